@@ -0,0 +1,231 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+type AlarmsOption struct {
+	Write          *bool
+	Rollback       *bool
+	ForceOverwrite *bool
+}
+
+// deploymentAlarmMetrics are metrics of target groups which indicate a broken deployment.
+var deploymentAlarmMetrics = map[string]bool{
+	"HTTPCode_Target_5XX_Count": true,
+	"HTTPCode_ELB_5XX_Count":    true,
+	"TargetResponseTime":        true,
+}
+
+// targetGroupDimension returns the value of the TargetGroup dimension of CloudWatch metrics for the target group ARN.
+// arn:aws:elasticloadbalancing:REGION:ACCOUNT:targetgroup/NAME/ID -> targetgroup/NAME/ID
+func targetGroupDimension(arn string) string {
+	if i := strings.Index(arn, ":targetgroup/"); i != -1 {
+		return arn[i+1:]
+	}
+	return ""
+}
+
+// isDeploymentAlarmCandidate reports whether the alarm watches 5xx errors or the response time of one of the target groups.
+func isDeploymentAlarmCandidate(a *cloudwatch.MetricAlarm, targetGroups map[string]bool) bool {
+	metrics := []*cloudwatch.Metric{{Namespace: a.Namespace, MetricName: a.MetricName, Dimensions: a.Dimensions}}
+	for _, m := range a.Metrics {
+		if m.MetricStat != nil && m.MetricStat.Metric != nil {
+			metrics = append(metrics, m.MetricStat.Metric)
+		}
+	}
+	for _, m := range metrics {
+		if aws.StringValue(m.Namespace) != "AWS/ApplicationELB" || !deploymentAlarmMetrics[aws.StringValue(m.MetricName)] {
+			continue
+		}
+		for _, dim := range m.Dimensions {
+			if aws.StringValue(dim.Name) == "TargetGroup" && targetGroups[aws.StringValue(dim.Value)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeDeploymentAlarms returns the deployment alarms configuration with the names appended to the configured ones,
+// and the names newly added. Enable and rollback of the configured alarms are kept.
+func mergeDeploymentAlarms(current *ecs.DeploymentAlarms, names []string, rollback bool) (*ecs.DeploymentAlarms, []string) {
+	merged := &ecs.DeploymentAlarms{Enable: aws.Bool(true), Rollback: aws.Bool(rollback)}
+	configured := map[string]bool{}
+	if current != nil {
+		merged.Enable = aws.Bool(aws.BoolValue(current.Enable))
+		merged.Rollback = aws.Bool(aws.BoolValue(current.Rollback))
+		for _, name := range current.AlarmNames {
+			configured[aws.StringValue(name)] = true
+			merged.AlarmNames = append(merged.AlarmNames, name)
+		}
+	}
+	var added []string
+	for _, name := range names {
+		if !configured[name] {
+			configured[name] = true
+			merged.AlarmNames = append(merged.AlarmNames, aws.String(name))
+			added = append(added, name)
+		}
+	}
+	return merged, added
+}
+
+// Alarms discovers CloudWatch alarms of target groups of the service and adds them to the deployment alarms configuration.
+func (d *App) Alarms(opt AlarmsOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	path := d.config.ServiceDefinitionPath
+	sv, err := d.LoadServiceDefinition(path)
+	if err != nil {
+		return err
+	}
+	if isCodeDeploy(sv.DeploymentController) {
+		return errors.New("deployment alarms are not supported for the CODE_DEPLOY deployment controller")
+	}
+	alarms, err := d.deploymentAlarmCandidates(ctx, sv.LoadBalancers)
+	if err != nil {
+		return err
+	}
+	if len(alarms) == 0 {
+		d.Log("No alarms of 5xx errors or response time of target groups of the service are found")
+		return nil
+	}
+	names := make([]string, 0, len(alarms))
+	d.Log("Alarms of target groups of the service:")
+	for _, a := range alarms {
+		names = append(names, aws.StringValue(a.AlarmName))
+		d.Log(fmt.Sprintf("%s%s (%s) %s", spcIndent, aws.StringValue(a.AlarmName), alarmMetricNames(a), aws.StringValue(a.StateValue)))
+	}
+
+	current := &ecs.DeploymentConfiguration{}
+	if sv.DeploymentConfiguration != nil {
+		current = sv.DeploymentConfiguration
+	}
+	merged, added := mergeDeploymentAlarms(current.Alarms, names, aws.BoolValue(opt.Rollback))
+	if len(added) == 0 {
+		d.Log("All of the alarms are already configured in deploymentConfiguration")
+		return nil
+	}
+	next := *current
+	next.Alarms = merged
+	fmt.Print(coloredDiff(diffStrings(MarshalJSONString(current), MarshalJSONString(&next), path, path, false)))
+
+	if !aws.BoolValue(opt.Write) {
+		d.Log("Run with --write to add the alarms to deploymentConfiguration of", path)
+		return nil
+	}
+	return d.writeDeploymentAlarms(path, names, aws.BoolValue(opt.Rollback), aws.BoolValue(opt.ForceOverwrite))
+}
+
+func alarmMetricNames(a *cloudwatch.MetricAlarm) string {
+	if a.MetricName != nil {
+		return aws.StringValue(a.MetricName)
+	}
+	var names []string
+	for _, m := range a.Metrics {
+		if m.MetricStat != nil && m.MetricStat.Metric != nil {
+			names = append(names, aws.StringValue(m.MetricStat.Metric.MetricName))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// deploymentAlarmCandidates returns metric alarms of the target groups sorted by names.
+func (d *App) deploymentAlarmCandidates(ctx context.Context, lbs []*ecs.LoadBalancer) ([]*cloudwatch.MetricAlarm, error) {
+	targetGroups := map[string]bool{}
+	for _, lb := range lbs {
+		if dim := targetGroupDimension(aws.StringValue(lb.TargetGroupArn)); dim != "" {
+			targetGroups[dim] = true
+		}
+	}
+	if len(targetGroups) == 0 {
+		return nil, nil
+	}
+	var alarms []*cloudwatch.MetricAlarm
+	err := d.cloudwatch.DescribeAlarmsPagesWithContext(ctx, &cloudwatch.DescribeAlarmsInput{},
+		func(out *cloudwatch.DescribeAlarmsOutput, _ bool) bool {
+			for _, a := range out.MetricAlarms {
+				if isDeploymentAlarmCandidate(a, targetGroups) {
+					alarms = append(alarms, a)
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe alarms")
+	}
+	sort.Slice(alarms, func(i, j int) bool {
+		return aws.StringValue(alarms[i].AlarmName) < aws.StringValue(alarms[j].AlarmName)
+	})
+	return alarms, nil
+}
+
+// writeDeploymentAlarms adds the alarms to deploymentConfiguration in the service definition file.
+// Only JSON files which can be parsed without rendering are rewritten, to keep templates in values.
+func (d *App) writeDeploymentAlarms(path string, names []string, rollback, force bool) error {
+	manually := fmt.Sprintf("add the alarms to deploymentConfiguration of %s manually", path)
+	if filepath.Ext(path) != jsonExt {
+		return errors.Errorf("unable to rewrite a non JSON file. %s", manually)
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", path)
+	}
+	// only deploymentConfiguration.alarms is rewritten, to keep keys unknown to ecspresso in the file
+	var sv map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+	if err := dec.Decode(&sv); err != nil {
+		return errors.Wrapf(err, "unable to parse the file without rendering. %s", manually)
+	}
+	dc, ok := sv["deploymentConfiguration"].(map[string]interface{})
+	if !ok {
+		if sv["deploymentConfiguration"] != nil {
+			return errors.Errorf("deploymentConfiguration is not an object. %s", manually)
+		}
+		dc = map[string]interface{}{}
+		sv["deploymentConfiguration"] = dc
+	}
+	var current *ecs.DeploymentAlarms
+	if v, ok := dc["alarms"]; ok && v != nil {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal deploymentConfiguration.alarms")
+		}
+		current = &ecs.DeploymentAlarms{}
+		if err := json.Unmarshal(b, current); err != nil {
+			return errors.Wrapf(err, "unable to parse deploymentConfiguration.alarms. %s", manually)
+		}
+	}
+	merged, _ := mergeDeploymentAlarms(current, names, rollback)
+	dc["alarms"] = map[string]interface{}{
+		"alarmNames": aws.StringValueSlice(merged.AlarmNames),
+		"enable":     aws.BoolValue(merged.Enable),
+		"rollback":   aws.BoolValue(merged.Rollback),
+	}
+	b, err := json.MarshalIndent(sv, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal service definition to JSON")
+	}
+	b = append(b, '\n')
+	d.Log("save service definition to", path)
+	if err := d.saveFile(path, b, CreateFileMode, force); err != nil {
+		return errors.Wrap(err, "failed to write file")
+	}
+	return nil
+}
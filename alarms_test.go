@@ -0,0 +1,148 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func newAlarmsApp(t *testing.T, clients ecspresso.AWSClients) *ecspresso.App {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestDeploymentAlarmCandidates(t *testing.T) {
+	tg := &cloudwatch.Dimension{Name: aws.String("TargetGroup"), Value: aws.String("targetgroup/test/12345678")}
+	lb := &cloudwatch.Dimension{Name: aws.String("LoadBalancer"), Value: aws.String("app/test/abcdef")}
+	cw := &fakeAlarmsCloudWatch{alarms: []*cloudwatch.MetricAlarm{
+		{
+			AlarmName:  aws.String("test-target-5xx"),
+			Namespace:  aws.String("AWS/ApplicationELB"),
+			MetricName: aws.String("HTTPCode_Target_5XX_Count"),
+			Dimensions: []*cloudwatch.Dimension{lb, tg},
+		},
+		{
+			AlarmName:  aws.String("test-healthy-hosts"),
+			Namespace:  aws.String("AWS/ApplicationELB"),
+			MetricName: aws.String("HealthyHostCount"),
+			Dimensions: []*cloudwatch.Dimension{lb, tg},
+		},
+		{
+			AlarmName:  aws.String("lb-5xx"),
+			Namespace:  aws.String("AWS/ApplicationELB"),
+			MetricName: aws.String("HTTPCode_ELB_5XX_Count"),
+			Dimensions: []*cloudwatch.Dimension{lb},
+		},
+		{
+			AlarmName: aws.String("test-latency"),
+			Metrics: []*cloudwatch.MetricDataQuery{{
+				Id: aws.String("m1"),
+				MetricStat: &cloudwatch.MetricStat{Metric: &cloudwatch.Metric{
+					Namespace:  aws.String("AWS/ApplicationELB"),
+					MetricName: aws.String("TargetResponseTime"),
+					Dimensions: []*cloudwatch.Dimension{lb, tg},
+				}},
+			}},
+		},
+		{
+			AlarmName:  aws.String("other-target-5xx"),
+			Namespace:  aws.String("AWS/ApplicationELB"),
+			MetricName: aws.String("HTTPCode_Target_5XX_Count"),
+			Dimensions: []*cloudwatch.Dimension{lb, {Name: aws.String("TargetGroup"), Value: aws.String("targetgroup/other/87654321")}},
+		},
+	}}
+	app := newAlarmsApp(t, ecspresso.AWSClients{ECS: &fakeECS{}, CloudWatch: cw})
+	alarms, err := app.DeploymentAlarmCandidates(context.Background(), []*ecs.LoadBalancer{
+		{TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:us-east-1:1111111111:targetgroup/test/12345678")},
+		{LoadBalancerName: aws.String("classic")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, a := range alarms {
+		names = append(names, aws.StringValue(a.AlarmName))
+	}
+	if expected := []string{"test-latency", "test-target-5xx"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected alarms %v expected %v", names, expected)
+	}
+}
+
+func TestMergeDeploymentAlarms(t *testing.T) {
+	merged, added := ecspresso.MergeDeploymentAlarms(nil, []string{"a", "b"}, true)
+	if !aws.BoolValue(merged.Enable) || !aws.BoolValue(merged.Rollback) || !reflect.DeepEqual(aws.StringValueSlice(merged.AlarmNames), []string{"a", "b"}) {
+		t.Errorf("unexpected alarms %s", merged)
+	}
+	if !reflect.DeepEqual(added, []string{"a", "b"}) {
+		t.Errorf("unexpected added %v", added)
+	}
+
+	current := &ecs.DeploymentAlarms{
+		Enable:     aws.Bool(false),
+		Rollback:   aws.Bool(false),
+		AlarmNames: aws.StringSlice([]string{"c", "b"}),
+	}
+	merged, added = ecspresso.MergeDeploymentAlarms(current, []string{"a", "b"}, true)
+	if aws.BoolValue(merged.Enable) || aws.BoolValue(merged.Rollback) {
+		t.Errorf("enable and rollback of the configured alarms must be kept %s", merged)
+	}
+	if names := aws.StringValueSlice(merged.AlarmNames); !reflect.DeepEqual(names, []string{"c", "b", "a"}) {
+		t.Errorf("unexpected alarm names %v", names)
+	}
+	if !reflect.DeepEqual(added, []string{"a"}) {
+		t.Errorf("unexpected added %v", added)
+	}
+}
+
+func TestWriteDeploymentAlarms(t *testing.T) {
+	dir := t.TempDir()
+	src, err := ioutil.ReadFile("tests/sv.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a key unknown to ecspresso must be kept
+	src = bytes.Replace(src, []byte("{"), []byte(`{"unknownAttribute": {"value": 1.50},`), 1)
+	path := filepath.Join(dir, "ecs-service-def.json")
+	if err := ioutil.WriteFile(path, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	app := newAlarmsApp(t, ecspresso.AWSClients{ECS: &fakeECS{}})
+	if err := app.WriteDeploymentAlarms(path, []string{"test-target-5xx"}, true); err != nil {
+		t.Fatal(err)
+	}
+	sv, err := app.LoadServiceDefinition(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alarms := sv.DeploymentConfiguration.Alarms
+	if !aws.BoolValue(alarms.Enable) || !aws.BoolValue(alarms.Rollback) || !reflect.DeepEqual(aws.StringValueSlice(alarms.AlarmNames), []string{"test-target-5xx"}) {
+		t.Errorf("unexpected alarms %s", alarms)
+	}
+	if aws.Int64Value(sv.DesiredCount) != 2 || len(sv.LoadBalancers) != 1 {
+		t.Errorf("other attributes must be kept %s", sv)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Contains(b, []byte(`"value": 1.50`)) {
+		t.Errorf("unknown keys must be kept as they are %s", string(b))
+	}
+
+	if err := app.WriteDeploymentAlarms(filepath.Join(dir, "ecs-service-def.jsonnet"), []string{"test-target-5xx"}, true); err == nil {
+		t.Error("rewriting a Jsonnet file must be an error")
+	}
+}
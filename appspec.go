@@ -1,12 +1,18 @@
 package ecspresso
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/kayac/ecspresso/appspec"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
 func (d *App) AppSpec(opt AppSpecOption) error {
@@ -33,15 +39,28 @@ func (d *App) AppSpec(opt AppSpecOption) error {
 			return errors.New("--task-definition requires current, latest or a valid task definition arn")
 		}
 	}
+	codeDeploy := isCodeDeploy(sv.DeploymentController)
 	if aws.BoolValue(opt.UpdateService) {
 		newSv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
 		if err != nil {
 			return err
 		}
-		sv = newSv
+		sv = &newSv.Service
 	}
 
-	spec, err := appspec.NewWithService(sv, taskDefinitionArn)
+	var lb *ecs.LoadBalancer
+	if codeDeploy {
+		dg, err := d.findDeploymentGroup(ctx)
+		if err != nil {
+			return err
+		}
+		if lb, err = d.appSpecLoadBalancer(ctx, sv, dg); err != nil {
+			return err
+		}
+	} else if len(sv.LoadBalancers) > 0 {
+		lb = sv.LoadBalancers[0]
+	}
+	spec, err := appspec.NewWithServiceLoadBalancer(sv, taskDefinitionArn, lb)
 	if err != nil {
 		return errors.Wrap(err, "failed to create appspec")
 	}
@@ -52,3 +71,200 @@ func (d *App) AppSpec(opt AppSpecOption) error {
 	fmt.Print(spec.String())
 	return nil
 }
+
+// appSpecLoadBalancer returns the load balancer of the service to shift traffic by the deployment group.
+// It validates that each target group pair of the deployment group is attached to the service, and that
+// the production and test listeners belong to the load balancer of the target groups of the service.
+func (d *App) appSpecLoadBalancer(ctx context.Context, sv *ecs.Service, dg *codedeploy.DeploymentGroupInfo) (*ecs.LoadBalancer, error) {
+	if len(sv.LoadBalancers) == 0 {
+		return nil, errors.New("require LoadBalancers")
+	}
+	if dg.LoadBalancerInfo == nil || len(dg.LoadBalancerInfo.TargetGroupPairInfoList) == 0 {
+		d.DebugLog("no target group pairs in the deployment group", aws.StringValue(dg.DeploymentGroupName))
+		return sv.LoadBalancers[0], nil
+	}
+
+	var tgArns []*string
+	for _, lb := range sv.LoadBalancers {
+		if lb.TargetGroupArn != nil {
+			tgArns = append(tgArns, lb.TargetGroupArn)
+		}
+	}
+	if len(tgArns) == 0 {
+		return sv.LoadBalancers[0], nil
+	}
+	out, err := d.elbv2.DescribeTargetGroupsWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: tgArns,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe target groups")
+	}
+	tgNames := make(map[string]string, len(out.TargetGroups))
+	lbArns := map[string]bool{}
+	for _, tg := range out.TargetGroups {
+		tgNames[aws.StringValue(tg.TargetGroupArn)] = aws.StringValue(tg.TargetGroupName)
+		for _, arn := range tg.LoadBalancerArns {
+			lbArns[aws.StringValue(arn)] = true
+		}
+	}
+
+	var selected *ecs.LoadBalancer
+	for _, pair := range dg.LoadBalancerInfo.TargetGroupPairInfoList {
+		var names []string
+		for _, tg := range pair.TargetGroups {
+			names = append(names, aws.StringValue(tg.Name))
+		}
+		pairName := strings.Join(names, ",")
+
+		var matched *ecs.LoadBalancer
+	LBS:
+		for _, lb := range sv.LoadBalancers {
+			for _, name := range names {
+				if tgNames[aws.StringValue(lb.TargetGroupArn)] == name {
+					matched = lb
+					break LBS
+				}
+			}
+		}
+		if matched == nil {
+			return nil, errors.Errorf("none of the target group pair %s is attached to the service", pairName)
+		}
+		if pair.ProdTrafficRoute == nil || len(pair.ProdTrafficRoute.ListenerArns) == 0 {
+			return nil, errors.Errorf("no production listener for the target group pair %s", pairName)
+		}
+		if err := d.validateTrafficRoute(ctx, "production", pair.ProdTrafficRoute, lbArns); err != nil {
+			return nil, errors.Wrapf(err, "invalid target group pair %s", pairName)
+		}
+		if pair.TestTrafficRoute != nil && len(pair.TestTrafficRoute.ListenerArns) > 0 {
+			if err := d.validateTrafficRoute(ctx, "test", pair.TestTrafficRoute, lbArns); err != nil {
+				return nil, errors.Wrapf(err, "invalid target group pair %s", pairName)
+			}
+		}
+		d.DebugLog(fmt.Sprintf("target group pair %s shifts traffic to %s:%d", pairName, aws.StringValue(matched.ContainerName), aws.Int64Value(matched.ContainerPort)))
+		if selected == nil {
+			selected = matched
+		}
+	}
+	return selected, nil
+}
+
+// validateTrafficRoute validates that listeners of the route belong to the load balancers.
+func (d *App) validateTrafficRoute(ctx context.Context, kind string, route *codedeploy.TrafficRoute, lbArns map[string]bool) error {
+	out, err := d.elbv2.DescribeListenersWithContext(ctx, &elbv2.DescribeListenersInput{
+		ListenerArns: route.ListenerArns,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to describe %s listeners", kind)
+	}
+	for _, l := range out.Listeners {
+		if !lbArns[aws.StringValue(l.LoadBalancerArn)] {
+			return errors.Errorf(
+				"%s listener %s does not belong to the load balancer of the service",
+				kind, aws.StringValue(l.ListenerArn),
+			)
+		}
+	}
+	return nil
+}
+
+// lastSucceededAppSpec returns the AppSpec of the last succeeded deployment in the deployment group, and the ID of the deployment.
+// It returns nil when no deployments have succeeded.
+func (d *App) lastSucceededAppSpec(ctx context.Context, dg *codedeploy.DeploymentGroupInfo) (*appspec.AppSpec, string, error) {
+	// ListDeployments does not guarantee the order of deployments
+	var ids []*string
+	err := d.codedeploy.ListDeploymentsPagesWithContext(ctx, &codedeploy.ListDeploymentsInput{
+		ApplicationName:     dg.ApplicationName,
+		DeploymentGroupName: dg.DeploymentGroupName,
+		IncludeOnlyStatuses: aws.StringSlice([]string{codedeploy.DeploymentStatusSucceeded}),
+	}, func(out *codedeploy.ListDeploymentsOutput, _ bool) bool {
+		ids = append(ids, out.Deployments...)
+		return true
+	})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to list deployments")
+	}
+	infos, err := d.batchGetDeployments(ctx, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	var latest *codedeploy.DeploymentInfo
+	for _, info := range infos {
+		if latest == nil || aws.TimeValue(info.CreateTime).After(aws.TimeValue(latest.CreateTime)) {
+			latest = info
+		}
+	}
+	if latest == nil {
+		return nil, "", nil
+	}
+	id := aws.StringValue(latest.DeploymentId)
+	rev := latest.Revision
+	if rev == nil || rev.AppSpecContent == nil || rev.AppSpecContent.Content == nil {
+		out, err := d.codedeploy.GetApplicationRevisionWithContext(ctx, &codedeploy.GetApplicationRevisionInput{
+			ApplicationName: dg.ApplicationName,
+			Revision:        rev,
+		})
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "failed to get the revision of deployment %s", id)
+		}
+		rev = out.Revision
+	}
+	if rev == nil || rev.AppSpecContent == nil {
+		return nil, "", errors.Errorf("deployment %s has no AppSpec content", id)
+	}
+	var spec appspec.AppSpec
+	if err := yaml.Unmarshal([]byte(aws.StringValue(rev.AppSpecContent.Content)), &spec); err != nil {
+		return nil, "", errors.Wrapf(err, "failed to parse AppSpec of deployment %s", id)
+	}
+	return &spec, id, nil
+}
+
+// diffAppSpec returns differences of the AppSpec for the service definition from the AppSpec of the last succeeded deployment.
+// The task definitions are not compared because a new revision is registered by each deployment.
+func (d *App) diffAppSpec(ctx context.Context, sv *Service, unified bool) (string, error) {
+	dg, err := d.findDeploymentGroup(ctx)
+	if err != nil {
+		return "", err
+	}
+	remote, id, err := d.lastSucceededAppSpec(ctx, dg)
+	if err != nil || remote == nil {
+		return "", err
+	}
+	var tdArn string
+	for _, r := range remote.Resources {
+		if r.TargetService != nil && r.TargetService.Properties != nil {
+			tdArn = aws.StringValue(r.TargetService.Properties.TaskDefinition)
+		}
+	}
+	lb, err := d.appSpecLoadBalancer(ctx, &sv.Service, dg)
+	if err != nil {
+		return "", err
+	}
+	spec, err := appspec.NewWithServiceLoadBalancer(&sv.Service, tdArn, lb)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create appspec")
+	}
+	if d.config.AppSpec != nil {
+		spec.Hooks = d.config.AppSpec.Hooks
+	}
+	sortAppSpecForDiff(remote)
+	sortAppSpecForDiff(spec)
+	return diffStrings(remote.String(), spec.String(), "appspec of deployment "+id, "appspec", unified), nil
+}
+
+// sortAppSpecForDiff sorts subnets and security groups, whose order is not significant.
+func sortAppSpecForDiff(spec *appspec.AppSpec) {
+	for _, r := range spec.Resources {
+		if r.TargetService == nil || r.TargetService.Properties == nil {
+			continue
+		}
+		nc := r.TargetService.Properties.NetworkConfiguration
+		if nc == nil || nc.AwsvpcConfiguration == nil {
+			continue
+		}
+		for _, ss := range [][]*string{nc.AwsvpcConfiguration.Subnets, nc.AwsvpcConfiguration.SecurityGroups} {
+			sort.Slice(ss, func(i, j int) bool {
+				return aws.StringValue(ss[i]) < aws.StringValue(ss[j])
+			})
+		}
+	}
+}
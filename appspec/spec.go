@@ -34,6 +34,15 @@ func NewWithService(sv *ecs.Service, tdArn string) (*AppSpec, error) {
 	if len(sv.LoadBalancers) == 0 {
 		return nil, errors.New("require LoadBalancers")
 	}
+	return NewWithServiceLoadBalancer(sv, tdArn, sv.LoadBalancers[0])
+}
+
+// NewWithServiceLoadBalancer creates an AppSpec which shifts traffic to the container of the load balancer.
+// It is used for the service attached to multiple target groups.
+func NewWithServiceLoadBalancer(sv *ecs.Service, tdArn string, lb *ecs.LoadBalancer) (*AppSpec, error) {
+	if lb == nil {
+		return nil, errors.New("require LoadBalancers")
+	}
 	spec := New()
 	resource := &Resource{
 		TargetService: &TargetService{
@@ -41,8 +50,8 @@ func NewWithService(sv *ecs.Service, tdArn string) (*AppSpec, error) {
 			Properties: &Properties{
 				TaskDefinition: aws.String(tdArn),
 				LoadBalancerInfo: &LoadBalancerInfo{
-					ContainerName: sv.LoadBalancers[0].ContainerName,
-					ContainerPort: sv.LoadBalancers[0].ContainerPort,
+					ContainerName: lb.ContainerName,
+					ContainerPort: lb.ContainerPort,
 				},
 				PlatformVersion: sv.PlatformVersion,
 			},
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/google/go-cmp/cmp"
 	"github.com/kayac/ecspresso/appspec"
 	"github.com/kayac/go-config"
@@ -70,3 +71,23 @@ func TestAppSpec(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestNewWithServiceLoadBalancer(t *testing.T) {
+	sv := &ecs.Service{
+		LoadBalancers: []*ecs.LoadBalancer{
+			{ContainerName: aws.String("admin"), ContainerPort: aws.Int64(8080)},
+			{ContainerName: aws.String("web"), ContainerPort: aws.Int64(80)},
+		},
+	}
+	spec, err := appspec.NewWithServiceLoadBalancer(sv, "arn:aws:ecs:us-east-1:111222333444:task-definition/test:1", sv.LoadBalancers[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := spec.Resources[0].TargetService.Properties.LoadBalancerInfo
+	if aws.StringValue(info.ContainerName) != "web" || aws.Int64Value(info.ContainerPort) != 80 {
+		t.Errorf("unexpected load balancer info %#v", info)
+	}
+	if _, err := appspec.NewWithServiceLoadBalancer(sv, "", nil); err == nil {
+		t.Error("expected an error without a load balancer")
+	}
+}
@@ -0,0 +1,258 @@
+package ecspresso_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/codedeploy/codedeployiface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/kayac/ecspresso"
+	"github.com/kayac/ecspresso/appspec"
+)
+
+const (
+	testLBArn      = "arn:aws:elasticloadbalancing:ap-northeast-1:123456789012:loadbalancer/app/web/1"
+	testOtherLBArn = "arn:aws:elasticloadbalancing:ap-northeast-1:123456789012:loadbalancer/app/other/2"
+)
+
+type fakeAppSpecELBv2 struct {
+	elbv2iface.ELBV2API
+}
+
+func (f *fakeAppSpecELBv2) DescribeTargetGroupsWithContext(_ aws.Context, in *elbv2.DescribeTargetGroupsInput, _ ...request.Option) (*elbv2.DescribeTargetGroupsOutput, error) {
+	out := &elbv2.DescribeTargetGroupsOutput{}
+	for _, arn := range in.TargetGroupArns {
+		name := aws.StringValue(arn)[strings.LastIndex(aws.StringValue(arn), "/")+1:]
+		out.TargetGroups = append(out.TargetGroups, &elbv2.TargetGroup{
+			TargetGroupArn:   arn,
+			TargetGroupName:  aws.String(name),
+			LoadBalancerArns: aws.StringSlice([]string{testLBArn}),
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeAppSpecELBv2) DescribeListenersWithContext(_ aws.Context, in *elbv2.DescribeListenersInput, _ ...request.Option) (*elbv2.DescribeListenersOutput, error) {
+	out := &elbv2.DescribeListenersOutput{}
+	for _, arn := range in.ListenerArns {
+		lbArn := testLBArn
+		if strings.Contains(aws.StringValue(arn), "other") {
+			lbArn = testOtherLBArn
+		}
+		out.Listeners = append(out.Listeners, &elbv2.Listener{ListenerArn: arn, LoadBalancerArn: aws.String(lbArn)})
+	}
+	return out, nil
+}
+
+func testTargetGroupPair(blue, green, prod, test string) *codedeploy.TargetGroupPairInfo {
+	pair := &codedeploy.TargetGroupPairInfo{
+		TargetGroups: []*codedeploy.TargetGroupInfo{
+			{Name: aws.String(blue)},
+			{Name: aws.String(green)},
+		},
+		ProdTrafficRoute: &codedeploy.TrafficRoute{ListenerArns: aws.StringSlice([]string{prod})},
+	}
+	if test != "" {
+		pair.TestTrafficRoute = &codedeploy.TrafficRoute{ListenerArns: aws.StringSlice([]string{test})}
+	}
+	return pair
+}
+
+func TestAppSpecLoadBalancer(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ELBv2: &fakeAppSpecELBv2{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := &ecs.Service{
+		LoadBalancers: []*ecs.LoadBalancer{
+			{ContainerName: aws.String("admin"), ContainerPort: aws.Int64(8080), TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:ap-northeast-1:123456789012:targetgroup/admin-blue")},
+			{ContainerName: aws.String("web"), ContainerPort: aws.Int64(80), TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:ap-northeast-1:123456789012:targetgroup/web-green")},
+		},
+	}
+	testCases := []struct {
+		name      string
+		pairs     []*codedeploy.TargetGroupPairInfo
+		container string
+		err       string
+	}{
+		{
+			name:      "no pairs",
+			container: "admin",
+		},
+		{
+			name: "multiple pairs",
+			pairs: []*codedeploy.TargetGroupPairInfo{
+				testTargetGroupPair("web-blue", "web-green", "listener/app/web/1/prod", "listener/app/web/1/test"),
+				testTargetGroupPair("admin-blue", "admin-green", "listener/app/web/1/admin", ""),
+			},
+			container: "web",
+		},
+		{
+			name: "not attached",
+			pairs: []*codedeploy.TargetGroupPairInfo{
+				testTargetGroupPair("api-blue", "api-green", "listener/app/web/1/prod", ""),
+			},
+			err: "none of the target group pair api-blue,api-green is attached to the service",
+		},
+		{
+			name: "test listener of other load balancer",
+			pairs: []*codedeploy.TargetGroupPairInfo{
+				testTargetGroupPair("web-blue", "web-green", "listener/app/web/1/prod", "listener/app/other/2/test"),
+			},
+			err: "test listener listener/app/other/2/test does not belong to the load balancer of the service",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dg := &codedeploy.DeploymentGroupInfo{DeploymentGroupName: aws.String("dg")}
+			if tc.pairs != nil {
+				dg.LoadBalancerInfo = &codedeploy.LoadBalancerInfo{TargetGroupPairInfoList: tc.pairs}
+			}
+			lb, err := app.AppSpecLoadBalancer(context.Background(), sv, dg)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := aws.StringValue(lb.ContainerName); got != tc.container {
+				t.Errorf("expected container %s, got %s", tc.container, got)
+			}
+		})
+	}
+}
+
+type fakeAppSpecCodeDeploy struct {
+	codedeployiface.CodeDeployAPI
+	content string
+}
+
+func (f *fakeAppSpecCodeDeploy) ListApplicationsWithContext(_ aws.Context, _ *codedeploy.ListApplicationsInput, _ ...request.Option) (*codedeploy.ListApplicationsOutput, error) {
+	return &codedeploy.ListApplicationsOutput{Applications: aws.StringSlice([]string{"app"})}, nil
+}
+
+func (f *fakeAppSpecCodeDeploy) BatchGetApplicationsWithContext(_ aws.Context, _ *codedeploy.BatchGetApplicationsInput, _ ...request.Option) (*codedeploy.BatchGetApplicationsOutput, error) {
+	return &codedeploy.BatchGetApplicationsOutput{ApplicationsInfo: []*codedeploy.ApplicationInfo{
+		{ApplicationName: aws.String("app"), ComputePlatform: aws.String("ECS")},
+	}}, nil
+}
+
+func (f *fakeAppSpecCodeDeploy) ListDeploymentGroupsWithContext(_ aws.Context, _ *codedeploy.ListDeploymentGroupsInput, _ ...request.Option) (*codedeploy.ListDeploymentGroupsOutput, error) {
+	return &codedeploy.ListDeploymentGroupsOutput{DeploymentGroups: aws.StringSlice([]string{"dg"})}, nil
+}
+
+func (f *fakeAppSpecCodeDeploy) BatchGetDeploymentGroupsWithContext(_ aws.Context, _ *codedeploy.BatchGetDeploymentGroupsInput, _ ...request.Option) (*codedeploy.BatchGetDeploymentGroupsOutput, error) {
+	return &codedeploy.BatchGetDeploymentGroupsOutput{DeploymentGroupsInfo: []*codedeploy.DeploymentGroupInfo{{
+		DeploymentGroupName: aws.String("dg"),
+		EcsServices:         []*codedeploy.ECSService{{ClusterName: aws.String("default2"), ServiceName: aws.String("test")}},
+	}}}, nil
+}
+
+func (f *fakeAppSpecCodeDeploy) ListDeploymentsPagesWithContext(_ aws.Context, in *codedeploy.ListDeploymentsInput, fn func(*codedeploy.ListDeploymentsOutput, bool) bool, _ ...request.Option) error {
+	if f.content == "" {
+		fn(&codedeploy.ListDeploymentsOutput{}, true)
+		return nil
+	}
+	// not ordered by the creation time
+	if fn(&codedeploy.ListDeploymentsOutput{Deployments: aws.StringSlice([]string{"d-OLD"})}, false) {
+		fn(&codedeploy.ListDeploymentsOutput{Deployments: aws.StringSlice([]string{"d-LAST", "d-OLDER"})}, true)
+	}
+	return nil
+}
+
+func (f *fakeAppSpecCodeDeploy) BatchGetDeploymentsWithContext(_ aws.Context, in *codedeploy.BatchGetDeploymentsInput, _ ...request.Option) (*codedeploy.BatchGetDeploymentsOutput, error) {
+	created := map[string]time.Time{
+		"d-OLDER": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"d-OLD":   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"d-LAST":  time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+	}
+	out := &codedeploy.BatchGetDeploymentsOutput{}
+	for _, id := range aws.StringValueSlice(in.DeploymentIds) {
+		content := strings.Replace(f.content, "ContainerPort: 9999", "ContainerPort: 80", 1)
+		if id == "d-LAST" {
+			content = f.content
+		}
+		out.DeploymentsInfo = append(out.DeploymentsInfo, &codedeploy.DeploymentInfo{
+			DeploymentId: aws.String(id),
+			CreateTime:   aws.Time(created[id]),
+			Revision: &codedeploy.RevisionLocation{
+				RevisionType:   aws.String("AppSpecContent"),
+				AppSpecContent: &codedeploy.AppSpecContent{Content: aws.String(content)},
+			},
+		})
+	}
+	return out, nil
+}
+
+const testLastAppSpec = `version: 0.0
+Resources:
+- TargetService:
+    Type: AWS::ECS::Service
+    Properties:
+      TaskDefinition: arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1
+      LoadBalancerInfo:
+        ContainerName: test
+        ContainerPort: 9999
+      NetworkConfiguration:
+        AwsvpcConfiguration:
+          AssignPublicIp: ENABLED
+          SecurityGroups:
+          - sg-23456789
+          - sg-12345678
+          Subnets:
+          - subnet-abcdef00
+          - subnet-abcdef01
+`
+
+func TestDiffAppSpec(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.AppSpec = &appspec.AppSpec{Hooks: []*appspec.Hook{{BeforeAllowTraffic: "check"}}}
+	cd := &fakeAppSpecCodeDeploy{content: testLastAppSpec}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{CodeDeploy: cd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := app.LoadServiceDefinition(conf.ServiceDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := app.DiffAppSpec(context.Background(), sv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ds, "+Hooks:") || !strings.Contains(ds, "+- BeforeAllowTraffic: check") {
+		t.Errorf("hooks are not shown in the diff:\n%s", ds)
+	}
+	for _, line := range strings.Split(ds, "\n")[2:] {
+		if (strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+")) && !strings.Contains(line, "Hooks") && !strings.Contains(line, "BeforeAllowTraffic") {
+			t.Errorf("unexpected diff %s:\n%s", line, ds)
+		}
+	}
+
+	conf.AppSpec = nil
+	if ds, err := app.DiffAppSpec(context.Background(), sv, true); err != nil || ds != "" {
+		t.Errorf("no differences are expected: %s %v", ds, err)
+	}
+
+	cd.content = ""
+	if ds, err := app.DiffAppSpec(context.Background(), sv, true); err != nil || ds != "" {
+		t.Errorf("no diff is expected without succeeded deployments: %s %v", ds, err)
+	}
+}
@@ -0,0 +1,211 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+)
+
+// ArtifactHashTagKey is the key of the task definition tag which records the SHA-256 digest of the rendered task definition.
+const ArtifactHashTagKey = "ecspresso:rendered-sha256"
+
+// Names of files stored as artifacts of a deployment.
+const (
+	artifactTaskDefinition    = "task-definition.json"
+	artifactServiceDefinition = "service-definition.json"
+	artifactManifest          = "manifest.json"
+)
+
+// ArtifactsConfig represents a configuration of the storage of rendered definitions used for deployments.
+type ArtifactsConfig struct {
+	S3  *ArtifactsS3Config `yaml:"s3,omitempty"`
+	Dir string             `yaml:"dir,omitempty"`
+}
+
+// ArtifactsS3Config represents a configuration of artifacts stored to S3.
+type ArtifactsS3Config struct {
+	Bucket string `yaml:"bucket"`
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+func (c *ArtifactsConfig) validate() error {
+	switch {
+	case c.S3 != nil && c.Dir != "":
+		return errors.New("artifacts.s3 and artifacts.dir can not be specified at the same time")
+	case c.S3 != nil:
+		if c.S3.Bucket == "" {
+			return errors.New("artifacts.s3.bucket is required")
+		}
+	case c.Dir == "":
+		return errors.New("artifacts.s3 or artifacts.dir is required")
+	}
+	return nil
+}
+
+// ArtifactManifest represents the manifest of artifacts stored for a revision of the task definition.
+type ArtifactManifest struct {
+	TaskDefinition string            `json:"task_definition"`
+	Cluster        string            `json:"cluster"`
+	Service        string            `json:"service"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Files          map[string]string `json:"files"`
+}
+
+// deployArtifacts holds rendered definitions to be stored for a deployment.
+type deployArtifacts struct {
+	taskDefinition []byte
+	sha256         string
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// newDeployArtifacts renders the task definition to be registered and records its digest as the tag of the task definition.
+// The digest is calculated from the task definition without the tag itself.
+// It returns nil when artifacts are not configured.
+func (d *App) newDeployArtifacts(td *TaskDefinitionInput) (*deployArtifacts, error) {
+	if d.config.Artifacts == nil {
+		return nil, nil
+	}
+	td.Tags = withoutArtifactHashTag(td.Tags)
+	b, err := MarshalJSON(td)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render the task definition for artifacts")
+	}
+	a := &deployArtifacts{taskDefinition: b, sha256: sha256Hex(b)}
+	td.Tags = append(td.Tags, &ecs.Tag{Key: aws.String(ArtifactHashTagKey), Value: aws.String(a.sha256)})
+	return a, nil
+}
+
+// withoutArtifactHashTag returns the tags except the tag of the digest recorded by the artifacts.
+func withoutArtifactHashTag(tags []*ecs.Tag) []*ecs.Tag {
+	var ts []*ecs.Tag
+	for _, t := range tags {
+		if aws.StringValue(t.Key) != ArtifactHashTagKey {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// putDeployArtifacts stores the rendered definitions and the manifest for the registered revision of the task definition.
+// sv is nil when the service definition is not deployed.
+func (d *App) putDeployArtifacts(ctx context.Context, a *deployArtifacts, tdArn string, sv *Service) error {
+	if a == nil {
+		return nil
+	}
+	store := d.artifactStore()
+	dir := path.Join(taskDefinitionFamily(tdArn), taskDefinitionRevision(tdArn))
+	m := ArtifactManifest{
+		TaskDefinition: arnToName(tdArn),
+		Cluster:        d.Cluster,
+		Service:        d.Service,
+		CreatedAt:      time.Now(),
+		Files:          map[string]string{artifactTaskDefinition: a.sha256},
+	}
+	files := map[string][]byte{artifactTaskDefinition: a.taskDefinition}
+	if sv != nil {
+		b, err := MarshalJSON(sv)
+		if err != nil {
+			return errors.Wrap(err, "failed to render the service definition for artifacts")
+		}
+		files[artifactServiceDefinition] = b
+		m.Files[artifactServiceDefinition] = sha256Hex(b)
+	}
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the manifest of artifacts")
+	}
+	// the manifest is stored at last, so its existence means that all files are stored
+	for _, name := range []string{artifactTaskDefinition, artifactServiceDefinition} {
+		if b, ok := files[name]; ok {
+			if err := store.put(ctx, path.Join(dir, name), b); err != nil {
+				return err
+			}
+		}
+	}
+	if err := store.put(ctx, path.Join(dir, artifactManifest), append(mb, '\n')); err != nil {
+		return err
+	}
+	d.Log("Rendered definitions are stored to", store.url(dir))
+	return nil
+}
+
+// taskDefinitionRevision returns the revision of the task definition ARN.
+func taskDefinitionRevision(tdArn string) string {
+	p := strings.SplitN(arnToName(tdArn), ":", 2)
+	if len(p) < 2 {
+		return ""
+	}
+	return p[1]
+}
+
+type artifactStore interface {
+	put(ctx context.Context, name string, b []byte) error
+	url(name string) string
+}
+
+func (d *App) artifactStore() artifactStore {
+	if c := d.config.Artifacts.S3; c != nil {
+		return &s3ArtifactStore{config: c, s3: d.s3}
+	}
+	return &dirArtifactStore{dir: d.config.Artifacts.Dir}
+}
+
+type s3ArtifactStore struct {
+	config *ArtifactsS3Config
+	s3     s3iface.S3API
+}
+
+func (s *s3ArtifactStore) url(name string) string {
+	return fmt.Sprintf("s3://%s/%s", s.config.Bucket, path.Join(s.config.Prefix, name))
+}
+
+func (s *s3ArtifactStore) put(ctx context.Context, name string, b []byte) error {
+	_, err := s.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.config.Bucket),
+		Key:         aws.String(path.Join(s.config.Prefix, name)),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to put the artifact to %s", s.url(name))
+	}
+	return nil
+}
+
+type dirArtifactStore struct {
+	dir string
+}
+
+func (s *dirArtifactStore) url(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+func (s *dirArtifactStore) put(_ context.Context, name string, b []byte) error {
+	p := s.url(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create the directory for the artifact %s", p)
+	}
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write the artifact %s", p)
+	}
+	return nil
+}
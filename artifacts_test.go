@@ -0,0 +1,97 @@
+package ecspresso_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestDeployArtifacts(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	dir, err := ioutil.TempDir("", "ecspresso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	conf.Artifacts = &ecspresso.ArtifactsConfig{Dir: dir}
+	fake := &fakeECS{
+		service: &ecs.Service{
+			ServiceName:    aws.String("test"),
+			ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+			DesiredCount:   aws.Int64(1),
+		},
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:                    fake,
+		ApplicationAutoScaling: &fakeAutoScaling{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DeployWithContext(context.Background(), ecspresso.DeployOption{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var tag string
+	for _, t := range fake.registered.Tags {
+		if aws.StringValue(t.Key) == ecspresso.ArtifactHashTagKey {
+			tag = aws.StringValue(t.Value)
+		}
+	}
+	revDir := filepath.Join(dir, aws.StringValue(fake.registered.Family), "2")
+	b, err := ioutil.ReadFile(filepath.Join(revDir, "task-definition.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+	if h := hex.EncodeToString(sum[:]); tag == "" || h != tag {
+		t.Errorf("the tag %s must be the digest %s of the artifact", tag, h)
+	}
+
+	mb, err := ioutil.ReadFile(filepath.Join(revDir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m ecspresso.ArtifactManifest
+	if err := json.Unmarshal(mb, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.TaskDefinition != aws.StringValue(fake.registered.Family)+":2" || m.Files["task-definition.json"] != tag {
+		t.Errorf("unexpected manifest %#v", m)
+	}
+	if _, ok := m.Files["service-definition.json"]; ok {
+		t.Error("the service definition must not be stored without --update-service")
+	}
+}
+
+func TestArtifactsConfigValidation(t *testing.T) {
+	for _, c := range []*ecspresso.ArtifactsConfig{
+		{},
+		{S3: &ecspresso.ArtifactsS3Config{}},
+		{S3: &ecspresso.ArtifactsS3Config{Bucket: "b"}, Dir: "artifacts"},
+	} {
+		conf := ecspresso.NewDefaultConfig()
+		conf.Artifacts = c
+		if err := conf.Restrict(); err == nil {
+			t.Errorf("%#v must be invalid", c)
+		}
+	}
+}
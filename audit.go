@@ -0,0 +1,196 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+const auditTimeout = 30 * time.Second
+
+// Outcomes of the audit record.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditConfig represents a configuration of the audit log sinks.
+type AuditConfig struct {
+	S3       *AuditS3Config       `yaml:"s3,omitempty"`
+	DynamoDB *AuditDynamoDBConfig `yaml:"dynamodb,omitempty"`
+}
+
+// AuditS3Config represents a configuration of the audit log stored to S3.
+type AuditS3Config struct {
+	Bucket string `yaml:"bucket"`
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+// AuditDynamoDBConfig represents a configuration of the audit log stored to DynamoDB.
+type AuditDynamoDBConfig struct {
+	Table string `yaml:"table"`
+}
+
+// AuditRecord represents a record of the state-changing command.
+type AuditRecord struct {
+	ID                string    `json:"id"`
+	Command           string    `json:"command"`
+	Cluster           string    `json:"cluster"`
+	Service           string    `json:"service"`
+	CallerArn         string    `json:"caller_arn,omitempty"`
+	User              string    `json:"user,omitempty"`
+	StartedAt         time.Time `json:"started_at"`
+	FinishedAt        time.Time `json:"finished_at"`
+	Outcome           string    `json:"outcome"`
+	Error             string    `json:"error,omitempty"`
+	TaskDefinition    string    `json:"task_definition,omitempty"`
+	ServiceDefinition string    `json:"service_definition,omitempty"`
+	Diff              string    `json:"diff,omitempty"`
+}
+
+// auditOption specifies the definition files rendered into the audit record.
+type auditOption struct {
+	taskDefinitionPath    string
+	serviceDefinitionPath string
+	diff                  bool
+}
+
+type auditSink interface {
+	put(ctx context.Context, r *AuditRecord) error
+}
+
+func newAuditSinks(c *AuditConfig, sess *session.Session) []auditSink {
+	var sinks []auditSink
+	if c == nil {
+		return sinks
+	}
+	if c.S3 != nil {
+		sinks = append(sinks, &s3AuditSink{config: c.S3, s3: s3.New(sess)})
+	}
+	if c.DynamoDB != nil {
+		sinks = append(sinks, &dynamodbAuditSink{config: c.DynamoDB, dynamodb: dynamodb.New(sess)})
+	}
+	return sinks
+}
+
+// startAudit creates an audit record before the command changes any resources.
+// It returns nil when no audit sinks are configured.
+func (d *App) startAudit(ctx context.Context, command string, opt auditOption) *AuditRecord {
+	if len(d.auditSinks) == 0 {
+		return nil
+	}
+	now := time.Now()
+	r := &AuditRecord{
+		ID:        fmt.Sprintf("%s/%s/%s", d.Cluster, d.Service, now.UTC().Format(time.RFC3339Nano)),
+		Command:   command,
+		Cluster:   d.Cluster,
+		Service:   d.Service,
+		User:      currentUser(),
+		StartedAt: now,
+	}
+	if out, err := d.sts.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+		d.Log("WARNING: failed to get caller identity for audit", err)
+	} else {
+		r.CallerArn = aws.StringValue(out.Arn)
+	}
+	if p := opt.taskDefinitionPath; p != "" {
+		if td, err := d.LoadTaskDefinition(p); err == nil {
+			r.TaskDefinition = MarshalJSONString(td)
+		}
+	}
+	if p := opt.serviceDefinitionPath; p != "" {
+		if sv, err := d.LoadServiceDefinition(p); err == nil {
+			r.ServiceDefinition = MarshalJSONString(sv)
+		}
+	}
+	if opt.diff {
+		if diffs, err := d.diffs(ctx, true); err != nil {
+			d.Log("WARNING: failed to diff for audit", err)
+		} else {
+			r.Diff = strings.Join(diffs, "")
+		}
+	}
+	return r
+}
+
+// finishAudit puts the audit record with the outcome to all sinks.
+// Failures are logged and never change the result of the command.
+func (d *App) finishAudit(r *AuditRecord, err error) {
+	if r == nil {
+		return
+	}
+	r.FinishedAt = time.Now()
+	r.Outcome = AuditOutcomeSuccess
+	if err != nil {
+		r.Outcome = AuditOutcomeFailure
+		r.Error = err.Error()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+	for _, s := range d.auditSinks {
+		if err := s.put(ctx, r); err != nil {
+			d.Log("WARNING: failed to put audit record", err)
+		}
+	}
+}
+
+type s3AuditSink struct {
+	config *AuditS3Config
+	s3     *s3.S3
+}
+
+func (s *s3AuditSink) key(r *AuditRecord) string {
+	name := fmt.Sprintf("%s-%s-%s-%s.json",
+		r.StartedAt.UTC().Format("20060102T150405.000Z"), r.Cluster, r.Service, r.Command,
+	)
+	return path.Join(s.config.Prefix, r.StartedAt.UTC().Format("2006/01/02"), name)
+}
+
+func (s *s3AuditSink) put(ctx context.Context, r *AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit record")
+	}
+	_, err = s.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.config.Bucket),
+		Key:         aws.String(s.key(r)),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to put audit record to s3://%s", s.config.Bucket)
+	}
+	return nil
+}
+
+type dynamodbAuditSink struct {
+	config   *AuditDynamoDBConfig
+	dynamodb *dynamodb.DynamoDB
+}
+
+func (s *dynamodbAuditSink) put(ctx context.Context, r *AuditRecord) error {
+	item, err := dynamodbattribute.MarshalMap(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit record")
+	}
+	_, err = s.dynamodb.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.config.Table),
+		Item:      item,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to put audit record to DynamoDB table %s", s.config.Table)
+	}
+	return nil
+}
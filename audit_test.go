@@ -0,0 +1,36 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/kayac/ecspresso"
+)
+
+func TestDeployCommandName(t *testing.T) {
+	for _, c := range []struct {
+		opt      ecspresso.DeployOption
+		expected string
+	}{
+		{
+			opt:      ecspresso.DeployOption{SkipTaskDefinition: aws.Bool(false), UpdateService: aws.Bool(true), DesiredCount: aws.Int64(-1)},
+			expected: "deploy",
+		},
+		{
+			opt:      ecspresso.DeployOption{SkipTaskDefinition: aws.Bool(true), UpdateService: aws.Bool(true), DesiredCount: aws.Int64(-1)},
+			expected: "deploy",
+		},
+		{
+			opt:      ecspresso.DeployOption{SkipTaskDefinition: aws.Bool(true), UpdateService: aws.Bool(false), DesiredCount: aws.Int64(3)},
+			expected: "scale",
+		},
+		{
+			opt:      ecspresso.DeployOption{SkipTaskDefinition: aws.Bool(true), UpdateService: aws.Bool(false), ForceNewDeployment: aws.Bool(true)},
+			expected: "refresh",
+		},
+	} {
+		if name := ecspresso.DeployCommandName(c.opt); name != c.expected {
+			t.Errorf("expected %s got %s for %#v", c.expected, name, c.opt)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/pkg/errors"
+)
+
+const (
+	autoScalingServiceNamespace  = "ecs"
+	autoScalingScalableDimension = "ecs:service:DesiredCount"
+)
+
+// AutoScalingDefinition represents a definition of Application Auto Scaling for the service.
+type AutoScalingDefinition struct {
+	ScalableTarget   *ScalableTargetDefinition    `json:"scalableTarget,omitempty" locationName:"scalableTarget"`
+	ScalingPolicies  []*ScalingPolicyDefinition   `json:"scalingPolicies,omitempty" locationName:"scalingPolicies"`
+	ScheduledActions []*ScheduledActionDefinition `json:"scheduledActions,omitempty" locationName:"scheduledActions"`
+}
+
+// ScalableTargetDefinition represents a scalable target of the service.
+type ScalableTargetDefinition struct {
+	MinCapacity *int64  `json:"minCapacity,omitempty" locationName:"minCapacity"`
+	MaxCapacity *int64  `json:"maxCapacity,omitempty" locationName:"maxCapacity"`
+	RoleARN     *string `json:"roleARN,omitempty" locationName:"roleARN"`
+}
+
+// ScalingPolicyDefinition represents a scaling policy of the service.
+type ScalingPolicyDefinition struct {
+	PolicyName                               *string                                                          `json:"policyName" locationName:"policyName"`
+	PolicyType                               *string                                                          `json:"policyType" locationName:"policyType"`
+	StepScalingPolicyConfiguration           *applicationautoscaling.StepScalingPolicyConfiguration           `json:"stepScalingPolicyConfiguration,omitempty" locationName:"stepScalingPolicyConfiguration"`
+	TargetTrackingScalingPolicyConfiguration *applicationautoscaling.TargetTrackingScalingPolicyConfiguration `json:"targetTrackingScalingPolicyConfiguration,omitempty" locationName:"targetTrackingScalingPolicyConfiguration"`
+}
+
+// ScheduledActionDefinition represents a scheduled action of the service.
+type ScheduledActionDefinition struct {
+	ScheduledActionName  *string                                      `json:"scheduledActionName" locationName:"scheduledActionName"`
+	Schedule             *string                                      `json:"schedule" locationName:"schedule"`
+	Timezone             *string                                      `json:"timezone,omitempty" locationName:"timezone"`
+	StartTime            *time.Time                                   `json:"startTime,omitempty" locationName:"startTime" timestampFormat:"iso8601"`
+	EndTime              *time.Time                                   `json:"endTime,omitempty" locationName:"endTime" timestampFormat:"iso8601"`
+	ScalableTargetAction *applicationautoscaling.ScalableTargetAction `json:"scalableTargetAction,omitempty" locationName:"scalableTargetAction"`
+}
+
+var scheduleExpressionRegexp = regexp.MustCompile(`^(at|rate|cron)\(.+\)$`)
+
+func validateScheduledAction(a *ScheduledActionDefinition) error {
+	name := aws.StringValue(a.ScheduledActionName)
+	if name == "" {
+		return errors.New("scheduledActionName is required")
+	}
+	if !scheduleExpressionRegexp.MatchString(aws.StringValue(a.Schedule)) {
+		return errors.Errorf("scheduled action %s has invalid schedule %q. at(), rate() or cron() expression is required", name, aws.StringValue(a.Schedule))
+	}
+	if tz := aws.StringValue(a.Timezone); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return errors.Wrapf(err, "scheduled action %s has invalid timezone", name)
+		}
+	}
+	if a.StartTime != nil && a.EndTime != nil && !a.StartTime.Before(*a.EndTime) {
+		return errors.Errorf("scheduled action %s endTime must be after startTime", name)
+	}
+	if a.ScalableTargetAction == nil {
+		return errors.Errorf("scheduled action %s requires scalableTargetAction", name)
+	}
+	return nil
+}
+
+func (d *App) autoScalingResourceID() string {
+	return fmt.Sprintf("service/%s/%s", d.Cluster, d.Service)
+}
+
+func (d *App) LoadAutoScalingDefinition(path string) (*AutoScalingDefinition, error) {
+	if path == "" {
+		return nil, errors.New("autoscaling_definition is not defined")
+	}
+	var def AutoScalingDefinition
+	src, err := d.readDefinitionFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load autoscaling definition %s", path)
+	}
+	if err := d.unmarshalJSON(src, &def, path); err != nil {
+		return nil, errors.Wrapf(err, "failed to load autoscaling definition %s", path)
+	}
+	for i, p := range def.ScalingPolicies {
+		if aws.StringValue(p.PolicyName) == "" {
+			return nil, errors.Errorf("scalingPolicies[%d].policyName is required in %s", i, path)
+		}
+	}
+	for i, a := range def.ScheduledActions {
+		if err := validateScheduledAction(a); err != nil {
+			return nil, errors.Wrapf(err, "scheduledActions[%d] in %s", i, path)
+		}
+	}
+	return &def, nil
+}
+
+// DescribeAutoScalingDefinition returns a current Application Auto Scaling settings of the service.
+func (d *App) DescribeAutoScalingDefinition(ctx context.Context) (*AutoScalingDefinition, error) {
+	return d.describeAutoScalingDefinition(ctx, d.autoScalingResourceID())
+}
+
+func (d *App) describeAutoScalingDefinition(ctx context.Context, resourceId string) (*AutoScalingDefinition, error) {
+	def := &AutoScalingDefinition{}
+	tout, err := d.autoScaling.DescribeScalableTargetsWithContext(ctx,
+		&applicationautoscaling.DescribeScalableTargetsInput{
+			ResourceIds:       []*string{&resourceId},
+			ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+			ScalableDimension: aws.String(autoScalingScalableDimension),
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe scalable targets")
+	}
+	if len(tout.ScalableTargets) == 0 {
+		return def, nil
+	}
+	t := tout.ScalableTargets[0]
+	def.ScalableTarget = &ScalableTargetDefinition{
+		MinCapacity: t.MinCapacity,
+		MaxCapacity: t.MaxCapacity,
+	}
+
+	var nextToken *string
+	for {
+		pout, err := d.autoScaling.DescribeScalingPoliciesWithContext(ctx,
+			&applicationautoscaling.DescribeScalingPoliciesInput{
+				ResourceId:        &resourceId,
+				ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+				ScalableDimension: aws.String(autoScalingScalableDimension),
+				NextToken:         nextToken,
+			},
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe scaling policies")
+		}
+		for _, p := range pout.ScalingPolicies {
+			def.ScalingPolicies = append(def.ScalingPolicies, &ScalingPolicyDefinition{
+				PolicyName:                               p.PolicyName,
+				PolicyType:                               p.PolicyType,
+				StepScalingPolicyConfiguration:           p.StepScalingPolicyConfiguration,
+				TargetTrackingScalingPolicyConfiguration: p.TargetTrackingScalingPolicyConfiguration,
+			})
+		}
+		if nextToken = pout.NextToken; nextToken == nil {
+			break
+		}
+	}
+
+	for {
+		sout, err := d.autoScaling.DescribeScheduledActionsWithContext(ctx,
+			&applicationautoscaling.DescribeScheduledActionsInput{
+				ResourceId:        &resourceId,
+				ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+				ScalableDimension: aws.String(autoScalingScalableDimension),
+				NextToken:         nextToken,
+			},
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe scheduled actions")
+		}
+		for _, a := range sout.ScheduledActions {
+			def.ScheduledActions = append(def.ScheduledActions, &ScheduledActionDefinition{
+				ScheduledActionName:  a.ScheduledActionName,
+				Schedule:             a.Schedule,
+				Timezone:             a.Timezone,
+				StartTime:            a.StartTime,
+				EndTime:              a.EndTime,
+				ScalableTargetAction: a.ScalableTargetAction,
+			})
+		}
+		if nextToken = sout.NextToken; nextToken == nil {
+			break
+		}
+	}
+	return def, nil
+}
+
+func sortAutoScalingDefinitionForDiff(def *AutoScalingDefinition) {
+	if def.ScalableTarget != nil {
+		// roleARN is not returned by DescribeScalableTargets as is
+		def.ScalableTarget.RoleARN = nil
+	}
+	for _, p := range def.ScalingPolicies {
+		if c := p.TargetTrackingScalingPolicyConfiguration; c != nil && c.DisableScaleIn == nil {
+			c.DisableScaleIn = aws.Bool(false)
+		}
+	}
+	sort.SliceStable(def.ScalingPolicies, func(i, j int) bool {
+		return aws.StringValue(def.ScalingPolicies[i].PolicyName) < aws.StringValue(def.ScalingPolicies[j].PolicyName)
+	})
+	for _, a := range def.ScheduledActions {
+		if a.Timezone == nil {
+			// Application Auto Scaling treats an omitted timezone as UTC
+			a.Timezone = aws.String("UTC")
+		}
+		if a.StartTime != nil {
+			a.StartTime = aws.Time(a.StartTime.UTC())
+		}
+		if a.EndTime != nil {
+			a.EndTime = aws.Time(a.EndTime.UTC())
+		}
+	}
+	sort.SliceStable(def.ScheduledActions, func(i, j int) bool {
+		return aws.StringValue(def.ScheduledActions[i].ScheduledActionName) < aws.StringValue(def.ScheduledActions[j].ScheduledActionName)
+	})
+}
+
+func diffAutoScalingDefinitions(local, remote *AutoScalingDefinition, remoteName string, localPath string, unified bool) (string, error) {
+	sortAutoScalingDefinitionForDiff(local)
+	sortAutoScalingDefinitionForDiff(remote)
+
+	newBytes, err := MarshalJSON(local)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal new autoscaling definition")
+	}
+	remoteBytes, err := MarshalJSON(remote)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal remote autoscaling definition")
+	}
+	return diffStrings(string(remoteBytes), string(newBytes), remoteName, localPath, unified), nil
+}
+
+// ApplyAutoScalingDefinition registers the scalable target and puts the scaling policies and the scheduled actions by the definition.
+// Scaling policies and scheduled actions which are not defined in the definition are deleted.
+func (d *App) ApplyAutoScalingDefinition(ctx context.Context, def *AutoScalingDefinition, dryRun bool) error {
+	resourceId := d.autoScalingResourceID()
+	current, err := d.DescribeAutoScalingDefinition(ctx)
+	if err != nil {
+		return err
+	}
+
+	if t := def.ScalableTarget; t != nil {
+		in := &applicationautoscaling.RegisterScalableTargetInput{
+			ResourceId:        aws.String(resourceId),
+			ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+			ScalableDimension: aws.String(autoScalingScalableDimension),
+			MinCapacity:       t.MinCapacity,
+			MaxCapacity:       t.MaxCapacity,
+			RoleARN:           t.RoleARN,
+		}
+		if dryRun {
+			d.Log("register scalable target input:")
+			d.LogJSON(in)
+		} else {
+			d.Log(fmt.Sprintf("Registering scalable target %s min:%d max:%d", resourceId, aws.Int64Value(t.MinCapacity), aws.Int64Value(t.MaxCapacity)))
+			d.DebugLog(in.String())
+			if _, err := d.autoScaling.RegisterScalableTargetWithContext(ctx, in); err != nil {
+				return errors.Wrap(err, "failed to register scalable target")
+			}
+		}
+	} else if current.ScalableTarget == nil {
+		return errors.New("scalableTarget is not defined in autoscaling definition and the service has no scalable targets")
+	}
+
+	defined := make(map[string]bool, len(def.ScalingPolicies))
+	for _, p := range def.ScalingPolicies {
+		defined[*p.PolicyName] = true
+		in := &applicationautoscaling.PutScalingPolicyInput{
+			PolicyName:                               p.PolicyName,
+			PolicyType:                               p.PolicyType,
+			ResourceId:                               aws.String(resourceId),
+			ServiceNamespace:                         aws.String(autoScalingServiceNamespace),
+			ScalableDimension:                        aws.String(autoScalingScalableDimension),
+			StepScalingPolicyConfiguration:           p.StepScalingPolicyConfiguration,
+			TargetTrackingScalingPolicyConfiguration: p.TargetTrackingScalingPolicyConfiguration,
+		}
+		if dryRun {
+			d.Log("put scaling policy input:")
+			d.LogJSON(in)
+			continue
+		}
+		d.Log("Putting scaling policy", *p.PolicyName)
+		d.DebugLog(in.String())
+		if _, err := d.autoScaling.PutScalingPolicyWithContext(ctx, in); err != nil {
+			return errors.Wrapf(err, "failed to put scaling policy %s", *p.PolicyName)
+		}
+	}
+
+	for _, p := range current.ScalingPolicies {
+		if defined[*p.PolicyName] {
+			continue
+		}
+		if dryRun {
+			d.Log(fmt.Sprintf("scaling policy %s will be deleted", *p.PolicyName))
+			continue
+		}
+		d.Log("Deleting scaling policy", *p.PolicyName)
+		if _, err := d.autoScaling.DeleteScalingPolicyWithContext(ctx, &applicationautoscaling.DeleteScalingPolicyInput{
+			PolicyName:        p.PolicyName,
+			ResourceId:        aws.String(resourceId),
+			ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+			ScalableDimension: aws.String(autoScalingScalableDimension),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to delete scaling policy %s", *p.PolicyName)
+		}
+	}
+
+	return d.applyScheduledActions(ctx, def, current, dryRun)
+}
+
+func (d *App) applyScheduledActions(ctx context.Context, def, current *AutoScalingDefinition, dryRun bool) error {
+	resourceId := d.autoScalingResourceID()
+	defined := make(map[string]bool, len(def.ScheduledActions))
+	for _, a := range def.ScheduledActions {
+		defined[*a.ScheduledActionName] = true
+		in := &applicationautoscaling.PutScheduledActionInput{
+			ScheduledActionName:  a.ScheduledActionName,
+			Schedule:             a.Schedule,
+			Timezone:             a.Timezone,
+			StartTime:            a.StartTime,
+			EndTime:              a.EndTime,
+			ScalableTargetAction: a.ScalableTargetAction,
+			ResourceId:           aws.String(resourceId),
+			ServiceNamespace:     aws.String(autoScalingServiceNamespace),
+			ScalableDimension:    aws.String(autoScalingScalableDimension),
+		}
+		if dryRun {
+			d.Log("put scheduled action input:")
+			d.LogJSON(in)
+			continue
+		}
+		d.Log("Putting scheduled action", *a.ScheduledActionName)
+		d.DebugLog(in.String())
+		if _, err := d.autoScaling.PutScheduledActionWithContext(ctx, in); err != nil {
+			return errors.Wrapf(err, "failed to put scheduled action %s", *a.ScheduledActionName)
+		}
+	}
+
+	for _, a := range current.ScheduledActions {
+		if defined[*a.ScheduledActionName] {
+			continue
+		}
+		if dryRun {
+			d.Log(fmt.Sprintf("scheduled action %s will be deleted", *a.ScheduledActionName))
+			continue
+		}
+		d.Log("Deleting scheduled action", *a.ScheduledActionName)
+		if _, err := d.autoScaling.DeleteScheduledActionWithContext(ctx, &applicationautoscaling.DeleteScheduledActionInput{
+			ScheduledActionName: a.ScheduledActionName,
+			ResourceId:          aws.String(resourceId),
+			ServiceNamespace:    aws.String(autoScalingServiceNamespace),
+			ScalableDimension:   aws.String(autoScalingScalableDimension),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to delete scheduled action %s", *a.ScheduledActionName)
+		}
+	}
+	return nil
+}
+
+// DeleteAutoScaling deregisters the scalable target of the service. Scaling policies and scheduled actions are deleted with it.
+func (d *App) DeleteAutoScaling(ctx context.Context) error {
+	resourceId := d.autoScalingResourceID()
+	current, err := d.DescribeAutoScalingDefinition(ctx)
+	if err != nil {
+		return err
+	}
+	if current.ScalableTarget == nil {
+		d.Log(fmt.Sprintf("No scalable target for %s", resourceId))
+		return nil
+	}
+	d.Log("Deregistering scalable target", resourceId)
+	if _, err := d.autoScaling.DeregisterScalableTargetWithContext(ctx, &applicationautoscaling.DeregisterScalableTargetInput{
+		ResourceId:        aws.String(resourceId),
+		ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+		ScalableDimension: aws.String(autoScalingScalableDimension),
+	}); err != nil {
+		return errors.Wrap(err, "failed to deregister scalable target")
+	}
+	return nil
+}
+
+// suspendAutoScalingDuringDeploy suspends scaling activities of the scalable target
+// and returns a function to restore the suspended state before suspending.
+func (d *App) suspendAutoScalingDuringDeploy(ctx context.Context) (func() error, error) {
+	resourceId := d.autoScalingResourceID()
+	nop := func() error { return nil }
+	out, err := d.autoScaling.DescribeScalableTargetsWithContext(ctx,
+		&applicationautoscaling.DescribeScalableTargetsInput{
+			ResourceIds:       []*string{&resourceId},
+			ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+			ScalableDimension: aws.String(autoScalingScalableDimension),
+		},
+	)
+	if err != nil {
+		return nop, errors.Wrap(err, "failed to describe scalable targets")
+	}
+	if len(out.ScalableTargets) == 0 {
+		d.Log(fmt.Sprintf("No scalable target for %s", resourceId))
+		return nop, nil
+	}
+	original := out.ScalableTargets[0].SuspendedState
+	if original == nil {
+		original = &applicationautoscaling.SuspendedState{
+			DynamicScalingInSuspended:  aws.Bool(false),
+			DynamicScalingOutSuspended: aws.Bool(false),
+			ScheduledScalingSuspended:  aws.Bool(false),
+		}
+	}
+	d.Log(fmt.Sprintf("Suspending auto scaling of %s during deploy", resourceId))
+	if err := d.putAutoScalingSuspendedState(ctx, &applicationautoscaling.SuspendedState{
+		DynamicScalingInSuspended:  aws.Bool(true),
+		DynamicScalingOutSuspended: aws.Bool(true),
+		ScheduledScalingSuspended:  aws.Bool(true),
+	}); err != nil {
+		return nop, err
+	}
+	return func() error {
+		d.Log(fmt.Sprintf(
+			"Restoring suspended state of %s in:%t out:%t scheduled:%t",
+			resourceId,
+			aws.BoolValue(original.DynamicScalingInSuspended),
+			aws.BoolValue(original.DynamicScalingOutSuspended),
+			aws.BoolValue(original.ScheduledScalingSuspended),
+		))
+		// restore even if ctx is already done (e.g. timed out)
+		return d.putAutoScalingSuspendedState(context.Background(), original)
+	}, nil
+}
+
+func (d *App) putAutoScalingSuspendedState(ctx context.Context, state *applicationautoscaling.SuspendedState) error {
+	resourceId := d.autoScalingResourceID()
+	_, err := d.autoScaling.RegisterScalableTargetWithContext(ctx,
+		&applicationautoscaling.RegisterScalableTargetInput{
+			ResourceId:        aws.String(resourceId),
+			ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+			ScalableDimension: aws.String(autoScalingScalableDimension),
+			SuspendedState:    state,
+		},
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to register scalable target %s", resourceId)
+	}
+	return nil
+}
+
+func clampDesiredCount(count, min, max int64) int64 {
+	if count < min {
+		return min
+	}
+	if count > max {
+		return max
+	}
+	return count
+}
+
+// adjustScalableTarget updates min/max capacity of the scalable target by the options,
+// and clamps the desired count within them. Otherwise Application Auto Scaling overrides the desired count soon.
+func (d *App) adjustScalableTarget(ctx context.Context, count *int64, opt DeployOption) (*int64, error) {
+	setCapacity := opt.AutoScalingMin != nil || opt.AutoScalingMax != nil
+	setTasks := opt.DesiredCount != nil && *opt.DesiredCount != DefaultDesiredCount
+	if count == nil || (!setTasks && !setCapacity) {
+		return count, nil
+	}
+	resourceId := d.autoScalingResourceID()
+	out, err := d.autoScaling.DescribeScalableTargetsWithContext(ctx,
+		&applicationautoscaling.DescribeScalableTargetsInput{
+			ResourceIds:       []*string{&resourceId},
+			ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+			ScalableDimension: aws.String(autoScalingScalableDimension),
+		},
+	)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "AccessDeniedException" && !setCapacity {
+			d.DebugLog("unable to describe scalable targets. requires IAM for application-autoscaling:Describe* to adjust desired count within auto-scaling capacity.")
+			return count, nil
+		}
+		return nil, errors.Wrap(err, "failed to describe scalable targets")
+	}
+	if len(out.ScalableTargets) == 0 {
+		if opt.AutoScalingMin != nil || opt.AutoScalingMax != nil {
+			return nil, errors.Errorf("no scalable target for %s. --auto-scaling-min and --auto-scaling-max require a scalable target", resourceId)
+		}
+		return count, nil
+	}
+	target := out.ScalableTargets[0]
+	min, max := aws.Int64Value(target.MinCapacity), aws.Int64Value(target.MaxCapacity)
+	if opt.AutoScalingMin != nil {
+		min = *opt.AutoScalingMin
+	}
+	if opt.AutoScalingMax != nil {
+		max = *opt.AutoScalingMax
+	}
+	if min > max {
+		return nil, errors.Errorf("auto scaling min capacity %d must be less than or equal to max capacity %d", min, max)
+	}
+	if min != aws.Int64Value(target.MinCapacity) || max != aws.Int64Value(target.MaxCapacity) {
+		d.Log(fmt.Sprintf(
+			"Updating capacity of scalable target %s min:%d->%d max:%d->%d",
+			resourceId, aws.Int64Value(target.MinCapacity), min, aws.Int64Value(target.MaxCapacity), max,
+		))
+		if !aws.BoolValue(opt.DryRun) {
+			if _, err := d.autoScaling.RegisterScalableTargetWithContext(ctx, &applicationautoscaling.RegisterScalableTargetInput{
+				ResourceId:        aws.String(resourceId),
+				ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+				ScalableDimension: aws.String(autoScalingScalableDimension),
+				MinCapacity:       aws.Int64(min),
+				MaxCapacity:       aws.Int64(max),
+			}); err != nil {
+				return nil, errors.Wrap(err, "failed to register scalable target")
+			}
+		}
+	}
+	if c := clampDesiredCount(*count, min, max); c != *count {
+		d.Log(fmt.Sprintf(
+			"desired count %d is out of range of auto scaling capacity min:%d max:%d, so it is adjusted to %d. "+
+				"Use --auto-scaling-min or --auto-scaling-max to change the capacity",
+			*count, min, max, c,
+		))
+		return aws.Int64(c), nil
+	}
+	return count, nil
+}
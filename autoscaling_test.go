@@ -0,0 +1,122 @@
+package ecspresso_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/kayac/ecspresso"
+)
+
+func TestLoadAutoScalingDefinition(t *testing.T) {
+	path := "tests/autoscaling.json"
+	c := &ecspresso.Config{
+		Region:                    "ap-northeast-1",
+		Timeout:                   600 * time.Second,
+		Service:                   "test",
+		Cluster:                   "default",
+		AutoScalingDefinitionPath: path,
+	}
+	if err := c.Restrict(); err != nil {
+		t.Error(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Error(err)
+	}
+	def, err := app.LoadAutoScalingDefinition(path)
+	if err != nil {
+		t.Fatalf("%s load failed: %s", path, err)
+	}
+	if min, max := aws.Int64Value(def.ScalableTarget.MinCapacity), aws.Int64Value(def.ScalableTarget.MaxCapacity); min != 1 || max != 10 {
+		t.Errorf("unexpected scalable target min:%d max:%d", min, max)
+	}
+	if len(def.ScalingPolicies) != 1 {
+		t.Fatalf("unexpected scaling policies %d", len(def.ScalingPolicies))
+	}
+	p := def.ScalingPolicies[0]
+	if aws.StringValue(p.PolicyName) != "cpu-target-tracking" || aws.StringValue(p.PolicyType) != "TargetTrackingScaling" {
+		t.Errorf("unexpected scaling policy %s %s", aws.StringValue(p.PolicyName), aws.StringValue(p.PolicyType))
+	}
+	if v := aws.Float64Value(p.TargetTrackingScalingPolicyConfiguration.TargetValue); v != 70 {
+		t.Errorf("unexpected target value %f", v)
+	}
+	if len(def.ScheduledActions) != 1 {
+		t.Fatalf("unexpected scheduled actions %d", len(def.ScheduledActions))
+	}
+	a := def.ScheduledActions[0]
+	if aws.StringValue(a.Timezone) != "Asia/Tokyo" || aws.Int64Value(a.ScalableTargetAction.MinCapacity) != 10 {
+		t.Errorf("unexpected scheduled action %#v", a)
+	}
+}
+
+var scheduledActionTestSuite = []struct {
+	action *ecspresso.ScheduledActionDefinition
+	ok     bool
+}{
+	{
+		action: &ecspresso.ScheduledActionDefinition{
+			ScheduledActionName:  aws.String("ok"),
+			Schedule:             aws.String("cron(0 9 ? * MON-FRI *)"),
+			Timezone:             aws.String("Asia/Tokyo"),
+			ScalableTargetAction: &applicationautoscaling.ScalableTargetAction{MinCapacity: aws.Int64(1)},
+		},
+		ok: true,
+	},
+	{
+		action: &ecspresso.ScheduledActionDefinition{
+			ScheduledActionName:  aws.String("rate"),
+			Schedule:             aws.String("rate(1 hour)"),
+			ScalableTargetAction: &applicationautoscaling.ScalableTargetAction{MaxCapacity: aws.Int64(1)},
+		},
+		ok: true,
+	},
+	{
+		action: &ecspresso.ScheduledActionDefinition{
+			ScheduledActionName:  aws.String("invalid-schedule"),
+			Schedule:             aws.String("0 9 * * *"),
+			ScalableTargetAction: &applicationautoscaling.ScalableTargetAction{MinCapacity: aws.Int64(1)},
+		},
+	},
+	{
+		action: &ecspresso.ScheduledActionDefinition{
+			ScheduledActionName:  aws.String("invalid-timezone"),
+			Schedule:             aws.String("cron(0 9 * * ? *)"),
+			Timezone:             aws.String("Mars/Olympus"),
+			ScalableTargetAction: &applicationautoscaling.ScalableTargetAction{MinCapacity: aws.Int64(1)},
+		},
+	},
+	{
+		action: &ecspresso.ScheduledActionDefinition{
+			ScheduledActionName: aws.String("no-action"),
+			Schedule:            aws.String("cron(0 9 * * ? *)"),
+		},
+	},
+}
+
+func TestValidateScheduledAction(t *testing.T) {
+	for _, s := range scheduledActionTestSuite {
+		err := ecspresso.ValidateScheduledAction(s.action)
+		if s.ok && err != nil {
+			t.Errorf("%s unexpected error %s", *s.action.ScheduledActionName, err)
+		} else if !s.ok && err == nil {
+			t.Errorf("%s must be failed", *s.action.ScheduledActionName)
+		}
+	}
+}
+
+func TestClampDesiredCount(t *testing.T) {
+	for _, c := range []struct {
+		count, min, max, expected int64
+	}{
+		{count: 3, min: 1, max: 5, expected: 3},
+		{count: 0, min: 1, max: 5, expected: 1},
+		{count: 10, min: 1, max: 5, expected: 5},
+		{count: 5, min: 5, max: 5, expected: 5},
+	} {
+		if got := ecspresso.ClampDesiredCount(c.count, c.min, c.max); got != c.expected {
+			t.Errorf("clamp %d in [%d, %d] expected %d got %d", c.count, c.min, c.max, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+type CapacityOption struct {
+	Strategy    *string
+	DryRun      *bool
+	NoWait      *bool
+	ForceUnlock *bool
+	ExitCode    *bool
+}
+
+func (opt CapacityOption) DryRunString() string {
+	if aws.BoolValue(opt.DryRun) {
+		return dryRunStr
+	}
+	return ""
+}
+
+// parseCapacityProviderStrategy parses the strategy formatted as NAME=WEIGHT[:BASE],...
+// e.g. FARGATE=1:2,FARGATE_SPOT=1
+func parseCapacityProviderStrategy(s string) ([]*ecs.CapacityProviderStrategyItem, error) {
+	var items []*ecs.CapacityProviderStrategyItem
+	seen := map[string]bool{}
+	var totalWeight int64
+	var hasBase bool
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("invalid strategy %q. NAME=WEIGHT[:BASE] is expected", part)
+		}
+		name := kv[0]
+		if seen[name] {
+			return nil, errors.Errorf("capacity provider %s is specified more than once", name)
+		}
+		seen[name] = true
+
+		wb := strings.SplitN(kv[1], ":", 2)
+		weight, err := strconv.ParseInt(wb[0], 10, 64)
+		if err != nil || weight < 0 || weight > 1000 {
+			return nil, errors.Errorf("invalid weight %q of %s. 0-1000 is expected", wb[0], name)
+		}
+		item := &ecs.CapacityProviderStrategyItem{
+			CapacityProvider: aws.String(name),
+			Weight:           aws.Int64(weight),
+		}
+		if len(wb) == 2 {
+			base, err := strconv.ParseInt(wb[1], 10, 64)
+			if err != nil || base < 0 || base > 100000 {
+				return nil, errors.Errorf("invalid base %q of %s. 0-100000 is expected", wb[1], name)
+			}
+			if base > 0 {
+				if hasBase {
+					return nil, errors.New("base can be specified for only one capacity provider")
+				}
+				hasBase = true
+			}
+			item.Base = aws.Int64(base)
+		}
+		totalWeight += weight
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no capacity providers in the strategy")
+	}
+	if totalWeight == 0 {
+		return nil, errors.New("at least one capacity provider must have a weight greater than zero")
+	}
+	return items, nil
+}
+
+// normalizeCapacityProviderStrategy returns a copy of the strategy sorted by names with explicit zero values.
+func normalizeCapacityProviderStrategy(items []*ecs.CapacityProviderStrategyItem) []*ecs.CapacityProviderStrategyItem {
+	ns := make([]*ecs.CapacityProviderStrategyItem, 0, len(items))
+	for _, item := range items {
+		ns = append(ns, &ecs.CapacityProviderStrategyItem{
+			CapacityProvider: item.CapacityProvider,
+			Weight:           aws.Int64(aws.Int64Value(item.Weight)),
+			Base:             aws.Int64(aws.Int64Value(item.Base)),
+		})
+	}
+	sort.Slice(ns, func(i, j int) bool {
+		return aws.StringValue(ns[i].CapacityProvider) < aws.StringValue(ns[j].CapacityProvider)
+	})
+	return ns
+}
+
+// formatCapacityProviderStrategy returns lines of the strategy with the share of weights.
+func formatCapacityProviderStrategy(items []*ecs.CapacityProviderStrategyItem) []string {
+	items = normalizeCapacityProviderStrategy(items)
+	var total int64
+	for _, item := range items {
+		total += *item.Weight
+	}
+	var lines []string
+	for _, item := range items {
+		var share float64
+		if total > 0 {
+			share = float64(*item.Weight) * 100 / float64(total)
+		}
+		lines = append(lines, fmt.Sprintf(
+			"%s weight:%d (%.0f%%) base:%d",
+			aws.StringValue(item.CapacityProvider), *item.Weight, share, *item.Base,
+		))
+	}
+	return lines
+}
+
+func capacityProviderStrategyString(items []*ecs.CapacityProviderStrategyItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	return strings.Join(formatCapacityProviderStrategy(items), "\n") + "\n"
+}
+
+func (d *App) logCapacityProviderStrategy(title string, items []*ecs.CapacityProviderStrategyItem) {
+	if len(items) == 0 {
+		d.Log(title, "(none)")
+		return
+	}
+	d.Log(title)
+	for _, line := range formatCapacityProviderStrategy(items) {
+		d.Log(spcIndent + line)
+	}
+}
+
+// Capacity shows or changes the capacity provider strategy of the service.
+func (d *App) Capacity(opt CapacityOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return err
+	}
+	var defined []*ecs.CapacityProviderStrategyItem
+	if d.config.ServiceDefinitionPath != "" {
+		svd, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
+		if err != nil {
+			return err
+		}
+		defined = svd.CapacityProviderStrategy
+	}
+
+	if aws.StringValue(opt.Strategy) == "" {
+		return d.showCapacityProviderStrategy(sv, defined, aws.BoolValue(opt.ExitCode))
+	}
+	return d.changeCapacityProviderStrategy(ctx, sv, defined, opt)
+}
+
+func (d *App) showCapacityProviderStrategy(sv *ecs.Service, defined []*ecs.CapacityProviderStrategyItem, exitCode bool) error {
+	if len(sv.CapacityProviderStrategy) == 0 && sv.LaunchType != nil {
+		d.Log("Launch type:", aws.StringValue(sv.LaunchType))
+	}
+	d.logCapacityProviderStrategy("Live capacity provider strategy:", sv.CapacityProviderStrategy)
+	if d.config.ServiceDefinitionPath == "" {
+		return nil
+	}
+	ds := diffStrings(
+		capacityProviderStrategyString(defined),
+		capacityProviderStrategyString(sv.CapacityProviderStrategy),
+		d.config.ServiceDefinitionPath, "live", false,
+	)
+	if ds == "" {
+		d.Log("No drift from the service definition")
+		return nil
+	}
+	fmt.Print(coloredDiff(ds))
+	if exitCode {
+		return withExitCode(ExitCodeDiffFound, errors.New("capacity provider strategy drift detected"))
+	}
+	return nil
+}
+
+func (d *App) changeCapacityProviderStrategy(ctx context.Context, sv *ecs.Service, defined []*ecs.CapacityProviderStrategyItem, opt CapacityOption) error {
+	strategy, err := parseCapacityProviderStrategy(aws.StringValue(opt.Strategy))
+	if err != nil {
+		return err
+	}
+	if isCodeDeploy(sv.DeploymentController) {
+		return errors.New("changing the capacity provider strategy is not supported for the CODE_DEPLOY deployment controller")
+	}
+
+	d.Log("Changing capacity provider strategy", opt.DryRunString())
+	d.logCapacityProviderStrategy("Current:", sv.CapacityProviderStrategy)
+	d.logCapacityProviderStrategy("New:", strategy)
+	if len(defined) > 0 && capacityProviderStrategyString(defined) != capacityProviderStrategyString(strategy) {
+		d.Log("WARNING: the new strategy differs from the service definition. the next deploy will revert it")
+	}
+	if aws.BoolValue(opt.DryRun) {
+		d.Log("DRY RUN OK")
+		return nil
+	}
+
+	unlock, err := d.acquireLock(ctx, aws.BoolValue(opt.ForceUnlock))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	in := &ecs.UpdateServiceInput{
+		Service:                  aws.String(d.Service),
+		Cluster:                  aws.String(d.Cluster),
+		CapacityProviderStrategy: strategy,
+		ForceNewDeployment:       aws.Bool(true),
+	}
+	startedAt := time.Now()
+	d.Log("Updating capacity provider strategy with force new deployment...")
+	d.DebugLog(in.String())
+	if _, err := d.ecs.UpdateServiceWithContext(ctx, in); err != nil {
+		return errors.Wrap(err, "failed to update capacity provider strategy")
+	}
+	d.emitEvent(LifecycleEvent{Type: EventDeploymentStarted, TaskDefinition: arnToName(aws.StringValue(sv.TaskDefinition))})
+	time.Sleep(delayForServiceChanged) // wait for service updated
+
+	if aws.BoolValue(opt.NoWait) {
+		d.Log("Service is deployed.")
+	} else {
+		if err := d.WaitServiceStable(ctx, time.Now()); err != nil {
+			return errors.Wrap(err, "failed to wait service stable")
+		}
+		d.Log("Service is stable now. Completed!")
+	}
+	d.saveState(stateOption{command: "capacity", startedAt: startedAt})
+	return nil
+}
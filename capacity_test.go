@@ -0,0 +1,55 @@
+package ecspresso_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso"
+)
+
+func TestParseCapacityStrategy(t *testing.T) {
+	items, err := ecspresso.ParseCapacityStrategy("FARGATE=1:2, FARGATE_SPOT=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*ecs.CapacityProviderStrategyItem{
+		{CapacityProvider: aws.String("FARGATE"), Weight: aws.Int64(1), Base: aws.Int64(2)},
+		{CapacityProvider: aws.String("FARGATE_SPOT"), Weight: aws.Int64(3)},
+	}
+	if diff := cmp.Diff(expected, items); diff != "" {
+		t.Error(diff)
+	}
+
+	for s, errMsg := range map[string]string{
+		"":                             "no capacity providers",
+		"FARGATE":                      "NAME=WEIGHT[:BASE] is expected",
+		"FARGATE=x":                    "invalid weight",
+		"FARGATE=1001":                 "invalid weight",
+		"FARGATE=1:-1":                 "invalid base",
+		"FARGATE=0,FARGATE_SPOT=0":     "weight greater than zero",
+		"FARGATE=1,FARGATE=2":          "more than once",
+		"FARGATE=1:1,FARGATE_SPOT=1:1": "only one capacity provider",
+	} {
+		_, err := ecspresso.ParseCapacityStrategy(s)
+		if err == nil || !strings.Contains(err.Error(), errMsg) {
+			t.Errorf("%q: expected error contains %q, got %v", s, errMsg, err)
+		}
+	}
+}
+
+func TestFormatCapacityStrategy(t *testing.T) {
+	lines := ecspresso.FormatCapacityStrategy([]*ecs.CapacityProviderStrategyItem{
+		{CapacityProvider: aws.String("FARGATE_SPOT"), Weight: aws.Int64(3)},
+		{CapacityProvider: aws.String("FARGATE"), Weight: aws.Int64(1), Base: aws.Int64(2)},
+	})
+	expected := []string{
+		"FARGATE weight:1 (25%) base:2",
+		"FARGATE_SPOT weight:3 (75%) base:0",
+	}
+	if diff := cmp.Diff(expected, lines); diff != "" {
+		t.Error(diff)
+	}
+}
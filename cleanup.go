@@ -0,0 +1,287 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/pkg/errors"
+)
+
+// cleanupPlan represents resources associated with the service to be deleted with the service.
+type cleanupPlan struct {
+	scalableTarget     string
+	scheduledTaskRules []*scheduledTaskRule
+	serviceDiscoveries []string
+	logGroups          []string
+}
+
+// scheduledTaskRule represents an EventBridge rule that runs tasks of the service's task definition family.
+// The rule itself is deleted only when all of the targets run the family on the cluster.
+type scheduledTaskRule struct {
+	name       string
+	targetIDs  []string
+	deleteRule bool
+}
+
+func (p *cleanupPlan) empty() bool {
+	return p.scalableTarget == "" && len(p.scheduledTaskRules) == 0 &&
+		len(p.serviceDiscoveries) == 0 && len(p.logGroups) == 0
+}
+
+func (d *App) logCleanupPlan(p *cleanupPlan) {
+	if p.empty() {
+		d.Log("No associated resources to clean up")
+		return
+	}
+	d.Log("Associated resources below will be deleted with the service")
+	if p.scalableTarget != "" {
+		d.Log("  scalable target:", p.scalableTarget)
+	}
+	for _, r := range p.scheduledTaskRules {
+		if r.deleteRule {
+			d.Log("  scheduled task rule:", r.name)
+		} else {
+			d.Log("  scheduled task rule targets:", r.name, strings.Join(r.targetIDs, ","))
+		}
+	}
+	for _, id := range p.serviceDiscoveries {
+		d.Log("  Cloud Map service:", id)
+	}
+	for _, name := range p.logGroups {
+		d.Log("  log group:", name)
+	}
+}
+
+// logGroupsOf returns names of the awslogs log groups used by containers in the task definition.
+func logGroupsOf(td *TaskDefinitionInput) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, c := range td.ContainerDefinitions {
+		lc := c.LogConfiguration
+		if lc == nil || aws.StringValue(lc.LogDriver) != ecs.LogDriverAwslogs {
+			continue
+		}
+		name := aws.StringValue(lc.Options["awslogs-group"])
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func taskDefinitionFamily(tdArn string) string {
+	return strings.SplitN(arnToName(tdArn), ":", 2)[0]
+}
+
+func (d *App) buildCleanupPlan(ctx context.Context, sv *ecs.Service) (*cleanupPlan, error) {
+	p := &cleanupPlan{}
+
+	as, err := d.DescribeAutoScalingDefinition(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if as.ScalableTarget != nil {
+		p.scalableTarget = d.autoScalingResourceID()
+	}
+
+	rules, err := d.findClusterScheduledTaskRules(ctx, aws.StringValue(sv.ClusterArn), taskDefinitionFamily(aws.StringValue(sv.TaskDefinition)))
+	if err != nil {
+		return nil, err
+	}
+	p.scheduledTaskRules = rules
+
+	for _, r := range sv.ServiceRegistries {
+		p.serviceDiscoveries = append(p.serviceDiscoveries, arnToName(aws.StringValue(r.RegistryArn)))
+	}
+
+	td, err := d.DescribeTaskDefinition(ctx, aws.StringValue(sv.TaskDefinition))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe task definition")
+	}
+	used, err := d.logGroupsOfOtherServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range logGroupsOf(td) {
+		if sv, ok := used[name]; ok {
+			d.Log(fmt.Sprintf("Log group %s is used by the service %s. It is not deleted", name, sv))
+			continue
+		}
+		p.logGroups = append(p.logGroups, name)
+	}
+	return p, nil
+}
+
+// logGroupsOfOtherServices returns log groups used by task definitions of other ACTIVE services in the cluster
+// and names of the services using them.
+func (d *App) logGroupsOfOtherServices(ctx context.Context) (map[string]string, error) {
+	services, err := d.describeClusterServices(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]string{}
+	described := map[string]bool{}
+	for _, sv := range services {
+		if aws.StringValue(sv.ServiceName) == d.Service || aws.StringValue(sv.Status) != "ACTIVE" {
+			continue
+		}
+		// task definitions being deployed are also used
+		tdArns := []string{aws.StringValue(sv.TaskDefinition)}
+		for _, dp := range sv.Deployments {
+			tdArns = append(tdArns, aws.StringValue(dp.TaskDefinition))
+		}
+		for _, tdArn := range tdArns {
+			if tdArn == "" || described[tdArn] {
+				continue
+			}
+			described[tdArn] = true
+			td, err := d.DescribeTaskDefinition(ctx, tdArn)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to describe task definition %s", tdArn)
+			}
+			for _, name := range logGroupsOf(td) {
+				if _, ok := used[name]; !ok {
+					used[name] = aws.StringValue(sv.ServiceName)
+				}
+			}
+		}
+	}
+	return used, nil
+}
+
+func (d *App) findScheduledTaskRules(ctx context.Context, clusterArn, family string) ([]*scheduledTaskRule, error) {
+	var names []*string
+	var nextToken *string
+	for {
+		out, err := d.eventbridge.ListRuleNamesByTargetWithContext(ctx, &eventbridge.ListRuleNamesByTargetInput{
+			TargetArn: aws.String(clusterArn),
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list rules by the cluster")
+		}
+		names = append(names, out.RuleNames...)
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+
+	var rules []*scheduledTaskRule
+	for _, name := range names {
+		out, err := d.eventbridge.ListTargetsByRuleWithContext(ctx, &eventbridge.ListTargetsByRuleInput{
+			Rule: name,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list targets of rule %s", *name)
+		}
+		r := &scheduledTaskRule{name: *name}
+		for _, t := range out.Targets {
+			if t.EcsParameters == nil || taskDefinitionFamily(aws.StringValue(t.EcsParameters.TaskDefinitionArn)) != family {
+				continue
+			}
+			r.targetIDs = append(r.targetIDs, aws.StringValue(t.Id))
+		}
+		if len(r.targetIDs) == 0 {
+			continue
+		}
+		r.deleteRule = len(r.targetIDs) == len(out.Targets)
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// findClusterScheduledTaskRules returns rules with only the targets which run tasks of the family on the cluster.
+// Targets running tasks in other clusters or of other families are kept with the rule.
+func (d *App) findClusterScheduledTaskRules(ctx context.Context, clusterArn, family string) ([]*scheduledTaskRule, error) {
+	rules, err := d.findScheduledTaskRules(ctx, clusterArn, family)
+	if err != nil {
+		return nil, err
+	}
+	var clusterRules []*scheduledTaskRule
+	for _, r := range rules {
+		out, err := d.eventbridge.ListTargetsByRuleWithContext(ctx, &eventbridge.ListTargetsByRuleInput{
+			Rule: aws.String(r.name),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list targets of rule %s", r.name)
+		}
+		onCluster := map[string]bool{}
+		for _, t := range out.Targets {
+			if aws.StringValue(t.Arn) == clusterArn {
+				onCluster[aws.StringValue(t.Id)] = true
+			}
+		}
+		cr := &scheduledTaskRule{name: r.name}
+		for _, id := range r.targetIDs {
+			if onCluster[id] {
+				cr.targetIDs = append(cr.targetIDs, id)
+			}
+		}
+		if len(cr.targetIDs) == 0 {
+			continue
+		}
+		cr.deleteRule = len(cr.targetIDs) == len(out.Targets)
+		clusterRules = append(clusterRules, cr)
+	}
+	return clusterRules, nil
+}
+
+// cleanupBeforeDelete deletes associated resources which must be deleted before the service.
+func (d *App) cleanupBeforeDelete(ctx context.Context, p *cleanupPlan) error {
+	if p.scalableTarget != "" {
+		if err := d.DeleteAutoScaling(ctx); err != nil {
+			return errors.Wrap(err, "failed to delete autoscaling")
+		}
+	}
+	for _, r := range p.scheduledTaskRules {
+		d.Log("Removing targets of scheduled task rule", r.name)
+		if _, err := d.eventbridge.RemoveTargetsWithContext(ctx, &eventbridge.RemoveTargetsInput{
+			Rule: aws.String(r.name),
+			Ids:  aws.StringSlice(r.targetIDs),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to remove targets of rule %s", r.name)
+		}
+		if !r.deleteRule {
+			continue
+		}
+		d.Log("Deleting scheduled task rule", r.name)
+		if _, err := d.eventbridge.DeleteRuleWithContext(ctx, &eventbridge.DeleteRuleInput{
+			Name: aws.String(r.name),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to delete rule %s", r.name)
+		}
+	}
+	return nil
+}
+
+// cleanupAfterDelete deletes associated resources which must be deleted after the service.
+// Instances of Cloud Map services must be deregistered before.
+func (d *App) cleanupAfterDelete(ctx context.Context, p *cleanupPlan) error {
+	for _, id := range p.serviceDiscoveries {
+		d.Log("Deleting Cloud Map service", id)
+		if _, err := d.servicediscovery.DeleteServiceWithContext(ctx, &servicediscovery.DeleteServiceInput{
+			Id: aws.String(id),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to delete Cloud Map service %s", id)
+		}
+	}
+	for _, name := range p.logGroups {
+		d.Log("Deleting log group", name)
+		if _, err := d.cwl.DeleteLogGroupWithContext(ctx, &cloudwatchlogs.DeleteLogGroupInput{
+			LogGroupName: aws.String(name),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to delete log group %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package ecspresso_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/kayac/ecspresso"
+)
+
+func TestLogGroupsOf(t *testing.T) {
+	awslogs := func(group string) *ecs.LogConfiguration {
+		return &ecs.LogConfiguration{
+			LogDriver: aws.String("awslogs"),
+			Options: map[string]*string{
+				"awslogs-group":  aws.String(group),
+				"awslogs-region": aws.String("ap-northeast-1"),
+			},
+		}
+	}
+	td := &ecspresso.TaskDefinitionInput{
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("app"), LogConfiguration: awslogs("/ecs/app")},
+			{Name: aws.String("sidecar"), LogConfiguration: awslogs("/ecs/app")},
+			{Name: aws.String("proxy"), LogConfiguration: awslogs("/ecs/proxy")},
+			{Name: aws.String("router"), LogConfiguration: &ecs.LogConfiguration{LogDriver: aws.String("awsfirelens")}},
+			{Name: aws.String("init")},
+		},
+	}
+	groups := ecspresso.LogGroupsOf(td)
+	if expected := []string{"/ecs/app", "/ecs/proxy"}; !reflect.DeepEqual(groups, expected) {
+		t.Errorf("unexpected log groups %v expected %v", groups, expected)
+	}
+}
+
+func awslogsTaskDefinition(family string, groups ...string) *ecs.TaskDefinition {
+	td := &ecs.TaskDefinition{
+		Family:            aws.String(family),
+		TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/" + family + ":1"),
+	}
+	for _, g := range groups {
+		td.ContainerDefinitions = append(td.ContainerDefinitions, &ecs.ContainerDefinition{
+			Name: aws.String(g),
+			LogConfiguration: &ecs.LogConfiguration{
+				LogDriver: aws.String("awslogs"),
+				Options:   map[string]*string{"awslogs-group": aws.String(g)},
+			},
+		})
+	}
+	return td
+}
+
+// fakeCleanupECS implements ECS APIs to find resources shared with other services in the cluster.
+type fakeCleanupECS struct {
+	ecsiface.ECSAPI
+	services []*ecs.Service
+	tds      map[string]*ecs.TaskDefinition
+}
+
+func (f *fakeCleanupECS) ListServicesWithContext(_ aws.Context, _ *ecs.ListServicesInput, _ ...request.Option) (*ecs.ListServicesOutput, error) {
+	out := &ecs.ListServicesOutput{}
+	for _, sv := range f.services {
+		out.ServiceArns = append(out.ServiceArns, sv.ServiceArn)
+	}
+	return out, nil
+}
+
+func (f *fakeCleanupECS) DescribeServicesWithContext(_ aws.Context, _ *ecs.DescribeServicesInput, _ ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	return &ecs.DescribeServicesOutput{Services: f.services}, nil
+}
+
+func (f *fakeCleanupECS) DescribeTaskDefinitionWithContext(_ aws.Context, in *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: f.tds[aws.StringValue(in.TaskDefinition)]}, nil
+}
+
+// fakeCleanupEventBridge implements EventBridge APIs to find scheduled task rules.
+type fakeCleanupEventBridge struct {
+	eventbridgeiface.EventBridgeAPI
+	targets map[string][]*eventbridge.Target
+}
+
+func (f *fakeCleanupEventBridge) ListRuleNamesByTargetWithContext(_ aws.Context, _ *eventbridge.ListRuleNamesByTargetInput, _ ...request.Option) (*eventbridge.ListRuleNamesByTargetOutput, error) {
+	out := &eventbridge.ListRuleNamesByTargetOutput{}
+	for name := range f.targets {
+		out.RuleNames = append(out.RuleNames, aws.String(name))
+	}
+	return out, nil
+}
+
+func (f *fakeCleanupEventBridge) ListTargetsByRuleWithContext(_ aws.Context, in *eventbridge.ListTargetsByRuleInput, _ ...request.Option) (*eventbridge.ListTargetsByRuleOutput, error) {
+	return &eventbridge.ListTargetsByRuleOutput{Targets: f.targets[aws.StringValue(in.Rule)]}, nil
+}
+
+func TestBuildCleanupPlanExcludesSharedResources(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	const clusterArn = "arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"
+	own := awslogsTaskDefinition("test", "/ecs/test", "/ecs/shared")
+	other := awslogsTaskDefinition("other", "/ecs/other")
+	deploying := awslogsTaskDefinition("deploying", "/ecs/shared")
+	newService := func(name string, td *ecs.TaskDefinition, status string) *ecs.Service {
+		return &ecs.Service{
+			ServiceName:    aws.String(name),
+			ServiceArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:service/default2/" + name),
+			ClusterArn:     aws.String(clusterArn),
+			Status:         aws.String(status),
+			TaskDefinition: td.TaskDefinitionArn,
+		}
+	}
+	sv := newService("test", own, "ACTIVE")
+	otherSv := newService("other", other, "ACTIVE")
+	otherSv.Deployments = []*ecs.Deployment{{TaskDefinition: deploying.TaskDefinitionArn}}
+	fakeECS := &fakeCleanupECS{
+		services: []*ecs.Service{
+			sv,
+			otherSv,
+			// log groups of inactive services are not used
+			newService("deleted", awslogsTaskDefinition("deleted", "/ecs/test"), "INACTIVE"),
+		},
+		tds: map[string]*ecs.TaskDefinition{},
+	}
+	for _, td := range []*ecs.TaskDefinition{own, other, deploying} {
+		fakeECS.tds[aws.StringValue(td.TaskDefinitionArn)] = td
+	}
+	target := func(id, arn string, td *ecs.TaskDefinition) *eventbridge.Target {
+		return &eventbridge.Target{
+			Id:            aws.String(id),
+			Arn:           aws.String(arn),
+			EcsParameters: &eventbridge.EcsParameters{TaskDefinitionArn: td.TaskDefinitionArn},
+		}
+	}
+	eb := &fakeCleanupEventBridge{
+		targets: map[string][]*eventbridge.Target{
+			"own": {target("1", clusterArn, own)},
+			"shared": {
+				target("1", clusterArn, own),
+				target("2", clusterArn, other),
+				target("3", "arn:aws:ecs:ap-northeast-1:123456789012:cluster/default", own),
+			},
+		},
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:                    fakeECS,
+		EventBridge:            eb,
+		ApplicationAutoScaling: &fakeAutoScaling{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, rules, err := app.CleanupPlanOf(context.Background(), sv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"/ecs/test"}; !reflect.DeepEqual(groups, expected) {
+		t.Errorf("unexpected log groups %v expected %v", groups, expected)
+	}
+	if expected := map[string][]string{"own": {"1"}, "shared": {"1"}}; !reflect.DeepEqual(rules, expected) {
+		t.Errorf("unexpected rule targets %v expected %v", rules, expected)
+	}
+}
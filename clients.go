@@ -0,0 +1,104 @@
+package ecspresso
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling/applicationautoscalingiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/codedeploy/codedeployiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/aws/aws-sdk-go/service/servicediscovery/servicediscoveryiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// AWSClients represents AWS service clients used by App.
+// Nil fields are created from the session of the configuration.
+// Set fakes implementing the interfaces to run commands without AWS.
+type AWSClients struct {
+	ECS                    ecsiface.ECSAPI
+	ApplicationAutoScaling applicationautoscalingiface.ApplicationAutoScalingAPI
+	CodeDeploy             codedeployiface.CodeDeployAPI
+	CloudWatch             cloudwatchiface.CloudWatchAPI
+	CloudWatchLogs         cloudwatchlogsiface.CloudWatchLogsAPI
+	IAM                    iamiface.IAMAPI
+	ServiceDiscovery       servicediscoveryiface.ServiceDiscoveryAPI
+	DynamoDB               dynamodbiface.DynamoDBAPI
+	S3                     s3iface.S3API
+	EventBridge            eventbridgeiface.EventBridgeAPI
+	ELBv2                  elbv2iface.ELBV2API
+	ECR                    ecriface.ECRAPI
+	EC2                    ec2iface.EC2API
+	STS                    stsiface.STSAPI
+}
+
+// fill creates clients for nil fields from the session.
+func (c *AWSClients) fill(sess *session.Session) {
+	if c.ECS == nil {
+		c.ECS = ecs.New(sess)
+	}
+	if c.ApplicationAutoScaling == nil {
+		c.ApplicationAutoScaling = applicationautoscaling.New(sess)
+	}
+	if c.CodeDeploy == nil {
+		c.CodeDeploy = codedeploy.New(sess)
+	}
+	if c.CloudWatch == nil {
+		c.CloudWatch = cloudwatch.New(sess)
+	}
+	if c.CloudWatchLogs == nil {
+		c.CloudWatchLogs = cloudwatchlogs.New(sess)
+	}
+	if c.IAM == nil {
+		c.IAM = iam.New(sess)
+	}
+	if c.ServiceDiscovery == nil {
+		c.ServiceDiscovery = servicediscovery.New(sess)
+	}
+	if c.DynamoDB == nil {
+		c.DynamoDB = dynamodb.New(sess)
+	}
+	if c.S3 == nil {
+		c.S3 = s3.New(sess)
+	}
+	if c.EventBridge == nil {
+		c.EventBridge = eventbridge.New(sess)
+	}
+	if c.ELBv2 == nil {
+		c.ELBv2 = elbv2.New(sess)
+	}
+	if c.ECR == nil {
+		c.ECR = ecr.New(sess)
+	}
+	if c.EC2 == nil {
+		c.EC2 = ec2.New(sess)
+	}
+	if c.STS == nil {
+		c.STS = sts.New(sess)
+	}
+}
+
+// NewWithClients creates a new App with the AWS service clients.
+func NewWithClients(conf *Config, clients AWSClients) (*App, error) {
+	return newApp(conf, clients)
+}
@@ -0,0 +1,182 @@
+package ecspresso_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling/applicationautoscalingiface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/kayac/ecspresso"
+)
+
+// fakeECS implements a subset of ECS APIs used by the rolling deployment.
+// Calling other methods panics by the nil embedded interface.
+type fakeECS struct {
+	ecsiface.ECSAPI
+	service    *ecs.Service
+	registered *ecs.RegisterTaskDefinitionInput
+	updated    *ecs.UpdateServiceInput
+	waited     bool
+	onDescribe func(*ecs.Service)
+}
+
+func (f *fakeECS) DescribeServicesWithContext(_ aws.Context, _ *ecs.DescribeServicesInput, _ ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	if f.onDescribe != nil {
+		f.onDescribe(f.service)
+	}
+	return &ecs.DescribeServicesOutput{Services: []*ecs.Service{f.service}}, nil
+}
+
+func (f *fakeECS) RegisterTaskDefinitionWithContext(_ aws.Context, in *ecs.RegisterTaskDefinitionInput, _ ...request.Option) (*ecs.RegisterTaskDefinitionOutput, error) {
+	f.registered = in
+	return &ecs.RegisterTaskDefinitionOutput{
+		TaskDefinition: &ecs.TaskDefinition{
+			Family:            in.Family,
+			Revision:          aws.Int64(2),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/" + *in.Family + ":2"),
+		},
+	}, nil
+}
+
+func (f *fakeECS) UpdateServiceWithContext(_ aws.Context, in *ecs.UpdateServiceInput, _ ...request.Option) (*ecs.UpdateServiceOutput, error) {
+	f.updated = in
+	f.service.TaskDefinition = in.TaskDefinition
+	return &ecs.UpdateServiceOutput{Service: f.service}, nil
+}
+
+func (f *fakeECS) WaitUntilServicesStableWithContext(_ aws.Context, _ *ecs.DescribeServicesInput, _ ...request.WaiterOption) error {
+	f.waited = true
+	return nil
+}
+
+// fakeAutoScaling returns the scalable targets, and records registrations of them.
+// Describing them is allowed because the status before deploy shows them.
+type fakeAutoScaling struct {
+	applicationautoscalingiface.ApplicationAutoScalingAPI
+	targets    []*applicationautoscaling.ScalableTarget
+	registered []*applicationautoscaling.RegisterScalableTargetInput
+}
+
+func (f *fakeAutoScaling) DescribeScalableTargetsWithContext(_ aws.Context, _ *applicationautoscaling.DescribeScalableTargetsInput, _ ...request.Option) (*applicationautoscaling.DescribeScalableTargetsOutput, error) {
+	return &applicationautoscaling.DescribeScalableTargetsOutput{ScalableTargets: f.targets}, nil
+}
+
+func (f *fakeAutoScaling) DescribeScalingPoliciesWithContext(_ aws.Context, _ *applicationautoscaling.DescribeScalingPoliciesInput, _ ...request.Option) (*applicationautoscaling.DescribeScalingPoliciesOutput, error) {
+	return &applicationautoscaling.DescribeScalingPoliciesOutput{}, nil
+}
+
+func (f *fakeAutoScaling) DescribeScheduledActionsWithContext(_ aws.Context, _ *applicationautoscaling.DescribeScheduledActionsInput, _ ...request.Option) (*applicationautoscaling.DescribeScheduledActionsOutput, error) {
+	return &applicationautoscaling.DescribeScheduledActionsOutput{}, nil
+}
+
+func (f *fakeAutoScaling) RegisterScalableTargetWithContext(_ aws.Context, in *applicationautoscaling.RegisterScalableTargetInput, _ ...request.Option) (*applicationautoscaling.RegisterScalableTargetOutput, error) {
+	f.registered = append(f.registered, in)
+	return &applicationautoscaling.RegisterScalableTargetOutput{}, nil
+}
+
+func TestDeployWithFakeClients(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	fake := &fakeECS{
+		service: &ecs.Service{
+			ServiceName:    aws.String("test"),
+			ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+			DesiredCount:   aws.Int64(1),
+		},
+	}
+	as := &fakeAutoScaling{targets: []*applicationautoscaling.ScalableTarget{testScalableTarget()}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:                    fake,
+		ApplicationAutoScaling: as,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DeployWithContext(context.Background(), ecspresso.DeployOption{}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.registered == nil {
+		t.Error("task definition must be registered")
+	}
+	if fake.updated == nil || aws.StringValue(fake.updated.TaskDefinition) != "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/"+aws.StringValue(fake.registered.Family)+":2" {
+		t.Errorf("service must be updated with the registered task definition %v", fake.updated)
+	}
+	if !fake.waited {
+		t.Error("must wait for service stable")
+	}
+	if len(as.registered) > 0 {
+		t.Errorf("the suspended state of auto scaling must be kept without options of auto scaling: %v", as.registered)
+	}
+}
+
+func testScalableTarget() *applicationautoscaling.ScalableTarget {
+	return &applicationautoscaling.ScalableTarget{
+		ServiceNamespace:  aws.String("ecs"),
+		ScalableDimension: aws.String("ecs:service:DesiredCount"),
+		ResourceId:        aws.String("service/default2/test"),
+		MinCapacity:       aws.Int64(1),
+		MaxCapacity:       aws.Int64(4),
+		SuspendedState: &applicationautoscaling.SuspendedState{
+			DynamicScalingInSuspended:  aws.Bool(true),
+			DynamicScalingOutSuspended: aws.Bool(true),
+			ScheduledScalingSuspended:  aws.Bool(true),
+		},
+	}
+}
+
+func TestDeploySuspendAutoScalingDuringDeploy(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	fake := &fakeECS{
+		service: &ecs.Service{
+			ServiceName:    aws.String("test"),
+			ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+			DesiredCount:   aws.Int64(1),
+		},
+	}
+	target := testScalableTarget()
+	target.SuspendedState = &applicationautoscaling.SuspendedState{
+		DynamicScalingInSuspended:  aws.Bool(false),
+		DynamicScalingOutSuspended: aws.Bool(true),
+		ScheduledScalingSuspended:  aws.Bool(false),
+	}
+	as := &fakeAutoScaling{targets: []*applicationautoscaling.ScalableTarget{target}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:                    fake,
+		ApplicationAutoScaling: as,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DeployWithContext(context.Background(), ecspresso.DeployOption{
+		SuspendAutoScalingDuringDeploy: aws.Bool(true),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(as.registered) != 2 {
+		t.Fatalf("auto scaling must be suspended and restored: %v", as.registered)
+	}
+	if s := as.registered[0].SuspendedState; !aws.BoolValue(s.DynamicScalingInSuspended) || !aws.BoolValue(s.DynamicScalingOutSuspended) || !aws.BoolValue(s.ScheduledScalingSuspended) {
+		t.Errorf("auto scaling must be suspended during deploy: %s", s)
+	}
+	if s := as.registered[1].SuspendedState; aws.BoolValue(s.DynamicScalingInSuspended) || !aws.BoolValue(s.DynamicScalingOutSuspended) || aws.BoolValue(s.ScheduledScalingSuspended) {
+		t.Errorf("the original suspended state must be restored: %s", s)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/alecthomas/kingpin"
 	"github.com/aws/aws-sdk-go/aws"
@@ -21,33 +22,59 @@ func main() {
 func _main() int {
 	kingpin.Command("version", "show version")
 
-	conf := kingpin.Flag("config", "config file").Default("ecspresso.yml").String()
+	confs := kingpin.Flag("config", "config file. multiple files are deep merged in order").Default("ecspresso.yml").Strings()
+	env := kingpin.Flag("env", "environment name selected from environments in the config file").String()
+	region := kingpin.Flag("region", "AWS region. overrides region in the config").String()
+	cluster := kingpin.Flag("cluster", "ECS cluster name. overrides cluster in the config").HintAction(completeClusters).String()
+	service := kingpin.Flag("service", "ECS service name. overrides service in the config").HintAction(completeServices).String()
 	debug := kingpin.Flag("debug", "enable debug log").Bool()
+	quiet := kingpin.Flag("quiet", "show only warnings and errors").Short('q').Bool()
+	verbose := kingpin.Flag("verbose", "show timing of phases and request IDs of failed AWS API calls. -vv also dumps requests and responses of AWS API calls").Short('v').Counter()
 	envFiles := kingpin.Flag("envfile", "environment files").Strings()
 	extStr := kingpin.Flag("ext-str", "external string values for Jsonnet").StringMap()
 	extCode := kingpin.Flag("ext-code", "external code values for Jsonnet").StringMap()
+	vars := kingpin.Flag("var", "variables for definition files (key=value). takes precedence over vars in the config file").StringMap()
+	assumeRoleArn := kingpin.Flag("assume-role-arn", "ARN of the IAM role to assume for this invocation. overrides aws.assume_role_arn in the config").String()
+	readOnly := kingpin.Flag("read-only", "block AWS API calls which may change resources").Envar("ECSPRESSO_READ_ONLY").Bool()
+	tfstateCache := kingpin.Flag("tfstate-cache", "TTL of the cache of values looked up by the tfstate plugin (e.g. 10m). disabled by default").Duration()
 
 	colorDefault := "false"
 	if isatty.IsTerminal(os.Stdout.Fd()) {
 		colorDefault = "true"
 	}
 	colorOpt := kingpin.Flag("color", "enable colored output").Default(colorDefault).Bool()
+	var isSetInteractive bool
+	interactive := kingpin.Flag("interactive", "show the plan and require typed confirmation before deploy, delete and rollback").IsSetByUser(&isSetInteractive).Bool()
+	logFormat := kingpin.Flag("log-format", "log format (text or json)").Default(ecspresso.LogFormatText).Enum(ecspresso.LogFormatText, ecspresso.LogFormatJSON)
 
 	var isSetSuspendAutoScaling, isSetResumeAutoScaling bool
 	deploy := kingpin.Command("deploy", "deploy service")
 	deploy.Flag("resume-auto-scaling", "resume application auto-scaling attached with the ECS service").IsSetByUser(&isSetResumeAutoScaling).Bool()
 	deployOption := ecspresso.DeployOption{
-		DryRun:               deploy.Flag("dry-run", "dry-run").Bool(),
-		DesiredCount:         deploy.Flag("tasks", "desired count of tasks").Default("-1").Int64(),
-		SkipTaskDefinition:   deploy.Flag("skip-task-definition", "skip register a new task definition").Bool(),
-		ForceNewDeployment:   deploy.Flag("force-new-deployment", "force a new deployment of the service").Bool(),
-		NoWait:               deploy.Flag("no-wait", "exit ecspresso immediately after just deployed without waiting for service stable").Bool(),
-		SuspendAutoScaling:   deploy.Flag("suspend-auto-scaling", "suspend application auto-scaling attached with the ECS service").IsSetByUser(&isSetSuspendAutoScaling).Bool(),
-		RollbackEvents:       deploy.Flag("rollback-events", " roll back when specified events happened (DEPLOYMENT_FAILURE,DEPLOYMENT_STOP_ON_ALARM,DEPLOYMENT_STOP_ON_REQUEST,...) CodeDeploy only.").String(),
-		UpdateService:        deploy.Flag("update-service", "update service attributes by service definition").Default("true").Bool(),
-		LatestTaskDefinition: deploy.Flag("latest-task-definition", "deploy with latest task definition without registering new task definition").Default("false").Bool(),
+		DryRun:                         deploy.Flag("dry-run", "dry-run").Bool(),
+		DesiredCount:                   deploy.Flag("tasks", "desired count of tasks").Default("-1").Int64(),
+		SkipTaskDefinition:             deploy.Flag("skip-task-definition", "skip register a new task definition").Bool(),
+		ForceNewDeployment:             deploy.Flag("force-new-deployment", "force a new deployment of the service").Bool(),
+		NoWait:                         deploy.Flag("no-wait", "exit ecspresso immediately after just deployed without waiting for service stable").Bool(),
+		SuspendAutoScaling:             deploy.Flag("suspend-auto-scaling", "suspend application auto-scaling attached with the ECS service").IsSetByUser(&isSetSuspendAutoScaling).Bool(),
+		SuspendAutoScalingDuringDeploy: deploy.Flag("suspend-auto-scaling-during-deploy", "suspend application auto-scaling while deploying and restore the suspended state after the service is stable").Bool(),
+		RollbackEvents:                 deploy.Flag("rollback-events", " roll back when specified events happened (DEPLOYMENT_FAILURE,DEPLOYMENT_STOP_ON_ALARM,DEPLOYMENT_STOP_ON_REQUEST,...) CodeDeploy only.").String(),
+		UpdateService:                  deploy.Flag("update-service", "update service attributes by service definition").Default("true").Bool(),
+		LatestTaskDefinition:           deploy.Flag("latest-task-definition", "deploy with latest task definition without registering new task definition").Default("false").Bool(),
+		AllowScaleDown:                 deploy.Flag("allow-scale-down", "allow to reduce desired count by the service definition more than scale_down_protection").Bool(),
+		ForceUnlock:                    deploy.Flag("force-unlock", "release the deployment lock held by another process before acquiring it").Bool(),
+		Estimate:                       deploy.Flag("estimate", "show estimated monthly cost delta with --dry-run").Bool(),
+		SummaryJSON:                    deploy.Flag("summary-json", "write the summary of the deployment to the file as JSON").String(),
+		SummaryMarkdown:                deploy.Flag("summary-markdown", "write the summary of the deployment to the file as Markdown").String(),
+		HealthCheckGracePeriodSeconds:  deploy.Flag("health-check-grace-period-seconds", "override healthCheckGracePeriodSeconds of the service for this deploy").Default("-1").Int64(),
+		MinimumHealthyPercent:          deploy.Flag("minimum-healthy-percent", "override deploymentConfiguration.minimumHealthyPercent of the service for this deploy").Default("-1").Int64(),
+		MaximumPercent:                 deploy.Flag("maximum-percent", "override deploymentConfiguration.maximumPercent of the service for this deploy").Default("-1").Int64(),
+		RollbackOnFailure:              deploy.Flag("rollback-on-failure", "roll back to the previous task definition when waiting for service stable failed or timed out. rolling deployments only").Bool(),
+		RecreateService:                deploy.Flag("recreate-service", "recreate the service without downtime when load balancers in the service definition can not be updated").Bool(),
+		SkipLogCheck:                   deploy.Flag("skip-log-check", "skip checking logs of new tasks by log_check in the config").Bool(),
 	}
 
+	var isSetAutoScalingMin, isSetAutoScalingMax bool
 	scale := kingpin.Command("scale", "scale service. equivalent to deploy --skip-task-definition --no-update-service")
 	scale.Flag("resume-auto-scaling", "resume application auto-scaling attached with the ECS service").IsSetByUser(&isSetResumeAutoScaling).Bool()
 	scaleOption := ecspresso.DeployOption{
@@ -55,10 +82,13 @@ func _main() int {
 		DesiredCount:         scale.Flag("tasks", "desired count of tasks").Default("-1").Int64(),
 		SkipTaskDefinition:   boolp(true),
 		SuspendAutoScaling:   scale.Flag("suspend-auto-scaling", "suspend application auto-scaling attached with the ECS service").IsSetByUser(&isSetSuspendAutoScaling).Bool(),
+		AutoScalingMin:       scale.Flag("auto-scaling-min", "set min capacity of application auto-scaling attached with the ECS service").IsSetByUser(&isSetAutoScalingMin).Int64(),
+		AutoScalingMax:       scale.Flag("auto-scaling-max", "set max capacity of application auto-scaling attached with the ECS service").IsSetByUser(&isSetAutoScalingMax).Int64(),
 		ForceNewDeployment:   boolp(false),
 		NoWait:               scale.Flag("no-wait", "exit ecspresso immediately after just deployed without waiting for service stable").Bool(),
 		UpdateService:        boolp(false),
 		LatestTaskDefinition: boolp(false),
+		ForceUnlock:          scale.Flag("force-unlock", "release the deployment lock held by another process before acquiring it").Bool(),
 	}
 
 	refresh := kingpin.Command("refresh", "refresh service. equivalent to deploy --skip-task-definition --force-new-deployment --no-update-service")
@@ -70,6 +100,17 @@ func _main() int {
 		NoWait:               refresh.Flag("no-wait", "exit ecspresso immediately after just deployed without waiting for service stable").Bool(),
 		UpdateService:        boolp(false),
 		LatestTaskDefinition: boolp(false),
+		ForceUnlock:          refresh.Flag("force-unlock", "release the deployment lock held by another process before acquiring it").Bool(),
+		SkipLogCheck:         refresh.Flag("skip-log-check", "skip checking logs of new tasks by log_check in the config").Bool(),
+	}
+
+	capacity := kingpin.Command("capacity", "show or change the capacity provider strategy of the service")
+	capacityOption := ecspresso.CapacityOption{
+		Strategy:    capacity.Flag("strategy", "new capacity provider strategy NAME=WEIGHT[:BASE],... (e.g. FARGATE=1:1,FARGATE_SPOT=1). shows the live strategy when omitted").String(),
+		DryRun:      capacity.Flag("dry-run", "dry-run").Bool(),
+		NoWait:      capacity.Flag("no-wait", "exit ecspresso immediately after just deployed without waiting for service stable").Bool(),
+		ForceUnlock: capacity.Flag("force-unlock", "release the deployment lock held by another process before acquiring it").Bool(),
+		ExitCode:    capacity.Flag("exit-code", "exit with non-zero status when the live strategy differs from the service definition").Bool(),
 	}
 
 	create := kingpin.Command("create", "create service")
@@ -81,7 +122,28 @@ func _main() int {
 
 	status := kingpin.Command("status", "show status of service")
 	statusOption := ecspresso.StatusOption{
-		Events: status.Flag("events", "show events num").Default("2").Int(),
+		Events:        status.Flag("events", "show events num").Default("2").Int(),
+		Metrics:       status.Flag("metrics", "show CPU and memory utilization from Container Insights").Bool(),
+		MetricsPeriod: status.Flag("metrics-period", "period to average Container Insights metrics").Default("5m").Duration(),
+	}
+
+	alarms := kingpin.Command("alarms", "discover CloudWatch alarms of target groups of the service for deployment alarms")
+	alarmsOption := ecspresso.AlarmsOption{
+		Write:          alarms.Flag("write", "add the alarms to deploymentConfiguration in the service definition file").Bool(),
+		Rollback:       alarms.Flag("rollback", "roll back the deployment when the alarms go into ALARM. used when no alarms are configured yet").Default("true").Bool(),
+		ForceOverwrite: alarms.Flag("force-overwrite", "overwrite the service definition file without confirmation").Bool(),
+	}
+
+	export := kingpin.Command("export", "export IaC resource definitions equivalent to the config")
+	exportOption := ecspresso.ExportOption{
+		Format:         export.Flag("format", "output format (terraform|cloudformation)").Required().Enum(ecspresso.ExportFormatTerraform, ecspresso.ExportFormatCloudFormation),
+		ScheduledTasks: export.Flag("scheduled-tasks", "export scheduled task rules running the task definition family").Default("true").Bool(),
+	}
+
+	ls := kingpin.Command("ls", "list services in the cluster with their status")
+	lsOption := ecspresso.LsOption{
+		Tags:   ls.Flag("tags", "list only services which have all the tags: format is KeyFoo=ValueFoo,KeyBar=ValueBar").String(),
+		Output: ls.Flag("output", "output format (table|json|tsv)").Default("table").Enum("table", "json", "tsv"),
 	}
 
 	rollback := kingpin.Command("rollback", "roll back a service")
@@ -90,12 +152,29 @@ func _main() int {
 		DeregisterTaskDefinition: rollback.Flag("deregister-task-definition", "deregister a rolled-back task definition. not works with --no-wait").Bool(),
 		NoWait:                   rollback.Flag("no-wait", "exit ecspresso immediately after just rolled back without waiting for service stable").Bool(),
 		RollbackEvents:           rollback.Flag("rollback-events", " roll back when specified events happened (DEPLOYMENT_FAILURE,DEPLOYMENT_STOP_ON_ALARM,DEPLOYMENT_STOP_ON_REQUEST,...) CodeDeploy only.").String(),
+		ForceUnlock:              rollback.Flag("force-unlock", "release the deployment lock held by another process before acquiring it").Bool(),
 	}
 
 	delete := kingpin.Command("delete", "delete service")
 	deleteOption := ecspresso.DeleteOption{
-		DryRun: delete.Flag("dry-run", "dry-run").Bool(),
-		Force:  delete.Flag("force", "delete without confirmation").Bool(),
+		DryRun:  delete.Flag("dry-run", "dry-run").Bool(),
+		Force:   delete.Flag("force", "delete without confirmation. required when deletion_protection is enabled").Bool(),
+		Cleanup: delete.Flag("cleanup", "delete associated resources (scalable target, scheduled task rules, Cloud Map services and log groups) with the service").Bool(),
+	}
+
+	recreate := kingpin.Command("recreate", "recreate service to apply changes of immutable fields (launch type, scheduling strategy, network mode, service name and load balancers)")
+	recreateOption := ecspresso.RecreateOption{
+		DryRun:      recreate.Flag("dry-run", "dry-run").Bool(),
+		FromService: recreate.Flag("from-service", "name of the existing service to be recreated as the service in the config").String(),
+		Force:       recreate.Flag("force", "recreate without confirmation, even if no immutable fields are changed").Bool(),
+	}
+
+	drain := kingpin.Command("drain", "set container instances to DRAINING and wait for tasks to be rescheduled")
+	drainOption := ecspresso.DrainOption{
+		Instances: drain.Flag("instance", "container instance ID, ARN or EC2 instance ID to drain (repeatable)").Strings(),
+		Filter:    drain.Flag("filter", "cluster query language expression selecting container instances to drain").String(),
+		DryRun:    drain.Flag("dry-run", "dry-run").Bool(),
+		NoWait:    drain.Flag("no-wait", "exit ecspresso immediately after container instances are set to DRAINING").Bool(),
 	}
 
 	run := kingpin.Command("run", "run task")
@@ -112,37 +191,60 @@ func _main() int {
 		LatestTaskDefinition: run.Flag("latest-task-definition", "run with latest task definition without registering new task definition").Default("false").Bool(),
 		PropagateTags:        run.Flag("propagate-tags", "propagate the tags for the task (SERVICE or TASK_DEFINITION)").Default("").Enum("SERVICE", "TASK_DEFINITION", ""),
 		Tags:                 run.Flag("tags", "tags for the task: format is KeyFoo=ValueFoo,KeyBar=ValueBar").String(),
-		Revision:             run.Flag("revision", "revision of the task definition to run when --skip-task-definition").Default("0").Int64(),
+		Revision:             run.Flag("revision", "revision of the task definition to run when --skip-task-definition").Default("0").HintAction(completeTaskDefinitions).Int64(),
+		ScheduledTask:        run.Flag("scheduled-task", "run the same task as the EventBridge scheduled task rule runs. RULE or RULE/TARGET_ID").String(),
 	}
 
 	register := kingpin.Command("register", "register task definition")
 	registerOption := ecspresso.RegisterOption{
-		DryRun: register.Flag("dry-run", "dry-run").Bool(),
-		Output: register.Flag("output", "output registered task definition").Bool(),
+		DryRun:       register.Flag("dry-run", "dry-run").Bool(),
+		Output:       register.Flag("output", "output registered task definition").Bool(),
+		Tags:         register.Flag("tags", "tags for the new revision: format is KeyFoo=ValueFoo,KeyBar=ValueBar").String(),
+		ArnFile:      register.Flag("arn-file", "write the ARN of the registered task definition to the file").String(),
+		GitHubOutput: register.Flag("github-output", "write the ARN of the registered task definition to task_definition_arn of GITHUB_OUTPUT").Bool(),
 	}
 
 	deregister := kingpin.Command("deregister", "deregister task definition")
 	deregisterOption := ecspresso.DeregisterOption{
 		DryRun:   deregister.Flag("dry-run", "dry-run").Bool(),
-		Revision: deregister.Flag("revision", "revision number to deregister").Int64(),
+		Revision: deregister.Flag("revision", "revision number to deregister").HintAction(completeTaskDefinitions).Int64(),
 		Keeps:    deregister.Flag("keeps", "numbers of keep latest revisions except in-use").Int(),
-		Force:    deregister.Flag("force", "deregister without confirmation").Bool(),
+		Force:    deregister.Flag("force", "deregister without confirmation, even if the revision is referenced").Bool(),
+	}
+
+	cleanup := kingpin.Command("cleanup", "delete stale resources of the service")
+	cleanupOption := ecspresso.CleanupOption{
+		DryRun:                cleanup.Flag("dry-run", "dry-run").Bool(),
+		TaskDefinitions:       cleanup.Flag("task-definitions", "delete INACTIVE task definition revisions of the family").Default("true").Bool(),
+		LogStreamsDays:        cleanup.Flag("log-streams-days", "delete log streams with no events in the days in log groups of the task definition (0: disabled)").Default("0").Int64(),
+		ECRUntaggedImages:     cleanup.Flag("ecr-untagged-images", "delete untagged images in ECR repositories of the task definition").Bool(),
+		ECRUntaggedImagesDays: cleanup.Flag("ecr-untagged-images-days", "delete untagged images pushed more than the days ago").Default("7").Int64(),
+		Force:                 cleanup.Flag("force", "delete without confirmation").Bool(),
 	}
 
 	revisions := kingpin.Command("revisions", "show revisions of task definitions")
 	revisionsOption := ecspresso.RevisionsOption{
 		Output:   revisions.Flag("output", "output format (table|json|tsv)").Default("table").Enum("table", "json", "tsv"),
-		Revision: revisions.Flag("revision", "revision number to output task definition as JSON").Int64(),
+		Revision: revisions.Flag("revision", "revision number to output task definition as JSON").HintAction(completeTaskDefinitions).Int64(),
 	}
 
-	_ = kingpin.Command("wait", "wait until service stable")
-	waitOption := ecspresso.WaitOption{}
+	deployments := kingpin.Command("deployments", "show history of deployments of the service")
+	deploymentsOption := ecspresso.DeploymentsOption{
+		Count:  deployments.Flag("count", "number of deployments to show").Default("10").Int64(),
+		Output: deployments.Flag("output", "output format (table|json|tsv)").Default("table").Enum("table", "json", "tsv"),
+		State:  deployments.Flag("state", "show the history recorded in the state on S3").Bool(),
+	}
+
+	wait := kingpin.Command("wait", "wait until service stable")
+	waitOption := ecspresso.WaitOption{
+		Until: wait.Flag("until", "wait until the condition (tasks-running=N|target-healthy|deployment-completed=ID|no-pending-tasks)[,timeout=DURATION] instead of service stable. can be specified multiple times").Strings(),
+	}
 
 	init := kingpin.Command("init", "create service/task definition files by existing ECS service")
 	initOption := ecspresso.InitOption{
-		Region:                init.Flag("region", "AWS region name").Default(os.Getenv("AWS_REGION")).String(),
-		Cluster:               init.Flag("cluster", "cluster name").Default("default").String(),
-		Service:               init.Flag("service", "service name").Required().String(),
+		Region:                region,
+		Cluster:               cluster,
+		Service:               service,
 		TaskDefinitionPath:    init.Flag("task-definition-path", "output task definition file path").Default("ecs-task-def.json").String(),
 		ServiceDefinitionPath: init.Flag("service-definition-path", "output service definition file path").Default("ecs-service-def.json").String(),
 		ForceOverwrite:        init.Flag("force-overwrite", "force overwrite files").Bool(),
@@ -151,7 +253,35 @@ func _main() int {
 
 	diff := kingpin.Command("diff", "display diff for task definition compared with latest one on ECS")
 	diffOption := ecspresso.DiffOption{
-		Unified: diff.Flag("unified", "display diff in unified format").Bool(),
+		Unified:  diff.Flag("unified", "display diff in unified format").Bool(),
+		ExitCode: diff.Flag("exit-code", "exit with non-zero status when differences are found").Bool(),
+		Revision: diff.Flag("revision", "compare the task definition with the revision instead of the deployed one").HintAction(completeTaskDefinitions).Int64(),
+		Against:  diff.Flag("against", "compare the task definition with the rendered task definition file instead of remote").String(),
+	}
+
+	drift := kingpin.Command("drift", "detect out-of-band changes of service made after the last deployment by ecspresso")
+	driftOption := ecspresso.DriftOption{
+		Unified:  drift.Flag("unified", "display diff in unified format").Bool(),
+		ExitCode: drift.Flag("exit-code", "exit with non-zero status when drift is detected").Bool(),
+	}
+
+	estimate := kingpin.Command("estimate", "estimate monthly cost delta of the task definition and desired count compared to the running service")
+	estimateOption := ecspresso.EstimateOption{
+		DesiredCount: estimate.Flag("tasks", "desired count of tasks").Default("-1").Int64(),
+	}
+
+	compare := kingpin.Command("compare", "display diff of rendered definitions between the config and another config or environment")
+	compareOption := ecspresso.CompareOption{
+		Configs:  compare.Flag("with-config", "config file to compare with. multiple files are deep merged in order (default: same as --config)").Strings(),
+		Env:      compare.Flag("with-env", "environment to compare with").String(),
+		Unified:  compare.Flag("unified", "display diff in unified format").Bool(),
+		ExitCode: compare.Flag("exit-code", "exit with non-zero status when differences are found").Bool(),
+	}
+
+	tags := kingpin.Command("tags", "manage tags of the service and related resources")
+	tagsSync := tags.Command("sync", "reconcile tags in the config onto the service, task definitions and scheduled task rules")
+	tagsSyncOption := ecspresso.TagsSyncOption{
+		DryRun: tagsSync.Flag("dry-run", "dry-run").Bool(),
 	}
 
 	appspec := kingpin.Command("appspec", "output AppSpec YAML for CodeDeploy to STDOUT")
@@ -162,10 +292,15 @@ func _main() int {
 
 	verify := kingpin.Command("verify", "verify resources in configurations")
 	verifyOption := ecspresso.VerifyOption{
-		GetSecrets: verify.Flag("get-secrets", "get secrets from ParameterStore or SecretsManager").Default("true").Bool(),
-		PutLogs:    verify.Flag("put-logs", "put verification logs to CloudWatch Logs").Default("true").Bool(),
+		GetSecrets:       verify.Flag("get-secrets", "get secrets from ParameterStore or SecretsManager").Default("true").Bool(),
+		PutLogs:          verify.Flag("put-logs", "put verification logs to CloudWatch Logs").Default("true").Bool(),
+		PlaintextSecrets: verify.Flag("plaintext-secrets", "how to treat environment values that look like secrets (warn, error, ignore)").Default(ecspresso.PlaintextSecretsWarn).Enum(ecspresso.PlaintextSecretsWarn, ecspresso.PlaintextSecretsError, ecspresso.PlaintextSecretsIgnore),
+		IAM:              verify.Flag("iam", "check the caller can perform API actions of deploy by the IAM policy simulation").Bool(),
 	}
 
+	kingpin.Command("precheck", "check the network environment of the service before the first deploy")
+	precheckOption := ecspresso.PrecheckOption{}
+
 	render := kingpin.Command("render", "render config, service definition or task definition file to stdout")
 	renderOption := ecspresso.RenderOption{
 		ServiceDefinition: render.Flag("service-definition", "render service definition").Bool(),
@@ -173,9 +308,14 @@ func _main() int {
 		ConfigFile:        render.Flag("config-file", "render config file").Bool(),
 	}
 
+	normalize := kingpin.Command("normalize", "print the task definition normalized as diff compares")
+	normalizeOption := ecspresso.NormalizeOption{
+		File: normalize.Flag("file", "task definition file to normalize instead of the task definition in the config").String(),
+	}
+
 	tasks := kingpin.Command("tasks", "list tasks that are in a service or having the same family")
 	tasksOption := ecspresso.TasksOption{
-		ID:     tasks.Flag("id", "task ID").Default("").String(),
+		ID:     tasks.Flag("id", "task ID").Default("").HintAction(completeTaskIDs).String(),
 		Output: tasks.Flag("output", "output format (table|json|tsv)").Default("table").Enum("table", "json", "tsv"),
 		Find:   tasks.Flag("find", "find a task from tasks list and dump it as JSON").Bool(),
 		Stop:   tasks.Flag("stop", "stop a task").Bool(),
@@ -185,7 +325,7 @@ func _main() int {
 
 	exec := kingpin.Command("exec", "execute command in a task")
 	execOption := ecspresso.ExecOption{
-		ID:          exec.Flag("id", "task ID").Default("").String(),
+		ID:          exec.Flag("id", "task ID").Default("").HintAction(completeTaskIDs).String(),
 		Command:     exec.Flag("command", "command").Default("sh").String(),
 		Container:   exec.Flag("container", "container name").String(),
 		LocalPort:   exec.Flag("local-port", "local port number").Default("0").Int(),
@@ -193,11 +333,47 @@ func _main() int {
 		PortForward: exec.Flag("port-forward", "enable port forward").Default("false").Bool(),
 	}
 
+	kingpin.Command("validate", "validate the config file and definition files without calling AWS APIs")
+	validateOption := ecspresso.ValidateOption{}
+
+	schema := kingpin.Command("schema", "print JSON Schema of the config file or definition files")
+	schemaOption := ecspresso.SchemaOption{
+		Type: schema.Flag("type", "type of schema").Default(ecspresso.SchemaTypeConfig).Enum(
+			ecspresso.SchemaTypeConfig,
+			ecspresso.SchemaTypeTaskDefinition,
+			ecspresso.SchemaTypeServiceDefinition,
+			ecspresso.SchemaTypeAutoScalingDefinition,
+		),
+	}
+
+	completion := kingpin.Command("completion", "print shell completion script")
+	completionOption := ecspresso.CompletionOption{
+		Shell: completion.Arg("shell", "shell (bash, zsh or fish)").Required().Enum(
+			ecspresso.CompletionShellBash,
+			ecspresso.CompletionShellZsh,
+			ecspresso.CompletionShellFish,
+		),
+	}
+
 	sub := kingpin.Parse()
 	if sub == "version" {
 		fmt.Println("ecspresso", Version)
 		return 0
 	}
+	if sub == "completion" {
+		if err := ecspresso.Completion(completionOption); err != nil {
+			log.Printf("%s FAILED. %s", sub, err)
+			return 1
+		}
+		return 0
+	}
+	if sub == "schema" {
+		if err := ecspresso.Schema(schemaOption); err != nil {
+			log.Printf("%s FAILED. %s", sub, err)
+			return 1
+		}
+		return 0
+	}
 
 	color.NoColor = !*colorOpt
 	for _, envFile := range *envFiles {
@@ -208,35 +384,88 @@ func _main() int {
 	}
 
 	c := ecspresso.NewDefaultConfig()
+	c.TFStateCacheTTL = *tfstateCache
+	c.AssumeRoleArn = *assumeRoleArn
+	c.ReadOnly = *readOnly
 	if sub == "init" {
+		if *service == "" {
+			log.Println("--service is required for init")
+			return 1
+		}
 		c.Region = *initOption.Region
+		if c.Region == "" {
+			c.Region = os.Getenv("AWS_REGION")
+		}
 		c.Cluster = *initOption.Cluster
 		c.Service = *initOption.Service
 		c.TaskDefinitionPath = *initOption.TaskDefinitionPath
 		c.ServiceDefinitionPath = *initOption.ServiceDefinitionPath
-		initOption.ConfigFilePath = conf
+		initOption.ConfigFilePath = &(*confs)[len(*confs)-1]
 		if err := c.Restrict(); err != nil {
 			log.Println("Could not init config", err)
 			return 1
 		}
-	} else {
-		if err := c.Load(*conf); err != nil {
-			log.Println("Could not load config file", *conf, err)
-			kingpin.Usage()
-			return 1
+	} else if sub == "ls" && !configFilesExist(*confs) {
+		// ls works without config files
+		c.Region = *region
+		if c.Region == "" {
+			c.Region = os.Getenv("AWS_REGION")
 		}
-		if err := c.ValidateVersion(Version); err != nil {
-			log.Println(err.Error())
+		c.Cluster = *cluster
+		if err := c.Restrict(); err != nil {
+			log.Println("Could not init config", err)
 			return 1
 		}
+	} else {
+		c.Environment = *env
+		c.RegionOverride = *region
+		c.ClusterOverride = *cluster
+		c.ServiceOverride = *service
+		defer c.Cleanup()
+		if sub == "validate" {
+			// problems of the config files are reported by validate
+			c.LoadForValidation(*confs...)
+		} else {
+			if err := c.Load(*confs...); err != nil {
+				log.Println("Could not load config file", strings.Join(*confs, ","), err)
+				kingpin.Usage()
+				return 1
+			}
+			if err := c.ValidateVersion(Version); err != nil {
+				log.Println(err.Error())
+				return 1
+			}
+		}
+		if isSetInteractive {
+			c.Interactive = *interactive
+		}
+		c.SetVars(*vars)
 	}
 
+	if *quiet && *verbose > 0 {
+		log.Println("--quiet and --verbose can not be specified together")
+		return 1
+	}
 	app, err := ecspresso.NewApp(c)
 	if err != nil {
 		log.Println(err)
 		return 1
 	}
-	app.Debug = *debug
+	defer func() {
+		if err := app.Shutdown(); err != nil {
+			log.Println("failed to shutdown tracer", err)
+		}
+	}()
+	app.Debug = *debug || *verbose >= ecspresso.VerbosityDump
+	switch {
+	case *quiet:
+		app.Verbosity = ecspresso.VerbosityQuiet
+	case *verbose > ecspresso.VerbosityDump:
+		app.Verbosity = ecspresso.VerbosityDump
+	default:
+		app.Verbosity = *verbose
+	}
+	app.LogFormat = *logFormat
 	app.ExtStr = *extStr
 	app.ExtCode = *extCode
 
@@ -258,15 +487,33 @@ func _main() int {
 		if isSetResumeAutoScaling {
 			scaleOption.SuspendAutoScaling = aws.Bool(false)
 		}
+		if !isSetAutoScalingMin {
+			scaleOption.AutoScalingMin = nil
+		}
+		if !isSetAutoScalingMax {
+			scaleOption.AutoScalingMax = nil
+		}
 		err = app.Deploy(scaleOption)
+	case "capacity":
+		err = app.Capacity(capacityOption)
 	case "status":
 		err = app.Status(statusOption)
+	case "ls":
+		err = app.Ls(lsOption)
+	case "alarms":
+		err = app.Alarms(alarmsOption)
+	case "export":
+		err = app.Export(exportOption)
 	case "rollback":
 		err = app.Rollback(rollbackOption)
 	case "create":
 		err = app.Create(createOption)
 	case "delete":
 		err = app.Delete(deleteOption)
+	case "recreate":
+		err = app.Recreate(recreateOption)
+	case "drain":
+		err = app.Drain(drainOption)
 	case "run":
 		err = app.Run(runOption)
 	case "wait":
@@ -275,18 +522,36 @@ func _main() int {
 		err = app.Register(registerOption)
 	case "deregister":
 		err = app.Deregister(deregisterOption)
+	case "cleanup":
+		err = app.Cleanup(cleanupOption)
 	case "revisions":
 		err = app.Revesions(revisionsOption)
+	case "deployments":
+		err = app.Deployments(deploymentsOption)
 	case "init":
 		err = app.Init(initOption)
 	case "diff":
 		err = app.Diff(diffOption)
+	case "drift":
+		err = app.Drift(driftOption)
+	case "estimate":
+		err = app.Estimate(estimateOption)
+	case "compare":
+		err = app.Compare(compareOption)
+	case "tags sync":
+		err = app.TagsSync(tagsSyncOption)
 	case "appspec":
 		err = app.AppSpec(appspecOption)
 	case "verify":
 		err = app.Verify(verifyOption)
+	case "validate":
+		err = app.Validate(validateOption)
+	case "precheck":
+		err = app.Precheck(precheckOption)
 	case "render":
 		err = app.Render(renderOption)
+	case "normalize":
+		err = app.Normalize(normalizeOption)
 	case "tasks":
 		err = app.Tasks(tasksOption)
 	case "exec":
@@ -296,13 +561,72 @@ func _main() int {
 		return 1
 	}
 	if err != nil {
-		log.Printf("%s FAILED. %s", sub, err)
-		return 1
+		app.LogFailed(sub, err)
+		if app.Interrupted() {
+			return ecspresso.ExitCodeInterrupted
+		}
+		return ecspresso.ExitCodeOf(err)
 	}
 
 	return 0
 }
 
+// completionRegion returns the region to complete values on the command line before parsed.
+func completionRegion() string {
+	if r := ecspresso.FlagValueFromArgs(os.Args, "region"); r != "" {
+		return r
+	}
+	return os.Getenv("AWS_REGION")
+}
+
+func completeClusters() []string {
+	return ecspresso.NewCompleter(completionRegion()).Clusters()
+}
+
+func completeServices() []string {
+	return ecspresso.NewCompleter(completionRegion()).Services(ecspresso.FlagValueFromArgs(os.Args, "cluster"))
+}
+
+func completeTaskIDs() []string {
+	paths := ecspresso.FlagValuesFromArgs(os.Args, "config")
+	if len(paths) == 0 {
+		paths = []string{"ecspresso.yml"}
+	}
+	c := ecspresso.NewDefaultConfig()
+	c.Environment = ecspresso.FlagValueFromArgs(os.Args, "env")
+	defer c.Cleanup()
+	if err := c.Load(paths...); err != nil {
+		return nil
+	}
+	return ecspresso.NewCompleter(c.Region).TaskIDs(c.Cluster, c.Service)
+}
+
+// completeTaskDefinitions returns revisions of the task definition family in the config.
+// The config is loaded for validation, not to set up plugins only for rendering the family.
+func completeTaskDefinitions() []string {
+	paths := ecspresso.FlagValuesFromArgs(os.Args, "config")
+	if len(paths) == 0 {
+		paths = []string{"ecspresso.yml"}
+	}
+	c := ecspresso.NewDefaultConfig()
+	c.Environment = ecspresso.FlagValueFromArgs(os.Args, "env")
+	defer c.Cleanup()
+	c.LoadForValidation(paths...)
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		return nil
+	}
+	td, err := app.LoadTaskDefinition(c.TaskDefinitionPath)
+	if err != nil {
+		return nil
+	}
+	region := c.Region
+	if region == "" {
+		region = completionRegion()
+	}
+	return ecspresso.NewCompleter(region).TaskDefinitionRevisions(aws.StringValue(td.Family))
+}
+
 func boolp(b bool) *bool {
 	return &b
 }
@@ -310,3 +634,15 @@ func boolp(b bool) *bool {
 func int64p(i int64) *int64 {
 	return &i
 }
+
+func configFilesExist(paths []string) bool {
+	for _, p := range paths {
+		if strings.Contains(p, "://") {
+			continue
+		}
+		if _, err := os.Stat(p); err != nil {
+			return false
+		}
+	}
+	return len(paths) > 0
+}
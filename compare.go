@@ -0,0 +1,152 @@
+package ecspresso
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+)
+
+type CompareOption struct {
+	Configs  *[]string
+	Env      *string
+	Unified  *bool
+	ExitCode *bool
+}
+
+// compareLabel returns a label of the configuration to be shown in diffs.
+func compareLabel(c *Config, path string) string {
+	label := strings.Join(c.paths, ",")
+	if c.Environment != "" {
+		label = label + " env:" + c.Environment
+	}
+	return fmt.Sprintf("%s (%s)", path, label)
+}
+
+// Compare renders definitions of the current configuration and the other configuration (or environment),
+// and displays differences between them. Nothing is fetched from AWS.
+func (d *App) Compare(opt CompareOption) error {
+	d.setupLogger()
+	var paths []string
+	if opt.Configs != nil {
+		paths = *opt.Configs
+	}
+	env := aws.StringValue(opt.Env)
+	if len(paths) == 0 && env == "" {
+		return errors.New("--with-config or --with-env is required")
+	}
+	if len(paths) == 0 {
+		paths = d.config.paths
+	}
+	conf := NewDefaultConfig()
+	conf.Environment = env
+	if err := conf.Load(paths...); err != nil {
+		return errors.Wrapf(err, "failed to load config %s", strings.Join(paths, ","))
+	}
+	other, err := NewApp(conf)
+	if err != nil {
+		return err
+	}
+	defer other.Shutdown()
+	other.ExtStr = d.ExtStr
+	other.ExtCode = d.ExtCode
+
+	diffs, err := compareDefinitions(d, other, aws.BoolValue(opt.Unified))
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		d.Log("No differences between", strings.Join(d.config.paths, ","), "and", strings.Join(paths, ","))
+		return nil
+	}
+	for _, ds := range diffs {
+		fmt.Print(coloredDiff(ds))
+	}
+	if aws.BoolValue(opt.ExitCode) {
+		return withExitCode(ExitCodeDiffFound, errors.New("differences found"))
+	}
+	return nil
+}
+
+// compareDefinitions returns differences of the rendered definitions from base to target.
+func compareDefinitions(base, target *App, unified bool) ([]string, error) {
+	var diffs []string
+	bc, tc := base.config, target.config
+
+	if bc.ServiceDefinitionPath != "" || tc.ServiceDefinitionPath != "" {
+		bsv, err := loadServiceDefinitionOrEmpty(base)
+		if err != nil {
+			return nil, err
+		}
+		tsv, err := loadServiceDefinitionOrEmpty(target)
+		if err != nil {
+			return nil, err
+		}
+		ds, err := diffServices(tsv, bsv, compareLabel(bc, bc.ServiceDefinitionPath), compareLabel(tc, tc.ServiceDefinitionPath), unified)
+		if err != nil {
+			return nil, err
+		}
+		if ds != "" {
+			diffs = append(diffs, ds)
+		}
+	}
+
+	btd, err := base.LoadTaskDefinition(bc.TaskDefinitionPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load task definition %s", bc.TaskDefinitionPath)
+	}
+	ttd, err := target.LoadTaskDefinition(tc.TaskDefinitionPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load task definition %s", tc.TaskDefinitionPath)
+	}
+	// masks of both are comparable because they are masked by the same redactor
+	ds, err := diffTaskDefs(base.redactTaskDefinition(ttd), base.redactTaskDefinition(btd), compareLabel(bc, bc.TaskDefinitionPath), compareLabel(tc, tc.TaskDefinitionPath), unified)
+	if err != nil {
+		return nil, err
+	}
+	if ds != "" {
+		diffs = append(diffs, ds)
+	}
+
+	if bc.AutoScalingDefinitionPath != "" || tc.AutoScalingDefinitionPath != "" {
+		bas, err := loadAutoScalingDefinitionOrEmpty(base)
+		if err != nil {
+			return nil, err
+		}
+		tas, err := loadAutoScalingDefinitionOrEmpty(target)
+		if err != nil {
+			return nil, err
+		}
+		ds, err := diffAutoScalingDefinitions(tas, bas, compareLabel(bc, bc.AutoScalingDefinitionPath), compareLabel(tc, tc.AutoScalingDefinitionPath), unified)
+		if err != nil {
+			return nil, err
+		}
+		if ds != "" {
+			diffs = append(diffs, ds)
+		}
+	}
+	return diffs, nil
+}
+
+func loadServiceDefinitionOrEmpty(d *App) (*Service, error) {
+	if d.config.ServiceDefinitionPath == "" {
+		return &Service{}, nil
+	}
+	sv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load service definition %s", d.config.ServiceDefinitionPath)
+	}
+	return sv, nil
+}
+
+func loadAutoScalingDefinitionOrEmpty(d *App) (*AutoScalingDefinition, error) {
+	if d.config.AutoScalingDefinitionPath == "" {
+		return &AutoScalingDefinition{}, nil
+	}
+	def, err := d.LoadAutoScalingDefinition(d.config.AutoScalingDefinitionPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load autoscaling definition %s", d.config.AutoScalingDefinitionPath)
+	}
+	return def, nil
+}
@@ -0,0 +1,53 @@
+package ecspresso_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func newAppWithEnv(t *testing.T, env string) *ecspresso.App {
+	t.Helper()
+	conf := ecspresso.NewDefaultConfig()
+	conf.Environment = env
+	if err := conf.Load("tests/compare/ecspresso.yml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestCompareDefinitions(t *testing.T) {
+	stg := newAppWithEnv(t, "stg")
+	prod := newAppWithEnv(t, "prod")
+
+	diffs, err := ecspresso.CompareDefinitions(stg, stg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("same environments must have no diffs %v", diffs)
+	}
+
+	diffs, err = ecspresso.CompareDefinitions(stg, prod, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("unexpected diffs %v", diffs)
+	}
+	for _, s := range []string{`-  "desiredCount": 1,`, `+  "desiredCount": 3,`, "env:prod"} {
+		if !strings.Contains(diffs[0], s) {
+			t.Errorf("service diff must contain %s: %s", s, diffs[0])
+		}
+	}
+	for _, s := range []string{`-      "image": "nginx:v1.1.0",`, `+      "image": "nginx:v1.0.0",`} {
+		if !strings.Contains(diffs[1], s) {
+			t.Errorf("task definition diff must contain %s: %s", s, diffs[1])
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package ecspresso
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// Shells supported by the completion command.
+const (
+	CompletionShellBash = "bash"
+	CompletionShellZsh  = "zsh"
+	CompletionShellFish = "fish"
+)
+
+const (
+	completionCacheTTL = 5 * time.Minute
+	// tasks are replaced frequently
+	completionTaskCacheTTL = 10 * time.Second
+	completionTimeout      = 5 * time.Second
+)
+
+// Completion scripts call `ecspresso --completion-bash` provided by kingpin.
+var completionScripts = map[string]string{
+	CompletionShellBash: `_ecspresso_bash_autocomplete() {
+    local cur opts
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    opts=$( ${COMP_WORDS[0]} --completion-bash "${COMP_WORDS[@]:1:$COMP_CWORD}" )
+    COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+    return 0
+}
+complete -F _ecspresso_bash_autocomplete -o default ecspresso
+`,
+	CompletionShellZsh: `#compdef ecspresso
+
+_ecspresso() {
+    local matches=($(${words[1]} --completion-bash "${(@)words[2,$CURRENT]}"))
+    compadd -a matches
+
+    if [[ $compstate[nmatches] -eq 0 && $words[$CURRENT] != -* ]]; then
+        _files
+    fi
+}
+
+if [[ "$(basename -- ${(%):-%x})" != "_ecspresso" ]]; then
+    compdef _ecspresso ecspresso
+fi
+`,
+	CompletionShellFish: `function __ecspresso_complete
+    set -l args (commandline -opc) (commandline -ct)
+    set -e args[1]
+    ecspresso --completion-bash $args
+end
+complete -c ecspresso -f -a '(__ecspresso_complete)'
+`,
+}
+
+type CompletionOption struct {
+	Shell *string
+}
+
+// Completion prints the completion script for the shell.
+// It does not require the configuration file.
+func Completion(opt CompletionOption) error {
+	script, ok := completionScripts[*opt.Shell]
+	if !ok {
+		return errors.Errorf("unsupported shell: %s", *opt.Shell)
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// FlagValueFromArgs returns the last value of the flag in the command line arguments.
+// It is used to complete values depending on other flags while the arguments are not parsed yet.
+func FlagValueFromArgs(args []string, name string) string {
+	var value string
+	flag := "--" + name
+	for i, a := range args {
+		switch {
+		case a == flag && i+1 < len(args):
+			value = args[i+1]
+		case strings.HasPrefix(a, flag+"="):
+			value = strings.TrimPrefix(a, flag+"=")
+		}
+	}
+	return value
+}
+
+// FlagValuesFromArgs returns all values of the repeatable flag in the command line arguments.
+func FlagValuesFromArgs(args []string, name string) []string {
+	var values []string
+	flag := "--" + name
+	for i, a := range args {
+		switch {
+		case a == flag && i+1 < len(args):
+			values = append(values, args[i+1])
+		case strings.HasPrefix(a, flag+"="):
+			values = append(values, strings.TrimPrefix(a, flag+"="))
+		}
+	}
+	return values
+}
+
+// Completer completes values of flags by AWS APIs.
+// Results are cached in files to complete quickly.
+type Completer struct {
+	region   string
+	cacheDir string
+	ecs      *ecs.ECS
+}
+
+// NewCompleter creates a Completer for the region.
+func NewCompleter(region string) *Completer {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return &Completer{
+		region:   region,
+		cacheDir: filepath.Join(dir, "ecspresso", "completion"),
+	}
+}
+
+type completionCache struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Values    []string  `json:"values"`
+}
+
+func (c *Completer) cachePath(key string) string {
+	h := sha256.Sum256([]byte(c.region + "\n" + key))
+	return filepath.Join(c.cacheDir, fmt.Sprintf("%x.json", h[:8]))
+}
+
+func (c *Completer) readCache(key string, ttl time.Duration) ([]string, bool) {
+	b, err := ioutil.ReadFile(c.cachePath(key))
+	if err != nil {
+		return nil, false
+	}
+	var cache completionCache
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return nil, false
+	}
+	if time.Since(cache.FetchedAt) > ttl {
+		return nil, false
+	}
+	return cache.Values, true
+}
+
+func (c *Completer) writeCache(key string, values []string) {
+	b, err := json.Marshal(completionCache{FetchedAt: time.Now(), Values: values})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.cacheDir, 0700); err != nil {
+		return
+	}
+	ioutil.WriteFile(c.cachePath(key), b, 0600)
+}
+
+// cached returns the cached values or fetches them. Errors are ignored not to break the shell.
+func (c *Completer) cached(key string, ttl time.Duration, fetch func(ctx context.Context, svc *ecs.ECS) ([]string, error)) []string {
+	if values, ok := c.readCache(key, ttl); ok {
+		return values
+	}
+	if c.ecs == nil {
+		sess, err := newSession(c.region, nil)
+		if err != nil {
+			return nil
+		}
+		c.ecs = ecs.New(sess)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	values, err := fetch(ctx, c.ecs)
+	if err != nil {
+		return nil
+	}
+	c.writeCache(key, values)
+	return values
+}
+
+// Clusters returns names of the clusters.
+func (c *Completer) Clusters() []string {
+	return c.cached("clusters", completionCacheTTL, func(ctx context.Context, svc *ecs.ECS) ([]string, error) {
+		var names []string
+		err := svc.ListClustersPagesWithContext(ctx, &ecs.ListClustersInput{},
+			func(out *ecs.ListClustersOutput, _ bool) bool {
+				for _, a := range out.ClusterArns {
+					names = append(names, arnToName(aws.StringValue(a)))
+				}
+				return true
+			})
+		return names, err
+	})
+}
+
+// Services returns names of the services in the cluster.
+func (c *Completer) Services(cluster string) []string {
+	if cluster == "" {
+		cluster = DefaultClusterName
+	}
+	return c.cached("services/"+cluster, completionCacheTTL, func(ctx context.Context, svc *ecs.ECS) ([]string, error) {
+		var names []string
+		err := svc.ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{Cluster: aws.String(cluster)},
+			func(out *ecs.ListServicesOutput, _ bool) bool {
+				for _, a := range out.ServiceArns {
+					names = append(names, arnToName(aws.StringValue(a)))
+				}
+				return true
+			})
+		return names, err
+	})
+}
+
+// TaskIDs returns IDs of the running tasks of the service.
+func (c *Completer) TaskIDs(cluster, service string) []string {
+	if cluster == "" {
+		cluster = DefaultClusterName
+	}
+	return c.cached("tasks/"+cluster+"/"+service, completionTaskCacheTTL, func(ctx context.Context, svc *ecs.ECS) ([]string, error) {
+		var ids []string
+		in := &ecs.ListTasksInput{Cluster: aws.String(cluster)}
+		if service != "" {
+			in.ServiceName = aws.String(service)
+		}
+		err := svc.ListTasksPagesWithContext(ctx, in, func(out *ecs.ListTasksOutput, _ bool) bool {
+			for _, a := range out.TaskArns {
+				ids = append(ids, arnToName(aws.StringValue(a)))
+			}
+			return true
+		})
+		return ids, err
+	})
+}
+
+// TaskDefinitionRevisions returns revision numbers of the task definition family, newest first.
+func (c *Completer) TaskDefinitionRevisions(family string) []string {
+	if family == "" {
+		return nil
+	}
+	return c.cached("task-definitions/"+family, completionCacheTTL, func(ctx context.Context, svc *ecs.ECS) ([]string, error) {
+		var revisions []string
+		in := &ecs.ListTaskDefinitionsInput{
+			FamilyPrefix: aws.String(family),
+			Sort:         aws.String(ecs.SortOrderDesc),
+		}
+		err := svc.ListTaskDefinitionsPagesWithContext(ctx, in, func(out *ecs.ListTaskDefinitionsOutput, _ bool) bool {
+			revisions = append(revisions, revisionsOfFamily(family, out.TaskDefinitionArns)...)
+			return true
+		})
+		return revisions, err
+	})
+}
+
+// revisionsOfFamily returns revision numbers of the task definitions of the family.
+// ListTaskDefinitions also returns other families which have the family as the prefix.
+func revisionsOfFamily(family string, arns []*string) []string {
+	var revisions []string
+	for _, a := range arns {
+		p := strings.SplitN(arnToName(aws.StringValue(a)), ":", 2)
+		if len(p) == 2 && p[0] == family {
+			revisions = append(revisions, p[1])
+		}
+	}
+	return revisions
+}
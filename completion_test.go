@@ -0,0 +1,73 @@
+package ecspresso_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/kayac/ecspresso"
+)
+
+func TestFlagValueFromArgs(t *testing.T) {
+	args := []string{"ecspresso", "--completion-bash", "init", "--region=us-east-1", "--cluster", "prod", "--config", "a.yml", "--config=b.yml", "--service"}
+	if v := ecspresso.FlagValueFromArgs(args, "region"); v != "us-east-1" {
+		t.Errorf("unexpected region %s", v)
+	}
+	if v := ecspresso.FlagValueFromArgs(args, "cluster"); v != "prod" {
+		t.Errorf("unexpected cluster %s", v)
+	}
+	if v := ecspresso.FlagValueFromArgs(args, "service"); v != "" {
+		t.Errorf("flag without value must be empty %s", v)
+	}
+	if vs := ecspresso.FlagValuesFromArgs(args, "config"); !reflect.DeepEqual(vs, []string{"a.yml", "b.yml"}) {
+		t.Errorf("unexpected configs %v", vs)
+	}
+}
+
+func TestCompleterCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecspresso-completion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := ecspresso.NewCompleterWithCacheDir("ap-northeast-1", dir)
+	ecspresso.CompleterWriteCache(c, "clusters", []string{"default", "prod"})
+	values, ok := ecspresso.CompleterReadCache(c, "clusters", time.Minute)
+	if !ok || !reflect.DeepEqual(values, []string{"default", "prod"}) {
+		t.Errorf("unexpected cached values %v %v", values, ok)
+	}
+	if _, ok := ecspresso.CompleterReadCache(c, "clusters", 0); ok {
+		t.Error("expired cache must not be used")
+	}
+
+	other := ecspresso.NewCompleterWithCacheDir("us-east-1", dir)
+	if _, ok := ecspresso.CompleterReadCache(other, "clusters", time.Minute); ok {
+		t.Error("cache must be separated by the region")
+	}
+}
+
+func TestTaskDefinitionRevisions(t *testing.T) {
+	arns := []*string{
+		aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/katsubushi:3"),
+		aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/katsubushi-worker:5"),
+		aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/katsubushi:2"),
+	}
+	if revs := ecspresso.RevisionsOfFamily("katsubushi", arns); !reflect.DeepEqual(revs, []string{"3", "2"}) {
+		t.Errorf("unexpected revisions %v", revs)
+	}
+
+	dir, err := ioutil.TempDir("", "ecspresso-completion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := ecspresso.NewCompleterWithCacheDir("ap-northeast-1", dir)
+	ecspresso.CompleterWriteCache(c, "task-definitions/katsubushi", []string{"3", "2"})
+	if revs := c.TaskDefinitionRevisions("katsubushi"); !reflect.DeepEqual(revs, []string{"3", "2"}) {
+		t.Errorf("revisions must be cached %v", revs)
+	}
+}
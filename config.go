@@ -1,13 +1,14 @@
 package ecspresso
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"text/template"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/fatih/color"
 	gv "github.com/hashicorp/go-version"
@@ -23,46 +24,158 @@ const (
 
 // Config represents a configuration.
 type Config struct {
-	RequiredVersion       string           `yaml:"required_version,omitempty"`
-	Region                string           `yaml:"region"`
-	Cluster               string           `yaml:"cluster"`
-	Service               string           `yaml:"service"`
-	ServiceDefinitionPath string           `yaml:"service_definition"`
-	TaskDefinitionPath    string           `yaml:"task_definition"`
-	Timeout               time.Duration    `yaml:"timeout"`
-	Plugins               []ConfigPlugin   `yaml:"plugins,omitempty"`
-	AppSpec               *appspec.AppSpec `yaml:"appspec,omitempty"`
-	FilterCommand         string           `yaml:"filter_command,omitempty"`
+	RequiredVersion           string                        `yaml:"required_version,omitempty"`
+	Region                    string                        `yaml:"region"`
+	Cluster                   string                        `yaml:"cluster"`
+	Service                   string                        `yaml:"service"`
+	ServiceDefinitionPath     string                        `yaml:"service_definition"`
+	TaskDefinitionPath        string                        `yaml:"task_definition"`
+	TaskDefinitionFragments   []string                      `yaml:"task_definition_fragments,omitempty"`
+	NameSuffix                string                        `yaml:"name_suffix,omitempty"`
+	AutoScalingDefinitionPath string                        `yaml:"autoscaling_definition,omitempty"`
+	Timeout                   time.Duration                 `yaml:"timeout"`
+	Plugins                   []ConfigPlugin                `yaml:"plugins,omitempty"`
+	AppSpec                   *appspec.AppSpec              `yaml:"appspec,omitempty"`
+	FilterCommand             string                        `yaml:"filter_command,omitempty"`
+	ServiceDiscovery          []ServiceDiscoveryConfig      `yaml:"service_discovery,omitempty"`
+	Notifications             *NotificationConfig           `yaml:"notifications,omitempty"`
+	Audit                     *AuditConfig                  `yaml:"audit,omitempty"`
+	Lock                      *LockConfig                   `yaml:"lock,omitempty"`
+	State                     *StateConfig                  `yaml:"state,omitempty"`
+	Artifacts                 *ArtifactsConfig              `yaml:"artifacts,omitempty"`
+	ScaleDownProtection       *ScaleDownProtectionConfig    `yaml:"scale_down_protection,omitempty"`
+	Cost                      *CostConfig                   `yaml:"cost,omitempty"`
+	ImageTagPolicy            *ImageTagPolicyConfig         `yaml:"image_tag_policy,omitempty"`
+	Redaction                 *RedactionConfig              `yaml:"redaction,omitempty"`
+	Wait                      *WaitConfig                   `yaml:"wait,omitempty"`
+	Timeouts                  *TimeoutsConfig               `yaml:"timeouts,omitempty"`
+	TestTrafficValidation     *TestTrafficValidationConfig  `yaml:"test_traffic_validation,omitempty"`
+	LogCheck                  *LogCheckConfig               `yaml:"log_check,omitempty"`
+	DeletionProtection        bool                          `yaml:"deletion_protection,omitempty"`
+	Interactive               bool                          `yaml:"interactive,omitempty"`
+	Tags                      map[string]string             `yaml:"tags,omitempty"`
+	RegistryMirrors           map[string][]string           `yaml:"registry_mirrors,omitempty"`
+	AWS                       *AWSConfig                    `yaml:"aws,omitempty"`
+	Vars                      map[string]string             `yaml:"vars,omitempty"`
+	Environments              map[string]*EnvironmentConfig `yaml:"environments,omitempty"`
+
+	// Environment is the name of the environment selected from Environments.
+	Environment string `yaml:"-"`
+
+	// TFStateCacheTTL is the TTL of the cache of values looked up by the tfstate plugin.
+	// The cache is disabled when zero.
+	TFStateCacheTTL time.Duration `yaml:"-"`
+
+	// RegionOverride, ClusterOverride and ServiceOverride take precedence over
+	// the configuration files and the environment for the invocation.
+	RegionOverride  string `yaml:"-"`
+	ClusterOverride string `yaml:"-"`
+	ServiceOverride string `yaml:"-"`
+
+	// AssumeRoleArn overrides aws.assume_role_arn for the invocation.
+	AssumeRoleArn string `yaml:"-"`
+
+	// ReadOnly blocks AWS API calls which may change resources.
+	ReadOnly bool `yaml:"-"`
 
 	templateFuncs      []template.FuncMap
 	dir                string
+	paths              []string
+	overlayDir         string
+	remoteDir          string
 	versionConstraints gv.Constraints
 	sess               *session.Session
+	sourceCredentials  *credentials.Credentials
+
+	// validation is set by LoadForValidation, and validationProblems are problems found in loading.
+	validation         bool
+	validationProblems []string
 }
 
-// Load loads configuration file from file path.
-func (c *Config) Load(path string) error {
-	if err := gc.LoadWithEnv(c, path); err != nil {
+// Load loads configuration files from file paths.
+// Multiple files are deep merged in order, and relative paths in the configuration are
+// resolved from the directory of the last file.
+func (c *Config) Load(paths ...string) error {
+	if len(paths) > 0 {
+		var err error
+		if paths, err = c.fetchRemoteConfigs(context.Background(), paths); err != nil {
+			return err
+		}
+	}
+	switch len(paths) {
+	case 0:
+		return errors.New("no config file")
+	case 1:
+		if err := gc.LoadWithEnv(c, paths[0]); err != nil {
+			return err
+		}
+	default:
+		if err := loadMergedConfig(c, paths); err != nil {
+			return err
+		}
+	}
+	c.dir = filepath.Dir(paths[len(paths)-1])
+	c.paths = paths
+	if err := c.applyEnvironment(); err != nil {
 		return err
 	}
-	c.dir = filepath.Dir(path)
+	c.applyOverrides()
 	return c.Restrict()
 }
 
 // Restrict restricts a configuration.
 func (c *Config) Restrict() error {
+	if err := c.restrict(); err != nil {
+		return err
+	}
+	var err error
+	c.sess, c.sourceCredentials, err = newSessionWithSource(c.Region, c.AWS)
+	if err != nil {
+		return err
+	}
+	if c.ReadOnly {
+		setupReadOnly(c.sess)
+	}
+	return nil
+}
+
+// restrict restricts a configuration without creating the AWS session.
+func (c *Config) restrict() error {
 	if c.Cluster == "" {
 		c.Cluster = DefaultClusterName
 	}
 	if c.dir == "" {
 		c.dir = "."
 	}
+	// the service specified by --service is used as it is
+	if c.NameSuffix != "" && c.Service != "" && c.ServiceOverride == "" {
+		c.Service = withNameSuffix(c.Service, c.NameSuffix)
+	}
 	if c.ServiceDefinitionPath != "" && !filepath.IsAbs(c.ServiceDefinitionPath) {
 		c.ServiceDefinitionPath = filepath.Join(c.dir, c.ServiceDefinitionPath)
 	}
 	if c.TaskDefinitionPath != "" && !filepath.IsAbs(c.TaskDefinitionPath) {
 		c.TaskDefinitionPath = filepath.Join(c.dir, c.TaskDefinitionPath)
 	}
+	for i, p := range c.TaskDefinitionFragments {
+		if !filepath.IsAbs(p) {
+			c.TaskDefinitionFragments[i] = filepath.Join(c.dir, p)
+		}
+	}
+	if c.overlayDir != "" && !filepath.IsAbs(c.overlayDir) {
+		c.overlayDir = filepath.Join(c.dir, c.overlayDir)
+	}
+	if c.AutoScalingDefinitionPath != "" && !filepath.IsAbs(c.AutoScalingDefinitionPath) {
+		c.AutoScalingDefinitionPath = filepath.Join(c.dir, c.AutoScalingDefinitionPath)
+	}
+	if c.Artifacts != nil {
+		if err := c.Artifacts.validate(); err != nil {
+			return err
+		}
+		if c.Artifacts.Dir != "" && !filepath.IsAbs(c.Artifacts.Dir) {
+			c.Artifacts.Dir = filepath.Join(c.dir, c.Artifacts.Dir)
+		}
+	}
 	if c.RequiredVersion != "" {
 		constraints, err := gv.NewConstraint(c.RequiredVersion)
 		if err != nil {
@@ -70,12 +183,48 @@ func (c *Config) Restrict() error {
 		}
 		c.versionConstraints = constraints
 	}
-	var err error
-	c.sess, err = session.NewSessionWithOptions(session.Options{
-		Config:            aws.Config{Region: aws.String(c.Region)},
-		SharedConfigState: session.SharedConfigEnable,
-	})
-	return err
+	if c.AssumeRoleArn != "" {
+		c.AWS = c.AWS.withAssumeRole(c.AssumeRoleArn)
+	}
+	if c.AWS != nil {
+		if err := c.AWS.validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.validateRegistryMirrors(); err != nil {
+		return err
+	}
+	if c.ImageTagPolicy != nil {
+		if err := c.ImageTagPolicy.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Redaction != nil {
+		if err := c.Redaction.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Wait != nil {
+		if err := c.Wait.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Timeouts != nil {
+		if err := c.Timeouts.validate(); err != nil {
+			return err
+		}
+	}
+	if c.TestTrafficValidation != nil {
+		if err := c.TestTrafficValidation.validate(); err != nil {
+			return err
+		}
+	}
+	if c.LogCheck != nil {
+		if err := c.LogCheck.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *Config) setupPlugins() error {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/kayac/ecspresso"
@@ -219,3 +220,170 @@ func TestConfigWithInvalidRequiredVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestRestrictConfigWithAWS(t *testing.T) {
+	cases := []struct {
+		name  string
+		aws   *ecspresso.AWSConfig
+		isErr bool
+	}{
+		{
+			name: "assume role",
+			aws: &ecspresso.AWSConfig{
+				AssumeRoleArn: "arn:aws:iam::123456789012:role/deploy",
+				ExternalID:    "external-id",
+				Duration:      time.Hour,
+				MFASerial:     "arn:aws:iam::123456789012:mfa/alice",
+			},
+		},
+		{
+			name:  "without assume_role_arn",
+			aws:   &ecspresso.AWSConfig{ExternalID: "external-id"},
+			isErr: true,
+		},
+		{
+			name: "too short duration",
+			aws: &ecspresso.AWSConfig{
+				AssumeRoleArn: "arn:aws:iam::123456789012:role/deploy",
+				Duration:      time.Minute,
+			},
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf := ecspresso.NewDefaultConfig()
+			conf.Region = "ap-northeast-1"
+			conf.AWS = c.aws
+			err := conf.Restrict()
+			if c.isErr && err == nil {
+				t.Error("must be error")
+			} else if !c.isErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigWithEnvironment(t *testing.T) {
+	testCases := []struct {
+		env      string
+		region   string
+		cluster  string
+		service  string
+		imageTag string
+		logLevel string
+	}{
+		{"", "ap-northeast-1", "default", "test", "latest", "debug"},
+		{"stg", "ap-northeast-1", "stg", "test", "stg", "debug"},
+		{"prod", "us-east-1", "prod", "test-prod", "v1.0.0", "info"},
+	}
+	for _, tc := range testCases {
+		c := &ecspresso.Config{Environment: tc.env}
+		if err := c.Load("tests/environments.yml"); err != nil {
+			t.Errorf("failed to load config with environment %s: %s", tc.env, err)
+			continue
+		}
+		if c.Region != tc.region || c.Cluster != tc.cluster || c.Service != tc.service {
+			t.Errorf("unexpected config for environment %s: %s %s %s", tc.env, c.Region, c.Cluster, c.Service)
+		}
+		if c.Vars["image_tag"] != tc.imageTag || c.Vars["log_level"] != tc.logLevel {
+			t.Errorf("unexpected vars for environment %s: %v", tc.env, c.Vars)
+		}
+	}
+
+	c := &ecspresso.Config{Environment: "dev"}
+	if err := c.Load("tests/environments.yml"); err == nil {
+		t.Error("undefined environment must be an error")
+	}
+}
+
+func TestLoadConfigWithOverrides(t *testing.T) {
+	c := &ecspresso.Config{
+		Environment:     "prod",
+		RegionOverride:  "us-west-2",
+		ClusterOverride: "scratch",
+	}
+	if err := c.Load("tests/environments.yml"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Region != "us-west-2" || c.Cluster != "scratch" || c.Service != "test-prod" {
+		t.Errorf("unexpected config with overrides: %s %s %s", c.Region, c.Cluster, c.Service)
+	}
+	if r := aws.StringValue(c.Session().Config.Region); r != "us-west-2" {
+		t.Errorf("the session must be for the overridden region: %s", r)
+	}
+
+	c = &ecspresso.Config{ServiceOverride: "other"}
+	if err := c.Load("tests/environments.yml"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Region != "ap-northeast-1" || c.Cluster != "default" || c.Service != "other" {
+		t.Errorf("unexpected config with overrides: %s %s %s", c.Region, c.Cluster, c.Service)
+	}
+}
+
+func TestLoadMergedConfig(t *testing.T) {
+	c := &ecspresso.Config{}
+	if err := c.Load("tests/merge/base.yml", "tests/merge/service.yml"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Region != "ap-northeast-1" || c.Cluster != "production" || c.Service != "test" {
+		t.Errorf("unexpected config %s %s %s", c.Region, c.Cluster, c.Service)
+	}
+	if c.Timeout != 10*time.Minute {
+		t.Errorf("unexpected timeout %s", c.Timeout)
+	}
+	if len(c.Plugins) != 1 || c.Plugins[0].Name != "tfstate" {
+		t.Errorf("unexpected plugins %#v", c.Plugins)
+	}
+	if c.TaskDefinitionPath != "tests/td.json" || c.ServiceDefinitionPath != "tests/sv.json" {
+		t.Errorf("unexpected definition paths %s %s", c.TaskDefinitionPath, c.ServiceDefinitionPath)
+	}
+	slack := c.Notifications.Slack
+	if slack.WebhookURL != "https://hooks.slack.com/services/XXX" || slack.Channel != "#test-deploy" {
+		t.Errorf("nested values must be deep merged %#v", slack)
+	}
+}
+
+func TestConfigNameSuffix(t *testing.T) {
+	for env, suffix := range map[string]string{"staging": "-staging", "production": ""} {
+		c := ecspresso.NewDefaultConfig()
+		c.Environment = env
+		if err := c.Load("tests/name-suffix/ecspresso.yml"); err != nil {
+			t.Fatal(err)
+		}
+		if c.Service != "app"+suffix {
+			t.Errorf("unexpected service name in %s: %s", env, c.Service)
+		}
+		app, err := ecspresso.NewApp(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		td, err := app.LoadTaskDefinition(c.TaskDefinitionPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if family := aws.StringValue(td.Family); family != "app"+suffix {
+			t.Errorf("unexpected family in %s: %s", env, family)
+		}
+		if group := aws.StringValue(td.ContainerDefinitions[0].LogConfiguration.Options["awslogs-group"]); group != "/ecs/app"+suffix {
+			t.Errorf("unexpected log group in %s: %s", env, group)
+		}
+	}
+}
+
+func TestConfigNameSuffixWithServiceOverride(t *testing.T) {
+	c := ecspresso.NewDefaultConfig()
+	c.Environment = "staging"
+	c.ServiceOverride = "app-preview"
+	if err := c.Load("tests/name-suffix/ecspresso.yml"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Service != "app-preview" {
+		t.Errorf("the name suffix must not be appended to the overridden service: %s", c.Service)
+	}
+	if c.NameSuffix != "-staging" {
+		t.Errorf("unexpected name suffix %s", c.NameSuffix)
+	}
+}
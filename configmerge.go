@@ -0,0 +1,52 @@
+package ecspresso
+
+import (
+	gc "github.com/kayac/go-config"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// loadMergedConfig loads configuration files and deep merges them in order.
+// Mappings are merged recursively, and the other values (including sequences) are replaced by the later file.
+func loadMergedConfig(c *Config, paths []string) error {
+	var merged interface{}
+	for _, path := range paths {
+		b, err := gc.ReadWithEnv(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+		var v interface{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return errors.Wrapf(err, "failed to parse %s", path)
+		}
+		merged = mergeConfigValues(merged, v)
+	}
+	b, err := yaml.Marshal(merged)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal merged config")
+	}
+	return yaml.Unmarshal(b, c)
+}
+
+func mergeConfigValues(base, override interface{}) interface{} {
+	bm, ok := base.(map[interface{}]interface{})
+	if !ok {
+		return override
+	}
+	om, ok := override.(map[interface{}]interface{})
+	if !ok {
+		if override == nil {
+			// empty file
+			return base
+		}
+		return override
+	}
+	merged := make(map[interface{}]interface{}, len(bm)+len(om))
+	for k, v := range bm {
+		merged[k] = v
+	}
+	for k, v := range om {
+		merged[k] = mergeConfigValues(bm[k], v)
+	}
+	return merged
+}
@@ -0,0 +1,132 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Songmu/prompter"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+)
+
+const confirmationAnswer = "yes"
+
+// promptConfirmation reads the typed answer to the confirmation. It is replaced in tests.
+var promptConfirmation = func(message string) string {
+	return prompter.Prompt(message, "")
+}
+
+// stdinIsTerminal reports whether the standard input is a terminal. It is replaced in tests.
+var stdinIsTerminal = func() bool {
+	return isatty.IsTerminal(os.Stdin.Fd())
+}
+
+// changePlan represents a concise plan of changes made by the command.
+type changePlan struct {
+	command string
+	changes []string
+}
+
+func newChangePlan(command string) *changePlan {
+	return &changePlan{command: command}
+}
+
+func (p *changePlan) add(format string, args ...interface{}) {
+	p.changes = append(p.changes, fmt.Sprintf(format, args...))
+}
+
+// addDiffSummary adds the number of changed lines of each diff.
+func (p *changePlan) addDiffSummary(diffs []string) {
+	for _, ds := range diffs {
+		name, added, removed := diffStat(ds)
+		p.add("%s: +%d -%d lines", name, added, removed)
+	}
+}
+
+// diffStat returns the name and counts of added and removed lines of the diff.
+func diffStat(ds string) (name string, added, removed int) {
+	for _, line := range strings.Split(ds, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			name = strings.TrimPrefix(line, "+++ ")
+		case strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return name, added, removed
+}
+
+func (d *App) deployPlan(ctx context.Context, opt DeployOption) (*changePlan, error) {
+	p := newChangePlan(opt.commandName())
+	switch {
+	case aws.BoolValue(opt.LatestTaskDefinition):
+		p.add("deploy the latest revision of the task definition")
+	case aws.BoolValue(opt.SkipTaskDefinition):
+		p.add("keep the current task definition")
+	default:
+		p.add("register a new revision of the task definition by %s", d.config.TaskDefinitionPath)
+	}
+	updateService := aws.BoolValue(opt.UpdateService) && d.config.ServiceDefinitionPath != ""
+	if updateService {
+		p.add("update attributes of the service by %s", d.config.ServiceDefinitionPath)
+	}
+	if opt.DesiredCount != nil && *opt.DesiredCount != DefaultDesiredCount {
+		p.add("change the desired count to %d", *opt.DesiredCount)
+	}
+	if aws.BoolValue(opt.ForceNewDeployment) {
+		p.add("force a new deployment")
+	}
+	if updateService && aws.BoolValue(opt.RecreateService) {
+		p.add("recreate the service when load balancers can not be updated")
+	}
+	if updateService {
+		for _, o := range applyServiceOverrides(&Service{}, opt) {
+			p.add("override %s to %d for this deploy", o.name, o.to)
+		}
+	}
+	if updateService || !aws.BoolValue(opt.SkipTaskDefinition) && !aws.BoolValue(opt.LatestTaskDefinition) {
+		diffs, err := d.diffs(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(diffs) == 0 {
+			p.add("no differences in the definitions")
+		}
+		p.addDiffSummary(diffs)
+	}
+	return p, nil
+}
+
+// confirmPlan shows the plan and requires the typed confirmation in the interactive mode.
+func (d *App) confirmPlan(p *changePlan) error {
+	if !d.config.Interactive {
+		return nil
+	}
+	if err := d.showPlan(p); err != nil {
+		return err
+	}
+	answer := promptConfirmation(fmt.Sprintf("Do you want to %s? Only %q will be accepted to approve", p.command, confirmationAnswer))
+	if strings.TrimSpace(answer) != confirmationAnswer {
+		d.Log("Aborted")
+		return errConfirmationFailed
+	}
+	return nil
+}
+
+// showPlan prints the changes of the plan in the interactive mode.
+func (d *App) showPlan(p *changePlan) error {
+	if !stdinIsTerminal() {
+		return withExitCode(ExitCodeAborted, errors.New("the interactive mode requires a terminal. use --no-interactive to run without confirmation"))
+	}
+	fmt.Printf("ecspresso will %s %s/%s:\n", p.command, d.Cluster, d.Service)
+	for _, c := range p.changes {
+		fmt.Println(spcIndent + c)
+	}
+	return nil
+}
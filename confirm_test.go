@@ -0,0 +1,74 @@
+package ecspresso_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestDiffStat(t *testing.T) {
+	ds := "--- arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1\n" +
+		"+++ tests/td.json\n" +
+		"@@ -1,3 +1,3 @@\n" +
+		" {\n" +
+		"-  \"cpu\": \"256\",\n" +
+		"+  \"cpu\": \"512\",\n" +
+		"+  \"memory\": \"1024\",\n" +
+		" }\n"
+	name, added, removed := ecspresso.DiffStat(ds)
+	if name != "tests/td.json" || added != 2 || removed != 1 {
+		t.Errorf("unexpected stat %s +%d -%d", name, added, removed)
+	}
+}
+
+func TestDeployInteractive(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	for _, answer := range []string{"no", "yes"} {
+		t.Run(answer, func(t *testing.T) {
+			defer ecspresso.SetConfirmation(answer)()
+			conf := ecspresso.NewDefaultConfig()
+			if err := conf.Load("tests/test.yaml"); err != nil {
+				t.Fatal(err)
+			}
+			conf.Timeout = time.Minute
+			conf.Interactive = true
+			fake := &fakeSummaryECS{fakeECS{
+				service: &ecs.Service{
+					ServiceName:    aws.String("test"),
+					ServiceArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:service/default2/test"),
+					ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+					TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+					DesiredCount:   aws.Int64(1),
+				},
+			}}
+			app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+				ECS:                    fake,
+				ApplicationAutoScaling: &fakeAutoScaling{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.DeployWithContext(context.Background(), ecspresso.DeployOption{UpdateService: aws.Bool(false)})
+			if answer == "yes" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fake.registered == nil {
+					t.Error("task definition must be registered after confirmed")
+				}
+				return
+			}
+			if code := ecspresso.ExitCodeOf(err); code != ecspresso.ExitCodeAborted {
+				t.Errorf("expected aborted, got %d: %v", code, err)
+			}
+			if fake.registered != nil || fake.updated != nil {
+				t.Error("nothing must be changed without confirmation")
+			}
+		})
+	}
+}
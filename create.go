@@ -34,12 +34,15 @@ func (d *App) Create(opt CreateOption) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to load service definition")
 	}
+	if err := d.resolveServiceRegistries(ctx, &svd.Service, *opt.DryRun); err != nil {
+		return errors.Wrap(err, "failed to resolve service registries")
+	}
 	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
 	if err != nil {
 		return errors.Wrap(err, "failed to load task definition")
 	}
 
-	count := calcDesiredCount(svd, opt)
+	count := calcDesiredCount(&svd.Service, opt)
 	if count == nil && (svd.SchedulingStrategy != nil && *svd.SchedulingStrategy == "REPLICA") {
 		count = aws.Int64(0) // Must provide desired count for replica scheduling strategy
 	}
@@ -57,8 +60,29 @@ func (d *App) Create(opt CreateOption) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to register task definition")
 	}
-	createServiceInput := &ecs.CreateServiceInput{
-		Cluster:                       aws.String(d.config.Cluster),
+	createServiceInput := newCreateServiceInput(d.config.Cluster, svd, *newTd.TaskDefinitionArn, count)
+	if _, err := d.ecs.CreateServiceWithContext(ctx, createServiceInput); err != nil {
+		return errors.Wrap(err, "failed to create service")
+	}
+	d.Log("Service is created")
+
+	if *opt.NoWait {
+		return nil
+	}
+
+	start := time.Now()
+	time.Sleep(delayForServiceChanged) // wait for service created
+	if err := d.WaitServiceStable(ctx, start); err != nil {
+		return errors.Wrap(err, "failed to wait service stable")
+	}
+
+	d.Log("Service is stable now. Completed!")
+	return nil
+}
+
+func newCreateServiceInput(cluster string, svd *Service, tdArn string, count *int64) *ecs.CreateServiceInput {
+	return &ecs.CreateServiceInput{
+		Cluster:                       aws.String(cluster),
 		CapacityProviderStrategy:      svd.CapacityProviderStrategy,
 		DeploymentConfiguration:       svd.DeploymentConfiguration,
 		DeploymentController:          svd.DeploymentController,
@@ -74,26 +98,11 @@ func (d *App) Create(opt CreateOption) error {
 		PlatformVersion:               svd.PlatformVersion,
 		PropagateTags:                 svd.PropagateTags,
 		SchedulingStrategy:            svd.SchedulingStrategy,
+		ServiceConnectConfiguration:   svd.ServiceConnectConfiguration,
 		ServiceName:                   svd.ServiceName,
 		ServiceRegistries:             svd.ServiceRegistries,
 		Tags:                          svd.Tags,
-		TaskDefinition:                newTd.TaskDefinitionArn,
-	}
-	if _, err := d.ecs.CreateServiceWithContext(ctx, createServiceInput); err != nil {
-		return errors.Wrap(err, "failed to create service")
-	}
-	d.Log("Service is created")
-
-	if *opt.NoWait {
-		return nil
+		TaskDefinition:                aws.String(tdArn),
+		VolumeConfigurations:          svd.VolumeConfigurations,
 	}
-
-	start := time.Now()
-	time.Sleep(delayForServiceChanged) // wait for service created
-	if err := d.WaitServiceStable(ctx, start); err != nil {
-		return errors.Wrap(err, "failed to wait service stable")
-	}
-
-	d.Log("Service is stable now. Completed!")
-	return nil
 }
@@ -0,0 +1,97 @@
+package ecspresso
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+)
+
+// Modes of the check of the credentials expiry.
+const (
+	CredentialsExpiryWarn   = "warn"
+	CredentialsExpiryError  = "error"
+	CredentialsExpiryIgnore = "ignore"
+)
+
+// assumeRoleExpiryWindow makes assumed credentials refreshed before they expire in long deployments.
+const assumeRoleExpiryWindow = time.Minute
+
+// credentialsExpirationEnvs are environment variables of the expiration of temporary credentials set by
+// credential helpers (e.g. aws-vault, granted).
+var credentialsExpirationEnvs = []string{"AWS_CREDENTIAL_EXPIRATION", "AWS_SESSION_EXPIRATION"}
+
+// fixedCredentialsProviders are providers which can not refresh credentials by themselves.
+var fixedCredentialsProviders = []string{
+	session.EnvProviderName,
+	credentials.EnvProviderName,
+	credentials.StaticProviderName,
+	credentials.SharedCredsProviderName,
+	"SharedConfigCredentials",
+}
+
+// credentialsExpiration returns the expiration of the credentials which can not be refreshed.
+// It returns false when the credentials are refreshed automatically or the expiration is unknown.
+func credentialsExpiration(v credentials.Value, getenv func(string) string) (time.Time, bool) {
+	if v.SessionToken == "" {
+		return time.Time{}, false
+	}
+	var fixed bool
+	for _, name := range fixedCredentialsProviders {
+		if strings.HasPrefix(v.ProviderName, name) {
+			fixed = true
+			break
+		}
+	}
+	if !fixed {
+		return time.Time{}, false
+	}
+	for _, name := range credentialsExpirationEnvs {
+		if s := getenv(name); s != "" {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// checkCredentialsExpiry checks the credentials live longer than the timeout of the command.
+// Credentials of the assumed role are refreshed by the source credentials, so the source credentials are checked.
+func (d *App) checkCredentialsExpiry(command string) error {
+	mode := CredentialsExpiryWarn
+	if c := d.config.AWS; c != nil && c.CredentialsExpiry != "" {
+		mode = c.CredentialsExpiry
+	}
+	if mode == CredentialsExpiryIgnore || d.config.Timeout <= 0 || d.config.sourceCredentials == nil {
+		return nil
+	}
+	v, err := d.config.sourceCredentials.Get()
+	if err != nil {
+		// API calls of the command report the error
+		d.DebugLog("unable to get credentials to check the expiry", err)
+		return nil
+	}
+	expiresAt, ok := credentialsExpiration(v, os.Getenv)
+	if !ok {
+		d.DebugLog("expiration of the credentials is unknown or refreshed automatically", v.ProviderName)
+		return nil
+	}
+	remaining := time.Until(expiresAt)
+	if remaining >= d.config.Timeout {
+		return nil
+	}
+	msg := fmt.Sprintf(
+		"the credentials expire in %s at %s, before the timeout %s of %s. renew the credentials or use aws.assume_role_arn with refreshable credentials",
+		remaining.Round(time.Second), expiresAt.Local().Format(time.RFC3339), d.config.Timeout, command,
+	)
+	if mode == CredentialsExpiryError {
+		return errors.New(msg)
+	}
+	d.Log("WARNING: " + msg)
+	return nil
+}
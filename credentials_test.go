@@ -0,0 +1,100 @@
+package ecspresso_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/kayac/ecspresso"
+)
+
+func TestCredentialsExpiration(t *testing.T) {
+	expiresAt := "2023-04-01T12:00:00Z"
+	env := func(name string) string {
+		if name == "AWS_SESSION_EXPIRATION" {
+			return expiresAt
+		}
+		return ""
+	}
+	testCases := []struct {
+		name  string
+		value credentials.Value
+		ok    bool
+	}{
+		{
+			name:  "temporary credentials in env",
+			value: credentials.Value{SessionToken: "token", ProviderName: credentials.EnvProviderName},
+			ok:    true,
+		},
+		{
+			name:  "temporary credentials in shared credentials file",
+			value: credentials.Value{SessionToken: "token", ProviderName: "SharedConfigCredentials: /root/.aws/credentials"},
+			ok:    true,
+		},
+		{
+			name:  "long-term credentials",
+			value: credentials.Value{ProviderName: credentials.EnvProviderName},
+		},
+		{
+			name:  "refreshed by the provider",
+			value: credentials.Value{SessionToken: "token", ProviderName: "EC2RoleProvider"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			at, ok := ecspresso.CredentialsExpiration(tc.value, env)
+			if ok != tc.ok {
+				t.Fatalf("unexpected ok %v", ok)
+			}
+			if ok && at.Format(time.RFC3339) != expiresAt {
+				t.Errorf("unexpected expiration %s", at)
+			}
+		})
+	}
+}
+
+func TestCheckCredentialsExpiry(t *testing.T) {
+	envs := map[string]string{
+		"AWS_ACCESS_KEY_ID":         "AKIAEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":     "secret",
+		"AWS_SESSION_TOKEN":         "token",
+		"AWS_CREDENTIAL_EXPIRATION": time.Now().Add(5 * time.Minute).UTC().Format(time.RFC3339),
+	}
+	for k, v := range envs {
+		orig, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, orig)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	for _, mode := range []string{"error", "warn"} {
+		conf := ecspresso.NewDefaultConfig()
+		if err := conf.Load("tests/test.yaml"); err != nil {
+			t.Fatal(err)
+		}
+		conf.AWS = &ecspresso.AWSConfig{CredentialsExpiry: mode}
+		conf.Timeout = 10 * time.Minute
+		app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.CheckCredentialsExpiry("deploy")
+		if mode == "error" {
+			if err == nil || !strings.Contains(err.Error(), "before the timeout 10m0s of deploy") {
+				t.Errorf("expiring credentials must be an error: %v", err)
+			}
+		} else if err != nil {
+			t.Errorf("expiring credentials must be a warning: %v", err)
+		}
+
+		conf.Timeout = time.Minute
+		if err := app.CheckCredentialsExpiry("deploy"); err != nil {
+			t.Errorf("credentials live longer than the timeout: %v", err)
+		}
+	}
+}
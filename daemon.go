@@ -0,0 +1,179 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+func isDaemon(sv *ecs.Service) bool {
+	return aws.StringValue(sv.SchedulingStrategy) == ecs.SchedulingStrategyDaemon
+}
+
+// validateForDaemon returns an error when the option changes the desired count, which the DAEMON scheduling strategy manages.
+func (opt DeployOption) validateForDaemon() error {
+	if opt.DesiredCount != nil && *opt.DesiredCount != DefaultDesiredCount {
+		return errors.New("--tasks can not be used for the service with the DAEMON scheduling strategy. ECS runs one task on each container instance")
+	}
+	if opt.AutoScalingMin != nil || opt.AutoScalingMax != nil {
+		return errors.New("--auto-scaling-min and --auto-scaling-max can not be used for the service with the DAEMON scheduling strategy")
+	}
+	return nil
+}
+
+// daemonPlacementFilter returns the cluster query expression of memberOf placement constraints,
+// which selects container instances the daemon tasks are placed on.
+func daemonPlacementFilter(constraints []*ecs.PlacementConstraint) string {
+	var exprs []string
+	for _, c := range constraints {
+		if aws.StringValue(c.Type) == ecs.PlacementConstraintTypeMemberOf && aws.StringValue(c.Expression) != "" {
+			exprs = append(exprs, "("+aws.StringValue(c.Expression)+")")
+		}
+	}
+	return strings.Join(exprs, " and ")
+}
+
+// daemonCoverage represents container instances running a task of the daemon service.
+type daemonCoverage struct {
+	instances int
+	missing   []string
+}
+
+func (c daemonCoverage) complete() bool {
+	return len(c.missing) == 0
+}
+
+func (c daemonCoverage) String() string {
+	return fmt.Sprintf("%d/%d container instances", c.instances-len(c.missing), c.instances)
+}
+
+func containerInstanceID(ci *ecs.ContainerInstance) string {
+	if id := aws.StringValue(ci.Ec2InstanceId); id != "" {
+		return id
+	}
+	return arnToName(aws.StringValue(ci.ContainerInstanceArn))
+}
+
+// calcDaemonCoverage returns the coverage of RUNNING tasks of the task definition across the container instances.
+func calcDaemonCoverage(instances []*ecs.ContainerInstance, tasks []*ecs.Task, tdArn string) daemonCoverage {
+	running := map[string]bool{}
+	for _, t := range tasks {
+		if aws.StringValue(t.LastStatus) == "RUNNING" && aws.StringValue(t.TaskDefinitionArn) == tdArn {
+			running[aws.StringValue(t.ContainerInstanceArn)] = true
+		}
+	}
+	c := daemonCoverage{instances: len(instances)}
+	for _, ci := range instances {
+		if !running[aws.StringValue(ci.ContainerInstanceArn)] {
+			c.missing = append(c.missing, containerInstanceID(ci))
+		}
+	}
+	sort.Strings(c.missing)
+	return c
+}
+
+func (d *App) describeDaemonCoverage(ctx context.Context, sv *ecs.Service) (daemonCoverage, error) {
+	var instances []*ecs.ContainerInstance
+	in := &ecs.ListContainerInstancesInput{
+		Cluster: aws.String(d.Cluster),
+		Status:  aws.String(ecs.ContainerInstanceStatusActive),
+	}
+	if f := daemonPlacementFilter(sv.PlacementConstraints); f != "" {
+		in.Filter = aws.String(f)
+	}
+	for {
+		out, err := d.ecs.ListContainerInstancesWithContext(ctx, in)
+		if err != nil {
+			return daemonCoverage{}, errors.Wrap(err, "failed to list container instances")
+		}
+		if len(out.ContainerInstanceArns) > 0 {
+			cis, err := d.ecs.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+				Cluster:            aws.String(d.Cluster),
+				ContainerInstances: out.ContainerInstanceArns,
+			})
+			if err != nil {
+				return daemonCoverage{}, errors.Wrap(err, "failed to describe container instances")
+			}
+			instances = append(instances, cis.ContainerInstances...)
+		}
+		if in.NextToken = out.NextToken; in.NextToken == nil {
+			break
+		}
+	}
+
+	var tasks []*ecs.Task
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListTasksWithContext(ctx, &ecs.ListTasksInput{
+			Cluster:       aws.String(d.Cluster),
+			ServiceName:   sv.ServiceName,
+			DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+			NextToken:     nextToken,
+		})
+		if err != nil {
+			return daemonCoverage{}, errors.Wrap(err, "failed to list tasks")
+		}
+		if len(out.TaskArns) > 0 {
+			ts, err := d.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+				Cluster: aws.String(d.Cluster),
+				Tasks:   out.TaskArns,
+			})
+			if err != nil {
+				return daemonCoverage{}, errors.Wrap(err, "failed to describe tasks")
+			}
+			tasks = append(tasks, ts.Tasks...)
+		}
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+	return calcDaemonCoverage(instances, tasks, aws.StringValue(sv.TaskDefinition)), nil
+}
+
+// waitDaemonCoverage waits until all container instances run a task of the current task definition
+// after the service got stable. It does nothing for services with the REPLICA scheduling strategy.
+func (d *App) waitDaemonCoverage(ctx context.Context, poller *waitPoller) error {
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return err
+	}
+	if !isDaemon(sv) {
+		return nil
+	}
+	for {
+		c, err := d.describeDaemonCoverage(ctx, sv)
+		if err != nil {
+			return err
+		}
+		if c.complete() {
+			d.Log("Daemon tasks are running on", c.String())
+			return nil
+		}
+		d.Log(fmt.Sprintf("Waiting for daemon tasks on %s. missing: %s", c, strings.Join(c.missing, ", ")))
+		if err := poller.wait(ctx); err != nil {
+			return errors.Wrapf(err, "daemon tasks are running on %s", c)
+		}
+	}
+}
+
+func (d *App) showDaemonCoverage(ctx context.Context, w io.Writer, sv *ecs.Service) error {
+	if !isDaemon(sv) {
+		return nil
+	}
+	c, err := d.describeDaemonCoverage(ctx, sv)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "Daemon:")
+	fmt.Fprintln(w, spcIndent+"coverage: "+c.String())
+	for _, id := range c.missing {
+		fmt.Fprintln(w, spcIndent+"missing: "+id)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package ecspresso_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestDaemonPlacementFilter(t *testing.T) {
+	f := ecspresso.DaemonPlacementFilter([]*ecs.PlacementConstraint{
+		{Type: aws.String("memberOf"), Expression: aws.String("attribute:ecs.instance-type =~ g4dn.*")},
+		{Type: aws.String("distinctInstance")},
+		{Type: aws.String("memberOf"), Expression: aws.String("attribute:role == worker")},
+	})
+	if f != "(attribute:ecs.instance-type =~ g4dn.*) and (attribute:role == worker)" {
+		t.Errorf("unexpected filter %s", f)
+	}
+	if f := ecspresso.DaemonPlacementFilter(nil); f != "" {
+		t.Errorf("unexpected filter %s", f)
+	}
+}
+
+func TestCalcDaemonCoverage(t *testing.T) {
+	instances := []*ecs.ContainerInstance{
+		{ContainerInstanceArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:container-instance/default/a"), Ec2InstanceId: aws.String("i-aaa")},
+		{ContainerInstanceArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:container-instance/default/b"), Ec2InstanceId: aws.String("i-bbb")},
+		{ContainerInstanceArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:container-instance/default/c")},
+	}
+	td := "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/agent:2"
+	tasks := []*ecs.Task{
+		{ContainerInstanceArn: instances[0].ContainerInstanceArn, TaskDefinitionArn: aws.String(td), LastStatus: aws.String("RUNNING")},
+		// old revision
+		{ContainerInstanceArn: instances[1].ContainerInstanceArn, TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/agent:1"), LastStatus: aws.String("RUNNING")},
+		{ContainerInstanceArn: instances[2].ContainerInstanceArn, TaskDefinitionArn: aws.String(td), LastStatus: aws.String("PENDING")},
+	}
+	c := ecspresso.CalcDaemonCoverage(instances, tasks, td)
+	if s := c.String(); s != "1/3 container instances" {
+		t.Errorf("unexpected coverage %s", s)
+	}
+	if m := c.Missing(); !reflect.DeepEqual(m, []string{"c", "i-bbb"}) {
+		t.Errorf("unexpected missing instances %v", m)
+	}
+
+	tasks[1].TaskDefinitionArn = aws.String(td)
+	tasks[2].LastStatus = aws.String("RUNNING")
+	c = ecspresso.CalcDaemonCoverage(instances, tasks, td)
+	if s := c.String(); s != "3/3 container instances" || len(c.Missing()) != 0 {
+		t.Errorf("unexpected coverage %s %v", s, c.Missing())
+	}
+}
+
+func TestValidateForDaemon(t *testing.T) {
+	testCases := []struct {
+		opt   ecspresso.DeployOption
+		isErr bool
+	}{
+		{opt: ecspresso.DeployOption{DesiredCount: aws.Int64(ecspresso.DefaultDesiredCount)}},
+		{opt: ecspresso.DeployOption{DesiredCount: aws.Int64(3)}, isErr: true},
+		{opt: ecspresso.DeployOption{AutoScalingMin: aws.Int64(1)}, isErr: true},
+	}
+	for _, tc := range testCases {
+		if err := tc.opt.ValidateForDaemon(); (err != nil) != tc.isErr {
+			t.Errorf("unexpected error %v for %#v", err, tc.opt)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ecs"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -22,7 +23,7 @@ const (
 )
 
 func calcDesiredCount(sv *ecs.Service, opt optWithDesiredCount) *int64 {
-	if aws.StringValue(sv.SchedulingStrategy) == "DAEMON" {
+	if isDaemon(sv) {
 		return nil
 	}
 	if oc := opt.getDesiredCount(); oc != nil {
@@ -34,18 +35,133 @@ func calcDesiredCount(sv *ecs.Service, opt optWithDesiredCount) *int64 {
 	return nil
 }
 
+// ScaleDownProtectionConfig represents a configuration of the protection against unsafe desired count reductions.
+type ScaleDownProtectionConfig struct {
+	// MaxPercent is the maximum percentage of the reduction allowed without --allow-scale-down.
+	MaxPercent int64 `yaml:"max_percent"`
+}
+
+// checkScaleDown returns an error when the desired count in the service definition reduces
+// the current desired count to zero or by more than maxPercent.
+func checkScaleDown(current, next, maxPercent int64) error {
+	if next >= current {
+		return nil
+	}
+	if next == 0 {
+		return errors.Errorf("desiredCount will be reduced from %d to 0. use --allow-scale-down to deploy", current)
+	}
+	if p := (current - next) * 100 / current; p > maxPercent {
+		return errors.Errorf("desiredCount will be reduced from %d to %d (-%d%%) more than %d%%. use --allow-scale-down to deploy", current, next, p, maxPercent)
+	}
+	return nil
+}
+
 func (d *App) Deploy(opt DeployOption) error {
 	ctx, cancel := d.Start()
 	defer cancel()
+	return d.DeployWithContext(ctx, opt)
+}
+
+// DeployWithContext deploys the service with the context.
+// Nil bool and string fields of the option are treated as zero values.
+func (d *App) DeployWithContext(ctx context.Context, opt DeployOption) error {
+	fillNilOptions(&opt)
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
+	ctx, span := d.startSpan(ctx, "deploy", attribute.Bool("dry_run", *opt.DryRun))
+	ev := d.newDeploymentEvent()
+	var audit *AuditRecord
+	var ao auditOption
+	if !*opt.DryRun {
+		if err := d.checkCredentialsExpiry("deploy"); err != nil {
+			endSpan(span, err)
+			return err
+		}
+		unlock, err := d.acquireLock(ctx, aws.BoolValue(opt.ForceUnlock))
+		if err != nil {
+			endSpan(span, err)
+			return err
+		}
+		defer unlock()
+		if d.config.Interactive {
+			p, err := d.deployPlan(ctx, opt)
+			if err == nil {
+				err = d.confirmPlan(p)
+			}
+			if err != nil {
+				endSpan(span, err)
+				return err
+			}
+		}
+		d.notify(ev)
+		if !aws.BoolValue(opt.SkipTaskDefinition) && !aws.BoolValue(opt.LatestTaskDefinition) {
+			ao.taskDefinitionPath = d.config.TaskDefinitionPath
+		}
+		if aws.BoolValue(opt.UpdateService) {
+			ao.serviceDefinitionPath = d.config.ServiceDefinitionPath
+		}
+		ao.diff = ao.taskDefinitionPath != "" || ao.serviceDefinitionPath != ""
+		audit = d.startAudit(ctx, opt.commandName(), ao)
+	}
+	st := stateOption{command: opt.commandName(), startedAt: ev.StartedAt}
+	err := d.deploy(ctx, opt, ev, &st)
+	endSpan(span, err)
+	if !*opt.DryRun {
+		finished := ev.finish(DeploymentEventSuccess, err)
+		d.notify(finished)
+		d.writeDeploymentSummary(opt, finished)
+		d.finishAudit(audit, err)
+		if err == nil {
+			d.saveState(st)
+		}
+	}
+	return err
+}
+
+// commandName returns the name of the sub-command equivalent to the option.
+func (opt DeployOption) commandName() string {
+	if !aws.BoolValue(opt.SkipTaskDefinition) || aws.BoolValue(opt.UpdateService) {
+		return "deploy"
+	}
+	if opt.DesiredCount == nil && aws.BoolValue(opt.ForceNewDeployment) {
+		return "refresh"
+	}
+	return "scale"
+}
+
+// deploy deploys the service, and sets the definitions applied by the deployment to st.
+func (d *App) deploy(ctx context.Context, opt DeployOption, ev *DeploymentEvent, st *stateOption) error {
 	var sv *ecs.Service
 	d.Log("Starting deploy", opt.DryRunString())
+	if opt.hasServiceOverrides() {
+		if d.config.ServiceDefinitionPath == "" || !aws.BoolValue(opt.UpdateService) {
+			return errors.New("overriding service attributes requires service_definition and --update-service")
+		}
+		if err := opt.validateServiceOverrides(); err != nil {
+			return err
+		}
+	}
 	sv, err := d.DescribeServiceStatus(ctx, 0)
 	if err != nil {
 		return errors.Wrap(err, "failed to describe current service status")
 	}
+	if isDaemon(sv) {
+		if err := opt.validateForDaemon(); err != nil {
+			return err
+		}
+	}
+	if aws.BoolValue(opt.RollbackOnFailure) && isCodeDeploy(sv.DeploymentController) {
+		return errors.New("--rollback-on-failure is not supported for the CODE_DEPLOY deployment controller. enable auto rollback of the deployment group instead")
+	}
+	ev.PreviousTaskDefinition = arnToName(aws.StringValue(sv.TaskDefinition))
+	prevTdArn := aws.StringValue(sv.TaskDefinition)
 
 	var tdArn string
+	var newTd *TaskDefinitionInput
+	var artifacts *deployArtifacts
+	var recreate *Service
+	var renderedSv *Service
 	if *opt.LatestTaskDefinition {
 		family := strings.Split(arnToName(*sv.TaskDefinition), ":")[0]
 		var err error
@@ -56,62 +172,172 @@ func (d *App) Deploy(opt DeployOption) error {
 	} else if *opt.SkipTaskDefinition {
 		tdArn = *sv.TaskDefinition
 	} else {
+		_, span := d.startSpan(ctx, "render task definition")
 		td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+		endSpan(span, err)
 		if err != nil {
 			return errors.Wrap(err, "failed to load task definition")
 		}
+		d.emitEvent(LifecycleEvent{Type: EventTaskDefinitionRendered, Definition: td})
+		newTd = td
 		if *opt.DryRun {
 			d.Log("task definition:")
 			d.LogJSON(td)
-		} else {
-			newTd, err := d.RegisterTaskDefinition(ctx, td)
-			if err != nil {
-				return errors.Wrap(err, "failed to register task definition")
-			}
-			tdArn = *newTd.TaskDefinitionArn
 		}
 	}
 
-	var count *int64
-	if d.config.ServiceDefinitionPath != "" && aws.BoolValue(opt.UpdateService) {
+	updateService := d.config.ServiceDefinitionPath != "" && aws.BoolValue(opt.UpdateService)
+	if updateService {
+		// the service definition is checked before registering the task definition
+		_, span := d.startSpan(ctx, "render service definition")
 		newSv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
+		endSpan(span, err)
 		if err != nil {
 			return errors.Wrap(err, "failed to load service definition")
 		}
-		ds, err := diffServices(sv, newSv, "", d.config.ServiceDefinitionPath, false)
+		d.emitEvent(LifecycleEvent{Type: EventServiceDefinitionRendered, Definition: newSv})
+		d.logServiceOverrides(applyServiceOverrides(newSv, opt))
+		renderedSv = newSv
+		if c := d.config.ScaleDownProtection; c != nil && !aws.BoolValue(opt.AllowScaleDown) && !isDaemon(&newSv.Service) &&
+			aws.Int64Value(opt.DesiredCount) == DefaultDesiredCount && newSv.DesiredCount != nil {
+			if err := checkScaleDown(aws.Int64Value(sv.DesiredCount), *newSv.DesiredCount, c.MaxPercent); err != nil {
+				return err
+			}
+		}
+		if reason := incompatibleLoadBalancerChange(sv, newSv); reason != "" {
+			if !aws.BoolValue(opt.RecreateService) {
+				return errors.Errorf("%s. use --recreate-service to recreate the service", reason)
+			}
+			d.Log(reason + ". the service will be recreated")
+			recreate = newSv
+		}
+	}
+
+	if newTd != nil && !*opt.DryRun {
+		if artifacts, err = d.newDeployArtifacts(newTd); err != nil {
+			return err
+		}
+		registered, err := d.RegisterTaskDefinition(ctx, newTd)
+		if err != nil {
+			return errors.Wrap(err, "failed to register task definition")
+		}
+		tdArn = *registered.TaskDefinitionArn
+		st.taskDefinition = newTd
+	}
+
+	var count *int64
+	if updateService {
+		newSv := renderedSv
+		if err := d.resolveServiceRegistries(ctx, &newSv.Service, *opt.DryRun); err != nil {
+			return errors.Wrap(err, "failed to resolve service registries")
+		}
+		if err := d.resolveServiceConnectNamespace(ctx, newSv); err != nil {
+			return errors.Wrap(err, "failed to resolve service connect namespace")
+		}
+		if err := d.putDeployArtifacts(ctx, artifacts, tdArn, newSv); err != nil {
+			return err
+		}
+		clearRemovedPlacement(newSv, sv)
+		st.serviceDefinition = newSv
+		ds, err := diffServices(newServiceFromRemote(sv), newSv, "", d.config.ServiceDefinitionPath, false)
 		if err != nil {
 			return errors.Wrap(err, "failed to diff of service definitions")
 		}
-		if ds != "" {
+		switch {
+		case recreate != nil:
+			// the service will be created by the definition
+		case ds != "":
 			if err = d.UpdateServiceAttributes(ctx, newSv, opt); err != nil {
 				return errors.Wrap(err, "failed to update service attributes")
 			}
-			sv = newSv // updated
-		} else {
+			sv = &newSv.Service // updated
+		default:
 			d.Log("service attributes will not change")
 		}
-		count = calcDesiredCount(newSv, opt)
+		count = calcDesiredCount(&newSv.Service, opt)
 	} else {
+		if err := d.putDeployArtifacts(ctx, artifacts, tdArn, nil); err != nil {
+			return err
+		}
 		count = calcDesiredCount(sv, opt)
 	}
-	if count != nil {
+	if count, err = d.adjustScalableTarget(ctx, count, opt); err != nil {
+		return errors.Wrap(err, "failed to adjust scalable target")
+	}
+	switch {
+	case count != nil:
 		d.Log("desired count:", *count)
-	} else {
+	case isDaemon(sv):
+		d.Log("desired count: managed by the DAEMON scheduling strategy")
+	default:
 		d.Log("desired count: unchanged")
 	}
 
+	var asDef *AutoScalingDefinition
+	if d.config.AutoScalingDefinitionPath != "" && aws.BoolValue(opt.UpdateService) {
+		asDef, err = d.LoadAutoScalingDefinition(d.config.AutoScalingDefinitionPath)
+		if err != nil {
+			return errors.Wrap(err, "failed to load autoscaling definition")
+		}
+	}
+
 	if *opt.DryRun {
+		if asDef != nil {
+			if err := d.ApplyAutoScalingDefinition(ctx, asDef, true); err != nil {
+				return errors.Wrap(err, "failed to apply autoscaling definition")
+			}
+		}
+		if aws.BoolValue(opt.Estimate) {
+			if err := d.estimateDeployCost(ctx, newTd, renderedSv, count); err != nil {
+				return errors.Wrap(err, "failed to estimate cost")
+			}
+		}
 		d.Log("DRY RUN OK")
 		return nil
 	}
 
+	if err := d.setDeploymentEventTaskDefinition(ctx, ev, tdArn); err != nil {
+		d.Log("WARNING: failed to describe task definition for notifications", err)
+	}
+
 	// manage auto scaling only when set option --suspend-auto-scaling or --no-suspend-auto-scaling explicitly
 	if suspendState := opt.SuspendAutoScaling; suspendState != nil {
-		if err := d.suspendAutoScaling(*suspendState); err != nil {
+		if err := d.suspendAutoScaling(ctx, *suspendState); err != nil {
 			return err
 		}
 	}
 
+	if asDef != nil {
+		if err := d.ApplyAutoScalingDefinition(ctx, asDef, false); err != nil {
+			return errors.Wrap(err, "failed to apply autoscaling definition")
+		}
+	}
+
+	if aws.BoolValue(opt.SuspendAutoScalingDuringDeploy) {
+		if opt.SuspendAutoScaling != nil {
+			d.Log("--suspend-auto-scaling-during-deploy is ignored with --suspend-auto-scaling or --resume-auto-scaling")
+		} else if isCodeDeploy(sv.DeploymentController) || aws.BoolValue(opt.NoWait) {
+			d.Log("--suspend-auto-scaling-during-deploy works only for rolling deployments waiting for service stable")
+		} else {
+			restore, err := d.suspendAutoScalingDuringDeploy(ctx)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := restore(); err != nil {
+					d.Log("failed to restore suspended state of auto scaling", err)
+				}
+			}()
+		}
+	}
+
+	if recreate != nil {
+		if count == nil && aws.StringValue(recreate.SchedulingStrategy) != ecs.SchedulingStrategyDaemon {
+			count = sv.DesiredCount
+		}
+		return d.recreateService(ctx, recreate, tdArn, count)
+	}
+
 	// detect controller
 	if dc := sv.DeploymentController; dc != nil {
 		switch t := *dc.Type; t {
@@ -133,14 +359,90 @@ func (d *App) Deploy(opt DeployOption) error {
 	}
 
 	if err := d.WaitServiceStable(ctx, time.Now()); err != nil {
-		return errors.Wrap(err, "failed to wait service stable")
+		err = errors.Wrap(err, "failed to wait service stable")
+		if aws.BoolValue(opt.RollbackOnFailure) {
+			return d.rollbackOnFailure(ctx, prevTdArn, tdArn, err)
+		}
+		return err
+	}
+	if err := d.checkRolledBack(ctx, tdArn); err != nil {
+		return err
+	}
+	if d.config.LogCheck != nil && !aws.BoolValue(opt.SkipLogCheck) && opt.commandName() != "scale" {
+		if err := d.checkTaskLogs(ctx, tdArn, ev.StartedAt); err != nil {
+			err = errors.Wrap(err, "log check failed")
+			if aws.BoolValue(opt.RollbackOnFailure) {
+				return d.rollbackOnFailure(ctx, prevTdArn, tdArn, err)
+			}
+			return err
+		}
 	}
 
 	d.Log("Service is stable now. Completed!")
 	return nil
 }
 
-func (d *App) UpdateServiceTasks(ctx context.Context, taskDefinitionArn string, count *int64, opt DeployOption) error {
+// rollbackOnFailure updates the service back to the previous task definition after the deployment failed, and waits again.
+// It returns the error which reports both of the deployment and the rollback.
+func (d *App) rollbackOnFailure(ctx context.Context, prevTdArn, tdArn string, deployErr error) error {
+	if d.Interrupted() {
+		d.Log("skipping rollback on failure. interrupted")
+		return deployErr
+	}
+	if prevTdArn == "" || prevTdArn == tdArn {
+		d.Log("skipping rollback on failure. no previous task definition to roll back to")
+		return deployErr
+	}
+	d.Log(fmt.Sprintf("ERROR: %s", deployErr))
+	if ctx.Err() != nil {
+		// the deployment consumed the timeout. the rollback has the timeout of its own, and is still stopped by signals
+		var cancel context.CancelFunc
+		ctx, cancel = d.withTimeout(interruptContextOf(ctx))
+		defer cancel()
+	}
+
+	d.Log(fmt.Sprintf("Rolling back to %s...", arnToName(prevTdArn)))
+	if err := d.UpdateServiceTasks(ctx, prevTdArn, nil, DeployOption{ForceNewDeployment: aws.Bool(false)}); err != nil {
+		return errors.Wrapf(err, "%s, and failed to roll back to %s", deployErr, arnToName(prevTdArn))
+	}
+	if err := d.WaitServiceStable(ctx, time.Now()); err != nil {
+		return errors.Wrapf(err, "%s, and failed to wait service stable after rolled back to %s", deployErr, arnToName(prevTdArn))
+	}
+	d.Log("Service is rolled back and stable now.")
+	return withExitCode(ExitCodeRollback, errors.Wrapf(
+		deployErr, "the deployment of %s was rolled back to %s", arnToName(tdArn), arnToName(prevTdArn),
+	))
+}
+
+// checkRolledBack checks whether the deployment circuit breaker rolled back the deployment of the task definition.
+// The service becomes stable with the previous task definition after rolled back.
+func (d *App) checkRolledBack(ctx context.Context, tdArn string) error {
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to describe service")
+	}
+	current := aws.StringValue(sv.TaskDefinition)
+	for _, dep := range sv.Deployments {
+		if aws.StringValue(dep.Status) == "PRIMARY" {
+			current = aws.StringValue(dep.TaskDefinition)
+		}
+	}
+	if current == tdArn {
+		return nil
+	}
+	return withExitCode(ExitCodeRollback, errors.Errorf(
+		"the deployment of %s was rolled back to %s by the deployment circuit breaker",
+		arnToName(tdArn), arnToName(current),
+	))
+}
+
+func (d *App) UpdateServiceTasks(ctx context.Context, taskDefinitionArn string, count *int64, opt DeployOption) (err error) {
+	ctx, span := d.startSpan(ctx, "update service tasks")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := d.withPhaseTimeout(ctx, phaseUpdateService)
+	defer cancel()
+	defer func() { err = d.phaseTimeoutError(ctx, phaseUpdateService, err) }()
+
 	in := &ecs.UpdateServiceInput{
 		Service:            aws.String(d.Service),
 		Cluster:            aws.String(d.Cluster),
@@ -156,15 +458,15 @@ func (d *App) UpdateServiceTasks(ctx context.Context, taskDefinitionArn string,
 	d.Log(msg)
 	d.DebugLog(in.String())
 
-	_, err := d.ecs.UpdateServiceWithContext(ctx, in)
-	if err != nil {
+	if _, err := d.ecs.UpdateServiceWithContext(ctx, in); err != nil {
 		return err
 	}
+	d.emitEvent(LifecycleEvent{Type: EventDeploymentStarted, TaskDefinition: arnToName(taskDefinitionArn)})
 	time.Sleep(delayForServiceChanged) // wait for service updated
 	return nil
 }
 
-func svToUpdateServiceInput(sv *ecs.Service) *ecs.UpdateServiceInput {
+func svToUpdateServiceInput(sv *Service) *ecs.UpdateServiceInput {
 	in := &ecs.UpdateServiceInput{
 		CapacityProviderStrategy:      sv.CapacityProviderStrategy,
 		DeploymentConfiguration:       sv.DeploymentConfiguration,
@@ -178,15 +480,23 @@ func svToUpdateServiceInput(sv *ecs.Service) *ecs.UpdateServiceInput {
 		PlacementStrategy:             sv.PlacementStrategy,
 		PlatformVersion:               sv.PlatformVersion,
 		PropagateTags:                 sv.PropagateTags,
+		ServiceConnectConfiguration:   sv.ServiceConnectConfiguration,
 		ServiceRegistries:             sv.ServiceRegistries,
+		VolumeConfigurations:          sv.VolumeConfigurations,
 	}
-	if aws.StringValue(sv.SchedulingStrategy) == "DAEMON" {
+	if isDaemon(&sv.Service) {
 		in.PlacementConstraints = nil
 	}
 	return in
 }
 
-func (d *App) UpdateServiceAttributes(ctx context.Context, sv *ecs.Service, opt DeployOption) error {
+func (d *App) UpdateServiceAttributes(ctx context.Context, sv *Service, opt DeployOption) (err error) {
+	ctx, span := d.startSpan(ctx, "update service attributes")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := d.withPhaseTimeout(ctx, phaseUpdateService)
+	defer cancel()
+	defer func() { err = d.phaseTimeoutError(ctx, phaseUpdateService, err) }()
+
 	in := svToUpdateServiceInput(sv)
 	if isCodeDeploy(sv.DeploymentController) {
 		// unable to update attributes below with a CODE_DEPLOY deployment controller.
@@ -195,6 +505,8 @@ func (d *App) UpdateServiceAttributes(ctx context.Context, sv *ecs.Service, opt
 		in.ForceNewDeployment = nil
 		in.LoadBalancers = nil
 		in.ServiceRegistries = nil
+		in.ServiceConnectConfiguration = nil
+		in.VolumeConfigurations = nil
 	} else {
 		in.ForceNewDeployment = opt.ForceNewDeployment
 	}
@@ -239,10 +551,23 @@ func (d *App) DeployByCodeDeploy(ctx context.Context, taskDefinitionArn string,
 	return d.createDeployment(ctx, sv, taskDefinitionArn, opt.RollbackEvents)
 }
 
-func (d *App) findDeploymentInfo() (*codedeploy.DeploymentInfo, error) {
+func (d *App) findDeploymentInfo(ctx context.Context) (*codedeploy.DeploymentInfo, error) {
+	dg, err := d.findDeploymentGroup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &codedeploy.DeploymentInfo{
+		ApplicationName:      aws.String(*dg.ApplicationName),
+		DeploymentGroupName:  aws.String(*dg.DeploymentGroupName),
+		DeploymentConfigName: aws.String(*dg.DeploymentConfigName),
+	}, nil
+}
+
+// findDeploymentGroup finds the deployment group of CodeDeploy for the service.
+func (d *App) findDeploymentGroup(ctx context.Context) (*codedeploy.DeploymentGroupInfo, error) {
 	// search deploymentGroup in CodeDeploy
 	d.DebugLog("find all applications in CodeDeploy")
-	la, err := d.codedeploy.ListApplications(&codedeploy.ListApplicationsInput{})
+	la, err := d.codedeploy.ListApplicationsWithContext(ctx, &codedeploy.ListApplicationsInput{})
 	if err != nil {
 		return nil, err
 	}
@@ -255,7 +580,7 @@ func (d *App) findDeploymentInfo() (*codedeploy.DeploymentInfo, error) {
 		if end > len(la.Applications) {
 			end = len(la.Applications)
 		}
-		apps, err := d.codedeploy.BatchGetApplications(&codedeploy.BatchGetApplicationsInput{
+		apps, err := d.codedeploy.BatchGetApplicationsWithContext(ctx, &codedeploy.BatchGetApplicationsInput{
 			ApplicationNames: la.Applications[i:end],
 		})
 		if err != nil {
@@ -266,7 +591,7 @@ func (d *App) findDeploymentInfo() (*codedeploy.DeploymentInfo, error) {
 			if *info.ComputePlatform != "ECS" {
 				continue
 			}
-			lg, err := d.codedeploy.ListDeploymentGroups(&codedeploy.ListDeploymentGroupsInput{
+			lg, err := d.codedeploy.ListDeploymentGroupsWithContext(ctx, &codedeploy.ListDeploymentGroupsInput{
 				ApplicationName: info.ApplicationName,
 			})
 			if err != nil {
@@ -276,7 +601,7 @@ func (d *App) findDeploymentInfo() (*codedeploy.DeploymentInfo, error) {
 				d.DebugLog("no deploymentGroups in application", *info.ApplicationName)
 				continue
 			}
-			groups, err := d.codedeploy.BatchGetDeploymentGroups(&codedeploy.BatchGetDeploymentGroupsInput{
+			groups, err := d.codedeploy.BatchGetDeploymentGroupsWithContext(ctx, &codedeploy.BatchGetDeploymentGroupsInput{
 				ApplicationName:      info.ApplicationName,
 				DeploymentGroupNames: lg.DeploymentGroups,
 			})
@@ -287,11 +612,10 @@ func (d *App) findDeploymentInfo() (*codedeploy.DeploymentInfo, error) {
 				d.DebugLog("deploymentGroup", dg.String())
 				for _, ecsService := range dg.EcsServices {
 					if *ecsService.ClusterName == d.config.Cluster && *ecsService.ServiceName == d.config.Service {
-						return &codedeploy.DeploymentInfo{
-							ApplicationName:      aws.String(*info.ApplicationName),
-							DeploymentGroupName:  aws.String(*dg.DeploymentGroupName),
-							DeploymentConfigName: aws.String(*dg.DeploymentConfigName),
-						}, nil
+						if dg.ApplicationName == nil {
+							dg.ApplicationName = info.ApplicationName
+						}
+						return dg, nil
 					}
 				}
 			}
@@ -311,9 +635,20 @@ func isCodeDeploy(dc *ecs.DeploymentController) bool {
 	return false
 }
 
-func (d *App) createDeployment(ctx context.Context, sv *ecs.Service, taskDefinitionArn string, rollbackEvents *string) error {
+func (d *App) createDeployment(ctx context.Context, sv *ecs.Service, taskDefinitionArn string, rollbackEvents *string) (err error) {
+	ctx, span := d.startSpan(ctx, "create CodeDeploy deployment")
+	defer func() { endSpan(span, err) }()
 
-	spec, err := appspec.NewWithService(sv, taskDefinitionArn)
+	// deployment
+	dg, err := d.findDeploymentGroup(ctx)
+	if err != nil {
+		return err
+	}
+	lb, err := d.appSpecLoadBalancer(ctx, sv, dg)
+	if err != nil {
+		return err
+	}
+	spec, err := appspec.NewWithServiceLoadBalancer(sv, taskDefinitionArn, lb)
 	if err != nil {
 		return errors.Wrap(err, "failed to create appspec")
 	}
@@ -322,15 +657,11 @@ func (d *App) createDeployment(ctx context.Context, sv *ecs.Service, taskDefinit
 	}
 	d.DebugLog("appSpecContent:", spec.String())
 
-	// deployment
-	dp, err := d.findDeploymentInfo()
-	if err != nil {
-		return err
-	}
 	dd := &codedeploy.CreateDeploymentInput{
-		ApplicationName:      dp.ApplicationName,
-		DeploymentGroupName:  dp.DeploymentGroupName,
-		DeploymentConfigName: dp.DeploymentConfigName,
+		ApplicationName:      dg.ApplicationName,
+		DeploymentGroupName:  dg.DeploymentGroupName,
+		DeploymentConfigName: dg.DeploymentConfigName,
+		Description:          aws.String(fmt.Sprintf(codeDeployDescriptionFmt, currentUser())),
 		Revision: &codedeploy.RevisionLocation{
 			RevisionType: aws.String("AppSpecContent"),
 			AppSpecContent: &codedeploy.AppSpecContent{
@@ -356,6 +687,7 @@ func (d *App) createDeployment(ctx context.Context, sv *ecs.Service, taskDefinit
 		return errors.Wrap(err, "failed to create deployment")
 	}
 	id := *res.DeploymentId
+	d.emitEvent(LifecycleEvent{Type: EventDeploymentStarted, TaskDefinition: arnToName(taskDefinitionArn), DeploymentID: id})
 	u := fmt.Sprintf(
 		CodeDeployConsoleURLFmt,
 		d.config.Region,
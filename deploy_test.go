@@ -68,3 +68,27 @@ func TestCalcDesiredCount(t *testing.T) {
 		}
 	}
 }
+
+var scaleDownTestSuite = []struct {
+	current, next, maxPercent int64
+	isErr                     bool
+}{
+	{current: 10, next: 10, maxPercent: 50, isErr: false},
+	{current: 10, next: 20, maxPercent: 50, isErr: false},
+	{current: 10, next: 5, maxPercent: 50, isErr: false},
+	{current: 10, next: 4, maxPercent: 50, isErr: true},
+	{current: 10, next: 0, maxPercent: 100, isErr: true},
+	{current: 0, next: 0, maxPercent: 0, isErr: false},
+	{current: 2, next: 1, maxPercent: 0, isErr: true},
+}
+
+func TestCheckScaleDown(t *testing.T) {
+	for n, c := range scaleDownTestSuite {
+		err := ecspresso.CheckScaleDown(c.current, c.next, c.maxPercent)
+		if c.isErr && err == nil {
+			t.Errorf("case %d %d to %d must be error", n, c.current, c.next)
+		} else if !c.isErr && err != nil {
+			t.Errorf("case %d %d to %d unexpected error: %s", n, c.current, c.next, err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/kayac/ecspresso/appspec"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// codeDeployDescriptionFmt is a description of CodeDeploy deployments created by ecspresso.
+// The user is recorded to show who deployed in the deployments history.
+const codeDeployDescriptionFmt = "Deployed by %s using ecspresso"
+
+var codeDeployDescriptionRegex = regexp.MustCompile(`^Deployed by (\S+) using ecspresso`)
+
+type DeploymentsOption struct {
+	Count  *int64
+	Output *string
+	State  *bool
+}
+
+type deploymentHistory struct {
+	ID          string     `json:"id"`
+	Source      string     `json:"source"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Duration    string     `json:"duration,omitempty"`
+	By          string     `json:"by,omitempty"`
+	From        string     `json:"from,omitempty"`
+	To          string     `json:"to"`
+	Outcome     string     `json:"outcome"`
+}
+
+func (h deploymentHistory) Cols() []string {
+	var completedAt string
+	if h.CompletedAt != nil {
+		completedAt = h.CompletedAt.Local().Format(time.RFC3339)
+	}
+	return []string{
+		h.ID, h.Source, h.StartedAt.Local().Format(time.RFC3339), completedAt,
+		h.Duration, h.By, h.From, h.To, h.Outcome,
+	}
+}
+
+type deploymentHistories []deploymentHistory
+
+func (hs deploymentHistories) Header() []string {
+	return []string{"ID", "Source", "Started At", "Completed At", "Duration", "By", "From", "To", "Outcome"}
+}
+
+func (hs deploymentHistories) OutputJSON(w io.Writer) error {
+	b, err := MarshalJSON(hs)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (hs deploymentHistories) OutputTSV(w io.Writer) error {
+	for _, h := range hs {
+		if _, err := fmt.Fprintln(w, strings.Join(h.Cols(), "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hs deploymentHistories) OutputTable(w io.Writer) error {
+	t := tablewriter.NewWriter(w)
+	t.SetHeader(hs.Header())
+	t.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	for _, h := range hs {
+		t.Append(h.Cols())
+	}
+	t.Render()
+	return nil
+}
+
+// Deployments shows the history of deployments of the service.
+func (d *App) Deployments(opt DeploymentsOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	var hs deploymentHistories
+	if aws.BoolValue(opt.State) {
+		var err error
+		if hs, err = d.stateHistories(ctx, int(aws.Int64Value(opt.Count))); err != nil {
+			return err
+		}
+	} else {
+		sv, err := d.DescribeService(ctx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case isCodeDeploy(sv.DeploymentController):
+			hs, err = d.codeDeployHistories(ctx, int(aws.Int64Value(opt.Count)))
+		case d.stateEnabled() && d.config.State.S3.History:
+			// the states recorded by ecspresso include completed older deployments
+			hs, err = d.stateHistories(ctx, int(aws.Int64Value(opt.Count)))
+		default:
+			d.Log("WARNING: ECS keeps only PRIMARY and ACTIVE deployments, and By is the principal who registered the task definition. configure state.s3.history for the full history")
+			hs, err = d.ecsDeploymentHistories(ctx, sv)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if n := int(aws.Int64Value(opt.Count)); n > 0 && len(hs) > n {
+		hs = hs[:n]
+	}
+
+	switch aws.StringValue(opt.Output) {
+	case "json":
+		return hs.OutputJSON(os.Stdout)
+	case "tsv":
+		return hs.OutputTSV(os.Stdout)
+	default:
+		return hs.OutputTable(os.Stdout)
+	}
+}
+
+// ecsDeploymentHistories returns histories of the deployments in the service, newest first.
+// ECS keeps only PRIMARY and ACTIVE deployments, so completed older deployments are not included.
+func (d *App) ecsDeploymentHistories(ctx context.Context, sv *ecs.Service) (deploymentHistories, error) {
+	deps := make([]*ecs.Deployment, len(sv.Deployments))
+	copy(deps, sv.Deployments)
+	sort.Slice(deps, func(i, j int) bool {
+		return aws.TimeValue(deps[i].CreatedAt).Before(aws.TimeValue(deps[j].CreatedAt))
+	})
+	hs := make(deploymentHistories, 0, len(deps))
+	for i, dep := range deps {
+		out, err := d.describeTaskDefinitionCached(ctx, aws.StringValue(dep.TaskDefinition))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe task definition")
+		}
+		by := arnToName(aws.StringValue(out.TaskDefinition.RegisteredBy))
+		h := deploymentHistory{
+			ID:        aws.StringValue(dep.Id),
+			Source:    "ecs",
+			StartedAt: aws.TimeValue(dep.CreatedAt),
+			By:        by,
+			To:        arnToName(aws.StringValue(dep.TaskDefinition)),
+			Outcome:   aws.StringValue(dep.RolloutState),
+		}
+		if h.Outcome == "" {
+			h.Outcome = aws.StringValue(dep.Status)
+		}
+		if i > 0 {
+			h.From = arnToName(aws.StringValue(deps[i-1].TaskDefinition))
+		}
+		switch h.Outcome {
+		case ecs.DeploymentRolloutStateCompleted, ecs.DeploymentRolloutStateFailed:
+			h.complete(aws.TimeValue(dep.UpdatedAt))
+		}
+		hs = append(hs, h)
+	}
+	reverseHistories(hs)
+	return hs, nil
+}
+
+// stateHistories returns histories of the states recorded by ecspresso, newest first.
+func (d *App) stateHistories(ctx context.Context, count int) (deploymentHistories, error) {
+	if !d.stateEnabled() || !d.config.State.S3.History {
+		return nil, errors.New("state history is not configured. deployments --state requires state.s3.history in the config")
+	}
+	var keys []string
+	err := d.s3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.config.State.S3.Bucket),
+		Prefix: aws.String(d.stateHistoryPrefix()),
+	}, func(out *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range out.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the state history")
+	}
+	sort.Strings(keys)
+	// load one more state to know the previous revision of the oldest one
+	if count > 0 && len(keys) > count+1 {
+		keys = keys[len(keys)-count-1:]
+	}
+	states := make([]*DeployedState, 0, len(keys))
+	for _, key := range keys {
+		st, err := d.loadStateObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, st)
+	}
+	return stateHistoriesOf(states), nil
+}
+
+// stateHistoriesOf converts the states in order of deployments into histories, newest first.
+func stateHistoriesOf(states []*DeployedState) deploymentHistories {
+	hs := make(deploymentHistories, 0, len(states))
+	var prev string
+	for _, st := range states {
+		h := deploymentHistory{
+			ID:        st.DeployedAt.UTC().Format(stateHistoryTimeFormat),
+			Source:    "state/" + st.Command,
+			StartedAt: st.DeployedAt,
+			By:        arnToName(st.DeployedBy),
+			From:      prev,
+			To:        arnToName(st.TaskDefinition),
+			Outcome:   ecs.DeploymentRolloutStateCompleted,
+		}
+		if h.By == "" {
+			h.By = st.User
+		}
+		if st.StartedAt != nil {
+			h.StartedAt = *st.StartedAt
+			h.complete(st.DeployedAt)
+		}
+		prev = h.To
+		hs = append(hs, h)
+	}
+	reverseHistories(hs)
+	return hs
+}
+
+// codeDeployHistories returns histories of the deployments in the deployment group, newest first.
+func (d *App) codeDeployHistories(ctx context.Context, count int) (deploymentHistories, error) {
+	dp, err := d.findDeploymentInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ids []*string
+	var nextToken *string
+	for {
+		out, err := d.codedeploy.ListDeploymentsWithContext(ctx, &codedeploy.ListDeploymentsInput{
+			ApplicationName:     dp.ApplicationName,
+			DeploymentGroupName: dp.DeploymentGroupName,
+			NextToken:           nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list deployments")
+		}
+		ids = append(ids, out.Deployments...)
+		// fetch one more deployment to know the previous revision of the oldest one
+		if nextToken = out.NextToken; nextToken == nil || (count > 0 && len(ids) > count) {
+			break
+		}
+	}
+
+	infos, err := d.batchGetDeployments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return codeDeployHistoriesOf(infos), nil
+}
+
+func (d *App) batchGetDeployments(ctx context.Context, ids []*string) ([]*codedeploy.DeploymentInfo, error) {
+	var infos []*codedeploy.DeploymentInfo
+	// BatchGetDeployments accepts deployments less than 25
+	for i := 0; i < len(ids); i += 25 {
+		end := i + 25
+		if end > len(ids) {
+			end = len(ids)
+		}
+		out, err := d.codedeploy.BatchGetDeploymentsWithContext(ctx, &codedeploy.BatchGetDeploymentsInput{
+			DeploymentIds: ids[i:end],
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get deployments")
+		}
+		infos = append(infos, out.DeploymentsInfo...)
+	}
+	return infos, nil
+}
+
+// codeDeployHistoriesOf converts the CodeDeploy deployments into histories, newest first.
+func codeDeployHistoriesOf(infos []*codedeploy.DeploymentInfo) deploymentHistories {
+	sort.Slice(infos, func(i, j int) bool {
+		return aws.TimeValue(infos[i].CreateTime).Before(aws.TimeValue(infos[j].CreateTime))
+	})
+	hs := make(deploymentHistories, 0, len(infos))
+	var prev string
+	for _, info := range infos {
+		h := deploymentHistory{
+			ID:        aws.StringValue(info.DeploymentId),
+			Source:    "codedeploy",
+			StartedAt: aws.TimeValue(info.CreateTime),
+			By:        aws.StringValue(info.Creator),
+			From:      prev,
+			To:        arnToName(appSpecTaskDefinition(info.Revision)),
+			Outcome:   aws.StringValue(info.Status),
+		}
+		if m := codeDeployDescriptionRegex.FindStringSubmatch(aws.StringValue(info.Description)); m != nil {
+			h.By = m[1]
+		}
+		if info.CompleteTime != nil {
+			h.complete(*info.CompleteTime)
+		}
+		if aws.StringValue(info.Status) == codedeploy.DeploymentStatusSucceeded {
+			prev = h.To
+		}
+		hs = append(hs, h)
+	}
+	reverseHistories(hs)
+	return hs
+}
+
+func (h *deploymentHistory) complete(t time.Time) {
+	h.CompletedAt = &t
+	h.Duration = t.Sub(h.StartedAt).Round(time.Second).String()
+}
+
+func reverseHistories(hs deploymentHistories) {
+	for i, j := 0, len(hs)-1; i < j; i, j = i+1, j-1 {
+		hs[i], hs[j] = hs[j], hs[i]
+	}
+}
+
+// appSpecTaskDefinition returns the task definition ARN in the AppSpec content of the revision.
+func appSpecTaskDefinition(rev *codedeploy.RevisionLocation) string {
+	if rev == nil || rev.AppSpecContent == nil {
+		return ""
+	}
+	var spec appspec.AppSpec
+	if err := yaml.Unmarshal([]byte(aws.StringValue(rev.AppSpecContent.Content)), &spec); err != nil {
+		return ""
+	}
+	for _, r := range spec.Resources {
+		if r.TargetService != nil && r.TargetService.Properties != nil {
+			return aws.StringValue(r.TargetService.Properties.TaskDefinition)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/kayac/ecspresso"
+)
+
+func appSpecRevision(tdArn string) *codedeploy.RevisionLocation {
+	return &codedeploy.RevisionLocation{
+		RevisionType: aws.String("AppSpecContent"),
+		AppSpecContent: &codedeploy.AppSpecContent{
+			Content: aws.String("version: 0.0\nResources:\n- TargetService:\n    Type: AWS::ECS::Service\n    Properties:\n      TaskDefinition: " + tdArn + "\n"),
+		},
+	}
+}
+
+func TestCodeDeployHistoriesOf(t *testing.T) {
+	base := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	tdArn := "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/app:"
+	infos := []*codedeploy.DeploymentInfo{
+		{
+			DeploymentId: aws.String("d-3"),
+			CreateTime:   aws.Time(base.Add(2 * time.Hour)),
+			Creator:      aws.String("user"),
+			Status:       aws.String(codedeploy.DeploymentStatusInProgress),
+			Revision:     appSpecRevision(tdArn + "3"),
+		},
+		{
+			DeploymentId: aws.String("d-1"),
+			CreateTime:   aws.Time(base),
+			CompleteTime: aws.Time(base.Add(5 * time.Minute)),
+			Creator:      aws.String("user"),
+			Description:  aws.String("Deployed by alice using ecspresso"),
+			Status:       aws.String(codedeploy.DeploymentStatusSucceeded),
+			Revision:     appSpecRevision(tdArn + "1"),
+		},
+		{
+			DeploymentId: aws.String("d-2"),
+			CreateTime:   aws.Time(base.Add(time.Hour)),
+			CompleteTime: aws.Time(base.Add(time.Hour + 90*time.Second)),
+			Creator:      aws.String("user"),
+			Status:       aws.String(codedeploy.DeploymentStatusFailed),
+			Revision:     appSpecRevision(tdArn + "2"),
+		},
+	}
+	hs := ecspresso.CodeDeployHistoriesOf(infos)
+	if len(hs) != 3 {
+		t.Fatalf("unexpected histories %#v", hs)
+	}
+	expected := []struct {
+		id, by, from, to, duration, outcome string
+	}{
+		{"d-3", "user", "app:1", "app:3", "", "InProgress"},
+		{"d-2", "user", "app:1", "app:2", "1m30s", "Failed"},
+		{"d-1", "alice", "", "app:1", "5m0s", "Succeeded"},
+	}
+	for i, e := range expected {
+		h := hs[i]
+		if h.ID != e.id || h.By != e.by || h.From != e.from || h.To != e.to || h.Duration != e.duration || h.Outcome != e.outcome {
+			t.Errorf("unexpected history[%d] %#v expected %#v", i, h, e)
+		}
+	}
+	if hs[0].CompletedAt != nil {
+		t.Errorf("in progress deployment must not be completed %v", hs[0].CompletedAt)
+	}
+}
+
+type fakeStateS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+	gets    []string
+}
+
+func (f *fakeStateS3) ListObjectsV2PagesWithContext(_ aws.Context, in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.StringValue(in.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	// S3 lists keys in the lexicographical order, but the order must not be relied on
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	out := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		out.Contents = append(out.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	fn(out, true)
+	return nil
+}
+
+func (f *fakeStateS3) GetObjectWithContext(_ aws.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	f.gets = append(f.gets, aws.StringValue(in.Key))
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(f.objects[aws.StringValue(in.Key)]))}, nil
+}
+
+func TestStateHistories(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.State = &ecspresso.StateConfig{S3: &ecspresso.StateS3Config{Bucket: "bucket", Prefix: "ecspresso"}}
+
+	base := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	tdArn := "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/katsubushi:"
+	fake := &fakeStateS3{objects: map[string][]byte{}}
+	for i, st := range []ecspresso.DeployedState{
+		{Command: "deploy", DeployedAt: base, User: "alice", TaskDefinition: tdArn + "1"},
+		{Command: "deploy", DeployedAt: base.Add(time.Hour), DeployedBy: "arn:aws:sts::123456789012:assumed-role/deployer/bob", TaskDefinition: tdArn + "2"},
+		{Command: "rollback", StartedAt: aws.Time(base.Add(2 * time.Hour)), DeployedAt: base.Add(2*time.Hour + time.Minute), User: "carol", TaskDefinition: tdArn + "1"},
+	} {
+		b, _ := json.Marshal(st)
+		fake.objects["ecspresso/default2/test/history/"+st.DeployedAt.Format("20060102T150405.000Z")+".json"] = b
+		if i == 0 {
+			fake.objects["ecspresso/default2/test.json"] = b
+		}
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{S3: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.StateHistories(context.Background(), 10); err == nil {
+		t.Error("state history must be required")
+	}
+
+	conf.State.S3.History = true
+	hs, err := app.StateHistories(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		id, source, by, from, to, duration string
+	}{
+		{"20220401T140100.000Z", "state/rollback", "carol", "katsubushi:2", "katsubushi:1", "1m0s"},
+		{"20220401T130000.000Z", "state/deploy", "bob", "katsubushi:1", "katsubushi:2", ""},
+	}
+	if len(hs) != 3 {
+		t.Fatalf("unexpected histories %#v", hs)
+	}
+	for i, e := range expected {
+		h := hs[i]
+		if h.ID != e.id || h.Source != e.source || h.By != e.by || h.From != e.from || h.To != e.to || h.Duration != e.duration {
+			t.Errorf("unexpected history[%d] %#v expected %#v", i, h, e)
+		}
+	}
+	if len(fake.gets) != 3 {
+		t.Errorf("unexpected objects are loaded %v", fake.gets)
+	}
+}
+
+func TestDeploymentsFromStateHistory(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.State = &ecspresso.StateConfig{S3: &ecspresso.StateS3Config{Bucket: "bucket", Prefix: "ecspresso", History: true}}
+
+	st := ecspresso.DeployedState{
+		Command:        "deploy",
+		DeployedAt:     time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC),
+		TaskDefinition: "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/katsubushi:1",
+	}
+	b, _ := json.Marshal(st)
+	fakeS3 := &fakeStateS3{objects: map[string][]byte{"ecspresso/default2/test/history/20220401T120000.000Z.json": b}}
+	// task definitions of deployments in the service are not described for the rolling deployments
+	client := &fakeECS{service: &ecs.Service{
+		ServiceName:    aws.String("test"),
+		TaskDefinition: aws.String(st.TaskDefinition),
+	}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: client, S3: fakeS3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := ecspresso.DeploymentsOption{Count: aws.Int64(10), Output: aws.String("json"), State: aws.Bool(false)}
+	if err := app.Deployments(opt); err != nil {
+		t.Fatal(err)
+	}
+	if len(fakeS3.gets) != 1 {
+		t.Errorf("the history must come from the state history %v", fakeS3.gets)
+	}
+}
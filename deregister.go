@@ -32,28 +32,36 @@ func (d *App) Deregister(opt DeregisterOption) error {
 	defer cancel()
 	d.Log("Starting deregister task definition", opt.DryRunString())
 
-	inUse, err := d.inUseRevisions(ctx)
+	if aws.Int64Value(opt.Revision) <= 0 && aws.IntValue(opt.Keeps) <= 0 {
+		return errors.New("--revision or --keeps required")
+	}
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to load task definition")
+	}
+	refs, err := d.revisionReferences(ctx, aws.StringValue(td.Family))
 	if err != nil {
 		return err
 	}
 
 	if aws.Int64Value(opt.Revision) > 0 {
-		return d.deregiserRevision(ctx, opt, inUse)
-	} else if aws.IntValue(opt.Keeps) > 0 {
-		return d.deregisterKeeps(ctx, opt, inUse)
+		return d.deregiserRevision(ctx, opt, td, refs)
 	}
-	return errors.New("--revision or --keeps required")
+	return d.deregisterKeeps(ctx, opt, td, refs)
 }
 
-func (d *App) deregiserRevision(ctx context.Context, opt DeregisterOption, inUse map[string]string) error {
-	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
-	if err != nil {
-		return errors.Wrap(err, "failed to load task definition")
-	}
+func (d *App) deregiserRevision(ctx context.Context, opt DeregisterOption, td *TaskDefinitionInput, refs revisionRefs) error {
 	name := fmt.Sprintf("%s:%d", aws.StringValue(td.Family), aws.Int64Value(opt.Revision))
 
-	if s := inUse[name]; s != "" {
-		return errors.Errorf("%s is in use by %s", name, s)
+	if rs := refs[name]; len(rs) > 0 {
+		d.Log(fmt.Sprintf("%s is still referenced by", name))
+		for _, r := range rs {
+			d.Log(spcIndent + r)
+		}
+		if !aws.BoolValue(opt.Force) {
+			return errors.Errorf("%s is in use by %d references. --force deregisters it anyway", name, len(rs))
+		}
+		d.Log("WARNING: deregistering the referenced task definition by --force")
 	}
 
 	if aws.BoolValue(opt.DryRun) {
@@ -71,17 +79,13 @@ func (d *App) deregiserRevision(ctx context.Context, opt DeregisterOption, inUse
 		d.Log(fmt.Sprintf("%s was deregistered successfully", name))
 	} else {
 		d.Log("Aborted")
-		return errors.New("confirmation failed")
+		return errConfirmationFailed
 	}
 	return nil
 }
 
-func (d *App) deregisterKeeps(ctx context.Context, opt DeregisterOption, inUse map[string]string) error {
+func (d *App) deregisterKeeps(ctx context.Context, opt DeregisterOption, td *TaskDefinitionInput, refs revisionRefs) error {
 	keeps := aws.IntValue(opt.Keeps)
-	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
-	if err != nil {
-		return errors.Wrap(err, "failed to load task definition")
-	}
 	names := []string{}
 	var nextToken *string
 	for {
@@ -97,8 +101,8 @@ func (d *App) deregisterKeeps(ctx context.Context, opt DeregisterOption, inUse m
 			if err != nil {
 				continue
 			}
-			if s := inUse[name]; s != "" {
-				d.Log(fmt.Sprintf("%s is in use by %s. skip", name, s))
+			if rs := refs[name]; len(rs) > 0 {
+				d.Log(fmt.Sprintf("%s is in use by %s. skip", name, strings.Join(rs, ", ")))
 			} else {
 				d.DebugLog(fmt.Sprintf("%s is marked to deregister", name))
 				names = append(names, name)
@@ -141,7 +145,7 @@ func (d *App) deregisterKeeps(ctx context.Context, opt DeregisterOption, inUse m
 		}
 	} else {
 		d.Log("Aborted")
-		return errors.New("confirmation failed")
+		return errConfirmationFailed
 	}
 	d.Log(fmt.Sprintf("%d task definitions were deregistered", deregistered))
 
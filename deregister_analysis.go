@@ -0,0 +1,170 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/pkg/errors"
+)
+
+// recentlyStoppedTaskWindow is the duration to regard STOPPED tasks as references.
+// Stopped tasks still refer the revision to show and to investigate them.
+const recentlyStoppedTaskWindow = time.Hour
+
+// revisionRefs maps the task definition name (family:revision) to the references.
+type revisionRefs map[string][]string
+
+func (refs revisionRefs) add(tdArn, ref string) {
+	name, err := taskDefinitionToName(tdArn)
+	if err != nil {
+		// the ARN without a revision refers the latest revision
+		return
+	}
+	refs.addName(name, ref)
+}
+
+func (refs revisionRefs) addName(name, ref string) {
+	if name == "" {
+		return
+	}
+	for _, r := range refs[name] {
+		if r == ref {
+			return
+		}
+	}
+	refs[name] = append(refs[name], ref)
+}
+
+// revisionReferences lists services, scheduled tasks, running and recently stopped tasks
+// and CodeDeploy deployments referencing revisions of the family.
+func (d *App) revisionReferences(ctx context.Context, family string) (revisionRefs, error) {
+	refs := revisionRefs{}
+	if err := d.taskReferences(ctx, refs, time.Now()); err != nil {
+		return nil, err
+	}
+	clusterArn, err := d.serviceReferences(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.scheduledTaskReferences(ctx, refs, clusterArn, family); err != nil {
+		return nil, err
+	}
+	if d.config.Service != "" {
+		if err := d.codeDeployReferences(ctx, refs); err != nil {
+			return nil, err
+		}
+	}
+	for _, rs := range refs {
+		sort.Strings(rs)
+	}
+	return refs, nil
+}
+
+func (d *App) taskReferences(ctx context.Context, refs revisionRefs, now time.Time) error {
+	tasks, err := d.listTasks(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		st := aws.StringValue(task.LastStatus)
+		if st == "" {
+			st = aws.StringValue(task.DesiredStatus)
+		}
+		if st == ecs.DesiredStatusStopped && (task.StoppedAt == nil || now.Sub(*task.StoppedAt) > recentlyStoppedTaskWindow) {
+			continue
+		}
+		refs.add(aws.StringValue(task.TaskDefinitionArn), fmt.Sprintf("%s task %s", st, arnToName(aws.StringValue(task.TaskArn))))
+	}
+	return nil
+}
+
+// serviceReferences adds deployments of all services in the cluster, and returns the cluster ARN.
+func (d *App) serviceReferences(ctx context.Context, refs revisionRefs) (string, error) {
+	services, err := d.describeClusterServices(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	var clusterArn string
+	for _, sv := range services {
+		clusterArn = aws.StringValue(sv.ClusterArn)
+		for _, dp := range sv.Deployments {
+			refs.add(aws.StringValue(dp.TaskDefinition), fmt.Sprintf("service %s (%s deployment)", aws.StringValue(sv.ServiceName), aws.StringValue(dp.Status)))
+		}
+		for _, ts := range sv.TaskSets {
+			refs.add(aws.StringValue(ts.TaskDefinition), fmt.Sprintf("service %s (%s task set)", aws.StringValue(sv.ServiceName), aws.StringValue(ts.Status)))
+		}
+	}
+	if clusterArn == "" {
+		out, err := d.ecs.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
+			Clusters: aws.StringSlice([]string{d.Cluster}),
+		})
+		if err != nil {
+			return "", errors.Wrap(err, "failed to describe cluster")
+		}
+		if len(out.Clusters) > 0 {
+			clusterArn = aws.StringValue(out.Clusters[0].ClusterArn)
+		}
+	}
+	return clusterArn, nil
+}
+
+func (d *App) scheduledTaskReferences(ctx context.Context, refs revisionRefs, clusterArn, family string) error {
+	if clusterArn == "" {
+		return nil
+	}
+	rules, err := d.findScheduledTaskRules(ctx, clusterArn, family)
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		out, err := d.eventbridge.ListTargetsByRuleWithContext(ctx, &eventbridge.ListTargetsByRuleInput{
+			Rule: aws.String(r.name),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list targets of rule %s", r.name)
+		}
+		for _, t := range out.Targets {
+			if t.EcsParameters == nil {
+				continue
+			}
+			refs.add(aws.StringValue(t.EcsParameters.TaskDefinitionArn), "scheduled task rule "+r.name)
+		}
+	}
+	return nil
+}
+
+// codeDeployReferences adds deployments in progress, and the last successful deployment
+// which CodeDeploy rolls back to.
+func (d *App) codeDeployReferences(ctx context.Context, refs revisionRefs) error {
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return err
+	}
+	if !isCodeDeploy(sv.DeploymentController) {
+		return nil
+	}
+	hs, err := d.codeDeployHistories(ctx, 10)
+	if err != nil {
+		return err
+	}
+	var succeeded bool
+	for _, h := range hs {
+		switch h.Outcome {
+		case codedeploy.DeploymentStatusCreated, codedeploy.DeploymentStatusQueued,
+			codedeploy.DeploymentStatusInProgress, codedeploy.DeploymentStatusBaking, codedeploy.DeploymentStatusReady:
+			refs.addName(h.To, fmt.Sprintf("CodeDeploy deployment %s (%s)", h.ID, h.Outcome))
+		case codedeploy.DeploymentStatusSucceeded:
+			if !succeeded {
+				refs.addName(h.To, fmt.Sprintf("CodeDeploy deployment %s (the last succeeded)", h.ID))
+				succeeded = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package ecspresso_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso"
+)
+
+const (
+	testClusterArn = "arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"
+	testTdArn      = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:"
+)
+
+type fakeReferencesECS struct {
+	ecsiface.ECSAPI
+	now time.Time
+}
+
+func (f *fakeReferencesECS) ListServicesWithContext(_ aws.Context, _ *ecs.ListServicesInput, _ ...request.Option) (*ecs.ListServicesOutput, error) {
+	return &ecs.ListServicesOutput{ServiceArns: aws.StringSlice([]string{"test", "worker"})}, nil
+}
+
+func (f *fakeReferencesECS) DescribeServicesWithContext(_ aws.Context, in *ecs.DescribeServicesInput, _ ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	svs := map[string]*ecs.Service{
+		"test": {
+			ServiceName:    aws.String("test"),
+			ClusterArn:     aws.String(testClusterArn),
+			TaskDefinition: aws.String(testTdArn + "5"),
+			Deployments: []*ecs.Deployment{
+				{Status: aws.String("PRIMARY"), TaskDefinition: aws.String(testTdArn + "5")},
+				{Status: aws.String("ACTIVE"), TaskDefinition: aws.String(testTdArn + "4")},
+			},
+		},
+		"worker": {
+			ServiceName: aws.String("worker"),
+			ClusterArn:  aws.String(testClusterArn),
+			Deployments: []*ecs.Deployment{
+				{Status: aws.String("PRIMARY"), TaskDefinition: aws.String(testTdArn + "3")},
+			},
+		},
+	}
+	out := &ecs.DescribeServicesOutput{}
+	for _, name := range in.Services {
+		out.Services = append(out.Services, svs[aws.StringValue(name)])
+	}
+	return out, nil
+}
+
+func (f *fakeReferencesECS) DescribeTaskDefinitionWithContext(_ aws.Context, _ *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{Family: aws.String("test")}}, nil
+}
+
+func (f *fakeReferencesECS) ListTasksWithContext(_ aws.Context, in *ecs.ListTasksInput, _ ...request.Option) (*ecs.ListTasksOutput, error) {
+	if aws.StringValue(in.DesiredStatus) == "RUNNING" {
+		return &ecs.ListTasksOutput{TaskArns: aws.StringSlice([]string{"running"})}, nil
+	}
+	return &ecs.ListTasksOutput{TaskArns: aws.StringSlice([]string{"stopped-recently", "stopped-long-ago"})}, nil
+}
+
+func (f *fakeReferencesECS) DescribeTasksWithContext(_ aws.Context, in *ecs.DescribeTasksInput, _ ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	tasks := map[string]*ecs.Task{
+		"running":          {LastStatus: aws.String("RUNNING"), TaskDefinitionArn: aws.String(testTdArn + "5")},
+		"stopped-recently": {LastStatus: aws.String("STOPPED"), TaskDefinitionArn: aws.String(testTdArn + "2"), StoppedAt: aws.Time(f.now.Add(-10 * time.Minute))},
+		"stopped-long-ago": {LastStatus: aws.String("STOPPED"), TaskDefinitionArn: aws.String(testTdArn + "1"), StoppedAt: aws.Time(f.now.Add(-2 * time.Hour))},
+	}
+	out := &ecs.DescribeTasksOutput{}
+	for _, id := range in.Tasks {
+		task := tasks[aws.StringValue(id)]
+		task.TaskArn = aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/default2/" + aws.StringValue(id))
+		out.Tasks = append(out.Tasks, task)
+	}
+	return out, nil
+}
+
+type fakeReferencesEventBridge struct {
+	eventbridgeiface.EventBridgeAPI
+}
+
+func (f *fakeReferencesEventBridge) ListRuleNamesByTargetWithContext(_ aws.Context, _ *eventbridge.ListRuleNamesByTargetInput, _ ...request.Option) (*eventbridge.ListRuleNamesByTargetOutput, error) {
+	return &eventbridge.ListRuleNamesByTargetOutput{RuleNames: aws.StringSlice([]string{"batch"})}, nil
+}
+
+func (f *fakeReferencesEventBridge) ListTargetsByRuleWithContext(_ aws.Context, _ *eventbridge.ListTargetsByRuleInput, _ ...request.Option) (*eventbridge.ListTargetsByRuleOutput, error) {
+	return &eventbridge.ListTargetsByRuleOutput{Targets: []*eventbridge.Target{
+		{Id: aws.String("1"), EcsParameters: &eventbridge.EcsParameters{TaskDefinitionArn: aws.String(testTdArn + "3")}},
+	}}, nil
+}
+
+func TestRevisionReferences(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:         &fakeReferencesECS{now: time.Now()},
+		EventBridge: &fakeReferencesEventBridge{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := app.RevisionReferences(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"test:5": {"RUNNING task running", "service test (PRIMARY deployment)"},
+		"test:4": {"service test (ACTIVE deployment)"},
+		"test:3": {"scheduled task rule batch", "service worker (PRIMARY deployment)"},
+		"test:2": {"STOPPED task stopped-recently"},
+	}
+	if diff := cmp.Diff(expected, refs); diff != "" {
+		t.Errorf("unexpected references: %s", diff)
+	}
+}
@@ -1,6 +1,7 @@
 package ecspresso
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sort"
@@ -17,9 +18,9 @@ import (
 	"github.com/pkg/errors"
 )
 
-func diffServices(local, remote *ecs.Service, remoteArn string, localPath string, unified bool) (string, error) {
-	sortServiceDefinitionForDiff(local)
-	sortServiceDefinitionForDiff(remote)
+func diffServices(local, remote *Service, remoteArn string, localPath string, unified bool) (string, error) {
+	sortServiceDefinitionForDiff(&local.Service)
+	sortServiceDefinitionForDiff(&remote.Service)
 
 	newSvBytes, err := MarshalJSON(svToUpdateServiceInput(local))
 	if err != nil {
@@ -34,19 +35,7 @@ func diffServices(local, remote *ecs.Service, remoteArn string, localPath string
 		return "", errors.Wrap(err, "failed to marshal remote service definition")
 	}
 
-	remoteSv := string(remoteSvBytes)
-	newSv := string(newSvBytes)
-
-	if unified {
-		edits := myers.ComputeEdits(span.URIFromPath(remoteArn), remoteSv, newSv)
-		return fmt.Sprint(gotextdiff.ToUnified(remoteArn, localPath, remoteSv, edits)), nil
-	}
-
-	ds := diff.Diff(remoteSv, newSv)
-	if ds == "" {
-		return ds, nil
-	}
-	return fmt.Sprintf("--- %s\n+++ %s\n%s", remoteArn, localPath, ds), nil
+	return diffStrings(string(remoteSvBytes), string(newSvBytes), remoteArn, localPath, unified), nil
 }
 
 func diffTaskDefs(local, remote *TaskDefinitionInput, remoteArn string, localPath string, unified bool) (string, error) {
@@ -63,41 +52,116 @@ func diffTaskDefs(local, remote *TaskDefinitionInput, remoteArn string, localPat
 		return "", errors.Wrap(err, "failed to marshal remote task definition")
 	}
 
-	remoteTd := string(remoteTdBytes)
-	newTd := string(newTdBytes)
+	return diffStrings(string(remoteTdBytes), string(newTdBytes), remoteArn, localPath, unified), nil
+}
 
+func diffStrings(remote, local string, remoteName string, localPath string, unified bool) string {
 	if unified {
-		edits := myers.ComputeEdits(span.URIFromPath(remoteArn), remoteTd, newTd)
-		return fmt.Sprint(gotextdiff.ToUnified(remoteArn, localPath, remoteTd, edits)), nil
+		edits := myers.ComputeEdits(span.URIFromPath(remoteName), remote, local)
+		return fmt.Sprint(gotextdiff.ToUnified(remoteName, localPath, remote, edits))
 	}
 
-	ds := diff.Diff(remoteTd, newTd)
+	ds := diff.Diff(remote, local)
 	if ds == "" {
-		return ds, nil
+		return ds
 	}
-	return fmt.Sprintf("--- %s\n+++ %s\n%s", remoteArn, localPath, ds), nil
+	return fmt.Sprintf("--- %s\n+++ %s\n%s", remoteName, localPath, ds)
 }
 
 func (d *App) Diff(opt DiffOption) error {
 	ctx, cancel := d.Start()
 	defer cancel()
+	return d.DiffWithContext(ctx, opt)
+}
+
+// DiffWithContext displays diffs of the definitions with the context.
+// Nil bool and string fields of the option are treated as zero values.
+func (d *App) DiffWithContext(ctx context.Context, opt DiffOption) error {
+	fillNilOptions(&opt)
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	revision := aws.Int64Value(opt.Revision)
+	var diffs []string
+	var err error
+	switch {
+	case revision < 0:
+		return errors.Errorf("invalid revision %d", revision)
+	case *opt.Against != "" && revision > 0:
+		return errors.New("--revision and --against can not be specified at the same time")
+	case *opt.Against != "":
+		diffs, err = d.diffAgainstFile(*opt.Against, *opt.Unified)
+	default:
+		diffs, err = d.diffsWithRevision(ctx, *opt.Unified, revision)
+	}
+	if err != nil {
+		return err
+	}
+	for _, ds := range diffs {
+		fmt.Print(coloredDiff(ds))
+	}
+	if len(diffs) > 0 && *opt.ExitCode {
+		return withExitCode(ExitCodeDiffFound, errors.New("differences found"))
+	}
+	return nil
+}
+
+// diffs returns differences of the service, task and autoscaling definitions between local files and remote.
+func (d *App) diffs(ctx context.Context, unified bool) ([]string, error) {
+	return d.diffsWithRevision(ctx, unified, 0)
+}
+
+// diffAgainstFile returns differences of the task definition from the rendered task definition file.
+// Nothing is fetched from AWS.
+func (d *App) diffAgainstFile(path string, unified bool) ([]string, error) {
+	base, err := d.LoadTaskDefinition(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load task definition %s", path)
+	}
+	newTd, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load task definition")
+	}
+	ds, err := diffTaskDefs(d.redactTaskDefinition(newTd), d.redactTaskDefinition(base), path, d.config.TaskDefinitionPath, unified)
+	if err != nil || ds == "" {
+		return nil, err
+	}
+	return []string{ds}, nil
+}
 
+// diffsWithRevision returns differences as diffs. The task definition is compared with the revision of the family
+// instead of the deployed one when revision is positive.
+func (d *App) diffsWithRevision(ctx context.Context, unified bool, revision int64) ([]string, error) {
+	var diffs []string
 	var taskDefArn string
 	// diff for services only when service defined
 	if d.config.Service != "" {
 		newSv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
 		if err != nil {
-			return errors.Wrap(err, "failed to load service definition")
+			return nil, errors.Wrap(err, "failed to load service definition")
+		}
+		if err := d.resolveServiceConnectNamespace(ctx, newSv); err != nil {
+			return nil, errors.Wrap(err, "failed to resolve service connect namespace")
 		}
 		remoteSv, err := d.DescribeService(ctx)
 		if err != nil {
-			return errors.Wrap(err, "failed to describe service")
+			return nil, errors.Wrap(err, "failed to describe service")
 		}
 
-		if ds, err := diffServices(newSv, remoteSv, *remoteSv.ServiceArn, d.config.ServiceDefinitionPath, *opt.Unified); err != nil {
-			return err
+		if reason := incompatibleLoadBalancerChange(remoteSv, newSv); reason != "" {
+			d.Log("WARNING: " + reason + ". deploy requires --recreate-service to recreate the service")
+		}
+		if ds, err := diffServices(newSv, newServiceFromRemote(remoteSv), *remoteSv.ServiceArn, d.config.ServiceDefinitionPath, unified); err != nil {
+			return nil, err
 		} else if ds != "" {
-			fmt.Print(coloredDiff(ds))
+			diffs = append(diffs, ds)
+		}
+		if isCodeDeploy(remoteSv.DeploymentController) {
+			if ds, err := d.diffAppSpec(ctx, newSv, unified); err != nil {
+				d.Log("WARNING: unable to diff AppSpec.", err)
+			} else if ds != "" {
+				diffs = append(diffs, ds)
+			}
 		}
 		taskDefArn = *remoteSv.TaskDefinition
 	}
@@ -105,27 +169,48 @@ func (d *App) Diff(opt DiffOption) error {
 	// task definition
 	newTd, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
 	if err != nil {
-		return errors.Wrap(err, "failed to load task definition")
+		return nil, errors.Wrap(err, "failed to load task definition")
 	}
-	if taskDefArn == "" {
+	if revision > 0 {
+		taskDefArn = fmt.Sprintf("%s:%d", aws.StringValue(newTd.Family), revision)
+	} else if taskDefArn == "" {
 		arn, err := d.findLatestTaskDefinitionArn(ctx, *newTd.Family)
 		if err != nil {
-			return errors.Wrap(err, "failed to find latest task definition from family")
+			return nil, errors.Wrap(err, "failed to find latest task definition from family")
 		}
 		taskDefArn = arn
 	}
 	remoteTd, err := d.DescribeTaskDefinition(ctx, taskDefArn)
 	if err != nil {
-		return errors.Wrap(err, "failed to describe task definition")
+		return nil, errors.Wrap(err, "failed to describe task definition")
 	}
+	// the digest recorded by the artifacts is not a part of the task definition file
+	remoteTd.Tags = withoutArtifactHashTag(remoteTd.Tags)
 
-	if ds, err := diffTaskDefs(newTd, remoteTd, taskDefArn, d.config.TaskDefinitionPath, *opt.Unified); err != nil {
-		return err
+	if ds, err := diffTaskDefs(d.redactTaskDefinition(newTd), d.redactTaskDefinition(remoteTd), taskDefArn, d.config.TaskDefinitionPath, unified); err != nil {
+		return nil, err
 	} else if ds != "" {
-		fmt.Print(coloredDiff(ds))
+		diffs = append(diffs, ds)
 	}
 
-	return nil
+	// autoscaling definition
+	if d.config.AutoScalingDefinitionPath != "" {
+		newAs, err := d.LoadAutoScalingDefinition(d.config.AutoScalingDefinitionPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load autoscaling definition")
+		}
+		remoteAs, err := d.DescribeAutoScalingDefinition(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe autoscaling definition")
+		}
+		if ds, err := diffAutoScalingDefinitions(newAs, remoteAs, d.autoScalingResourceID(), d.config.AutoScalingDefinitionPath, unified); err != nil {
+			return nil, err
+		} else if ds != "" {
+			diffs = append(diffs, ds)
+		}
+	}
+
+	return diffs, nil
 }
 
 func coloredDiff(src string) string {
@@ -220,9 +305,9 @@ func sortServiceDefinitionForDiff(sv *ecs.Service) {
 	sortSlicesInDefinition(
 		reflect.TypeOf(*sv), reflect.Indirect(reflect.ValueOf(sv)),
 		"PlacementConstraints",
-		"PlacementStrategy",
 		"RequiresCompatibilities",
 	)
+	normalizePlacementStrategy(sv.PlacementStrategy)
 	if equalString(sv.LaunchType, ecs.LaunchTypeFargate) && sv.PlatformVersion == nil {
 		sv.PlatformVersion = aws.String("LATEST")
 	}
@@ -238,6 +323,13 @@ func sortServiceDefinitionForDiff(sv *ecs.Service) {
 		}
 	}
 
+	if sv.PropagateTags == nil {
+		sv.PropagateTags = aws.String(ecs.PropagateTagsNone)
+	}
+	if sv.EnableECSManagedTags == nil {
+		sv.EnableECSManagedTags = aws.Bool(false)
+	}
+
 	if len(sv.LoadBalancers) > 0 && sv.HealthCheckGracePeriodSeconds == nil {
 		sv.HealthCheckGracePeriodSeconds = aws.Int64(0)
 	}
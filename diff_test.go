@@ -1,9 +1,16 @@
 package ecspresso_test
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/kayac/ecspresso"
 )
@@ -192,3 +199,112 @@ func TestServiceDefinitionDiffer(t *testing.T) {
 		t.Log(testServiceDefinition2.String())
 	}
 }
+
+type fakeRevisionECS struct {
+	fakeECS
+	described []string
+}
+
+func (f *fakeRevisionECS) DescribeTaskDefinitionWithContext(_ aws.Context, in *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	f.described = append(f.described, aws.StringValue(in.TaskDefinition))
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{Family: aws.String("katsubushi")}}, nil
+}
+
+func testDiffApp(t *testing.T, client *fakeRevisionECS) *ecspresso.App {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Service = "" // diff only the task definition
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestDiffAgainst(t *testing.T) {
+	app := testDiffApp(t, &fakeRevisionECS{})
+	ctx := context.Background()
+	opt := ecspresso.DiffOption{Against: aws.String("tests/td.json"), ExitCode: aws.Bool(true)}
+	if err := app.DiffWithContext(ctx, opt); err != nil {
+		t.Errorf("no differences are expected: %s", err)
+	}
+
+	src, err := ioutil.ReadFile("tests/td.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "ecspresso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	against := filepath.Join(dir, "td.json")
+	if err := ioutil.WriteFile(against, []byte(strings.Replace(string(src), `"value": "3"`, `"value": "4"`, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt.Against = aws.String(against)
+	if err := app.DiffWithContext(ctx, opt); err == nil {
+		t.Error("differences are expected")
+	}
+}
+
+func TestDiffRevision(t *testing.T) {
+	client := &fakeRevisionECS{}
+	app := testDiffApp(t, client)
+	if err := app.DiffWithContext(context.Background(), ecspresso.DiffOption{Revision: aws.Int64(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.described) != 1 || client.described[0] != "katsubushi:3" {
+		t.Errorf("unexpected task definitions are described: %v", client.described)
+	}
+
+	err := app.DiffWithContext(context.Background(), ecspresso.DiffOption{Revision: aws.Int64(3), Against: aws.String("tests/td.json")})
+	if err == nil {
+		t.Error("--revision and --against must be exclusive")
+	}
+}
+
+type fakeArtifactTagECS struct {
+	fakeECS
+	td   *ecs.TaskDefinition
+	tags []*ecs.Tag
+}
+
+func (f *fakeArtifactTagECS) DescribeTaskDefinitionWithContext(_ aws.Context, in *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: f.td, Tags: f.tags}, nil
+}
+
+func TestDiffIgnoresArtifactHashTag(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Service = "" // diff only the task definition
+	conf.Artifacts = &ecspresso.ArtifactsConfig{Dir: "artifacts"}
+	client := &fakeArtifactTagECS{}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the remote task definition is registered from the same file with the digest tag
+	local, err := app.LoadTaskDefinition(conf.TaskDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.td = &ecs.TaskDefinition{}
+	if err := json.Unmarshal(b, client.td); err != nil {
+		t.Fatal(err)
+	}
+	client.tags = append(local.Tags, &ecs.Tag{Key: aws.String(ecspresso.ArtifactHashTagKey), Value: aws.String("0123abcd")})
+
+	opt := ecspresso.DiffOption{Revision: aws.Int64(1), ExitCode: aws.Bool(true)}
+	if err := app.DiffWithContext(context.Background(), opt); err != nil {
+		t.Errorf("the artifact hash tag must be ignored: %s", err)
+	}
+}
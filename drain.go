@@ -0,0 +1,263 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// UpdateContainerInstancesState accepts up to 10 container instances at once.
+const updateContainerInstancesStateMax = 10
+
+type DrainOption struct {
+	Instances *[]string
+	Filter    *string
+	DryRun    *bool
+	NoWait    *bool
+}
+
+func (opt DrainOption) DryRunString() string {
+	if aws.BoolValue(opt.DryRun) {
+		return dryRunStr
+	}
+	return ""
+}
+
+// drainFilter returns the cluster query expression selecting container instances to drain.
+// EC2 instance IDs in refs are selected by the expression. Other refs are container instance IDs or ARNs.
+// Both kinds of refs are selected only when they also match the filter.
+func drainFilter(refs []string, filter string) (string, []string) {
+	var ec2IDs, ids []string
+	for _, r := range refs {
+		if strings.HasPrefix(r, "i-") {
+			ec2IDs = append(ec2IDs, r)
+		} else {
+			ids = append(ids, r)
+		}
+	}
+	var exprs []string
+	if len(ec2IDs) > 0 {
+		exprs = append(exprs, "ec2InstanceId in ["+strings.Join(ec2IDs, ", ")+"]")
+	}
+	if filter != "" {
+		exprs = append(exprs, "("+filter+")")
+	}
+	return strings.Join(exprs, " and "), ids
+}
+
+// drainProgress returns the number of running tasks on the container instances and lines of instances not drained yet.
+func drainProgress(instances []*ecs.ContainerInstance) (int64, []string) {
+	var running int64
+	var lines []string
+	for _, ci := range instances {
+		n := aws.Int64Value(ci.RunningTasksCount)
+		if n == 0 {
+			continue
+		}
+		running += n
+		lines = append(lines, fmt.Sprintf("%s: %d running, %d pending tasks", containerInstanceID(ci), n, aws.Int64Value(ci.PendingTasksCount)))
+	}
+	sort.Strings(lines)
+	return running, lines
+}
+
+// Drain sets the container instances to DRAINING, and waits for tasks on them to be rescheduled to other instances.
+func (d *App) Drain(opt DrainOption) (err error) {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	var refs []string
+	if opt.Instances != nil {
+		refs = *opt.Instances
+	}
+	if len(refs) == 0 && aws.StringValue(opt.Filter) == "" {
+		return errors.New("--instance or --filter is required to select container instances to drain")
+	}
+	d.Log("Starting drain", opt.DryRunString())
+
+	instances, err := d.describeContainerInstancesToDrain(ctx, refs, aws.StringValue(opt.Filter))
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		return errors.New("no container instances are selected")
+	}
+	var active int
+	err = d.eachContainerInstance(ctx, func(*ecs.ContainerInstance) bool {
+		active++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	p := newChangePlan("drain container instances of")
+	var arns []*string
+	for _, ci := range instances {
+		d.Log(fmt.Sprintf("%s %s (%s) running tasks: %d",
+			containerInstanceID(ci), aws.StringValue(ci.Status), arnToName(aws.StringValue(ci.ContainerInstanceArn)), aws.Int64Value(ci.RunningTasksCount),
+		))
+		if aws.StringValue(ci.Status) == ecs.ContainerInstanceStatusDraining {
+			continue
+		}
+		p.add("drain %s (%d running tasks)", containerInstanceID(ci), aws.Int64Value(ci.RunningTasksCount))
+		arns = append(arns, ci.ContainerInstanceArn)
+	}
+	if active-len(arns) <= 0 {
+		d.Log("WARNING: no ACTIVE container instances will remain in the cluster. tasks can not be rescheduled until new instances are registered")
+	}
+	if aws.BoolValue(opt.DryRun) {
+		d.Log("DRY RUN OK")
+		return nil
+	}
+	if len(arns) > 0 {
+		if err := d.confirmPlan(p); err != nil {
+			return err
+		}
+	}
+
+	startedAt := time.Now()
+	for i := 0; i < len(arns); i += updateContainerInstancesStateMax {
+		end := i + updateContainerInstancesStateMax
+		if end > len(arns) {
+			end = len(arns)
+		}
+		out, err := d.ecs.UpdateContainerInstancesStateWithContext(ctx, &ecs.UpdateContainerInstancesStateInput{
+			Cluster:            aws.String(d.Cluster),
+			ContainerInstances: arns[i:end],
+			Status:             aws.String(ecs.ContainerInstanceStatusDraining),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to update container instances state")
+		}
+		if len(out.Failures) > 0 {
+			f := out.Failures[0]
+			return errors.Errorf("failed to drain %s: %s", arnToName(aws.StringValue(f.Arn)), aws.StringValue(f.Reason))
+		}
+	}
+	d.Log(fmt.Sprintf("%d container instances are DRAINING", len(instances)))
+
+	if aws.BoolValue(opt.NoWait) {
+		return nil
+	}
+	if err := d.waitContainerInstancesDrained(ctx, instances, newWaitPoller(d.config.Wait, startedAt)); err != nil {
+		return err
+	}
+	if d.Service != "" {
+		if err := d.WaitServiceStable(ctx, startedAt); err != nil {
+			return errors.Wrap(err, "failed to wait service stable")
+		}
+	}
+	d.Log("Container instances are drained. Completed!")
+	return nil
+}
+
+func (d *App) describeContainerInstancesToDrain(ctx context.Context, refs []string, filter string) ([]*ecs.ContainerInstance, error) {
+	expr, ids := drainFilter(refs, filter)
+	var arns []*string
+	// the expression selects nothing but the filter for refs of container instances only
+	if expr != "" && (len(refs) == 0 || len(ids) < len(refs)) {
+		listed, err := d.listContainerInstanceArns(ctx, expr)
+		if err != nil {
+			return nil, err
+		}
+		arns = append(arns, listed...)
+	}
+	if len(ids) > 0 && filter == "" {
+		arns = append(arns, aws.StringSlice(ids)...)
+	} else if len(ids) > 0 {
+		listed, err := d.listContainerInstanceArns(ctx, "("+filter+")")
+		if err != nil {
+			return nil, err
+		}
+		matched := map[string]string{}
+		for _, a := range listed {
+			matched[aws.StringValue(a)] = aws.StringValue(a)
+			matched[arnToName(aws.StringValue(a))] = aws.StringValue(a)
+		}
+		for _, id := range ids {
+			if a, ok := matched[id]; ok {
+				arns = append(arns, aws.String(a))
+			} else {
+				d.Log(fmt.Sprintf("container instance %s does not match the filter", id))
+			}
+		}
+	}
+	return d.describeContainerInstances(ctx, arns)
+}
+
+func (d *App) listContainerInstanceArns(ctx context.Context, expr string) ([]*string, error) {
+	var arns []*string
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListContainerInstancesWithContext(ctx, &ecs.ListContainerInstancesInput{
+			Cluster:   aws.String(d.Cluster),
+			Filter:    aws.String(expr),
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list container instances")
+		}
+		arns = append(arns, out.ContainerInstanceArns...)
+		if nextToken = out.NextToken; nextToken == nil {
+			return arns, nil
+		}
+	}
+}
+
+func (d *App) describeContainerInstances(ctx context.Context, arns []*string) ([]*ecs.ContainerInstance, error) {
+	var instances []*ecs.ContainerInstance
+	// DescribeContainerInstances accepts up to 100 container instances at once
+	for i := 0; i < len(arns); i += 100 {
+		end := i + 100
+		if end > len(arns) {
+			end = len(arns)
+		}
+		out, err := d.ecs.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+			Cluster:            aws.String(d.Cluster),
+			ContainerInstances: arns[i:end],
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe container instances")
+		}
+		if len(out.Failures) > 0 {
+			f := out.Failures[0]
+			return nil, errors.Errorf("container instance %s: %s", aws.StringValue(f.Arn), aws.StringValue(f.Reason))
+		}
+		instances = append(instances, out.ContainerInstances...)
+	}
+	return instances, nil
+}
+
+func (d *App) waitContainerInstancesDrained(ctx context.Context, instances []*ecs.ContainerInstance, poller *waitPoller) error {
+	ctx, cancel := d.withPhaseTimeout(ctx, phaseWait)
+	defer cancel()
+	arns := make([]*string, 0, len(instances))
+	for _, ci := range instances {
+		arns = append(arns, ci.ContainerInstanceArn)
+	}
+	d.Log("Waiting for tasks to be rescheduled...")
+	for {
+		current, err := d.describeContainerInstances(ctx, arns)
+		if err != nil {
+			return d.phaseTimeoutError(ctx, phaseWait, err)
+		}
+		running, lines := drainProgress(current)
+		if running == 0 {
+			return nil
+		}
+		d.Log(fmt.Sprintf("%d tasks are running on draining container instances", running))
+		for _, line := range lines {
+			d.Log(spcIndent + line)
+		}
+		if err := poller.wait(ctx); err != nil {
+			return d.phaseTimeoutError(ctx, phaseWait, errors.Wrapf(err, "%d tasks are still running. tasks not managed by services are not stopped by draining", running))
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package ecspresso_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestDrainFilter(t *testing.T) {
+	expr, ids := ecspresso.DrainFilter([]string{"i-aaa", "0a1b2c", "i-bbb"}, "attribute:ecs.ami-id == ami-1")
+	if expr != "ec2InstanceId in [i-aaa, i-bbb] and (attribute:ecs.ami-id == ami-1)" {
+		t.Errorf("unexpected filter %s", expr)
+	}
+	if !reflect.DeepEqual(ids, []string{"0a1b2c"}) {
+		t.Errorf("unexpected ids %v", ids)
+	}
+	if expr, _ := ecspresso.DrainFilter([]string{"0a1b2c"}, ""); expr != "" {
+		t.Errorf("unexpected filter %s", expr)
+	}
+}
+
+func TestDrainProgress(t *testing.T) {
+	running, lines := ecspresso.DrainProgress([]*ecs.ContainerInstance{
+		{Ec2InstanceId: aws.String("i-bbb"), RunningTasksCount: aws.Int64(2), PendingTasksCount: aws.Int64(1)},
+		{Ec2InstanceId: aws.String("i-aaa"), RunningTasksCount: aws.Int64(0)},
+		{Ec2InstanceId: aws.String("i-ccc"), RunningTasksCount: aws.Int64(1)},
+	})
+	if running != 3 {
+		t.Errorf("unexpected running tasks %d", running)
+	}
+	expected := []string{"i-bbb: 2 running, 1 pending tasks", "i-ccc: 1 running, 0 pending tasks"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("unexpected lines %#v", lines)
+	}
+}
+
+type fakeDrainECS struct {
+	fakeECS
+	instances []*ecs.ContainerInstance
+	filter    string
+	drained   []string
+}
+
+func (f *fakeDrainECS) ListContainerInstancesWithContext(_ aws.Context, in *ecs.ListContainerInstancesInput, _ ...request.Option) (*ecs.ListContainerInstancesOutput, error) {
+	out := &ecs.ListContainerInstancesOutput{}
+	if in.Filter != nil {
+		f.filter = aws.StringValue(in.Filter)
+		out.ContainerInstanceArns = []*string{f.instances[0].ContainerInstanceArn}
+		return out, nil
+	}
+	for _, ci := range f.instances {
+		if aws.StringValue(ci.Status) == aws.StringValue(in.Status) {
+			out.ContainerInstanceArns = append(out.ContainerInstanceArns, ci.ContainerInstanceArn)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDrainECS) DescribeContainerInstancesWithContext(_ aws.Context, in *ecs.DescribeContainerInstancesInput, _ ...request.Option) (*ecs.DescribeContainerInstancesOutput, error) {
+	out := &ecs.DescribeContainerInstancesOutput{}
+	for _, arn := range in.ContainerInstances {
+		for _, ci := range f.instances {
+			if aws.StringValue(ci.ContainerInstanceArn) == aws.StringValue(arn) {
+				out.ContainerInstances = append(out.ContainerInstances, ci)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDrainECS) UpdateContainerInstancesStateWithContext(_ aws.Context, in *ecs.UpdateContainerInstancesStateInput, _ ...request.Option) (*ecs.UpdateContainerInstancesStateOutput, error) {
+	for _, arn := range in.ContainerInstances {
+		f.drained = append(f.drained, aws.StringValue(arn))
+		for _, ci := range f.instances {
+			if aws.StringValue(ci.ContainerInstanceArn) == aws.StringValue(arn) {
+				ci.Status = in.Status
+				ci.RunningTasksCount = aws.Int64(0)
+			}
+		}
+	}
+	return &ecs.UpdateContainerInstancesStateOutput{}, nil
+}
+
+func TestDrain(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	arn := "arn:aws:ecs:ap-northeast-1:123456789012:container-instance/default2/"
+	fake := &fakeDrainECS{
+		fakeECS: fakeECS{
+			service: &ecs.Service{
+				ServiceName:    aws.String("test"),
+				TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+			},
+		},
+		instances: []*ecs.ContainerInstance{
+			{ContainerInstanceArn: aws.String(arn + "a"), Ec2InstanceId: aws.String("i-aaa"), Status: aws.String("ACTIVE"), RunningTasksCount: aws.Int64(2)},
+			{ContainerInstanceArn: aws.String(arn + "b"), Ec2InstanceId: aws.String("i-bbb"), Status: aws.String("ACTIVE"), RunningTasksCount: aws.Int64(1)},
+		},
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt := ecspresso.DrainOption{Instances: &[]string{"i-aaa"}, DryRun: aws.Bool(true)}
+	if err := app.Drain(opt); err != nil {
+		t.Fatal(err)
+	}
+	if fake.filter != "ec2InstanceId in [i-aaa]" {
+		t.Errorf("unexpected filter %s", fake.filter)
+	}
+	if len(fake.drained) != 0 {
+		t.Error("must not drain in dry-run")
+	}
+
+	opt.DryRun = aws.Bool(false)
+	if err := app.Drain(opt); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fake.drained, []string{arn + "a"}) {
+		t.Errorf("unexpected drained instances %v", fake.drained)
+	}
+	if !fake.waited {
+		t.Error("must wait for service stable")
+	}
+
+	// container instance IDs are also selected only when they match the filter
+	fake.drained = nil
+	fake.instances[0].Status = aws.String("ACTIVE")
+	opt = ecspresso.DrainOption{Instances: &[]string{"a", "b"}, Filter: aws.String("attribute:ecs.ami-id == ami-1"), DryRun: aws.Bool(false)}
+	if err := app.Drain(opt); err != nil {
+		t.Fatal(err)
+	}
+	if fake.filter != "(attribute:ecs.ami-id == ami-1)" || !reflect.DeepEqual(fake.drained, []string{arn + "a"}) {
+		t.Errorf("unexpected drained instances %v by %s", fake.drained, fake.filter)
+	}
+
+	if err := app.Drain(ecspresso.DrainOption{}); err == nil {
+		t.Error("drain without instances must be an error")
+	}
+}
@@ -0,0 +1,340 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+const (
+	stateTimeout           = 30 * time.Second
+	stateHistoryTimeFormat = "20060102T150405.000Z"
+)
+
+// StateConfig represents a configuration of the state file recorded by deployments.
+type StateConfig struct {
+	S3 *StateS3Config `yaml:"s3,omitempty"`
+}
+
+// StateS3Config represents a configuration of the state file stored to S3.
+type StateS3Config struct {
+	Bucket string `yaml:"bucket"`
+	Prefix string `yaml:"prefix,omitempty"`
+	// History also records every state under {cluster}/{service}/history/ for deployments --state.
+	History bool `yaml:"history,omitempty"`
+}
+
+// DeployedState represents a state of the service deployed by ecspresso.
+type DeployedState struct {
+	Cluster        string                 `json:"cluster"`
+	Service        string                 `json:"service"`
+	Command        string                 `json:"command"`
+	StartedAt      *time.Time             `json:"started_at,omitempty"`
+	DeployedAt     time.Time              `json:"deployed_at"`
+	DeployedBy     string                 `json:"deployed_by,omitempty"`
+	User           string                 `json:"user,omitempty"`
+	TaskDefinition string                 `json:"task_definition"`
+	Attributes     json.RawMessage        `json:"attributes"`
+	Tags           map[string]string      `json:"tags,omitempty"`
+	AutoScaling    *AutoScalingDefinition `json:"auto_scaling,omitempty"`
+
+	// RenderedTaskDefinition and RenderedServiceDefinition are the definitions registered and applied by the command.
+	// Values of all environment variables are masked whatever the redaction is configured.
+	RenderedTaskDefinition    json.RawMessage `json:"rendered_task_definition,omitempty"`
+	RenderedServiceDefinition json.RawMessage `json:"rendered_service_definition,omitempty"`
+}
+
+// stateOption represents the command recorded in the state and the definitions applied by it.
+type stateOption struct {
+	command           string
+	startedAt         time.Time
+	taskDefinition    *TaskDefinitionInput
+	serviceDefinition *Service
+}
+
+func (d *App) stateKey() string {
+	return path.Join(d.config.State.S3.Prefix, d.Cluster, d.Service+".json")
+}
+
+func (d *App) stateURL() string {
+	return fmt.Sprintf("s3://%s/%s", d.config.State.S3.Bucket, d.stateKey())
+}
+
+func (d *App) stateHistoryPrefix() string {
+	return path.Join(d.config.State.S3.Prefix, d.Cluster, d.Service, "history") + "/"
+}
+
+// stateHistoryKey returns the key of the state in the history. Keys are sorted in order of deployments.
+func (d *App) stateHistoryKey(st *DeployedState) string {
+	return d.stateHistoryPrefix() + st.DeployedAt.UTC().Format(stateHistoryTimeFormat) + ".json"
+}
+
+func (d *App) stateEnabled() bool {
+	return d.config.State != nil && d.config.State.S3 != nil
+}
+
+// currentState returns the live state of the service.
+func (d *App) currentState(ctx context.Context) (*DeployedState, error) {
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	remote := newServiceFromRemote(sv)
+	sortServiceDefinitionForDiff(&remote.Service)
+	attrs, err := MarshalJSON(svToUpdateServiceInput(remote))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal service attributes")
+	}
+	st := &DeployedState{
+		Cluster:        d.Cluster,
+		Service:        d.Service,
+		TaskDefinition: aws.StringValue(sv.TaskDefinition),
+		Attributes:     json.RawMessage(attrs),
+		Tags:           map[string]string{},
+	}
+
+	out, err := d.ecs.ListTagsForResourceWithContext(ctx, &ecs.ListTagsForResourceInput{
+		ResourceArn: sv.ServiceArn,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tags of the service")
+	}
+	for _, t := range out.Tags {
+		st.Tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	as, err := d.DescribeAutoScalingDefinition(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if as.ScalableTarget != nil {
+		sortAutoScalingDefinitionForDiff(as)
+		st.AutoScaling = as
+	}
+	return st, nil
+}
+
+// saveState records the live state of the service as the last deployed state.
+// Failures are logged and never change the result of the command.
+func (d *App) saveState(opt stateOption) {
+	if !d.stateEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+
+	st, err := d.currentState(ctx)
+	if err != nil {
+		d.Log("WARNING: failed to get the state of the service", err)
+		return
+	}
+	st.Command = opt.command
+	if !opt.startedAt.IsZero() {
+		st.StartedAt = &opt.startedAt
+	}
+	st.DeployedAt = time.Now()
+	st.User = currentUser()
+	if out, err := d.sts.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+		d.DebugLog("failed to get caller identity for the state", err)
+	} else {
+		st.DeployedBy = aws.StringValue(out.Arn)
+	}
+	if td := opt.taskDefinition; td != nil {
+		if b, err := MarshalJSON(maskEnvironmentValues(td)); err == nil {
+			st.RenderedTaskDefinition = json.RawMessage(b)
+		}
+	}
+	if sv := opt.serviceDefinition; sv != nil {
+		if b, err := MarshalJSON(maskEnvironmentValues(sv)); err == nil {
+			st.RenderedServiceDefinition = json.RawMessage(b)
+		}
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		d.Log("WARNING: failed to marshal the state", err)
+		return
+	}
+	keys := []string{d.stateKey()}
+	if d.config.State.S3.History {
+		keys = append(keys, d.stateHistoryKey(st))
+	}
+	for _, key := range keys {
+		_, err = d.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(d.config.State.S3.Bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(b),
+			ContentType: aws.String("application/json"),
+		})
+		url := fmt.Sprintf("s3://%s/%s", d.config.State.S3.Bucket, key)
+		if err != nil {
+			d.Log("WARNING: failed to put the state to", url, err)
+			return
+		}
+		d.DebugLog("state saved to", url)
+	}
+}
+
+// maskEnvironmentValues returns a copy of v with values of all environment variables masked.
+// States are kept in S3 for a long time, so fingerprints of values are not stored either.
+func maskEnvironmentValues(v interface{}) interface{} {
+	c := awsutil.CopyOf(v)
+	eachKeyValuePair(reflect.ValueOf(c), func(kv *ecs.KeyValuePair) {
+		if kv.Value != nil {
+			kv.Value = aws.String(redactedValue)
+		}
+	})
+	return c
+}
+
+func (d *App) loadState(ctx context.Context) (*DeployedState, error) {
+	return d.loadStateObject(ctx, d.stateKey())
+}
+
+func (d *App) loadStateObject(ctx context.Context, key string) (*DeployedState, error) {
+	url := fmt.Sprintf("s3://%s/%s", d.config.State.S3.Bucket, key)
+	out, err := d.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.config.State.S3.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, errors.Errorf("no state found at %s. deploy by ecspresso at first", url)
+		}
+		return nil, errors.Wrapf(err, "failed to get the state from %s", url)
+	}
+	defer out.Body.Close()
+	b, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the state from %s", url)
+	}
+	var st DeployedState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the state from %s", url)
+	}
+	return &st, nil
+}
+
+// driftDiffs returns differences between the deployed state and the live state.
+func driftDiffs(deployed, live *DeployedState, deployedName, liveName string, unified bool) ([]string, error) {
+	var diffs []string
+	if deployed.TaskDefinition != live.TaskDefinition {
+		diffs = append(diffs, diffStrings(
+			deployed.TaskDefinition+"\n", live.TaskDefinition+"\n",
+			deployedName+" taskDefinition", liveName+" taskDefinition", unified,
+		))
+	}
+	parts := []struct {
+		name           string
+		deployed, live interface{}
+	}{
+		{"attributes", deployed.Attributes, live.Attributes},
+		{"tags", sortedTags(deployed.Tags), sortedTags(live.Tags)},
+		{"autoScaling", autoScalingOrEmpty(deployed.AutoScaling), autoScalingOrEmpty(live.AutoScaling)},
+	}
+	for _, p := range parts {
+		db, err := marshalIndentJSON(p.deployed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal deployed %s", p.name)
+		}
+		lb, err := marshalIndentJSON(p.live)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal live %s", p.name)
+		}
+		if ds := diffStrings(db, lb, deployedName+" "+p.name, liveName+" "+p.name, unified); ds != "" {
+			diffs = append(diffs, ds)
+		}
+	}
+	return diffs, nil
+}
+
+func marshalIndentJSON(v interface{}) (string, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		if len(raw) == 0 {
+			return "", nil
+		}
+		// normalize indents of the raw message nested in the state file
+		var compacted, buf bytes.Buffer
+		if err := json.Compact(&compacted, raw); err != nil {
+			return "", err
+		}
+		json.Indent(&buf, compacted.Bytes(), "", "  ")
+		buf.WriteString("\n")
+		return buf.String(), nil
+	}
+	b, err := MarshalJSON(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func autoScalingOrEmpty(def *AutoScalingDefinition) *AutoScalingDefinition {
+	if def == nil {
+		return &AutoScalingDefinition{}
+	}
+	return def
+}
+
+func sortedTags(tags map[string]string) []*ecs.Tag {
+	ts := make([]*ecs.Tag, 0, len(tags))
+	for k, v := range tags {
+		ts = append(ts, &ecs.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		return *ts[i].Key < *ts[j].Key
+	})
+	return ts
+}
+
+// Drift reports out-of-band changes of the service made after the last deployment by ecspresso.
+func (d *App) Drift(opt DriftOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	if !d.stateEnabled() {
+		return errors.New("state is not configured. drift requires state.s3 in the config")
+	}
+	deployed, err := d.loadState(ctx)
+	if err != nil {
+		return err
+	}
+	live, err := d.currentState(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the live state of the service")
+	}
+	if deployed.DeployedBy != "" {
+		d.Log("Last deployed state:", d.stateURL(), deployed.Command, "at", deployed.DeployedAt.Local().Format(time.RFC3339), "by", deployed.DeployedBy)
+	} else {
+		d.Log("Last deployed state:", d.stateURL(), deployed.Command, "at", deployed.DeployedAt.Local().Format(time.RFC3339))
+	}
+
+	diffs, err := driftDiffs(deployed, live, "deployed", "live", aws.BoolValue(opt.Unified))
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		d.Log("No drift detected")
+		return nil
+	}
+	for _, ds := range diffs {
+		fmt.Print(coloredDiff(ds))
+	}
+	if aws.BoolValue(opt.ExitCode) {
+		return withExitCode(ExitCodeDiffFound, errors.New("drift detected"))
+	}
+	return nil
+}
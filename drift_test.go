@@ -0,0 +1,109 @@
+package ecspresso_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func newTestDeployedState(t *testing.T, desiredCount int64) *ecspresso.DeployedState {
+	attrs, err := ecspresso.MarshalJSON(&ecs.UpdateServiceInput{
+		DesiredCount:         aws.Int64(desiredCount),
+		EnableExecuteCommand: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	min, max := int64(1), int64(10)
+	return &ecspresso.DeployedState{
+		Cluster:        "default",
+		Service:        "test",
+		TaskDefinition: "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1",
+		Attributes:     json.RawMessage(attrs),
+		Tags:           map[string]string{"Env": "dev"},
+		AutoScaling: &ecspresso.AutoScalingDefinition{
+			ScalableTarget: &ecspresso.ScalableTargetDefinition{
+				MinCapacity: &min,
+				MaxCapacity: &max,
+			},
+		},
+	}
+}
+
+func TestDriftDiffsNoDrift(t *testing.T) {
+	live := newTestDeployedState(t, 2)
+	// the deployed state is restored from the state file
+	b, err := json.MarshalIndent(newTestDeployedState(t, 2), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deployed ecspresso.DeployedState
+	if err := json.Unmarshal(b, &deployed); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := ecspresso.DriftDiffs(&deployed, live, "deployed", "live", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("unexpected drift %s", strings.Join(diffs, ""))
+	}
+}
+
+func TestDriftDiffs(t *testing.T) {
+	deployed := newTestDeployedState(t, 2)
+	live := newTestDeployedState(t, 5)
+	live.TaskDefinition = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"
+	live.Tags["Env"] = "prod"
+	live.AutoScaling = nil
+
+	diffs, err := ecspresso.DriftDiffs(deployed, live, "deployed", "live", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 4 {
+		t.Fatalf("expected 4 diffs, got %d: %s", len(diffs), strings.Join(diffs, ""))
+	}
+	for i, expected := range []string{"test:2", `"desiredCount": 5`, `"value": "prod"`, `"maxCapacity": 10`} {
+		if !strings.Contains(diffs[i], expected) {
+			t.Errorf("diff[%d] must contain %s: %s", i, expected, diffs[i])
+		}
+	}
+}
+
+func TestMaskEnvironmentValues(t *testing.T) {
+	td := &ecspresso.TaskDefinitionInput{
+		Family: aws.String("test"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{
+				Name: aws.String("app"),
+				Environment: []*ecs.KeyValuePair{
+					{Name: aws.String("HOST"), Value: aws.String("db.example.com")},
+					{Name: aws.String("DB_PASS"), Value: aws.String("hunter2")},
+				},
+			},
+		},
+	}
+	b, err := ecspresso.MarshalJSON(ecspresso.MaskEnvironmentValues(td))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b)
+	// all values are masked, even if they are not matched by any redaction patterns
+	for _, v := range []string{"db.example.com", "hunter2"} {
+		if strings.Contains(s, v) {
+			t.Errorf("value %s must be masked in %s", v, s)
+		}
+	}
+	if strings.Count(s, "<redacted>") != 2 {
+		t.Errorf("values must be masked in %s", s)
+	}
+	// the original definition is not modified
+	if v := aws.StringValue(td.ContainerDefinitions[0].Environment[0].Value); v != "db.example.com" {
+		t.Errorf("the original definition is modified: %s", v)
+	}
+}
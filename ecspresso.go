@@ -5,27 +5,44 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Songmu/prompter"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling/applicationautoscalingiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/codedeploy/codedeployiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/aws/aws-sdk-go/service/ecs"
-	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/servicediscovery/servicediscoveryiface"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 	"github.com/fatih/color"
 	gc "github.com/kayac/go-config"
 	"github.com/mattn/go-isatty"
 	"github.com/morikuni/aec"
 	"github.com/pkg/errors"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const DefaultDesiredCount = -1
@@ -44,24 +61,56 @@ func taskDefinitionName(t *TaskDefinition) string {
 }
 
 type App struct {
-	ecs         *ecs.ECS
-	autoScaling *applicationautoscaling.ApplicationAutoScaling
-	codedeploy  *codedeploy.CodeDeploy
-	cwl         *cloudwatchlogs.CloudWatchLogs
-	iam         *iam.IAM
-
-	sess     *session.Session
-	verifier *verifier
+	ecs              ecsiface.ECSAPI
+	autoScaling      applicationautoscalingiface.ApplicationAutoScalingAPI
+	codedeploy       codedeployiface.CodeDeployAPI
+	cloudwatch       cloudwatchiface.CloudWatchAPI
+	cwl              cloudwatchlogsiface.CloudWatchLogsAPI
+	iam              iamiface.IAMAPI
+	servicediscovery servicediscoveryiface.ServiceDiscoveryAPI
+	dynamodb         dynamodbiface.DynamoDBAPI
+	s3               s3iface.S3API
+	eventbridge      eventbridgeiface.EventBridgeAPI
+	elbv2            elbv2iface.ELBV2API
+	ecr              ecriface.ECRAPI
+	ec2              ec2iface.EC2API
+	sts              stsiface.STSAPI
+
+	sess       *session.Session
+	verifier   *verifier
+	redactor   *redactor
+	notifiers  []notifier
+	auditSinks []auditSink
+
+	tracer         trace.Tracer
+	tracerProvider *sdktrace.TracerProvider
 
 	Service string
 	Cluster string
 	config  *Config
 	Debug   bool
 
+	// Verbosity is the level of the output. VerbosityNormal by default.
+	Verbosity int
+
+	LogFormat string
+	phaseMu   sync.Mutex
+	phase     string
+
 	ExtStr  map[string]string
 	ExtCode map[string]string
 
 	loader *gc.Loader
+
+	eventHandlers []LifecycleEventHandler
+	interrupted   int32
+
+	// taskDefinitionCache caches responses of DescribeTaskDefinition by the ARN with the revision.
+	taskDefinitionCacheMu sync.Mutex
+	taskDefinitionCache   map[string]*ecs.DescribeTaskDefinitionOutput
+
+	imageLabelsCacheMu sync.Mutex
+	imageLabelsCache   map[string]map[string]string
 }
 
 func (d *App) DescribeServicesInput() *ecs.DescribeServicesInput {
@@ -119,8 +168,25 @@ func (d *App) DescribeServiceStatus(ctx context.Context, events int) (*ecs.Servi
 		}
 	}
 
-	if err := d.describeAutoScaling(s); err != nil {
-		return nil, errors.Wrap(err, "failed to describe autoscaling")
+	err = runBufferedTasks(ctx, os.Stdout,
+		func(ctx context.Context, w io.Writer) error {
+			return errors.Wrap(d.describeServiceConnect(ctx, w, s), "failed to describe service connect")
+		},
+		func(ctx context.Context, w io.Writer) error {
+			return errors.Wrap(d.describeAutoScaling(ctx, w, s), "failed to describe autoscaling")
+		},
+		func(ctx context.Context, w io.Writer) error {
+			return errors.Wrap(d.describeExternalInstances(ctx, w, s), "failed to describe external instances")
+		},
+		func(ctx context.Context, w io.Writer) error {
+			return errors.Wrap(d.describeNetworkEndpoints(ctx, w, s), "failed to describe network endpoints")
+		},
+		func(ctx context.Context, w io.Writer) error {
+			return errors.Wrap(d.showDaemonCoverage(ctx, w, s), "failed to describe daemon coverage")
+		},
+	)
+	if err != nil {
+		return nil, err
 	}
 
 	fmt.Println("Events:")
@@ -135,9 +201,10 @@ func (d *App) DescribeServiceStatus(ctx context.Context, events int) (*ecs.Servi
 	return s, nil
 }
 
-func (d *App) describeAutoScaling(s *ecs.Service) error {
+func (d *App) describeAutoScaling(ctx context.Context, w io.Writer, s *ecs.Service) error {
 	resourceId := fmt.Sprintf("service/%s/%s", arnToName(*s.ClusterArn), *s.ServiceName)
-	tout, err := d.autoScaling.DescribeScalableTargets(
+	tout, err := d.autoScaling.DescribeScalableTargetsWithContext(
+		ctx,
 		&applicationautoscaling.DescribeScalableTargetsInput{
 			ResourceIds:       []*string{&resourceId},
 			ServiceNamespace:  aws.String("ecs"),
@@ -157,12 +224,13 @@ func (d *App) describeAutoScaling(s *ecs.Service) error {
 		return nil
 	}
 
-	fmt.Println("AutoScaling:")
+	fmt.Fprintln(w, "AutoScaling:")
 	for _, target := range tout.ScalableTargets {
-		fmt.Println(formatScalableTarget(target))
+		fmt.Fprintln(w, formatScalableTarget(target))
 	}
 
-	pout, err := d.autoScaling.DescribeScalingPolicies(
+	pout, err := d.autoScaling.DescribeScalingPoliciesWithContext(
+		ctx,
 		&applicationautoscaling.DescribeScalingPoliciesInput{
 			ResourceId:        &resourceId,
 			ServiceNamespace:  aws.String("ecs"),
@@ -173,18 +241,41 @@ func (d *App) describeAutoScaling(s *ecs.Service) error {
 		return errors.Wrap(err, "failed to describe scaling policies")
 	}
 	for _, policy := range pout.ScalingPolicies {
-		fmt.Println(formatScalingPolicy(policy))
+		fmt.Fprintln(w, formatScalingPolicy(policy))
+	}
+
+	sout, err := d.autoScaling.DescribeScheduledActionsWithContext(
+		ctx,
+		&applicationautoscaling.DescribeScheduledActionsInput{
+			ResourceId:        &resourceId,
+			ServiceNamespace:  aws.String("ecs"),
+			ScalableDimension: aws.String("ecs:service:DesiredCount"),
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to describe scheduled actions")
+	}
+	for _, action := range sout.ScheduledActions {
+		fmt.Fprintln(w, formatScheduledAction(action))
 	}
 	return nil
 }
 
 func (d *App) DescribeServiceDeployments(ctx context.Context, startedAt time.Time) (int, error) {
+	lines, _, err := d.describeServiceDeployments(ctx, startedAt)
+	return lines, err
+}
+
+// describeServiceDeployments shows deployments and events of the service after startedAt.
+// It returns the number of lines shown and the time of the latest event.
+func (d *App) describeServiceDeployments(ctx context.Context, startedAt time.Time) (int, time.Time, error) {
+	var latest time.Time
 	out, err := d.ecs.DescribeServicesWithContext(ctx, d.DescribeServicesInput())
 	if err != nil {
-		return 0, err
+		return 0, latest, err
 	}
 	if len(out.Services) == 0 {
-		return 0, nil
+		return 0, latest, nil
 	}
 	s := out.Services[0]
 	lines := 0
@@ -199,8 +290,11 @@ func (d *App) DescribeServiceDeployments(ctx context.Context, startedAt time.Tim
 				lines++
 			}
 		}
+		if event.CreatedAt.After(latest) {
+			latest = *event.CreatedAt
+		}
 	}
-	return lines, nil
+	return lines, latest, nil
 }
 
 func (d *App) DescribeTaskStatus(ctx context.Context, task *ecs.Task, watchContainer *ecs.ContainerDefinition) error {
@@ -238,6 +332,28 @@ func (d *App) DescribeTaskStatus(ctx context.Context, task *ecs.Task, watchConta
 }
 
 func (d *App) DescribeTaskDefinition(ctx context.Context, tdArn string) (*TaskDefinitionInput, error) {
+	out, err := d.describeTaskDefinitionCached(ctx, tdArn)
+	if err != nil {
+		return nil, err
+	}
+	return tdToTaskDefinitionInput(out.TaskDefinition, out.Tags), nil
+}
+
+// describeTaskDefinitionCached describes the task definition with tags.
+// Responses for the task definition with a revision are cached, because revisions are immutable
+// except for tags and the status. It returns a deep copy of the cached response.
+func (d *App) describeTaskDefinitionCached(ctx context.Context, tdArn string) (*ecs.DescribeTaskDefinitionOutput, error) {
+	cacheable := strings.Contains(arnToName(tdArn), ":")
+	if cacheable {
+		d.taskDefinitionCacheMu.Lock()
+		cached, ok := d.taskDefinitionCache[tdArn]
+		d.taskDefinitionCacheMu.Unlock()
+		if ok {
+			var out ecs.DescribeTaskDefinitionOutput
+			awsutil.Copy(&out, cached)
+			return &out, nil
+		}
+	}
 	out, err := d.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
 		TaskDefinition: &tdArn,
 		Include:        []*string{aws.String("TAGS")},
@@ -245,7 +361,17 @@ func (d *App) DescribeTaskDefinition(ctx context.Context, tdArn string) (*TaskDe
 	if err != nil {
 		return nil, err
 	}
-	return tdToTaskDefinitionInput(out.TaskDefinition, out.Tags), nil
+	if cacheable {
+		var cached ecs.DescribeTaskDefinitionOutput
+		awsutil.Copy(&cached, out)
+		d.taskDefinitionCacheMu.Lock()
+		if d.taskDefinitionCache == nil {
+			d.taskDefinitionCache = map[string]*ecs.DescribeTaskDefinitionOutput{}
+		}
+		d.taskDefinitionCache[tdArn] = &cached
+		d.taskDefinitionCacheMu.Unlock()
+	}
+	return out, nil
 }
 
 func (d *App) GetLogEvents(ctx context.Context, logGroup string, logStream string, startedAt time.Time, nextToken *string) (*string, error) {
@@ -266,68 +392,162 @@ func (d *App) GetLogEvents(ctx context.Context, logGroup string, logStream strin
 }
 
 func NewApp(conf *Config) (*App, error) {
+	return newApp(conf, AWSClients{})
+}
+
+func newApp(conf *Config, clients AWSClients) (*App, error) {
+	if conf.validation {
+		return newValidationApp(conf), nil
+	}
 	if err := conf.setupPlugins(); err != nil {
 		return nil, err
 	}
 	loader := gc.New()
+	loader.Funcs(conf.varsFuncMap())
+	// vars are also referred by {{ .Var.name }}
+	loader.Data = map[string]interface{}{"Var": conf.Vars}
 	for _, f := range conf.templateFuncs {
 		loader.Funcs(f)
 	}
 
 	sess := conf.sess
 	d := &App{
-		Service:     conf.Service,
-		Cluster:     conf.Cluster,
-		ecs:         ecs.New(sess),
-		autoScaling: applicationautoscaling.New(sess),
-		codedeploy:  codedeploy.New(sess),
-		cwl:         cloudwatchlogs.New(sess),
-		iam:         iam.New(sess),
-
-		sess:   sess,
-		config: conf,
-		loader: loader,
+		Service:  conf.Service,
+		Cluster:  conf.Cluster,
+		sess:     sess,
+		config:   conf,
+		loader:   loader,
+		redactor: newRedactor(conf.Redaction),
+	}
+	if sess != nil {
+		d.setupRequestLogger(sess)
+	}
+	clients.fill(sess)
+	d.ecs = clients.ECS
+	d.autoScaling = clients.ApplicationAutoScaling
+	d.servicediscovery = clients.ServiceDiscovery
+	d.dynamodb = clients.DynamoDB
+	d.s3 = clients.S3
+	d.eventbridge = clients.EventBridge
+	d.elbv2 = clients.ELBv2
+	d.ecr = clients.ECR
+	d.ec2 = clients.EC2
+	d.codedeploy = clients.CodeDeploy
+	d.cloudwatch = clients.CloudWatch
+	d.cwl = clients.CloudWatchLogs
+	d.iam = clients.IAM
+	d.sts = clients.STS
+	d.notifiers = newNotifiers(conf.Notifications, sess)
+	d.auditSinks = newAuditSinks(conf.Audit, sess)
+	loader.Funcs(d.imageLabelFuncMap())
+	if err := d.setupTracing(); err != nil {
+		return nil, err
 	}
 	return d, nil
 }
 
 func (d *App) Start() (context.Context, context.CancelFunc) {
-	log.SetOutput(os.Stdout)
+	d.setupLogger()
+	ctx, stop := d.handleSignals(context.Background())
+	ctx, cancel := d.withTimeout(ctx)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
 
+// withTimeout returns the context with the timeout in the configuration.
+func (d *App) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
 	if d.config.Timeout > 0 {
-		return context.WithTimeout(context.Background(), d.config.Timeout)
-	} else {
-		return context.Background(), func() {}
+		return context.WithTimeout(ctx, d.config.Timeout)
 	}
+	return ctx, func() {}
 }
 
 func (d *App) Status(opt StatusOption) error {
 	ctx, cancel := d.Start()
 	defer cancel()
-	_, err := d.DescribeServiceStatus(ctx, *opt.Events)
-	return err
+	sv, err := d.DescribeServiceStatus(ctx, *opt.Events)
+	if err != nil || !aws.BoolValue(opt.Metrics) {
+		return err
+	}
+	period := defaultMetricsPeriod
+	if opt.MetricsPeriod != nil {
+		period = *opt.MetricsPeriod
+	}
+	return errors.Wrap(
+		d.describeContainerInsights(ctx, os.Stdout, sv, period),
+		"failed to describe Container Insights metrics",
+	)
 }
 
-func (d *App) Delete(opt DeleteOption) error {
+func (d *App) Delete(opt DeleteOption) (err error) {
 	ctx, cancel := d.Start()
 	defer cancel()
 
+	if !*opt.DryRun {
+		audit := d.startAudit(ctx, "delete", auditOption{})
+		defer func() { d.finishAudit(audit, err) }()
+	}
+
 	d.Log("Deleting service", opt.DryRunString())
 	sv, err := d.DescribeServiceStatus(ctx, 3)
 	if err != nil {
 		return err
 	}
 
+	var plan *cleanupPlan
+	if aws.BoolValue(opt.Cleanup) {
+		if plan, err = d.buildCleanupPlan(ctx, sv); err != nil {
+			return errors.Wrap(err, "failed to build cleanup plan")
+		}
+		d.logCleanupPlan(plan)
+	}
+
 	if *opt.DryRun {
+		if d.config.DeletionProtection && !*opt.Force {
+			d.Log("deletion protection is enabled. --force is required to delete the service")
+		}
+		if plan == nil && d.config.AutoScalingDefinitionPath != "" {
+			d.Log("scalable target", d.autoScalingResourceID(), "will be deregistered")
+		}
 		d.Log("DRY RUN OK")
 		return nil
 	}
 
-	if !*opt.Force {
+	if d.config.DeletionProtection {
+		if !*opt.Force {
+			return errors.New("deletion protection is enabled. use --force to delete the service")
+		}
+	}
+	if d.config.Interactive {
+		p := newChangePlan("delete")
+		p.add("delete the service %s", *sv.ServiceName)
+		if plan != nil && !plan.empty() {
+			p.add("delete associated resources listed above")
+		} else if plan == nil && d.config.AutoScalingDefinitionPath != "" {
+			p.add("deregister the scalable target %s", d.autoScalingResourceID())
+		}
+		if err := d.showPlan(p); err != nil {
+			return err
+		}
+	}
+	// the service name is required to be typed even in the interactive mode
+	if d.config.Interactive || (!d.config.DeletionProtection && !*opt.Force) {
 		service := prompter.Prompt(`Enter the service name to DELETE`, "")
 		if service != *sv.ServiceName {
 			d.Log("Aborted")
-			return errors.New("confirmation failed")
+			return errConfirmationFailed
+		}
+	}
+
+	if plan != nil {
+		if err := d.cleanupBeforeDelete(ctx, plan); err != nil {
+			return err
+		}
+	} else if d.config.AutoScalingDefinitionPath != "" {
+		if err := d.DeleteAutoScaling(ctx); err != nil {
+			return errors.Wrap(err, "failed to delete autoscaling")
 		}
 	}
 
@@ -340,6 +560,18 @@ func (d *App) Delete(opt DeleteOption) error {
 	}
 	d.Log("Service is deleted")
 
+	if len(d.config.ServiceDiscovery) > 0 || (plan != nil && len(plan.serviceDiscoveries) > 0) {
+		if err := d.waitServiceDiscoveryInstancesDeregistered(ctx, sv.ServiceRegistries); err != nil {
+			return errors.Wrap(err, "failed to wait for service discovery instances deregistered")
+		}
+	}
+
+	if plan != nil {
+		if err := d.cleanupAfterDelete(ctx, plan); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -360,6 +592,22 @@ func (d *App) Wait(opt WaitOption) error {
 	ctx, cancel := d.Start()
 	defer cancel()
 
+	if opt.Until != nil && len(*opt.Until) > 0 {
+		var conds []*waitCondition
+		for _, s := range *opt.Until {
+			c, err := parseWaitCondition(s)
+			if err != nil {
+				return err
+			}
+			conds = append(conds, c)
+		}
+		if err := d.waitUntil(ctx, conds); err != nil {
+			return err
+		}
+		d.Log("All conditions are satisfied. Completed!")
+		return nil
+	}
+
 	d.Log("Waiting for the service stable")
 
 	sv, err := d.DescribeServiceStatus(ctx, 0)
@@ -433,52 +681,86 @@ func (d *App) Name() string {
 }
 
 func (d *App) Log(v ...interface{}) {
-	args := []interface{}{d.Name()}
-	args = append(args, v...)
-	log.Println(args...)
+	d.log(logLevelInfo, v...)
 }
 
 func (d *App) DebugLog(v ...interface{}) {
 	if !d.Debug {
 		return
 	}
-	d.Log(v...)
+	d.log(logLevelDebug, v...)
 }
 
 func (d *App) LogJSON(v interface{}) {
-	fmt.Print(MarshalJSONString(v))
+	fmt.Print(MarshalJSONString(d.redactor.redact(v)))
 }
 
-func (d *App) WaitServiceStable(ctx context.Context, startedAt time.Time) error {
+func (d *App) WaitServiceStable(ctx context.Context, startedAt time.Time) (err error) {
+	ctx, span := d.startSpan(ctx, "wait service stable")
+	defer func() { endSpan(span, err) }()
+
 	d.Log("Waiting for service stable...(it will take a few minutes)")
+	ctx, cancelTimeout := d.withPhaseTimeout(ctx, phaseWait)
+	defer cancelTimeout()
 	waitCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	poller := newWaitPoller(d.config.Wait, startedAt)
+	progress := newWaitPoller(d.config.Wait, startedAt)
 	go func() {
-		tick := time.Tick(10 * time.Second)
 		var lines int
+		var lastEventAt time.Time
+		failedTasks := map[string]bool{}
 		for {
-			select {
-			case <-waitCtx.Done():
+			if err := progress.wait(waitCtx); err != nil {
 				return
-			case <-tick:
-				if isTerminal {
-					for i := 0; i < lines; i++ {
-						fmt.Print(aec.EraseLine(aec.EraseModes.All), aec.PreviousLine(1))
-					}
+			}
+			if isTerminal {
+				for i := 0; i < lines; i++ {
+					fmt.Print(aec.EraseLine(aec.EraseModes.All), aec.PreviousLine(1))
 				}
-				lines, _ = d.DescribeServiceDeployments(waitCtx, startedAt)
 			}
+			var eventAt time.Time
+			lines, eventAt, _ = d.describeServiceDeployments(waitCtx, startedAt)
+			if remaining, ok := remainingTime(waitCtx); ok {
+				d.Log(formatRemainingTime(phaseWait, remaining))
+				lines++
+			}
+			if eventAt.After(lastEventAt) {
+				if !lastEventAt.IsZero() {
+					// new service events. re-check the service stability immediately
+					poller.notify()
+				}
+				lastEventAt = eventAt
+			}
+			d.emitFailedTasks(waitCtx, startedAt, failedTasks)
 		}
 	}()
 
-	return d.ecs.WaitUntilServicesStableWithContext(
+	if err := d.ecs.WaitUntilServicesStableWithContext(
 		ctx, d.DescribeServicesInput(),
-		d.waiterOptions()...,
-	)
+		poller.waiterOptions(waitCtx, d.config.phaseTimeout(phaseWait))...,
+	); err != nil {
+		return d.phaseTimeoutError(ctx, phaseWait, err)
+	}
+	if err := d.waitDaemonCoverage(ctx, poller); err != nil {
+		return d.phaseTimeoutError(ctx, phaseWait, err)
+	}
+	d.emitEvent(LifecycleEvent{Type: EventSteadyState})
+	return nil
 }
 
-func (d *App) RegisterTaskDefinition(ctx context.Context, td *TaskDefinitionInput) (*TaskDefinition, error) {
+func (d *App) RegisterTaskDefinition(ctx context.Context, td *TaskDefinitionInput) (_ *TaskDefinition, err error) {
+	ctx, span := d.startSpan(ctx, "register task definition")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := d.withPhaseTimeout(ctx, phaseRegister)
+	defer cancel()
+	defer func() { err = d.phaseTimeoutError(ctx, phaseRegister, err) }()
+
+	d.warnPlaintextSecrets(td)
+	if err := d.checkImageTagPolicy(td); err != nil {
+		return nil, err
+	}
 	d.Log("Registering a new task definition...")
 	if len(td.Tags) == 0 {
 		td.Tags = nil // Tags can not be empty.
@@ -491,23 +773,28 @@ func (d *App) RegisterTaskDefinition(ctx context.Context, td *TaskDefinitionInpu
 		return nil, err
 	}
 	d.Log("Task definition is registered", taskDefinitionName(out.TaskDefinition))
+	d.emitEvent(LifecycleEvent{
+		Type:           EventTaskDefinitionRegistered,
+		TaskDefinition: taskDefinitionName(out.TaskDefinition),
+		Revision:       aws.Int64Value(out.TaskDefinition.Revision),
+	})
 	return out.TaskDefinition, nil
 }
 
 func (d *App) LoadTaskDefinition(path string) (*TaskDefinitionInput, error) {
-	src, err := d.readDefinitionFile(path)
+	src, err := d.readTaskDefinitionJSON(path)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to load task definition %s", path)
-	}
-	c := struct {
-		TaskDefinition json.RawMessage `json:"taskDefinition"`
-	}{}
-	dec := json.NewDecoder(bytes.NewReader(src))
-	if err := dec.Decode(&c); err != nil {
-		return nil, errors.Wrapf(err, "failed to load task definition %s", path)
+		return nil, err
 	}
-	if c.TaskDefinition != nil {
-		src = c.TaskDefinition
+	if path == d.config.TaskDefinitionPath {
+		if fragments := d.config.TaskDefinitionFragments; len(fragments) > 0 {
+			if src, err = d.mergeTaskDefinitionFragments(src, fragments); err != nil {
+				return nil, errors.Wrapf(err, "failed to merge task definition fragments into %s", path)
+			}
+		}
+		if src, err = d.overlayTaskDefinition(src); err != nil {
+			return nil, err
+		}
 	}
 	var td TaskDefinitionInput
 	if err := d.unmarshalJSON(src, &td, path); err != nil {
@@ -516,6 +803,9 @@ func (d *App) LoadTaskDefinition(path string) (*TaskDefinitionInput, error) {
 	if len(td.Tags) == 0 {
 		td.Tags = nil
 	}
+	if suffix := d.config.NameSuffix; suffix != "" && td.Family != nil {
+		td.Family = aws.String(withNameSuffix(*td.Family, suffix))
+	}
 	return &td, nil
 }
 
@@ -537,16 +827,21 @@ func (d *App) unmarshalJSON(src []byte, v interface{}, path string) error {
 	return nil
 }
 
-func (d *App) LoadServiceDefinition(path string) (*ecs.Service, error) {
+func (d *App) LoadServiceDefinition(path string) (*Service, error) {
 	if path == "" {
 		return nil, errors.New("service_definition is not defined")
 	}
 
-	sv := ecs.Service{}
+	sv := Service{}
 	src, err := d.readDefinitionFile(path)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to load service definition %s", path)
 	}
+	if path == d.config.ServiceDefinitionPath {
+		if src, err = d.overlayServiceDefinition(src); err != nil {
+			return nil, err
+		}
+	}
 	if err := d.unmarshalJSON(src, &sv, path); err != nil {
 		return nil, errors.Wrapf(err, "failed to load service definition %s", path)
 	}
@@ -570,10 +865,11 @@ func (d *App) GetLogInfo(task *ecs.Task, c *ecs.ContainerDefinition) (string, st
 	return logGroup, logStream
 }
 
-func (d *App) suspendAutoScaling(suspendState bool) error {
+func (d *App) suspendAutoScaling(ctx context.Context, suspendState bool) error {
 	resourceId := fmt.Sprintf("service/%s/%s", d.Cluster, d.Service)
 
-	out, err := d.autoScaling.DescribeScalableTargets(
+	out, err := d.autoScaling.DescribeScalableTargetsWithContext(
+		ctx,
 		&applicationautoscaling.DescribeScalableTargetsInput{
 			ResourceIds:       []*string{&resourceId},
 			ServiceNamespace:  aws.String("ecs"),
@@ -589,7 +885,8 @@ func (d *App) suspendAutoScaling(suspendState bool) error {
 	}
 	for _, target := range out.ScalableTargets {
 		d.Log(fmt.Sprintf("Register scalable target %s set suspend state to %t", *target.ResourceId, suspendState))
-		_, err := d.autoScaling.RegisterScalableTarget(
+		_, err := d.autoScaling.RegisterScalableTargetWithContext(
+			ctx,
 			&applicationautoscaling.RegisterScalableTargetInput{
 				ServiceNamespace:  target.ServiceNamespace,
 				ScalableDimension: target.ScalableDimension,
@@ -608,16 +905,22 @@ func (d *App) suspendAutoScaling(suspendState bool) error {
 	return nil
 }
 
-func (d *App) WaitForCodeDeploy(ctx context.Context, sv *ecs.Service) error {
-	dp, err := d.findDeploymentInfo()
+func (d *App) WaitForCodeDeploy(ctx context.Context, sv *ecs.Service) (err error) {
+	ctx, span := d.startSpan(ctx, "wait CodeDeploy deployment")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := d.withPhaseTimeout(ctx, phaseCodeDeploy)
+	defer cancel()
+	defer func() { err = d.phaseTimeoutError(ctx, phaseCodeDeploy, err) }()
+
+	dg, err := d.findDeploymentGroup(ctx)
 	if err != nil {
 		return err
 	}
 	out, err := d.codedeploy.ListDeploymentsWithContext(
 		ctx,
 		&codedeploy.ListDeploymentsInput{
-			ApplicationName:     dp.ApplicationName,
-			DeploymentGroupName: dp.DeploymentGroupName,
+			ApplicationName:     dg.ApplicationName,
+			DeploymentGroupName: dg.DeploymentGroupName,
 			IncludeOnlyStatuses: []*string{
 				aws.String("Created"),
 				aws.String("Queued"),
@@ -634,15 +937,32 @@ func (d *App) WaitForCodeDeploy(ctx context.Context, sv *ecs.Service) error {
 	}
 	dpID := out.Deployments[0]
 	d.Log("Waiting for a deployment successful ID: " + *dpID)
-	return d.codedeploy.WaitUntilDeploymentSuccessfulWithContext(
+	if d.config.TestTrafficValidation != nil {
+		if err := d.waitForCodeDeployWithValidation(ctx, dg, *dpID); err != nil {
+			if d.Interrupted() {
+				d.abortCodeDeployOnInterrupt(*dpID)
+			}
+			return err
+		}
+		d.emitEvent(LifecycleEvent{Type: EventSteadyState, DeploymentID: *dpID})
+		return nil
+	}
+	if err := d.codedeploy.WaitUntilDeploymentSuccessfulWithContext(
 		ctx,
 		&codedeploy.GetDeploymentInput{DeploymentId: dpID},
-		d.waiterOptions()...,
-	)
+		d.waiterOptions(ctx, d.config.phaseTimeout(phaseCodeDeploy), &remainingReporter{d: d, phase: phaseCodeDeploy})...,
+	); err != nil {
+		if d.Interrupted() {
+			d.abortCodeDeployOnInterrupt(*dpID)
+		}
+		return err
+	}
+	d.emitEvent(LifecycleEvent{Type: EventSteadyState, DeploymentID: *dpID})
+	return nil
 }
 
 func (d *App) RollbackByCodeDeploy(ctx context.Context, sv *ecs.Service, tdArn string, opt RollbackOption) error {
-	dp, err := d.findDeploymentInfo()
+	dp, err := d.findDeploymentInfo(ctx)
 	if err != nil {
 		return err
 	}
@@ -694,14 +1014,20 @@ func (d *App) RollbackByCodeDeploy(ctx context.Context, sv *ecs.Service, tdArn s
 // SDK Default is 10 min (MaxAttempts=40 * Delay=15sec) at now.
 // ref. https://github.com/aws/aws-sdk-go/blob/d57c8d96f72d9475194ccf18d2ba70ac294b0cb3/service/ecs/waiters.go#L82-L83
 // Explicitly set these options so not being affected by the default setting.
-func (d *App) waiterOptions() []request.WaiterOption {
+// The reporter logs the remaining time of the context between attempts.
+func (d *App) waiterOptions(ctx context.Context, timeout time.Duration, r *remainingReporter) []request.WaiterOption {
 	const delay = 15 * time.Second
-	attempts := int((d.config.Timeout / delay)) + 1
-	if (d.config.Timeout % delay) > 0 {
+	attempts := int((timeout / delay)) + 1
+	if (timeout % delay) > 0 {
 		attempts++
 	}
 	return []request.WaiterOption{
-		request.WithWaiterDelay(request.ConstantWaiterDelay(delay)),
+		request.WithWaiterDelay(func(int) time.Duration {
+			if r != nil {
+				r.report(ctx)
+			}
+			return delay
+		}),
 		request.WithWaiterMaxAttempts(attempts),
 	}
 }
@@ -0,0 +1,217 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/pkg/errors"
+)
+
+// taskENI represents the elastic network interface attached to the awsvpc task.
+type taskENI struct {
+	taskID           string
+	lastStatus       string
+	id               string
+	privateIP        string
+	publicIP         string
+	subnetID         string
+	availabilityZone string
+}
+
+func (e taskENI) String() string {
+	public := ""
+	if e.publicIP != "" {
+		public = " public:" + e.publicIP
+	}
+	return fmt.Sprintf(
+		"%s %s %s private:%s%s %s %s",
+		e.taskID, e.lastStatus, e.id, e.privateIP, public, e.subnetID, e.availabilityZone,
+	)
+}
+
+// eniOfTask returns the ENI in the attachments of the task. It returns false for non-awsvpc tasks.
+func eniOfTask(task *ecs.Task) (taskENI, bool) {
+	for _, a := range task.Attachments {
+		if aws.StringValue(a.Type) != "ElasticNetworkInterface" {
+			continue
+		}
+		e := taskENI{
+			taskID:           arnToName(aws.StringValue(task.TaskArn)),
+			lastStatus:       aws.StringValue(task.LastStatus),
+			availabilityZone: aws.StringValue(task.AvailabilityZone),
+		}
+		for _, kv := range a.Details {
+			switch aws.StringValue(kv.Name) {
+			case "networkInterfaceId":
+				e.id = aws.StringValue(kv.Value)
+			case "privateIPv4Address":
+				e.privateIP = aws.StringValue(kv.Value)
+			case "subnetId":
+				e.subnetID = aws.StringValue(kv.Value)
+			}
+		}
+		return e, e.id != ""
+	}
+	return taskENI{}, false
+}
+
+// describeNetworkEndpoints describes ENIs of running awsvpc tasks and listeners of load balancers of the service.
+func (d *App) describeNetworkEndpoints(ctx context.Context, w io.Writer, s *ecs.Service) error {
+	if s.NetworkConfiguration == nil || s.NetworkConfiguration.AwsvpcConfiguration == nil {
+		return nil
+	}
+	// the endpoints are optional for the status, so denied permissions are warned
+	enis, err := d.serviceTaskENIs(ctx, s)
+	if ExitCodeOf(err) == ExitCodePermissionDenied {
+		d.Log("WARNING: unable to describe ENIs of tasks.", err)
+	} else if err != nil {
+		return err
+	}
+	endpoints, err := d.loadBalancerEndpoints(ctx, s)
+	if ExitCodeOf(err) == ExitCodePermissionDenied {
+		d.Log("WARNING: unable to describe load balancers of the service.", err)
+	} else if err != nil {
+		return err
+	}
+	if len(enis) > 0 {
+		fmt.Fprintln(w, "Tasks:")
+		for _, e := range enis {
+			fmt.Fprintln(w, spcIndent+e.String())
+		}
+	}
+	if len(endpoints) > 0 {
+		fmt.Fprintln(w, "LoadBalancers:")
+		for _, ep := range endpoints {
+			fmt.Fprintln(w, spcIndent+ep)
+		}
+	}
+	return nil
+}
+
+func (d *App) serviceTaskENIs(ctx context.Context, s *ecs.Service) ([]taskENI, error) {
+	var arns []*string
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListTasksWithContext(ctx, &ecs.ListTasksInput{
+			Cluster:       s.ClusterArn,
+			ServiceName:   s.ServiceName,
+			DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+			NextToken:     nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list tasks")
+		}
+		arns = append(arns, out.TaskArns...)
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+	if len(arns) == 0 {
+		return nil, nil
+	}
+
+	var enis []taskENI
+	err := d.describeTasksInBatches(ctx, arns, func(task *ecs.Task) {
+		if e, ok := eniOfTask(task); ok {
+			enis = append(enis, e)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(enis) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]*string, 0, len(enis))
+	for _, e := range enis {
+		ids = append(ids, aws.String(e.id))
+	}
+	publicIPs := map[string]string{}
+	err = d.ec2.DescribeNetworkInterfacesPagesWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: ids,
+	}, func(out *ec2.DescribeNetworkInterfacesOutput, _ bool) bool {
+		for _, ni := range out.NetworkInterfaces {
+			if ni.Association != nil && ni.Association.PublicIp != nil {
+				publicIPs[aws.StringValue(ni.NetworkInterfaceId)] = aws.StringValue(ni.Association.PublicIp)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "UnauthorizedOperation" {
+			d.DebugLog("unable to describe network interfaces. requires IAM for ec2:DescribeNetworkInterfaces to display public IPs.")
+			return enis, nil
+		}
+		return nil, errors.Wrap(err, "failed to describe network interfaces")
+	}
+	for i := range enis {
+		enis[i].publicIP = publicIPs[enis[i].id]
+	}
+	return enis, nil
+}
+
+// loadBalancerEndpoints returns endpoints of listeners of load balancers attached to target groups of the service.
+func (d *App) loadBalancerEndpoints(ctx context.Context, s *ecs.Service) ([]string, error) {
+	var tgArns []*string
+	for _, lb := range s.LoadBalancers {
+		if lb.TargetGroupArn != nil {
+			tgArns = append(tgArns, lb.TargetGroupArn)
+		}
+	}
+	if len(tgArns) == 0 {
+		return nil, nil
+	}
+	tgs, err := d.elbv2.DescribeTargetGroupsWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: tgArns,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe target groups")
+	}
+	var lbArns []*string
+	seen := map[string]bool{}
+	for _, tg := range tgs.TargetGroups {
+		for _, arn := range tg.LoadBalancerArns {
+			if !seen[aws.StringValue(arn)] {
+				seen[aws.StringValue(arn)] = true
+				lbArns = append(lbArns, arn)
+			}
+		}
+	}
+	if len(lbArns) == 0 {
+		return nil, nil
+	}
+	lbs, err := d.elbv2.DescribeLoadBalancersWithContext(ctx, &elbv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: lbArns,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe load balancers")
+	}
+
+	var endpoints []string
+	for _, lb := range lbs.LoadBalancers {
+		dns := aws.StringValue(lb.DNSName)
+		ls, err := d.elbv2.DescribeListenersWithContext(ctx, &elbv2.DescribeListenersInput{
+			LoadBalancerArn: lb.LoadBalancerArn,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to describe listeners of %s", aws.StringValue(lb.LoadBalancerName))
+		}
+		var urls []string
+		for _, l := range ls.Listeners {
+			urls = append(urls, fmt.Sprintf("%s://%s:%d", strings.ToLower(aws.StringValue(l.Protocol)), dns, aws.Int64Value(l.Port)))
+		}
+		endpoints = append(endpoints, fmt.Sprintf("%s %s %s", aws.StringValue(lb.LoadBalancerName), aws.StringValue(lb.Scheme), dns))
+		for _, u := range urls {
+			endpoints = append(endpoints, spcIndent+u)
+		}
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,168 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso"
+)
+
+type fakeEndpointsECS struct {
+	ecsiface.ECSAPI
+}
+
+func (f *fakeEndpointsECS) ListTasksWithContext(_ aws.Context, _ *ecs.ListTasksInput, _ ...request.Option) (*ecs.ListTasksOutput, error) {
+	return &ecs.ListTasksOutput{TaskArns: aws.StringSlice([]string{"task1", "task2"})}, nil
+}
+
+func (f *fakeEndpointsECS) DescribeTasksWithContext(_ aws.Context, in *ecs.DescribeTasksInput, _ ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	out := &ecs.DescribeTasksOutput{}
+	for i, id := range aws.StringValueSlice(in.Tasks) {
+		n := []string{"1", "2"}[i]
+		out.Tasks = append(out.Tasks, &ecs.Task{
+			TaskArn:          aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/default/" + id),
+			LastStatus:       aws.String("RUNNING"),
+			AvailabilityZone: aws.String("ap-northeast-1" + []string{"a", "c"}[i]),
+			Attachments: []*ecs.Attachment{{
+				Type: aws.String("ElasticNetworkInterface"),
+				Details: []*ecs.KeyValuePair{
+					{Name: aws.String("subnetId"), Value: aws.String("subnet-" + n)},
+					{Name: aws.String("networkInterfaceId"), Value: aws.String("eni-" + n)},
+					{Name: aws.String("privateIPv4Address"), Value: aws.String("10.0.0." + n)},
+				},
+			}},
+		})
+	}
+	return out, nil
+}
+
+type fakeEndpointsEC2 struct {
+	ec2iface.EC2API
+}
+
+func (f *fakeEndpointsEC2) DescribeNetworkInterfacesPagesWithContext(_ aws.Context, _ *ec2.DescribeNetworkInterfacesInput, fn func(*ec2.DescribeNetworkInterfacesOutput, bool) bool, _ ...request.Option) error {
+	fn(&ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []*ec2.NetworkInterface{
+		{NetworkInterfaceId: aws.String("eni-1"), Association: &ec2.NetworkInterfaceAssociation{PublicIp: aws.String("203.0.113.1")}},
+		{NetworkInterfaceId: aws.String("eni-2")},
+	}}, true)
+	return nil
+}
+
+type fakeEndpointsELBv2 struct {
+	fakeAppSpecELBv2
+}
+
+func (f *fakeEndpointsELBv2) DescribeLoadBalancersWithContext(_ aws.Context, _ *elbv2.DescribeLoadBalancersInput, _ ...request.Option) (*elbv2.DescribeLoadBalancersOutput, error) {
+	return &elbv2.DescribeLoadBalancersOutput{LoadBalancers: []*elbv2.LoadBalancer{{
+		LoadBalancerArn:  aws.String(testLBArn),
+		LoadBalancerName: aws.String("web"),
+		Scheme:           aws.String("internet-facing"),
+		DNSName:          aws.String("web.example.com"),
+	}}}, nil
+}
+
+func (f *fakeEndpointsELBv2) DescribeListenersWithContext(_ aws.Context, _ *elbv2.DescribeListenersInput, _ ...request.Option) (*elbv2.DescribeListenersOutput, error) {
+	return &elbv2.DescribeListenersOutput{Listeners: []*elbv2.Listener{
+		{Protocol: aws.String("HTTPS"), Port: aws.Int64(443)},
+		{Protocol: aws.String("HTTP"), Port: aws.Int64(80)},
+	}}, nil
+}
+
+func TestDescribeNetworkEndpoints(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:   &fakeEndpointsECS{},
+		EC2:   &fakeEndpointsEC2{},
+		ELBv2: &fakeEndpointsELBv2{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := &ecs.Service{
+		ServiceName: aws.String("test"),
+		ClusterArn:  aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default"),
+		NetworkConfiguration: &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{},
+		},
+		LoadBalancers: []*ecs.LoadBalancer{
+			{TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:ap-northeast-1:123456789012:targetgroup/web")},
+		},
+	}
+	var buf bytes.Buffer
+	if err := app.DescribeNetworkEndpoints(context.Background(), &buf, sv); err != nil {
+		t.Fatal(err)
+	}
+	expected := `Tasks:
+  task1 RUNNING eni-1 private:10.0.0.1 public:203.0.113.1 subnet-1 ap-northeast-1a
+  task2 RUNNING eni-2 private:10.0.0.2 subnet-2 ap-northeast-1c
+LoadBalancers:
+  web internet-facing web.example.com
+    https://web.example.com:443
+    http://web.example.com:80
+`
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("unexpected output: %s", diff)
+	}
+
+	buf.Reset()
+	sv.NetworkConfiguration = nil
+	if err := app.DescribeNetworkEndpoints(context.Background(), &buf, sv); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected output for non-awsvpc service: %s", buf.String())
+	}
+}
+
+type fakeDeniedELBv2 struct {
+	fakeEndpointsELBv2
+}
+
+func (f *fakeDeniedELBv2) DescribeTargetGroupsWithContext(_ aws.Context, _ *elbv2.DescribeTargetGroupsInput, _ ...request.Option) (*elbv2.DescribeTargetGroupsOutput, error) {
+	return nil, awserr.New("AccessDenied", "not authorized to perform: elasticloadbalancing:DescribeTargetGroups", nil)
+}
+
+func TestDescribeNetworkEndpointsAccessDenied(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:   &fakeEndpointsECS{},
+		EC2:   &fakeEndpointsEC2{},
+		ELBv2: &fakeDeniedELBv2{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := &ecs.Service{
+		ServiceName: aws.String("test"),
+		ClusterArn:  aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default"),
+		NetworkConfiguration: &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{},
+		},
+		LoadBalancers: []*ecs.LoadBalancer{
+			{TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:ap-northeast-1:123456789012:targetgroup/web")},
+		},
+	}
+	var buf bytes.Buffer
+	if err := app.DescribeNetworkEndpoints(context.Background(), &buf, sv); err != nil {
+		t.Fatalf("denied load balancers must be warned: %s", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("Tasks:")) || bytes.Contains(buf.Bytes(), []byte("LoadBalancers:")) {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
@@ -0,0 +1,127 @@
+package ecspresso
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// EnvironmentConfig represents a configuration which overrides the base configuration for the environment.
+type EnvironmentConfig struct {
+	Region     string            `yaml:"region,omitempty"`
+	Cluster    string            `yaml:"cluster,omitempty"`
+	Service    string            `yaml:"service,omitempty"`
+	Plugins    []ConfigPlugin    `yaml:"plugins,omitempty"`
+	Vars       map[string]string `yaml:"vars,omitempty"`
+	NameSuffix string            `yaml:"name_suffix,omitempty"`
+	// Interactive overrides the interactive mode for the environment.
+	Interactive *bool `yaml:"interactive,omitempty"`
+	// Overlay is the directory which contains patch files for the definitions.
+	Overlay string `yaml:"overlay,omitempty"`
+}
+
+// applyEnvironment overrides the configuration by the selected environment.
+func (c *Config) applyEnvironment() error {
+	if c.Environment == "" {
+		return nil
+	}
+	env, ok := c.Environments[c.Environment]
+	if !ok || env == nil {
+		return errors.Errorf("environment %s is not defined in environments. available: %s", c.Environment, c.environmentNames())
+	}
+	if env.Region != "" {
+		c.Region = env.Region
+	}
+	if env.Cluster != "" {
+		c.Cluster = env.Cluster
+	}
+	if env.Service != "" {
+		c.Service = env.Service
+	}
+	if env.Plugins != nil {
+		c.Plugins = env.Plugins
+	}
+	if env.NameSuffix != "" {
+		c.NameSuffix = env.NameSuffix
+	}
+	if env.Interactive != nil {
+		c.Interactive = *env.Interactive
+	}
+	if env.Overlay != "" {
+		c.overlayDir = env.Overlay
+	}
+	if len(env.Vars) > 0 {
+		vars := make(map[string]string, len(c.Vars)+len(env.Vars))
+		for k, v := range c.Vars {
+			vars[k] = v
+		}
+		for k, v := range env.Vars {
+			vars[k] = v
+		}
+		c.Vars = vars
+	}
+	return nil
+}
+
+// SetVars sets variables given by the command line (--var). They take precedence over vars in the configuration file.
+func (c *Config) SetVars(vars map[string]string) {
+	if len(vars) == 0 {
+		return
+	}
+	merged := make(map[string]string, len(c.Vars)+len(vars))
+	for k, v := range c.Vars {
+		merged[k] = v
+	}
+	for k, v := range vars {
+		merged[k] = v
+	}
+	c.Vars = merged
+}
+
+func (c *Config) environmentNames() string {
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// varsFuncMap returns template functions to refer the variables in definition files.
+func (c *Config) varsFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"var": func(name string) (string, error) {
+			v, ok := c.Vars[name]
+			if !ok {
+				return "", errors.Errorf("var %s is not defined", name)
+			}
+			return v, nil
+		},
+		"name_suffix": func() string {
+			return c.NameSuffix
+		},
+	}
+}
+
+// withNameSuffix appends the suffix to the name unless the name already has it.
+func withNameSuffix(name, suffix string) string {
+	if strings.HasSuffix(name, suffix) {
+		return name
+	}
+	return name + suffix
+}
+
+// applyOverrides overrides the configuration by the values specified for the invocation.
+func (c *Config) applyOverrides() {
+	if c.RegionOverride != "" {
+		c.Region = c.RegionOverride
+	}
+	if c.ClusterOverride != "" {
+		c.Cluster = c.ClusterOverride
+	}
+	if c.ServiceOverride != "" {
+		c.Service = c.ServiceOverride
+	}
+}
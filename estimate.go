@@ -0,0 +1,208 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+// hoursPerMonth is the number of hours in a month used by AWS pricing.
+const hoursPerMonth = 730
+
+// freeEphemeralStorageGB is the size of the ephemeral storage of Fargate tasks included in the price.
+const freeEphemeralStorageGB = 20
+
+// CostConfig represents unit prices (USD) to estimate costs of tasks.
+// Zero values are replaced by the defaults (Fargate Linux on-demand in us-east-1).
+type CostConfig struct {
+	VCPUPerHour               float64 `yaml:"vcpu_per_hour,omitempty"`
+	GBPerHour                 float64 `yaml:"gb_per_hour,omitempty"`
+	ARMVCPUPerHour            float64 `yaml:"arm_vcpu_per_hour,omitempty"`
+	ARMGBPerHour              float64 `yaml:"arm_gb_per_hour,omitempty"`
+	EphemeralStorageGBPerHour float64 `yaml:"ephemeral_storage_gb_per_hour,omitempty"`
+	EBSGBPerMonth             float64 `yaml:"ebs_gb_per_month,omitempty"`
+}
+
+var defaultCostConfig = CostConfig{
+	VCPUPerHour:               0.04048,
+	GBPerHour:                 0.004445,
+	ARMVCPUPerHour:            0.03238,
+	ARMGBPerHour:              0.00356,
+	EphemeralStorageGBPerHour: 0.000111,
+	EBSGBPerMonth:             0.08,
+}
+
+func (c *CostConfig) withDefaults() CostConfig {
+	r := defaultCostConfig
+	if c == nil {
+		return r
+	}
+	for _, p := range []struct{ dst, src *float64 }{
+		{&r.VCPUPerHour, &c.VCPUPerHour},
+		{&r.GBPerHour, &c.GBPerHour},
+		{&r.ARMVCPUPerHour, &c.ARMVCPUPerHour},
+		{&r.ARMGBPerHour, &c.ARMGBPerHour},
+		{&r.EphemeralStorageGBPerHour, &c.EphemeralStorageGBPerHour},
+		{&r.EBSGBPerMonth, &c.EBSGBPerMonth},
+	} {
+		if *p.src > 0 {
+			*p.dst = *p.src
+		}
+	}
+	return r
+}
+
+type EstimateOption struct {
+	DesiredCount *int64
+}
+
+// costEstimate represents an estimated monthly cost of tasks of the service.
+type costEstimate struct {
+	Count       int64
+	VCPU        float64
+	MemoryGB    float64
+	EphemeralGB float64
+	EBSGB       float64
+	ARM         bool
+	Monthly     float64
+}
+
+// estimateCost estimates the monthly cost of count tasks of the task definition.
+// volumes are EBS volumes attached to each task by the service.
+func estimateCost(td *TaskDefinitionInput, volumes []*ecs.ServiceVolumeConfiguration, count int64, c CostConfig) (*costEstimate, error) {
+	cpu, err := strconv.ParseFloat(aws.StringValue(toNumberCPU(aws.StringValue(td.Cpu))), 64)
+	if err != nil {
+		return nil, errors.Errorf("task level cpu is required to estimate cost: %q", aws.StringValue(td.Cpu))
+	}
+	mem, err := strconv.ParseFloat(aws.StringValue(toNumberMemory(aws.StringValue(td.Memory))), 64)
+	if err != nil {
+		return nil, errors.Errorf("task level memory is required to estimate cost: %q", aws.StringValue(td.Memory))
+	}
+	e := &costEstimate{
+		Count:    count,
+		VCPU:     cpu / 1024,
+		MemoryGB: mem / 1024,
+	}
+	if rp := td.RuntimePlatform; rp != nil && aws.StringValue(rp.CpuArchitecture) == ecs.CPUArchitectureArm64 {
+		e.ARM = true
+	}
+	if es := td.EphemeralStorage; es != nil {
+		e.EphemeralGB = float64(aws.Int64Value(es.SizeInGiB))
+	}
+	for _, v := range volumes {
+		if v.ManagedEBSVolume != nil {
+			e.EBSGB += float64(aws.Int64Value(v.ManagedEBSVolume.SizeInGiB))
+		}
+	}
+
+	vcpuPrice, gbPrice := c.VCPUPerHour, c.GBPerHour
+	if e.ARM {
+		vcpuPrice, gbPrice = c.ARMVCPUPerHour, c.ARMGBPerHour
+	}
+	perHour := e.VCPU*vcpuPrice + e.MemoryGB*gbPrice
+	if e.EphemeralGB > freeEphemeralStorageGB {
+		perHour += (e.EphemeralGB - freeEphemeralStorageGB) * c.EphemeralStorageGBPerHour
+	}
+	perTask := perHour*hoursPerMonth + e.EBSGB*c.EBSGBPerMonth
+	e.Monthly = perTask * float64(count)
+	return e, nil
+}
+
+func printCostEstimates(current, next *costEstimate) {
+	fmt.Println("Estimated monthly cost (USD, Fargate on-demand):")
+	t := tablewriter.NewWriter(os.Stdout)
+	t.SetHeader([]string{"", "Current", "New", "Delta"})
+	t.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	row := func(name string, c, n float64, format string) {
+		t.Append([]string{name, fmt.Sprintf(format, c), fmt.Sprintf(format, n), fmt.Sprintf("%+"+format[1:], n-c)})
+	}
+	row("Tasks", float64(current.Count), float64(next.Count), "%.0f")
+	row("vCPU/task", current.VCPU, next.VCPU, "%.2f")
+	row("Memory GB/task", current.MemoryGB, next.MemoryGB, "%.2f")
+	row("Ephemeral GB/task", current.EphemeralGB, next.EphemeralGB, "%.0f")
+	row("EBS GB/task", current.EBSGB, next.EBSGB, "%.0f")
+	row("Monthly", current.Monthly, next.Monthly, "%.2f")
+	t.Render()
+}
+
+// Estimate shows the approximate monthly cost delta of the rendered definitions compared to the running service.
+func (d *App) Estimate(opt EstimateOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to load task definition")
+	}
+	var newSv *Service
+	if d.config.ServiceDefinitionPath != "" {
+		if newSv, err = d.LoadServiceDefinition(d.config.ServiceDefinitionPath); err != nil {
+			return errors.Wrap(err, "failed to load service definition")
+		}
+	}
+	var count *int64
+	if opt.DesiredCount != nil && *opt.DesiredCount != DefaultDesiredCount {
+		count = opt.DesiredCount
+	} else if newSv != nil {
+		count = newSv.DesiredCount
+	}
+	return d.estimateDeployCost(ctx, td, newSv, count)
+}
+
+// estimateDeployCost prints the estimated cost of the service deployed with the definitions.
+// Nil arguments mean that they are not changed from the running service.
+func (d *App) estimateDeployCost(ctx context.Context, td *TaskDefinitionInput, newSv *Service, count *int64) error {
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return err
+	}
+	currentTd, err := d.DescribeTaskDefinition(ctx, aws.StringValue(sv.TaskDefinition))
+	if err != nil {
+		return errors.Wrap(err, "failed to describe task definition")
+	}
+	if td == nil {
+		td = currentTd
+	}
+	currentVolumes := newServiceFromRemote(sv).VolumeConfigurations
+	volumes := currentVolumes
+	if newSv != nil {
+		volumes = newSv.VolumeConfigurations
+	}
+	if count == nil {
+		count = sv.DesiredCount
+	}
+	if !isFargateService(sv) {
+		d.Log("WARNING: the service does not run on Fargate. costs of EC2 instances are not estimated")
+	}
+
+	prices := d.config.Cost.withDefaults()
+	current, err := estimateCost(currentTd, currentVolumes, aws.Int64Value(sv.DesiredCount), prices)
+	if err != nil {
+		return errors.Wrap(err, "failed to estimate current cost")
+	}
+	next, err := estimateCost(td, volumes, aws.Int64Value(count), prices)
+	if err != nil {
+		return errors.Wrap(err, "failed to estimate new cost")
+	}
+	printCostEstimates(current, next)
+	return nil
+}
+
+func isFargateService(sv *ecs.Service) bool {
+	if aws.StringValue(sv.LaunchType) == ecs.LaunchTypeFargate {
+		return true
+	}
+	for _, s := range sv.CapacityProviderStrategy {
+		switch aws.StringValue(s.CapacityProvider) {
+		case "FARGATE", "FARGATE_SPOT":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package ecspresso_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestEstimateCost(t *testing.T) {
+	prices := ecspresso.CostConfig{
+		VCPUPerHour:               0.04,
+		GBPerHour:                 0.004,
+		ARMVCPUPerHour:            0.03,
+		ARMGBPerHour:              0.003,
+		EphemeralStorageGBPerHour: 0.0001,
+		EBSGBPerMonth:             0.1,
+	}
+	testCases := []struct {
+		name    string
+		td      *ecspresso.TaskDefinitionInput
+		volumes []*ecs.ServiceVolumeConfiguration
+		count   int64
+		monthly float64
+	}{
+		{
+			name:    "x86",
+			td:      &ecspresso.TaskDefinitionInput{Cpu: aws.String("1024"), Memory: aws.String("2048")},
+			count:   2,
+			monthly: (0.04 + 2*0.004) * 730 * 2,
+		},
+		{
+			name:    "vCPU and GB units",
+			td:      &ecspresso.TaskDefinitionInput{Cpu: aws.String(".5 vCPU"), Memory: aws.String("1GB")},
+			count:   1,
+			monthly: (0.5*0.04 + 0.004) * 730,
+		},
+		{
+			name: "arm with storages",
+			td: &ecspresso.TaskDefinitionInput{
+				Cpu:              aws.String("256"),
+				Memory:           aws.String("512"),
+				RuntimePlatform:  &ecs.RuntimePlatform{CpuArchitecture: aws.String("ARM64")},
+				EphemeralStorage: &ecs.EphemeralStorage{SizeInGiB: aws.Int64(30)},
+			},
+			volumes: []*ecs.ServiceVolumeConfiguration{
+				{ManagedEBSVolume: &ecs.ServiceManagedEBSVolumeConfiguration{SizeInGiB: aws.Int64(100)}},
+			},
+			count:   3,
+			monthly: ((0.25*0.03+0.5*0.003+10*0.0001)*730 + 100*0.1) * 3,
+		},
+		{
+			name:    "zero tasks",
+			td:      &ecspresso.TaskDefinitionInput{Cpu: aws.String("1024"), Memory: aws.String("2048")},
+			count:   0,
+			monthly: 0,
+		},
+	}
+	for _, tc := range testCases {
+		e, err := ecspresso.EstimateCost(tc.td, tc.volumes, tc.count, prices)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tc.name, err)
+			continue
+		}
+		if math.Abs(e.Monthly-tc.monthly) > 1e-9 {
+			t.Errorf("%s: unexpected monthly cost %f expected %f", tc.name, e.Monthly, tc.monthly)
+		}
+	}
+
+	if _, err := ecspresso.EstimateCost(&ecspresso.TaskDefinitionInput{Memory: aws.String("512")}, nil, 1, prices); err == nil {
+		t.Error("task definition without cpu must be an error")
+	}
+}
+
+func TestCostConfigWithDefaults(t *testing.T) {
+	c := ecspresso.CostConfigWithDefaults(&ecspresso.CostConfig{VCPUPerHour: 0.05})
+	if c.VCPUPerHour != 0.05 {
+		t.Errorf("unexpected vcpu price %f", c.VCPUPerHour)
+	}
+	if c.GBPerHour != ecspresso.DefaultCostConfig.GBPerHour {
+		t.Errorf("unexpected gb price %f", c.GBPerHour)
+	}
+	if d := ecspresso.CostConfigWithDefaults(nil); d != ecspresso.DefaultCostConfig {
+		t.Errorf("unexpected defaults %#v", d)
+	}
+}
@@ -0,0 +1,135 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// LifecycleEventType represents a type of the lifecycle event.
+type LifecycleEventType string
+
+// Types of lifecycle events.
+const (
+	EventTaskDefinitionRendered    LifecycleEventType = "task_definition_rendered"
+	EventServiceDefinitionRendered LifecycleEventType = "service_definition_rendered"
+	EventTaskDefinitionRegistered  LifecycleEventType = "task_definition_registered"
+	EventDeploymentStarted         LifecycleEventType = "deployment_started"
+	EventTaskFailed                LifecycleEventType = "task_failed"
+	EventSteadyState               LifecycleEventType = "steady_state"
+)
+
+// LifecycleEvent represents an event in deployments for library embedders.
+type LifecycleEvent struct {
+	Type    LifecycleEventType
+	Time    time.Time
+	Cluster string
+	Service string
+
+	// TaskDefinition is a family:revision of the task definition related with the event.
+	TaskDefinition string
+	// Revision is a revision of the registered task definition.
+	Revision int64
+	// DeploymentID is an ID of the CodeDeploy deployment.
+	DeploymentID string
+	// TaskArn and Reason are set for EventTaskFailed.
+	TaskArn string
+	Reason  string
+
+	// Definition is the rendered TaskDefinitionInput or *Service.
+	Definition interface{}
+}
+
+// LifecycleEventHandler is called synchronously on lifecycle events. It must return quickly.
+type LifecycleEventHandler func(LifecycleEvent)
+
+// OnEvent registers the handler of lifecycle events.
+func (d *App) OnEvent(h LifecycleEventHandler) {
+	d.eventHandlers = append(d.eventHandlers, h)
+}
+
+// Events returns a channel that receives lifecycle events.
+// Events are dropped when the buffer of the channel is full not to block deployments.
+func (d *App) Events(size int) <-chan LifecycleEvent {
+	ch := make(chan LifecycleEvent, size)
+	d.OnEvent(func(ev LifecycleEvent) {
+		select {
+		case ch <- ev:
+		default:
+			d.DebugLog("lifecycle event is dropped", ev.Type)
+		}
+	})
+	return ch
+}
+
+func (d *App) emitEvent(ev LifecycleEvent) {
+	if len(d.eventHandlers) == 0 {
+		return
+	}
+	ev.Time = time.Now()
+	ev.Cluster = d.Cluster
+	ev.Service = d.Service
+	for _, h := range d.eventHandlers {
+		h(ev)
+	}
+}
+
+// emitFailedTasks emits EventTaskFailed for tasks of the service stopped after startedAt.
+// Tasks in seen are already emitted.
+func (d *App) emitFailedTasks(ctx context.Context, startedAt time.Time, seen map[string]bool) {
+	if len(d.eventHandlers) == 0 {
+		return
+	}
+	out, err := d.ecs.ListTasksWithContext(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(d.Cluster),
+		ServiceName:   aws.String(d.Service),
+		DesiredStatus: aws.String(ecs.DesiredStatusStopped),
+	})
+	if err != nil || len(out.TaskArns) == 0 {
+		return
+	}
+	tasks, err := d.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(d.Cluster),
+		Tasks:   out.TaskArns,
+	})
+	if err != nil {
+		return
+	}
+	for _, task := range tasks.Tasks {
+		arn := aws.StringValue(task.TaskArn)
+		if seen[arn] || task.StoppedAt == nil || task.StoppedAt.Before(startedAt) {
+			continue
+		}
+		reason, failed := taskFailure(task)
+		if !failed {
+			continue
+		}
+		seen[arn] = true
+		d.emitEvent(LifecycleEvent{
+			Type:           EventTaskFailed,
+			TaskDefinition: arnToName(aws.StringValue(task.TaskDefinitionArn)),
+			TaskArn:        arn,
+			Reason:         reason,
+		})
+	}
+}
+
+// taskFailure reports whether the stopped task was failed, and the reason.
+func taskFailure(task *ecs.Task) (string, bool) {
+	if aws.StringValue(task.StopCode) == ecs.TaskStopCodeTaskFailedToStart {
+		return aws.StringValue(task.StoppedReason), true
+	}
+	for _, c := range task.Containers {
+		if c.ExitCode != nil && *c.ExitCode != 0 {
+			return fmt.Sprintf("container %s exited with code %d: %s",
+				aws.StringValue(c.Name), *c.ExitCode, aws.StringValue(task.StoppedReason)), true
+		}
+	}
+	if aws.StringValue(task.StopCode) == ecs.TaskStopCodeEssentialContainerExited {
+		return aws.StringValue(task.StoppedReason), true
+	}
+	return "", false
+}
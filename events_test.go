@@ -0,0 +1,88 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestTaskFailure(t *testing.T) {
+	testCases := []struct {
+		task   *ecs.Task
+		failed bool
+	}{
+		{
+			task: &ecs.Task{
+				StopCode:      aws.String(ecs.TaskStopCodeTaskFailedToStart),
+				StoppedReason: aws.String("CannotPullContainerError"),
+			},
+			failed: true,
+		},
+		{
+			task: &ecs.Task{
+				StopCode:      aws.String(ecs.TaskStopCodeEssentialContainerExited),
+				StoppedReason: aws.String("Essential container in task exited"),
+				Containers: []*ecs.Container{
+					{Name: aws.String("app"), ExitCode: aws.Int64(1)},
+				},
+			},
+			failed: true,
+		},
+		{
+			task: &ecs.Task{
+				StopCode:      aws.String(ecs.TaskStopCodeServiceSchedulerInitiated),
+				StoppedReason: aws.String("Scaling activity initiated by deployment"),
+				Containers: []*ecs.Container{
+					{Name: aws.String("app"), ExitCode: aws.Int64(0)},
+				},
+			},
+			failed: false,
+		},
+	}
+	for _, tc := range testCases {
+		reason, failed := ecspresso.TaskFailure(tc.task)
+		if failed != tc.failed {
+			t.Errorf("unexpected result %v for %s", failed, tc.task.String())
+		}
+		if failed && reason == "" {
+			t.Errorf("reason must be set for %s", tc.task.String())
+		}
+	}
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	c := &ecspresso.Config{}
+	if err := c.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received []ecspresso.LifecycleEvent
+	app.OnEvent(func(ev ecspresso.LifecycleEvent) {
+		received = append(received, ev)
+	})
+	ch := app.Events(1)
+
+	ecspresso.EmitEvent(app, ecspresso.LifecycleEvent{Type: ecspresso.EventTaskDefinitionRegistered, TaskDefinition: "test:3", Revision: 3})
+	ecspresso.EmitEvent(app, ecspresso.LifecycleEvent{Type: ecspresso.EventSteadyState})
+
+	if len(received) != 2 {
+		t.Fatalf("unexpected events %v", received)
+	}
+	if ev := received[0]; ev.Revision != 3 || ev.Service != "test" || ev.Cluster != "default2" || ev.Time.IsZero() {
+		t.Errorf("unexpected event %#v", ev)
+	}
+	// the channel drops events when the buffer is full
+	if ev := <-ch; ev.Type != ecspresso.EventTaskDefinitionRegistered {
+		t.Errorf("unexpected event %#v", ev)
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("event must be dropped %#v", ev)
+	default:
+	}
+}
@@ -90,7 +90,7 @@ func (d *App) Exec(opt ExecOption) error {
 		return d.portForward(ctx, task, targetContainer, *opt.LocalPort, *opt.Port)
 	}
 
-	out, err := d.ecs.ExecuteCommand(&ecs.ExecuteCommandInput{
+	out, err := d.ecs.ExecuteCommandWithContext(ctx, &ecs.ExecuteCommandInput{
 		Cluster:     task.ClusterArn,
 		Interactive: aws.Bool(true),
 		Task:        task.TaskArn,
@@ -101,7 +101,7 @@ func (d *App) Exec(opt ExecOption) error {
 		return errors.Wrap(err, "failed to execute command. See also https://github.com/aws-containers/amazon-ecs-exec-checker")
 	}
 	sess, _ := json.Marshal(out.Session)
-	ssmReq, err := d.buildSsmRequestParameters(task, targetContainer)
+	ssmReq, err := d.buildSsmRequestParameters(ctx, task, targetContainer)
 	if err != nil {
 		return errors.Wrap(err, "failed to build ssm request parameters")
 	}
@@ -113,7 +113,7 @@ func (d *App) Exec(opt ExecOption) error {
 		"StartSession",
 		"",
 		ssmReq.String(),
-		d.ecs.Endpoint,
+		d.ecsEndpoint(),
 	)
 	signal.Ignore(os.Interrupt)
 	defer signal.Reset(os.Interrupt)
@@ -173,11 +173,11 @@ func (p *ssmRequestParameters) String() string {
 	return string(b)
 }
 
-func (d *App) buildSsmRequestParameters(task *ecs.Task, targetContainer *string) (*ssmRequestParameters, error) {
+func (d *App) buildSsmRequestParameters(ctx context.Context, task *ecs.Task, targetContainer *string) (*ssmRequestParameters, error) {
 	values := strings.Split(*task.TaskArn, "/")
 	clusterName := values[1]
 	taskID := values[2]
-	runtimeID, err := d.getContainerRuntimeID(task, targetContainer)
+	runtimeID, err := d.getContainerRuntimeID(ctx, task, targetContainer)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get container runtime ID")
 	}
@@ -186,8 +186,8 @@ func (d *App) buildSsmRequestParameters(task *ecs.Task, targetContainer *string)
 	}, nil
 }
 
-func (d *App) getContainerRuntimeID(task *ecs.Task, targetContainer *string) (*string, error) {
-	output, err := d.ecs.DescribeTasks(&ecs.DescribeTasksInput{
+func (d *App) getContainerRuntimeID(ctx context.Context, task *ecs.Task, targetContainer *string) (*string, error) {
+	output, err := d.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
 		Cluster: task.ClusterArn,
 		Tasks:   []*string{task.TaskArn},
 	})
@@ -247,7 +247,7 @@ func (d *App) portForward(ctx context.Context, task *ecs.Task, targetContainer *
 	}
 
 	ssmclient := ssm.New(d.sess)
-	ssmReq, err := d.buildSsmRequestParameters(task, targetContainer)
+	ssmReq, err := d.buildSsmRequestParameters(ctx, task, targetContainer)
 	if err != nil {
 		return err
 	}
@@ -264,7 +264,7 @@ func (d *App) portForward(ctx context.Context, task *ecs.Task, targetContainer *
 		return errors.Wrap(err, "failed to start SSM session")
 	}
 	ssmSess, _ := json.Marshal(res)
-	d.DebugLog(SessionManagerPluginBinary, string(ssmSess), d.config.Region, "StartSession", "", ssmReq.String(), d.ecs.Endpoint)
+	d.DebugLog(SessionManagerPluginBinary, string(ssmSess), d.config.Region, "StartSession", "", ssmReq.String(), d.ecsEndpoint())
 
 	cmd := exec.Command(
 		SessionManagerPluginBinary,
@@ -273,10 +273,15 @@ func (d *App) portForward(ctx context.Context, task *ecs.Task, targetContainer *
 		"StartSession",
 		"",
 		ssmReq.String(),
-		d.ecs.Endpoint,
+		d.ecsEndpoint(),
 	)
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// ecsEndpoint returns the endpoint of ECS passed to the session-manager-plugin.
+func (d *App) ecsEndpoint() string {
+	return ecs.New(d.sess).Endpoint
+}
@@ -0,0 +1,101 @@
+package ecspresso
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
+)
+
+// Exit statuses of classes of failures for scripting.
+// Other failures exit with ExitCodeError, and interrupted commands exit with ExitCodeInterrupted.
+const (
+	ExitCodeError            = 1
+	ExitCodeVerifyFailed     = 2
+	ExitCodeDiffFound        = 3
+	ExitCodeTimeout          = 4
+	ExitCodeRollback         = 5
+	ExitCodePermissionDenied = 6
+	ExitCodeAborted          = 7
+)
+
+// permissionErrorCodes are error codes of AWS APIs for denied permissions.
+var permissionErrorCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"UnauthorizedOperation":       true,
+	"UnauthorizedException":       true,
+	"UnrecognizedClientException": true,
+	"InvalidClientTokenId":        true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"AuthorizationErrorException": true,
+	"AuthFailure":                 true,
+}
+
+var errConfirmationFailed = withExitCode(ExitCodeAborted, errors.New("confirmation failed"))
+
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Cause() error {
+	return e.err
+}
+
+// withExitCode annotates the error to exit with the code.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitCodeError{code: code, err: err}
+}
+
+// withDefaultExitCode annotates the error to exit with the code only when it is not classified yet,
+// to keep the classes of permission errors, timeouts, etc.
+func withDefaultExitCode(code int, err error) error {
+	if ExitCodeOf(err) != ExitCodeError {
+		return err
+	}
+	return withExitCode(code, err)
+}
+
+// ExitCodeOf returns the exit status for the error returned by commands.
+// The code annotated by the outermost error wins. Unannotated errors are classified by the causes.
+func ExitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	for e := err; e != nil; {
+		if ec, ok := e.(*exitCodeError); ok {
+			return ec.code
+		}
+		if e == context.DeadlineExceeded {
+			return ExitCodeTimeout
+		}
+		if aerr, ok := e.(awserr.Error); ok {
+			switch {
+			case permissionErrorCodes[aerr.Code()]:
+				return ExitCodePermissionDenied
+			case aerr.Code() == request.WaiterResourceNotReadyErrorCode:
+				return ExitCodeTimeout
+			case aerr.OrigErr() != nil:
+				e = aerr.OrigErr()
+				continue
+			}
+			return ExitCodeError
+		}
+		c, ok := e.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		e = c.Cause()
+	}
+	return ExitCodeError
+}
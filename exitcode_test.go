@@ -0,0 +1,99 @@
+package ecspresso_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+	"github.com/pkg/errors"
+)
+
+func TestExitCodeOf(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"nil", nil, 0},
+		{"generic", errors.New("something wrong"), ecspresso.ExitCodeError},
+		{"aborted", errors.Wrap(ecspresso.ErrConfirmationFailed, "failed to delete"), ecspresso.ExitCodeAborted},
+		{"deadline", errors.Wrap(context.DeadlineExceeded, "failed to wait"), ecspresso.ExitCodeTimeout},
+		{"request canceled", errors.Wrap(awserr.New(request.CanceledErrorCode, "canceled", context.DeadlineExceeded), "failed"), ecspresso.ExitCodeTimeout},
+		{"waiter", errors.Wrap(awserr.New(request.WaiterResourceNotReadyErrorCode, "exceeded wait attempts", nil), "failed"), ecspresso.ExitCodeTimeout},
+		{"access denied", errors.Wrap(awserr.New("AccessDeniedException", "not authorized", nil), "failed"), ecspresso.ExitCodePermissionDenied},
+		{"other aws error", awserr.New("ServiceNotFoundException", "not found", nil), ecspresso.ExitCodeError},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := ecspresso.ExitCodeOf(tc.err); code != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, code)
+			}
+		})
+	}
+}
+
+func TestWithDefaultExitCode(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"generic", errors.New("target group's port mismatch"), ecspresso.ExitCodeVerifyFailed},
+		{"access denied", errors.Wrap(awserr.New("AccessDenied", "not authorized", nil), "verify Cluster failed"), ecspresso.ExitCodePermissionDenied},
+		{"deadline", errors.Wrap(context.DeadlineExceeded, "verify TaskDefinition failed"), ecspresso.ExitCodeTimeout},
+		{"aborted", errors.Wrap(ecspresso.ErrConfirmationFailed, "verify failed"), ecspresso.ExitCodeAborted},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ecspresso.WithDefaultExitCode(ecspresso.ExitCodeVerifyFailed, tc.err)
+			if code := ecspresso.ExitCodeOf(err); code != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, code)
+			}
+		})
+	}
+}
+
+func TestDeployRolledBackByCircuitBreaker(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	previous := "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"
+	fake := &fakeECS{
+		service: &ecs.Service{
+			ServiceName:    aws.String("test"),
+			ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+			TaskDefinition: aws.String(previous),
+			DesiredCount:   aws.Int64(1),
+		},
+	}
+	fake.onDescribe = func(sv *ecs.Service) {
+		if !fake.waited {
+			return
+		}
+		// the circuit breaker rolled back to the previous task definition
+		sv.TaskDefinition = aws.String(previous)
+		sv.Deployments = []*ecs.Deployment{
+			{Status: aws.String("PRIMARY"), TaskDefinition: aws.String(previous)},
+		}
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:                    fake,
+		ApplicationAutoScaling: &fakeAutoScaling{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.DeployWithContext(context.Background(), ecspresso.DeployOption{})
+	if code := ecspresso.ExitCodeOf(err); code != ecspresso.ExitCodeRollback {
+		t.Errorf("expected exit code %d, got %d: %v", ecspresso.ExitCodeRollback, code, err)
+	}
+}
@@ -1,5 +1,17 @@
 package ecspresso
 
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
 var (
 	SortTaskDefinitionForDiff    = sortTaskDefinitionForDiff
 	SortServiceDefinitionForDiff = sortServiceDefinitionForDiff
@@ -9,6 +21,388 @@ var (
 	CalcDesiredCount             = calcDesiredCount
 	ParseTags                    = parseTags
 	ParseRoleArn                 = parseRoleArn
+	PlatformMismatchMessage      = platformMismatchMessage
+	RegistryCredentials          = registryCredentials
 	IsLongArnFormat              = isLongArnFormat
 	ECRImageURLRegex             = ecrImageURLRegex
+	ValidateScheduledAction      = validateScheduledAction
+	ClampDesiredCount            = clampDesiredCount
+	ValidateServiceDiscovery     = (*ServiceDiscoveryConfig).validate
+	NewServiceFromRemote         = newServiceFromRemote
+	NewSlackPayload              = newSlackPayload
+	Notify                       = (*App).notify
+	DeployCommandName            = DeployOption.commandName
+	DriftDiffs                   = driftDiffs
+	MaskEnvironmentValues        = maskEnvironmentValues
+	CheckScaleDown               = checkScaleDown
+	LogGroupsOf                  = logGroupsOf
+	DetectPlaintextSecret        = detectPlaintextSecret
+	IsSSOProfile                 = isSSOProfile
+	IsSSOSessionExpired          = isSSOSessionExpired
+	ResolveEndpoints             = resolveEndpoints
+	ValidateRetryConfig          = (*AWSRetryConfig).validate
+	NextAdaptiveRate             = nextAdaptiveRate
+	FormatLogFields              = formatLogFields
+	ValidateConfigFile           = validateConfigFile
+	ValidateTaskDefinition       = func(src []byte) []string { return validateDefinition(src, &TaskDefinitionInput{}) }
+	GenerateSchema               = generateSchema
+	CompleterWriteCache          = (*Completer).writeCache
+	CompleterReadCache           = (*Completer).readCache
+	RevisionsOfFamily            = revisionsOfFamily
+	FillNilOptions               = fillNilOptions
+	TaskFailure                  = taskFailure
+	EmitEvent                    = (*App).emitEvent
+	CodeDeployHistoriesOf        = codeDeployHistoriesOf
+	CompareDefinitions           = compareDefinitions
+	EstimateCost                 = estimateCost
+	DefaultCostConfig            = defaultCostConfig
+	CostConfigWithDefaults       = (*CostConfig).withDefaults
+	ECRRepositoryOf              = ecrRepositoryOf
+	VerifyWindowsTaskDefinition  = verifyWindowsTaskDefinition
+	VerifyAcceleratorDefinition  = verifyAcceleratorDefinition
+	GPUCountOf                   = gpuCountOf
+	RegisteredGPUs               = registeredGPUs
+	AutoScalingGroupNameOf       = autoScalingGroupNameOf
+	IsGPUOptimizedAMI            = isGPUOptimizedAMI
+	VerifyExternalService        = verifyExternalServiceDefinition
+	IsExternalInstance           = isExternalInstance
+	FormatExternalInstance       = formatExternalInstance
+	ParseCapacityStrategy        = parseCapacityProviderStrategy
+	FormatCapacityStrategy       = formatCapacityProviderStrategy
+	ECRRepositoryNameOf          = ecrRepositoryNameOf
+	SplitImageTag                = splitImageTag
+	JoinImageTag                 = joinImageTag
+	MatchPullThroughCacheRule    = matchPullThroughCacheRule
+	UpstreamImageOf              = upstreamImageOf
+	MutableImageTag              = mutableImageTag
+	ValidateImageTagPolicy       = (*ImageTagPolicyConfig).validate
+	ValidateRedaction            = (*RedactionConfig).validate
+)
+
+func NewJSONLogWriter(w io.Writer) io.Writer {
+	return &jsonLogWriter{w: w}
+}
+
+func NewCompleterWithCacheDir(region, dir string) *Completer {
+	c := NewCompleter(region)
+	c.cacheDir = dir
+	return c
+}
+
+func CallExecPlugin(command, name string, args ...interface{}) (string, error) {
+	p, _, err := newExecPlugin(map[string]interface{}{
+		"command":   command,
+		"functions": []interface{}{name},
+	}, ".")
+	if err != nil {
+		return "", err
+	}
+	return p.call(name, args)
+}
+
+func SetDelayForServiceChanged(d time.Duration) (restore func()) {
+	orig := delayForServiceChanged
+	delayForServiceChanged = d
+	return func() { delayForServiceChanged = orig }
+}
+
+var ParseWaitCondition = parseWaitCondition
+
+func SetWaitUntilInterval(d time.Duration) (restore func()) {
+	orig := waitUntilInterval
+	waitUntilInterval = d
+	return func() { waitUntilInterval = orig }
+}
+
+func PlanTagChanges(current, desired map[string]string) []string {
+	var ss []string
+	for _, c := range planTagChanges(current, desired) {
+		ss = append(ss, c.String())
+	}
+	return ss
+}
+
+func RunBufferedTasks(ctx context.Context, w io.Writer, tasks ...func(context.Context, io.Writer) error) error {
+	bts := make([]bufferedTask, 0, len(tasks))
+	for _, t := range tasks {
+		bts = append(bts, t)
+	}
+	return runBufferedTasks(ctx, w, bts...)
+}
+
+func (d *App) ListTasks(ctx context.Context) ([]*ecs.Task, error) {
+	return d.listTasks(ctx, nil)
+}
+
+func WaitPollerInterval(c *WaitConfig, startedAt, now time.Time) time.Duration {
+	p := newWaitPoller(c, startedAt)
+	p.now = func() time.Time { return now }
+	return p.interval()
+}
+
+func WaitPollerNotified(ctx context.Context, c *WaitConfig) error {
+	p := newWaitPoller(c, time.Now())
+	p.notify()
+	return p.wait(ctx)
+}
+
+func SetTFStateCacheDir(dir string) (restore func()) {
+	orig := tfstateCacheDir
+	tfstateCacheDir = func() string { return dir }
+	return func() { tfstateCacheDir = orig }
+}
+
+func ResetTFStateLookups() {
+	tfstateLookupsMu.Lock()
+	defer tfstateLookupsMu.Unlock()
+	tfstateLookups = map[string]*tfstateLookup{}
+}
+
+func TFStateLookup(loc string, ttl time.Duration, addrs string) (string, error) {
+	l, err := newTFStateLookup(loc, ttl)
+	if err != nil {
+		return "", err
+	}
+	return l.lookup(addrs)
+}
+
+func (d *App) CheckTaskDefinitionForRegister(td *TaskDefinitionInput) []string {
+	return d.checkTaskDefinitionForRegister(td)
+}
+
+func (d *App) RevisionReferences(ctx context.Context, family string) (map[string][]string, error) {
+	return d.revisionReferences(ctx, family)
+}
+
+func (d *App) AppSpecLoadBalancer(ctx context.Context, sv *ecs.Service, dg *codedeploy.DeploymentGroupInfo) (*ecs.LoadBalancer, error) {
+	return d.appSpecLoadBalancer(ctx, sv, dg)
+}
+
+func (d *App) WaitForCodeDeployWithValidation(ctx context.Context, dg *codedeploy.DeploymentGroupInfo, dpID string) error {
+	return d.waitForCodeDeployWithValidation(ctx, dg, dpID)
+}
+
+func (d *App) DescribeNetworkEndpoints(ctx context.Context, w io.Writer, s *ecs.Service) error {
+	return d.describeNetworkEndpoints(ctx, w, s)
+}
+
+var DiffImages = diffImages
+
+var ErrConfirmationFailed = errConfirmationFailed
+
+var WithDefaultExitCode = withDefaultExitCode
+
+func SetConfirmation(answer string) func() {
+	prompt, terminal := promptConfirmation, stdinIsTerminal
+	promptConfirmation = func(string) string { return answer }
+	stdinIsTerminal = func() bool { return true }
+	return func() {
+		promptConfirmation, stdinIsTerminal = prompt, terminal
+	}
+}
+
+var DiffStat = diffStat
+
+func PhaseTimeout(c *Config, phase string) time.Duration {
+	return c.phaseTimeout(phase)
+}
+
+func (d *App) SetImageLabels(image string, labels map[string]string) {
+	d.imageLabelsCache = map[string]map[string]string{image: labels}
+}
+
+func (d *App) ReadDefinitionFile(path string) ([]byte, error) {
+	return d.readDefinitionFile(path)
+}
+
+func RegistryMirrors(c *Config, host, repo string) []string {
+	return c.registryMirrors(host, repo)
+}
+
+func ApplyServiceOverrides(sv *Service, opt DeployOption) []string {
+	var diffs []string
+	for _, o := range applyServiceOverrides(sv, opt) {
+		diffs = append(diffs, o.diff())
+	}
+	return diffs
+}
+
+var (
+	RequiredEndpointServices = requiredEndpointServices
+	DefaultRouteTarget       = defaultRouteTarget
+	EgressAllowsHTTPS        = egressAllowsHTTPS
+	CheckSubnetRoute         = checkSubnetRoute
+)
+
+func CheckVPCEndpoint(svc string, endpoints []*ec2.VpcEndpoint, routeTableIDs, subnetCIDRs, securityGroupIDs []string, sgs map[string]*ec2.SecurityGroup) error {
+	return checkVPCEndpoint(svc, endpoints, &privateNetwork{
+		routeTableIDs:    routeTableIDs,
+		subnetCIDRs:      subnetCIDRs,
+		securityGroupIDs: securityGroupIDs,
+	}, sgs)
+}
+
+var (
+	ParseS3ConfigURL  = parseS3ConfigURL
+	ParseGitConfigURL = parseGitConfigURL
+)
+
+var IncompatibleLoadBalancerChange = incompatibleLoadBalancerChange
+
+var (
+	ImmutableServiceChanges = immutableServiceChanges
+	MergeServiceTags        = mergeServiceTags
+	AlarmForService         = alarmForService
 )
+
+var (
+	DaemonPlacementFilter = daemonPlacementFilter
+	CalcDaemonCoverage    = calcDaemonCoverage
+)
+
+func (c daemonCoverage) Missing() []string {
+	return c.missing
+}
+
+func (opt DeployOption) ValidateForDaemon() error {
+	return opt.validateForDaemon()
+}
+
+var (
+	ClearRemovedPlacement      = clearRemovedPlacement
+	ValidatePlacement          = validatePlacement
+	PlacementAttributeWarnings = placementAttributeWarnings
+)
+
+var (
+	DrainFilter   = drainFilter
+	DrainProgress = drainProgress
+)
+
+var (
+	ScheduledTaskTarget       = scheduledTaskTarget
+	ScheduledTaskRunTaskInput = scheduledTaskRunTaskInput
+	ParseScheduledTaskName    = parseScheduledTaskName
+)
+
+func (c *AWSConfig) WithAssumeRole(arn string) *AWSConfig {
+	return c.withAssumeRole(arn)
+}
+
+var CredentialsExpiration = credentialsExpiration
+
+func (d *App) CheckCredentialsExpiry(command string) error {
+	return d.checkCredentialsExpiry(command)
+}
+
+var IsReadOnlyOperation = isReadOnlyOperation
+
+func (c *Config) Session() *session.Session {
+	return c.sess
+}
+
+func (d *App) VerifyServiceDefinition(ctx context.Context, td *TaskDefinitionInput, sv *Service) error {
+	d.verifier = &verifier{td: td, sv: sv}
+	return d.verifyServiceDefinition(ctx)
+}
+
+func (d *App) VerifyIAMPermissions(ctx context.Context, td *TaskDefinitionInput, sv *Service) error {
+	d.verifier = &verifier{td: td, sv: sv}
+	return d.verifyIAMPermissions(ctx)
+}
+
+func (d *App) RedactTaskDefinition(td *TaskDefinitionInput) *TaskDefinitionInput {
+	return d.redactTaskDefinition(td)
+}
+
+func (d *App) DiffAppSpec(ctx context.Context, sv *Service, unified bool) (string, error) {
+	return d.diffAppSpec(ctx, sv, unified)
+}
+
+func (d *App) DescribeContainerInsights(ctx context.Context, w io.Writer, sv *ecs.Service, period time.Duration) error {
+	return d.describeContainerInsights(ctx, w, sv, period)
+}
+
+func (d *App) ServiceSummariesTSV(ctx context.Context, w io.Writer, tags string) error {
+	ss, err := d.serviceSummaries(ctx, tags)
+	if err != nil {
+		return err
+	}
+	return ss.OutputTSV(w)
+}
+
+func (d *App) StateHistories(ctx context.Context, count int) (deploymentHistories, error) {
+	return d.stateHistories(ctx, count)
+}
+
+func (d *App) ExportResources(ctx context.Context, opt ExportOption) (map[string]interface{}, error) {
+	return d.exportResources(ctx, opt)
+}
+
+var ToSnakeCase = toSnakeCase
+
+var MergeDeploymentAlarms = mergeDeploymentAlarms
+
+func (d *App) DeploymentAlarmCandidates(ctx context.Context, lbs []*ecs.LoadBalancer) ([]*cloudwatch.MetricAlarm, error) {
+	return d.deploymentAlarmCandidates(ctx, lbs)
+}
+
+func (d *App) WriteDeploymentAlarms(path string, names []string, rollback bool) error {
+	return d.writeDeploymentAlarms(path, names, rollback, true)
+}
+
+func (c *LogCheckConfig) Validate() error {
+	return c.validate()
+}
+
+func (d *App) CheckTaskLogs(ctx context.Context, tdArn string, since time.Time) error {
+	return d.checkTaskLogs(ctx, tdArn, since)
+}
+
+var (
+	S3ConfigListInput = s3ConfigListInput
+	LocalPathOfS3Key  = localPathOfS3Key
+)
+
+var InterruptContextOf = interruptContextOf
+
+func (d *App) StartSpan(ctx context.Context, name string) (context.Context, func()) {
+	ctx, span := d.startSpan(ctx, name)
+	return ctx, func() { span.End() }
+}
+
+func (d *App) CurrentPhase() string {
+	return d.currentPhase()
+}
+
+func (d *App) PrettifyForLog(v interface{}) string {
+	return d.redactor.prettify(v)
+}
+
+// StaleECRImages returns digests of images to be deleted by cleanup for each ECR repository.
+func (d *App) StaleECRImages(ctx context.Context, td *TaskDefinitionInput, opt CleanupOption) (map[string][]string, error) {
+	p, err := d.buildStalePlan(ctx, td, opt)
+	if err != nil {
+		return nil, err
+	}
+	images := map[string][]string{}
+	for repo, ids := range p.ecrImages {
+		for _, id := range ids {
+			images[repo.String()] = append(images[repo.String()], *id.ImageDigest)
+		}
+	}
+	return images, nil
+}
+
+// CleanupPlanOf returns log groups and targets of scheduled task rules to be deleted with the service.
+func (d *App) CleanupPlanOf(ctx context.Context, sv *ecs.Service) (logGroups []string, ruleTargets map[string][]string, err error) {
+	p, err := d.buildCleanupPlan(ctx, sv)
+	if err != nil {
+		return nil, nil, err
+	}
+	ruleTargets = map[string][]string{}
+	for _, r := range p.scheduledTaskRules {
+		ruleTargets[r.name] = r.targetIDs
+	}
+	return p.logGroups, ruleTargets, nil
+}
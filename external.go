@@ -0,0 +1,148 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// externalCapabilityAttribute is the attribute of container instances registered by ECS Anywhere.
+const externalCapabilityAttribute = "ecs.capability.external"
+
+func isExternalLaunchType(launchType *string) bool {
+	return aws.StringValue(launchType) == ecs.LaunchTypeExternal
+}
+
+// isExternalInstance reports whether the container instance is an external instance of ECS Anywhere.
+// External instances are registered as SSM managed instances (mi-*).
+func isExternalInstance(ci *ecs.ContainerInstance) bool {
+	if strings.HasPrefix(aws.StringValue(ci.Ec2InstanceId), "mi-") {
+		return true
+	}
+	for _, a := range ci.Attributes {
+		if aws.StringValue(a.Name) == externalCapabilityAttribute {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyExternalServiceDefinition verifies the service and task definitions for the EXTERNAL launch type
+// without accessing AWS.
+func verifyExternalServiceDefinition(sv *Service, td *TaskDefinitionInput) error {
+	if len(td.RequiresCompatibilities) > 0 {
+		var compatible bool
+		for _, c := range td.RequiresCompatibilities {
+			if aws.StringValue(c) == ecs.CompatibilityExternal {
+				compatible = true
+			}
+		}
+		if !compatible {
+			return errors.New("requiresCompatibilities of the task definition must contain EXTERNAL")
+		}
+	}
+	var errs []string
+	if aws.StringValue(td.NetworkMode) == ecs.NetworkModeAwsvpc {
+		errs = append(errs, "networkMode awsvpc")
+	}
+	if sv.NetworkConfiguration != nil {
+		errs = append(errs, "networkConfiguration")
+	}
+	if len(sv.LoadBalancers) > 0 {
+		errs = append(errs, "loadBalancers")
+	}
+	if len(sv.ServiceRegistries) > 0 {
+		errs = append(errs, "serviceRegistries")
+	}
+	if isServiceConnectEnabled(sv.ServiceConnectConfiguration) {
+		errs = append(errs, "serviceConnectConfiguration")
+	}
+	if len(sv.VolumeConfigurations) > 0 {
+		errs = append(errs, "volumeConfigurations")
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("not supported for the EXTERNAL launch type: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// verifyExternalInstances verifies that ACTIVE external instances are registered to the cluster.
+func (d *App) verifyExternalInstances(ctx context.Context) error {
+	var active, disconnected int
+	err := d.eachContainerInstance(ctx, func(ci *ecs.ContainerInstance) bool {
+		if !isExternalInstance(ci) {
+			return true
+		}
+		active++
+		if !aws.BoolValue(ci.AgentConnected) {
+			disconnected++
+			d.DebugLog("agent of the external instance", aws.StringValue(ci.Ec2InstanceId), "is disconnected")
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if active == 0 {
+		return errors.Errorf("no ACTIVE external instances are registered to cluster %s. register instances by ECS Anywhere", d.Cluster)
+	}
+	if active == disconnected {
+		return errors.Errorf("agents of all %d external instances in cluster %s are disconnected", active, d.Cluster)
+	}
+	if disconnected > 0 {
+		return verifyWarnErr(fmt.Sprintf("agents of %d/%d external instances are disconnected", disconnected, active))
+	}
+	d.DebugLog(fmt.Sprintf("%d ACTIVE external instances are registered", active))
+	return nil
+}
+
+func formatExternalInstance(ci *ecs.ContainerInstance) string {
+	agent := "disconnected"
+	if aws.BoolValue(ci.AgentConnected) {
+		agent = "connected"
+	}
+	health := "UNKNOWN"
+	if h := ci.HealthStatus; h != nil && h.OverallStatus != nil {
+		health = *h.OverallStatus
+	}
+	return fmt.Sprintf(
+		"%8s %s %s agent:%s health:%s running:%d pending:%d",
+		aws.StringValue(ci.Status),
+		aws.StringValue(ci.Ec2InstanceId),
+		arnToName(aws.StringValue(ci.ContainerInstanceArn)),
+		agent,
+		health,
+		aws.Int64Value(ci.RunningTasksCount),
+		aws.Int64Value(ci.PendingTasksCount),
+	)
+}
+
+// describeExternalInstances shows external instances in the cluster for the service of the EXTERNAL launch type.
+func (d *App) describeExternalInstances(ctx context.Context, w io.Writer, s *ecs.Service) error {
+	if !isExternalLaunchType(s.LaunchType) {
+		return nil
+	}
+	var lines []string
+	err := d.eachContainerInstance(ctx, func(ci *ecs.ContainerInstance) bool {
+		if isExternalInstance(ci) {
+			lines = append(lines, spcIndent+formatExternalInstance(ci))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "ExternalInstances:")
+	if len(lines) == 0 {
+		fmt.Fprintln(w, spcIndent+"(no ACTIVE external instances)")
+	}
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package ecspresso_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestVerifyExternalService(t *testing.T) {
+	external := func() *ecspresso.Service {
+		return &ecspresso.Service{Service: ecs.Service{LaunchType: aws.String("EXTERNAL")}}
+	}
+	testCases := []struct {
+		name   string
+		sv     *ecspresso.Service
+		td     *ecspresso.TaskDefinitionInput
+		errMsg string
+	}{
+		{
+			name: "bridge",
+			sv:   external(),
+			td: &ecspresso.TaskDefinitionInput{
+				NetworkMode:             aws.String("bridge"),
+				RequiresCompatibilities: aws.StringSlice([]string{"EXTERNAL"}),
+			},
+		},
+		{
+			name: "no compatibilities",
+			sv:   external(),
+			td:   &ecspresso.TaskDefinitionInput{NetworkMode: aws.String("host")},
+		},
+		{
+			name: "incompatible",
+			sv:   external(),
+			td: &ecspresso.TaskDefinitionInput{
+				RequiresCompatibilities: aws.StringSlice([]string{"EC2"}),
+			},
+			errMsg: "must contain EXTERNAL",
+		},
+		{
+			name: "awsvpc and load balancers",
+			sv: func() *ecspresso.Service {
+				sv := external()
+				sv.NetworkConfiguration = &ecs.NetworkConfiguration{AwsvpcConfiguration: &ecs.AwsVpcConfiguration{}}
+				sv.LoadBalancers = []*ecs.LoadBalancer{{ContainerName: aws.String("app")}}
+				return sv
+			}(),
+			td:     &ecspresso.TaskDefinitionInput{NetworkMode: aws.String("awsvpc")},
+			errMsg: "not supported for the EXTERNAL launch type: networkMode awsvpc, networkConfiguration, loadBalancers",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ecspresso.VerifyExternalService(tc.sv, tc.td)
+			if tc.errMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("expected error contains %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestVerifyExternalServiceDefinition(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeDrainECS{
+		instances: []*ecs.ContainerInstance{
+			{
+				ContainerInstanceArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:container-instance/default2/a"),
+				Ec2InstanceId:        aws.String("mi-0123456789abcdef0"),
+				Status:               aws.String("ACTIVE"),
+				AgentConnected:       aws.Bool(true),
+			},
+		},
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := &ecspresso.Service{Service: ecs.Service{
+		LaunchType:                    aws.String("EXTERNAL"),
+		HealthCheckGracePeriodSeconds: aws.Int64(60),
+	}}
+	td := &ecspresso.TaskDefinitionInput{NetworkMode: aws.String("bridge")}
+	err = app.VerifyServiceDefinition(context.Background(), td, sv)
+	if err == nil || !strings.Contains(err.Error(), "healthCheckGracePeriodSeconds") {
+		t.Errorf("expected error of healthCheckGracePeriodSeconds, got %v", err)
+	}
+}
+
+func TestIsExternalInstance(t *testing.T) {
+	if !ecspresso.IsExternalInstance(&ecs.ContainerInstance{Ec2InstanceId: aws.String("mi-0123456789abcdef0")}) {
+		t.Error("managed instance must be external")
+	}
+	if !ecspresso.IsExternalInstance(&ecs.ContainerInstance{
+		Attributes: []*ecs.Attribute{{Name: aws.String("ecs.capability.external")}},
+	}) {
+		t.Error("instance with ecs.capability.external must be external")
+	}
+	if ecspresso.IsExternalInstance(&ecs.ContainerInstance{Ec2InstanceId: aws.String("i-0123456789abcdef0")}) {
+		t.Error("EC2 instance must not be external")
+	}
+}
+
+func TestFormatExternalInstance(t *testing.T) {
+	ci := &ecs.ContainerInstance{
+		ContainerInstanceArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:container-instance/default/0123456789abcdef"),
+		Ec2InstanceId:        aws.String("mi-0123456789abcdef0"),
+		Status:               aws.String("ACTIVE"),
+		AgentConnected:       aws.Bool(true),
+		HealthStatus:         &ecs.ContainerInstanceHealthStatus{OverallStatus: aws.String("OK")},
+		RunningTasksCount:    aws.Int64(2),
+		PendingTasksCount:    aws.Int64(0),
+	}
+	expected := "  ACTIVE mi-0123456789abcdef0 0123456789abcdef agent:connected health:OK running:2 pending:0"
+	if s := ecspresso.FormatExternalInstance(ci); s != expected {
+		t.Errorf("unexpected format\n%s\n%s", s, expected)
+	}
+}
@@ -0,0 +1,349 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// gpuCountOf returns the number of GPUs required by all containers in the task definition.
+func gpuCountOf(td *TaskDefinitionInput) (int64, error) {
+	var total int64
+	for _, c := range td.ContainerDefinitions {
+		for _, r := range c.ResourceRequirements {
+			if aws.StringValue(r.Type) != ecs.ResourceTypeGpu {
+				continue
+			}
+			n, err := strconv.ParseInt(aws.StringValue(r.Value), 10, 64)
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf("invalid GPU value %q of container %s", aws.StringValue(r.Value), aws.StringValue(c.Name))
+			}
+			total += n
+		}
+	}
+	return total, nil
+}
+
+func requiresAccelerators(td *TaskDefinitionInput) bool {
+	if len(td.InferenceAccelerators) > 0 {
+		return true
+	}
+	for _, c := range td.ContainerDefinitions {
+		for _, r := range c.ResourceRequirements {
+			switch aws.StringValue(r.Type) {
+			case ecs.ResourceTypeGpu, ecs.ResourceTypeInferenceAccelerator:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyAcceleratorDefinition verifies GPU and inference accelerator requirements in the task definition
+// without accessing AWS.
+func verifyAcceleratorDefinition(td *TaskDefinitionInput, isFargate bool) error {
+	gpus, err := gpuCountOf(td)
+	if err != nil {
+		return err
+	}
+	for _, c := range td.RequiresCompatibilities {
+		if aws.StringValue(c) == ecs.CompatibilityFargate {
+			isFargate = true
+		}
+	}
+	if isFargate && gpus > 0 {
+		return errors.New("GPU resource requirements are not supported by Fargate")
+	}
+	if isFargate && len(td.InferenceAccelerators) > 0 {
+		return errors.New("inferenceAccelerators are not supported by Fargate")
+	}
+
+	devices := map[string]bool{}
+	for _, a := range td.InferenceAccelerators {
+		devices[aws.StringValue(a.DeviceName)] = true
+	}
+	for _, c := range td.ContainerDefinitions {
+		for _, r := range c.ResourceRequirements {
+			if aws.StringValue(r.Type) != ecs.ResourceTypeInferenceAccelerator {
+				continue
+			}
+			if name := aws.StringValue(r.Value); !devices[name] {
+				return errors.Errorf("inference accelerator %s of container %s is not defined in inferenceAccelerators", name, aws.StringValue(c.Name))
+			}
+		}
+	}
+	return nil
+}
+
+// registeredGPUs returns the number of GPUs registered by the container instance.
+func registeredGPUs(ci *ecs.ContainerInstance) int64 {
+	for _, r := range ci.RegisteredResources {
+		if aws.StringValue(r.Name) == ecs.ResourceTypeGpu {
+			return int64(len(r.StringSetValue))
+		}
+	}
+	return 0
+}
+
+// autoScalingGroupNameOf returns the name of the Auto Scaling group from the ARN.
+func autoScalingGroupNameOf(arn string) string {
+	if i := strings.Index(arn, ":autoScalingGroupName/"); i >= 0 {
+		return arn[i+len(":autoScalingGroupName/"):]
+	}
+	return arn
+}
+
+// isGPUOptimizedAMI reports whether the AMI looks like the Amazon ECS GPU-optimized AMI.
+func isGPUOptimizedAMI(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "gpu") || strings.Contains(name, "nvidia") || strings.Contains(name, "neuron")
+}
+
+func (d *App) verifyAccelerators(ctx context.Context, td *TaskDefinitionInput) error {
+	isFargate, err := d.isFargateService()
+	if err != nil {
+		return err
+	}
+	if err := verifyAcceleratorDefinition(td, isFargate); err != nil {
+		return err
+	}
+	gpus, _ := gpuCountOf(td)
+	if gpus == 0 {
+		// Elastic Inference accelerators are attached on launch. nothing to check in the cluster.
+		return nil
+	}
+
+	var instances int
+	err = d.eachContainerInstance(ctx, func(ci *ecs.ContainerInstance) bool {
+		instances++
+		return registeredGPUs(ci) < gpus
+	})
+	if err == errStopIteration {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	providers, err := d.capacityProvidersForVerify(ctx)
+	if err != nil {
+		return err
+	}
+	var warns []string
+	for _, name := range providers {
+		ok, warn, err := d.capacityProviderOffersGPUs(ctx, name, gpus)
+		if err != nil {
+			return errors.Wrapf(err, "failed to verify capacity provider %s", name)
+		}
+		if ok && warn == "" {
+			return nil
+		}
+		if ok {
+			warns = append(warns, warn)
+		}
+	}
+	if len(warns) > 0 {
+		return verifyWarnErr(strings.Join(warns, ", "))
+	}
+	return errors.Errorf(
+		"no container instances (%d registered) and capacity providers offer %d GPUs in cluster %s. tasks will be stuck in PROVISIONING",
+		instances, gpus, d.Cluster,
+	)
+}
+
+var errStopIteration = errors.New("stop iteration")
+
+// eachContainerInstance calls fn for each ACTIVE container instance in the cluster until fn returns false.
+func (d *App) eachContainerInstance(ctx context.Context, fn func(*ecs.ContainerInstance) bool) error {
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListContainerInstancesWithContext(ctx, &ecs.ListContainerInstancesInput{
+			Cluster:   aws.String(d.Cluster),
+			Status:    aws.String(ecs.ContainerInstanceStatusActive),
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to list container instances")
+		}
+		if len(out.ContainerInstanceArns) > 0 {
+			cis, err := d.ecs.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+				Cluster:            aws.String(d.Cluster),
+				ContainerInstances: out.ContainerInstanceArns,
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed to describe container instances")
+			}
+			for _, ci := range cis.ContainerInstances {
+				if !fn(ci) {
+					return errStopIteration
+				}
+			}
+		}
+		if nextToken = out.NextToken; nextToken == nil {
+			return nil
+		}
+	}
+}
+
+// capacityProvidersForVerify returns names of capacity providers which may run tasks of the service.
+func (d *App) capacityProvidersForVerify(ctx context.Context) ([]string, error) {
+	var strategy []*ecs.CapacityProviderStrategyItem
+	if sv := d.verifier.sv; sv != nil {
+		if sv.LaunchType != nil {
+			return nil, nil
+		}
+		strategy = sv.CapacityProviderStrategy
+	}
+	if len(strategy) == 0 {
+		out, err := d.ecs.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
+			Clusters: aws.StringSlice([]string{d.Cluster}),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe cluster")
+		}
+		if len(out.Clusters) > 0 {
+			strategy = out.Clusters[0].DefaultCapacityProviderStrategy
+		}
+	}
+	var names []string
+	for _, s := range strategy {
+		switch name := aws.StringValue(s.CapacityProvider); name {
+		case "FARGATE", "FARGATE_SPOT":
+		default:
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// capacityProviderOffersGPUs reports whether the Auto Scaling group of the capacity provider launches instances with enough GPUs.
+// warn is not empty when the instances have GPUs but the AMI doesn't look like GPU-optimized.
+func (d *App) capacityProviderOffersGPUs(ctx context.Context, name string, gpus int64) (ok bool, warn string, err error) {
+	out, err := d.ecs.DescribeCapacityProvidersWithContext(ctx, &ecs.DescribeCapacityProvidersInput{
+		CapacityProviders: aws.StringSlice([]string{name}),
+	})
+	if err != nil {
+		return false, "", err
+	}
+	if len(out.CapacityProviders) == 0 || out.CapacityProviders[0].AutoScalingGroupProvider == nil {
+		return false, "", nil
+	}
+	asgName := autoScalingGroupNameOf(aws.StringValue(out.CapacityProviders[0].AutoScalingGroupProvider.AutoScalingGroupArn))
+	instanceTypes, imageID, err := d.launchSpecOfAutoScalingGroup(ctx, asgName)
+	if err != nil {
+		return false, "", err
+	}
+	if len(instanceTypes) == 0 {
+		return false, "", nil
+	}
+
+	its, err := d.verifier.ec2.DescribeInstanceTypesWithContext(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: aws.StringSlice(instanceTypes),
+	})
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to describe instance types")
+	}
+	for _, it := range its.InstanceTypes {
+		var n int64
+		if it.GpuInfo != nil {
+			for _, g := range it.GpuInfo.Gpus {
+				n += aws.Int64Value(g.Count)
+			}
+		}
+		d.DebugLog(fmt.Sprintf("instance type %s of %s has %d GPUs", aws.StringValue(it.InstanceType), asgName, n))
+		if n >= gpus {
+			ok = true
+		}
+	}
+	if !ok || imageID == "" {
+		return ok, "", nil
+	}
+
+	imgs, err := d.verifier.ec2.DescribeImagesWithContext(ctx, &ec2.DescribeImagesInput{
+		ImageIds: aws.StringSlice([]string{imageID}),
+	})
+	if err != nil {
+		return false, "", errors.Wrapf(err, "failed to describe image %s", imageID)
+	}
+	if len(imgs.Images) == 0 {
+		return true, fmt.Sprintf("AMI %s of %s is not found", imageID, asgName), nil
+	}
+	if img := imgs.Images[0]; !isGPUOptimizedAMI(aws.StringValue(img.Name)) {
+		return true, fmt.Sprintf("AMI %s (%s) of %s may not be GPU-optimized", imageID, aws.StringValue(img.Name), asgName), nil
+	}
+	return true, "", nil
+}
+
+// launchSpecOfAutoScalingGroup returns the instance types and the AMI ID launched by the Auto Scaling group.
+func (d *App) launchSpecOfAutoScalingGroup(ctx context.Context, name string) ([]string, string, error) {
+	out, err := d.verifier.autoscaling.DescribeAutoScalingGroupsWithContext(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: aws.StringSlice([]string{name}),
+	})
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to describe Auto Scaling group %s", name)
+	}
+	if len(out.AutoScalingGroups) == 0 {
+		return nil, "", errors.Errorf("Auto Scaling group %s is not found", name)
+	}
+	asg := out.AutoScalingGroups[0]
+
+	var instanceTypes []string
+	lt := asg.LaunchTemplate
+	if mip := asg.MixedInstancesPolicy; mip != nil && mip.LaunchTemplate != nil {
+		if spec := mip.LaunchTemplate.LaunchTemplateSpecification; spec != nil {
+			lt = spec
+		}
+		for _, o := range mip.LaunchTemplate.Overrides {
+			if o.InstanceType != nil {
+				instanceTypes = append(instanceTypes, *o.InstanceType)
+			}
+		}
+	}
+
+	if lt != nil {
+		version := aws.StringValue(lt.Version)
+		if version == "" {
+			version = "$Default"
+		}
+		in := &ec2.DescribeLaunchTemplateVersionsInput{
+			Versions: aws.StringSlice([]string{version}),
+		}
+		if lt.LaunchTemplateId != nil {
+			in.LaunchTemplateId = lt.LaunchTemplateId
+		} else {
+			in.LaunchTemplateName = lt.LaunchTemplateName
+		}
+		vs, err := d.verifier.ec2.DescribeLaunchTemplateVersionsWithContext(ctx, in)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "failed to describe launch template versions")
+		}
+		if len(vs.LaunchTemplateVersions) == 0 || vs.LaunchTemplateVersions[0].LaunchTemplateData == nil {
+			return instanceTypes, "", nil
+		}
+		data := vs.LaunchTemplateVersions[0].LaunchTemplateData
+		if len(instanceTypes) == 0 && data.InstanceType != nil {
+			instanceTypes = append(instanceTypes, *data.InstanceType)
+		}
+		return instanceTypes, aws.StringValue(data.ImageId), nil
+	}
+
+	if asg.LaunchConfigurationName != nil {
+		lcs, err := d.verifier.autoscaling.DescribeLaunchConfigurationsWithContext(ctx, &autoscaling.DescribeLaunchConfigurationsInput{
+			LaunchConfigurationNames: []*string{asg.LaunchConfigurationName},
+		})
+		if err != nil {
+			return nil, "", errors.Wrap(err, "failed to describe launch configurations")
+		}
+		if len(lcs.LaunchConfigurations) > 0 {
+			lc := lcs.LaunchConfigurations[0]
+			return []string{aws.StringValue(lc.InstanceType)}, aws.StringValue(lc.ImageId), nil
+		}
+	}
+	return instanceTypes, "", nil
+}
@@ -0,0 +1,142 @@
+package ecspresso_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func gpuContainer(name string, reqs ...*ecs.ResourceRequirement) *ecs.ContainerDefinition {
+	return &ecs.ContainerDefinition{Name: aws.String(name), ResourceRequirements: reqs}
+}
+
+func resourceRequirement(typ, value string) *ecs.ResourceRequirement {
+	return &ecs.ResourceRequirement{Type: aws.String(typ), Value: aws.String(value)}
+}
+
+func TestGPUCountOf(t *testing.T) {
+	td := &ecspresso.TaskDefinitionInput{
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			gpuContainer("app", resourceRequirement("GPU", "2")),
+			gpuContainer("worker", resourceRequirement("GPU", "1")),
+			gpuContainer("sidecar"),
+		},
+	}
+	n, err := ecspresso.GPUCountOf(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("unexpected GPU count %d", n)
+	}
+
+	td.ContainerDefinitions[0].ResourceRequirements[0].Value = aws.String("x")
+	if _, err := ecspresso.GPUCountOf(td); err == nil {
+		t.Error("invalid GPU value must be an error")
+	}
+}
+
+func TestVerifyAcceleratorDefinition(t *testing.T) {
+	testCases := []struct {
+		name      string
+		td        *ecspresso.TaskDefinitionInput
+		isFargate bool
+		errMsg    string
+	}{
+		{
+			name: "gpu on ec2",
+			td: &ecspresso.TaskDefinitionInput{
+				ContainerDefinitions: []*ecs.ContainerDefinition{gpuContainer("app", resourceRequirement("GPU", "1"))},
+			},
+		},
+		{
+			name: "gpu on fargate service",
+			td: &ecspresso.TaskDefinitionInput{
+				ContainerDefinitions: []*ecs.ContainerDefinition{gpuContainer("app", resourceRequirement("GPU", "1"))},
+			},
+			isFargate: true,
+			errMsg:    "not supported by Fargate",
+		},
+		{
+			name: "gpu requires fargate",
+			td: &ecspresso.TaskDefinitionInput{
+				RequiresCompatibilities: aws.StringSlice([]string{"FARGATE"}),
+				ContainerDefinitions:    []*ecs.ContainerDefinition{gpuContainer("app", resourceRequirement("GPU", "1"))},
+			},
+			errMsg: "not supported by Fargate",
+		},
+		{
+			name: "inference accelerator",
+			td: &ecspresso.TaskDefinitionInput{
+				InferenceAccelerators: []*ecs.InferenceAccelerator{
+					{DeviceName: aws.String("device_1"), DeviceType: aws.String("eia2.medium")},
+				},
+				ContainerDefinitions: []*ecs.ContainerDefinition{gpuContainer("app", resourceRequirement("InferenceAccelerator", "device_1"))},
+			},
+		},
+		{
+			name: "undefined inference accelerator",
+			td: &ecspresso.TaskDefinitionInput{
+				InferenceAccelerators: []*ecs.InferenceAccelerator{
+					{DeviceName: aws.String("device_1"), DeviceType: aws.String("eia2.medium")},
+				},
+				ContainerDefinitions: []*ecs.ContainerDefinition{gpuContainer("app", resourceRequirement("InferenceAccelerator", "device_2"))},
+			},
+			errMsg: "inference accelerator device_2 of container app is not defined",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ecspresso.VerifyAcceleratorDefinition(tc.td, tc.isFargate)
+			if tc.errMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("expected error contains %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestRegisteredGPUs(t *testing.T) {
+	ci := &ecs.ContainerInstance{
+		RegisteredResources: []*ecs.Resource{
+			{Name: aws.String("CPU"), Type: aws.String("INTEGER"), IntegerValue: aws.Int64(4096)},
+			{Name: aws.String("GPU"), Type: aws.String("STRINGSET"), StringSetValue: aws.StringSlice([]string{"GPU-a", "GPU-b"})},
+		},
+	}
+	if n := ecspresso.RegisteredGPUs(ci); n != 2 {
+		t.Errorf("unexpected registered GPUs %d", n)
+	}
+	if n := ecspresso.RegisteredGPUs(&ecs.ContainerInstance{}); n != 0 {
+		t.Errorf("unexpected registered GPUs %d", n)
+	}
+}
+
+func TestAutoScalingGroupNameOf(t *testing.T) {
+	arn := "arn:aws:autoscaling:ap-northeast-1:123456789012:autoScalingGroup:0d3d1c1e-3a4b-4c5d-8e9f-0a1b2c3d4e5f:autoScalingGroupName/gpu-asg"
+	if name := ecspresso.AutoScalingGroupNameOf(arn); name != "gpu-asg" {
+		t.Errorf("unexpected name %s", name)
+	}
+	if name := ecspresso.AutoScalingGroupNameOf("gpu-asg"); name != "gpu-asg" {
+		t.Errorf("unexpected name %s", name)
+	}
+}
+
+func TestIsGPUOptimizedAMI(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"amzn2-ami-ecs-gpu-hvm-2.0.20240131-x86_64-ebs":               true,
+		"al2023-ami-ecs-neuron-hvm-2023.0.20240201-kernel-6.1-x86_64": true,
+		"al2023-ami-ecs-hvm-2023.0.20240201-kernel-6.1-x86_64":        false,
+	} {
+		if got := ecspresso.IsGPUOptimizedAMI(name); got != expected {
+			t.Errorf("IsGPUOptimizedAMI(%s) expected %v, got %v", name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/pkg/errors"
+)
+
+// Formats of the export.
+const (
+	ExportFormatTerraform      = "terraform"
+	ExportFormatCloudFormation = "cloudformation"
+)
+
+type ExportOption struct {
+	Format         *string
+	ScheduledTasks *bool
+}
+
+// mapValueKeys are keys of which values are maps of user defined keys. Keys in the maps are never converted.
+var mapValueKeys = map[string]bool{
+	"options":      true,
+	"dockerLabels": true,
+	"driverOpts":   true,
+	"labels":       true,
+}
+
+// terraformKeys are arguments of the Terraform AWS provider which differ from the snake case of the API.
+var terraformKeys = map[string]string{
+	"serviceName":           "name",
+	"sizeInGiB":             "size_in_gib",
+	"volumes":               "volume",
+	"inferenceAccelerators": "inference_accelerator",
+	"loadBalancers":         "load_balancer",
+	"loadBalancerName":      "elb_name",
+	"placementStrategy":     "ordered_placement_strategy",
+	"PlacementStrategy":     "ordered_placement_strategy",
+	"volumeConfigurations":  "volume_configuration",
+	"services":              "service",
+	"clientAliases":         "client_alias",
+	"secretOptions":         "secret_option",
+	"configuredAtLaunch":    "configure_at_launch",
+}
+
+// cloudFormationKeys are properties of CloudFormation which differ from the capitalized API names.
+var cloudFormationKeys = map[string]string{
+	"efsVolumeConfiguration": "EFSVolumeConfiguration",
+	"fileSystemId":           "FilesystemId",
+	"iam":                    "IAM",
+	"placementStrategy":      "PlacementStrategies",
+	"PlacementStrategy":      "PlacementStrategies",
+	"properties":             "ProxyConfigurationProperties",
+	"awsvpcConfiguration":    "AwsVpcConfiguration",
+}
+
+// serviceStatusKeys are attributes of the running service, not of the definition.
+var serviceStatusKeys = []string{
+	"clusterArn", "serviceArn", "status", "runningCount", "pendingCount",
+	"events", "deployments", "taskSets", "createdAt", "createdBy", "roleArn",
+}
+
+var resourceNameRegex = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// toSnakeCase converts the name in camel case or pascal case into snake case. e.g. enableECSManagedTags -> enable_ecs_managed_tags
+func toSnakeCase(s string) string {
+	rs := []rune(s)
+	var b strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1])
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if prevLower || (unicode.IsUpper(rs[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func toTerraformKey(s string) string {
+	if k, ok := terraformKeys[s]; ok {
+		return k
+	}
+	return toSnakeCase(s)
+}
+
+func toCloudFormationKey(s string) string {
+	if k, ok := cloudFormationKeys[s]; ok {
+		return k
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// convertKeys converts keys of objects in v recursively.
+func convertKeys(v interface{}, conv func(string) string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			if mapValueKeys[k] {
+				m[conv(k)] = val
+			} else {
+				m[conv(k)] = convertKeys(val, conv)
+			}
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = convertKeys(val, conv)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// toGenericJSON converts the API shape into generic JSON values of which keys are same as the API.
+func toGenericJSON(s interface{}) (map[string]interface{}, error) {
+	b, err := MarshalJSON(s)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// tagsToMap converts tags of the API ({key, value} or {Key, Value}) into the map.
+func tagsToMap(v interface{}) map[string]interface{} {
+	tags := map[string]interface{}{}
+	l, _ := v.([]interface{})
+	for _, t := range l {
+		t, _ := t.(map[string]interface{})
+		key, value := t["key"], t["value"]
+		if key == nil {
+			key, value = t["Key"], t["Value"]
+		}
+		if k, ok := key.(string); ok {
+			tags[k] = value
+		}
+	}
+	return tags
+}
+
+// flattenAwsvpcConfiguration converts the network configuration into the block of Terraform.
+func flattenAwsvpcConfiguration(v interface{}) interface{} {
+	nc, _ := v.(map[string]interface{})
+	vpc, _ := nc["awsvpc_configuration"].(map[string]interface{})
+	if vpc == nil {
+		return nil
+	}
+	if ip, ok := vpc["assign_public_ip"].(string); ok {
+		vpc["assign_public_ip"] = ip == ecs.AssignPublicIpEnabled
+	}
+	return vpc
+}
+
+func terraformResourceName(name string) string {
+	name = resourceNameRegex.ReplaceAllString(name, "_")
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+func cloudFormationLogicalID(prefix, name string) string {
+	id := prefix
+	for _, p := range resourceNameRegex.Split(name, -1) {
+		if p != "" {
+			id += strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Replace(id, "_", "", -1)
+}
+
+// exportedScheduledRule represents a scheduled rule and its targets running the task definition family.
+type exportedScheduledRule struct {
+	rule    *eventbridge.DescribeRuleOutput
+	targets []*eventbridge.Target
+}
+
+// exportSources represents definitions to be exported.
+type exportSources struct {
+	taskDefinition map[string]interface{}
+	service        map[string]interface{}
+	rules          []exportedScheduledRule
+}
+
+// Export emits IaC resource definitions equivalent to the configuration.
+func (d *App) Export(opt ExportOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	out, err := d.exportResources(ctx, opt)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal exported resources")
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(b))
+	return err
+}
+
+func (d *App) exportResources(ctx context.Context, opt ExportOption) (map[string]interface{}, error) {
+	switch f := aws.StringValue(opt.Format); f {
+	case ExportFormatTerraform, ExportFormatCloudFormation:
+	default:
+		return nil, errors.Errorf("unknown export format %q. %s or %s is expected", f, ExportFormatTerraform, ExportFormatCloudFormation)
+	}
+	src, err := d.exportSources(ctx, aws.BoolValue(opt.ScheduledTasks))
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(opt.Format) == ExportFormatTerraform {
+		return d.terraformJSON(src)
+	}
+	return d.cloudFormationTemplate(src)
+}
+
+func (d *App) exportSources(ctx context.Context, scheduledTasks bool) (*exportSources, error) {
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return nil, err
+	}
+	// the values are exported as they are, because the redacted task definition can not be applied
+	if MarshalJSONString(d.redactTaskDefinition(td)) != MarshalJSONString(td) {
+		d.Log("WARNING: the exported task definition contains values matching the redaction patterns. keep the output secret")
+	}
+	src := &exportSources{}
+	if src.taskDefinition, err = toGenericJSON(td); err != nil {
+		return nil, errors.Wrap(err, "failed to convert task definition")
+	}
+
+	if d.config.ServiceDefinitionPath != "" {
+		sv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
+		if err != nil {
+			return nil, err
+		}
+		if src.service, err = toGenericJSON(sv); err != nil {
+			return nil, errors.Wrap(err, "failed to convert service definition")
+		}
+		for _, k := range serviceStatusKeys {
+			delete(src.service, k)
+		}
+		src.service["serviceName"] = d.Service
+		src.service["cluster"] = d.Cluster
+	}
+
+	if !scheduledTasks {
+		return src, nil
+	}
+	out, err := d.ecs.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
+		Clusters: aws.StringSlice([]string{d.Cluster}),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe cluster")
+	}
+	if len(out.Clusters) == 0 {
+		return nil, errors.Errorf("cluster %s is not found. use --no-scheduled-tasks to export without scheduled tasks", d.Cluster)
+	}
+	clusterArn := aws.StringValue(out.Clusters[0].ClusterArn)
+	family := aws.StringValue(td.Family)
+	rules, err := d.findScheduledTaskRules(ctx, clusterArn, family)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		rule, err := d.eventbridge.DescribeRuleWithContext(ctx, &eventbridge.DescribeRuleInput{
+			Name: aws.String(r.name),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to describe rule %s", r.name)
+		}
+		targets, err := d.eventbridge.ListTargetsByRuleWithContext(ctx, &eventbridge.ListTargetsByRuleInput{
+			Rule: aws.String(r.name),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list targets of rule %s", r.name)
+		}
+		er := exportedScheduledRule{rule: rule}
+		for _, t := range targets.Targets {
+			if t.EcsParameters != nil && taskDefinitionFamily(aws.StringValue(t.EcsParameters.TaskDefinitionArn)) == family {
+				er.targets = append(er.targets, t)
+			}
+		}
+		src.rules = append(src.rules, er)
+	}
+	return src, nil
+}
+
+// terraformJSON returns resources in the JSON configuration syntax of Terraform.
+func (d *App) terraformJSON(src *exportSources) (map[string]interface{}, error) {
+	resources := map[string]map[string]interface{}{}
+	add := func(typ, name string, body map[string]interface{}) string {
+		if resources[typ] == nil {
+			resources[typ] = map[string]interface{}{}
+		}
+		name = terraformResourceName(name)
+		resources[typ][name] = body
+		return typ + "." + name
+	}
+
+	td := map[string]interface{}{}
+	for k, v := range src.taskDefinition {
+		switch k {
+		case "containerDefinitions":
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to marshal container definitions")
+			}
+			td["container_definitions"] = string(b)
+		case "tags":
+			td["tags"] = tagsToMap(v)
+		case "proxyConfiguration":
+			pc := convertKeys(v, toTerraformKey).(map[string]interface{})
+			props := map[string]interface{}{}
+			l, _ := pc["properties"].([]interface{})
+			for _, p := range l {
+				p, _ := p.(map[string]interface{})
+				if name, ok := p["name"].(string); ok {
+					props[name] = p["value"]
+				}
+			}
+			pc["properties"] = props
+			td["proxy_configuration"] = pc
+		case "volumes":
+			vols := convertKeys(v, toTerraformKey).([]interface{})
+			for _, vol := range vols {
+				vol := vol.(map[string]interface{})
+				if host, ok := vol["host"].(map[string]interface{}); ok {
+					delete(vol, "host")
+					if p, ok := host["source_path"]; ok {
+						vol["host_path"] = p
+					}
+				}
+			}
+			td["volume"] = vols
+		default:
+			td[toTerraformKey(k)] = convertKeys(v, toTerraformKey)
+		}
+	}
+	family, _ := src.taskDefinition["family"].(string)
+	tdRef := add("aws_ecs_task_definition", family, td)
+
+	if src.service != nil {
+		sv := map[string]interface{}{}
+		for k, v := range src.service {
+			switch k {
+			case "taskDefinition":
+			case "tags":
+				sv["tags"] = tagsToMap(v)
+			case "networkConfiguration":
+				if vpc := flattenAwsvpcConfiguration(convertKeys(v, toTerraformKey)); vpc != nil {
+					sv["network_configuration"] = vpc
+				}
+			case "deploymentConfiguration":
+				dc := convertKeys(v, toTerraformKey).(map[string]interface{})
+				for dk, dv := range dc {
+					switch dk {
+					case "maximum_percent", "minimum_healthy_percent":
+						sv["deployment_"+dk] = dv
+					case "deployment_circuit_breaker", "alarms":
+						sv[dk] = dv
+					}
+				}
+			default:
+				sv[toTerraformKey(k)] = convertKeys(v, toTerraformKey)
+			}
+		}
+		sv["task_definition"] = "${" + tdRef + ".arn}"
+		add("aws_ecs_service", d.Service, sv)
+	}
+
+	for _, r := range src.rules {
+		name := aws.StringValue(r.rule.Name)
+		rule := map[string]interface{}{"name": name}
+		for k, v := range map[string]*string{
+			"description":         r.rule.Description,
+			"schedule_expression": r.rule.ScheduleExpression,
+			"event_pattern":       r.rule.EventPattern,
+			"state":               r.rule.State,
+			"role_arn":            r.rule.RoleArn,
+		} {
+			if v != nil {
+				rule[k] = aws.StringValue(v)
+			}
+		}
+		ruleRef := add("aws_cloudwatch_event_rule", name, rule)
+		for _, t := range r.targets {
+			tm, err := toGenericJSON(t)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to convert target")
+			}
+			target := map[string]interface{}{}
+			for k, v := range tm {
+				switch k {
+				case "Id":
+					target["target_id"] = v
+				case "EcsParameters":
+					target["ecs_target"] = terraformECSTarget(v, tdRef)
+				default:
+					target[toTerraformKey(k)] = convertKeys(v, toTerraformKey)
+				}
+			}
+			target["rule"] = "${" + ruleRef + ".name}"
+			add("aws_cloudwatch_event_target", name+"_"+aws.StringValue(t.Id), target)
+		}
+	}
+	return map[string]interface{}{"resource": resources}, nil
+}
+
+func terraformECSTarget(v interface{}, tdRef string) map[string]interface{} {
+	p, _ := v.(map[string]interface{})
+	target := map[string]interface{}{}
+	for k, v := range p {
+		switch k {
+		case "TaskDefinitionArn":
+			target["task_definition_arn"] = "${" + tdRef + ".arn}"
+		case "Tags":
+			target["tags"] = tagsToMap(v)
+		case "NetworkConfiguration":
+			if vpc := flattenAwsvpcConfiguration(convertKeys(v, toTerraformKey)); vpc != nil {
+				target["network_configuration"] = vpc
+			}
+		case "PlacementConstraints":
+			target["placement_constraint"] = convertKeys(v, toTerraformKey)
+		default:
+			target[toTerraformKey(k)] = convertKeys(v, toTerraformKey)
+		}
+	}
+	return target
+}
+
+// cloudFormationTemplate returns the template of CloudFormation.
+func (d *App) cloudFormationTemplate(src *exportSources) (map[string]interface{}, error) {
+	resources := map[string]interface{}{}
+	props := func(m map[string]interface{}) map[string]interface{} {
+		return convertKeys(m, toCloudFormationKey).(map[string]interface{})
+	}
+
+	resources["TaskDefinition"] = map[string]interface{}{
+		"Type":       "AWS::ECS::TaskDefinition",
+		"Properties": props(src.taskDefinition),
+	}
+	tdRef := map[string]interface{}{"Ref": "TaskDefinition"}
+
+	if src.service != nil {
+		sv := props(src.service)
+		sv["TaskDefinition"] = tdRef
+		if nc, ok := sv["NetworkConfiguration"].(map[string]interface{}); ok {
+			// AWS::ECS::Service spells AwsvpcConfiguration unlike AWS::Events::Rule
+			if vpc, ok := nc["AwsVpcConfiguration"]; ok {
+				delete(nc, "AwsVpcConfiguration")
+				nc["AwsvpcConfiguration"] = vpc
+			}
+		}
+		resources["Service"] = map[string]interface{}{
+			"Type":       "AWS::ECS::Service",
+			"Properties": sv,
+		}
+	}
+
+	for _, r := range src.rules {
+		rule := map[string]interface{}{"Name": aws.StringValue(r.rule.Name)}
+		for k, v := range map[string]*string{
+			"Description":        r.rule.Description,
+			"ScheduleExpression": r.rule.ScheduleExpression,
+			"State":              r.rule.State,
+			"RoleArn":            r.rule.RoleArn,
+		} {
+			if v != nil {
+				rule[k] = aws.StringValue(v)
+			}
+		}
+		if p := aws.StringValue(r.rule.EventPattern); p != "" {
+			var pattern interface{}
+			if err := json.Unmarshal([]byte(p), &pattern); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse the event pattern of rule %s", aws.StringValue(r.rule.Name))
+			}
+			rule["EventPattern"] = pattern
+		}
+		var targets []interface{}
+		for _, t := range r.targets {
+			tm, err := toGenericJSON(t)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to convert target")
+			}
+			target := props(tm)
+			if p, ok := target["EcsParameters"].(map[string]interface{}); ok {
+				p["TaskDefinitionArn"] = tdRef
+			}
+			targets = append(targets, target)
+		}
+		rule["Targets"] = targets
+		resources[cloudFormationLogicalID("Rule", aws.StringValue(r.rule.Name))] = map[string]interface{}{
+			"Type":       "AWS::Events::Rule",
+			"Properties": rule,
+		}
+	}
+	return map[string]interface{}{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Description":              fmt.Sprintf("ECS resources of %s/%s exported by ecspresso", d.Cluster, d.Service),
+		"Resources":                resources,
+	}, nil
+}
@@ -0,0 +1,226 @@
+package ecspresso_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/kayac/ecspresso"
+)
+
+type fakeExportECS struct {
+	fakeECS
+}
+
+func (f *fakeExportECS) DescribeClustersWithContext(_ aws.Context, in *ecs.DescribeClustersInput, _ ...request.Option) (*ecs.DescribeClustersOutput, error) {
+	return &ecs.DescribeClustersOutput{Clusters: []*ecs.Cluster{{
+		ClusterName: in.Clusters[0],
+		ClusterArn:  aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/" + aws.StringValue(in.Clusters[0])),
+	}}}, nil
+}
+
+type fakeExportEventBridge struct {
+	fakeScheduledTaskEventBridge
+}
+
+func (f *fakeExportEventBridge) ListRuleNamesByTargetWithContext(_ aws.Context, _ *eventbridge.ListRuleNamesByTargetInput, _ ...request.Option) (*eventbridge.ListRuleNamesByTargetOutput, error) {
+	return &eventbridge.ListRuleNamesByTargetOutput{RuleNames: aws.StringSlice([]string{"nightly-batch"})}, nil
+}
+
+func TestToSnakeCase(t *testing.T) {
+	for s, expected := range map[string]string{
+		"family":               "family",
+		"enableECSManagedTags": "enable_ecs_managed_tags",
+		"TaskDefinitionArn":    "task_definition_arn",
+		"managedEBSVolume":     "managed_ebs_volume",
+		"awsvpcConfiguration":  "awsvpc_configuration",
+		"ipv6Address":          "ipv6_address",
+	} {
+		if got := ecspresso.ToSnakeCase(s); got != expected {
+			t.Errorf("unexpected snake case of %s: %s expected %s", s, got, expected)
+		}
+	}
+}
+
+// lookup returns the value at the path of keys in the generic JSON.
+func lookup(t *testing.T, v interface{}, keys ...string) interface{} {
+	t.Helper()
+	b, _ := json.Marshal(v)
+	var m interface{}
+	json.Unmarshal(b, &m)
+	for _, k := range keys {
+		o, ok := m.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s is not found in %s", k, string(b))
+		}
+		m = o[k]
+	}
+	return m
+}
+
+func newExportApp(t *testing.T) *ecspresso.App {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	target := testScheduledTaskTarget("batch")
+	target.EcsParameters.TaskDefinitionArn = aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/katsubushi:3")
+	eb := &fakeExportEventBridge{fakeScheduledTaskEventBridge{targets: []*eventbridge.Target{
+		target,
+		{Id: aws.String("other"), EcsParameters: &eventbridge.EcsParameters{TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/other:1")}},
+	}}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: &fakeExportECS{}, EventBridge: eb})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestExportTerraform(t *testing.T) {
+	app := newExportApp(t)
+	out, err := app.ExportResources(context.Background(), ecspresso.ExportOption{
+		Format:         aws.String(ecspresso.ExportFormatTerraform),
+		ScheduledTasks: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := lookup(t, out, "resource", "aws_ecs_task_definition", "katsubushi")
+	if lookup(t, td, "family") != "katsubushi" || lookup(t, td, "ephemeral_storage", "size_in_gib") != 25.0 {
+		t.Errorf("unexpected task definition %v", td)
+	}
+	var containers []map[string]interface{}
+	if err := json.Unmarshal([]byte(lookup(t, td, "container_definitions").(string)), &containers); err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0]["name"] != "katsubushi" || lookup(t, containers[0], "logConfiguration", "options", "awslogs-group") != "fargate" {
+		t.Errorf("container definitions must be a JSON string of the API: %v", containers)
+	}
+	if lookup(t, td, "proxy_configuration", "properties", "ProxyIngressPort") != "15000" {
+		t.Errorf("properties of the proxy configuration must be a map: %v", lookup(t, td, "proxy_configuration"))
+	}
+
+	sv := lookup(t, out, "resource", "aws_ecs_service", "test")
+	for k, expected := range map[string]interface{}{
+		"name":            "test",
+		"cluster":         "default2",
+		"task_definition": "${aws_ecs_task_definition.katsubushi.arn}",
+		"desired_count":   2.0,
+		"propagate_tags":  "SERVICE",
+	} {
+		if v := lookup(t, sv, k); v != expected {
+			t.Errorf("unexpected %s of the service: %v", k, v)
+		}
+	}
+	if lookup(t, sv, "network_configuration", "assign_public_ip") != true || lookup(t, sv, "tags", "cluster") != "default2" {
+		t.Errorf("unexpected service %v", sv)
+	}
+	if lbs := lookup(t, sv, "load_balancer").([]interface{}); lookup(t, lbs[0], "container_port") != 9999.0 {
+		t.Errorf("unexpected load balancers %v", lbs)
+	}
+
+	if lookup(t, out, "resource", "aws_cloudwatch_event_rule", "nightly_batch", "schedule_expression") != "cron(0 3 * * ? *)" {
+		t.Errorf("unexpected rules %v", lookup(t, out, "resource", "aws_cloudwatch_event_rule"))
+	}
+	targets := lookup(t, out, "resource", "aws_cloudwatch_event_target").(map[string]interface{})
+	if len(targets) != 1 {
+		t.Fatalf("only targets of the family must be exported: %v", targets)
+	}
+	target := targets["nightly_batch_batch"]
+	for _, c := range []struct {
+		keys     []string
+		expected interface{}
+	}{
+		{[]string{"rule"}, "${aws_cloudwatch_event_rule.nightly_batch.name}"},
+		{[]string{"target_id"}, "batch"},
+		{[]string{"role_arn"}, "arn:aws:iam::123456789012:role/ecsEventsRole"},
+		{[]string{"ecs_target", "task_definition_arn"}, "${aws_ecs_task_definition.katsubushi.arn}"},
+		{[]string{"ecs_target", "launch_type"}, "FARGATE"},
+		{[]string{"ecs_target", "tags", "Job"}, "nightly"},
+	} {
+		if v := lookup(t, target, c.keys...); v != c.expected {
+			t.Errorf("unexpected %v of the target: %v", c.keys, v)
+		}
+	}
+	if subnets := lookup(t, target, "ecs_target", "network_configuration", "subnets").([]interface{}); subnets[0] != "subnet-1" {
+		t.Errorf("unexpected subnets %v", subnets)
+	}
+}
+
+func TestExportCloudFormation(t *testing.T) {
+	app := newExportApp(t)
+	out, err := app.ExportResources(context.Background(), ecspresso.ExportOption{
+		Format:         aws.String(ecspresso.ExportFormatCloudFormation),
+		ScheduledTasks: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := lookup(t, out, "Resources", "TaskDefinition")
+	if lookup(t, td, "Type") != "AWS::ECS::TaskDefinition" || lookup(t, td, "Properties", "Family") != "katsubushi" {
+		t.Errorf("unexpected task definition %v", td)
+	}
+	containers := lookup(t, td, "Properties", "ContainerDefinitions").([]interface{})
+	if lookup(t, containers[0], "LogConfiguration", "Options", "awslogs-group") != "fargate" || lookup(t, containers[0], "DockerLabels", "name") != "katsubushi" {
+		t.Errorf("keys of maps must be kept: %v", containers[0])
+	}
+	if props := lookup(t, td, "Properties", "ProxyConfiguration", "ProxyConfigurationProperties"); props == nil {
+		t.Errorf("unexpected proxy configuration %v", lookup(t, td, "Properties", "ProxyConfiguration"))
+	}
+
+	sv := lookup(t, out, "Resources", "Service", "Properties")
+	if lookup(t, sv, "TaskDefinition", "Ref") != "TaskDefinition" || lookup(t, sv, "ServiceName") != "test" {
+		t.Errorf("unexpected service %v", sv)
+	}
+	if lookup(t, sv, "NetworkConfiguration", "AwsvpcConfiguration", "AssignPublicIp") != "ENABLED" {
+		t.Errorf("unexpected network configuration %v", lookup(t, sv, "NetworkConfiguration"))
+	}
+
+	rule := lookup(t, out, "Resources", "RuleNightlyBatch", "Properties")
+	targets := lookup(t, rule, "Targets").([]interface{})
+	if len(targets) != 1 || lookup(t, targets[0], "EcsParameters", "TaskDefinitionArn", "Ref") != "TaskDefinition" {
+		t.Errorf("unexpected targets %v", targets)
+	}
+	if subnets := lookup(t, targets[0], "EcsParameters", "NetworkConfiguration", "AwsVpcConfiguration", "Subnets").([]interface{}); subnets[0] != "subnet-1" {
+		t.Errorf("unexpected network configuration of the target %v", subnets)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	app := newExportApp(t)
+	if _, err := app.ExportResources(context.Background(), ecspresso.ExportOption{Format: aws.String("pulumi")}); err == nil {
+		t.Error("unknown format must be an error")
+	}
+}
+
+func TestExportUnredacted(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Redaction = &ecspresso.RedactionConfig{Patterns: []string{"worker_id"}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: &fakeExportECS{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := app.ExportResources(context.Background(), ecspresso.ExportOption{
+		Format:         aws.String(ecspresso.ExportFormatTerraform),
+		ScheduledTasks: aws.Bool(false),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := lookup(t, out, "resource", "aws_ecs_task_definition", "katsubushi")
+	var containers []map[string]interface{}
+	if err := json.Unmarshal([]byte(lookup(t, td, "container_definitions").(string)), &containers); err != nil {
+		t.Fatal(err)
+	}
+	env := containers[0]["environment"].([]interface{})
+	if v := lookup(t, env[0], "value"); v != "3" {
+		t.Errorf("values must be exported without redaction: %v", v)
+	}
+}
@@ -0,0 +1,186 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// iamAction represents an API action that the deploy calls on the resource.
+type iamAction struct {
+	action   string
+	resource string
+}
+
+func (a iamAction) String() string {
+	return a.action + " on " + a.resource
+}
+
+// deployIAMParams represents the configuration of the deploy to plan required IAM actions.
+type deployIAMParams struct {
+	partition    string
+	region       string
+	account      string
+	cluster      string
+	service      string
+	family       string
+	roles        []string
+	tagged       bool
+	codeDeploy   bool
+	autoScaling  bool
+	loadBalanced bool
+}
+
+// deployIAMActions returns IAM actions which the deploy requires.
+func deployIAMActions(p deployIAMParams) []iamAction {
+	prefix := fmt.Sprintf("arn:%s:ecs:%s:%s:", p.partition, p.region, p.account)
+	serviceArn := prefix + "service/" + p.cluster + "/" + p.service
+	actions := []iamAction{
+		{"ecs:RegisterTaskDefinition", "*"},
+		{"ecs:DescribeTaskDefinition", "*"},
+		{"ecs:ListTaskDefinitions", "*"},
+		{"ecs:DescribeServices", serviceArn},
+		{"ecs:UpdateService", serviceArn},
+		{"ecs:ListTasks", "*"},
+		{"ecs:DescribeTasks", "*"},
+		{"application-autoscaling:DescribeScalableTargets", "*"},
+	}
+	if p.tagged {
+		actions = append(actions, iamAction{"ecs:TagResource", prefix + "task-definition/" + p.family + ":*"})
+	}
+	for _, role := range p.roles {
+		actions = append(actions, iamAction{"iam:PassRole", role})
+	}
+	if p.codeDeploy {
+		for _, a := range []string{
+			"ListApplications", "BatchGetApplications", "ListDeploymentGroups", "BatchGetDeploymentGroups",
+			"CreateDeployment", "GetDeployment", "GetDeploymentConfig", "ListDeployments",
+			"RegisterApplicationRevision", "StopDeployment", "ContinueDeployment",
+		} {
+			actions = append(actions, iamAction{"codedeploy:" + a, "*"})
+		}
+	}
+	if p.loadBalanced || p.codeDeploy {
+		for _, a := range []string{"DescribeTargetGroups", "DescribeLoadBalancers", "DescribeListeners"} {
+			actions = append(actions, iamAction{"elasticloadbalancing:" + a, "*"})
+		}
+	}
+	if p.autoScaling {
+		for _, a := range []string{"RegisterScalableTarget", "DescribeScalingPolicies", "PutScalingPolicy", "DescribeScheduledActions", "PutScheduledAction"} {
+			actions = append(actions, iamAction{"application-autoscaling:" + a, "*"})
+		}
+	}
+	return actions
+}
+
+// principalArnForSimulation returns the ARN of the IAM user or role of the caller identity.
+// The role of an assumed role session is resolved by GetRole because the ARN of the session has no path of the role.
+func (d *App) principalArnForSimulation(ctx context.Context, callerArn string) (string, error) {
+	a, err := arn.Parse(callerArn)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(a.Resource, "user/"):
+		return callerArn, nil
+	case strings.HasPrefix(a.Resource, "assumed-role/"):
+		p := strings.Split(a.Resource, "/")
+		out, err := d.iam.GetRoleWithContext(ctx, &iam.GetRoleInput{RoleName: aws.String(p[1])})
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to get role %s", p[1])
+		}
+		return aws.StringValue(out.Role.Arn), nil
+	default:
+		return "", verifySkipErr(fmt.Sprintf("policies of %s can not be simulated", callerArn))
+	}
+}
+
+// simulateIAMActions returns actions denied for the principal.
+func (d *App) simulateIAMActions(ctx context.Context, principal string, actions []iamAction) ([]string, error) {
+	byResource := map[string][]string{}
+	var resources []string
+	for _, a := range actions {
+		if _, ok := byResource[a.resource]; !ok {
+			resources = append(resources, a.resource)
+		}
+		byResource[a.resource] = append(byResource[a.resource], a.action)
+	}
+	var denied []string
+	for _, r := range resources {
+		in := &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principal),
+			ActionNames:     aws.StringSlice(byResource[r]),
+			ContextEntries: []*iam.ContextEntry{{
+				ContextKeyName:   aws.String("iam:PassedToService"),
+				ContextKeyType:   aws.String(iam.ContextKeyTypeEnumString),
+				ContextKeyValues: aws.StringSlice([]string{"ecs-tasks.amazonaws.com"}),
+			}},
+		}
+		if r != "*" {
+			in.ResourceArns = aws.StringSlice([]string{r})
+		}
+		err := d.iam.SimulatePrincipalPolicyPagesWithContext(ctx, in, func(out *iam.SimulatePolicyResponse, _ bool) bool {
+			for _, e := range out.EvaluationResults {
+				if aws.StringValue(e.EvalDecision) == iam.PolicyEvaluationDecisionTypeAllowed {
+					continue
+				}
+				denied = append(denied, fmt.Sprintf("%s (%s)", iamAction{aws.StringValue(e.EvalActionName), r}, aws.StringValue(e.EvalDecision)))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to simulate principal policy")
+		}
+	}
+	sort.Strings(denied)
+	return denied, nil
+}
+
+// verifyIAMPermissions verifies the caller can perform API actions the deploy requires by the IAM policy simulation.
+func (d *App) verifyIAMPermissions(ctx context.Context) error {
+	id, err := d.sts.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get caller identity")
+	}
+	principal, err := d.principalArnForSimulation(ctx, aws.StringValue(id.Arn))
+	if err != nil {
+		return err
+	}
+	a, _ := arn.Parse(aws.StringValue(id.Arn))
+	td := d.verifier.td
+	p := deployIAMParams{
+		partition:   a.Partition,
+		region:      d.config.Region,
+		account:     aws.StringValue(id.Account),
+		cluster:     arnToName(d.Cluster),
+		service:     d.Service,
+		family:      aws.StringValue(td.Family),
+		tagged:      len(td.Tags) > 0,
+		autoScaling: d.config.AutoScalingDefinitionPath != "",
+	}
+	for _, role := range []*string{td.ExecutionRoleArn, td.TaskRoleArn} {
+		if aws.StringValue(role) != "" {
+			p.roles = append(p.roles, aws.StringValue(role))
+		}
+	}
+	if sv := d.verifier.sv; sv != nil {
+		p.codeDeploy = isCodeDeploy(sv.DeploymentController)
+		p.loadBalanced = len(sv.LoadBalancers) > 0
+	}
+	d.DebugLog("simulating policies of", principal)
+	denied, err := d.simulateIAMActions(ctx, principal, deployIAMActions(p))
+	if err != nil {
+		return err
+	}
+	if len(denied) > 0 {
+		return errors.Errorf("%s is not allowed to deploy. denied: %s", principal, strings.Join(denied, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package ecspresso_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/kayac/ecspresso"
+)
+
+type fakeCallerSTS struct {
+	stsiface.STSAPI
+	arn string
+}
+
+func (f *fakeCallerSTS) GetCallerIdentityWithContext(_ aws.Context, _ *sts.GetCallerIdentityInput, _ ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Arn: aws.String(f.arn), Account: aws.String("123456789012")}, nil
+}
+
+type fakeSimulationIAM struct {
+	iamiface.IAMAPI
+	denied    map[string]bool // "action resource"
+	principal string
+	actions   []string
+}
+
+func (f *fakeSimulationIAM) GetRoleWithContext(_ aws.Context, in *iam.GetRoleInput, _ ...request.Option) (*iam.GetRoleOutput, error) {
+	return &iam.GetRoleOutput{Role: &iam.Role{Arn: aws.String("arn:aws:iam::123456789012:role/ci/" + aws.StringValue(in.RoleName))}}, nil
+}
+
+func (f *fakeSimulationIAM) SimulatePrincipalPolicyPagesWithContext(_ aws.Context, in *iam.SimulatePrincipalPolicyInput, fn func(*iam.SimulatePolicyResponse, bool) bool, _ ...request.Option) error {
+	f.principal = aws.StringValue(in.PolicySourceArn)
+	resource := "*"
+	if len(in.ResourceArns) > 0 {
+		resource = aws.StringValue(in.ResourceArns[0])
+	}
+	out := &iam.SimulatePolicyResponse{}
+	for _, a := range aws.StringValueSlice(in.ActionNames) {
+		f.actions = append(f.actions, a+" "+resource)
+		decision := iam.PolicyEvaluationDecisionTypeAllowed
+		if f.denied[a+" "+resource] {
+			decision = iam.PolicyEvaluationDecisionTypeImplicitDeny
+		}
+		out.EvaluationResults = append(out.EvaluationResults, &iam.EvaluationResult{
+			EvalActionName: aws.String(a),
+			EvalDecision:   aws.String(decision),
+		})
+	}
+	fn(out, true)
+	return nil
+}
+
+func testIAMPermissionsApp(t *testing.T, callerArn string, fakeIAM *fakeSimulationIAM) *ecspresso.App {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS: &fakeECS{},
+		IAM: fakeIAM,
+		STS: &fakeCallerSTS{arn: callerArn},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+var testIAMTaskDefinition = &ecspresso.TaskDefinitionInput{
+	Family:           aws.String("test"),
+	ExecutionRoleArn: aws.String("arn:aws:iam::123456789012:role/ecsTaskExecutionRole"),
+	TaskRoleArn:      aws.String("arn:aws:iam::123456789012:role/app"),
+}
+
+func TestVerifyIAMPermissions(t *testing.T) {
+	fakeIAM := &fakeSimulationIAM{denied: map[string]bool{
+		"iam:PassRole arn:aws:iam::123456789012:role/app":                                 true,
+		"ecs:UpdateService arn:aws:ecs:ap-northeast-1:123456789012:service/default2/test": true,
+	}}
+	app := testIAMPermissionsApp(t, "arn:aws:sts::123456789012:assumed-role/deployer/session", fakeIAM)
+	err := app.VerifyIAMPermissions(context.Background(), testIAMTaskDefinition, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if fakeIAM.principal != "arn:aws:iam::123456789012:role/ci/deployer" {
+		t.Errorf("unexpected principal %s", fakeIAM.principal)
+	}
+	for _, s := range []string{
+		"ecs:UpdateService on arn:aws:ecs:ap-northeast-1:123456789012:service/default2/test (implicitDeny)",
+		"iam:PassRole on arn:aws:iam::123456789012:role/app (implicitDeny)",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("%s is not reported: %s", s, err)
+		}
+	}
+	if strings.Contains(err.Error(), "ecsTaskExecutionRole") || strings.Contains(err.Error(), "codedeploy:") {
+		t.Errorf("unexpected denied action: %s", err)
+	}
+}
+
+func TestVerifyIAMPermissionsAllowed(t *testing.T) {
+	fakeIAM := &fakeSimulationIAM{}
+	app := testIAMPermissionsApp(t, "arn:aws:iam::123456789012:user/ci", fakeIAM)
+	sv := &ecspresso.Service{}
+	sv.DeploymentController = &ecs.DeploymentController{Type: aws.String(ecs.DeploymentControllerTypeCodeDeploy)}
+	if err := app.VerifyIAMPermissions(context.Background(), testIAMTaskDefinition, sv); err != nil {
+		t.Fatal(err)
+	}
+	if fakeIAM.principal != "arn:aws:iam::123456789012:user/ci" {
+		t.Errorf("unexpected principal %s", fakeIAM.principal)
+	}
+	for _, action := range []string{"codedeploy:CreateDeployment *", "elasticloadbalancing:DescribeTargetGroups *", "elasticloadbalancing:DescribeListeners *"} {
+		var found bool
+		for _, a := range fakeIAM.actions {
+			if a == action {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s is not simulated: %v", action, fakeIAM.actions)
+		}
+	}
+}
+
+func TestVerifyIAMPermissionsRoot(t *testing.T) {
+	app := testIAMPermissionsApp(t, "arn:aws:iam::123456789012:root", &fakeSimulationIAM{})
+	err := app.VerifyIAMPermissions(context.Background(), testIAMTaskDefinition, nil)
+	if err == nil || !strings.Contains(err.Error(), "can not be simulated") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/kayac/ecspresso/registry"
+	"github.com/pkg/errors"
+)
+
+// imageLabels returns labels of the image config in the registry. Results are cached by the image.
+func (d *App) imageLabels(ctx context.Context, image string) (map[string]string, error) {
+	d.imageLabelsCacheMu.Lock()
+	defer d.imageLabelsCacheMu.Unlock()
+	if labels, ok := d.imageLabelsCache[image]; ok {
+		return labels, nil
+	}
+
+	var user, password string
+	if ecrImageURLRegex.MatchString(image) {
+		out, err := d.ecr.GetAuthorizationTokenWithContext(ctx, &ecr.GetAuthorizationTokenInput{})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get authorization token of ECR")
+		}
+		user, password = "AWS", aws.StringValue(out.AuthorizationData[0].AuthorizationToken)
+	} else {
+		user, password = registryCredentials(image)
+	}
+	url, tag := splitImageTag(image)
+	d.DebugLog(fmt.Sprintf("fetching labels of image=%s tag=%s", url, tag))
+	// ImageLabels of the upstream repository reports errors when the image is not found
+	repo, _, _ := d.findRegistryImage(ctx, registry.New(url, user, password), tag)
+	labels, err := repo.ImageLabels(ctx, tag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get labels of %s", image)
+	}
+	if d.imageLabelsCache == nil {
+		d.imageLabelsCache = map[string]map[string]string{}
+	}
+	d.imageLabelsCache[image] = labels
+	return labels, nil
+}
+
+func (d *App) imageLabel(image, label string) (string, error) {
+	labels, err := d.imageLabels(context.Background(), image)
+	if err != nil {
+		return "", err
+	}
+	v, ok := labels[label]
+	if !ok {
+		return "", errors.Errorf("label %s is not found in %s", label, image)
+	}
+	return v, nil
+}
+
+// imageLabelFuncMap returns template functions to refer labels of container images.
+func (d *App) imageLabelFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"image_label": d.imageLabel,
+	}
+}
+
+// imageLabelNativeFunction returns the Jsonnet native function to refer labels of container images.
+// e.g. std.native('image_label')('nginx:latest', 'org.opencontainers.image.revision')
+func (d *App) imageLabelNativeFunction() *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   "image_label",
+		Params: ast.Identifiers{"image", "label"},
+		Func: func(args []interface{}) (interface{}, error) {
+			image, ok := args[0].(string)
+			if !ok {
+				return nil, errors.New("image_label requires the image as a string")
+			}
+			label, ok := args[1].(string)
+			if !ok {
+				return nil, errors.New("image_label requires the label as a string")
+			}
+			return d.imageLabel(image, label)
+		},
+	}
+}
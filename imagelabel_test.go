@@ -0,0 +1,57 @@
+package ecspresso_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestImageLabel(t *testing.T) {
+	conf := &ecspresso.Config{}
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetImageLabels("nginx:1.25", map[string]string{
+		"org.opencontainers.image.revision": "abc123",
+	})
+
+	dir, err := ioutil.TempDir("", "ecspresso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"td.json":    `{"revision":"{{ image_label "nginx:1.25" "org.opencontainers.image.revision" }}"}`,
+		"td.jsonnet": `{revision: std.native('image_label')('nginx:1.25', 'org.opencontainers.image.revision')}`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		b, err := app.ReadDefinitionFile(path)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !strings.Contains(string(b), `"abc123"`) {
+			t.Errorf("%s: unexpected output %s", name, string(b))
+		}
+	}
+
+	path := filepath.Join(dir, "missing.json")
+	if err := ioutil.WriteFile(path, []byte(`{"v":"{{ image_label "nginx:1.25" "no.such.label" }}"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.ReadDefinitionFile(path); err == nil {
+		t.Error("missing label must be an error")
+	}
+}
@@ -0,0 +1,123 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/pkg/errors"
+)
+
+// Modes of the image tag policy.
+const (
+	ImageTagPolicyWarn  = "warn"
+	ImageTagPolicyError = "error"
+)
+
+var defaultMutableTags = []string{"latest", "stable"}
+
+// ImageTagPolicyConfig represents a configuration of the policy check for mutable image tags.
+type ImageTagPolicyConfig struct {
+	// Mode is warn (default) or error.
+	Mode string `yaml:"mode,omitempty"`
+	// Tags are glob patterns of mutable tags. default: latest, stable
+	Tags []string `yaml:"tags,omitempty"`
+	// ECRTagImmutability checks the tag immutability of ECR repositories in verify.
+	ECRTagImmutability bool `yaml:"ecr_tag_immutability,omitempty"`
+}
+
+func (c *ImageTagPolicyConfig) validate() error {
+	switch c.Mode {
+	case "", ImageTagPolicyWarn, ImageTagPolicyError:
+	default:
+		return errors.Errorf("image_tag_policy.mode must be %s or %s: %s", ImageTagPolicyWarn, ImageTagPolicyError, c.Mode)
+	}
+	for _, p := range c.Tags {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, "invalid pattern in image_tag_policy.tags: %s", p)
+		}
+	}
+	return nil
+}
+
+func (c *ImageTagPolicyConfig) tags() []string {
+	if len(c.Tags) == 0 {
+		return defaultMutableTags
+	}
+	return c.Tags
+}
+
+// mutableImageTag returns the tag of the image when it matches any of the patterns.
+// Images referred by the digest are never mutable.
+func mutableImageTag(image string, patterns []string) string {
+	if strings.Contains(image, "@") {
+		return ""
+	}
+	tag := "latest"
+	// the last colon after the last slash separates the tag (a host may have a port)
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		tag = image[i+1:]
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, tag); ok {
+			return tag
+		}
+	}
+	return ""
+}
+
+func (d *App) imageTagPolicyError(msg string) error {
+	if d.config.ImageTagPolicy.Mode == ImageTagPolicyError {
+		return errors.New(msg)
+	}
+	return verifyWarnErr(msg)
+}
+
+// checkImageTagPolicy checks images in the task definition by the image tag policy before registering it.
+func (d *App) checkImageTagPolicy(td *TaskDefinitionInput) error {
+	p := d.config.ImageTagPolicy
+	if p == nil {
+		return nil
+	}
+	var findings []string
+	for _, c := range td.ContainerDefinitions {
+		if tag := mutableImageTag(aws.StringValue(c.Image), p.tags()); tag != "" {
+			findings = append(findings, fmt.Sprintf("container %s uses the mutable tag %s", aws.StringValue(c.Name), tag))
+		}
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	msg := strings.Join(findings, ", ") + ". deploy by a digest or a versioned tag"
+	if p.Mode == ImageTagPolicyError {
+		return errors.New(msg)
+	}
+	d.Log("WARNING: " + msg)
+	return nil
+}
+
+// verifyImageTagPolicy verifies the image of the container by the image tag policy.
+func (d *App) verifyImageTagPolicy(ctx context.Context, image string) error {
+	p := d.config.ImageTagPolicy
+	if tag := mutableImageTag(image, p.tags()); tag != "" {
+		return d.imageTagPolicyError(fmt.Sprintf("mutable tag %s is used. deploy by a digest or a versioned tag", tag))
+	}
+	if !p.ECRTagImmutability || !ecrImageURLRegex.MatchString(image) {
+		return nil
+	}
+	repo := ecrRepositoryNameOf(image)
+	out, err := d.verifier.ecr.DescribeRepositoriesWithContext(ctx, &ecr.DescribeRepositoriesInput{
+		RegistryId:      aws.String(strings.SplitN(image, ".", 2)[0]),
+		RepositoryNames: aws.StringSlice([]string{repo}),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to describe ECR repository %s", repo)
+	}
+	if len(out.Repositories) > 0 && aws.StringValue(out.Repositories[0].ImageTagMutability) == ecr.ImageTagMutabilityMutable {
+		return d.imageTagPolicyError(fmt.Sprintf("tag immutability of ECR repository %s is disabled", repo))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestMutableImageTag(t *testing.T) {
+	patterns := []string{"latest", "stable", "main-*"}
+	testCases := []struct {
+		image string
+		tag   string
+	}{
+		{image: "nginx", tag: "latest"},
+		{image: "nginx:latest", tag: "latest"},
+		{image: "nginx:1.25", tag: ""},
+		{image: "ghcr.io/kayac/app:stable", tag: "stable"},
+		{image: "localhost:5000/app", tag: "latest"},
+		{image: "localhost:5000/app:v1.2.3", tag: ""},
+		{image: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/app:main-abcdef", tag: "main-abcdef"},
+		{image: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/app@sha256:0123456789abcdef", tag: ""},
+	}
+	for _, tc := range testCases {
+		if tag := ecspresso.MutableImageTag(tc.image, patterns); tag != tc.tag {
+			t.Errorf("%s: expected tag %q, got %q", tc.image, tc.tag, tag)
+		}
+	}
+}
+
+func TestValidateImageTagPolicy(t *testing.T) {
+	for _, c := range []*ecspresso.ImageTagPolicyConfig{
+		{},
+		{Mode: "warn", Tags: []string{"latest", "dev-*"}},
+		{Mode: "error", ECRTagImmutability: true},
+	} {
+		if err := ecspresso.ValidateImageTagPolicy(c); err != nil {
+			t.Errorf("unexpected error %s", err)
+		}
+	}
+	for _, c := range []*ecspresso.ImageTagPolicyConfig{
+		{Mode: "fatal"},
+		{Tags: []string{"[latest"}},
+	} {
+		if err := ecspresso.ValidateImageTagPolicy(c); err == nil {
+			t.Errorf("%#v must be invalid", c)
+		}
+	}
+}
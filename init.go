@@ -1,7 +1,6 @@
 package ecspresso
 
 import (
-	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -35,7 +34,8 @@ var (
 
 func (d *App) Init(opt InitOption) error {
 	config := d.config
-	ctx := context.Background()
+	ctx, cancel := d.Start()
+	defer cancel()
 
 	if *opt.Jsonnet {
 		if ext := filepath.Ext(config.ServiceDefinitionPath); ext == jsonExt {
@@ -0,0 +1,267 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+const (
+	containerInsightsNamespace = "ECS/ContainerInsights"
+	maxMetricDataQueries       = 500
+	defaultMetricsPeriod       = 5 * time.Minute
+)
+
+var containerInsightsMetricNames = map[string]bool{
+	"CpuUtilized":             true,
+	"CpuReserved":             true,
+	"MemoryUtilized":          true,
+	"MemoryReserved":          true,
+	"ContainerCpuUtilized":    true,
+	"ContainerCpuReserved":    true,
+	"ContainerMemoryUtilized": true,
+	"ContainerMemoryReserved": true,
+}
+
+// insightsScope represents the scope of Container Insights metrics: the service, a task or a container in a task.
+type insightsScope struct {
+	taskID    string
+	container string
+}
+
+func (s insightsScope) String() string {
+	switch {
+	case s.taskID == "":
+		return "service"
+	case s.container == "":
+		return s.taskID
+	default:
+		return spcIndent + s.container
+	}
+}
+
+func (s insightsScope) less(o insightsScope) bool {
+	if s.taskID != o.taskID {
+		return s.taskID < o.taskID
+	}
+	return s.container < o.container
+}
+
+// insightsScopeOf returns the scope of the metric. ok is false for metrics of tasks not running or of other dimensions.
+func insightsScopeOf(m *cloudwatch.Metric, running map[string]bool) (scope insightsScope, ok bool) {
+	dims := map[string]string{}
+	for _, d := range m.Dimensions {
+		dims[aws.StringValue(d.Name)] = aws.StringValue(d.Value)
+	}
+	delete(dims, "ClusterName")
+	delete(dims, "ServiceName")
+	scope.taskID, scope.container = dims["TaskId"], dims["ContainerName"]
+	delete(dims, "TaskId")
+	delete(dims, "ContainerName")
+	if len(dims) > 0 {
+		return scope, false
+	}
+	isContainerMetric := strings.HasPrefix(aws.StringValue(m.MetricName), "Container")
+	switch {
+	case scope.taskID == "":
+		return scope, scope.container == "" && !isContainerMetric
+	case !running[scope.taskID]:
+		return scope, false
+	case scope.container == "":
+		return scope, !isContainerMetric
+	default:
+		return scope, isContainerMetric
+	}
+}
+
+// formatInsightsUsage formats the utilization of CPU and memory from averages of metrics.
+func formatInsightsUsage(values map[string]float64) string {
+	var usages []string
+	for _, r := range []struct{ name, title, unit string }{
+		{"Cpu", "cpu", ""},
+		{"Memory", "memory", "MiB"},
+	} {
+		utilized, ok := values[r.name+"Utilized"]
+		if !ok {
+			continue
+		}
+		usage := fmt.Sprintf("%s:%.1f%s", r.title, utilized, r.unit)
+		if reserved := values[r.name+"Reserved"]; reserved > 0 {
+			usage = fmt.Sprintf("%s/%.0f%s (%.1f%%)", strings.TrimSuffix(usage, r.unit), reserved, r.unit, utilized*100/reserved)
+		}
+		usages = append(usages, usage)
+	}
+	return strings.Join(usages, " ")
+}
+
+func containerInsightsEnabled(c *ecs.Cluster) bool {
+	for _, s := range c.Settings {
+		if aws.StringValue(s.Name) == ecs.ClusterSettingNameContainerInsights {
+			v := aws.StringValue(s.Value)
+			return v == "enabled" || v == "enhanced"
+		}
+	}
+	return false
+}
+
+// describeContainerInsights shows average utilization of CPU and memory per service, task and container
+// in the period from Container Insights metrics.
+func (d *App) describeContainerInsights(ctx context.Context, w io.Writer, s *ecs.Service, period time.Duration) error {
+	cluster := arnToName(aws.StringValue(s.ClusterArn))
+	out, err := d.ecs.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
+		Clusters: aws.StringSlice([]string{cluster}),
+		Include:  aws.StringSlice([]string{ecs.ClusterFieldSettings}),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to describe cluster")
+	}
+	if len(out.Clusters) == 0 || !containerInsightsEnabled(out.Clusters[0]) {
+		fmt.Fprintln(w, "ContainerInsights: not enabled on the cluster", cluster)
+		return nil
+	}
+
+	running, err := d.serviceRunningTaskIDs(ctx, s)
+	if err != nil {
+		return err
+	}
+	var metrics []*cloudwatch.Metric
+	var scopes []insightsScope
+	err = d.cloudwatch.ListMetricsPagesWithContext(ctx, &cloudwatch.ListMetricsInput{
+		Namespace: aws.String(containerInsightsNamespace),
+		Dimensions: []*cloudwatch.DimensionFilter{
+			{Name: aws.String("ClusterName"), Value: aws.String(cluster)},
+			{Name: aws.String("ServiceName"), Value: s.ServiceName},
+		},
+		RecentlyActive: aws.String(cloudwatch.RecentlyActivePt3h),
+	}, func(p *cloudwatch.ListMetricsOutput, _ bool) bool {
+		for _, m := range p.Metrics {
+			if !containerInsightsMetricNames[aws.StringValue(m.MetricName)] {
+				continue
+			}
+			if scope, ok := insightsScopeOf(m, running); ok {
+				metrics = append(metrics, m)
+				scopes = append(scopes, scope)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to list Container Insights metrics")
+	}
+	if len(metrics) == 0 {
+		fmt.Fprintln(w, "ContainerInsights: no metrics yet")
+		return nil
+	}
+
+	values, err := d.averageMetrics(ctx, metrics, period)
+	if err != nil {
+		return err
+	}
+	byScope := map[insightsScope]map[string]float64{}
+	for i, m := range metrics {
+		v, ok := values[i]
+		if !ok {
+			continue
+		}
+		if byScope[scopes[i]] == nil {
+			byScope[scopes[i]] = map[string]float64{}
+		}
+		byScope[scopes[i]][strings.TrimPrefix(aws.StringValue(m.MetricName), "Container")] = v
+	}
+	sorted := make([]insightsScope, 0, len(byScope))
+	for scope := range byScope {
+		sorted = append(sorted, scope)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].less(sorted[j]) })
+
+	fmt.Fprintf(w, "ContainerInsights: (average in the last %s)\n", period)
+	for _, scope := range sorted {
+		if usage := formatInsightsUsage(byScope[scope]); usage != "" {
+			fmt.Fprintln(w, spcIndent+scope.String()+" "+usage)
+		}
+	}
+	return nil
+}
+
+// averageMetrics returns averages of the metrics in the period keyed by indexes of the metrics.
+func (d *App) averageMetrics(ctx context.Context, metrics []*cloudwatch.Metric, period time.Duration) (map[int]float64, error) {
+	end := time.Now()
+	seconds := int64(period.Round(time.Minute) / time.Second)
+	if seconds < 60 {
+		seconds = 60
+	}
+	sums := map[int]float64{}
+	counts := map[int]int{}
+	for start := 0; start < len(metrics); start += maxMetricDataQueries {
+		stop := start + maxMetricDataQueries
+		if stop > len(metrics) {
+			stop = len(metrics)
+		}
+		var queries []*cloudwatch.MetricDataQuery
+		for i := start; i < stop; i++ {
+			queries = append(queries, &cloudwatch.MetricDataQuery{
+				Id: aws.String(fmt.Sprintf("m%d", i)),
+				MetricStat: &cloudwatch.MetricStat{
+					Metric: metrics[i],
+					Period: aws.Int64(seconds),
+					Stat:   aws.String(cloudwatch.StatisticAverage),
+				},
+			})
+		}
+		err := d.cloudwatch.GetMetricDataPagesWithContext(ctx, &cloudwatch.GetMetricDataInput{
+			MetricDataQueries: queries,
+			StartTime:         aws.Time(end.Add(-time.Duration(seconds) * time.Second)),
+			EndTime:           aws.Time(end),
+		}, func(p *cloudwatch.GetMetricDataOutput, _ bool) bool {
+			for _, r := range p.MetricDataResults {
+				var i int
+				if _, err := fmt.Sscanf(aws.StringValue(r.Id), "m%d", &i); err != nil {
+					continue
+				}
+				for _, v := range r.Values {
+					sums[i] += aws.Float64Value(v)
+					counts[i]++
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get Container Insights metrics")
+		}
+	}
+	avgs := make(map[int]float64, len(sums))
+	for i, sum := range sums {
+		avgs[i] = sum / float64(counts[i])
+	}
+	return avgs, nil
+}
+
+func (d *App) serviceRunningTaskIDs(ctx context.Context, s *ecs.Service) (map[string]bool, error) {
+	ids := map[string]bool{}
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListTasksWithContext(ctx, &ecs.ListTasksInput{
+			Cluster:       s.ClusterArn,
+			ServiceName:   s.ServiceName,
+			DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+			NextToken:     nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list tasks")
+		}
+		for _, arn := range out.TaskArns {
+			ids[arnToName(aws.StringValue(arn))] = true
+		}
+		if nextToken = out.NextToken; nextToken == nil {
+			return ids, nil
+		}
+	}
+}
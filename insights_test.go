@@ -0,0 +1,149 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+type fakeInsightsECS struct {
+	fakeECS
+	insights string
+}
+
+func (f *fakeInsightsECS) DescribeClustersWithContext(_ aws.Context, in *ecs.DescribeClustersInput, _ ...request.Option) (*ecs.DescribeClustersOutput, error) {
+	return &ecs.DescribeClustersOutput{Clusters: []*ecs.Cluster{{
+		ClusterName: in.Clusters[0],
+		Settings: []*ecs.ClusterSetting{
+			{Name: aws.String(ecs.ClusterSettingNameContainerInsights), Value: aws.String(f.insights)},
+		},
+	}}}, nil
+}
+
+func (f *fakeInsightsECS) ListTasksWithContext(_ aws.Context, _ *ecs.ListTasksInput, _ ...request.Option) (*ecs.ListTasksOutput, error) {
+	return &ecs.ListTasksOutput{TaskArns: aws.StringSlice([]string{
+		"arn:aws:ecs:ap-northeast-1:123456789012:task/default2/bbbb",
+		"arn:aws:ecs:ap-northeast-1:123456789012:task/default2/aaaa",
+	})}, nil
+}
+
+type fakeInsightsCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+	metrics []*cloudwatch.Metric
+	values  map[string]float64
+}
+
+func insightsMetric(name string, dims ...string) *cloudwatch.Metric {
+	m := &cloudwatch.Metric{
+		Namespace:  aws.String("ECS/ContainerInsights"),
+		MetricName: aws.String(name),
+		Dimensions: []*cloudwatch.Dimension{
+			{Name: aws.String("ClusterName"), Value: aws.String("default2")},
+			{Name: aws.String("ServiceName"), Value: aws.String("test")},
+		},
+	}
+	for i := 0; i < len(dims); i += 2 {
+		m.Dimensions = append(m.Dimensions, &cloudwatch.Dimension{Name: aws.String(dims[i]), Value: aws.String(dims[i+1])})
+	}
+	return m
+}
+
+func insightsMetricKey(m *cloudwatch.Metric) string {
+	key := aws.StringValue(m.MetricName)
+	for _, d := range m.Dimensions[2:] {
+		key += "," + aws.StringValue(d.Value)
+	}
+	return key
+}
+
+func (f *fakeInsightsCloudWatch) ListMetricsPagesWithContext(_ aws.Context, _ *cloudwatch.ListMetricsInput, fn func(*cloudwatch.ListMetricsOutput, bool) bool, _ ...request.Option) error {
+	fn(&cloudwatch.ListMetricsOutput{Metrics: f.metrics}, true)
+	return nil
+}
+
+func (f *fakeInsightsCloudWatch) GetMetricDataPagesWithContext(_ aws.Context, in *cloudwatch.GetMetricDataInput, fn func(*cloudwatch.GetMetricDataOutput, bool) bool, _ ...request.Option) error {
+	out := &cloudwatch.GetMetricDataOutput{}
+	for _, q := range in.MetricDataQueries {
+		if v, ok := f.values[insightsMetricKey(q.MetricStat.Metric)]; ok {
+			out.MetricDataResults = append(out.MetricDataResults, &cloudwatch.MetricDataResult{
+				Id:     q.Id,
+				Values: aws.Float64Slice([]float64{v, v + 2}),
+			})
+		}
+	}
+	fn(out, true)
+	return nil
+}
+
+func TestDescribeContainerInsights(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	sv := &ecs.Service{
+		ServiceName: aws.String("test"),
+		ClusterArn:  aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+	}
+	cw := &fakeInsightsCloudWatch{
+		metrics: []*cloudwatch.Metric{
+			insightsMetric("CpuUtilized"),
+			insightsMetric("CpuReserved"),
+			insightsMetric("MemoryUtilized"),
+			insightsMetric("CpuUtilized", "TaskId", "bbbb"),
+			insightsMetric("CpuUtilized", "TaskId", "aaaa"),
+			insightsMetric("CpuReserved", "TaskId", "aaaa"),
+			insightsMetric("ContainerMemoryUtilized", "TaskId", "aaaa", "ContainerName", "app"),
+			insightsMetric("ContainerMemoryReserved", "TaskId", "aaaa", "ContainerName", "app"),
+			insightsMetric("CpuUtilized", "TaskId", "stopped"),
+			insightsMetric("StorageReadBytes", "TaskId", "aaaa"),
+		},
+		values: map[string]float64{
+			"CpuUtilized":                      99,
+			"CpuReserved":                      512,
+			"MemoryUtilized":                   299,
+			"CpuUtilized,bbbb":                 9,
+			"CpuUtilized,aaaa":                 127,
+			"CpuReserved,aaaa":                 255,
+			"ContainerMemoryUtilized,aaaa,app": 255,
+			"ContainerMemoryReserved,aaaa,app": 511,
+			"CpuUtilized,stopped":              1,
+		},
+	}
+
+	for _, insights := range []string{"enabled", "disabled"} {
+		app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+			ECS:        &fakeInsightsECS{insights: insights},
+			CloudWatch: cw,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := app.DescribeContainerInsights(context.Background(), &b, sv, 10*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		expected := strings.Join([]string{
+			"ContainerInsights: (average in the last 10m0s)",
+			"  service cpu:100.0/513 (19.5%) memory:300.0MiB",
+			"  aaaa cpu:128.0/256 (50.0%)",
+			"    app memory:256.0/512MiB (50.0%)",
+			"  bbbb cpu:10.0",
+			"",
+		}, "\n")
+		if insights == "disabled" {
+			expected = "ContainerInsights: not enabled on the cluster default2\n"
+		}
+		if b.String() != expected {
+			t.Errorf("unexpected output with %s:\n%s", insights, b.String())
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/pkg/errors"
+)
+
+// KMS actions required for each usage of the key.
+var (
+	secretsKMSActions           = []string{"kms:Decrypt"}
+	serviceConnectTLSKMSActions = []string{"kms:Encrypt", "kms:Decrypt", "kms:GenerateDataKey"}
+	ebsKMSActions               = []string{"kms:CreateGrant", "kms:GenerateDataKeyWithoutPlaintext", "kms:ReEncryptFrom", "kms:ReEncryptTo", "kms:Decrypt"}
+)
+
+// verifyKMSKey verifies the KMS key is enabled, and the actions are allowed for the role
+// by IAM policy simulation with the key policy.
+func (d *App) verifyKMSKey(ctx context.Context, keyID string, roleArn string, actions []string) error {
+	out, err := d.verifier.kms.DescribeKeyWithContext(ctx, &kms.DescribeKeyInput{
+		KeyId: aws.String(keyID),
+	})
+	if err != nil {
+		return err
+	}
+	key := out.KeyMetadata
+	if st := aws.StringValue(key.KeyState); st != kms.KeyStateEnabled {
+		return errors.Errorf("key state is %s", st)
+	}
+	if roleArn == "" || len(actions) == 0 {
+		return nil
+	}
+
+	in := &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(roleArn),
+		ActionNames:     aws.StringSlice(actions),
+		ResourceArns:    []*string{key.Arn},
+	}
+	if p, err := d.verifier.kms.GetKeyPolicyWithContext(ctx, &kms.GetKeyPolicyInput{
+		KeyId:      key.Arn,
+		PolicyName: aws.String("default"),
+	}); err != nil {
+		d.DebugLog("unable to get the key policy. simulating without the key policy", err)
+	} else {
+		in.ResourcePolicy = p.Policy
+		in.ResourceOwner = aws.String(fmt.Sprintf("arn:aws:iam::%s:root", aws.StringValue(key.AWSAccountId)))
+	}
+	sout, err := d.iam.SimulatePrincipalPolicyWithContext(ctx, in)
+	if err != nil {
+		return errors.Wrap(err, "failed to simulate principal policy")
+	}
+	for _, r := range sout.EvaluationResults {
+		if aws.StringValue(r.EvalDecision) != iam.PolicyEvaluationDecisionTypeAllowed {
+			return errors.Errorf("%s is not allowed for %s (%s)", aws.StringValue(r.EvalActionName), roleArn, aws.StringValue(r.EvalDecision))
+		}
+	}
+	return nil
+}
+
+// verifySecretKMSKey verifies the customer managed key that encrypts the Secrets Manager secret.
+func (d *App) verifySecretKMSKey(ctx context.Context, secretArn string, executionRoleArn string) error {
+	out, err := d.verifier.secretsmanager.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(secretArn),
+	})
+	if err != nil {
+		return err
+	}
+	keyID := aws.StringValue(out.KmsKeyId)
+	if keyID == "" {
+		return verifySkipErr("encrypted by the AWS managed key")
+	}
+	return d.verifyKMSKey(ctx, keyID, executionRoleArn, secretsKMSActions)
+}
+
+// verifyLogGroupKMSKey verifies the KMS key associated with the log group.
+func (d *App) verifyLogGroupKMSKey(ctx context.Context, group string) error {
+	out, err := d.verifier.cwl.DescribeLogGroupsWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(group),
+	})
+	if err != nil {
+		return err
+	}
+	for _, g := range out.LogGroups {
+		if aws.StringValue(g.LogGroupName) != group {
+			continue
+		}
+		keyID := aws.StringValue(g.KmsKeyId)
+		if keyID == "" {
+			return verifySkipErr("not encrypted by KMS key")
+		}
+		// The key is used by CloudWatch Logs service principal, so the key policy can't be simulated.
+		return d.verifyKMSKey(ctx, keyID, "", nil)
+	}
+	return verifySkipErr(fmt.Sprintf("log group %s is not found", group))
+}
+
+// verifyVolumeConfiguration verifies the infrastructure role and the KMS key of the managed EBS volume.
+func (d *App) verifyVolumeConfiguration(ctx context.Context, vc *ecs.ServiceVolumeConfiguration) error {
+	ebs := vc.ManagedEBSVolume
+	if ebs == nil {
+		return nil
+	}
+	roleArn := aws.StringValue(ebs.RoleArn)
+	if roleArn == "" {
+		return errors.New("managedEBSVolume.roleArn is required")
+	}
+	err := d.verifyResource(ctx, fmt.Sprintf("InfrastructureRole[%s]", roleArn), func(ctx context.Context) error {
+		return d.verifyRoleAssumedBy(ctx, roleArn, "ecs.amazonaws.com")
+	})
+	if err != nil {
+		return err
+	}
+	if keyID := aws.StringValue(ebs.KmsKeyId); keyID != "" {
+		err := d.verifyResource(ctx, fmt.Sprintf("KMSKey[%s]", keyID), func(ctx context.Context) error {
+			return d.verifyKMSKey(ctx, keyID, roleArn, ebsKMSActions)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isSecretsManagerArn(s string) bool {
+	return strings.HasPrefix(s, "arn:aws:secretsmanager:")
+}
+
+// secretsManagerSecretArn truncates additional params in secretsmanager Arn.
+// https://docs.aws.amazon.com/AmazonECS/latest/developerguide/specifying-sensitive-data-secrets.html
+func secretsManagerSecretArn(valueFrom string) (string, error) {
+	part := strings.Split(valueFrom, ":")
+	if len(part) < 7 {
+		return "", errors.New("invalid arn format")
+	}
+	return strings.Join(part[0:7], ":"), nil
+}
@@ -0,0 +1,46 @@
+package ecspresso
+
+import "reflect"
+
+// New creates an App from the configuration for using ecspresso as a Go library.
+//
+//	conf := ecspresso.NewDefaultConfig()
+//	if err := conf.Load("ecspresso.yml"); err != nil {
+//		return err
+//	}
+//	app, err := ecspresso.New(conf)
+//	if err != nil {
+//		return err
+//	}
+//	defer app.Shutdown()
+//	err = app.DeployWithContext(ctx, ecspresso.DeployOption{})
+//
+// Methods with the WithContext suffix (DeployWithContext, RollbackWithContext,
+// VerifyWithContext and DiffWithContext) accept the context, and don't change
+// the output of the standard logger unlike the methods for the CLI.
+func New(conf *Config) (*App, error) {
+	return NewApp(conf)
+}
+
+// nilMeaningfulOptions are names of *bool and *string fields whose nil means "not specified".
+// e.g. nil SuspendAutoScaling keeps the suspended state of auto scaling, and false resumes it.
+var nilMeaningfulOptions = map[string]bool{
+	"SuspendAutoScaling": true,
+}
+
+// fillNilOptions sets zero values into nil *bool and *string fields of the option struct.
+// Other nil fields (e.g. DesiredCount) and fields in nilMeaningfulOptions have meanings as "not specified",
+// and are left as is.
+func fillNilOptions(opt interface{}) {
+	v := reflect.ValueOf(opt).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.Ptr || !f.IsNil() || !f.CanSet() || nilMeaningfulOptions[v.Type().Field(i).Name] {
+			continue
+		}
+		switch f.Type().Elem().Kind() {
+		case reflect.Bool, reflect.String:
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/kayac/ecspresso"
+)
+
+func TestFillNilOptions(t *testing.T) {
+	opt := ecspresso.DeployOption{
+		UpdateService: aws.Bool(true),
+	}
+	ecspresso.FillNilOptions(&opt)
+	if opt.DryRun == nil || *opt.DryRun {
+		t.Errorf("DryRun must be false %v", opt.DryRun)
+	}
+	if opt.RollbackEvents == nil || *opt.RollbackEvents != "" {
+		t.Errorf("RollbackEvents must be empty %v", opt.RollbackEvents)
+	}
+	if !aws.BoolValue(opt.UpdateService) {
+		t.Error("UpdateService must not be changed")
+	}
+	if opt.DesiredCount != nil {
+		t.Errorf("DesiredCount must be left as nil %d", *opt.DesiredCount)
+	}
+	if opt.SuspendAutoScaling != nil {
+		t.Errorf("SuspendAutoScaling must be left as nil %v", *opt.SuspendAutoScaling)
+	}
+}
+
+func TestNew(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Service != "test" || app.Cluster != "default2" {
+		t.Errorf("unexpected app %s", app.Name())
+	}
+}
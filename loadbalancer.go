@@ -0,0 +1,125 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// recreateServiceSuffix is the suffix of the name of the temporary service which serves while recreating the service.
+const recreateServiceSuffix = "-recreate"
+
+func formatLoadBalancer(lb *ecs.LoadBalancer) string {
+	target := aws.StringValue(lb.LoadBalancerName)
+	if lb.TargetGroupArn != nil {
+		// arn:aws:elasticloadbalancing:REGION:ACCOUNT:targetgroup/NAME/ID
+		target = aws.StringValue(lb.TargetGroupArn)
+		if p := strings.Split(target, "/"); len(p) == 3 {
+			target = p[1]
+		}
+	}
+	return fmt.Sprintf("%s %s:%d", target, aws.StringValue(lb.ContainerName), aws.Int64Value(lb.ContainerPort))
+}
+
+func formatLoadBalancers(lbs []*ecs.LoadBalancer) string {
+	if len(lbs) == 0 {
+		return "(none)"
+	}
+	ss := make([]string, 0, len(lbs))
+	for _, lb := range lbs {
+		ss = append(ss, formatLoadBalancer(lb))
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ", ")
+}
+
+// incompatibleLoadBalancerChange returns the reason why the change of load balancers of the service
+// can not be applied by UpdateService. It returns "" when load balancers are not changed or the change can be applied.
+func incompatibleLoadBalancerChange(current *ecs.Service, next *Service) string {
+	from, to := formatLoadBalancers(current.LoadBalancers), formatLoadBalancers(next.LoadBalancers)
+	if from == to {
+		return ""
+	}
+	change := fmt.Sprintf("load balancers will be changed from [%s] to [%s]", from, to)
+	if isCodeDeploy(current.DeploymentController) {
+		return change + ", but load balancers of the service using the CODE_DEPLOY deployment controller can not be updated"
+	}
+	lbs := make([]*ecs.LoadBalancer, 0, len(current.LoadBalancers)+len(next.LoadBalancers))
+	lbs = append(lbs, current.LoadBalancers...)
+	lbs = append(lbs, next.LoadBalancers...)
+	for _, lb := range lbs {
+		if lb.LoadBalancerName != nil {
+			return change + fmt.Sprintf(", but the service attached to the classic load balancer %s can not be updated", *lb.LoadBalancerName)
+		}
+	}
+	return ""
+}
+
+// recreateService recreates the service by the definition without downtime.
+//  1. create the temporary service by the definition and wait for it to be stable.
+//  2. delete the current service and wait for its tasks to be drained.
+//  3. create the service by the definition again with the same name and wait for it to be stable.
+//  4. delete the temporary service.
+func (d *App) recreateService(ctx context.Context, sv *Service, tdArn string, count *int64) error {
+	tmp := d.Service + recreateServiceSuffix
+	d.Log("Recreating the service with the temporary service", tmp)
+
+	in := newCreateServiceInput(d.Cluster, sv, tdArn, count)
+	in.ServiceName = aws.String(tmp)
+	// the temporary service is not a target of the deployment group of CodeDeploy
+	in.DeploymentController = nil
+	if err := d.createServiceAndWait(ctx, in); err != nil {
+		return errors.Wrapf(err, "failed to create the temporary service %s", tmp)
+	}
+	if err := d.deleteServiceAndWait(ctx, d.Service); err != nil {
+		return errors.Wrapf(err, "failed to delete the service %s. the temporary service %s is serving", d.Service, tmp)
+	}
+	in = newCreateServiceInput(d.Cluster, sv, tdArn, count)
+	in.ServiceName = aws.String(d.Service)
+	if err := d.createServiceAndWait(ctx, in); err != nil {
+		return errors.Wrapf(err, "failed to create the service %s. the temporary service %s is serving", d.Service, tmp)
+	}
+	if err := d.deleteServiceAndWait(ctx, tmp); err != nil {
+		return errors.Wrapf(err, "failed to delete the temporary service %s", tmp)
+	}
+	d.Log("Service is recreated. Completed!")
+	return nil
+}
+
+func (d *App) createServiceAndWait(ctx context.Context, in *ecs.CreateServiceInput) error {
+	name := aws.StringValue(in.ServiceName)
+	d.Log("Creating the service", name)
+	d.DebugLog(in.String())
+	if _, err := d.ecs.CreateServiceWithContext(ctx, in); err != nil {
+		return err
+	}
+	time.Sleep(delayForServiceChanged) // wait for service created
+	d.Log("Waiting for the service", name, "to be stable...")
+	return d.ecs.WaitUntilServicesStableWithContext(
+		ctx,
+		&ecs.DescribeServicesInput{Cluster: aws.String(d.Cluster), Services: []*string{aws.String(name)}},
+		d.waiterOptions(ctx, d.config.phaseTimeout(phaseWait), nil)...,
+	)
+}
+
+func (d *App) deleteServiceAndWait(ctx context.Context, name string) error {
+	d.Log("Deleting the service", name, "and draining its tasks")
+	if _, err := d.ecs.DeleteServiceWithContext(ctx, &ecs.DeleteServiceInput{
+		Cluster: aws.String(d.Cluster),
+		Service: aws.String(name),
+		Force:   aws.Bool(true),
+	}); err != nil {
+		return err
+	}
+	return d.ecs.WaitUntilServicesInactiveWithContext(
+		ctx,
+		&ecs.DescribeServicesInput{Cluster: aws.String(d.Cluster), Services: []*string{aws.String(name)}},
+		d.waiterOptions(ctx, d.config.phaseTimeout(phaseWait), nil)...,
+	)
+}
@@ -0,0 +1,134 @@
+package ecspresso_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestIncompatibleLoadBalancerChange(t *testing.T) {
+	tg := func(name string, port int64) *ecs.LoadBalancer {
+		return &ecs.LoadBalancer{
+			TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:ap-northeast-1:123456789012:targetgroup/" + name + "/1234567890abcdef"),
+			ContainerName:  aws.String("app"),
+			ContainerPort:  aws.Int64(port),
+		}
+	}
+	clb := &ecs.LoadBalancer{
+		LoadBalancerName: aws.String("my-clb"),
+		ContainerName:    aws.String("app"),
+		ContainerPort:    aws.Int64(80),
+	}
+	codeDeploy := &ecs.DeploymentController{Type: aws.String(ecs.DeploymentControllerTypeCodeDeploy)}
+	testCases := []struct {
+		name       string
+		controller *ecs.DeploymentController
+		current    []*ecs.LoadBalancer
+		next       []*ecs.LoadBalancer
+		reason     string
+	}{
+		{name: "not changed", controller: codeDeploy, current: []*ecs.LoadBalancer{tg("a", 80), tg("b", 80)}, next: []*ecs.LoadBalancer{tg("b", 80), tg("a", 80)}},
+		{name: "rolling", current: []*ecs.LoadBalancer{tg("a", 80)}, next: []*ecs.LoadBalancer{tg("a", 8080)}},
+		{name: "code deploy", controller: codeDeploy, current: []*ecs.LoadBalancer{tg("a", 80)}, next: []*ecs.LoadBalancer{tg("a", 8080)}, reason: "from [a app:80] to [a app:8080], but load balancers of the service using the CODE_DEPLOY"},
+		{name: "classic", current: []*ecs.LoadBalancer{clb}, next: []*ecs.LoadBalancer{tg("a", 80)}, reason: "classic load balancer my-clb"},
+		{name: "removed", controller: codeDeploy, current: []*ecs.LoadBalancer{tg("a", 80)}, reason: "to [(none)]"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			current := &ecs.Service{DeploymentController: tc.controller, LoadBalancers: tc.current}
+			next := &ecspresso.Service{}
+			next.LoadBalancers = tc.next
+			reason := ecspresso.IncompatibleLoadBalancerChange(current, next)
+			if tc.reason == "" && reason != "" || !strings.Contains(reason, tc.reason) {
+				t.Errorf("unexpected reason %q", reason)
+			}
+		})
+	}
+}
+
+// fakeRecreateECS records creations and deletions of services.
+type fakeRecreateECS struct {
+	fakeECS
+	calls   []string
+	created *ecs.CreateServiceInput
+}
+
+func (f *fakeRecreateECS) CreateServiceWithContext(_ aws.Context, in *ecs.CreateServiceInput, _ ...request.Option) (*ecs.CreateServiceOutput, error) {
+	f.calls = append(f.calls, "create "+aws.StringValue(in.ServiceName))
+	f.created = in
+	return &ecs.CreateServiceOutput{}, nil
+}
+
+func (f *fakeRecreateECS) DeleteServiceWithContext(_ aws.Context, in *ecs.DeleteServiceInput, _ ...request.Option) (*ecs.DeleteServiceOutput, error) {
+	f.calls = append(f.calls, "delete "+aws.StringValue(in.Service))
+	return &ecs.DeleteServiceOutput{}, nil
+}
+
+func (f *fakeRecreateECS) WaitUntilServicesInactiveWithContext(_ aws.Context, _ *ecs.DescribeServicesInput, _ ...request.WaiterOption) error {
+	return nil
+}
+
+func TestDeployRecreateService(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	for _, recreate := range []bool{false, true} {
+		conf := ecspresso.NewDefaultConfig()
+		if err := conf.Load("tests/test.yaml"); err != nil {
+			t.Fatal(err)
+		}
+		conf.Timeout = time.Minute
+		fake := &fakeRecreateECS{
+			fakeECS: fakeECS{
+				service: &ecs.Service{
+					ServiceName:          aws.String("test"),
+					ClusterArn:           aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+					TaskDefinition:       aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+					DesiredCount:         aws.Int64(2),
+					DeploymentController: &ecs.DeploymentController{Type: aws.String(ecs.DeploymentControllerTypeCodeDeploy)},
+					LoadBalancers: []*ecs.LoadBalancer{{
+						ContainerName:  aws.String("test"),
+						ContainerPort:  aws.Int64(80),
+						TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:us-east-1:1111111111:targetgroup/test/12345678"),
+					}},
+				},
+			},
+		}
+		app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+			ECS:                    fake,
+			ApplicationAutoScaling: &fakeAutoScaling{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.DeployWithContext(context.Background(), ecspresso.DeployOption{
+			UpdateService:   aws.Bool(true),
+			RecreateService: aws.Bool(recreate),
+		})
+		if !recreate {
+			if err == nil || !strings.Contains(err.Error(), "--recreate-service") {
+				t.Errorf("deploy must be failed with the hint: %v", err)
+			}
+			if fake.registered != nil {
+				t.Errorf("the task definition must not be registered %s", fake.registered)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"create test-recreate", "delete test", "create test", "delete test-recreate"}
+		if !reflect.DeepEqual(fake.calls, expected) {
+			t.Errorf("unexpected calls %v", fake.calls)
+		}
+		if fake.updated != nil {
+			t.Errorf("the service must not be updated %s", fake.updated)
+		}
+	}
+}
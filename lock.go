@@ -0,0 +1,119 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+// lockExpirationMargin is added to the timeout for the expiration of the lock.
+// The lock left by the aborted process can be acquired after the expiration.
+const lockExpirationMargin = 5 * time.Minute
+
+// LockConfig represents a configuration of the deployment lock.
+type LockConfig struct {
+	DynamoDBTable string `yaml:"dynamodb_table"`
+}
+
+func (d *App) lockID() string {
+	return fmt.Sprintf("lock/%s/%s", d.Cluster, d.Service)
+}
+
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s:%d:%d", currentUser(), host, os.Getpid(), time.Now().UnixNano())
+}
+
+// acquireLock acquires the advisory lock of the service to prevent concurrent deployments.
+// The returned function releases the lock. When the lock is not configured, it does nothing.
+func (d *App) acquireLock(ctx context.Context, forceUnlock bool) (func(), error) {
+	noop := func() {}
+	if d.config.Lock == nil || d.config.Lock.DynamoDBTable == "" {
+		return noop, nil
+	}
+	table := d.config.Lock.DynamoDBTable
+	id := d.lockID()
+
+	if forceUnlock {
+		d.Log("Releasing the lock forcibly", id)
+		if _, err := d.dynamodb.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(table),
+			Key:       map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+		}); err != nil {
+			return noop, errors.Wrap(err, "failed to release the lock")
+		}
+	}
+
+	owner := lockOwner()
+	now := time.Now()
+	expiresAt := now.Add(d.config.Timeout + lockExpirationMargin)
+	_, err := d.dynamodb.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":          {S: aws.String(id)},
+			"owner":       {S: aws.String(owner)},
+			"acquired_at": {S: aws.String(now.Format(time.RFC3339))},
+			"expires_at":  {N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(id) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return noop, d.lockedError(ctx, table, id)
+		}
+		return noop, errors.Wrap(err, "failed to acquire the lock")
+	}
+	d.Log("Acquired the lock", id)
+
+	release := func() {
+		// the lock must be released even if the context was canceled.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, err := d.dynamodb.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName:           aws.String(table),
+			Key:                 map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+			ConditionExpression: aws.String("#owner = :owner"),
+			ExpressionAttributeNames: map[string]*string{
+				"#owner": aws.String("owner"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":owner": {S: aws.String(owner)},
+			},
+		})
+		if err != nil {
+			d.Log("WARNING: failed to release the lock", id, err)
+			return
+		}
+		d.Log("Released the lock", id)
+	}
+	return release, nil
+}
+
+func (d *App) lockedError(ctx context.Context, table, id string) error {
+	out, err := d.dynamodb.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || out.Item == nil {
+		return errors.Errorf("%s is locked by another deployment. use --force-unlock to release the lock", id)
+	}
+	var owner, acquiredAt string
+	if v := out.Item["owner"]; v != nil {
+		owner = aws.StringValue(v.S)
+	}
+	if v := out.Item["acquired_at"]; v != nil {
+		acquiredAt = aws.StringValue(v.S)
+	}
+	return errors.Errorf("%s is locked by %s since %s. use --force-unlock to release the lock", id, owner, acquiredAt)
+}
@@ -0,0 +1,207 @@
+package ecspresso
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats of log output.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Levels of log records.
+const (
+	logLevelDebug = "debug"
+	logLevelInfo  = "info"
+	logLevelWarn  = "warn"
+	logLevelError = "error"
+)
+
+const warningPrefix = "WARNING: "
+
+// LogFields represents structured fields of a log record.
+// LogFields passed to App.Log are output as fields instead of a part of the message.
+type LogFields map[string]interface{}
+
+// logRecord represents a log record in the JSON log format.
+type logRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Phase     string    `json:"phase,omitempty"`
+	Service   string    `json:"service,omitempty"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Message   string    `json:"message"`
+	Fields    LogFields `json:"fields,omitempty"`
+}
+
+var logMu sync.Mutex
+
+func writeLogRecord(w io.Writer, r *logRecord) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now()
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		// fields may contain values can not be marshaled
+		b, _ = json.Marshal(&logRecord{
+			Timestamp: r.Timestamp,
+			Level:     r.Level,
+			Phase:     r.Phase,
+			Service:   r.Service,
+			Cluster:   r.Cluster,
+			Message:   r.Message,
+			Fields:    LogFields{"error": err.Error()},
+		})
+	}
+	w.Write(append(b, '\n'))
+}
+
+// jsonLogWriter converts lines written by the standard logger into log records.
+type jsonLogWriter struct {
+	w io.Writer
+}
+
+func (w *jsonLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		writeLogRecord(w.w, newLogRecord(logLevelInfo, line, nil))
+	}
+	return len(p), nil
+}
+
+func newLogRecord(level, msg string, fields LogFields) *logRecord {
+	if level == logLevelInfo && strings.HasPrefix(msg, warningPrefix) {
+		level = logLevelWarn
+		msg = strings.TrimPrefix(msg, warningPrefix)
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+	return &logRecord{Level: level, Message: msg, Fields: fields}
+}
+
+// splitLogArgs separates LogFields from arguments of the message.
+func splitLogArgs(v []interface{}) ([]interface{}, LogFields) {
+	args := make([]interface{}, 0, len(v))
+	fields := LogFields{}
+	for _, a := range v {
+		if f, ok := a.(LogFields); ok {
+			for k, v := range f {
+				fields[k] = v
+			}
+			continue
+		}
+		args = append(args, a)
+	}
+	return args, fields
+}
+
+// formatLogFields formats fields as key=value in the text log format.
+func formatLogFields(fields LogFields) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s := make([]string, 0, len(keys))
+	for _, k := range keys {
+		s = append(s, fmt.Sprintf("%s=%v", k, fields[k]))
+	}
+	return strings.Join(s, " ")
+}
+
+func (d *App) jsonLog() bool {
+	return d.LogFormat == LogFormatJSON
+}
+
+// setupLogger sets the output of the standard logger by the log format.
+func (d *App) setupLogger() {
+	if d.jsonLog() {
+		log.SetFlags(0)
+		log.SetOutput(&jsonLogWriter{w: os.Stdout})
+		return
+	}
+	log.SetOutput(os.Stdout)
+}
+
+func (d *App) log(level string, v ...interface{}) {
+	args, fields := splitLogArgs(v)
+	if d.Verbosity <= VerbosityQuiet && level == logLevelInfo && !isWarningMessage(args) {
+		return
+	}
+	if !d.jsonLog() {
+		args = append([]interface{}{d.Name()}, args...)
+		if len(fields) > 0 {
+			args = append(args, formatLogFields(fields))
+		}
+		log.Println(args...)
+		return
+	}
+	r := newLogRecord(level, strings.TrimRight(fmt.Sprintln(args...), " \n"), fields)
+	r.Phase = d.currentPhase()
+	r.Service = d.Service
+	r.Cluster = d.Cluster
+	writeLogRecord(os.Stdout, r)
+}
+
+// LogFailed logs the error of the command.
+func (d *App) LogFailed(command string, err error) {
+	msg := fmt.Sprintf("%s FAILED. %s", command, err)
+	if !d.jsonLog() {
+		log.Println(msg)
+		return
+	}
+	r := newLogRecord(logLevelError, msg, LogFields{"command": command})
+	r.Phase = d.currentPhase()
+	r.Service = d.Service
+	r.Cluster = d.Cluster
+	writeLogRecord(os.Stdout, r)
+}
+
+func (d *App) currentPhase() string {
+	d.phaseMu.Lock()
+	defer d.phaseMu.Unlock()
+	return d.phase
+}
+
+// enterPhase sets the current phase and returns a function to restore the previous phase.
+func (d *App) enterPhase(name string) func() {
+	d.phaseMu.Lock()
+	defer d.phaseMu.Unlock()
+	prev := d.phase
+	d.phase = name
+	return func() {
+		d.phaseMu.Lock()
+		defer d.phaseMu.Unlock()
+		d.phase = prev
+	}
+}
+
+// phaseSpan restores the phase of logs when the span ends.
+// The elapsed time of the phase is logged in the verbose mode unless timing is nil.
+type phaseSpan struct {
+	trace.Span
+	restore   func()
+	startedAt time.Time
+	timing    func(time.Duration)
+}
+
+func (s *phaseSpan) End(options ...trace.SpanEndOption) {
+	s.restore()
+	if s.timing != nil {
+		s.timing(time.Since(s.startedAt))
+	}
+	s.Span.End(options...)
+}
@@ -0,0 +1,51 @@
+package ecspresso_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestJSONLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := ecspresso.NewJSONLogWriter(&buf)
+	w.Write([]byte("WARNING: something wrong\nhello world\n"))
+
+	expected := []struct {
+		level   string
+		message string
+	}{
+		{"warn", "something wrong"},
+		{"info", "hello world"},
+	}
+	scanner := bufio.NewScanner(&buf)
+	var i int
+	for ; scanner.Scan(); i++ {
+		var r map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid json %s: %s", scanner.Text(), err)
+		}
+		if i >= len(expected) {
+			t.Fatalf("unexpected record %s", scanner.Text())
+		}
+		if r["level"] != expected[i].level || r["message"] != expected[i].message {
+			t.Errorf("unexpected record %s", scanner.Text())
+		}
+		if _, ok := r["timestamp"]; !ok {
+			t.Errorf("no timestamp in %s", scanner.Text())
+		}
+	}
+	if i != len(expected) {
+		t.Errorf("unexpected number of records %d", i)
+	}
+}
+
+func TestFormatLogFields(t *testing.T) {
+	s := ecspresso.FormatLogFields(ecspresso.LogFields{"revision": 3, "family": "app"})
+	if s != "family=app revision=3" {
+		t.Errorf("unexpected fields %s", s)
+	}
+}
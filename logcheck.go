@@ -0,0 +1,277 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// Defaults of the log check.
+const (
+	DefaultLogCheckDuration = time.Minute
+	DefaultLogCheckInterval = 10 * time.Second
+)
+
+// LogCheckConfig represents a configuration of the check of logs of new tasks after a rolling deployment.
+type LogCheckConfig struct {
+	// Duration is the duration to watch logs after the service is stable.
+	Duration time.Duration `yaml:"duration,omitempty"`
+	// Interval is the interval of polling log events.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// ErrorPatterns are regular expressions which fail the deployment when appeared in the logs.
+	ErrorPatterns []string `yaml:"error_patterns,omitempty"`
+	// ReadinessPattern is a regular expression which must appear in the logs of every new task in the duration.
+	ReadinessPattern string `yaml:"readiness_pattern,omitempty"`
+	// Containers are names of containers to watch. All containers using the awslogs log driver by default.
+	Containers []string `yaml:"containers,omitempty"`
+}
+
+func (c *LogCheckConfig) validate() error {
+	if len(c.ErrorPatterns) == 0 && c.ReadinessPattern == "" {
+		return errors.New("log_check requires error_patterns or readiness_pattern")
+	}
+	if c.Duration < 0 || c.Interval < 0 {
+		return errors.New("durations in log_check must be positive")
+	}
+	_, err := c.matcher()
+	return err
+}
+
+func (c *LogCheckConfig) duration() time.Duration {
+	if c.Duration > 0 {
+		return c.Duration
+	}
+	return DefaultLogCheckDuration
+}
+
+func (c *LogCheckConfig) interval() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return DefaultLogCheckInterval
+}
+
+// logMatcher matches log messages with the error patterns and the readiness pattern.
+type logMatcher struct {
+	errors    []*regexp.Regexp
+	readiness *regexp.Regexp
+}
+
+func (c *LogCheckConfig) matcher() (*logMatcher, error) {
+	m := &logMatcher{}
+	for _, p := range c.ErrorPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid log_check.error_patterns %q", p)
+		}
+		m.errors = append(m.errors, re)
+	}
+	if c.ReadinessPattern != "" {
+		re, err := regexp.Compile(c.ReadinessPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid log_check.readiness_pattern %q", c.ReadinessPattern)
+		}
+		m.readiness = re
+	}
+	return m, nil
+}
+
+// match returns the error pattern matching the message, and whether the message matches the readiness pattern.
+func (m *logMatcher) match(message string) (string, bool) {
+	for _, re := range m.errors {
+		if re.MatchString(message) {
+			return re.String(), false
+		}
+	}
+	return "", m.readiness != nil && m.readiness.MatchString(message)
+}
+
+// logCheckContainer represents the log group and the stream prefix of a container to watch.
+type logCheckContainer struct {
+	name   string
+	group  string
+	prefix string
+}
+
+// logCheckContainers returns containers using the awslogs log driver with the stream prefix.
+// Only the named containers are returned when names are specified.
+func logCheckContainers(cds []*ecs.ContainerDefinition, names []string) ([]logCheckContainer, error) {
+	want := map[string]bool{}
+	for _, name := range names {
+		want[name] = true
+	}
+	var containers []logCheckContainer
+	for _, cd := range cds {
+		name := aws.StringValue(cd.Name)
+		if len(want) > 0 && !want[name] {
+			continue
+		}
+		delete(want, name)
+		lc := cd.LogConfiguration
+		if lc == nil || aws.StringValue(lc.LogDriver) != ecs.LogDriverAwslogs ||
+			aws.StringValue(lc.Options["awslogs-group"]) == "" || aws.StringValue(lc.Options["awslogs-stream-prefix"]) == "" {
+			if len(names) > 0 {
+				return nil, errors.Errorf("container %s does not use the awslogs log driver with awslogs-stream-prefix", name)
+			}
+			continue
+		}
+		containers = append(containers, logCheckContainer{
+			name:   name,
+			group:  aws.StringValue(lc.Options["awslogs-group"]),
+			prefix: aws.StringValue(lc.Options["awslogs-stream-prefix"]),
+		})
+	}
+	for name := range want {
+		return nil, errors.Errorf("container %s is not found in the task definition", name)
+	}
+	return containers, nil
+}
+
+// logCheckStream represents a log stream of a container of a new task.
+type logCheckStream struct {
+	taskID    string
+	container string
+	group     string
+	name      string
+	nextToken *string
+}
+
+// checkTaskLogs watches logs of tasks of the task definition since the time for the duration.
+// It fails when an error pattern appears in the logs, or when the readiness pattern does not appear in logs of some tasks.
+func (d *App) checkTaskLogs(ctx context.Context, tdArn string, since time.Time) error {
+	c := d.config.LogCheck
+	m, err := c.matcher()
+	if err != nil {
+		return err
+	}
+	td, err := d.DescribeTaskDefinition(ctx, tdArn)
+	if err != nil {
+		return errors.Wrap(err, "failed to describe task definition")
+	}
+	containers, err := logCheckContainers(td.ContainerDefinitions, c.Containers)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		d.Log("WARNING: no containers use the awslogs log driver with awslogs-stream-prefix. skipping the log check")
+		return nil
+	}
+
+	d.Log(fmt.Sprintf("Checking logs of new tasks for %s...", c.duration()))
+	streams := map[string]*logCheckStream{}
+	ready := map[string]bool{}
+	deadline := time.Now().Add(c.duration())
+	for {
+		tasks, err := d.listServiceTasks(ctx)
+		if err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			if aws.StringValue(task.TaskDefinitionArn) != tdArn {
+				continue
+			}
+			id := arnToName(aws.StringValue(task.TaskArn))
+			if _, ok := ready[id]; !ok {
+				ready[id] = false
+			}
+			for _, ct := range containers {
+				name := strings.Join([]string{ct.prefix, ct.name, id}, "/")
+				if _, ok := streams[ct.group+":"+name]; !ok {
+					streams[ct.group+":"+name] = &logCheckStream{taskID: id, container: ct.name, group: ct.group, name: name}
+				}
+			}
+		}
+		keys := make([]string, 0, len(streams))
+		for key := range streams {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := streams[key]
+			if err := d.matchLogStream(ctx, s, since, m, ready); err != nil {
+				return err
+			}
+		}
+		if m.readiness != nil && len(m.errors) == 0 && len(ready) > 0 && len(notReadyTasks(ready)) == 0 {
+			d.Log("All of new tasks are ready")
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.interval()):
+		}
+	}
+
+	if m.readiness != nil {
+		if len(ready) == 0 {
+			return errors.Errorf("no running tasks of %s to check the readiness", arnToName(tdArn))
+		}
+		if ids := notReadyTasks(ready); len(ids) > 0 {
+			return errors.Errorf("readiness pattern %q did not appear in logs of tasks %s in %s",
+				m.readiness.String(), strings.Join(ids, ", "), c.duration())
+		}
+		d.Log("All of new tasks are ready")
+	}
+	d.Log("No error patterns appeared in logs of new tasks")
+	return nil
+}
+
+// matchLogStream reads new events of the log stream and matches them.
+func (d *App) matchLogStream(ctx context.Context, s *logCheckStream, since time.Time, m *logMatcher, ready map[string]bool) error {
+	for {
+		out, err := d.cwl.GetLogEventsWithContext(ctx, &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(s.group),
+			LogStreamName: aws.String(s.name),
+			StartTime:     aws.Int64(since.UnixNano() / int64(time.Millisecond)),
+			StartFromHead: aws.Bool(true),
+			NextToken:     s.nextToken,
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException {
+				// the container has not written logs yet
+				return nil
+			}
+			return errors.Wrapf(err, "failed to get log events of %s", s.name)
+		}
+		for _, ev := range out.Events {
+			msg := aws.StringValue(ev.Message)
+			pattern, ok := m.match(msg)
+			if pattern != "" {
+				return errors.Errorf("error pattern %q appeared in logs of the container %s of the task %s: %s",
+					pattern, s.container, s.taskID, strings.TrimSpace(msg))
+			}
+			if ok && !ready[s.taskID] {
+				ready[s.taskID] = true
+				d.Log(fmt.Sprintf("Task %s is ready: %s", s.taskID, strings.TrimSpace(msg)))
+			}
+		}
+		if len(out.Events) == 0 || out.NextForwardToken == nil {
+			return nil
+		}
+		s.nextToken = out.NextForwardToken
+	}
+}
+
+func notReadyTasks(ready map[string]bool) []string {
+	var ids []string
+	for id, ok := range ready {
+		if !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
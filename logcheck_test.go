@@ -0,0 +1,192 @@
+package ecspresso_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/kayac/ecspresso"
+)
+
+const logCheckTdArn = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/app:2"
+
+type fakeLogCheckECS struct {
+	ecsiface.ECSAPI
+	tasks []*ecs.Task
+}
+
+func (f *fakeLogCheckECS) ListTasksPagesWithContext(_ aws.Context, _ *ecs.ListTasksInput, fn func(*ecs.ListTasksOutput, bool) bool, _ ...request.Option) error {
+	var arns []*string
+	for _, task := range f.tasks {
+		arns = append(arns, task.TaskArn)
+	}
+	fn(&ecs.ListTasksOutput{TaskArns: arns}, true)
+	return nil
+}
+
+func (f *fakeLogCheckECS) DescribeTasksWithContext(_ aws.Context, _ *ecs.DescribeTasksInput, _ ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	return &ecs.DescribeTasksOutput{Tasks: f.tasks}, nil
+}
+
+func (f *fakeLogCheckECS) DescribeTaskDefinitionWithContext(_ aws.Context, _ *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{
+		TaskDefinitionArn: aws.String(logCheckTdArn),
+		Family:            aws.String("app"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{
+				Name: aws.String("app"),
+				LogConfiguration: &ecs.LogConfiguration{
+					LogDriver: aws.String(ecs.LogDriverAwslogs),
+					Options: aws.StringMap(map[string]string{
+						"awslogs-group":         "/ecs/app",
+						"awslogs-stream-prefix": "ecs",
+					}),
+				},
+			},
+			{Name: aws.String("sidecar")},
+		},
+	}}, nil
+}
+
+// fakeLogCheckLogs returns messages of streams at once.
+type fakeLogCheckLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	messages map[string][]string
+}
+
+func (f *fakeLogCheckLogs) GetLogEventsWithContext(_ aws.Context, in *cloudwatchlogs.GetLogEventsInput, _ ...request.Option) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	msgs, ok := f.messages[aws.StringValue(in.LogStreamName)]
+	if !ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException, "The specified log stream does not exist.", nil)
+	}
+	out := &cloudwatchlogs.GetLogEventsOutput{NextForwardToken: aws.String("f/end")}
+	if in.NextToken != nil {
+		return out, nil
+	}
+	for _, msg := range msgs {
+		out.Events = append(out.Events, &cloudwatchlogs.OutputLogEvent{Message: aws.String(msg)})
+	}
+	return out, nil
+}
+
+func logCheckTask(id, tdArn string) *ecs.Task {
+	return &ecs.Task{
+		TaskArn:           aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/default2/" + id),
+		TaskDefinitionArn: aws.String(tdArn),
+	}
+}
+
+func TestLogCheckConfigValidate(t *testing.T) {
+	for _, c := range []struct {
+		config *ecspresso.LogCheckConfig
+		valid  bool
+	}{
+		{&ecspresso.LogCheckConfig{ErrorPatterns: []string{"panic:"}}, true},
+		{&ecspresso.LogCheckConfig{ReadinessPattern: "listening on"}, true},
+		{&ecspresso.LogCheckConfig{}, false},
+		{&ecspresso.LogCheckConfig{ErrorPatterns: []string{"("}}, false},
+		{&ecspresso.LogCheckConfig{ReadinessPattern: "["}, false},
+		{&ecspresso.LogCheckConfig{ErrorPatterns: []string{"panic:"}, Duration: -time.Second}, false},
+	} {
+		if err := c.config.Validate(); (err == nil) != c.valid {
+			t.Errorf("unexpected validation of %#v: %v", c.config, err)
+		}
+	}
+}
+
+func TestCheckTaskLogs(t *testing.T) {
+	tasks := []*ecs.Task{
+		logCheckTask("task1", logCheckTdArn),
+		logCheckTask("task2", logCheckTdArn),
+		logCheckTask("old", "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/app:1"),
+	}
+	for _, c := range []struct {
+		name     string
+		config   ecspresso.LogCheckConfig
+		messages map[string][]string
+		err      string
+	}{
+		{
+			name:   "no errors",
+			config: ecspresso.LogCheckConfig{ErrorPatterns: []string{"^panic:", "FATAL"}},
+			messages: map[string][]string{
+				"ecs/app/task1": {"starting", "listening on :8080"},
+				"ecs/app/old":   {"panic: ignored in old tasks"},
+			},
+		},
+		{
+			name:   "error pattern",
+			config: ecspresso.LogCheckConfig{ErrorPatterns: []string{"^panic:", "FATAL"}},
+			messages: map[string][]string{
+				"ecs/app/task1": {"starting"},
+				"ecs/app/task2": {"starting", "FATAL: failed to connect to the database\n"},
+			},
+			err: `error pattern "FATAL" appeared in logs of the container app of the task task2: FATAL: failed to connect to the database`,
+		},
+		{
+			name:   "ready",
+			config: ecspresso.LogCheckConfig{ReadinessPattern: "listening on :\\d+", Duration: time.Hour},
+			messages: map[string][]string{
+				"ecs/app/task1": {"starting", "listening on :8080"},
+				"ecs/app/task2": {"listening on :8080"},
+			},
+		},
+		{
+			name:   "not ready",
+			config: ecspresso.LogCheckConfig{ReadinessPattern: "listening on :\\d+"},
+			messages: map[string][]string{
+				"ecs/app/task1": {"starting", "listening on :8080"},
+				"ecs/app/task2": {"starting"},
+			},
+			err: `readiness pattern "listening on :\\d+" did not appear in logs of tasks task2`,
+		},
+		{
+			name:   "ready but error",
+			config: ecspresso.LogCheckConfig{ReadinessPattern: "listening on", ErrorPatterns: []string{"^panic:"}},
+			messages: map[string][]string{
+				"ecs/app/task1": {"listening on :8080", "panic: runtime error"},
+				"ecs/app/task2": {"listening on :8080"},
+			},
+			err: `error pattern "^panic:" appeared in logs of the container app of the task task1`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			conf := ecspresso.NewDefaultConfig()
+			if err := conf.Load("tests/test.yaml"); err != nil {
+				t.Fatal(err)
+			}
+			lc := c.config
+			if lc.Duration == 0 {
+				lc.Duration = 30 * time.Millisecond
+			}
+			lc.Interval = 10 * time.Millisecond
+			conf.LogCheck = &lc
+			app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+				ECS:            &fakeLogCheckECS{tasks: tasks},
+				CloudWatchLogs: &fakeLogCheckLogs{messages: c.messages},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err = app.CheckTaskLogs(ctx, logCheckTdArn, time.Now())
+			switch {
+			case c.err == "" && err != nil:
+				t.Errorf("unexpected error %s", err)
+			case c.err != "" && err == nil:
+				t.Errorf("expected error %s, but no error", c.err)
+			case c.err != "" && !strings.Contains(err.Error(), c.err):
+				t.Errorf("unexpected error %s, expected %s", err, c.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+type LsOption struct {
+	Tags   *string
+	Output *string
+}
+
+// maxEventLengthInTable is the maximum length of the last event shown in the table.
+const maxEventLengthInTable = 80
+
+type serviceSummary struct {
+	Name           string     `json:"name"`
+	Status         string     `json:"status"`
+	Desired        int64      `json:"desired"`
+	Running        int64      `json:"running"`
+	Pending        int64      `json:"pending"`
+	TaskDefinition string     `json:"task_definition"`
+	Deployment     string     `json:"deployment"`
+	LastEvent      string     `json:"last_event,omitempty"`
+	LastEventAt    *time.Time `json:"last_event_at,omitempty"`
+}
+
+func newServiceSummary(sv *ecs.Service) serviceSummary {
+	s := serviceSummary{
+		Name:           aws.StringValue(sv.ServiceName),
+		Status:         aws.StringValue(sv.Status),
+		Desired:        aws.Int64Value(sv.DesiredCount),
+		Running:        aws.Int64Value(sv.RunningCount),
+		Pending:        aws.Int64Value(sv.PendingCount),
+		TaskDefinition: arnToName(aws.StringValue(sv.TaskDefinition)),
+		Deployment:     deploymentState(sv),
+	}
+	if len(sv.Events) > 0 {
+		s.LastEvent = aws.StringValue(sv.Events[0].Message)
+		s.LastEventAt = sv.Events[0].CreatedAt
+	}
+	return s
+}
+
+// deploymentState returns the rollout state of the primary deployment, with the number of deployments in progress.
+func deploymentState(sv *ecs.Service) string {
+	state := "-"
+	for _, dp := range sv.Deployments {
+		if aws.StringValue(dp.Status) == "PRIMARY" && dp.RolloutState != nil {
+			state = aws.StringValue(dp.RolloutState)
+		}
+	}
+	if isCodeDeploy(sv.DeploymentController) {
+		for _, ts := range sv.TaskSets {
+			if aws.StringValue(ts.Status) == "PRIMARY" {
+				state = aws.StringValue(ts.StabilityStatus)
+			}
+		}
+		if n := len(sv.TaskSets); n > 1 {
+			return fmt.Sprintf("%s (%d task sets)", state, n)
+		}
+		return state
+	}
+	if n := len(sv.Deployments); n > 1 {
+		return fmt.Sprintf("%s (%d deployments)", state, n)
+	}
+	return state
+}
+
+func (s serviceSummary) Cols() []string {
+	event := s.LastEvent
+	if len(event) > maxEventLengthInTable {
+		event = event[:maxEventLengthInTable-3] + "..."
+	}
+	if s.LastEventAt != nil {
+		event = s.LastEventAt.In(time.Local).Format("2006/01/02 15:04:05") + " " + event
+	}
+	return []string{
+		s.Name,
+		s.Status,
+		fmt.Sprintf("%d/%d", s.Running, s.Desired),
+		fmt.Sprint(s.Pending),
+		s.TaskDefinition,
+		s.Deployment,
+		event,
+	}
+}
+
+type serviceSummaries []serviceSummary
+
+func (ss serviceSummaries) Header() []string {
+	return []string{"Name", "Status", "Running", "Pending", "TaskDefinition", "Deployment", "Last Event"}
+}
+
+func (ss serviceSummaries) OutputJSON(w io.Writer) error {
+	b, err := MarshalJSON(ss)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (ss serviceSummaries) OutputTSV(w io.Writer) error {
+	for _, s := range ss {
+		var eventAt string
+		if s.LastEventAt != nil {
+			eventAt = s.LastEventAt.Format(time.RFC3339)
+		}
+		cols := []string{
+			s.Name, s.Status,
+			fmt.Sprint(s.Running), fmt.Sprint(s.Desired), fmt.Sprint(s.Pending),
+			s.TaskDefinition, s.Deployment, eventAt, s.LastEvent,
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(cols, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ss serviceSummaries) OutputTable(w io.Writer) error {
+	t := tablewriter.NewWriter(w)
+	t.SetHeader(ss.Header())
+	t.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	t.SetAutoWrapText(false)
+	for _, s := range ss {
+		t.Append(s.Cols())
+	}
+	t.Render()
+	return nil
+}
+
+// matchTags reports whether the tags contain all of the filter tags.
+func matchTags(tags []*ecs.Tag, filter []*ecs.Tag) bool {
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	for _, f := range filter {
+		if v, ok := m[aws.StringValue(f.Key)]; !ok || v != aws.StringValue(f.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Ls lists services in the cluster with their counts of tasks, deployment states and last events.
+func (d *App) Ls(opt LsOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	ss, err := d.serviceSummaries(ctx, aws.StringValue(opt.Tags))
+	if err != nil {
+		return err
+	}
+	switch aws.StringValue(opt.Output) {
+	case "json":
+		return ss.OutputJSON(os.Stdout)
+	case "tsv":
+		return ss.OutputTSV(os.Stdout)
+	default:
+		return ss.OutputTable(os.Stdout)
+	}
+}
+
+// serviceSummaries returns summaries of services in the cluster which have all the tags, sorted by names.
+func (d *App) serviceSummaries(ctx context.Context, tags string) (serviceSummaries, error) {
+	filter, err := parseTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	services, err := d.describeClusterServices(ctx, len(filter) > 0)
+	if err != nil {
+		return nil, err
+	}
+	ss := serviceSummaries{}
+	for _, sv := range services {
+		if matchTags(sv.Tags, filter) {
+			ss = append(ss, newServiceSummary(sv))
+		}
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].Name < ss[j].Name
+	})
+	return ss, nil
+}
+
+// describeClusterServices describes all services in the cluster.
+func (d *App) describeClusterServices(ctx context.Context, withTags bool) ([]*ecs.Service, error) {
+	var arns []*string
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListServicesWithContext(ctx, &ecs.ListServicesInput{
+			Cluster:   aws.String(d.Cluster),
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list services")
+		}
+		arns = append(arns, out.ServiceArns...)
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+	var include []*string
+	if withTags {
+		include = aws.StringSlice([]string{ecs.ServiceFieldTags})
+	}
+	var services []*ecs.Service
+	// DescribeServices accepts services up to 10
+	for i := 0; i < len(arns); i += 10 {
+		end := i + 10
+		if end > len(arns) {
+			end = len(arns)
+		}
+		out, err := d.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(d.Cluster),
+			Services: arns[i:end],
+			Include:  include,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe services")
+		}
+		services = append(services, out.Services...)
+	}
+	return services, nil
+}
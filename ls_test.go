@@ -0,0 +1,129 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+type fakeLsECS struct {
+	fakeECS
+	services []*ecs.Service
+	describe [][]*string
+}
+
+func (f *fakeLsECS) ListServicesWithContext(_ aws.Context, in *ecs.ListServicesInput, _ ...request.Option) (*ecs.ListServicesOutput, error) {
+	var arns []*string
+	for _, sv := range f.services {
+		arns = append(arns, sv.ServiceArn)
+	}
+	// return services page by page to check pagination
+	if in.NextToken == nil {
+		return &ecs.ListServicesOutput{ServiceArns: arns[:1], NextToken: aws.String("next")}, nil
+	}
+	return &ecs.ListServicesOutput{ServiceArns: arns[1:]}, nil
+}
+
+func (f *fakeLsECS) DescribeServicesWithContext(_ aws.Context, in *ecs.DescribeServicesInput, _ ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	f.describe = append(f.describe, in.Include)
+	out := &ecs.DescribeServicesOutput{}
+	for _, arn := range in.Services {
+		for _, sv := range f.services {
+			if aws.StringValue(sv.ServiceArn) == aws.StringValue(arn) {
+				out.Services = append(out.Services, sv)
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestServiceSummaries(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	fake := &fakeLsECS{services: []*ecs.Service{
+		{
+			ServiceName:    aws.String("web"),
+			ServiceArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:service/default2/web"),
+			Status:         aws.String("ACTIVE"),
+			DesiredCount:   aws.Int64(3),
+			RunningCount:   aws.Int64(2),
+			PendingCount:   aws.Int64(1),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/web:12"),
+			Deployments: []*ecs.Deployment{
+				{Status: aws.String("PRIMARY"), RolloutState: aws.String(ecs.DeploymentRolloutStateInProgress)},
+				{Status: aws.String("ACTIVE"), RolloutState: aws.String(ecs.DeploymentRolloutStateCompleted)},
+			},
+			Events: []*ecs.ServiceEvent{
+				{CreatedAt: aws.Time(at), Message: aws.String("(service web) has started 1 tasks")},
+				{CreatedAt: aws.Time(at.Add(-time.Hour)), Message: aws.String("(service web) has reached a steady state.")},
+			},
+			Tags: []*ecs.Tag{
+				{Key: aws.String("team"), Value: aws.String("a")},
+				{Key: aws.String("env"), Value: aws.String("prod")},
+			},
+		},
+		{
+			ServiceName:    aws.String("api"),
+			ServiceArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:service/default2/api"),
+			Status:         aws.String("ACTIVE"),
+			DesiredCount:   aws.Int64(2),
+			RunningCount:   aws.Int64(2),
+			PendingCount:   aws.Int64(0),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/api:3"),
+			DeploymentController: &ecs.DeploymentController{
+				Type: aws.String(ecs.DeploymentControllerTypeCodeDeploy),
+			},
+			TaskSets: []*ecs.TaskSet{
+				{Status: aws.String("PRIMARY"), StabilityStatus: aws.String(ecs.StabilityStatusSteadyState)},
+			},
+			Tags: []*ecs.Tag{
+				{Key: aws.String("team"), Value: aws.String("b")},
+			},
+		},
+	}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := app.ServiceSummariesTSV(context.Background(), &b, ""); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"api\tACTIVE\t2\t2\t0\tapi:3\tSTEADY_STATE\t\t",
+		"web\tACTIVE\t2\t3\t1\tweb:12\tIN_PROGRESS (2 deployments)\t2026-10-01T12:00:00Z\t(service web) has started 1 tasks",
+		"",
+	}, "\n")
+	if b.String() != expected {
+		t.Errorf("unexpected summaries:\n%s", b.String())
+	}
+	if fake.describe[0] != nil {
+		t.Errorf("tags must not be described without filters: %v", fake.describe[0])
+	}
+
+	b.Reset()
+	if err := app.ServiceSummariesTSV(context.Background(), &b, "env=prod,team=a"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), "web\t") || strings.Count(b.String(), "\n") != 1 {
+		t.Errorf("unexpected filtered summaries:\n%s", b.String())
+	}
+	if include := fake.describe[len(fake.describe)-1]; aws.StringValueSlice(include)[0] != ecs.ServiceFieldTags {
+		t.Errorf("tags must be described with filters: %v", include)
+	}
+
+	if err := app.ServiceSummariesTSV(context.Background(), &b, "team"); err == nil {
+		t.Error("invalid filter must be an error")
+	}
+}
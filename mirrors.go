@@ -0,0 +1,100 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kayac/ecspresso/registry"
+	"github.com/pkg/errors"
+)
+
+// dockerHubAliases are names of Docker Hub in registry_mirrors.
+var dockerHubAliases = []string{"docker.io", "index.docker.io", "registry-1.docker.io"}
+
+func (c *Config) validateRegistryMirrors() error {
+	for key, mirrors := range c.RegistryMirrors {
+		if key == "" || strings.Contains(key, "://") || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || strings.Contains(key, "//") {
+			return errors.Errorf("registry_mirrors must be keyed by the host of the registry or the host with a repository prefix: %s", key)
+		}
+		for _, m := range mirrors {
+			if m == "" {
+				return errors.Errorf("empty mirror of %s in registry_mirrors", key)
+			}
+			if strings.HasPrefix(m, "http://") {
+				return errors.Errorf("mirror %s of %s must be https", m, key)
+			}
+		}
+	}
+	return nil
+}
+
+// registryMirrors returns locations of the repository in mirrors in the order to try.
+// Mirrors keyed by the longest prefix of the repository (the host, or the host with a repository prefix) are used,
+// and the rest of the repository name is appended to them.
+func (c *Config) registryMirrors(host, repo string) []string {
+	hosts := []string{host}
+	for _, alias := range dockerHubAliases {
+		if host == alias {
+			hosts = append(hosts, dockerHubAliases...)
+			break
+		}
+	}
+	var prefixes []string
+	for p := repo; p != ""; {
+		prefixes = append(prefixes, p)
+		i := strings.LastIndex(p, "/")
+		if i == -1 {
+			break
+		}
+		p = p[:i]
+	}
+	prefixes = append(prefixes, "")
+
+	for _, prefix := range prefixes {
+		for _, h := range hosts {
+			key := h
+			if prefix != "" {
+				key = h + "/" + prefix
+			}
+			mirrors, ok := c.RegistryMirrors[key]
+			if !ok {
+				continue
+			}
+			rest := strings.TrimPrefix(strings.TrimPrefix(repo, prefix), "/")
+			locations := make([]string, 0, len(mirrors))
+			for _, m := range mirrors {
+				m = strings.TrimSuffix(m, "/")
+				if rest != "" {
+					m = m + "/" + rest
+				}
+				locations = append(locations, m)
+			}
+			return locations
+		}
+	}
+	return nil
+}
+
+// findRegistryImage tries mirrors of the registry before the upstream registry as same as registry-mirrors of the docker daemon.
+// It returns the repository which has the image tag.
+func (d *App) findRegistryImage(ctx context.Context, upstream *registry.Repository, tag string) (*registry.Repository, bool, error) {
+	for _, m := range d.config.registryMirrors(upstream.Host(), upstream.Repo()) {
+		repo := upstream.Mirror(m)
+		ok, err := hasRegistryImage(ctx, repo, tag)
+		if err == nil && ok {
+			d.DebugLog(fmt.Sprintf("found the image tag %s in the mirror %s", tag, m))
+			return repo, true, nil
+		}
+		d.DebugLog(fmt.Sprintf("the image tag %s is not available in the mirror %s, falling back. %v", tag, m, err))
+	}
+	ok, err := hasRegistryImage(ctx, upstream, tag)
+	return upstream, ok, err
+}
+
+func hasRegistryImage(ctx context.Context, repo *registry.Repository, tag string) (bool, error) {
+	if registry.IsDigest(tag) {
+		return repo.HasImageDigest(ctx, tag)
+	}
+	return repo.HasImage(ctx, tag)
+}
@@ -0,0 +1,60 @@
+package ecspresso_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestRegistryMirrors(t *testing.T) {
+	conf := &ecspresso.Config{
+		RegistryMirrors: map[string][]string{
+			"docker.io":            {"mirror.example.com", "https://mirror2.example.com/"},
+			"docker.io/library":    {"library-mirror.example.com/dockerhub-library"},
+			"ghcr.io":              {"ghcr-proxy.example.com"},
+			"ghcr.io/kayac/public": {"public-proxy.example.com"},
+		},
+	}
+	testCases := []struct {
+		host     string
+		repo     string
+		expected []string
+	}{
+		{"registry-1.docker.io", "library/nginx", []string{"library-mirror.example.com/dockerhub-library/nginx"}},
+		{"registry-1.docker.io", "kayac/ecspresso", []string{"mirror.example.com/kayac/ecspresso", "https://mirror2.example.com/kayac/ecspresso"}},
+		{"ghcr.io", "kayac/ecspresso", []string{"ghcr-proxy.example.com/kayac/ecspresso"}},
+		{"ghcr.io", "kayac/public/app", []string{"public-proxy.example.com/app"}},
+		{"ghcr.io", "kayac/publicity", []string{"ghcr-proxy.example.com/kayac/publicity"}},
+		{"quay.io", "kayac/ecspresso", nil},
+	}
+	for _, c := range testCases {
+		if got := ecspresso.RegistryMirrors(conf, c.host, c.repo); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("unexpected mirrors of %s/%s: %v", c.host, c.repo, got)
+		}
+	}
+}
+
+func TestRegistryMirrorsValidate(t *testing.T) {
+	testCases := []struct {
+		mirrors map[string][]string
+		valid   bool
+	}{
+		{map[string][]string{"docker.io": {"https://mirror.example.com"}}, true},
+		{map[string][]string{"docker.io": {"http://mirror.example.com"}}, false},
+		{map[string][]string{"docker.io/library": {"mirror.example.com"}}, true},
+		{map[string][]string{"https://docker.io": {"mirror.example.com"}}, false},
+		{map[string][]string{"docker.io/library/": {"mirror.example.com"}}, false},
+		{map[string][]string{"docker.io": {""}}, false},
+	}
+	for _, c := range testCases {
+		conf := &ecspresso.Config{}
+		if err := conf.Load("tests/test.yaml"); err != nil {
+			t.Fatal(err)
+		}
+		conf.RegistryMirrors = c.mirrors
+		if err := conf.Restrict(); (err == nil) != c.valid {
+			t.Errorf("unexpected validation of %v: %v", c.mirrors, err)
+		}
+	}
+}
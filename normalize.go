@@ -0,0 +1,40 @@
+package ecspresso
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+)
+
+type NormalizeOption struct {
+	File *string
+}
+
+// NormalizeTaskDefinition returns a copy of the task definition normalized as diff compares task definitions.
+// Slices whose order is not significant (containerDefinitions, environment, portMappings, secrets, volumes, tags and so on)
+// are sorted, cpu and memory in units (e.g. "0.5 vCPU", "1 GB") are converted into numbers, and the omitted cpu of containers is
+// defaulted to 0 as ECS does.
+func NormalizeTaskDefinition(td *TaskDefinitionInput) *TaskDefinitionInput {
+	ntd := awsutil.CopyOf(td).(*TaskDefinitionInput)
+	sortTaskDefinitionForDiff(ntd)
+	return ntd
+}
+
+// Normalize prints the normalized task definition to stdout.
+func (d *App) Normalize(opt NormalizeOption) error {
+	path := d.config.TaskDefinitionPath
+	if f := aws.StringValue(opt.File); f != "" {
+		path = f
+	}
+	td, err := d.LoadTaskDefinition(path)
+	if err != nil {
+		return err
+	}
+	b, err := MarshalJSON(d.redactTaskDefinition(NormalizeTaskDefinition(td)))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
@@ -0,0 +1,47 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestNormalizeTaskDefinition(t *testing.T) {
+	td := &ecspresso.TaskDefinitionInput{
+		Family: aws.String("app"),
+		Cpu:    aws.String("0.5 vCPU"),
+		Memory: aws.String("1 GB"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("app"), Environment: []*ecs.KeyValuePair{
+				{Name: aws.String("B"), Value: aws.String("2")},
+				{Name: aws.String("A"), Value: aws.String("1")},
+			}},
+			{Name: aws.String("sidecar"), Cpu: aws.Int64(128)},
+		},
+	}
+	ntd := ecspresso.NormalizeTaskDefinition(td)
+	if aws.StringValue(ntd.Cpu) != "512" || aws.StringValue(ntd.Memory) != "1024" {
+		t.Errorf("unexpected cpu and memory: %s %s", aws.StringValue(ntd.Cpu), aws.StringValue(ntd.Memory))
+	}
+	if aws.StringValue(ntd.ContainerDefinitions[0].Name) != "sidecar" {
+		t.Errorf("containerDefinitions must be sorted as diff: %s", ntd.ContainerDefinitions)
+	}
+	app := ntd.ContainerDefinitions[1]
+	if aws.Int64Value(app.Cpu) != 0 || app.Cpu == nil {
+		t.Errorf("cpu of the container must be defaulted to 0: %v", app.Cpu)
+	}
+	if aws.StringValue(app.Environment[0].Name) != "A" {
+		t.Errorf("environment must be sorted: %s", app.Environment)
+	}
+
+	if aws.StringValue(td.Cpu) != "0.5 vCPU" || aws.StringValue(td.ContainerDefinitions[0].Name) != "app" || td.ContainerDefinitions[0].Cpu != nil {
+		t.Error("the original task definition must not be modified")
+	}
+
+	// normalized task definitions are stable
+	if ecspresso.MarshalJSONString(ecspresso.NormalizeTaskDefinition(ntd)) != ecspresso.MarshalJSONString(ntd) {
+		t.Error("normalization must be idempotent")
+	}
+}
@@ -0,0 +1,573 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/pkg/errors"
+)
+
+const notificationTimeout = 30 * time.Second
+
+// Deployment event types to be notified.
+const (
+	DeploymentEventStart    = "start"
+	DeploymentEventSuccess  = "success"
+	DeploymentEventFailure  = "failure"
+	DeploymentEventRollback = "rollback"
+)
+
+// NotificationConfig represents a configuration of deployment notifications.
+type NotificationConfig struct {
+	Slack       *SlackNotificationConfig       `yaml:"slack,omitempty"`
+	Webhook     *WebhookNotificationConfig     `yaml:"webhook,omitempty"`
+	SNS         *SNSNotificationConfig         `yaml:"sns,omitempty"`
+	GitHub      *GitHubNotificationConfig      `yaml:"github,omitempty"`
+	Datadog     *DatadogNotificationConfig     `yaml:"datadog,omitempty"`
+	CloudWatch  *CloudWatchNotificationConfig  `yaml:"cloudwatch,omitempty"`
+	EventBridge *EventBridgeNotificationConfig `yaml:"eventbridge,omitempty"`
+}
+
+// SlackNotificationConfig represents a configuration of Slack incoming webhook.
+type SlackNotificationConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Channel    string `yaml:"channel,omitempty"`
+}
+
+// WebhookNotificationConfig represents a configuration of generic HTTP webhook.
+type WebhookNotificationConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// SNSNotificationConfig represents a configuration of SNS topic to publish deployment events.
+type SNSNotificationConfig struct {
+	TopicArn string `yaml:"topic_arn"`
+}
+
+// GitHubNotificationConfig represents a configuration of GitHub Deployments.
+type GitHubNotificationConfig struct {
+	Repository  string `yaml:"repository"`
+	Token       string `yaml:"token,omitempty"`
+	Environment string `yaml:"environment,omitempty"`
+	Ref         string `yaml:"ref,omitempty"`
+	APIURL      string `yaml:"api_url,omitempty"`
+}
+
+// DatadogNotificationConfig represents a configuration of Datadog Events API.
+type DatadogNotificationConfig struct {
+	APIKey string   `yaml:"api_key,omitempty"`
+	Site   string   `yaml:"site,omitempty"`
+	Tags   []string `yaml:"tags,omitempty"`
+}
+
+// CloudWatchNotificationConfig represents a configuration of CloudWatch custom metrics.
+type CloudWatchNotificationConfig struct {
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// EventBridgeNotificationConfig represents a configuration of EventBridge events.
+type EventBridgeNotificationConfig struct {
+	EventBusName string `yaml:"event_bus_name,omitempty"`
+}
+
+// DeploymentEvent represents an event of the deployment.
+type DeploymentEvent struct {
+	Type                   string    `json:"type"`
+	Service                string    `json:"service"`
+	Cluster                string    `json:"cluster"`
+	TaskDefinition         string    `json:"task_definition,omitempty"`
+	PreviousTaskDefinition string    `json:"previous_task_definition,omitempty"`
+	Images                 []string  `json:"images,omitempty"`
+	User                   string    `json:"user,omitempty"`
+	StartedAt              time.Time `json:"started_at"`
+	DurationSeconds        float64   `json:"duration_seconds,omitempty"`
+	Error                  string    `json:"error,omitempty"`
+}
+
+func (ev *DeploymentEvent) finish(t string, err error) *DeploymentEvent {
+	e := *ev
+	e.Type = t
+	e.DurationSeconds = time.Since(ev.StartedAt).Round(time.Second).Seconds()
+	if err != nil {
+		e.Type = DeploymentEventFailure
+		e.Error = err.Error()
+	}
+	return &e
+}
+
+func (ev *DeploymentEvent) duration() time.Duration {
+	return time.Duration(ev.DurationSeconds) * time.Second
+}
+
+// version returns the revision of the task definition.
+func (ev *DeploymentEvent) version() string {
+	if i := strings.LastIndex(ev.TaskDefinition, ":"); i >= 0 {
+		return ev.TaskDefinition[i+1:]
+	}
+	return ""
+}
+
+type notifier interface {
+	notify(ctx context.Context, ev *DeploymentEvent) error
+}
+
+func newNotifiers(c *NotificationConfig, sess *session.Session) []notifier {
+	var ns []notifier
+	if c == nil {
+		return ns
+	}
+	if c.Slack != nil {
+		ns = append(ns, &slackNotifier{config: c.Slack})
+	}
+	if c.Webhook != nil {
+		ns = append(ns, &webhookNotifier{config: c.Webhook})
+	}
+	if c.SNS != nil {
+		ns = append(ns, &snsNotifier{config: c.SNS, sns: sns.New(sess)})
+	}
+	if c.GitHub != nil {
+		ns = append(ns, &githubNotifier{config: c.GitHub})
+	}
+	if c.Datadog != nil {
+		ns = append(ns, &datadogNotifier{config: c.Datadog})
+	}
+	if c.CloudWatch != nil {
+		ns = append(ns, &cloudwatchNotifier{config: c.CloudWatch, cloudwatch: cloudwatch.New(sess)})
+	}
+	if c.EventBridge != nil {
+		ns = append(ns, &eventbridgeNotifier{config: c.EventBridge, eventbridge: eventbridge.New(sess)})
+	}
+	return ns
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func (d *App) newDeploymentEvent() *DeploymentEvent {
+	return &DeploymentEvent{
+		Type:      DeploymentEventStart,
+		Service:   d.Service,
+		Cluster:   d.Cluster,
+		User:      currentUser(),
+		StartedAt: time.Now(),
+	}
+}
+
+// setDeploymentEventTaskDefinition sets the task definition and the container images to the event.
+func (d *App) setDeploymentEventTaskDefinition(ctx context.Context, ev *DeploymentEvent, tdArn string) error {
+	if tdArn == "" {
+		return nil
+	}
+	ev.TaskDefinition = arnToName(tdArn)
+	if len(d.notifiers) == 0 {
+		return nil
+	}
+	td, err := d.DescribeTaskDefinition(ctx, tdArn)
+	if err != nil {
+		return err
+	}
+	ev.Images = ev.Images[:0]
+	for _, c := range td.ContainerDefinitions {
+		ev.Images = append(ev.Images, aws.StringValue(c.Image))
+	}
+	return nil
+}
+
+// notify sends the event to all notifiers.
+// Failures of notifications are logged and never break the deployment.
+func (d *App) notify(ev *DeploymentEvent) {
+	if len(d.notifiers) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	for _, n := range d.notifiers {
+		if err := n.notify(ctx, ev); err != nil {
+			d.Log("WARNING: failed to notify the deployment event", ev.Type, err)
+		}
+	}
+}
+
+// postJSON posts the payload as JSON. When result is not nil, the response body is decoded into it.
+func postJSON(ctx context.Context, url string, headers map[string]string, payload interface{}, result interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal payload")
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return errors.Errorf("%s returned status %s", req.URL.Host, resp.Status)
+	}
+	if result == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+type webhookNotifier struct {
+	config *WebhookNotificationConfig
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, ev *DeploymentEvent) error {
+	return postJSON(ctx, n.config.URL, n.config.Headers, ev, nil)
+}
+
+type snsNotifier struct {
+	config *SNSNotificationConfig
+	sns    *sns.SNS
+}
+
+func (n *snsNotifier) notify(ctx context.Context, ev *DeploymentEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal payload")
+	}
+	// message attributes allow subscribers to filter events by subscription filter policies.
+	attrs := map[string]*sns.MessageAttributeValue{}
+	for k, v := range map[string]string{"type": ev.Type, "service": ev.Service, "cluster": ev.Cluster} {
+		attrs[k] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	}
+	_, err = n.sns.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn:          aws.String(n.config.TopicArn),
+		Subject:           aws.String(fmt.Sprintf("ecspresso deployment %s: %s/%s", ev.Type, ev.Cluster, ev.Service)),
+		Message:           aws.String(string(b)),
+		MessageAttributes: attrs,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to publish to SNS")
+	}
+	return nil
+}
+
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// githubNotifier records deployments to GitHub Deployments API.
+// A deployment is created on the first event, and the status is updated by the following events.
+type githubNotifier struct {
+	config       *GitHubNotificationConfig
+	deploymentID int64
+}
+
+func (n *githubNotifier) apiURL(path string) string {
+	base := n.config.APIURL
+	if base == "" {
+		base = defaultGitHubAPIURL
+	}
+	return strings.TrimSuffix(base, "/") + "/repos/" + n.config.Repository + path
+}
+
+func (n *githubNotifier) headers() map[string]string {
+	token := n.config.Token
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+	return map[string]string{
+		"Accept":        "application/vnd.github+json",
+		"Authorization": "token " + token,
+	}
+}
+
+func (n *githubNotifier) ref() (string, error) {
+	if n.config.Ref != "" {
+		return n.config.Ref, nil
+	}
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha, nil
+	}
+	b, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to detect the commit SHA. set ref to github notification")
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func githubDeploymentState(t string) string {
+	switch t {
+	case DeploymentEventStart:
+		return "in_progress"
+	case DeploymentEventSuccess, DeploymentEventRollback:
+		return "success"
+	default:
+		return "failure"
+	}
+}
+
+func (n *githubNotifier) createDeployment(ctx context.Context, ev *DeploymentEvent) error {
+	ref, err := n.ref()
+	if err != nil {
+		return err
+	}
+	env := n.config.Environment
+	if env == "" {
+		env = ev.Cluster
+	}
+	payload := map[string]interface{}{
+		"ref":               ref,
+		"environment":       env,
+		"auto_merge":        false,
+		"required_contexts": []string{},
+		"description":       fmt.Sprintf("ecspresso deploy %s/%s", ev.Cluster, ev.Service),
+		"payload":           ev,
+	}
+	var res struct {
+		ID int64 `json:"id"`
+	}
+	if err := postJSON(ctx, n.apiURL("/deployments"), n.headers(), payload, &res); err != nil {
+		return errors.Wrap(err, "failed to create GitHub deployment")
+	}
+	n.deploymentID = res.ID
+	return n.createDeploymentStatus(ctx, "pending", "")
+}
+
+func (n *githubNotifier) createDeploymentStatus(ctx context.Context, state, description string) error {
+	if len(description) > 140 {
+		description = description[:140] // limit of GitHub API
+	}
+	payload := map[string]interface{}{
+		"state":       state,
+		"description": description,
+	}
+	path := fmt.Sprintf("/deployments/%d/statuses", n.deploymentID)
+	if err := postJSON(ctx, n.apiURL(path), n.headers(), payload, nil); err != nil {
+		return errors.Wrap(err, "failed to create GitHub deployment status")
+	}
+	return nil
+}
+
+func (n *githubNotifier) notify(ctx context.Context, ev *DeploymentEvent) error {
+	if n.deploymentID == 0 {
+		if err := n.createDeployment(ctx, ev); err != nil {
+			return err
+		}
+	}
+	description := strings.TrimSpace(fmt.Sprintf("%s %s", ev.Type, ev.TaskDefinition))
+	if ev.Error != "" {
+		description = ev.Error
+	}
+	return n.createDeploymentStatus(ctx, githubDeploymentState(ev.Type), description)
+}
+
+const (
+	defaultDatadogSite          = "datadoghq.com"
+	defaultCloudWatchNamespace  = "ecspresso"
+	eventBridgeEventSource      = "ecspresso"
+	eventBridgeEventDetailType  = "ECS Deployment"
+	cloudWatchDeploymentsMetric = "Deployments"
+)
+
+// datadogNotifier posts deployment markers to Datadog Events API at deploy completion.
+type datadogNotifier struct {
+	config *DatadogNotificationConfig
+}
+
+func (n *datadogNotifier) notify(ctx context.Context, ev *DeploymentEvent) error {
+	if ev.Type == DeploymentEventStart {
+		return nil
+	}
+	apiKey := n.config.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("DD_API_KEY")
+	}
+	site := n.config.Site
+	if site == "" {
+		site = defaultDatadogSite
+	}
+	tags := append([]string{
+		"service:" + ev.Service,
+		"cluster:" + ev.Cluster,
+	}, n.config.Tags...)
+	if v := ev.version(); v != "" {
+		tags = append(tags, "version:"+v)
+	}
+	alertType := "success"
+	if ev.Type == DeploymentEventFailure {
+		alertType = "error"
+	} else if ev.Type == DeploymentEventRollback {
+		alertType = "warning"
+	}
+	text := strings.TrimSpace(fmt.Sprintf("%s\n%s", strings.Join(ev.Images, "\n"), ev.Error))
+	payload := map[string]interface{}{
+		"title":            fmt.Sprintf("ecspresso %s: %s/%s %s", ev.Type, ev.Cluster, ev.Service, ev.TaskDefinition),
+		"text":             text,
+		"tags":             tags,
+		"alert_type":       alertType,
+		"source_type_name": "ecspresso",
+		"aggregation_key":  ev.Cluster + "/" + ev.Service,
+	}
+	u := fmt.Sprintf("https://api.%s/api/v1/events", site)
+	if err := postJSON(ctx, u, map[string]string{"DD-API-KEY": apiKey}, payload, nil); err != nil {
+		return errors.Wrap(err, "failed to post an event to Datadog")
+	}
+	return nil
+}
+
+// cloudwatchNotifier puts a custom metric at deploy completion.
+type cloudwatchNotifier struct {
+	config     *CloudWatchNotificationConfig
+	cloudwatch *cloudwatch.CloudWatch
+}
+
+func (n *cloudwatchNotifier) notify(ctx context.Context, ev *DeploymentEvent) error {
+	if ev.Type == DeploymentEventStart {
+		return nil
+	}
+	ns := n.config.Namespace
+	if ns == "" {
+		ns = defaultCloudWatchNamespace
+	}
+	_, err := n.cloudwatch.PutMetricDataWithContext(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(ns),
+		MetricData: []*cloudwatch.MetricDatum{
+			{
+				MetricName: aws.String(cloudWatchDeploymentsMetric),
+				Dimensions: []*cloudwatch.Dimension{
+					{Name: aws.String("Cluster"), Value: aws.String(ev.Cluster)},
+					{Name: aws.String("Service"), Value: aws.String(ev.Service)},
+					{Name: aws.String("Outcome"), Value: aws.String(ev.Type)},
+				},
+				Timestamp: aws.Time(time.Now()),
+				Unit:      aws.String(cloudwatch.StandardUnitCount),
+				Value:     aws.Float64(1),
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to put metric data to CloudWatch")
+	}
+	return nil
+}
+
+// eventbridgeNotifier puts an event to EventBridge at deploy completion.
+type eventbridgeNotifier struct {
+	config      *EventBridgeNotificationConfig
+	eventbridge *eventbridge.EventBridge
+}
+
+func (n *eventbridgeNotifier) notify(ctx context.Context, ev *DeploymentEvent) error {
+	if ev.Type == DeploymentEventStart {
+		return nil
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal payload")
+	}
+	entry := &eventbridge.PutEventsRequestEntry{
+		Source:     aws.String(eventBridgeEventSource),
+		DetailType: aws.String(eventBridgeEventDetailType),
+		Detail:     aws.String(string(b)),
+		Time:       aws.Time(time.Now()),
+	}
+	if n.config.EventBusName != "" {
+		entry.EventBusName = aws.String(n.config.EventBusName)
+	}
+	out, err := n.eventbridge.PutEventsWithContext(ctx, &eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{entry},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to put an event to EventBridge")
+	}
+	if aws.Int64Value(out.FailedEntryCount) > 0 && len(out.Entries) > 0 {
+		return errors.Errorf("failed to put an event to EventBridge: %s", aws.StringValue(out.Entries[0].ErrorMessage))
+	}
+	return nil
+}
+
+type slackNotifier struct {
+	config *SlackNotificationConfig
+}
+
+type slackPayload struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color,omitempty"`
+	Fields []slackField `json:"fields,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (n *slackNotifier) notify(ctx context.Context, ev *DeploymentEvent) error {
+	return postJSON(ctx, n.config.WebhookURL, nil, newSlackPayload(ev, n.config.Channel), nil)
+}
+
+func newSlackPayload(ev *DeploymentEvent, channel string) *slackPayload {
+	target := fmt.Sprintf("service *%s* on cluster *%s*", ev.Service, ev.Cluster)
+	var text, color string
+	switch ev.Type {
+	case DeploymentEventStart:
+		text = "Deploying " + target
+	case DeploymentEventSuccess:
+		text, color = "Deployed "+target, "good"
+	case DeploymentEventRollback:
+		text, color = "Rolled back "+target, "warning"
+	default:
+		text, color = "Failed to deploy "+target, "danger"
+	}
+	if ev.User != "" {
+		text += " by " + ev.User
+	}
+
+	a := slackAttachment{Color: color}
+	if ev.TaskDefinition != "" {
+		a.Fields = append(a.Fields, slackField{Title: "Task definition", Value: ev.TaskDefinition, Short: true})
+	}
+	if ev.Type != DeploymentEventStart {
+		a.Fields = append(a.Fields, slackField{Title: "Duration", Value: ev.duration().String(), Short: true})
+	}
+	if len(ev.Images) > 0 {
+		a.Fields = append(a.Fields, slackField{Title: "Images", Value: strings.Join(ev.Images, "\n")})
+	}
+	if ev.Error != "" {
+		a.Fields = append(a.Fields, slackField{Title: "Error", Value: ev.Error})
+	}
+	p := &slackPayload{Channel: channel, Text: text}
+	if len(a.Fields) > 0 {
+		p.Attachments = []slackAttachment{a}
+	}
+	return p
+}
@@ -0,0 +1,141 @@
+package ecspresso_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestWebhookNotification(t *testing.T) {
+	var got ecspresso.DeploymentEvent
+	var header string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Token")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	c := &ecspresso.Config{
+		Region:  "ap-northeast-1",
+		Timeout: 600 * time.Second,
+		Service: "test",
+		Cluster: "default",
+		Notifications: &ecspresso.NotificationConfig{
+			Webhook: &ecspresso.WebhookNotificationConfig{
+				URL:     ts.URL,
+				Headers: map[string]string{"X-Token": "secret"},
+			},
+		},
+	}
+	if err := c.Restrict(); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecspresso.Notify(app, &ecspresso.DeploymentEvent{
+		Type:           ecspresso.DeploymentEventSuccess,
+		Service:        "test",
+		Cluster:        "default",
+		TaskDefinition: "test:3",
+		Images:         []string{"nginx:latest"},
+	})
+	if got.Type != ecspresso.DeploymentEventSuccess || got.Service != "test" || got.TaskDefinition != "test:3" || len(got.Images) != 1 {
+		t.Errorf("unexpected event %#v", got)
+	}
+	if header != "secret" {
+		t.Errorf("unexpected header %s", header)
+	}
+}
+
+func TestSlackPayload(t *testing.T) {
+	p := ecspresso.NewSlackPayload(&ecspresso.DeploymentEvent{
+		Type:            ecspresso.DeploymentEventFailure,
+		Service:         "test",
+		Cluster:         "default",
+		User:            "alice",
+		DurationSeconds: 83,
+		Error:           "failed to wait service stable",
+	}, "#deploy")
+	b, _ := json.Marshal(p)
+	s := string(b)
+	for _, expected := range []string{
+		`"channel":"#deploy"`,
+		"Failed to deploy service *test* on cluster *default* by alice",
+		`"color":"danger"`,
+		"1m23s",
+		"failed to wait service stable",
+	} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("%s is not found in %s", expected, s)
+		}
+	}
+}
+
+func TestGitHubDeploymentNotification(t *testing.T) {
+	var requests []string
+	var states []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Header.Get("Authorization") != "token xxx" {
+			t.Errorf("unexpected Authorization header %s", r.Header.Get("Authorization"))
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/repos/kayac/ecspresso/deployments":
+			if body["ref"] != "abcdef" || body["environment"] != "production" {
+				t.Errorf("unexpected deployment %v", body)
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":123}`))
+		case "/repos/kayac/ecspresso/deployments/123/statuses":
+			states = append(states, body["state"].(string))
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := &ecspresso.Config{
+		Region:  "ap-northeast-1",
+		Timeout: 600 * time.Second,
+		Service: "test",
+		Cluster: "default",
+		Notifications: &ecspresso.NotificationConfig{
+			GitHub: &ecspresso.GitHubNotificationConfig{
+				Repository:  "kayac/ecspresso",
+				Token:       "xxx",
+				Environment: "production",
+				Ref:         "abcdef",
+				APIURL:      ts.URL,
+			},
+		},
+	}
+	if err := c.Restrict(); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{ecspresso.DeploymentEventStart, ecspresso.DeploymentEventFailure} {
+		ecspresso.Notify(app, &ecspresso.DeploymentEvent{Type: typ, Service: "test", Cluster: "default"})
+	}
+	if len(requests) != 4 {
+		t.Errorf("unexpected requests %v", requests)
+	}
+	if strings.Join(states, ",") != "pending,in_progress,failure" {
+		t.Errorf("unexpected states %v", states)
+	}
+}
@@ -2,6 +2,7 @@ package ecspresso
 
 import (
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecs"
@@ -19,15 +20,29 @@ type optWithDesiredCount interface {
 }
 
 type DeployOption struct {
-	DryRun               *bool
-	DesiredCount         *int64
-	SkipTaskDefinition   *bool
-	ForceNewDeployment   *bool
-	NoWait               *bool
-	SuspendAutoScaling   *bool
-	RollbackEvents       *string
-	UpdateService        *bool
-	LatestTaskDefinition *bool
+	DryRun                         *bool
+	DesiredCount                   *int64
+	SkipTaskDefinition             *bool
+	ForceNewDeployment             *bool
+	NoWait                         *bool
+	SuspendAutoScaling             *bool
+	SuspendAutoScalingDuringDeploy *bool
+	AutoScalingMin                 *int64
+	AutoScalingMax                 *int64
+	RollbackEvents                 *string
+	UpdateService                  *bool
+	LatestTaskDefinition           *bool
+	ForceUnlock                    *bool
+	AllowScaleDown                 *bool
+	Estimate                       *bool
+	SummaryJSON                    *string
+	SummaryMarkdown                *string
+	RollbackOnFailure              *bool
+	RecreateService                *bool
+	HealthCheckGracePeriodSeconds  *int64
+	MinimumHealthyPercent          *int64
+	MaximumPercent                 *int64
+	SkipLogCheck                   *bool
 }
 
 func (opt DeployOption) getDesiredCount() *int64 {
@@ -42,7 +57,9 @@ func (opt DeployOption) DryRunString() string {
 }
 
 type StatusOption struct {
-	Events *int
+	Events        *int
+	Metrics       *bool
+	MetricsPeriod *time.Duration
 }
 
 type RollbackOption struct {
@@ -50,6 +67,7 @@ type RollbackOption struct {
 	DeregisterTaskDefinition *bool
 	NoWait                   *bool
 	RollbackEvents           *string
+	ForceUnlock              *bool
 }
 
 func (opt RollbackOption) DryRunString() string {
@@ -60,8 +78,9 @@ func (opt RollbackOption) DryRunString() string {
 }
 
 type DeleteOption struct {
-	DryRun *bool
-	Force  *bool
+	DryRun  *bool
+	Force   *bool
+	Cleanup *bool
 }
 
 func (opt DeleteOption) DryRunString() string {
@@ -85,6 +104,7 @@ type RunOption struct {
 	Tags                 *string
 	WaitUntil            *string
 	Revision             *int64
+	ScheduledTask        *string
 }
 
 func (opt RunOption) waitUntilRunning() bool {
@@ -125,10 +145,19 @@ func parseTags(s string) ([]*ecs.Tag, error) {
 }
 
 type WaitOption struct {
+	Until *[]string
 }
 
 type DiffOption struct {
-	Unified *bool
+	Unified  *bool
+	ExitCode *bool
+	Revision *int64
+	Against  *string
+}
+
+type DriftOption struct {
+	Unified  *bool
+	ExitCode *bool
 }
 
 type AppSpecOption struct {
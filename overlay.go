@@ -0,0 +1,64 @@
+package ecspresso
+
+import (
+	"os"
+	"path/filepath"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+)
+
+// Names of patch files in the overlay directory of the environment.
+const (
+	taskDefinitionMergePatchFile    = "taskdef.merge.json"
+	taskDefinitionJSONPatchFile     = "taskdef.patch.json"
+	serviceDefinitionMergePatchFile = "servicedef.merge.json"
+	serviceDefinitionJSONPatchFile  = "servicedef.patch.json"
+)
+
+func (d *App) overlayTaskDefinition(src []byte) ([]byte, error) {
+	return d.applyOverlay(src, taskDefinitionMergePatchFile, taskDefinitionJSONPatchFile)
+}
+
+func (d *App) overlayServiceDefinition(src []byte) ([]byte, error) {
+	return d.applyOverlay(src, serviceDefinitionMergePatchFile, serviceDefinitionJSONPatchFile)
+}
+
+// applyOverlay patches the definition by a JSON merge patch (RFC 7386) and then a JSON patch (RFC 6902)
+// in the overlay directory. Patch files which don't exist are skipped.
+func (d *App) applyOverlay(src []byte, mergePatchFile, jsonPatchFile string) ([]byte, error) {
+	dir := d.config.overlayDir
+	if dir == "" {
+		return src, nil
+	}
+	if path := filepath.Join(dir, mergePatchFile); fileExists(path) {
+		patch, err := d.readDefinitionFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", path)
+		}
+		if src, err = jsonpatch.MergePatch(src, patch); err != nil {
+			return nil, errors.Wrapf(err, "failed to apply merge patch %s", path)
+		}
+		d.DebugLog("applied merge patch", path)
+	}
+	if path := filepath.Join(dir, jsonPatchFile); fileExists(path) {
+		b, err := d.readDefinitionFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", path)
+		}
+		patch, err := jsonpatch.DecodePatch(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid JSON patch %s", path)
+		}
+		if src, err = patch.Apply(src); err != nil {
+			return nil, errors.Wrapf(err, "failed to apply JSON patch %s", path)
+		}
+		d.DebugLog("applied JSON patch", path)
+	}
+	return src, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
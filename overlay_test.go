@@ -0,0 +1,55 @@
+package ecspresso_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/kayac/ecspresso"
+)
+
+func TestLoadDefinitionsWithOverlay(t *testing.T) {
+	os.Setenv("TAG", "v1.2.3")
+	for _, env := range []string{"", "production"} {
+		c := ecspresso.NewDefaultConfig()
+		c.Environment = env
+		if err := c.Load("tests/overlay/ecspresso.yml"); err != nil {
+			t.Fatal(err)
+		}
+		app, err := ecspresso.NewApp(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		td, err := app.LoadTaskDefinition(c.TaskDefinitionPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sv, err := app.LoadServiceDefinition(c.ServiceDefinitionPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cd := td.ContainerDefinitions[0]
+		vpc := sv.NetworkConfiguration.AwsvpcConfiguration
+		if env == "" {
+			if aws.StringValue(td.Cpu) != "256" || aws.StringValue(td.Memory) != "512" || aws.StringValue(cd.Image) != "app:v1" {
+				t.Errorf("base task definition must not be patched: %s", td.String())
+			}
+			if aws.Int64Value(sv.DesiredCount) != 1 || aws.StringValue(vpc.AssignPublicIp) != "ENABLED" {
+				t.Errorf("base service definition must not be patched: %s", sv.String())
+			}
+			continue
+		}
+		if aws.StringValue(td.Cpu) != "1024" || td.Memory != nil {
+			t.Errorf("task definition must be patched by the merge patch: %s", td.String())
+		}
+		if aws.StringValue(cd.Image) != "app:v1.2.3" {
+			t.Errorf("image must be replaced by the JSON patch: %s", aws.StringValue(cd.Image))
+		}
+		if len(cd.Environment) != 3 || aws.StringValue(cd.Environment[2].Name) != "FEATURE" {
+			t.Errorf("environment must be added by the JSON patch: %v", cd.Environment)
+		}
+		if aws.Int64Value(sv.DesiredCount) != 3 || aws.StringValue(vpc.AssignPublicIp) != "DISABLED" || len(vpc.Subnets) != 1 {
+			t.Errorf("service definition must be patched by the merge patch: %s", sv.String())
+		}
+	}
+}
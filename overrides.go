@@ -0,0 +1,92 @@
+package ecspresso
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// overrideValue returns the value of the override option. Nil or negative values are not overridden.
+func overrideValue(v *int64) (int64, bool) {
+	if v == nil || *v < 0 {
+		return 0, false
+	}
+	return *v, true
+}
+
+func (opt DeployOption) hasServiceOverrides() bool {
+	for _, v := range []*int64{opt.HealthCheckGracePeriodSeconds, opt.MinimumHealthyPercent, opt.MaximumPercent} {
+		if _, ok := overrideValue(v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (opt DeployOption) validateServiceOverrides() error {
+	if v, ok := overrideValue(opt.MinimumHealthyPercent); ok && v > 100 {
+		return errors.Errorf("--minimum-healthy-percent must be 0-100: %d", v)
+	}
+	if v, ok := overrideValue(opt.MaximumPercent); ok && v < 100 {
+		return errors.Errorf("--maximum-percent must be 100 or more: %d", v)
+	}
+	return nil
+}
+
+// serviceOverride represents a change of the service attribute by the option for the deploy.
+type serviceOverride struct {
+	name string
+	from *int64
+	to   int64
+}
+
+func (o serviceOverride) diff() string {
+	from := "(not defined)"
+	if o.from != nil {
+		from = fmt.Sprint(*o.from)
+	}
+	return fmt.Sprintf("- %s: %s\n+ %s: %d\n", o.name, from, o.name, o.to)
+}
+
+// applyServiceOverrides overrides attributes of the service definition for the deploy.
+// The next deploy without overrides restores the values in the service definition.
+func applyServiceOverrides(sv *Service, opt DeployOption) []serviceOverride {
+	var overrides []serviceOverride
+	if v, ok := overrideValue(opt.HealthCheckGracePeriodSeconds); ok {
+		overrides = append(overrides, serviceOverride{"healthCheckGracePeriodSeconds", sv.HealthCheckGracePeriodSeconds, v})
+		sv.HealthCheckGracePeriodSeconds = aws.Int64(v)
+	}
+	minimum, okMin := overrideValue(opt.MinimumHealthyPercent)
+	maximum, okMax := overrideValue(opt.MaximumPercent)
+	if !okMin && !okMax {
+		return overrides
+	}
+	if sv.DeploymentConfiguration == nil {
+		sv.DeploymentConfiguration = &ecs.DeploymentConfiguration{}
+	}
+	dc := sv.DeploymentConfiguration
+	if okMin {
+		overrides = append(overrides, serviceOverride{"deploymentConfiguration.minimumHealthyPercent", dc.MinimumHealthyPercent, minimum})
+		dc.MinimumHealthyPercent = aws.Int64(minimum)
+	}
+	if okMax {
+		overrides = append(overrides, serviceOverride{"deploymentConfiguration.maximumPercent", dc.MaximumPercent, maximum})
+		dc.MaximumPercent = aws.Int64(maximum)
+	}
+	return overrides
+}
+
+func (d *App) logServiceOverrides(overrides []serviceOverride) {
+	if len(overrides) == 0 {
+		return
+	}
+	d.Log("Overriding service attributes for this deploy. the next deploy restores them by", d.config.ServiceDefinitionPath)
+	var b strings.Builder
+	for _, o := range overrides {
+		b.WriteString(o.diff())
+	}
+	fmt.Print(coloredDiff(strings.TrimSuffix(b.String(), "\n")))
+}
@@ -0,0 +1,70 @@
+package ecspresso_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestApplyServiceOverrides(t *testing.T) {
+	sv := &ecspresso.Service{}
+	sv.HealthCheckGracePeriodSeconds = aws.Int64(60)
+	diffs := ecspresso.ApplyServiceOverrides(sv, ecspresso.DeployOption{
+		HealthCheckGracePeriodSeconds: aws.Int64(600),
+		MinimumHealthyPercent:         aws.Int64(100),
+		MaximumPercent:                aws.Int64(-1), // not overridden
+	})
+	expected := []string{
+		"- healthCheckGracePeriodSeconds: 60\n+ healthCheckGracePeriodSeconds: 600\n",
+		"- deploymentConfiguration.minimumHealthyPercent: (not defined)\n+ deploymentConfiguration.minimumHealthyPercent: 100\n",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("unexpected overrides %#v", diffs)
+	}
+	if aws.Int64Value(sv.HealthCheckGracePeriodSeconds) != 600 {
+		t.Errorf("unexpected healthCheckGracePeriodSeconds %d", aws.Int64Value(sv.HealthCheckGracePeriodSeconds))
+	}
+	if dc := sv.DeploymentConfiguration; aws.Int64Value(dc.MinimumHealthyPercent) != 100 || dc.MaximumPercent != nil {
+		t.Errorf("unexpected deployment configuration %s", dc.String())
+	}
+
+	if diffs := ecspresso.ApplyServiceOverrides(&ecspresso.Service{}, ecspresso.DeployOption{}); len(diffs) != 0 {
+		t.Errorf("must not be overridden %v", diffs)
+	}
+}
+
+func TestDeployServiceOverridesValidation(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	fake := &fakeECS{
+		service: &ecs.Service{
+			ServiceName:    aws.String("test"),
+			ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+		},
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opt := range []ecspresso.DeployOption{
+		{HealthCheckGracePeriodSeconds: aws.Int64(600), UpdateService: aws.Bool(false)},
+		{MinimumHealthyPercent: aws.Int64(101), UpdateService: aws.Bool(true)},
+		{MaximumPercent: aws.Int64(50), UpdateService: aws.Bool(true)},
+	} {
+		if err := app.DeployWithContext(context.Background(), opt); err == nil {
+			t.Errorf("deploy must be failed with %v", opt)
+		}
+		if fake.updated != nil {
+			t.Error("service must not be updated")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// maxConcurrency is the maximum number of concurrent tasks run by runBufferedTasks.
+const maxConcurrency = 8
+
+type bufferedTask func(ctx context.Context, w io.Writer) error
+
+type bufferedTaskKey struct{}
+
+// inBufferedTask reports whether the context is of a task run by runBufferedTasks.
+func inBufferedTask(ctx context.Context) bool {
+	return ctx.Value(bufferedTaskKey{}) != nil
+}
+
+// runBufferedTasks runs independent tasks concurrently. Each task writes to its own buffer,
+// and the buffers are flushed to w in order of the tasks to keep the output same as sequential runs.
+// It returns the error of the first failed task in order, and the output of the following tasks is discarded.
+func runBufferedTasks(ctx context.Context, w io.Writer, tasks ...bufferedTask) error {
+	bufs := make([]bytes.Buffer, len(tasks))
+	errs := make([]error, len(tasks))
+	var eg errgroup.Group
+	eg.SetLimit(maxConcurrency)
+	ctx = context.WithValue(ctx, bufferedTaskKey{}, true)
+	for i, task := range tasks {
+		i, task := i, task
+		eg.Go(func() error {
+			errs[i] = task(ctx, &bufs[i])
+			return nil
+		})
+	}
+	eg.Wait()
+	for i := range tasks {
+		if _, err := bufs[i].WriteTo(w); err != nil {
+			return err
+		}
+		if errs[i] != nil {
+			return errs[i]
+		}
+	}
+	return nil
+}
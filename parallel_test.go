@@ -0,0 +1,63 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestRunBufferedTasksOrder(t *testing.T) {
+	var tasks []func(context.Context, io.Writer) error
+	for i := 0; i < 20; i++ {
+		i := i
+		tasks = append(tasks, func(ctx context.Context, w io.Writer) error {
+			// later tasks finish earlier
+			time.Sleep(time.Duration(20-i) * time.Millisecond)
+			fmt.Fprintf(w, "task %d\n", i)
+			return nil
+		})
+	}
+	var buf, expected bytes.Buffer
+	if err := ecspresso.RunBufferedTasks(context.Background(), &buf, tasks...); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&expected, "task %d\n", i)
+	}
+	if buf.String() != expected.String() {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestRunBufferedTasksError(t *testing.T) {
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+	var buf bytes.Buffer
+	err := ecspresso.RunBufferedTasks(context.Background(), &buf,
+		func(ctx context.Context, w io.Writer) error {
+			fmt.Fprintln(w, "a")
+			return nil
+		},
+		func(ctx context.Context, w io.Writer) error {
+			time.Sleep(10 * time.Millisecond)
+			fmt.Fprintln(w, "b")
+			return errFirst
+		},
+		func(ctx context.Context, w io.Writer) error {
+			fmt.Fprintln(w, "c")
+			return errSecond
+		},
+	)
+	if err != errFirst {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if s := buf.String(); s != "a\nb\n" {
+		t.Errorf("unexpected output: %q", s)
+	}
+}
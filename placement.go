@@ -0,0 +1,160 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+const availabilityZoneAttribute = "ecs.availability-zone"
+
+var placementAttributeRegex = regexp.MustCompile(`attribute:([A-Za-z0-9_.\-/@]+)`)
+
+// normalizePlacementStrategy normalizes fields of the strategies as same as ECS returns.
+// The order of strategies is significant, so they are not sorted.
+func normalizePlacementStrategy(items []*ecs.PlacementStrategy) {
+	for _, s := range items {
+		switch aws.StringValue(s.Type) {
+		case ecs.PlacementStrategyTypeRandom:
+			s.Field = nil
+		case ecs.PlacementStrategyTypeSpread:
+			if strings.EqualFold(aws.StringValue(s.Field), "host") {
+				s.Field = aws.String("instanceId")
+			}
+		case ecs.PlacementStrategyTypeBinpack:
+			s.Field = aws.String(strings.ToLower(aws.StringValue(s.Field)))
+		}
+	}
+}
+
+// clearRemovedPlacement makes the service definition remove placement constraints and strategies of the current service
+// which are not defined. UpdateService keeps them as is when they are not specified.
+func clearRemovedPlacement(sv *Service, current *ecs.Service) {
+	if isDaemon(&sv.Service) {
+		return
+	}
+	if sv.PlacementConstraints == nil && len(current.PlacementConstraints) > 0 {
+		sv.PlacementConstraints = []*ecs.PlacementConstraint{}
+	}
+	if sv.PlacementStrategy == nil && len(current.PlacementStrategy) > 0 {
+		sv.PlacementStrategy = []*ecs.PlacementStrategy{}
+	}
+}
+
+// validatePlacement validates types and fields of placement constraints and strategies.
+func validatePlacement(constraints []*ecs.PlacementConstraint, strategies []*ecs.PlacementStrategy) error {
+	for i, c := range constraints {
+		switch aws.StringValue(c.Type) {
+		case ecs.PlacementConstraintTypeMemberOf:
+			if aws.StringValue(c.Expression) == "" {
+				return errors.Errorf("placementConstraints[%d]: memberOf requires an expression", i)
+			}
+		case ecs.PlacementConstraintTypeDistinctInstance:
+			if c.Expression != nil {
+				return errors.Errorf("placementConstraints[%d]: distinctInstance does not take an expression", i)
+			}
+		default:
+			return errors.Errorf("placementConstraints[%d]: unknown type %q", i, aws.StringValue(c.Type))
+		}
+	}
+	for i, s := range strategies {
+		field := aws.StringValue(s.Field)
+		switch aws.StringValue(s.Type) {
+		case ecs.PlacementStrategyTypeRandom:
+		case ecs.PlacementStrategyTypeSpread:
+			if !strings.EqualFold(field, "instanceId") && !strings.EqualFold(field, "host") && !strings.HasPrefix(field, "attribute:") {
+				return errors.Errorf("placementStrategy[%d]: spread field must be instanceId, host or attribute:NAME: %q", i, field)
+			}
+		case ecs.PlacementStrategyTypeBinpack:
+			if !strings.EqualFold(field, "cpu") && !strings.EqualFold(field, "memory") {
+				return errors.Errorf("placementStrategy[%d]: binpack field must be cpu or memory: %q", i, field)
+			}
+		default:
+			return errors.Errorf("placementStrategy[%d]: unknown type %q", i, aws.StringValue(s.Type))
+		}
+	}
+	return nil
+}
+
+// placementAttributeWarnings returns warnings for attributes referenced by placement constraints and strategies
+// which do not make sense for the container instances.
+func placementAttributeWarnings(constraints []*ecs.PlacementConstraint, strategies []*ecs.PlacementStrategy, instances []*ecs.ContainerInstance) []string {
+	values := map[string]map[string]bool{}
+	for _, ci := range instances {
+		for _, a := range ci.Attributes {
+			name := aws.StringValue(a.Name)
+			if values[name] == nil {
+				values[name] = map[string]bool{}
+			}
+			values[name][aws.StringValue(a.Value)] = true
+		}
+	}
+
+	var warns []string
+	seen := map[string]bool{}
+	for _, c := range constraints {
+		for _, m := range placementAttributeRegex.FindAllStringSubmatch(aws.StringValue(c.Expression), -1) {
+			name := m[1]
+			if values[name] == nil && !seen[name] {
+				seen[name] = true
+				warns = append(warns, fmt.Sprintf("attribute %s in memberOf expression is not found in container instances", name))
+			}
+		}
+	}
+	for _, s := range strategies {
+		field := aws.StringValue(s.Field)
+		if aws.StringValue(s.Type) != ecs.PlacementStrategyTypeSpread || !strings.HasPrefix(field, "attribute:") {
+			continue
+		}
+		name := strings.TrimPrefix(field, "attribute:")
+		switch n := len(values[name]); {
+		case n == 0:
+			warns = append(warns, fmt.Sprintf("attribute %s to spread is not found in container instances", name))
+		case n == 1 && name == availabilityZoneAttribute:
+			var az []string
+			for v := range values[name] {
+				az = append(az, v)
+			}
+			warns = append(warns, fmt.Sprintf("spread by %s has no effect. all container instances are in %s", name, az[0]))
+		}
+	}
+	sort.Strings(warns)
+	return warns
+}
+
+func (d *App) verifyPlacement(ctx context.Context, sv *Service, td *TaskDefinitionInput) error {
+	constraints := append([]*ecs.PlacementConstraint{}, sv.PlacementConstraints...)
+	for _, c := range td.PlacementConstraints {
+		constraints = append(constraints, &ecs.PlacementConstraint{Type: c.Type, Expression: c.Expression})
+	}
+	if err := validatePlacement(constraints, sv.PlacementStrategy); err != nil {
+		return err
+	}
+	if isFargate, err := d.isFargateService(); err != nil {
+		return err
+	} else if isFargate {
+		return errors.New("placement constraints and strategies are not supported for Fargate")
+	}
+
+	var instances []*ecs.ContainerInstance
+	err := d.eachContainerInstance(ctx, func(ci *ecs.ContainerInstance) bool {
+		instances = append(instances, ci)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		return verifySkipErr("no container instances are registered in the cluster")
+	}
+	if warns := placementAttributeWarnings(constraints, sv.PlacementStrategy, instances); len(warns) > 0 {
+		return verifyWarnErr(strings.Join(warns, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package ecspresso_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func placementStrategy(typ, field string) *ecs.PlacementStrategy {
+	s := &ecs.PlacementStrategy{Type: aws.String(typ)}
+	if field != "" {
+		s.Field = aws.String(field)
+	}
+	return s
+}
+
+func TestSortServiceDefinitionForDiffKeepsPlacementStrategyOrder(t *testing.T) {
+	sv := &ecs.Service{
+		PlacementStrategy: []*ecs.PlacementStrategy{
+			placementStrategy("spread", "host"),
+			placementStrategy("binpack", "MEMORY"),
+			placementStrategy("random", "cpu"),
+		},
+	}
+	ecspresso.SortServiceDefinitionForDiff(sv)
+	expected := []*ecs.PlacementStrategy{
+		placementStrategy("spread", "instanceId"),
+		placementStrategy("binpack", "memory"),
+		placementStrategy("random", ""),
+	}
+	if !reflect.DeepEqual(sv.PlacementStrategy, expected) {
+		t.Errorf("unexpected placement strategy %v", sv.PlacementStrategy)
+	}
+}
+
+func TestClearRemovedPlacement(t *testing.T) {
+	current := &ecs.Service{
+		PlacementConstraints: []*ecs.PlacementConstraint{{Type: aws.String("distinctInstance")}},
+		PlacementStrategy:    []*ecs.PlacementStrategy{placementStrategy("spread", "instanceId")},
+	}
+	sv := &ecspresso.Service{}
+	ecspresso.ClearRemovedPlacement(sv, current)
+	if sv.PlacementConstraints == nil || len(sv.PlacementConstraints) != 0 {
+		t.Errorf("placement constraints must be cleared %v", sv.PlacementConstraints)
+	}
+	if sv.PlacementStrategy == nil || len(sv.PlacementStrategy) != 0 {
+		t.Errorf("placement strategy must be cleared %v", sv.PlacementStrategy)
+	}
+
+	sv = &ecspresso.Service{}
+	ecspresso.ClearRemovedPlacement(sv, &ecs.Service{})
+	if sv.PlacementConstraints != nil || sv.PlacementStrategy != nil {
+		t.Error("placement must not be specified when the current service has none")
+	}
+}
+
+func TestValidatePlacement(t *testing.T) {
+	testCases := []struct {
+		name        string
+		constraints []*ecs.PlacementConstraint
+		strategies  []*ecs.PlacementStrategy
+		isErr       bool
+	}{
+		{
+			name: "valid",
+			constraints: []*ecs.PlacementConstraint{
+				{Type: aws.String("memberOf"), Expression: aws.String("attribute:ecs.instance-type =~ t3.*")},
+				{Type: aws.String("distinctInstance")},
+			},
+			strategies: []*ecs.PlacementStrategy{
+				placementStrategy("spread", "attribute:ecs.availability-zone"),
+				placementStrategy("binpack", "cpu"),
+				placementStrategy("random", ""),
+			},
+		},
+		{
+			name:        "memberOf without expression",
+			constraints: []*ecs.PlacementConstraint{{Type: aws.String("memberOf")}},
+			isErr:       true,
+		},
+		{
+			name:       "binpack by az",
+			strategies: []*ecs.PlacementStrategy{placementStrategy("binpack", "attribute:ecs.availability-zone")},
+			isErr:      true,
+		},
+		{
+			name:       "unknown type",
+			strategies: []*ecs.PlacementStrategy{placementStrategy("pack", "cpu")},
+			isErr:      true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := ecspresso.ValidatePlacement(tc.constraints, tc.strategies); (err != nil) != tc.isErr {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func containerInstanceWithAttributes(attrs map[string]string) *ecs.ContainerInstance {
+	ci := &ecs.ContainerInstance{}
+	for k, v := range attrs {
+		ci.Attributes = append(ci.Attributes, &ecs.Attribute{Name: aws.String(k), Value: aws.String(v)})
+	}
+	return ci
+}
+
+func TestPlacementAttributeWarnings(t *testing.T) {
+	instances := []*ecs.ContainerInstance{
+		containerInstanceWithAttributes(map[string]string{"ecs.availability-zone": "ap-northeast-1a", "role": "web"}),
+		containerInstanceWithAttributes(map[string]string{"ecs.availability-zone": "ap-northeast-1a"}),
+	}
+	constraints := []*ecs.PlacementConstraint{
+		{Type: aws.String("memberOf"), Expression: aws.String("attribute:role == web and attribute:stack == prod")},
+	}
+	strategies := []*ecs.PlacementStrategy{
+		placementStrategy("spread", "attribute:ecs.availability-zone"),
+		placementStrategy("spread", "attribute:rack"),
+	}
+	warns := ecspresso.PlacementAttributeWarnings(constraints, strategies, instances)
+	expected := []string{
+		"attribute rack to spread is not found in container instances",
+		"attribute stack in memberOf expression is not found in container instances",
+		"spread by ecs.availability-zone has no effect. all container instances are in ap-northeast-1a",
+	}
+	if !reflect.DeepEqual(warns, expected) {
+		t.Errorf("unexpected warnings %#v", warns)
+	}
+
+	instances = append(instances, containerInstanceWithAttributes(map[string]string{
+		"ecs.availability-zone": "ap-northeast-1c", "stack": "prod", "rack": "r1",
+	}))
+	if warns := ecspresso.PlacementAttributeWarnings(constraints, strategies, instances); len(warns) != 0 {
+		t.Errorf("unexpected warnings %#v", warns)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"github.com/fujiwara/cfn-lookup/cfn"
-	"github.com/fujiwara/tfstate-lookup/tfstate"
 )
 
 type ConfigPlugin struct {
@@ -21,11 +20,31 @@ func (p ConfigPlugin) Setup(c *Config) error {
 		return setupPluginTFState(p, c)
 	case "cloudformation":
 		return setupPluginCFn(p, c)
+	case "exec":
+		return setupPluginExec(p, c)
 	default:
 		return fmt.Errorf("plugin %s is not available", p.Name)
 	}
 }
 
+// templateFuncNames returns names of the template functions provided by the plugin without setting it up.
+func (p ConfigPlugin) templateFuncNames() ([]string, error) {
+	switch strings.ToLower(p.Name) {
+	case "tfstate":
+		return []string{"tfstate", "tfstatef"}, nil
+	case "cloudformation":
+		return []string{"cfn_output", "cfn_export"}, nil
+	case "exec":
+		funcs, err := stringsOf(p.Config["functions"])
+		if err != nil || len(funcs) == 0 {
+			return nil, errors.New("exec plugin requires functions as a list of function names")
+		}
+		return funcs, nil
+	default:
+		return nil, fmt.Errorf("plugin %s is not available", p.Name)
+	}
+}
+
 func setupPluginTFState(p ConfigPlugin, c *Config) error {
 	var loc string
 	if p.Config["path"] != nil {
@@ -46,11 +65,11 @@ func setupPluginTFState(p ConfigPlugin, c *Config) error {
 	} else {
 		return errors.New("tfstate plugin requires path or url for tfstate location")
 	}
-	funcs, err := tfstate.FuncMap(loc)
+	l, err := newTFStateLookup(loc, c.TFStateCacheTTL)
 	if err != nil {
 		return err
 	}
-	c.templateFuncs = append(c.templateFuncs, funcs)
+	c.templateFuncs = append(c.templateFuncs, l.funcMap())
 	return nil
 }
 
@@ -0,0 +1,167 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultExecPluginTimeout = 30 * time.Second
+
+// execPluginRequest is written to the stdin of the plugin command for each function call.
+type execPluginRequest struct {
+	Function string        `json:"function"`
+	Args     []interface{} `json:"args"`
+}
+
+// execPluginResponse is read from the stdout of the plugin command.
+type execPluginResponse struct {
+	Value json.RawMessage `json:"value"`
+	Error string          `json:"error,omitempty"`
+}
+
+// execPlugin calls template functions implemented by an external command.
+type execPlugin struct {
+	command []string
+	timeout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func setupPluginExec(p ConfigPlugin, c *Config) error {
+	ep, funcs, err := newExecPlugin(p.Config, c.dir)
+	if err != nil {
+		return err
+	}
+	fm := template.FuncMap{}
+	for _, name := range funcs {
+		fm[name] = ep.templateFunc(name)
+	}
+	c.templateFuncs = append(c.templateFuncs, fm)
+	return nil
+}
+
+func newExecPlugin(config map[string]interface{}, dir string) (*execPlugin, []string, error) {
+	name, ok := config["command"].(string)
+	if !ok || name == "" {
+		return nil, nil, errors.New("exec plugin requires command as a string")
+	}
+	if strings.Contains(name, "/") && !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	command := []string{name}
+	if config["args"] != nil {
+		args, err := stringsOf(config["args"])
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "exec plugin requires args as a list of strings")
+		}
+		command = append(command, args...)
+	}
+	funcs, err := stringsOf(config["functions"])
+	if err != nil || len(funcs) == 0 {
+		return nil, nil, errors.New("exec plugin requires functions as a list of function names")
+	}
+	timeout := defaultExecPluginTimeout
+	if config["timeout"] != nil {
+		s, ok := config["timeout"].(string)
+		if !ok {
+			return nil, nil, errors.New("exec plugin requires timeout as a duration string (e.g. 10s)")
+		}
+		if timeout, err = time.ParseDuration(s); err != nil {
+			return nil, nil, errors.Wrap(err, "exec plugin has invalid timeout")
+		}
+	}
+	return &execPlugin{
+		command: command,
+		timeout: timeout,
+		cache:   map[string]string{},
+	}, funcs, nil
+}
+
+func stringsOf(v interface{}) ([]string, error) {
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("not a list")
+	}
+	ss := make([]string, 0, len(vs))
+	for _, v := range vs {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("%v is not a string", v)
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+func (p *execPlugin) templateFunc(name string) func(args ...interface{}) (string, error) {
+	return func(args ...interface{}) (string, error) {
+		if args == nil {
+			args = []interface{}{}
+		}
+		return p.call(name, args)
+	}
+}
+
+// call runs the command for the function call. Results are cached for the same arguments.
+func (p *execPlugin) call(name string, args []interface{}) (string, error) {
+	req, err := json.Marshal(execPluginRequest{Function: name, Args: args})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to marshal args of %s", name)
+	}
+	key := string(req)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v, ok := p.cache[key]; ok {
+		return v, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	cmd.Stdin = bytes.NewReader(req)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "plugin function %s failed: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	var res execPluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		return "", errors.Wrapf(err, "plugin function %s returned invalid response", name)
+	}
+	if res.Error != "" {
+		return "", errors.Errorf("plugin function %s failed: %s", name, res.Error)
+	}
+	v, err := execPluginValue(res.Value)
+	if err != nil {
+		return "", errors.Wrapf(err, "plugin function %s returned invalid value", name)
+	}
+	p.cache[key] = v
+	return v, nil
+}
+
+// execPluginValue returns a string value as is, and others as JSON.
+func execPluginValue(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", errors.New("no value")
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
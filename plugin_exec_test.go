@@ -0,0 +1,42 @@
+package ecspresso_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/kayac/ecspresso"
+)
+
+func TestExecPlugin(t *testing.T) {
+	c := &ecspresso.Config{}
+	if err := c.Load("tests/plugin/ecspresso.yml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td, err := app.LoadTaskDefinition(c.TaskDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := aws.StringValue(td.Family); f != "TEST" {
+		t.Errorf("unexpected family %s", f)
+	}
+	env := td.ContainerDefinitions[0].Environment[0]
+	if v := aws.StringValue(env.Value); v != `{"function":"request","args":["foo",1]}` {
+		t.Errorf("unexpected value %s", v)
+	}
+}
+
+func TestExecPluginError(t *testing.T) {
+	_, err := ecspresso.CallExecPlugin("tests/plugin/lookup.sh", "unknown")
+	if err == nil || !strings.Contains(err.Error(), "unknown function") {
+		t.Errorf("unexpected error %v", err)
+	}
+	_, err = ecspresso.CallExecPlugin("tests/plugin/not-found.sh", "upper", "foo")
+	if err == nil {
+		t.Error("command not found must be an error")
+	}
+}
@@ -0,0 +1,232 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+type PrecheckOption struct{}
+
+// Targets of the default route of subnets.
+const (
+	routeInternetGateway = "internet gateway"
+	routeNATGateway      = "NAT gateway"
+	routeOther           = "other"
+)
+
+// Precheck validates the network environment of the service before the first deploy.
+// It catches tasks stuck in PROVISIONING by unable to pull images, get secrets or put logs.
+func (d *App) Precheck(opt PrecheckOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return err
+	}
+	var sv *Service
+	if p := d.config.ServiceDefinitionPath; p != "" {
+		if sv, err = d.LoadServiceDefinition(p); err != nil {
+			return err
+		}
+	}
+
+	d.Log("Starting precheck")
+	err = d.verifyResources(ctx, []verifyResourceItem{
+		{name: "Cluster", fn: d.verifyCluster},
+		{name: "Network", fn: func(ctx context.Context) error {
+			return d.precheckNetwork(ctx, sv, td)
+		}},
+	})
+	if err != nil {
+		return withDefaultExitCode(ExitCodeVerifyFailed, err)
+	}
+	d.Log("Precheck OK!")
+	return nil
+}
+
+// requiredEndpointServices returns AWS services which tasks of the task definition access to start.
+func requiredEndpointServices(td *TaskDefinitionInput) []string {
+	required := map[string]bool{}
+	for _, c := range td.ContainerDefinitions {
+		if ecrImageURLRegex.MatchString(aws.StringValue(c.Image)) {
+			// image layers of ECR are in S3
+			required["ecr.api"], required["ecr.dkr"], required["s3"] = true, true, true
+		}
+		if lc := c.LogConfiguration; lc != nil && aws.StringValue(lc.LogDriver) == "awslogs" {
+			required["logs"] = true
+		}
+		for _, s := range c.Secrets {
+			if strings.HasPrefix(aws.StringValue(s.ValueFrom), "arn:aws:secretsmanager:") {
+				required["secretsmanager"] = true
+			} else {
+				required["ssm"] = true
+			}
+		}
+	}
+	services := make([]string, 0, len(required))
+	for s := range required {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// defaultRouteTarget returns the target of the default route (0.0.0.0/0) in the route table.
+func defaultRouteTarget(rt *ec2.RouteTable) string {
+	for _, r := range rt.Routes {
+		if aws.StringValue(r.DestinationCidrBlock) != "0.0.0.0/0" || aws.StringValue(r.State) == ec2.RouteStateBlackhole {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(aws.StringValue(r.GatewayId), "igw-"):
+			return routeInternetGateway
+		case r.NatGatewayId != nil:
+			return routeNATGateway
+		default:
+			return routeOther
+		}
+	}
+	return ""
+}
+
+// egressAllowsHTTPS reports whether egress rules of security groups allow HTTPS to anywhere.
+// When the destinations are limited, it returns them.
+func egressAllowsHTTPS(sgs []*ec2.SecurityGroup) (bool, []string) {
+	var limited []string
+	for _, sg := range sgs {
+		for _, p := range sg.IpPermissionsEgress {
+			proto := aws.StringValue(p.IpProtocol)
+			if proto != "-1" && !(proto == "tcp" && aws.Int64Value(p.FromPort) <= 443 && aws.Int64Value(p.ToPort) >= 443) {
+				continue
+			}
+			for _, r := range p.IpRanges {
+				if aws.StringValue(r.CidrIp) == "0.0.0.0/0" {
+					return true, nil
+				}
+				limited = append(limited, aws.StringValue(r.CidrIp))
+			}
+			for _, pl := range p.PrefixListIds {
+				limited = append(limited, aws.StringValue(pl.PrefixListId))
+			}
+			for _, g := range p.UserIdGroupPairs {
+				limited = append(limited, aws.StringValue(g.GroupId))
+			}
+		}
+	}
+	return false, limited
+}
+
+// subnetNeedsEndpoints reports whether tasks in the subnet reach AWS services only by VPC endpoints.
+func subnetNeedsEndpoints(route string, assignPublicIP bool) bool {
+	return route == "" || route == routeInternetGateway && !assignPublicIP
+}
+
+// checkSubnetRoute checks the route of the subnet to the internet.
+// Subnets without the route are checked by checkVPCEndpoint.
+func checkSubnetRoute(subnet, route string, assignPublicIP bool) error {
+	switch {
+	case route == routeOther:
+		return verifyWarnErr(fmt.Sprintf("subnet %s routes to the internet by neither an internet gateway nor a NAT gateway. make sure it can reach AWS services", subnet))
+	case route == routeInternetGateway && !assignPublicIP:
+		return verifyWarnErr(fmt.Sprintf("subnet %s routes to an internet gateway, but assignPublicIp is DISABLED. tasks reach AWS services only by VPC endpoints", subnet))
+	case route == "":
+		return verifyWarnErr(fmt.Sprintf("subnet %s has no route to the internet. tasks reach AWS services only by VPC endpoints", subnet))
+	}
+	return nil
+}
+
+func (d *App) precheckNetwork(ctx context.Context, sv *Service, td *TaskDefinitionInput) error {
+	if sv == nil || sv.NetworkConfiguration == nil || sv.NetworkConfiguration.AwsvpcConfiguration == nil {
+		return verifySkipErr("no awsvpc network configuration in the service definition")
+	}
+	ac := sv.NetworkConfiguration.AwsvpcConfiguration
+	required := requiredEndpointServices(td)
+	assignPublicIP := aws.StringValue(ac.AssignPublicIp) == ecs.AssignPublicIpEnabled
+
+	subnets, err := d.ec2.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{SubnetIds: ac.Subnets})
+	if err != nil {
+		return errors.Wrap(err, "failed to describe subnets")
+	}
+	if len(subnets.Subnets) == 0 {
+		return errors.New("no subnets in the network configuration")
+	}
+
+	private := &privateNetwork{securityGroupIDs: aws.StringValueSlice(ac.SecurityGroups)}
+	for _, s := range subnets.Subnets {
+		s := s
+		if err := d.verifyResource(ctx, fmt.Sprintf("Subnet[%s]", aws.StringValue(s.SubnetId)), func(ctx context.Context) error {
+			rt, err := d.subnetRouteTable(ctx, s)
+			if err != nil {
+				return err
+			}
+			route := defaultRouteTarget(rt)
+			if subnetNeedsEndpoints(route, assignPublicIP) {
+				private.routeTableIDs = appendIfMissing(private.routeTableIDs, aws.StringValue(rt.RouteTableId))
+				private.subnetCIDRs = append(private.subnetCIDRs, aws.StringValue(s.CidrBlock))
+			}
+			return checkSubnetRoute(aws.StringValue(s.SubnetId), route, assignPublicIP)
+		}); err != nil {
+			return err
+		}
+	}
+	if len(private.subnetCIDRs) > 0 && len(required) > 0 {
+		vpcID := aws.StringValue(subnets.Subnets[0].VpcId)
+		if err := d.verifyResource(ctx, "VPCEndpoints", func(ctx context.Context) error {
+			return d.verifyVPCEndpoints(ctx, vpcID, required, private)
+		}); err != nil {
+			return err
+		}
+	}
+	return d.verifyResource(ctx, "SecurityGroups", func(ctx context.Context) error {
+		if len(ac.SecurityGroups) == 0 {
+			return verifySkipErr("no security groups. the default security group of the VPC is used")
+		}
+		out, err := d.ec2.DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: ac.SecurityGroups})
+		if err != nil {
+			return errors.Wrap(err, "failed to describe security groups")
+		}
+		ok, limited := egressAllowsHTTPS(out.SecurityGroups)
+		switch {
+		case ok || len(required) == 0:
+			return nil
+		case len(limited) == 0:
+			return errors.Errorf("egress rules of security groups deny HTTPS (443). tasks can't reach %s", strings.Join(required, ", "))
+		default:
+			return verifyWarnErr(fmt.Sprintf("egress of HTTPS (443) is limited to %s. make sure it covers endpoints of %s", strings.Join(limited, ", "), strings.Join(required, ", ")))
+		}
+	})
+}
+
+func appendIfMissing(ss []string, s string) []string {
+	for _, v := range ss {
+		if v == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
+
+// subnetRouteTable returns the route table associated with the subnet, or the main route table of the VPC.
+func (d *App) subnetRouteTable(ctx context.Context, s *ec2.Subnet) (*ec2.RouteTable, error) {
+	for _, filter := range [][]*ec2.Filter{
+		{{Name: aws.String("association.subnet-id"), Values: []*string{s.SubnetId}}},
+		{{Name: aws.String("vpc-id"), Values: []*string{s.VpcId}}, {Name: aws.String("association.main"), Values: aws.StringSlice([]string{"true"})}},
+	} {
+		out, err := d.ec2.DescribeRouteTablesWithContext(ctx, &ec2.DescribeRouteTablesInput{Filters: filter})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe route tables")
+		}
+		if len(out.RouteTables) > 0 {
+			return out.RouteTables[0], nil
+		}
+	}
+	return nil, errors.Errorf("route table of %s is not found", aws.StringValue(s.SubnetId))
+}
@@ -0,0 +1,149 @@
+package ecspresso_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestRequiredEndpointServices(t *testing.T) {
+	td := &ecspresso.TaskDefinitionInput{
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{
+				Image: aws.String("123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/app:v1"),
+				LogConfiguration: &ecs.LogConfiguration{
+					LogDriver: aws.String("awslogs"),
+				},
+				Secrets: []*ecs.Secret{
+					{Name: aws.String("DB_PASSWORD"), ValueFrom: aws.String("arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:db")},
+				},
+			},
+			{Image: aws.String("nginx:latest")},
+		},
+	}
+	expected := []string{"ecr.api", "ecr.dkr", "logs", "s3", "secretsmanager"}
+	if got := ecspresso.RequiredEndpointServices(td); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected services %v", got)
+	}
+}
+
+func TestDefaultRouteTarget(t *testing.T) {
+	testCases := []struct {
+		route    *ec2.Route
+		expected string
+	}{
+		{&ec2.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), GatewayId: aws.String("igw-1234")}, "internet gateway"},
+		{&ec2.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), NatGatewayId: aws.String("nat-1234")}, "NAT gateway"},
+		{&ec2.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), TransitGatewayId: aws.String("tgw-1234")}, "other"},
+		{&ec2.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), NatGatewayId: aws.String("nat-1234"), State: aws.String("blackhole")}, ""},
+		{&ec2.Route{DestinationCidrBlock: aws.String("10.0.0.0/16"), GatewayId: aws.String("local")}, ""},
+	}
+	for _, tc := range testCases {
+		rt := &ec2.RouteTable{Routes: []*ec2.Route{tc.route}}
+		if got := ecspresso.DefaultRouteTarget(rt); got != tc.expected {
+			t.Errorf("unexpected target %q for %s", got, tc.route.String())
+		}
+	}
+}
+
+func TestEgressAllowsHTTPS(t *testing.T) {
+	all := &ec2.SecurityGroup{IpPermissionsEgress: []*ec2.IpPermission{
+		{IpProtocol: aws.String("-1"), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+	}}
+	limited := &ec2.SecurityGroup{IpPermissionsEgress: []*ec2.IpPermission{
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(443), ToPort: aws.Int64(443), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/16")}}},
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(5432), ToPort: aws.Int64(5432), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+	}}
+	if ok, _ := ecspresso.EgressAllowsHTTPS([]*ec2.SecurityGroup{limited, all}); !ok {
+		t.Error("egress must allow HTTPS")
+	}
+	ok, dests := ecspresso.EgressAllowsHTTPS([]*ec2.SecurityGroup{limited})
+	if ok || !reflect.DeepEqual(dests, []string{"10.0.0.0/16"}) {
+		t.Errorf("egress must be limited: %v %v", ok, dests)
+	}
+	if ok, dests := ecspresso.EgressAllowsHTTPS([]*ec2.SecurityGroup{{}}); ok || len(dests) != 0 {
+		t.Errorf("egress must deny HTTPS: %v %v", ok, dests)
+	}
+}
+
+func TestCheckSubnetRoute(t *testing.T) {
+	testCases := []struct {
+		route          string
+		assignPublicIP bool
+		ok             bool
+	}{
+		{"NAT gateway", false, true},
+		{"internet gateway", true, true},
+		{"internet gateway", false, false},
+		{"other", false, false},
+		{"", false, false},
+	}
+	for _, tc := range testCases {
+		err := ecspresso.CheckSubnetRoute("subnet-1234", tc.route, tc.assignPublicIP)
+		if (err == nil) != tc.ok {
+			t.Errorf("unexpected result for route=%q assignPublicIp=%v: %v", tc.route, tc.assignPublicIP, err)
+		}
+	}
+}
+
+func TestCheckVPCEndpoint(t *testing.T) {
+	endpoints := []*ec2.VpcEndpoint{
+		{
+			VpcEndpointId: aws.String("vpce-s3"), ServiceName: aws.String("com.amazonaws.ap-northeast-1.s3"),
+			VpcEndpointType: aws.String("Gateway"), State: aws.String("available"),
+			RouteTableIds: aws.StringSlice([]string{"rtb-1"}),
+		},
+		{
+			VpcEndpointId: aws.String("vpce-dkr"), ServiceName: aws.String("com.amazonaws.ap-northeast-1.ecr.dkr"),
+			VpcEndpointType: aws.String("Interface"), State: aws.String("available"), PrivateDnsEnabled: aws.Bool(true),
+			Groups: []*ec2.SecurityGroupIdentifier{{GroupId: aws.String("sg-endpoint")}},
+		},
+		{
+			VpcEndpointId: aws.String("vpce-api"), ServiceName: aws.String("com.amazonaws.ap-northeast-1.ecr.api"),
+			VpcEndpointType: aws.String("Interface"), State: aws.String("available"), PrivateDnsEnabled: aws.Bool(false),
+			Groups: []*ec2.SecurityGroupIdentifier{{GroupId: aws.String("sg-endpoint")}},
+		},
+		{
+			VpcEndpointId: aws.String("vpce-logs"), ServiceName: aws.String("com.amazonaws.ap-northeast-1.logs"),
+			VpcEndpointType: aws.String("Interface"), State: aws.String("available"), PrivateDnsEnabled: aws.Bool(true),
+			Groups: []*ec2.SecurityGroupIdentifier{{GroupId: aws.String("sg-closed")}},
+		},
+	}
+	sgs := map[string]*ec2.SecurityGroup{
+		"sg-endpoint": {GroupId: aws.String("sg-endpoint"), IpPermissions: []*ec2.IpPermission{
+			{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(443), ToPort: aws.Int64(443), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/16")}}},
+		}},
+		"sg-closed": {GroupId: aws.String("sg-closed"), IpPermissions: []*ec2.IpPermission{
+			{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(443), ToPort: aws.Int64(443), UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-other")}}},
+		}},
+	}
+	testCases := []struct {
+		svc           string
+		routeTableIDs []string
+		subnetCIDRs   []string
+		ok            bool
+	}{
+		{"s3", []string{"rtb-1"}, []string{"10.0.1.0/24"}, true},
+		{"s3", []string{"rtb-1", "rtb-2"}, []string{"10.0.1.0/24"}, false},
+		{"ecr.dkr", []string{"rtb-1"}, []string{"10.0.1.0/24"}, true},
+		{"ecr.dkr", []string{"rtb-1"}, []string{"10.0.1.0/24", "10.1.1.0/24"}, false},
+		{"ecr.api", []string{"rtb-1"}, []string{"10.0.1.0/24"}, false},
+		{"logs", []string{"rtb-1"}, []string{"10.0.1.0/24"}, false},
+		{"secretsmanager", []string{"rtb-1"}, []string{"10.0.1.0/24"}, false},
+	}
+	for _, tc := range testCases {
+		err := ecspresso.CheckVPCEndpoint(tc.svc, endpoints, tc.routeTableIDs, tc.subnetCIDRs, []string{"sg-task"}, sgs)
+		if (err == nil) != tc.ok {
+			t.Errorf("unexpected result for %s %v %v: %v", tc.svc, tc.routeTableIDs, tc.subnetCIDRs, err)
+		}
+	}
+	// allowed by the security group of tasks
+	sgs["sg-closed"].IpPermissions[0].UserIdGroupPairs[0].GroupId = aws.String("sg-task")
+	if err := ecspresso.CheckVPCEndpoint("logs", endpoints, nil, []string{"10.0.1.0/24"}, []string{"sg-task"}, sgs); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,145 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/kayac/ecspresso/registry"
+	"github.com/pkg/errors"
+)
+
+var (
+	pullThroughCacheWaitInterval = 5 * time.Second
+	pullThroughCacheWaitTries    = 6
+)
+
+// splitImageTag splits the image into the repository URL and the tag. tag is "latest" when not specified.
+// For images referred by the digest (image@sha256:...), the digest is returned as the tag.
+func splitImageTag(image string) (string, string) {
+	if i := strings.Index(image, "@"); i != -1 {
+		// a tag before the digest is ignored as same as docker pull
+		url, _ := splitImageTag(image[:i])
+		return url, image[i+1:]
+	}
+	// the last colon after the last slash separates the tag (a host may have a port)
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// joinImageTag joins the repository URL and the tag or the digest.
+func joinImageTag(url, tag string) string {
+	if registry.IsDigest(tag) {
+		return url + "@" + tag
+	}
+	return url + ":" + tag
+}
+
+// ecrRepositoryNameOf returns the repository name of the ECR image URL without the tag.
+func ecrRepositoryNameOf(image string) string {
+	image, _ = splitImageTag(image)
+	p := strings.SplitN(image, "/", 2)
+	if len(p) < 2 {
+		return ""
+	}
+	return p[1]
+}
+
+// matchPullThroughCacheRule returns the pull-through cache rule which has the longest prefix matching the repository name.
+func matchPullThroughCacheRule(rules []*ecr.PullThroughCacheRule, repo string) *ecr.PullThroughCacheRule {
+	var matched *ecr.PullThroughCacheRule
+	for _, r := range rules {
+		prefix := aws.StringValue(r.EcrRepositoryPrefix)
+		if prefix == "" || !strings.HasPrefix(repo, prefix+"/") {
+			continue
+		}
+		if matched == nil || len(prefix) > len(aws.StringValue(matched.EcrRepositoryPrefix)) {
+			matched = r
+		}
+	}
+	return matched
+}
+
+// upstreamImageOf returns the image URL in the upstream registry of the pull-through cache repository.
+func upstreamImageOf(rule *ecr.PullThroughCacheRule, repo string) string {
+	host := strings.TrimPrefix(aws.StringValue(rule.UpstreamRegistryUrl), "https://")
+	return strings.TrimSuffix(host, "/") + "/" + strings.TrimPrefix(repo, aws.StringValue(rule.EcrRepositoryPrefix)+"/")
+}
+
+func (v *verifier) describePullThroughCacheRules(ctx context.Context) ([]*ecr.PullThroughCacheRule, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.pullThroughCacheRules != nil {
+		return v.pullThroughCacheRules, nil
+	}
+	rules := []*ecr.PullThroughCacheRule{}
+	var nextToken *string
+	for {
+		out, err := v.ecr.DescribePullThroughCacheRulesWithContext(ctx, &ecr.DescribePullThroughCacheRulesInput{
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, out.PullThroughCacheRules...)
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+	v.pullThroughCacheRules = rules
+	return rules, nil
+}
+
+// verifyPullThroughCacheImage populates the pull-through cache repository by pulling the image, and waits for caching.
+// When the image is not cached, falls back to check the image in the upstream registry.
+// It returns false when the image is not in a pull-through cache repository.
+func (d *App) verifyPullThroughCacheImage(ctx context.Context, image, token string) (bool, error) {
+	repo := ecrRepositoryNameOf(image)
+	rules, err := d.verifier.describePullThroughCacheRules(ctx)
+	if err != nil {
+		d.DebugLog("unable to describe pull-through cache rules", err)
+		return false, nil
+	}
+	rule := matchPullThroughCacheRule(rules, repo)
+	if rule == nil {
+		return false, nil
+	}
+	url, tag := splitImageTag(image)
+	d.DebugLog(fmt.Sprintf("%s is a pull-through cache repository of %s", repo, aws.StringValue(rule.UpstreamRegistryUrl)))
+
+	cache := registry.New(url, "AWS", token)
+	if ok, err := cache.HasImage(ctx, tag); err == nil && ok {
+		return true, d.verifyRegistryImage(ctx, image, "AWS", token)
+	}
+
+	d.Log(fmt.Sprintf("%s is not cached yet. pulling to populate the pull-through cache", joinImageTag(url, tag)))
+	if err := cache.Pull(ctx, tag); err != nil {
+		d.DebugLog("failed to pull", err)
+	}
+	for i := 0; i < pullThroughCacheWaitTries; i++ {
+		if ok, err := cache.HasImage(ctx, tag); err == nil && ok {
+			return true, d.verifyRegistryImage(ctx, image, "AWS", token)
+		}
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-time.After(pullThroughCacheWaitInterval):
+		}
+	}
+
+	upstream := joinImageTag(upstreamImageOf(rule, repo), tag)
+	d.Log(fmt.Sprintf("%s is not cached. checking the upstream image %s", joinImageTag(url, tag), upstream))
+	if err := d.verifyRegistryImage(ctx, upstream, "", ""); err != nil {
+		if rule.CredentialArn != nil {
+			// the upstream registry requires credentials
+			return true, verifyWarnErr(fmt.Sprintf("%s is not cached and the upstream image %s could not be verified: %s", joinImageTag(url, tag), upstream, err))
+		}
+		return true, errors.Wrapf(err, "%s is not cached", joinImageTag(url, tag))
+	}
+	return true, verifyWarnErr(fmt.Sprintf("%s is not cached yet, but exists in the upstream registry", joinImageTag(url, tag)))
+}
@@ -0,0 +1,97 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/kayac/ecspresso"
+)
+
+var testPullThroughCacheRules = []*ecr.PullThroughCacheRule{
+	{EcrRepositoryPrefix: aws.String("ecr-public"), UpstreamRegistryUrl: aws.String("public.ecr.aws")},
+	{EcrRepositoryPrefix: aws.String("docker-hub"), UpstreamRegistryUrl: aws.String("registry-1.docker.io"), CredentialArn: aws.String("arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:ecr-pullthroughcache/docker-hub")},
+	{EcrRepositoryPrefix: aws.String("docker-hub/library"), UpstreamRegistryUrl: aws.String("registry-1.docker.io/library")},
+}
+
+func TestPullThroughCacheImage(t *testing.T) {
+	testCases := []struct {
+		image    string
+		repo     string
+		prefix   string
+		upstream string
+	}{
+		{
+			image:    "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/ecr-public/nginx/nginx:latest",
+			repo:     "ecr-public/nginx/nginx",
+			prefix:   "ecr-public",
+			upstream: "public.ecr.aws/nginx/nginx",
+		},
+		{
+			image:    "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/docker-hub/library/nginx:1.25",
+			repo:     "docker-hub/library/nginx",
+			prefix:   "docker-hub/library",
+			upstream: "registry-1.docker.io/library/nginx",
+		},
+		{
+			image:    "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/docker-hub/fujiwara/tracer",
+			repo:     "docker-hub/fujiwara/tracer",
+			prefix:   "docker-hub",
+			upstream: "registry-1.docker.io/fujiwara/tracer",
+		},
+		{
+			image: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/ecr-publicity/app:v1",
+			repo:  "ecr-publicity/app",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.image, func(t *testing.T) {
+			repo := ecspresso.ECRRepositoryNameOf(tc.image)
+			if repo != tc.repo {
+				t.Errorf("unexpected repository %s", repo)
+			}
+			rule := ecspresso.MatchPullThroughCacheRule(testPullThroughCacheRules, repo)
+			if tc.prefix == "" {
+				if rule != nil {
+					t.Errorf("unexpected rule %s", rule.String())
+				}
+				return
+			}
+			if rule == nil {
+				t.Fatal("rule is not matched")
+			}
+			if p := aws.StringValue(rule.EcrRepositoryPrefix); p != tc.prefix {
+				t.Errorf("unexpected prefix %s", p)
+			}
+			if u := ecspresso.UpstreamImageOf(rule, repo); u != tc.upstream {
+				t.Errorf("unexpected upstream %s", u)
+			}
+		})
+	}
+}
+
+func TestSplitImageTag(t *testing.T) {
+	digest := "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+	testCases := []struct {
+		image  string
+		url    string
+		tag    string
+		joined string
+	}{
+		{"nginx", "nginx", "latest", "nginx:latest"},
+		{"nginx:1.25", "nginx", "1.25", "nginx:1.25"},
+		{"nginx@" + digest, "nginx", digest, "nginx@" + digest},
+		{"nginx:1.25@" + digest, "nginx", digest, "nginx@" + digest},
+		{"registry.example.com:5000/app", "registry.example.com:5000/app", "latest", "registry.example.com:5000/app:latest"},
+		{"registry.example.com:5000/app:v1", "registry.example.com:5000/app", "v1", "registry.example.com:5000/app:v1"},
+	}
+	for _, tc := range testCases {
+		url, tag := ecspresso.SplitImageTag(tc.image)
+		if url != tc.url || tag != tc.tag {
+			t.Errorf("unexpected split of %s: %s %s", tc.image, url, tag)
+		}
+		if joined := ecspresso.JoinImageTag(url, tag); joined != tc.joined {
+			t.Errorf("unexpected join of %s: %s", tc.image, joined)
+		}
+	}
+}
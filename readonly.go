@@ -0,0 +1,55 @@
+package ecspresso
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// ErrCodeReadOnlyMode is the error code of API calls blocked by the read-only mode.
+const ErrCodeReadOnlyMode = "ReadOnlyMode"
+
+// readOnlyOperationPrefixes are prefixes of operations which never change resources.
+var readOnlyOperationPrefixes = []string{
+	"Describe",
+	"List",
+	"Get",
+	"BatchGet",
+	"BatchCheck",
+	"Head",
+	"Filter",
+	"Lookup",
+	"Search",
+	"Discover",
+	"Simulate",
+	// sts
+	"AssumeRole",
+}
+
+func isReadOnlyOperation(name string) bool {
+	for _, p := range readOnlyOperationPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupReadOnly adds the handler to block API calls which may change resources.
+func setupReadOnly(sess *session.Session) {
+	sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: "ecspresso.ReadOnly",
+		Fn: func(r *request.Request) {
+			if isReadOnlyOperation(r.Operation.Name) {
+				return
+			}
+			r.Error = awserr.New(
+				ErrCodeReadOnlyMode,
+				"read-only mode blocks "+r.ClientInfo.ServiceName+" "+r.Operation.Name,
+				nil,
+			)
+		},
+	})
+}
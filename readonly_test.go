@@ -0,0 +1,50 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestIsReadOnlyOperation(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"DescribeServices":       true,
+		"ListTasks":              true,
+		"GetAuthorizationToken":  true,
+		"BatchGetImage":          true,
+		"FilterLogEvents":        true,
+		"AssumeRole":             true,
+		"UpdateService":          false,
+		"RegisterTaskDefinition": false,
+		"PutLogEvents":           false,
+		"ExecuteCommand":         false,
+		"StartSession":           false,
+	} {
+		if ecspresso.IsReadOnlyOperation(name) != ok {
+			t.Errorf("%s must be %v", name, ok)
+		}
+	}
+}
+
+func TestReadOnlySession(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	conf.ReadOnly = true
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	svc := ecs.New(conf.Session())
+
+	_, err := svc.UpdateService(&ecs.UpdateServiceInput{Service: aws.String("test")})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ecspresso.ErrCodeReadOnlyMode {
+		t.Errorf("UpdateService must be blocked: %v", err)
+	}
+
+	// build the request without sending
+	req, _ := svc.DescribeServicesRequest(&ecs.DescribeServicesInput{Services: aws.StringSlice([]string{"test"})})
+	if err := req.Build(); err != nil {
+		t.Errorf("DescribeServices must not be blocked: %v", err)
+	}
+}
@@ -0,0 +1,442 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Songmu/prompter"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+type RecreateOption struct {
+	DryRun      *bool
+	FromService *string
+	Force       *bool
+}
+
+func (opt RecreateOption) DryRunString() string {
+	if aws.BoolValue(opt.DryRun) {
+		return dryRunStr
+	}
+	return ""
+}
+
+// immutableServiceChanges returns changes of fields which can not be updated by UpdateService.
+func immutableServiceChanges(current *ecs.Service, currentNetworkMode string, next *Service, name, nextNetworkMode string) []string {
+	var changes []string
+	if from := aws.StringValue(current.ServiceName); from != name {
+		changes = append(changes, fmt.Sprintf("serviceName: %s -> %s", from, name))
+	}
+	// UpdateService can not set the launch type. omitted launchType is left to the capacity provider strategy
+	if next.LaunchType != nil && aws.StringValue(next.LaunchType) != aws.StringValue(current.LaunchType) {
+		changes = append(changes, fmt.Sprintf("launchType: %s -> %s", valueOrNone(current.LaunchType), aws.StringValue(next.LaunchType)))
+	}
+	if from, to := schedulingStrategyOf(current.SchedulingStrategy), schedulingStrategyOf(next.SchedulingStrategy); from != to {
+		changes = append(changes, fmt.Sprintf("schedulingStrategy: %s -> %s", from, to))
+	}
+	if currentNetworkMode != nextNetworkMode {
+		changes = append(changes, fmt.Sprintf("networkMode of the task definition: %s -> %s", currentNetworkMode, nextNetworkMode))
+	}
+	if reason := incompatibleLoadBalancerChange(current, next); reason != "" {
+		changes = append(changes, reason)
+	}
+	return changes
+}
+
+func valueOrNone(s *string) string {
+	if s == nil {
+		return "(none)"
+	}
+	return *s
+}
+
+func schedulingStrategyOf(s *string) string {
+	if s == nil {
+		return ecs.SchedulingStrategyReplica
+	}
+	return *s
+}
+
+func networkModeOf(s *string) string {
+	if s == nil {
+		return ecs.NetworkModeBridge
+	}
+	return *s
+}
+
+// mergeServiceTags returns tags in the definition and tags of the current service which are not in the definition.
+func mergeServiceTags(defined, current []*ecs.Tag) []*ecs.Tag {
+	keys := make(map[string]bool, len(defined))
+	tags := make([]*ecs.Tag, 0, len(defined)+len(current))
+	for _, t := range defined {
+		keys[aws.StringValue(t.Key)] = true
+		tags = append(tags, t)
+	}
+	for _, t := range current {
+		if !keys[aws.StringValue(t.Key)] {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// Recreate deletes and recreates the service to apply changes of immutable fields with minimal downtime.
+// Tags, auto scaling and CloudWatch alarms of the service are carried over.
+func (d *App) Recreate(opt RecreateOption) (err error) {
+	ctx, cancel := d.Start()
+	defer cancel()
+	fillNilOptions(&opt)
+
+	dryRun := aws.BoolValue(opt.DryRun)
+	from := aws.StringValue(opt.FromService)
+	if from == "" {
+		from = d.Service
+	}
+	renamed := from != d.Service
+	d.Log("Starting recreate service", opt.DryRunString())
+
+	current, err := d.describeActiveService(ctx, from)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errors.Errorf("service %s is not found", from)
+	}
+	if renamed {
+		if sv, err := d.describeActiveService(ctx, d.Service); err != nil {
+			return err
+		} else if sv != nil {
+			return errors.Errorf("service %s already exists", d.Service)
+		}
+	}
+
+	svd, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to load service definition")
+	}
+	if err := d.resolveServiceRegistries(ctx, &svd.Service, dryRun); err != nil {
+		return errors.Wrap(err, "failed to resolve service registries")
+	}
+	if err := d.resolveServiceConnectNamespace(ctx, svd); err != nil {
+		return errors.Wrap(err, "failed to resolve service connect namespace")
+	}
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to load task definition")
+	}
+	currentTd, err := d.DescribeTaskDefinition(ctx, aws.StringValue(current.TaskDefinition))
+	if err != nil {
+		return errors.Wrap(err, "failed to describe the current task definition")
+	}
+
+	changes := immutableServiceChanges(current, networkModeOf(currentTd.NetworkMode), svd, d.Service, networkModeOf(td.NetworkMode))
+	if len(changes) == 0 {
+		if !aws.BoolValue(opt.Force) {
+			return errors.New("no changes of immutable fields. use deploy to update the service, or --force to recreate anyway")
+		}
+		d.Log("No changes of immutable fields. recreating by --force")
+	}
+	for _, c := range changes {
+		d.Log(spcIndent + c)
+	}
+
+	// resources carried over
+	tagsOut, err := d.ecs.ListTagsForResourceWithContext(ctx, &ecs.ListTagsForResourceInput{ResourceArn: current.ServiceArn})
+	if err != nil {
+		return errors.Wrap(err, "failed to list tags of the service")
+	}
+	svd.Tags = mergeServiceTags(svd.Tags, tagsOut.Tags)
+	fromResourceID := fmt.Sprintf("service/%s/%s", d.Cluster, from)
+	var asDef *AutoScalingDefinition
+	if d.config.AutoScalingDefinitionPath != "" {
+		if asDef, err = d.LoadAutoScalingDefinition(d.config.AutoScalingDefinitionPath); err != nil {
+			return errors.Wrap(err, "failed to load autoscaling definition")
+		}
+	} else if asDef, err = d.describeAutoScalingDefinition(ctx, fromResourceID); err != nil {
+		return err
+	}
+	if asDef.ScalableTarget == nil {
+		asDef = nil
+	}
+	var alarms []*cloudwatch.MetricAlarm
+	if renamed {
+		if alarms, err = d.serviceAlarms(ctx, from); err != nil {
+			return err
+		}
+	}
+	var count *int64
+	if schedulingStrategyOf(svd.SchedulingStrategy) != ecs.SchedulingStrategyDaemon {
+		count = current.DesiredCount // keep the current capacity
+	}
+
+	d.Log(fmt.Sprintf("service %s will be recreated as %s with desired count %d", from, d.Service, aws.Int64Value(count)))
+	d.Log(fmt.Sprintf("%d tags will be carried over", len(svd.Tags)))
+	if asDef != nil {
+		d.Log(fmt.Sprintf("auto scaling (%d scaling policies, %d scheduled actions) will be carried over", len(asDef.ScalingPolicies), len(asDef.ScheduledActions)))
+	}
+	for _, a := range alarms {
+		d.Log(fmt.Sprintf("alarm %s will be changed to watch %s", aws.StringValue(a.AlarmName), d.Service))
+	}
+	if dryRun {
+		d.Log("task definition:")
+		d.LogJSON(td)
+		d.Log("service definition:")
+		d.LogJSON(svd)
+		d.Log("DRY RUN OK")
+		return nil
+	}
+
+	if d.config.Interactive {
+		p := newChangePlan("recreate")
+		p.add("recreate the service %s as %s", from, d.Service)
+		for _, c := range changes {
+			p.add(c)
+		}
+		if err := d.confirmPlan(p); err != nil {
+			return err
+		}
+	} else if !aws.BoolValue(opt.Force) {
+		if service := prompter.Prompt(`Enter the service name to RECREATE`, ""); service != from {
+			d.Log("Aborted")
+			return errConfirmationFailed
+		}
+	}
+	unlock, err := d.acquireLock(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	audit := d.startAudit(ctx, "recreate", auditOption{
+		taskDefinitionPath:    d.config.TaskDefinitionPath,
+		serviceDefinitionPath: d.config.ServiceDefinitionPath,
+	})
+	defer func() { d.finishAudit(audit, err) }()
+
+	newTd, err := d.RegisterTaskDefinition(ctx, td)
+	if err != nil {
+		return errors.Wrap(err, "failed to register task definition")
+	}
+	tdArn := aws.StringValue(newTd.TaskDefinitionArn)
+
+	if !renamed {
+		if err := d.recreateService(ctx, svd, tdArn, count); err != nil {
+			return err
+		}
+		if asDef != nil {
+			if err := d.ApplyAutoScalingDefinition(ctx, asDef, false); err != nil {
+				return errors.Wrap(err, "failed to apply autoscaling definition")
+			}
+		}
+		return nil
+	}
+
+	in := newCreateServiceInput(d.Cluster, svd, tdArn, count)
+	in.ServiceName = aws.String(d.Service)
+	if err := d.createServiceAndWait(ctx, in); err != nil {
+		return errors.Wrapf(err, "failed to create the service %s", d.Service)
+	}
+	if asDef != nil {
+		if err := d.ApplyAutoScalingDefinition(ctx, asDef, false); err != nil {
+			return errors.Wrap(err, "failed to apply autoscaling definition")
+		}
+	}
+	if err := d.moveServiceAlarms(ctx, alarms, from, fromResourceID); err != nil {
+		return err
+	}
+	if err := d.deleteServiceAndWait(ctx, from); err != nil {
+		return errors.Wrapf(err, "failed to delete the service %s. the service %s is serving", from, d.Service)
+	}
+	if asDef != nil {
+		d.Log("Deregistering the scalable target", fromResourceID)
+		if _, err := d.autoScaling.DeregisterScalableTargetWithContext(ctx, &applicationautoscaling.DeregisterScalableTargetInput{
+			ResourceId:        aws.String(fromResourceID),
+			ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+			ScalableDimension: aws.String(autoScalingScalableDimension),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to deregister the scalable target %s", fromResourceID)
+		}
+	}
+	d.Log("Service is recreated. Completed!")
+	return nil
+}
+
+// describeActiveService returns the service which is not INACTIVE. It returns nil when the service does not exist.
+func (d *App) describeActiveService(ctx context.Context, name string) (*ecs.Service, error) {
+	out, err := d.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(d.Cluster),
+		Services: []*string{aws.String(name)},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe service %s", name)
+	}
+	for _, sv := range out.Services {
+		if aws.StringValue(sv.Status) != "INACTIVE" {
+			return sv, nil
+		}
+	}
+	return nil, nil
+}
+
+// isServiceAlarm reports whether the metric alarm watches the service.
+// Alarms of target tracking scaling policies are managed by Application Auto Scaling, so they are excluded.
+func isServiceAlarm(a *cloudwatch.MetricAlarm, cluster, service string) bool {
+	if strings.HasPrefix(aws.StringValue(a.AlarmName), "TargetTracking-") {
+		return false
+	}
+	dims := [][]*cloudwatch.Dimension{a.Dimensions}
+	for _, m := range a.Metrics {
+		if m.MetricStat != nil && m.MetricStat.Metric != nil {
+			dims = append(dims, m.MetricStat.Metric.Dimensions)
+		}
+	}
+	for _, ds := range dims {
+		var c, s bool
+		for _, dim := range ds {
+			switch aws.StringValue(dim.Name) {
+			case "ClusterName":
+				c = aws.StringValue(dim.Value) == cluster
+			case "ServiceName":
+				s = aws.StringValue(dim.Value) == service
+			}
+		}
+		if c && s {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *App) serviceAlarms(ctx context.Context, service string) ([]*cloudwatch.MetricAlarm, error) {
+	var alarms []*cloudwatch.MetricAlarm
+	err := d.cloudwatch.DescribeAlarmsPagesWithContext(ctx, &cloudwatch.DescribeAlarmsInput{},
+		func(out *cloudwatch.DescribeAlarmsOutput, _ bool) bool {
+			for _, a := range out.MetricAlarms {
+				if isServiceAlarm(a, d.Cluster, service) {
+					alarms = append(alarms, a)
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe alarms")
+	}
+	return alarms, nil
+}
+
+// alarmForService returns the input to update the alarm to watch the service instead.
+// Actions of scaling policies are replaced by policyARNs which maps old ARNs to new ones.
+func alarmForService(a *cloudwatch.MetricAlarm, service string, policyARNs map[string]string) *cloudwatch.PutMetricAlarmInput {
+	replaceDims := func(ds []*cloudwatch.Dimension) []*cloudwatch.Dimension {
+		replaced := make([]*cloudwatch.Dimension, 0, len(ds))
+		for _, dim := range ds {
+			if aws.StringValue(dim.Name) == "ServiceName" {
+				dim = &cloudwatch.Dimension{Name: dim.Name, Value: aws.String(service)}
+			}
+			replaced = append(replaced, dim)
+		}
+		return replaced
+	}
+	replaceActions := func(actions []*string) []*string {
+		replaced := make([]*string, 0, len(actions))
+		for _, action := range actions {
+			if arn, ok := policyARNs[aws.StringValue(action)]; ok {
+				action = aws.String(arn)
+			}
+			replaced = append(replaced, action)
+		}
+		return replaced
+	}
+	in := &cloudwatch.PutMetricAlarmInput{
+		AlarmName:                        a.AlarmName,
+		AlarmDescription:                 a.AlarmDescription,
+		ActionsEnabled:                   a.ActionsEnabled,
+		AlarmActions:                     replaceActions(a.AlarmActions),
+		OKActions:                        replaceActions(a.OKActions),
+		InsufficientDataActions:          replaceActions(a.InsufficientDataActions),
+		MetricName:                       a.MetricName,
+		Namespace:                        a.Namespace,
+		Statistic:                        a.Statistic,
+		ExtendedStatistic:                a.ExtendedStatistic,
+		Period:                           a.Period,
+		Unit:                             a.Unit,
+		EvaluationPeriods:                a.EvaluationPeriods,
+		DatapointsToAlarm:                a.DatapointsToAlarm,
+		Threshold:                        a.Threshold,
+		ThresholdMetricId:                a.ThresholdMetricId,
+		ComparisonOperator:               a.ComparisonOperator,
+		TreatMissingData:                 a.TreatMissingData,
+		EvaluateLowSampleCountPercentile: a.EvaluateLowSampleCountPercentile,
+	}
+	if len(a.Dimensions) > 0 {
+		in.Dimensions = replaceDims(a.Dimensions)
+	}
+	for _, m := range a.Metrics {
+		if m.MetricStat != nil && m.MetricStat.Metric != nil {
+			metric := *m.MetricStat.Metric
+			metric.Dimensions = replaceDims(metric.Dimensions)
+			stat := *m.MetricStat
+			stat.Metric = &metric
+			q := *m
+			q.MetricStat = &stat
+			m = &q
+		}
+		in.Metrics = append(in.Metrics, m)
+	}
+	return in
+}
+
+// moveServiceAlarms updates alarms of the service from to watch the service in the configuration.
+func (d *App) moveServiceAlarms(ctx context.Context, alarms []*cloudwatch.MetricAlarm, from, fromResourceID string) error {
+	if len(alarms) == 0 {
+		return nil
+	}
+	oldARNs, err := d.scalingPolicyARNs(ctx, fromResourceID)
+	if err != nil {
+		return err
+	}
+	newARNs, err := d.scalingPolicyARNs(ctx, d.autoScalingResourceID())
+	if err != nil {
+		return err
+	}
+	policyARNs := make(map[string]string, len(oldARNs))
+	for name, arn := range oldARNs {
+		if newARN, ok := newARNs[name]; ok {
+			policyARNs[arn] = newARN
+		}
+	}
+	for _, a := range alarms {
+		d.Log(fmt.Sprintf("Updating alarm %s to watch %s instead of %s", aws.StringValue(a.AlarmName), d.Service, from))
+		if _, err := d.cloudwatch.PutMetricAlarmWithContext(ctx, alarmForService(a, d.Service, policyARNs)); err != nil {
+			return errors.Wrapf(err, "failed to update alarm %s", aws.StringValue(a.AlarmName))
+		}
+	}
+	return nil
+}
+
+// scalingPolicyARNs returns ARNs of scaling policies of the resource by names.
+func (d *App) scalingPolicyARNs(ctx context.Context, resourceID string) (map[string]string, error) {
+	arns := map[string]string{}
+	err := d.autoScaling.DescribeScalingPoliciesPagesWithContext(ctx, &applicationautoscaling.DescribeScalingPoliciesInput{
+		ResourceId:        aws.String(resourceID),
+		ServiceNamespace:  aws.String(autoScalingServiceNamespace),
+		ScalableDimension: aws.String(autoScalingScalableDimension),
+	}, func(out *applicationautoscaling.DescribeScalingPoliciesOutput, _ bool) bool {
+		for _, p := range out.ScalingPolicies {
+			arns[aws.StringValue(p.PolicyName)] = aws.StringValue(p.PolicyARN)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe scaling policies of %s", resourceID)
+	}
+	return arns, nil
+}
@@ -0,0 +1,198 @@
+package ecspresso_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestImmutableServiceChanges(t *testing.T) {
+	current := &ecs.Service{
+		ServiceName: aws.String("app"),
+		LaunchType:  aws.String(ecs.LaunchTypeEc2),
+	}
+	next := &ecspresso.Service{}
+	if changes := ecspresso.ImmutableServiceChanges(current, "bridge", next, "app", "bridge"); len(changes) != 0 {
+		t.Errorf("unexpected changes %v", changes)
+	}
+
+	next.LaunchType = aws.String(ecs.LaunchTypeFargate)
+	next.SchedulingStrategy = aws.String(ecs.SchedulingStrategyDaemon)
+	changes := ecspresso.ImmutableServiceChanges(current, "bridge", next, "app-v2", "awsvpc")
+	expected := []string{
+		"serviceName: app -> app-v2",
+		"launchType: EC2 -> FARGATE",
+		"schedulingStrategy: REPLICA -> DAEMON",
+		"networkMode of the task definition: bridge -> awsvpc",
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes %#v", changes)
+	}
+}
+
+func TestMergeServiceTags(t *testing.T) {
+	tags := ecspresso.MergeServiceTags(
+		[]*ecs.Tag{{Key: aws.String("env"), Value: aws.String("prod")}},
+		[]*ecs.Tag{{Key: aws.String("env"), Value: aws.String("stg")}, {Key: aws.String("owner"), Value: aws.String("team-a")}},
+	)
+	var ss []string
+	for _, t := range tags {
+		ss = append(ss, aws.StringValue(t.Key)+"="+aws.StringValue(t.Value))
+	}
+	if s := strings.Join(ss, ","); s != "env=prod,owner=team-a" {
+		t.Errorf("unexpected tags %s", s)
+	}
+	if tags := ecspresso.MergeServiceTags(nil, nil); tags != nil {
+		t.Errorf("tags must be nil %v", tags)
+	}
+}
+
+func TestAlarmForService(t *testing.T) {
+	dims := func(service string) []*cloudwatch.Dimension {
+		return []*cloudwatch.Dimension{
+			{Name: aws.String("ClusterName"), Value: aws.String("default")},
+			{Name: aws.String("ServiceName"), Value: aws.String(service)},
+		}
+	}
+	a := &cloudwatch.MetricAlarm{
+		AlarmName:    aws.String("app-cpu-high"),
+		MetricName:   aws.String("CPUUtilization"),
+		Namespace:    aws.String("AWS/ECS"),
+		Dimensions:   dims("app"),
+		AlarmActions: aws.StringSlice([]string{"arn:old-policy", "arn:aws:sns:ap-northeast-1:123456789012:ops"}),
+	}
+	in := ecspresso.AlarmForService(a, "app-v2", map[string]string{"arn:old-policy": "arn:new-policy"})
+	if !reflect.DeepEqual(in.Dimensions, dims("app-v2")) {
+		t.Errorf("unexpected dimensions %v", in.Dimensions)
+	}
+	if actions := aws.StringValueSlice(in.AlarmActions); !reflect.DeepEqual(actions, []string{"arn:new-policy", "arn:aws:sns:ap-northeast-1:123456789012:ops"}) {
+		t.Errorf("unexpected actions %v", actions)
+	}
+	if aws.StringValue(a.Dimensions[1].Value) != "app" {
+		t.Error("the original alarm must not be modified")
+	}
+}
+
+// fakeRenameECS has the service "old" only.
+type fakeRenameECS struct {
+	fakeRecreateECS
+}
+
+func (f *fakeRenameECS) DescribeServicesWithContext(_ aws.Context, in *ecs.DescribeServicesInput, _ ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	if aws.StringValue(in.Services[0]) == aws.StringValue(f.service.ServiceName) {
+		return &ecs.DescribeServicesOutput{Services: []*ecs.Service{f.service}}, nil
+	}
+	return &ecs.DescribeServicesOutput{}, nil
+}
+
+func (f *fakeRenameECS) ListTagsForResourceWithContext(_ aws.Context, _ *ecs.ListTagsForResourceInput, _ ...request.Option) (*ecs.ListTagsForResourceOutput, error) {
+	return &ecs.ListTagsForResourceOutput{Tags: []*ecs.Tag{{Key: aws.String("owner"), Value: aws.String("team-a")}}}, nil
+}
+
+func (f *fakeRenameECS) DescribeTaskDefinitionWithContext(_ aws.Context, in *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{
+		TaskDefinitionArn: in.TaskDefinition,
+		Family:            aws.String("test"),
+		NetworkMode:       aws.String(ecs.NetworkModeBridge),
+	}}, nil
+}
+
+type fakeAlarmsCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+	alarms []*cloudwatch.MetricAlarm
+	put    []*cloudwatch.PutMetricAlarmInput
+}
+
+func (f *fakeAlarmsCloudWatch) DescribeAlarmsPagesWithContext(_ aws.Context, _ *cloudwatch.DescribeAlarmsInput, fn func(*cloudwatch.DescribeAlarmsOutput, bool) bool, _ ...request.Option) error {
+	fn(&cloudwatch.DescribeAlarmsOutput{MetricAlarms: f.alarms}, true)
+	return nil
+}
+
+func (f *fakeAlarmsCloudWatch) PutMetricAlarmWithContext(_ aws.Context, in *cloudwatch.PutMetricAlarmInput, _ ...request.Option) (*cloudwatch.PutMetricAlarmOutput, error) {
+	f.put = append(f.put, in)
+	return &cloudwatch.PutMetricAlarmOutput{}, nil
+}
+
+type fakeNoPoliciesAutoScaling struct {
+	fakeAutoScaling
+}
+
+func (f *fakeNoPoliciesAutoScaling) DescribeScalingPoliciesPagesWithContext(_ aws.Context, _ *applicationautoscaling.DescribeScalingPoliciesInput, _ func(*applicationautoscaling.DescribeScalingPoliciesOutput, bool) bool, _ ...request.Option) error {
+	return nil
+}
+
+func TestRecreateRenamedService(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	fake := &fakeRenameECS{fakeRecreateECS{fakeECS: fakeECS{
+		service: &ecs.Service{
+			ServiceName:    aws.String("old"),
+			ServiceArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:service/default2/old"),
+			ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+			DesiredCount:   aws.Int64(3),
+			Status:         aws.String("ACTIVE"),
+			LoadBalancers: []*ecs.LoadBalancer{{
+				ContainerName:  aws.String("test"),
+				ContainerPort:  aws.Int64(9999),
+				TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:us-east-1:1111111111:targetgroup/test/12345678"),
+			}},
+		},
+	}}}
+	cw := &fakeAlarmsCloudWatch{alarms: []*cloudwatch.MetricAlarm{
+		{
+			AlarmName: aws.String("old-cpu-high"),
+			Dimensions: []*cloudwatch.Dimension{
+				{Name: aws.String("ClusterName"), Value: aws.String("default2")},
+				{Name: aws.String("ServiceName"), Value: aws.String("old")},
+			},
+		},
+		{
+			AlarmName: aws.String("TargetTracking-service/default2/old-AlarmHigh"),
+			Dimensions: []*cloudwatch.Dimension{
+				{Name: aws.String("ClusterName"), Value: aws.String("default2")},
+				{Name: aws.String("ServiceName"), Value: aws.String("old")},
+			},
+		},
+	}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:                    fake,
+		ApplicationAutoScaling: &fakeNoPoliciesAutoScaling{},
+		CloudWatch:             cw,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Recreate(ecspresso.RecreateOption{
+		FromService: aws.String("old"),
+		Force:       aws.Bool(true),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"create test", "delete old"}; !reflect.DeepEqual(fake.calls, expected) {
+		t.Errorf("unexpected calls %v", fake.calls)
+	}
+	if tags := fake.created.Tags; len(tags) != 2 || aws.StringValue(tags[1].Key) != "owner" {
+		t.Errorf("tags must be carried over %v", tags)
+	}
+	if aws.Int64Value(fake.created.DesiredCount) != 3 {
+		t.Errorf("the desired count must be carried over %d", aws.Int64Value(fake.created.DesiredCount))
+	}
+	if len(cw.put) != 1 || aws.StringValue(cw.put[0].AlarmName) != "old-cpu-high" || aws.StringValue(cw.put[0].Dimensions[1].Value) != "test" {
+		t.Errorf("unexpected alarms updated %v", cw.put)
+	}
+}
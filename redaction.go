@@ -0,0 +1,151 @@
+package ecspresso
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+var defaultRedactionPatterns = []string{"PASSWORD", "PASSWD", "TOKEN", "KEY", "SECRET", "CREDENTIAL"}
+
+// redactedValue replaces secrets found in strings of outputs.
+const redactedValue = "<redacted>"
+
+// RedactionConfig represents a configuration to mask values of environment variables in outputs.
+// The redaction is enabled by default.
+type RedactionConfig struct {
+	// Patterns are regular expressions matched against names of environment variables case-insensitively.
+	// default: PASSWORD, PASSWD, TOKEN, KEY, SECRET, CREDENTIAL
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Disabled disables the redaction.
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+func (c *RedactionConfig) validate() error {
+	for _, p := range c.patterns() {
+		if _, err := regexp.Compile("(?i)" + p); err != nil {
+			return errors.Wrapf(err, "invalid pattern in redaction.patterns: %s", p)
+		}
+	}
+	return nil
+}
+
+func (c *RedactionConfig) patterns() []string {
+	if len(c.Patterns) == 0 {
+		return defaultRedactionPatterns
+	}
+	return c.Patterns
+}
+
+// redactor masks values of environment variables whose names match patterns, or values which look like secrets.
+// Masked values have a fingerprint by HMAC with a random key of the process,
+// so that diffs show changes of values without exposing them.
+type redactor struct {
+	names []*regexp.Regexp
+	key   []byte
+}
+
+// newRedactor returns nil when the redaction is disabled.
+func newRedactor(c *RedactionConfig) *redactor {
+	if c == nil {
+		c = &RedactionConfig{}
+	}
+	if c.Disabled {
+		return nil
+	}
+	r := &redactor{key: make([]byte, 32)}
+	rand.Read(r.key)
+	for _, p := range c.patterns() {
+		r.names = append(r.names, regexp.MustCompile("(?i)"+p))
+	}
+	return r
+}
+
+func (r *redactor) match(name, value string) bool {
+	for _, re := range r.names {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return detectPlaintextSecret(name, value) != ""
+}
+
+func (r *redactor) mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	h := hmac.New(sha256.New, r.key)
+	h.Write([]byte(value))
+	return fmt.Sprintf("<redacted:%x>", h.Sum(nil)[:4])
+}
+
+// redact returns a copy of v with values of matched environment variables masked.
+// v is returned as is when r is nil.
+func (r *redactor) redact(v interface{}) interface{} {
+	if r == nil || v == nil {
+		return v
+	}
+	c := awsutil.CopyOf(v)
+	eachKeyValuePair(reflect.ValueOf(c), func(kv *ecs.KeyValuePair) {
+		if r.match(aws.StringValue(kv.Name), aws.StringValue(kv.Value)) {
+			kv.Value = aws.String(r.mask(aws.StringValue(kv.Value)))
+		}
+	})
+	return c
+}
+
+// prettify returns the string representation of v (e.g. parameters of AWS APIs) for logs.
+// In addition to environment variables, values matching patterns of secrets are masked.
+// Fields marked as sensitive by the SDK are always masked.
+func (r *redactor) prettify(v interface{}) string {
+	if r == nil {
+		return awsutil.Prettify(v)
+	}
+	s := awsutil.Prettify(r.redact(v))
+	for _, p := range plaintextSecretPatterns {
+		s = p.re.ReplaceAllString(s, redactedValue)
+	}
+	return s
+}
+
+// eachKeyValuePair calls fn for each ecs.KeyValuePair (e.g. environment variables) in v.
+func eachKeyValuePair(v reflect.Value, fn func(*ecs.KeyValuePair)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if kv, ok := v.Interface().(*ecs.KeyValuePair); ok {
+			fn(kv)
+			return
+		}
+		eachKeyValuePair(v.Elem(), fn)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				eachKeyValuePair(v.Field(i), fn)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			eachKeyValuePair(v.Index(i), fn)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			eachKeyValuePair(v.MapIndex(k), fn)
+		}
+	}
+}
+
+// redactTaskDefinition returns a copy of the task definition for outputs.
+func (d *App) redactTaskDefinition(td *TaskDefinitionInput) *TaskDefinitionInput {
+	return d.redactor.redact(td).(*TaskDefinitionInput)
+}
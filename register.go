@@ -1,10 +1,23 @@
 package ecspresso
 
-import "github.com/pkg/errors"
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
 
 type RegisterOption struct {
-	DryRun *bool
-	Output *bool
+	DryRun       *bool
+	Output       *bool
+	Tags         *string
+	ArnFile      *string
+	GitHubOutput *bool
 }
 
 func (opt RegisterOption) DryRunString() string {
@@ -14,6 +27,11 @@ func (opt RegisterOption) DryRunString() string {
 	return ""
 }
 
+// maxTaskDefinitionTags is the maximum number of tags of a task definition.
+const maxTaskDefinitionTags = 50
+
+var taskDefinitionFamilyRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,255}$`)
+
 func (d *App) Register(opt RegisterOption) error {
 	ctx, cancel := d.Start()
 	defer cancel()
@@ -23,7 +41,23 @@ func (d *App) Register(opt RegisterOption) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to load task definition")
 	}
+	tags, err := parseTags(aws.StringValue(opt.Tags))
+	if err != nil {
+		return errors.Wrap(err, "invalid tags")
+	}
+	td.Tags = mergeTags(td.Tags, tags)
+
 	if *opt.DryRun {
+		if problems := d.checkTaskDefinitionForRegister(td); len(problems) > 0 {
+			for _, p := range problems {
+				d.Log(spcIndent + p)
+			}
+			return errors.Errorf("%d problems found in the task definition", len(problems))
+		}
+		d.warnPlaintextSecrets(td)
+		if err := d.checkImageTagPolicy(td); err != nil {
+			return err
+		}
 		d.Log("task definition:")
 		d.LogJSON(td)
 		d.Log("DRY RUN OK")
@@ -38,5 +72,83 @@ func (d *App) Register(opt RegisterOption) error {
 	if *opt.Output {
 		d.LogJSON(newTd)
 	}
+	arn := aws.StringValue(newTd.TaskDefinitionArn)
+	if path := aws.StringValue(opt.ArnFile); path != "" {
+		if err := ioutil.WriteFile(path, []byte(arn+"\n"), 0644); err != nil {
+			return errors.Wrapf(err, "failed to write the task definition ARN to %s", path)
+		}
+		d.Log("The task definition ARN is written to", path)
+	}
+	if aws.BoolValue(opt.GitHubOutput) {
+		if err := writeGitHubOutput("task_definition_arn", arn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTaskDefinitionForRegister checks the task definition locally as RegisterTaskDefinition validates.
+func (d *App) checkTaskDefinitionForRegister(td *TaskDefinitionInput) []string {
+	var problems []string
+	for _, p := range missingRequiredFields(reflect.ValueOf(td), "") {
+		problems = append(problems, p+" is required")
+	}
+	if f := aws.StringValue(td.Family); f != "" && !taskDefinitionFamilyRegex.MatchString(f) {
+		problems = append(problems, fmt.Sprintf("family %q must be up to 255 letters, numbers, hyphens and underscores", f))
+	}
+	names := map[string]bool{}
+	var essential bool
+	for _, c := range td.ContainerDefinitions {
+		name := aws.StringValue(c.Name)
+		if names[name] {
+			problems = append(problems, fmt.Sprintf("container name %s is duplicated", name))
+		}
+		names[name] = true
+		// essential is true by default
+		if c.Essential == nil || *c.Essential {
+			essential = true
+		}
+	}
+	if len(td.ContainerDefinitions) > 0 && !essential {
+		problems = append(problems, "at least one container must be essential")
+	}
+	if len(td.Tags) > maxTaskDefinitionTags {
+		problems = append(problems, fmt.Sprintf("too many tags: %d (max %d)", len(td.Tags), maxTaskDefinitionTags))
+	}
+	return problems
+}
+
+// mergeTags returns tags merged by the key. Values in override take precedence.
+func mergeTags(base, override []*ecs.Tag) []*ecs.Tag {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make([]*ecs.Tag, 0, len(base)+len(override))
+	index := map[string]int{}
+	for _, t := range append(append([]*ecs.Tag{}, base...), override...) {
+		if i, ok := index[aws.StringValue(t.Key)]; ok {
+			merged[i] = t
+			continue
+		}
+		index[aws.StringValue(t.Key)] = len(merged)
+		merged = append(merged, t)
+	}
+	return merged
+}
+
+// writeGitHubOutput appends the output to the file of GITHUB_OUTPUT in GitHub Actions.
+func writeGitHubOutput(name, value string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return errors.New("GITHUB_OUTPUT is not set. --github-output works only in GitHub Actions")
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open GITHUB_OUTPUT")
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s=%s\n", name, value); err != nil {
+		return errors.Wrap(err, "failed to write GITHUB_OUTPUT")
+	}
 	return nil
 }
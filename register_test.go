@@ -0,0 +1,87 @@
+package ecspresso_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestRegisterWithTagsAndOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecspresso-register")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ghOutput := filepath.Join(dir, "github_output")
+	os.Setenv("GITHUB_OUTPUT", ghOutput)
+	defer os.Unsetenv("GITHUB_OUTPUT")
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	fake := &fakeECS{}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arnFile := filepath.Join(dir, "arn")
+	err = app.Register(ecspresso.RegisterOption{
+		DryRun:       aws.Bool(false),
+		Output:       aws.Bool(false),
+		Tags:         aws.String("GitSHA=abcdef,Build=12"),
+		ArnFile:      aws.String(arnFile),
+		GitHubOutput: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := map[string]string{}
+	for _, tag := range fake.registered.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	if tags["GitSHA"] != "abcdef" || tags["Build"] != "12" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	arn := "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/" + aws.StringValue(fake.registered.Family) + ":2"
+	if b, _ := ioutil.ReadFile(arnFile); string(b) != arn+"\n" {
+		t.Errorf("unexpected ARN file: %s", string(b))
+	}
+	if b, _ := ioutil.ReadFile(ghOutput); string(b) != "task_definition_arn="+arn+"\n" {
+		t.Errorf("unexpected GITHUB_OUTPUT: %s", string(b))
+	}
+}
+
+func TestCheckTaskDefinitionForRegister(t *testing.T) {
+	c := &ecspresso.Config{Region: "ap-northeast-1"}
+	if err := c.Restrict(); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := &ecspresso.TaskDefinitionInput{
+		Family: aws.String("my app"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("app"), Image: aws.String("app:v1"), Essential: aws.Bool(false)},
+			{Name: aws.String("app"), Image: aws.String("app:v1"), Essential: aws.Bool(false)},
+		},
+	}
+	if ps := app.CheckTaskDefinitionForRegister(td); len(ps) != 3 {
+		t.Errorf("unexpected problems: %v", ps)
+	}
+	td.Family = aws.String("my-app")
+	td.ContainerDefinitions = td.ContainerDefinitions[:1]
+	td.ContainerDefinitions[0].Essential = nil
+	if ps := app.CheckTaskDefinitionForRegister(td); len(ps) != 0 {
+		t.Errorf("unexpected problems: %v", ps)
+	}
+}
@@ -0,0 +1,168 @@
+package registry_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kayac/ecspresso/registry"
+	"github.com/pkg/errors"
+)
+
+type tokenServer struct {
+	service   string
+	scope     string // scope in the challenge
+	user      string
+	password  string
+	tokenJSON string
+	// requested scope to the token endpoint
+	requestedScope string
+}
+
+func (s *tokenServer) handler(srv **httptest.Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		s.requestedScope = r.URL.Query().Get("scope")
+		if s.password != "" {
+			user, password, ok := r.BasicAuth()
+			if !ok || user != s.user || password != s.password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		fmt.Fprint(w, s.tokenJSON)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer testtoken" {
+			challenge := fmt.Sprintf(`Bearer realm="%s/token",service="%s"`, (*srv).URL, s.service)
+			if s.scope != "" {
+				challenge += fmt.Sprintf(`,scope="%s"`, s.scope)
+			}
+			w.Header().Set("Www-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/manifests/v1") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	return mux
+}
+
+func testRegistryImage(t *testing.T, s *tokenServer, user, password string) (bool, error) {
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(s.handler(&srv))
+	defer srv.Close()
+	image := strings.TrimPrefix(srv.URL, "https://") + "/owner/app"
+	repo := registry.NewWithClient(image, user, password, srv.Client())
+	return repo.HasImage(context.Background(), "v1")
+}
+
+func TestGHCRTokenFlow(t *testing.T) {
+	s := &tokenServer{
+		service:   "ghcr.io",
+		scope:     "repository:owner/app:pull",
+		user:      "token",
+		password:  "ghp_xxx",
+		tokenJSON: `{"token":"testtoken"}`,
+	}
+	// a PAT without the user name
+	ok, err := testRegistryImage(t, s, "", "ghp_xxx")
+	if err != nil || !ok {
+		t.Errorf("image must be found with the PAT: %v %s", ok, err)
+	}
+	if s.requestedScope != "repository:owner/app:pull" {
+		t.Errorf("unexpected scope %s", s.requestedScope)
+	}
+
+	ok, err = testRegistryImage(t, s, "", "invalid")
+	if ok || !errors.Is(err, registry.ErrUnauthorized) {
+		t.Errorf("invalid PAT must be unauthorized: %v %s", ok, err)
+	}
+}
+
+func TestGitLabTokenFlow(t *testing.T) {
+	s := &tokenServer{
+		service:   "container_registry",
+		user:      "gitlab-ci-token",
+		password:  "glpat-xxx",
+		tokenJSON: `{"access_token":"testtoken"}`,
+	}
+	// the challenge has no scope
+	ok, err := testRegistryImage(t, s, "gitlab-ci-token", "glpat-xxx")
+	if err != nil || !ok {
+		t.Errorf("image must be found with the token: %v %s", ok, err)
+	}
+	if s.requestedScope != "repository:owner/app:pull" {
+		t.Errorf("unexpected scope %s", s.requestedScope)
+	}
+}
+
+func TestTokenNotPermitted(t *testing.T) {
+	s := &tokenServer{
+		service:   "container_registry",
+		scope:     "repository:owner/app:pull",
+		tokenJSON: `{"token":"anonymous"}`,
+	}
+	ok, err := testRegistryImage(t, s, "", "")
+	if ok || !errors.Is(err, registry.ErrUnauthorized) {
+		t.Errorf("anonymous token must be unauthorized: %v %s", ok, err)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/library/nginx/manifests/latest" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mirror.Close()
+
+	upstream := registry.NewWithClient("nginx", "user", "password", mirror.Client())
+	if h := upstream.Host(); h != "registry-1.docker.io" {
+		t.Errorf("unexpected host %s", h)
+	}
+	repo := upstream.Mirror(mirror.URL + "/")
+	if h := repo.Host(); h != strings.TrimPrefix(mirror.URL, "https://") {
+		t.Errorf("unexpected host of the mirror %s", h)
+	}
+	if ok, err := repo.HasImage(context.Background(), "latest"); err != nil || !ok {
+		t.Errorf("image must be found in the mirror: %v %s", ok, err)
+	}
+	if ok, err := repo.HasImage(context.Background(), "missing"); err != nil || ok {
+		t.Errorf("image must not be found in the mirror: %v %s", ok, err)
+	}
+	if r := upstream.Mirror(mirror.URL + "/dockerhub/library/nginx").Repo(); r != "dockerhub/library/nginx" {
+		t.Errorf("unexpected repository of the mirror %s", r)
+	}
+}
+
+func TestHasImageDigest(t *testing.T) {
+	digest := "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/owner/app/manifests/"+digest {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	repo := registry.NewWithClient(strings.TrimPrefix(srv.URL, "https://")+"/owner/app", "", "", srv.Client())
+	ctx := context.Background()
+	if ok, err := repo.HasImageDigest(ctx, digest); err != nil || !ok {
+		t.Errorf("image of the digest must be found: %v %s", ok, err)
+	}
+	if ok, err := repo.HasImageDigest(ctx, "sha256:ffff"); err != nil || ok {
+		t.Errorf("image of the other digest must not be found: %v %s", ok, err)
+	}
+	if _, err := repo.HasImageDigest(ctx, "latest"); err == nil {
+		t.Error("tag must not be a digest")
+	}
+}
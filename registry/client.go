@@ -18,11 +18,19 @@ const (
 	dockerHubHost                      = "registry-1.docker.io"
 	mediaTypeDockerSchema2ManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
 	mediaTypeDockerSchema2Manifest     = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// services in token endpoints of registries which have quirks
+	ghcrService   = "ghcr.io"
+	gitlabService = "container_registry"
+
+	// ghcrUser is used for PATs of GitHub without the user name. ghcr.io accepts any user name with a PAT.
+	ghcrUser = "token"
 )
 
 var (
 	ErrDeprecatedManifest    = errors.New("deprecated image manifest")
 	ErrPullRateLimitExceeded = errors.New("image pull rate limit exceeded")
+	ErrUnauthorized          = errors.New("unauthorized")
 )
 
 // Repository represents a repository using Docker Registry API v2.
@@ -58,6 +66,50 @@ func New(image, user, password string) *Repository {
 	return c
 }
 
+// loginUser returns the user name for the basic authentication to the token endpoint of the service.
+func (c *Repository) loginUser(service string) string {
+	if c.user == "" && c.password != "" && service == ghcrService {
+		return ghcrUser
+	}
+	return c.user
+}
+
+// loginScope returns the scope to request to the token endpoint.
+// GitLab omits the scope in the challenge for some requests, so the pull scope of the repository is requested.
+func (c *Repository) loginScope(scope string) string {
+	if scope == "" {
+		return "repository:" + c.repo + ":pull"
+	}
+	return scope
+}
+
+// Host returns the host of the registry.
+func (c *Repository) Host() string {
+	return c.host
+}
+
+// Repo returns the name of the repository in the registry.
+func (c *Repository) Repo() string {
+	return c.repo
+}
+
+// Mirror returns a client for the repository in the mirror registry.
+// The mirror is a host of the registry, or a host with the name of the repository (e.g. mirror.example.com/library/nginx).
+// Credentials of the repository are not sent to the mirror.
+func (c *Repository) Mirror(mirror string) *Repository {
+	mirror = strings.TrimPrefix(strings.TrimPrefix(mirror, "https://"), "http://")
+	p := strings.SplitN(strings.Trim(mirror, "/"), "/", 2)
+	m := &Repository{
+		client: c.client,
+		host:   p[0],
+		repo:   c.repo,
+	}
+	if len(p) == 2 {
+		m.repo = p[1]
+	}
+	return m
+}
+
 func (c *Repository) login(ctx context.Context, endpoint, service, scope string) error {
 	u, err := url.Parse(endpoint)
 	if err != nil {
@@ -65,34 +117,44 @@ func (c *Repository) login(ctx context.Context, endpoint, service, scope string)
 	}
 	u.RawQuery = strings.Join([]string{
 		"service=" + url.QueryEscape(service),
-		"scope=" + url.QueryEscape(scope),
+		"scope=" + url.QueryEscape(c.loginScope(scope)),
 	}, "&")
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
 		return err
 	}
-	if c.user != "" && c.password != "" {
-		req.SetBasicAuth(c.user, c.password)
+	if user := c.loginUser(service); user != "" && c.password != "" {
+		req.SetBasicAuth(user, c.password)
 	}
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Wrapf(ErrUnauthorized, "login to %s failed %s", service, resp.Status)
+	default:
 		return errors.Errorf("login failed %s", resp.Status)
 	}
 	dec := json.NewDecoder(resp.Body)
+	// token endpoints return token, access_token or both
+	// https://distribution.github.io/distribution/spec/auth/token/#token-response-fields
 	var body struct {
-		Token string `json:"Token"`
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
 	}
 	if err := dec.Decode(&body); err != nil {
 		return err
 	}
-	if body.Token == "" {
+	c.token = body.Token
+	if c.token == "" {
+		c.token = body.AccessToken
+	}
+	if c.token == "" {
 		return errors.New("response does not contains token")
 	}
-	c.token = body.Token
 	return nil
 }
 
@@ -177,6 +239,17 @@ func match(want, got string) bool {
 
 // HasPlatformImage returns an image tag for arch/os exists or not in the repository.
 func (c *Repository) HasPlatformImage(ctx context.Context, tag, arch, os string) (bool, error) {
+	return c.HasPlatformImageWithOSVersion(ctx, tag, arch, os, "")
+}
+
+// matchOSVersion reports whether the os.version (e.g. 10.0.17763.4377) is the build of want (e.g. 10.0.17763).
+func matchOSVersion(want, got string) bool {
+	return want == "" || got == want || strings.HasPrefix(got, want+".")
+}
+
+// HasPlatformImageWithOSVersion returns an image tag for arch/os/os.version exists or not in the repository.
+// osVersion is compared as a prefix of the os.version of images, because Windows images have revisions in the os.version.
+func (c *Repository) HasPlatformImageWithOSVersion(ctx context.Context, tag, arch, os, osVersion string) (bool, error) {
 	mediaType, rc, err := c.getManifests(ctx, tag)
 	if err != nil {
 		return false, err
@@ -198,7 +271,7 @@ func (c *Repository) HasPlatformImage(ctx context.Context, tag, arch, os string)
 				// regard as non platform-specific image
 				return true, nil
 			}
-			if match(arch, p.Architecture) && match(os, p.OS) {
+			if match(arch, p.Architecture) && match(os, p.OS) && matchOSVersion(osVersion, p.OSVersion) {
 				return true, nil
 			}
 		}
@@ -210,7 +283,7 @@ func (c *Repository) HasPlatformImage(ctx context.Context, tag, arch, os string)
 			return false, fmt.Errorf("manifest decode error: %w", err)
 		}
 		if p := manifest.Config.Platform; p != nil {
-			if match(arch, p.OS) && match(os, p.Architecture) {
+			if match(arch, p.Architecture) && match(os, p.OS) && matchOSVersion(osVersion, p.OSVersion) {
 				return true, nil
 			}
 		}
@@ -222,11 +295,15 @@ func (c *Repository) HasPlatformImage(ctx context.Context, tag, arch, os string)
 			return false, err
 		}
 		defer rc.Close()
-		var image ocispec.Image
+		var image struct {
+			ocispec.Image
+			// os.version is not defined in ocispec.Image v1.0
+			OSVersion string `json:"os.version,omitempty"`
+		}
 		if err := json.NewDecoder(rc).Decode(&image); err != nil {
 			return false, fmt.Errorf("image config decode error: %w", err)
 		}
-		if match(arch, image.Architecture) && match(os, image.OS) {
+		if match(arch, image.Architecture) && match(os, image.OS) && matchOSVersion(osVersion, image.OSVersion) {
 			return true, nil
 		}
 	case
@@ -241,6 +318,128 @@ func (c *Repository) HasPlatformImage(ctx context.Context, tag, arch, os string)
 	return false, nil
 }
 
+// ImagePlatforms returns platforms (os/arch) of images in the image tag.
+func (c *Repository) ImagePlatforms(ctx context.Context, tag string) ([]string, error) {
+	mediaType, rc, err := c.getManifests(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	switch mediaType {
+	case
+		ocispec.MediaTypeImageIndex,
+		mediaTypeDockerSchema2ManifestList:
+		var manifestList ocispec.Index
+		if err := json.NewDecoder(rc).Decode(&manifestList); err != nil {
+			return nil, fmt.Errorf("manifest list decode error: %w", err)
+		}
+		var platforms []string
+		for _, desc := range manifestList.Manifests {
+			p := desc.Platform
+			if p == nil || p.OS == "unknown" {
+				// not platform-specific or attestation manifests
+				continue
+			}
+			platforms = append(platforms, p.OS+"/"+p.Architecture)
+		}
+		return platforms, nil
+	case
+		mediaTypeDockerSchema2Manifest,
+		ocispec.MediaTypeImageManifest:
+		var manifest ocispec.Manifest
+		if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("manifest decode error: %w", err)
+		}
+		crc, err := c.getImageConfig(ctx, manifest.Config.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+		defer crc.Close()
+		var image ocispec.Image
+		if err := json.NewDecoder(crc).Decode(&image); err != nil {
+			return nil, fmt.Errorf("image config decode error: %w", err)
+		}
+		return []string{image.OS + "/" + image.Architecture}, nil
+	default:
+		return nil, fmt.Errorf("unknown MediaType %s", mediaType)
+	}
+}
+
+// Pull fetches the manifest of the image tag by GET, as same as docker pull.
+// It triggers caching the image into a pull-through cache repository of Amazon ECR.
+func (c *Repository) Pull(ctx context.Context, tag string) error {
+	_, rc, err := c.getManifests(ctx, tag)
+	if err != nil {
+		return err
+	}
+	return rc.Close()
+}
+
+// ImageLabels returns labels in the config of the image tag.
+// For a multi-platform image, labels of the first platform-specific image are returned.
+func (c *Repository) ImageLabels(ctx context.Context, tag string) (map[string]string, error) {
+	// HasImage logins to the registry when required
+	if ok, err := c.HasImage(ctx, tag); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.Errorf("%s/%s:%s is not found", c.host, c.repo, tag)
+	}
+	mediaType, rc, err := c.getManifests(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	switch mediaType {
+	case
+		ocispec.MediaTypeImageIndex,
+		mediaTypeDockerSchema2ManifestList:
+		var manifestList ocispec.Index
+		if err := json.NewDecoder(rc).Decode(&manifestList); err != nil {
+			return nil, fmt.Errorf("manifest list decode error: %w", err)
+		}
+		for _, desc := range manifestList.Manifests {
+			if p := desc.Platform; p != nil && p.OS == "unknown" {
+				// attestation manifests
+				continue
+			}
+			return c.ImageLabels(ctx, desc.Digest.String())
+		}
+		return nil, errors.New("no images in the manifest list")
+	case
+		mediaTypeDockerSchema2Manifest,
+		ocispec.MediaTypeImageManifest:
+		var manifest ocispec.Manifest
+		if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("manifest decode error: %w", err)
+		}
+		crc, err := c.getImageConfig(ctx, manifest.Config.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+		defer crc.Close()
+		var image ocispec.Image
+		if err := json.NewDecoder(crc).Decode(&image); err != nil {
+			return nil, fmt.Errorf("image config decode error: %w", err)
+		}
+		return image.Config.Labels, nil
+	case
+		"application/vnd.docker.distribution.manifest.v1+prettyjws",
+		"application/vnd.docker.distribution.manifest.v1+json":
+		return nil, ErrDeprecatedManifest
+	default:
+		return nil, fmt.Errorf("unknown MediaType %s", mediaType)
+	}
+}
+
+// HasImageDigest returns an image of the digest exists or not in the repository.
+// The digest may be of a manifest list, so platforms are checked by HasPlatformImage with the digest as the tag.
+func (c *Repository) HasImageDigest(ctx context.Context, digest string) (bool, error) {
+	if !IsDigest(digest) {
+		return false, errors.Errorf("invalid digest %s", digest)
+	}
+	return c.HasImage(ctx, digest)
+}
+
 // HasImage returns an image tag exists or not in the repository.
 func (c *Repository) HasImage(ctx context.Context, tag string) (bool, error) {
 	tries := 2
@@ -252,10 +451,13 @@ func (c *Repository) HasImage(ctx context.Context, tag string) (bool, error) {
 		}
 		switch resp.StatusCode {
 		case http.StatusUnauthorized:
+			if tries == 0 {
+				// the token is not permitted to pull the image
+				return false, errors.Wrapf(ErrUnauthorized, "%s/%s", c.host, c.repo)
+			}
 			h := resp.Header.Get("Www-Authenticate")
-			if strings.HasPrefix(h, "Bearer ") {
-				auth := strings.SplitN(h, " ", 2)[1]
-				e, svc, scope := parseAuthHeader(auth)
+			if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+				e, svc, scope := parseAuthHeader(h[7:])
 				if err := c.login(ctx, e, svc, scope); err != nil {
 					return false, err
 				}
@@ -273,8 +475,16 @@ func (c *Repository) HasImage(ctx context.Context, tag string) (bool, error) {
 
 var (
 	partRegexp = regexp.MustCompile(`[a-zA-Z0-9_]+="[^"]*"`)
+
+	// https://github.com/opencontainers/image-spec/blob/main/descriptor.md#digests
+	digestRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
 )
 
+// IsDigest reports whether the reference of the image is a digest (e.g. sha256:...) rather than a tag.
+func IsDigest(ref string) bool {
+	return digestRegexp.MatchString(ref)
+}
+
 func parseAuthHeader(bearer string) (endpoint, service, scope string) {
 	parsed := make(map[string]string, 3)
 	for _, part := range partRegexp.FindAllString(bearer, -1) {
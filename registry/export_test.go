@@ -0,0 +1,9 @@
+package registry
+
+import "net/http"
+
+func NewWithClient(image, user, password string, client *http.Client) *Repository {
+	c := New(image, user, password)
+	c.client = client
+	return c
+}
@@ -0,0 +1,32 @@
+package ecspresso
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	ghcrHost   = "ghcr.io"
+	gitlabHost = "registry.gitlab.com"
+)
+
+// registryCredentials returns credentials of the registry of the image from environment variables.
+// ghcr.io: GHCR_TOKEN or GITHUB_TOKEN (with GITHUB_ACTOR)
+// GitLab: CI_REGISTRY_USER and CI_REGISTRY_PASSWORD in GitLab CI, or GITLAB_USER and GITLAB_TOKEN
+func registryCredentials(image string) (user, password string) {
+	host := strings.SplitN(image, "/", 2)[0]
+	switch {
+	case host == ghcrHost:
+		password = os.Getenv("GHCR_TOKEN")
+		if password == "" {
+			password = os.Getenv("GITHUB_TOKEN")
+		}
+		return os.Getenv("GITHUB_ACTOR"), password
+	case host == gitlabHost || (host == os.Getenv("CI_REGISTRY") && host != ""):
+		if p := os.Getenv("CI_REGISTRY_PASSWORD"); p != "" {
+			return os.Getenv("CI_REGISTRY_USER"), p
+		}
+		return os.Getenv("GITLAB_USER"), os.Getenv("GITLAB_TOKEN")
+	}
+	return "", ""
+}
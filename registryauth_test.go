@@ -0,0 +1,45 @@
+package ecspresso_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestRegistryCredentials(t *testing.T) {
+	envs := map[string]string{
+		"GHCR_TOKEN":           "",
+		"GITHUB_TOKEN":         "ghp_xxx",
+		"GITHUB_ACTOR":         "octocat",
+		"CI_REGISTRY":          "registry.example.com",
+		"CI_REGISTRY_USER":     "gitlab-ci-token",
+		"CI_REGISTRY_PASSWORD": "job-token",
+	}
+	for k, v := range envs {
+		orig, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, orig)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+	testCases := []struct {
+		image    string
+		user     string
+		password string
+	}{
+		{"ghcr.io/owner/app:v1", "octocat", "ghp_xxx"},
+		{"registry.gitlab.com/group/app:v1", "gitlab-ci-token", "job-token"},
+		{"registry.example.com/group/app:v1", "gitlab-ci-token", "job-token"},
+		{"nginx:latest", "", ""},
+		{"quay.io/owner/app:v1", "", ""},
+	}
+	for _, c := range testCases {
+		user, password := ecspresso.RegistryCredentials(c.image)
+		if user != c.user || password != c.password {
+			t.Errorf("unexpected credentials of %s: %s %s", c.image, user, password)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
+)
+
+// remoteConfigTimeout limits fetching configs from remote sources.
+const remoteConfigTimeout = 5 * time.Minute
+
+// Prefixes of config paths in remote sources.
+const (
+	s3ConfigPrefix  = "s3://"
+	gitConfigPrefix = "git::"
+)
+
+func isRemoteConfig(p string) bool {
+	return strings.HasPrefix(p, s3ConfigPrefix) || strings.HasPrefix(p, gitConfigPrefix)
+}
+
+// parseS3ConfigURL parses s3://bucket/prefix/ecspresso.yml into the bucket, the prefix containing the config and the file name.
+func parseS3ConfigURL(u string) (bucket, prefix, name string, err error) {
+	p := strings.SplitN(strings.TrimPrefix(u, s3ConfigPrefix), "/", 2)
+	if len(p) != 2 || p[0] == "" || p[1] == "" || strings.HasSuffix(p[1], "/") {
+		return "", "", "", errors.Errorf("invalid S3 config URL %s. s3://bucket/path/to/ecspresso.yml is expected", u)
+	}
+	bucket, key := p[0], p[1]
+	if dir := path.Dir(key); dir != "." {
+		prefix = dir + "/"
+	}
+	return bucket, prefix, path.Base(key), nil
+}
+
+// parseGitConfigURL parses git::URL//path/to/ecspresso.yml?ref=REF into the repository URL, the path in the repository and the ref.
+func parseGitConfigURL(u string) (repo, file, ref string, err error) {
+	u = strings.TrimPrefix(u, gitConfigPrefix)
+	if i := strings.LastIndex(u, "?ref="); i != -1 {
+		u, ref = u[:i], u[i+len("?ref="):]
+	}
+	start := 0
+	if i := strings.Index(u, "://"); i != -1 {
+		start = i + len("://")
+	}
+	i := strings.Index(u[start:], "//")
+	if i == -1 {
+		return "", "", "", errors.Errorf("invalid git config URL %s. git::URL//path/to/ecspresso.yml?ref=REF is expected", u)
+	}
+	repo, file = u[:start+i], u[start+i+2:]
+	if repo == "" || file == "" {
+		return "", "", "", errors.Errorf("invalid git config URL %s. git::URL//path/to/ecspresso.yml?ref=REF is expected", u)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// not to be parsed as options of the git command
+	if strings.HasPrefix(repo, "-") || strings.HasPrefix(ref, "-") {
+		return "", "", "", errors.Errorf("invalid git config URL %s. the repository and the ref must not start with -", u)
+	}
+	return repo, file, ref, nil
+}
+
+// fetchRemoteConfigs fetches configs in remote sources into the local directory, and returns local paths of them.
+// The directory containing the config is fetched, so relative paths of definition files work as same as local configs.
+func (c *Config) fetchRemoteConfigs(ctx context.Context, paths []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteConfigTimeout)
+	defer cancel()
+	local := make([]string, 0, len(paths))
+	for i, p := range paths {
+		if !isRemoteConfig(p) {
+			local = append(local, p)
+			continue
+		}
+		if c.remoteDir == "" {
+			dir, err := ioutil.TempDir("", "ecspresso-config")
+			if err != nil {
+				return nil, err
+			}
+			c.remoteDir = dir
+		}
+		dir := filepath.Join(c.remoteDir, fmt.Sprint(i))
+		var lp string
+		var err error
+		if strings.HasPrefix(p, s3ConfigPrefix) {
+			lp, err = c.fetchS3Config(ctx, p, dir)
+		} else {
+			lp, err = fetchGitConfig(ctx, p, dir)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch config %s", p)
+		}
+		local = append(local, lp)
+	}
+	return local, nil
+}
+
+// Cleanup removes files of configs fetched from remote sources.
+func (c *Config) Cleanup() error {
+	if c.remoteDir == "" {
+		return nil
+	}
+	defer func() { c.remoteDir = "" }()
+	return os.RemoveAll(c.remoteDir)
+}
+
+// s3ConfigListInput returns the input to list objects fetched with the config.
+// Objects under the directory of the config are listed recursively, but the config at the root of the bucket
+// lists only objects at the root not to fetch the entire bucket.
+func s3ConfigListInput(bucket, prefix string) *s3.ListObjectsV2Input {
+	in := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	if prefix == "" {
+		in.Delimiter = aws.String("/")
+	}
+	return in
+}
+
+// localPathOfS3Key returns the local path of the key under the prefix in the directory.
+// Keys resolved outside of the directory (e.g. containing "..") are rejected.
+func localPathOfS3Key(dir, prefix, key string) (string, error) {
+	if !strings.HasPrefix(key, prefix) {
+		return "", errors.Errorf("s3 key %s is not under %s", key, prefix)
+	}
+	dest, ok := joinInDir(dir, strings.TrimPrefix(key, prefix))
+	if !ok {
+		return "", errors.Errorf("s3 key %s is resolved outside of the config directory", key)
+	}
+	return dest, nil
+}
+
+// joinInDir joins the slash separated path to the directory.
+// It reports false when the path is resolved to the directory itself or outside of it.
+func joinInDir(dir, p string) (string, bool) {
+	dest := filepath.Join(dir, filepath.FromSlash(p))
+	if rel, err := filepath.Rel(dir, dest); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return dest, true
+}
+
+func (c *Config) fetchS3Config(ctx context.Context, u, dir string) (string, error) {
+	bucket, prefix, name, err := parseS3ConfigURL(u)
+	if err != nil {
+		return "", err
+	}
+	region, awsConfig := c.Region, c.AWS
+	if c.RegionOverride != "" {
+		region = c.RegionOverride
+	}
+	if c.AssumeRoleArn != "" {
+		awsConfig = awsConfig.withAssumeRole(c.AssumeRoleArn)
+	}
+	sess, _, err := newSessionWithSource(region, awsConfig)
+	if err != nil {
+		return "", err
+	}
+	if c.ReadOnly {
+		setupReadOnly(sess)
+	}
+	bucketRegion, err := s3manager.GetBucketRegion(ctx, sess, bucket, "us-east-1")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get the region of the bucket %s", bucket)
+	}
+	svc := s3.New(sess, &aws.Config{Region: aws.String(bucketRegion)})
+	keys := []string{prefix + name}
+	if err := svc.ListObjectsV2PagesWithContext(ctx, s3ConfigListInput(bucket, prefix), func(out *s3.ListObjectsV2Output, _ bool) bool {
+		for _, o := range out.Contents {
+			if k := aws.StringValue(o.Key); !strings.HasSuffix(k, "/") && k != prefix+name {
+				keys = append(keys, k)
+			}
+		}
+		return true
+	}); err != nil {
+		return "", errors.Wrapf(err, "failed to list objects in s3://%s/%s", bucket, prefix)
+	}
+	for _, key := range keys {
+		dest, err := localPathOfS3Key(dir, prefix, key)
+		if err != nil {
+			return "", err
+		}
+		if err := downloadS3Object(ctx, svc, bucket, key, dest); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func downloadS3Object(ctx context.Context, svc *s3.S3, bucket, key, dest string) error {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get s3://%s/%s", bucket, key)
+	}
+	defer out.Body.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, out.Body)
+	return err
+}
+
+// fetchGitConfig fetches the ref of the repository by the git command.
+// The ref may be a branch, a tag or a commit.
+func fetchGitConfig(ctx context.Context, u, dir string) (string, error) {
+	repo, file, ref, err := parseGitConfigURL(u)
+	if err != nil {
+		return "", err
+	}
+	dest, ok := joinInDir(dir, file)
+	if !ok {
+		return "", errors.Errorf("path %s is resolved outside of the repository", file)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet", "--", dir},
+		{"-C", dir, "remote", "add", "--", "origin", repo},
+		{"-C", dir, "fetch", "--quiet", "--depth", "1", "--", "origin", ref},
+		{"-C", dir, "checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		name := args[0]
+		if name == "-C" {
+			name = args[2]
+		}
+		cmd := exec.CommandContext(ctx, "git", args...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", errors.Wrapf(err, "git %s failed: %s", name, strings.TrimSpace(string(out)))
+		}
+	}
+	return dest, nil
+}
@@ -0,0 +1,166 @@
+package ecspresso_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/kayac/ecspresso"
+)
+
+func TestParseS3ConfigURL(t *testing.T) {
+	bucket, prefix, name, err := ecspresso.ParseS3ConfigURL("s3://bucket/app/prod/ecspresso.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket != "bucket" || prefix != "app/prod/" || name != "ecspresso.yml" {
+		t.Errorf("unexpected parsed %s %s %s", bucket, prefix, name)
+	}
+	if _, prefix, _, _ := ecspresso.ParseS3ConfigURL("s3://bucket/ecspresso.yml"); prefix != "" {
+		t.Errorf("unexpected prefix %s", prefix)
+	}
+	for _, u := range []string{"s3://bucket", "s3://bucket/", "s3://bucket/app/"} {
+		if _, _, _, err := ecspresso.ParseS3ConfigURL(u); err == nil {
+			t.Errorf("%s must be invalid", u)
+		}
+	}
+}
+
+func TestS3ConfigListInput(t *testing.T) {
+	if in := ecspresso.S3ConfigListInput("bucket", "app/prod/"); aws.StringValue(in.Prefix) != "app/prod/" || in.Delimiter != nil {
+		t.Errorf("objects under the prefix must be listed recursively %s", in)
+	}
+	if in := ecspresso.S3ConfigListInput("bucket", ""); aws.StringValue(in.Prefix) != "" || aws.StringValue(in.Delimiter) != "/" {
+		t.Errorf("only objects at the root must be listed for the config at the root %s", in)
+	}
+}
+
+func TestLocalPathOfS3Key(t *testing.T) {
+	dir := filepath.Join("tmp", "ecspresso-config")
+	for key, expected := range map[string]string{
+		"app/prod/ecspresso.yml":           filepath.Join(dir, "ecspresso.yml"),
+		"app/prod/overlays/service.json":   filepath.Join(dir, "overlays", "service.json"),
+		"app/prod/overlays/../task.json":   filepath.Join(dir, "task.json"),
+		"app/prod/../../etc/passwd":        "",
+		"app/prod/../prod2/ecspresso.yml":  "",
+		"app/other/ecspresso.yml":          "",
+		"app/prod/overlays/../../../x.yml": "",
+	} {
+		p, err := ecspresso.LocalPathOfS3Key(dir, "app/prod/", key)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%s must be rejected, but resolved to %s", key, p)
+			}
+			continue
+		}
+		if err != nil || p != expected {
+			t.Errorf("unexpected local path of %s: %s %v", key, p, err)
+		}
+	}
+}
+
+func TestParseGitConfigURL(t *testing.T) {
+	testCases := []struct {
+		url  string
+		repo string
+		file string
+		ref  string
+	}{
+		{"git::https://github.com/org/repo.git//deploy/ecspresso.yml?ref=v1.2.3", "https://github.com/org/repo.git", "deploy/ecspresso.yml", "v1.2.3"},
+		{"git::https://github.com/org/repo.git//ecspresso.yml", "https://github.com/org/repo.git", "ecspresso.yml", "HEAD"},
+		{"git::git@github.com:org/repo.git//app/ecspresso.yml?ref=main", "git@github.com:org/repo.git", "app/ecspresso.yml", "main"},
+		{"git::file:///tmp/repo//ecspresso.yml", "file:///tmp/repo", "ecspresso.yml", "HEAD"},
+	}
+	for _, tc := range testCases {
+		repo, file, ref, err := ecspresso.ParseGitConfigURL(tc.url)
+		if err != nil {
+			t.Errorf("%s: %s", tc.url, err)
+			continue
+		}
+		if repo != tc.repo || file != tc.file || ref != tc.ref {
+			t.Errorf("%s: unexpected parsed %s %s %s", tc.url, repo, file, ref)
+		}
+	}
+	if _, _, _, err := ecspresso.ParseGitConfigURL("git::https://github.com/org/repo.git"); err == nil {
+		t.Error("the URL without the path must be invalid")
+	}
+	for _, u := range []string{
+		"git::https://github.com/org/repo.git//ecspresso.yml?ref=--upload-pack=touch /tmp/pwned",
+		"git::--upload-pack=touch /tmp/pwned//ecspresso.yml",
+	} {
+		if _, _, _, err := ecspresso.ParseGitConfigURL(u); err == nil {
+			t.Errorf("%s must be invalid not to be parsed as an option", u)
+		}
+	}
+}
+
+func TestLoadGitConfig(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "ecspresso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"app/ecspresso.yml": "region: ap-northeast-1\ncluster: default\nservice: remote\ntask_definition: td.json\n",
+		"app/td.json":       "{}\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "init"},
+		{"tag", "v1"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s %s", args, err, out)
+		}
+	}
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("git::file://" + dir + "//app/ecspresso.yml?ref=v1"); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Service != "remote" {
+		t.Errorf("unexpected service %s", conf.Service)
+	}
+	if _, err := os.Stat(conf.TaskDefinitionPath); err != nil {
+		t.Errorf("task definition must be fetched: %s", err)
+	}
+	if err := conf.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(conf.TaskDefinitionPath); !os.IsNotExist(err) {
+		t.Errorf("fetched files must be removed: %v", err)
+	}
+
+	conf = ecspresso.NewDefaultConfig()
+	err = conf.Load("git::file://" + dir + "//../../ecspresso.yml?ref=v1")
+	if err == nil || !strings.Contains(err.Error(), "outside of the repository") {
+		t.Errorf("the path outside of the repository must be rejected: %v", err)
+	}
+	conf.Cleanup()
+
+	conf = ecspresso.NewDefaultConfig()
+	err = conf.Load("git::file://" + dir + "//app/ecspresso.yml?ref=missing")
+	if err == nil || !strings.Contains(err.Error(), "git fetch failed") {
+		t.Errorf("unexpected error of the missing ref: %v", err)
+	}
+	conf.Cleanup()
+}
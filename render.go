@@ -37,7 +37,7 @@ func (d *App) Render(opt RenderOption) error {
 		if err != nil {
 			return err
 		}
-		b, err := MarshalJSON(td)
+		b, err := MarshalJSON(d.redactTaskDefinition(td))
 		_, err = out.Write(b)
 		return err
 	}
@@ -0,0 +1,163 @@
+package ecspresso
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// Retry modes of AWS API calls.
+const (
+	RetryModeStandard = "standard"
+	RetryModeAdaptive = "adaptive"
+)
+
+// DefaultPollingRate is the default rate limit (requests per second) of polling API calls.
+const DefaultPollingRate = 10.0
+
+// adaptive rate limiting parameters
+const (
+	adaptiveInitialRate = 10.0
+	adaptiveMinRate     = 0.5
+	adaptiveMaxRate     = 50.0
+)
+
+// pollingOperations are the ECS API operations called repeatedly while waiting.
+var pollingOperations = map[string]bool{
+	"DescribeServices": true,
+	"DescribeTasks":    true,
+}
+
+// AWSRetryConfig represents a configuration of retries and throttling of AWS API calls.
+type AWSRetryConfig struct {
+	Mode        string        `yaml:"mode,omitempty"`
+	MaxAttempts int           `yaml:"max_attempts,omitempty"`
+	Timeout     time.Duration `yaml:"timeout,omitempty"`
+	PollingRate float64       `yaml:"polling_rate,omitempty"`
+}
+
+func (c *AWSRetryConfig) validate() error {
+	switch c.Mode {
+	case "", RetryModeStandard, RetryModeAdaptive:
+	default:
+		return errors.Errorf("aws.retry.mode must be %s or %s: %s", RetryModeStandard, RetryModeAdaptive, c.Mode)
+	}
+	if c.MaxAttempts < 0 {
+		return errors.Errorf("aws.retry.max_attempts must be positive: %d", c.MaxAttempts)
+	}
+	if c.Timeout < 0 {
+		return errors.Errorf("aws.retry.timeout must be positive: %s", c.Timeout)
+	}
+	if c.PollingRate < 0 {
+		return errors.Errorf("aws.retry.polling_rate must be positive: %f", c.PollingRate)
+	}
+	return nil
+}
+
+func (c *AWSRetryConfig) pollingRate() float64 {
+	if c == nil || c.PollingRate == 0 {
+		return DefaultPollingRate
+	}
+	return c.PollingRate
+}
+
+// applyRetryConfig sets the retryer and the per-call timeout into the aws.Config.
+func applyRetryConfig(config *aws.Config, c *AWSRetryConfig) {
+	if c == nil {
+		return
+	}
+	if c.MaxAttempts > 0 {
+		request.WithRetryer(config, client.DefaultRetryer{NumMaxRetries: c.MaxAttempts - 1})
+	}
+	if c.Timeout > 0 {
+		config.HTTPClient = &http.Client{Timeout: c.Timeout}
+	}
+}
+
+// setupRateLimit adds handlers to limit the rate of polling API calls,
+// and to limit the rate of all calls adaptively by throttling errors in adaptive mode.
+func setupRateLimit(sess *session.Session, c *AWSRetryConfig) {
+	polling := rate.NewLimiter(rate.Limit(c.pollingRate()), 1)
+	sess.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: "ecspresso.PollingRateLimit",
+		Fn: func(r *request.Request) {
+			if r.ClientInfo.ServiceName != "ecs" || !pollingOperations[r.Operation.Name] {
+				return
+			}
+			if err := polling.Wait(r.Context()); err != nil {
+				r.Error = err
+			}
+		},
+	})
+
+	if c == nil || c.Mode != RetryModeAdaptive {
+		return
+	}
+	adaptive := newAdaptiveRateLimiter()
+	sess.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: "ecspresso.AdaptiveRateLimit",
+		Fn: func(r *request.Request) {
+			if err := adaptive.wait(r); err != nil {
+				r.Error = err
+			}
+		},
+	})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "ecspresso.AdaptiveRateLimitFeedback",
+		Fn: func(r *request.Request) {
+			adaptive.feedback(r.Error != nil && request.IsErrorThrottle(r.Error))
+		},
+	})
+}
+
+// adaptiveRateLimiter limits the rate of API calls after throttled.
+// The rate is halved on each throttling error, and recovers gradually on successes.
+type adaptiveRateLimiter struct {
+	mu      sync.Mutex
+	limiter *rate.Limiter
+}
+
+func newAdaptiveRateLimiter() *adaptiveRateLimiter {
+	return &adaptiveRateLimiter{
+		limiter: rate.NewLimiter(rate.Inf, 1),
+	}
+}
+
+func (a *adaptiveRateLimiter) wait(r *request.Request) error {
+	return a.limiter.Wait(r.Context())
+}
+
+func (a *adaptiveRateLimiter) feedback(throttled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if next := nextAdaptiveRate(a.limiter.Limit(), throttled); next != a.limiter.Limit() {
+		a.limiter.SetLimit(next)
+	}
+}
+
+// nextAdaptiveRate returns the next rate limit by the result of an API call.
+// rate.Inf means the calls are not limited.
+func nextAdaptiveRate(current rate.Limit, throttled bool) rate.Limit {
+	switch {
+	case throttled && current == rate.Inf:
+		return adaptiveInitialRate
+	case throttled:
+		if next := current / 2; next > adaptiveMinRate {
+			return next
+		}
+		return adaptiveMinRate
+	case current == rate.Inf:
+		return rate.Inf
+	}
+	if next := current * 1.1; next <= adaptiveMaxRate {
+		return next
+	}
+	return rate.Inf
+}
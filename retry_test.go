@@ -0,0 +1,61 @@
+package ecspresso_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kayac/ecspresso"
+	"golang.org/x/time/rate"
+)
+
+func TestValidateRetryConfig(t *testing.T) {
+	valid := []*ecspresso.AWSRetryConfig{
+		{},
+		{Mode: "standard", MaxAttempts: 5},
+		{Mode: "adaptive", Timeout: 30 * time.Second, PollingRate: 2.5},
+	}
+	for _, c := range valid {
+		if err := ecspresso.ValidateRetryConfig(c); err != nil {
+			t.Errorf("%#v must be valid: %s", c, err)
+		}
+	}
+	invalid := []*ecspresso.AWSRetryConfig{
+		{Mode: "legacy"},
+		{MaxAttempts: -1},
+		{Timeout: -time.Second},
+		{PollingRate: -1},
+	}
+	for _, c := range invalid {
+		if err := ecspresso.ValidateRetryConfig(c); err == nil {
+			t.Errorf("%#v must be invalid", c)
+		}
+	}
+}
+
+func TestNextAdaptiveRate(t *testing.T) {
+	l := rate.Inf
+	if l = ecspresso.NextAdaptiveRate(l, false); l != rate.Inf {
+		t.Errorf("unexpected rate without throttling %f", l)
+	}
+	if l = ecspresso.NextAdaptiveRate(l, true); l != 10 {
+		t.Errorf("unexpected rate after throttled %f", l)
+	}
+	if l = ecspresso.NextAdaptiveRate(l, true); l != 5 {
+		t.Errorf("unexpected rate after throttled twice %f", l)
+	}
+	for i := 0; i < 10; i++ {
+		l = ecspresso.NextAdaptiveRate(l, true)
+	}
+	if l != 0.5 {
+		t.Errorf("rate must not be lower than min %f", l)
+	}
+	if l = ecspresso.NextAdaptiveRate(l, false); l <= 0.5 {
+		t.Errorf("rate must be increased on success %f", l)
+	}
+	for i := 0; i < 100; i++ {
+		l = ecspresso.NextAdaptiveRate(l, false)
+	}
+	if l != rate.Inf {
+		t.Errorf("rate must be unlimited after recovered %f", l)
+	}
+}
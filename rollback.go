@@ -1,6 +1,7 @@
 package ecspresso
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -9,12 +10,47 @@ import (
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func (d *App) Rollback(opt RollbackOption) error {
 	ctx, cancel := d.Start()
 	defer cancel()
+	return d.RollbackWithContext(ctx, opt)
+}
+
+// RollbackWithContext rolls back the service with the context.
+// Nil bool and string fields of the option are treated as zero values.
+func (d *App) RollbackWithContext(ctx context.Context, opt RollbackOption) error {
+	fillNilOptions(&opt)
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
+	ctx, span := d.startSpan(ctx, "rollback", attribute.Bool("dry_run", *opt.DryRun))
+	ev := d.newDeploymentEvent()
+	var audit *AuditRecord
+	if !*opt.DryRun {
+		unlock, err := d.acquireLock(ctx, aws.BoolValue(opt.ForceUnlock))
+		if err != nil {
+			endSpan(span, err)
+			return err
+		}
+		defer unlock()
+		audit = d.startAudit(ctx, "rollback", auditOption{})
+	}
+	err := d.rollback(ctx, opt, ev)
+	endSpan(span, err)
+	if !*opt.DryRun {
+		d.notify(ev.finish(DeploymentEventRollback, err))
+		d.finishAudit(audit, err)
+		if err == nil {
+			d.saveState(stateOption{command: "rollback", startedAt: ev.StartedAt})
+		}
+	}
+	return err
+}
+
+func (d *App) rollback(ctx context.Context, opt RollbackOption, ev *DeploymentEvent) error {
 	if aws.BoolValue(opt.DeregisterTaskDefinition) && aws.BoolValue(opt.NoWait) {
 		fmt.Fprintln(
 			os.Stderr,
@@ -29,10 +65,27 @@ func (d *App) Rollback(opt RollbackOption) error {
 	}
 
 	currentArn := *sv.TaskDefinition
+	ev.PreviousTaskDefinition = arnToName(currentArn)
 	targetArn, err := d.FindRollbackTarget(ctx, currentArn)
 	if err != nil {
 		return errors.Wrap(err, "failed to find rollback target")
 	}
+	if !*opt.DryRun {
+		if err := d.setDeploymentEventTaskDefinition(ctx, ev, targetArn); err != nil {
+			d.Log("WARNING: failed to describe task definition for notifications", err)
+		}
+		p := newChangePlan("rollback")
+		p.add("roll back the task definition from %s to %s", arnToName(currentArn), arnToName(targetArn))
+		if isCodeDeploy(sv.DeploymentController) {
+			p.add("roll back by CodeDeploy")
+		}
+		if aws.BoolValue(opt.DeregisterTaskDefinition) {
+			p.add("deregister %s", arnToName(currentArn))
+		}
+		if err := d.confirmPlan(p); err != nil {
+			return err
+		}
+	}
 
 	if isCodeDeploy(sv.DeploymentController) {
 		return d.RollbackByCodeDeploy(ctx, sv, targetArn, opt)
@@ -0,0 +1,129 @@
+package ecspresso_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+// fakeFailingWaitECS fails waiting for the service stable failures times.
+type fakeFailingWaitECS struct {
+	fakeECS
+	failures int
+	waits    int
+	updates  []string
+}
+
+func (f *fakeFailingWaitECS) UpdateServiceWithContext(ctx aws.Context, in *ecs.UpdateServiceInput, opts ...request.Option) (*ecs.UpdateServiceOutput, error) {
+	f.updates = append(f.updates, aws.StringValue(in.TaskDefinition))
+	return f.fakeECS.UpdateServiceWithContext(ctx, in, opts...)
+}
+
+func (f *fakeFailingWaitECS) WaitUntilServicesStableWithContext(_ aws.Context, _ *ecs.DescribeServicesInput, _ ...request.WaiterOption) error {
+	f.waits++
+	if f.waits <= f.failures {
+		return awserr.New(request.WaiterResourceNotReadyErrorCode, "exceeded wait attempts", nil)
+	}
+	return nil
+}
+
+func TestDeployRollbackOnFailure(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	previous := "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"
+	testCases := []struct {
+		name     string
+		rollback bool
+		failures int
+		updates  int
+		code     int
+	}{
+		{name: "rolled back", rollback: true, failures: 1, updates: 2, code: ecspresso.ExitCodeRollback},
+		{name: "rollback failed", rollback: true, failures: 2, updates: 2, code: ecspresso.ExitCodeTimeout},
+		{name: "without the option", rollback: false, failures: 1, updates: 1, code: ecspresso.ExitCodeTimeout},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := ecspresso.NewDefaultConfig()
+			if err := conf.Load("tests/test.yaml"); err != nil {
+				t.Fatal(err)
+			}
+			conf.Timeout = time.Minute
+			fake := &fakeFailingWaitECS{
+				fakeECS: fakeECS{
+					service: &ecs.Service{
+						ServiceName:    aws.String("test"),
+						ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+						TaskDefinition: aws.String(previous),
+						DesiredCount:   aws.Int64(1),
+					},
+				},
+				failures: tc.failures,
+			}
+			app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+				ECS:                    fake,
+				ApplicationAutoScaling: &fakeAutoScaling{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.DeployWithContext(context.Background(), ecspresso.DeployOption{
+				RollbackOnFailure: aws.Bool(tc.rollback),
+			})
+			if err == nil {
+				t.Fatal("deploy must be failed")
+			}
+			if code := ecspresso.ExitCodeOf(err); code != tc.code {
+				t.Errorf("expected exit code %d, got %d: %s", tc.code, code, err)
+			}
+			if len(fake.updates) != tc.updates {
+				t.Fatalf("unexpected updates %v", fake.updates)
+			}
+			if tc.rollback && fake.updates[1] != previous {
+				t.Errorf("must be rolled back to %s: %v", previous, fake.updates)
+			}
+		})
+	}
+}
+
+func TestDeployRollbackOnFailureWithCodeDeploy(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	fake := &fakeFailingWaitECS{
+		fakeECS: fakeECS{
+			service: &ecs.Service{
+				ServiceName:          aws.String("test"),
+				ClusterArn:           aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+				TaskDefinition:       aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+				DesiredCount:         aws.Int64(1),
+				DeploymentController: &ecs.DeploymentController{Type: aws.String("CODE_DEPLOY")},
+			},
+		},
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:                    fake,
+		ApplicationAutoScaling: &fakeAutoScaling{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.DeployWithContext(context.Background(), ecspresso.DeployOption{
+		RollbackOnFailure: aws.Bool(true),
+	})
+	if err == nil || !strings.Contains(err.Error(), "not supported for the CODE_DEPLOY deployment controller") {
+		t.Errorf("--rollback-on-failure must be rejected for CODE_DEPLOY: %v", err)
+	}
+	if len(fake.updates) != 0 {
+		t.Errorf("service must not be updated: %v", fake.updates)
+	}
+}
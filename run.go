@@ -12,11 +12,26 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (d *App) Run(opt RunOption) error {
+func (d *App) Run(opt RunOption) (err error) {
 	ctx, cancel := d.Start()
 	defer cancel()
 
+	if !*opt.DryRun {
+		var ao auditOption
+		if !*opt.SkipTaskDefinition && !*opt.LatestTaskDefinition && aws.StringValue(opt.ScheduledTask) == "" {
+			ao.taskDefinitionPath = aws.StringValue(opt.TaskDefinition)
+			if ao.taskDefinitionPath == "" {
+				ao.taskDefinitionPath = d.config.TaskDefinitionPath
+			}
+		}
+		audit := d.startAudit(ctx, "run", ao)
+		defer func() { d.finishAudit(audit, err) }()
+	}
+
 	d.Log("Running task", opt.DryRunString())
+	if aws.StringValue(opt.ScheduledTask) != "" {
+		return d.runScheduledTask(ctx, opt)
+	}
 	ov := ecs.TaskOverride{}
 	if ovStr := aws.StringValue(opt.TaskOverrideStr); ovStr != "" {
 		if err := json.Unmarshal([]byte(ovStr), &ov); err != nil {
@@ -31,7 +46,7 @@ func (d *App) Run(opt RunOption) error {
 			return errors.Wrapf(err, "failed to read overrides-file %s", ovFile)
 		}
 	}
-	d.DebugLog("Overrides:", ov.String())
+	d.DebugLog("Overrides:", d.redactor.redact(&ov).(*ecs.TaskOverride).String())
 
 	tdArn, watchContainer, err := d.taskDefinitionForRun(ctx, opt)
 	if err != nil {
@@ -107,8 +122,11 @@ func (d *App) RunTask(ctx context.Context, tdArn string, ov *ecs.TaskOverride, o
 	default:
 		in.PropagateTags = opt.PropagateTags
 	}
-	d.DebugLog("run task input", in.String())
+	d.DebugLog("run task input", d.redactor.redact(in).(*ecs.RunTaskInput).String())
+	return d.runTask(ctx, in)
+}
 
+func (d *App) runTask(ctx context.Context, in *ecs.RunTaskInput) (*ecs.Task, error) {
 	out, err := d.ecs.RunTaskWithContext(ctx, in)
 	if err != nil {
 		return nil, err
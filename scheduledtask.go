@@ -0,0 +1,172 @@
+package ecspresso
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/pkg/errors"
+)
+
+// parseScheduledTaskName parses RULE or RULE/TARGET_ID.
+func parseScheduledTaskName(s string) (rule, targetID string) {
+	if i := strings.Index(s, "/"); i != -1 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// scheduledTaskTarget returns the ECS target of the rule. targetID is required when the rule has multiple ECS targets.
+func scheduledTaskTarget(rule, targetID string, targets []*eventbridge.Target) (*eventbridge.Target, error) {
+	var found []*eventbridge.Target
+	for _, t := range targets {
+		if t.EcsParameters == nil {
+			continue
+		}
+		if targetID == "" || aws.StringValue(t.Id) == targetID {
+			found = append(found, t)
+		}
+	}
+	switch len(found) {
+	case 0:
+		if targetID != "" {
+			return nil, errors.Errorf("ECS target %s is not found in the rule %s", targetID, rule)
+		}
+		return nil, errors.Errorf("rule %s has no ECS targets", rule)
+	case 1:
+		return found[0], nil
+	default:
+		ids := make([]string, 0, len(found))
+		for _, t := range found {
+			ids = append(ids, aws.StringValue(t.Id))
+		}
+		return nil, errors.Errorf("rule %s has multiple ECS targets. specify one of them as %s/TARGET_ID: %s", rule, rule, strings.Join(ids, ", "))
+	}
+}
+
+// scheduledTaskRunTaskInput returns the RunTask input which runs the same task as EventBridge runs for the target.
+func scheduledTaskRunTaskInput(cluster string, t *eventbridge.Target) (*ecs.RunTaskInput, error) {
+	if t.InputTransformer != nil || t.InputPath != nil {
+		return nil, errors.Errorf("target %s transforms the input of events. it can not be run on demand", aws.StringValue(t.Id))
+	}
+	p := t.EcsParameters
+	in := &ecs.RunTaskInput{
+		Cluster:              aws.String(cluster),
+		TaskDefinition:       p.TaskDefinitionArn,
+		Count:                p.TaskCount,
+		LaunchType:           p.LaunchType,
+		PlatformVersion:      p.PlatformVersion,
+		Group:                p.Group,
+		EnableECSManagedTags: p.EnableECSManagedTags,
+		EnableExecuteCommand: p.EnableExecuteCommand,
+		PropagateTags:        p.PropagateTags,
+		ReferenceId:          p.ReferenceId,
+	}
+	if in.Count == nil {
+		in.Count = aws.Int64(1)
+	}
+	if nc := p.NetworkConfiguration; nc != nil && nc.AwsvpcConfiguration != nil {
+		in.NetworkConfiguration = &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+				AssignPublicIp: nc.AwsvpcConfiguration.AssignPublicIp,
+				SecurityGroups: nc.AwsvpcConfiguration.SecurityGroups,
+				Subnets:        nc.AwsvpcConfiguration.Subnets,
+			},
+		}
+	}
+	for _, s := range p.CapacityProviderStrategy {
+		in.CapacityProviderStrategy = append(in.CapacityProviderStrategy, &ecs.CapacityProviderStrategyItem{
+			CapacityProvider: s.CapacityProvider,
+			Weight:           s.Weight,
+			Base:             s.Base,
+		})
+	}
+	for _, c := range p.PlacementConstraints {
+		in.PlacementConstraints = append(in.PlacementConstraints, &ecs.PlacementConstraint{Type: c.Type, Expression: c.Expression})
+	}
+	for _, s := range p.PlacementStrategy {
+		in.PlacementStrategy = append(in.PlacementStrategy, &ecs.PlacementStrategy{Type: s.Type, Field: s.Field})
+	}
+	for _, tag := range p.Tags {
+		in.Tags = append(in.Tags, &ecs.Tag{Key: tag.Key, Value: tag.Value})
+	}
+	if input := aws.StringValue(t.Input); input != "" {
+		var ov ecs.TaskOverride
+		if err := json.Unmarshal([]byte(input), &ov); err != nil {
+			return nil, errors.Wrapf(err, "invalid input of target %s", aws.StringValue(t.Id))
+		}
+		in.Overrides = &ov
+	}
+	return in, nil
+}
+
+// runScheduledTask runs the task of the EventBridge scheduled task with the same parameters on demand.
+func (d *App) runScheduledTask(ctx context.Context, opt RunOption) error {
+	name, targetID := parseScheduledTaskName(aws.StringValue(opt.ScheduledTask))
+	rule, err := d.eventbridge.DescribeRuleWithContext(ctx, &eventbridge.DescribeRuleInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to describe scheduled task rule %s", name)
+	}
+	out, err := d.eventbridge.ListTargetsByRuleWithContext(ctx, &eventbridge.ListTargetsByRuleInput{
+		Rule: aws.String(name),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list targets of rule %s", name)
+	}
+	t, err := scheduledTaskTarget(name, targetID, out.Targets)
+	if err != nil {
+		return err
+	}
+	if cluster := arnToName(aws.StringValue(t.Arn)); cluster != arnToName(d.Cluster) {
+		return errors.Errorf("target %s of rule %s runs tasks in the cluster %s, not %s", aws.StringValue(t.Id), name, cluster, d.Cluster)
+	}
+	in, err := scheduledTaskRunTaskInput(d.Cluster, t)
+	if err != nil {
+		return err
+	}
+	d.Log("Scheduled task rule:", name, aws.StringValue(rule.ScheduleExpression))
+	d.Log("Target:", aws.StringValue(t.Id))
+	d.Log("Task definition ARN:", aws.StringValue(in.TaskDefinition))
+	if aws.StringValue(t.RoleArn) != "" {
+		d.DebugLog("the role of the target is used by EventBridge only. the task runs with the current credentials", aws.StringValue(t.RoleArn))
+	}
+	if *opt.DryRun {
+		d.Log("run task input:")
+		d.LogJSON(in)
+		d.Log("DRY RUN OK")
+		return nil
+	}
+
+	td, err := d.DescribeTaskDefinition(ctx, aws.StringValue(in.TaskDefinition))
+	if err != nil {
+		return errors.Wrap(err, "failed to describe task definition")
+	}
+	watchContainer := containerOf(td, opt.WatchContainer)
+	if watchContainer == nil {
+		return errors.Errorf("container %s is not found in %s", aws.StringValue(opt.WatchContainer), aws.StringValue(in.TaskDefinition))
+	}
+	d.Log("Watch container:", *watchContainer.Name)
+
+	task, err := d.runTask(ctx, in)
+	if err != nil {
+		return errors.Wrap(err, "failed to run task")
+	}
+	if *opt.NoWait {
+		d.Log("Run task invoked")
+		return nil
+	}
+	if err := d.WaitRunTask(ctx, task, watchContainer, time.Now(), opt.waitUntilRunning()); err != nil {
+		return errors.Wrap(err, "failed to run task")
+	}
+	if err := d.DescribeTaskStatus(ctx, task, watchContainer); err != nil {
+		return err
+	}
+	d.Log("Run task completed!")
+	return nil
+}
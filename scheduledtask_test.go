@@ -0,0 +1,121 @@
+package ecspresso_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/kayac/ecspresso"
+)
+
+func testScheduledTaskTarget(id string) *eventbridge.Target {
+	return &eventbridge.Target{
+		Id:      aws.String(id),
+		Arn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+		RoleArn: aws.String("arn:aws:iam::123456789012:role/ecsEventsRole"),
+		Input:   aws.String(`{"containerOverrides":[{"name":"app","command":["batch","--nightly"]}],"taskRoleArn":"arn:aws:iam::123456789012:role/batch"}`),
+		EcsParameters: &eventbridge.EcsParameters{
+			TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/batch:3"),
+			LaunchType:        aws.String("FARGATE"),
+			NetworkConfiguration: &eventbridge.NetworkConfiguration{
+				AwsvpcConfiguration: &eventbridge.AwsVpcConfiguration{
+					Subnets:        aws.StringSlice([]string{"subnet-1"}),
+					SecurityGroups: aws.StringSlice([]string{"sg-1"}),
+				},
+			},
+			Tags: []*eventbridge.Tag{{Key: aws.String("Job"), Value: aws.String("nightly")}},
+		},
+	}
+}
+
+func TestParseScheduledTaskName(t *testing.T) {
+	if rule, id := ecspresso.ParseScheduledTaskName("nightly/batch"); rule != "nightly" || id != "batch" {
+		t.Errorf("unexpected %s %s", rule, id)
+	}
+	if rule, id := ecspresso.ParseScheduledTaskName("nightly"); rule != "nightly" || id != "" {
+		t.Errorf("unexpected %s %s", rule, id)
+	}
+}
+
+func TestScheduledTaskTarget(t *testing.T) {
+	lambda := &eventbridge.Target{Id: aws.String("notify"), Arn: aws.String("arn:aws:lambda:ap-northeast-1:123456789012:function:notify")}
+	targets := []*eventbridge.Target{lambda, testScheduledTaskTarget("batch")}
+	if tg, err := ecspresso.ScheduledTaskTarget("nightly", "", targets); err != nil || aws.StringValue(tg.Id) != "batch" {
+		t.Errorf("unexpected target %v %v", tg, err)
+	}
+	targets = append(targets, testScheduledTaskTarget("batch2"))
+	if _, err := ecspresso.ScheduledTaskTarget("nightly", "", targets); err == nil || !strings.Contains(err.Error(), "batch, batch2") {
+		t.Errorf("multiple targets must be an error: %v", err)
+	}
+	if tg, err := ecspresso.ScheduledTaskTarget("nightly", "batch2", targets); err != nil || aws.StringValue(tg.Id) != "batch2" {
+		t.Errorf("unexpected target %v %v", tg, err)
+	}
+	if _, err := ecspresso.ScheduledTaskTarget("nightly", "notify", targets); err == nil {
+		t.Error("non-ECS target must be an error")
+	}
+}
+
+func TestScheduledTaskRunTaskInput(t *testing.T) {
+	in, err := ecspresso.ScheduledTaskRunTaskInput("default2", testScheduledTaskTarget("batch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(in.TaskDefinition) != "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/batch:3" || aws.Int64Value(in.Count) != 1 {
+		t.Errorf("unexpected task definition or count %s", in)
+	}
+	if aws.StringValueSlice(in.NetworkConfiguration.AwsvpcConfiguration.Subnets)[0] != "subnet-1" {
+		t.Errorf("unexpected network configuration %s", in.NetworkConfiguration)
+	}
+	if aws.StringValue(in.Overrides.TaskRoleArn) != "arn:aws:iam::123456789012:role/batch" ||
+		strings.Join(aws.StringValueSlice(in.Overrides.ContainerOverrides[0].Command), " ") != "batch --nightly" {
+		t.Errorf("unexpected overrides %s", in.Overrides)
+	}
+	if len(in.Tags) != 1 || aws.StringValue(in.Tags[0].Key) != "Job" {
+		t.Errorf("unexpected tags %s", in.Tags)
+	}
+
+	tg := testScheduledTaskTarget("batch")
+	tg.InputTransformer = &eventbridge.InputTransformer{InputTemplate: aws.String(`{"containerOverrides":[]}`)}
+	if _, err := ecspresso.ScheduledTaskRunTaskInput("default2", tg); err == nil {
+		t.Error("input transformer must be an error")
+	}
+}
+
+type fakeScheduledTaskEventBridge struct {
+	eventbridgeiface.EventBridgeAPI
+	targets []*eventbridge.Target
+}
+
+func (f *fakeScheduledTaskEventBridge) DescribeRuleWithContext(_ aws.Context, in *eventbridge.DescribeRuleInput, _ ...request.Option) (*eventbridge.DescribeRuleOutput, error) {
+	return &eventbridge.DescribeRuleOutput{Name: in.Name, ScheduleExpression: aws.String("cron(0 3 * * ? *)")}, nil
+}
+
+func (f *fakeScheduledTaskEventBridge) ListTargetsByRuleWithContext(_ aws.Context, _ *eventbridge.ListTargetsByRuleInput, _ ...request.Option) (*eventbridge.ListTargetsByRuleOutput, error) {
+	return &eventbridge.ListTargetsByRuleOutput{Targets: f.targets}, nil
+}
+
+func TestRunScheduledTaskDryRun(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	eb := &fakeScheduledTaskEventBridge{targets: []*eventbridge.Target{testScheduledTaskTarget("batch")}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: &fakeECS{}, EventBridge: eb})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := ecspresso.RunOption{DryRun: aws.Bool(true), ScheduledTask: aws.String("nightly")}
+	if err := app.Run(opt); err != nil {
+		t.Fatal(err)
+	}
+
+	eb.targets[0].Arn = aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/other")
+	if err := app.Run(opt); err == nil || !strings.Contains(err.Error(), "cluster other") {
+		t.Errorf("target in another cluster must be an error: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package ecspresso
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Types of JSON Schema printed by the schema command.
+const (
+	SchemaTypeConfig                = "config"
+	SchemaTypeTaskDefinition        = "task-definition"
+	SchemaTypeServiceDefinition     = "service-definition"
+	SchemaTypeAutoScalingDefinition = "autoscaling-definition"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// configRequiredKeys are keys required in the configuration file.
+var configRequiredKeys = []string{"task_definition"}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+type SchemaOption struct {
+	Type *string
+}
+
+type jsonSchema map[string]interface{}
+
+type schemaGenerator struct {
+	// fieldName returns the key name of the struct field. false means the field is ignored.
+	fieldName func(f reflect.StructField) (string, bool)
+	// required reports whether the struct field is required.
+	required func(f reflect.StructField) bool
+	visiting map[reflect.Type]bool
+}
+
+func newYAMLSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		fieldName: yamlFieldName,
+		required:  func(reflect.StructField) bool { return false },
+		visiting:  map[reflect.Type]bool{},
+	}
+}
+
+func newJSONSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		fieldName: jsonFieldName,
+		required: func(f reflect.StructField) bool {
+			return f.Tag.Get("required") == "true"
+		},
+		visiting: map[reflect.Type]bool{},
+	}
+}
+
+func yamlFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.SplitN(tag, ",", 2)[0]; name != "" {
+		return name, true
+	}
+	return strings.ToLower(f.Name), true
+}
+
+// jsonFieldName returns the name of the field in definition files.
+// Types of the AWS SDK have locationName tags instead of json tags.
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.SplitN(tag, ",", 2)[0]; name != "" {
+		return name, true
+	}
+	if name := f.Tag.Get("locationName"); name != "" {
+		return name, true
+	}
+	r, size := utf8.DecodeRuneInString(f.Name)
+	return string(unicode.ToLower(r)) + f.Name[size:], true
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) jsonSchema {
+	switch t {
+	case durationType:
+		return jsonSchema{"type": []string{"string", "integer"}, "description": "duration (e.g. 30s, 10m, 1h)"}
+	case timeType:
+		return jsonSchema{"type": []string{"string", "integer"}}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaOf(t.Elem())
+	case reflect.String:
+		return jsonSchema{"type": "string"}
+	case reflect.Bool:
+		return jsonSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonSchema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return jsonSchema{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return jsonSchema{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if g.visiting[t] {
+			// recursive type
+			return jsonSchema{"type": "object"}
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
+		props := jsonSchema{}
+		var required []string
+		g.fields(t, props, &required)
+		s := jsonSchema{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return jsonSchema{}
+}
+
+func (g *schemaGenerator) fields(t reflect.Type, props jsonSchema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				// embedded struct fields are flattened
+				g.fields(ft, props, required)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name, ok := g.fieldName(f)
+		if !ok {
+			continue
+		}
+		props[name] = g.schemaOf(f.Type)
+		if g.required(f) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// generateSchema returns the JSON Schema of the configuration file or definition files.
+func generateSchema(schemaType string) (jsonSchema, error) {
+	var s jsonSchema
+	var title string
+	switch schemaType {
+	case SchemaTypeConfig:
+		s = newYAMLSchemaGenerator().schemaOf(reflect.TypeOf(Config{}))
+		s["required"] = configRequiredKeys
+		title = "ecspresso configuration file"
+	case SchemaTypeTaskDefinition:
+		s = newJSONSchemaGenerator().schemaOf(reflect.TypeOf(TaskDefinitionInput{}))
+		title = "ecspresso task definition file"
+	case SchemaTypeServiceDefinition:
+		s = newJSONSchemaGenerator().schemaOf(reflect.TypeOf(Service{}))
+		title = "ecspresso service definition file"
+	case SchemaTypeAutoScalingDefinition:
+		s = newJSONSchemaGenerator().schemaOf(reflect.TypeOf(AutoScalingDefinition{}))
+		title = "ecspresso autoscaling definition file"
+	default:
+		return nil, errors.Errorf("unknown schema type: %s", schemaType)
+	}
+	s["$schema"] = jsonSchemaDraft
+	s["title"] = title
+	return s, nil
+}
+
+// Schema prints the JSON Schema for editor integration.
+// It does not require the configuration file.
+func Schema(opt SchemaOption) error {
+	s, err := generateSchema(*opt.Type)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal schema")
+	}
+	fmt.Println(string(b))
+	return nil
+}
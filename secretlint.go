@@ -0,0 +1,108 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// Modes of the plaintext secrets check by verify.
+const (
+	PlaintextSecretsWarn   = "warn"
+	PlaintextSecretsError  = "error"
+	PlaintextSecretsIgnore = "ignore"
+)
+
+var plaintextSecretPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA|A3T[A-Z0-9])[A-Z0-9]{16}\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"password in URL", regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+:[^@/\s]+@`)},
+}
+
+var secretLikeNameRegex = regexp.MustCompile(`(?i)(SECRET|TOKEN|PASSWORD|PASSWD|API_?KEY|PRIVATE_?KEY|CREDENTIAL)`)
+
+// shannonEntropy returns the Shannon entropy (bits per character) of s.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	freq := map[rune]float64{}
+	for _, r := range s {
+		freq[r]++
+	}
+	n := float64(len([]rune(s)))
+	var e float64
+	for _, c := range freq {
+		p := c / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// detectPlaintextSecret returns a kind of the secret when the environment variable looks like a secret.
+func detectPlaintextSecret(name, value string) string {
+	for _, p := range plaintextSecretPatterns {
+		if p.re.MatchString(value) {
+			return p.kind
+		}
+	}
+	if len(value) < 20 || strings.ContainsAny(value, " \t\n") {
+		return ""
+	}
+	e := shannonEntropy(value)
+	if secretLikeNameRegex.MatchString(name) && e >= 3.5 {
+		return "high-entropy value"
+	}
+	if len(value) >= 32 && e >= 4.5 && !strings.Contains(value, "/") {
+		return "high-entropy value"
+	}
+	return ""
+}
+
+// plaintextSecretsOf returns findings of environment variables that look like secrets in the container.
+func plaintextSecretsOf(c *ecs.ContainerDefinition) []string {
+	var findings []string
+	for _, env := range c.Environment {
+		name := aws.StringValue(env.Name)
+		if kind := detectPlaintextSecret(name, aws.StringValue(env.Value)); kind != "" {
+			findings = append(findings, fmt.Sprintf("%s looks like %s", name, kind))
+		}
+	}
+	return findings
+}
+
+func (d *App) verifyPlaintextSecrets(ctx context.Context, c *ecs.ContainerDefinition) error {
+	mode := aws.StringValue(d.verifier.opt.PlaintextSecrets)
+	if mode == PlaintextSecretsIgnore {
+		return verifySkipErr("checking plaintext secrets in environment")
+	}
+	findings := plaintextSecretsOf(c)
+	if len(findings) == 0 {
+		return nil
+	}
+	msg := strings.Join(findings, ", ") + ". use secrets instead of environment"
+	if mode == PlaintextSecretsError {
+		return errors.New(msg)
+	}
+	return verifyWarnErr(msg)
+}
+
+// warnPlaintextSecrets logs warnings for environment variables that look like secrets in the task definition.
+func (d *App) warnPlaintextSecrets(td *TaskDefinitionInput) {
+	for _, c := range td.ContainerDefinitions {
+		for _, f := range plaintextSecretsOf(c) {
+			d.Log(fmt.Sprintf("WARNING: container %s: %s. use secrets instead of environment", aws.StringValue(c.Name), f))
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/ecs"
@@ -87,3 +88,16 @@ func formatScalableTarget(t *applicationautoscaling.ScalableTarget) string {
 func formatScalingPolicy(p *applicationautoscaling.ScalingPolicy) string {
 	return fmt.Sprintf("  Policy name:%s type:%s", *p.PolicyName, *p.PolicyType)
 }
+
+func formatScheduledAction(a *applicationautoscaling.ScheduledAction) string {
+	line := fmt.Sprintf("  Scheduled action name:%s schedule:%s timezone:%s", *a.ScheduledActionName, *a.Schedule, aws.StringValue(a.Timezone))
+	if t := a.ScalableTargetAction; t != nil {
+		if t.MinCapacity != nil {
+			line += fmt.Sprintf(" min:%d", *t.MinCapacity)
+		}
+		if t.MaxCapacity != nil {
+			line += fmt.Sprintf(" max:%d", *t.MaxCapacity)
+		}
+	}
+	return line
+}
@@ -0,0 +1,307 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/acmpca"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/pkg/errors"
+)
+
+const serviceConnectContainerPrefix = "ecs-service-connect-"
+
+// Service represents a service definition.
+// ecs.Service does not have serviceConnectConfiguration and volumeConfigurations because they are attributes of the deployments.
+type Service struct {
+	ecs.Service
+	ServiceConnectConfiguration *ecs.ServiceConnectConfiguration  `locationName:"serviceConnectConfiguration" type:"structure"`
+	VolumeConfigurations        []*ecs.ServiceVolumeConfiguration `locationName:"volumeConfigurations" type:"list"`
+}
+
+// newServiceFromRemote creates a Service from the running service.
+// serviceConnectConfiguration and volumeConfigurations are taken from the PRIMARY deployment.
+func newServiceFromRemote(sv *ecs.Service) *Service {
+	s := &Service{Service: *sv}
+	for _, dep := range sv.Deployments {
+		if aws.StringValue(dep.Status) == "PRIMARY" {
+			s.ServiceConnectConfiguration = dep.ServiceConnectConfiguration
+			s.VolumeConfigurations = dep.VolumeConfigurations
+			break
+		}
+	}
+	return s
+}
+
+func (s *Service) buildJSON() ([]byte, error) {
+	b, err := jsonutil.BuildJSON(&s.Service)
+	if err != nil {
+		return nil, err
+	}
+	if s.ServiceConnectConfiguration == nil && len(s.VolumeConfigurations) == 0 {
+		return b, nil
+	}
+	ext, err := jsonutil.BuildJSON(&struct {
+		_                           struct{}                          `type:"structure"`
+		ServiceConnectConfiguration *ecs.ServiceConnectConfiguration  `locationName:"serviceConnectConfiguration" type:"structure"`
+		VolumeConfigurations        []*ecs.ServiceVolumeConfiguration `locationName:"volumeConfigurations" type:"list"`
+	}{
+		ServiceConnectConfiguration: s.ServiceConnectConfiguration,
+		VolumeConfigurations:        s.VolumeConfigurations,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == "{}" {
+		return ext, nil
+	}
+	return append(append(b[:len(b)-1], ','), ext[1:]...), nil
+}
+
+func isServiceConnectEnabled(c *ecs.ServiceConnectConfiguration) bool {
+	return c != nil && aws.BoolValue(c.Enabled)
+}
+
+func (d *App) findNamespaceByName(ctx context.Context, name string) (*servicediscovery.NamespaceSummary, error) {
+	out, err := d.servicediscovery.ListNamespacesWithContext(ctx, &servicediscovery.ListNamespacesInput{
+		Filters: []*servicediscovery.NamespaceFilter{
+			{
+				Name:      aws.String(servicediscovery.NamespaceFilterNameName),
+				Condition: aws.String(servicediscovery.FilterConditionEq),
+				Values:    []*string{aws.String(name)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list namespaces")
+	}
+	for _, ns := range out.Namespaces {
+		if aws.StringValue(ns.Name) == name {
+			return ns, nil
+		}
+	}
+	return nil, errors.Errorf("namespace %s is not found", name)
+}
+
+// resolveServiceConnectNamespace replaces the namespace name in serviceConnectConfiguration by the ARN.
+// ECS returns the namespace as the ARN, so it is required to compare definitions.
+func (d *App) resolveServiceConnectNamespace(ctx context.Context, sv *Service) error {
+	sc := sv.ServiceConnectConfiguration
+	if sc == nil || sc.Namespace == nil || strings.HasPrefix(*sc.Namespace, "arn:") {
+		return nil
+	}
+	ns, err := d.findNamespaceByName(ctx, *sc.Namespace)
+	if err != nil {
+		return err
+	}
+	d.DebugLog("resolved service connect namespace", *sc.Namespace, "to", aws.StringValue(ns.Arn))
+	sc.Namespace = ns.Arn
+	return nil
+}
+
+func (d *App) verifyServiceConnect(ctx context.Context, sv *Service, td *TaskDefinitionInput) error {
+	sc := sv.ServiceConnectConfiguration
+	if ns := aws.StringValue(sc.Namespace); ns != "" {
+		err := d.verifyResource(ctx, fmt.Sprintf("ServiceConnect.Namespace[%s]", ns), func(ctx context.Context) error {
+			if !strings.HasPrefix(ns, "arn:") {
+				_, err := d.findNamespaceByName(ctx, ns)
+				return err
+			}
+			_, err := d.servicediscovery.GetNamespaceWithContext(ctx, &servicediscovery.GetNamespaceInput{
+				Id: aws.String(arnToName(ns)),
+			})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	portNames := make(map[string]bool)
+	for _, c := range td.ContainerDefinitions {
+		for _, pm := range c.PortMappings {
+			if pm.Name != nil {
+				portNames[*pm.Name] = true
+			}
+		}
+	}
+	for i, s := range sc.Services {
+		name := fmt.Sprintf("ServiceConnect.Services[%d]", i)
+		err := d.verifyResource(ctx, name, func(context.Context) error {
+			if pn := aws.StringValue(s.PortName); !portNames[pn] {
+				return errors.Errorf("portName %s is not defined in portMappings of the task definition", pn)
+			}
+			if s.Tls != nil {
+				return d.verifyServiceConnectTLS(ctx, s.Tls)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceConnectTLSActions are required to the role to issue certificates for Service Connect TLS.
+var serviceConnectTLSActions = []string{
+	"acm-pca:IssueCertificate",
+	"acm-pca:GetCertificate",
+	"acm-pca:DescribeCertificateAuthority",
+	"acm-pca:GetCertificateAuthorityCertificate",
+}
+
+func (d *App) verifyServiceConnectTLS(ctx context.Context, tls *ecs.ServiceConnectTlsConfiguration) error {
+	var pcaArn string
+	if ca := tls.IssuerCertificateAuthority; ca != nil {
+		pcaArn = aws.StringValue(ca.AwsPcaAuthorityArn)
+	}
+	if pcaArn == "" {
+		return errors.New("tls.issuerCertificateAuthority.awsPcaAuthorityArn is required")
+	}
+	err := d.verifyResource(ctx, fmt.Sprintf("PrivateCA[%s]", pcaArn), func(ctx context.Context) error {
+		out, err := d.verifier.acmpca.DescribeCertificateAuthorityWithContext(ctx, &acmpca.DescribeCertificateAuthorityInput{
+			CertificateAuthorityArn: aws.String(pcaArn),
+		})
+		if err != nil {
+			return err
+		}
+		if st := aws.StringValue(out.CertificateAuthority.Status); st != acmpca.CertificateAuthorityStatusActive {
+			return errors.Errorf("certificate authority status is %s", st)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if roleArn := aws.StringValue(tls.RoleArn); roleArn != "" {
+		err := d.verifyResource(ctx, fmt.Sprintf("TLSRole[%s]", roleArn), func(ctx context.Context) error {
+			if err := d.verifyRoleAssumedBy(ctx, roleArn, "ecs.amazonaws.com"); err != nil {
+				return err
+			}
+			out, err := d.iam.SimulatePrincipalPolicyWithContext(ctx, &iam.SimulatePrincipalPolicyInput{
+				PolicySourceArn: aws.String(roleArn),
+				ActionNames:     aws.StringSlice(serviceConnectTLSActions),
+				ResourceArns:    []*string{aws.String(pcaArn)},
+			})
+			if err != nil {
+				return err
+			}
+			for _, r := range out.EvaluationResults {
+				if aws.StringValue(r.EvalDecision) != iam.PolicyEvaluationDecisionTypeAllowed {
+					return errors.Errorf("%s is not allowed on %s (%s)", aws.StringValue(r.EvalActionName), pcaArn, aws.StringValue(r.EvalDecision))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if kmsKey := aws.StringValue(tls.KmsKey); kmsKey != "" {
+		err := d.verifyResource(ctx, fmt.Sprintf("KMSKey[%s]", kmsKey), func(ctx context.Context) error {
+			return d.verifyKMSKey(ctx, kmsKey, aws.StringValue(tls.RoleArn), serviceConnectTLSKMSActions)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatServiceConnectService(s *ecs.ServiceConnectService) string {
+	name := aws.StringValue(s.DiscoveryName)
+	if name == "" {
+		name = aws.StringValue(s.PortName)
+	}
+	aliases := make([]string, 0, len(s.ClientAliases))
+	for _, a := range s.ClientAliases {
+		if a.DnsName != nil {
+			aliases = append(aliases, fmt.Sprintf("%s:%d", *a.DnsName, aws.Int64Value(a.Port)))
+		} else {
+			aliases = append(aliases, fmt.Sprintf(":%d", aws.Int64Value(a.Port)))
+		}
+	}
+	return fmt.Sprintf("%s portName:%s clientAliases:[%s]", name, aws.StringValue(s.PortName), strings.Join(aliases, ","))
+}
+
+// describeServiceConnect shows the service connect configuration and health of the proxy containers.
+func (d *App) describeServiceConnect(ctx context.Context, w io.Writer, sv *ecs.Service) error {
+	sc := newServiceFromRemote(sv).ServiceConnectConfiguration
+	if !isServiceConnectEnabled(sc) {
+		return nil
+	}
+	fmt.Fprintln(w, "ServiceConnect:")
+	fmt.Fprintln(w, spcIndent+"Namespace: "+aws.StringValue(sc.Namespace))
+	for _, s := range sc.Services {
+		fmt.Fprintln(w, spcIndent+formatServiceConnectService(s))
+	}
+
+	tasks, err := d.listServiceTasks(ctx)
+	if err != nil {
+		return err
+	}
+	health := make(map[string]int)
+	for _, task := range tasks {
+		for _, c := range task.Containers {
+			if strings.HasPrefix(aws.StringValue(c.Name), serviceConnectContainerPrefix) {
+				health[aws.StringValue(c.HealthStatus)]++
+			}
+		}
+	}
+	if len(health) == 0 {
+		return nil
+	}
+	statuses := make([]string, 0, len(health))
+	for s := range health {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	hs := make([]string, 0, len(statuses))
+	for _, s := range statuses {
+		hs = append(hs, fmt.Sprintf("%s:%d", s, health[s]))
+	}
+	fmt.Fprintln(w, spcIndent+"Proxy: "+strings.Join(hs, " "))
+	return nil
+}
+
+func (d *App) listServiceTasks(ctx context.Context) ([]*ecs.Task, error) {
+	var arns []*string
+	err := d.ecs.ListTasksPagesWithContext(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(d.Cluster),
+		ServiceName:   aws.String(d.Service),
+		DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+	}, func(out *ecs.ListTasksOutput, lastPage bool) bool {
+		arns = append(arns, out.TaskArns...)
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tasks")
+	}
+	var tasks []*ecs.Task
+	// DescribeTasks accepts tasks less than 100
+	for i := 0; i < len(arns); i += 100 {
+		end := i + 100
+		if end > len(arns) {
+			end = len(arns)
+		}
+		out, err := d.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(d.Cluster),
+			Tasks:   arns[i:end],
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe tasks")
+		}
+		tasks = append(tasks, out.Tasks...)
+	}
+	return tasks, nil
+}
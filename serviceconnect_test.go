@@ -0,0 +1,103 @@
+package ecspresso_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestLoadServiceDefinitionServiceConnect(t *testing.T) {
+	c := &ecspresso.Config{
+		Region:                "ap-northeast-1",
+		Timeout:               600 * time.Second,
+		Service:               "test",
+		Cluster:               "default",
+		ServiceDefinitionPath: "tests/sv-service-connect.json",
+	}
+	if err := c.Restrict(); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := app.LoadServiceDefinition(c.ServiceDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := sv.ServiceConnectConfiguration
+	if sc == nil || !aws.BoolValue(sc.Enabled) || len(sc.Services) != 1 ||
+		aws.StringValue(sc.Services[0].PortName) != "http" ||
+		aws.Int64Value(sc.Services[0].ClientAliases[0].Port) != 80 ||
+		sc.Services[0].Tls == nil ||
+		aws.StringValue(sc.Services[0].Tls.RoleArn) != "arn:aws:iam::123456789012:role/ecsServiceConnectTLS" {
+		t.Errorf("unexpected serviceConnectConfiguration %s", sc)
+	}
+	if aws.StringValue(sv.LaunchType) != "FARGATE" {
+		t.Errorf("unexpected launchType %s", aws.StringValue(sv.LaunchType))
+	}
+
+	s := ecspresso.MarshalJSONString(sv)
+	for _, key := range []string{`"serviceConnectConfiguration"`, `"launchType"`, `"serviceName"`} {
+		if !strings.Contains(s, key) {
+			t.Errorf("%s is not found in %s", key, s)
+		}
+	}
+}
+
+func TestLoadServiceDefinitionVolumeConfigurations(t *testing.T) {
+	c := &ecspresso.Config{
+		Region:                "ap-northeast-1",
+		Timeout:               600 * time.Second,
+		Service:               "test",
+		Cluster:               "default",
+		ServiceDefinitionPath: "tests/sv-volume.json",
+	}
+	if err := c.Restrict(); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := app.LoadServiceDefinition(c.ServiceDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sv.VolumeConfigurations) != 1 {
+		t.Fatalf("unexpected volumeConfigurations %v", sv.VolumeConfigurations)
+	}
+	ebs := sv.VolumeConfigurations[0].ManagedEBSVolume
+	if ebs == nil || aws.StringValue(ebs.RoleArn) != "arn:aws:iam::123456789012:role/ecsInfrastructureRole" ||
+		aws.Int64Value(ebs.SizeInGiB) != 20 || !strings.HasPrefix(aws.StringValue(ebs.KmsKeyId), "arn:aws:kms:") {
+		t.Errorf("unexpected managedEBSVolume %s", ebs)
+	}
+
+	s := ecspresso.MarshalJSONString(sv)
+	for _, key := range []string{`"volumeConfigurations"`, `"managedEBSVolume"`, `"launchType"`} {
+		if !strings.Contains(s, key) {
+			t.Errorf("%s is not found in %s", key, s)
+		}
+	}
+}
+
+func TestNewServiceFromRemote(t *testing.T) {
+	sc := &ecs.ServiceConnectConfiguration{Enabled: aws.Bool(true)}
+	sv := ecspresso.NewServiceFromRemote(&ecs.Service{
+		ServiceName: aws.String("test"),
+		Deployments: []*ecs.Deployment{
+			{Status: aws.String("ACTIVE")},
+			{Status: aws.String("PRIMARY"), ServiceConnectConfiguration: sc},
+		},
+	})
+	if sv.ServiceConnectConfiguration != sc {
+		t.Errorf("serviceConnectConfiguration must be taken from the PRIMARY deployment")
+	}
+	if aws.StringValue(sv.ServiceName) != "test" {
+		t.Errorf("unexpected serviceName %s", aws.StringValue(sv.ServiceName))
+	}
+}
@@ -0,0 +1,232 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/pkg/errors"
+)
+
+// ServiceDiscoveryConfig represents a Cloud Map service registered to the ECS service.
+type ServiceDiscoveryConfig struct {
+	Name                    string                       `yaml:"name"`
+	NamespaceID             string                       `yaml:"namespace_id"`
+	Description             string                       `yaml:"description,omitempty"`
+	DNSRecords              []ServiceDiscoveryDNSRecord  `yaml:"dns_records,omitempty"`
+	RoutingPolicy           string                       `yaml:"routing_policy,omitempty"`
+	HealthCheckCustomConfig *ServiceDiscoveryHealthCheck `yaml:"health_check_custom_config,omitempty"`
+	ContainerName           string                       `yaml:"container_name,omitempty"`
+	ContainerPort           int64                        `yaml:"container_port,omitempty"`
+	Port                    int64                        `yaml:"port,omitempty"`
+}
+
+// ServiceDiscoveryDNSRecord represents a DNS record of a Cloud Map service.
+type ServiceDiscoveryDNSRecord struct {
+	Type string `yaml:"type"`
+	TTL  int64  `yaml:"ttl"`
+}
+
+// ServiceDiscoveryHealthCheck represents a custom health check of a Cloud Map service.
+type ServiceDiscoveryHealthCheck struct {
+	FailureThreshold int64 `yaml:"failure_threshold,omitempty"`
+}
+
+func (c *ServiceDiscoveryConfig) dnsRecords() []*servicediscovery.DnsRecord {
+	records := make([]*servicediscovery.DnsRecord, 0, len(c.DNSRecords))
+	for _, r := range c.DNSRecords {
+		records = append(records, &servicediscovery.DnsRecord{
+			Type: aws.String(r.Type),
+			TTL:  aws.Int64(r.TTL),
+		})
+	}
+	return records
+}
+
+func (c *ServiceDiscoveryConfig) createServiceInput() *servicediscovery.CreateServiceInput {
+	in := &servicediscovery.CreateServiceInput{
+		Name:        aws.String(c.Name),
+		NamespaceId: aws.String(c.NamespaceID),
+	}
+	if c.Description != "" {
+		in.Description = aws.String(c.Description)
+	}
+	if len(c.DNSRecords) > 0 {
+		in.DnsConfig = &servicediscovery.DnsConfig{
+			DnsRecords: c.dnsRecords(),
+		}
+		if c.RoutingPolicy != "" {
+			in.DnsConfig.RoutingPolicy = aws.String(c.RoutingPolicy)
+		}
+	}
+	if hc := c.HealthCheckCustomConfig; hc != nil {
+		in.HealthCheckCustomConfig = &servicediscovery.HealthCheckCustomConfig{}
+		if hc.FailureThreshold > 0 {
+			in.HealthCheckCustomConfig.FailureThreshold = aws.Int64(hc.FailureThreshold)
+		}
+	}
+	return in
+}
+
+func (c *ServiceDiscoveryConfig) validate() error {
+	if c.Name == "" {
+		return errors.New("service_discovery name is required")
+	}
+	if c.NamespaceID == "" {
+		return errors.Errorf("service_discovery %s namespace_id is required", c.Name)
+	}
+	for _, r := range c.DNSRecords {
+		switch r.Type {
+		case servicediscovery.RecordTypeA, servicediscovery.RecordTypeAaaa, servicediscovery.RecordTypeSrv:
+		default:
+			return errors.Errorf("service_discovery %s has unsupported dns record type %s", c.Name, r.Type)
+		}
+	}
+	return nil
+}
+
+func (d *App) findServiceDiscoveryService(ctx context.Context, c *ServiceDiscoveryConfig) (*servicediscovery.ServiceSummary, error) {
+	var found *servicediscovery.ServiceSummary
+	err := d.servicediscovery.ListServicesPagesWithContext(ctx, &servicediscovery.ListServicesInput{
+		Filters: []*servicediscovery.ServiceFilter{
+			{
+				Name:      aws.String(servicediscovery.ServiceFilterNameNamespaceId),
+				Condition: aws.String(servicediscovery.FilterConditionEq),
+				Values:    []*string{aws.String(c.NamespaceID)},
+			},
+		},
+	}, func(out *servicediscovery.ListServicesOutput, lastPage bool) bool {
+		for _, s := range out.Services {
+			if aws.StringValue(s.Name) == c.Name {
+				found = s
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list service discovery services")
+	}
+	return found, nil
+}
+
+// ensureServiceDiscovery creates or updates the Cloud Map service and returns the ARN of it.
+// When dryRun is true, it does not create or update any resources and returns empty ARN for the service that does not exist yet.
+func (d *App) ensureServiceDiscovery(ctx context.Context, c *ServiceDiscoveryConfig, dryRun bool) (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	s, err := d.findServiceDiscoveryService(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		in := c.createServiceInput()
+		if dryRun {
+			d.Log("create service discovery service input:")
+			d.LogJSON(in)
+			return "", nil
+		}
+		d.Log("Creating service discovery service", c.Name)
+		out, err := d.servicediscovery.CreateServiceWithContext(ctx, in)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to create service discovery service %s", c.Name)
+		}
+		return aws.StringValue(out.Service.Arn), nil
+	}
+
+	if c.HealthCheckCustomConfig != nil && s.HealthCheckCustomConfig == nil ||
+		c.HealthCheckCustomConfig == nil && s.HealthCheckCustomConfig != nil {
+		d.Log(fmt.Sprintf("WARNING: health_check_custom_config of service discovery service %s can not be changed after created", c.Name))
+	}
+	if len(c.DNSRecords) > 0 && s.DnsConfig != nil && !reflect.DeepEqual(c.dnsRecords(), s.DnsConfig.DnsRecords) {
+		in := &servicediscovery.UpdateServiceInput{
+			Id: s.Id,
+			Service: &servicediscovery.ServiceChange{
+				DnsConfig: &servicediscovery.DnsConfigChange{
+					DnsRecords: c.dnsRecords(),
+				},
+			},
+		}
+		if c.Description != "" {
+			in.Service.Description = aws.String(c.Description)
+		}
+		if dryRun {
+			d.Log("update service discovery service input:")
+			d.LogJSON(in)
+		} else {
+			d.Log("Updating service discovery service", c.Name)
+			if _, err := d.servicediscovery.UpdateServiceWithContext(ctx, in); err != nil {
+				return "", errors.Wrapf(err, "failed to update service discovery service %s", c.Name)
+			}
+		}
+	}
+	return aws.StringValue(s.Arn), nil
+}
+
+// resolveServiceRegistries ensures the Cloud Map services defined in the config, and adds them to serviceRegistries of the service definition.
+func (d *App) resolveServiceRegistries(ctx context.Context, sv *ecs.Service, dryRun bool) error {
+	for i := range d.config.ServiceDiscovery {
+		c := &d.config.ServiceDiscovery[i]
+		arn, err := d.ensureServiceDiscovery(ctx, c, dryRun)
+		if err != nil {
+			return err
+		}
+		if arn == "" {
+			continue // will be created
+		}
+		var registered bool
+		for _, r := range sv.ServiceRegistries {
+			if aws.StringValue(r.RegistryArn) == arn {
+				registered = true
+				break
+			}
+		}
+		if registered {
+			continue
+		}
+		r := &ecs.ServiceRegistry{RegistryArn: aws.String(arn)}
+		if c.ContainerName != "" {
+			r.ContainerName = aws.String(c.ContainerName)
+		}
+		if c.ContainerPort > 0 {
+			r.ContainerPort = aws.Int64(c.ContainerPort)
+		}
+		if c.Port > 0 {
+			r.Port = aws.Int64(c.Port)
+		}
+		sv.ServiceRegistries = append(sv.ServiceRegistries, r)
+	}
+	return nil
+}
+
+// waitServiceDiscoveryInstancesDeregistered waits for all instances in the Cloud Map services are deregistered.
+func (d *App) waitServiceDiscoveryInstancesDeregistered(ctx context.Context, registries []*ecs.ServiceRegistry) error {
+	for _, r := range registries {
+		id := arnToName(aws.StringValue(r.RegistryArn))
+		d.Log("Waiting for instances in service discovery service", id, "are deregistered")
+		for {
+			out, err := d.servicediscovery.ListInstancesWithContext(ctx, &servicediscovery.ListInstancesInput{
+				ServiceId: aws.String(id),
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to list instances of service discovery service %s", id)
+			}
+			if len(out.Instances) == 0 {
+				d.Log("All instances in service discovery service", id, "are deregistered")
+				break
+			}
+			d.Log(fmt.Sprintf("%d instances are still registered", len(out.Instances)))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}
+	return nil
+}
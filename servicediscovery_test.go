@@ -0,0 +1,39 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestLoadConfigServiceDiscovery(t *testing.T) {
+	conf := &ecspresso.Config{}
+	if err := conf.Load("tests/service_discovery.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.ServiceDiscovery) != 1 {
+		t.Fatalf("unexpected service_discovery %#v", conf.ServiceDiscovery)
+	}
+	c := conf.ServiceDiscovery[0]
+	if c.Name != "test" || c.NamespaceID != "ns-xxxxxxxxxxxxxxxx" ||
+		len(c.DNSRecords) != 2 || c.DNSRecords[1].Type != "SRV" || c.DNSRecords[1].TTL != 60 ||
+		c.HealthCheckCustomConfig == nil || c.HealthCheckCustomConfig.FailureThreshold != 1 ||
+		c.ContainerName != "app" || c.ContainerPort != 80 {
+		t.Errorf("unexpected service_discovery %#v", c)
+	}
+	if err := ecspresso.ValidateServiceDiscovery(&c); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateServiceDiscovery(t *testing.T) {
+	for _, c := range []ecspresso.ServiceDiscoveryConfig{
+		{NamespaceID: "ns-xxxxxxxxxxxxxxxx"},
+		{Name: "test"},
+		{Name: "test", NamespaceID: "ns-xxxxxxxxxxxxxxxx", DNSRecords: []ecspresso.ServiceDiscoveryDNSRecord{{Type: "CNAME", TTL: 60}}},
+	} {
+		if err := ecspresso.ValidateServiceDiscovery(&c); err == nil {
+			t.Errorf("must be invalid %#v", c)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package ecspresso
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+)
+
+const defaultAssumeRoleSessionName = "ecspresso"
+
+// endpointEnvPrefix is a prefix of environment variables to override endpoints. e.g. ECSPRESSO_ENDPOINT_ECS
+const endpointEnvPrefix = "ECSPRESSO_ENDPOINT_"
+
+// endpointServiceIDs maps names of endpoints in the config to IDs of the service endpoints in the AWS SDK.
+// Other names are used as IDs as is. (e.g. sts, iam, s3)
+var endpointServiceIDs = map[string]string{
+	"ecr":                     "api.ecr",
+	"elbv2":                   "elasticloadbalancing",
+	"application_autoscaling": "application-autoscaling",
+	"cloudwatch_logs":         "logs",
+}
+
+// AWSConfig represents a configuration of the AWS session.
+type AWSConfig struct {
+	AssumeRoleArn string        `yaml:"assume_role_arn,omitempty"`
+	ExternalID    string        `yaml:"external_id,omitempty"`
+	SessionName   string        `yaml:"session_name,omitempty"`
+	Duration      time.Duration `yaml:"duration,omitempty"`
+	MFASerial     string        `yaml:"mfa_serial,omitempty"`
+	SSOLogin      bool          `yaml:"sso_login,omitempty"`
+	// CredentialsExpiry is warn (default), error or ignore for credentials expiring before the timeout of deploy.
+	CredentialsExpiry string `yaml:"credentials_expiry,omitempty"`
+
+	Endpoints map[string]string `yaml:"endpoints,omitempty"`
+	Retry     *AWSRetryConfig   `yaml:"retry,omitempty"`
+}
+
+func (c *AWSConfig) validate() error {
+	if c.Retry != nil {
+		if err := c.Retry.validate(); err != nil {
+			return err
+		}
+	}
+	for name, u := range c.Endpoints {
+		if u == "" {
+			return errors.Errorf("aws.endpoints.%s is empty", name)
+		}
+	}
+	switch c.CredentialsExpiry {
+	case "", CredentialsExpiryWarn, CredentialsExpiryError, CredentialsExpiryIgnore:
+	default:
+		return errors.Errorf("aws.credentials_expiry must be %s, %s or %s: %s", CredentialsExpiryWarn, CredentialsExpiryError, CredentialsExpiryIgnore, c.CredentialsExpiry)
+	}
+	if c.AssumeRoleArn == "" {
+		if c.ExternalID != "" || c.SessionName != "" || c.Duration != 0 || c.MFASerial != "" {
+			return errors.New("aws.assume_role_arn is required")
+		}
+		return nil
+	}
+	if c.Duration != 0 && (c.Duration < 15*time.Minute || c.Duration > 12*time.Hour) {
+		return errors.Errorf("aws.duration must be between 15m and 12h: %s", c.Duration)
+	}
+	return nil
+}
+
+// withAssumeRole returns a copy of the config which assumes the role instead of assume_role_arn.
+// external_id is dropped because it is specific to the trust policy of the role in the config.
+func (c *AWSConfig) withAssumeRole(arn string) *AWSConfig {
+	n := &AWSConfig{}
+	if c != nil {
+		*n = *c
+	}
+	n.AssumeRoleArn = arn
+	n.ExternalID = ""
+	return n
+}
+
+func (c *AWSConfig) sessionName() string {
+	if c.SessionName != "" {
+		return c.SessionName
+	}
+	return defaultAssumeRoleSessionName
+}
+
+// newSession creates a new AWS session.
+// When the profile uses AWS SSO, the SSO session is checked in advance.
+// When the assume role is configured, the session uses credentials of the assumed role.
+// The MFA token code is prompted on the first use of the credentials.
+func newSession(region string, c *AWSConfig) (*session.Session, error) {
+	sess, _, err := newSessionWithSource(region, c)
+	return sess, err
+}
+
+// newSessionWithSource creates a new AWS session, and returns the credentials of the session before assuming the role.
+func newSessionWithSource(region string, c *AWSConfig) (*session.Session, *credentials.Credentials, error) {
+	config := aws.Config{Region: aws.String(region)}
+	var configEndpoints map[string]string
+	var retry *AWSRetryConfig
+	if c != nil {
+		configEndpoints = c.Endpoints
+		retry = c.Retry
+	}
+	applyRetryConfig(&config, retry)
+	if eps := resolveEndpoints(configEndpoints, os.Environ()); len(eps) > 0 {
+		config.EndpointResolver = endpointResolver(eps)
+		if _, ok := eps["s3"]; ok {
+			// S3 compatible endpoints (e.g. LocalStack) require path style addressing
+			config.S3ForcePathStyle = aws.Bool(true)
+		}
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	setupRateLimit(sess, retry)
+	if err := checkSSOSession(sess, c != nil && c.SSOLogin); err != nil {
+		return nil, nil, err
+	}
+	if c == nil || c.AssumeRoleArn == "" {
+		return sess, sess.Config.Credentials, nil
+	}
+	creds := stscreds.NewCredentials(sess, c.AssumeRoleArn, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = c.sessionName()
+		p.ExpiryWindow = assumeRoleExpiryWindow
+		if c.ExternalID != "" {
+			p.ExternalID = aws.String(c.ExternalID)
+		}
+		if c.Duration != 0 {
+			p.Duration = c.Duration
+		}
+		if c.MFASerial != "" {
+			p.SerialNumber = aws.String(c.MFASerial)
+			p.TokenProvider = stscreds.StdinTokenProvider
+		}
+	})
+	return sess.Copy(&aws.Config{Credentials: creds}), sess.Config.Credentials, nil
+}
+
+// resolveEndpoints returns URLs of the endpoints keyed by the service endpoint IDs.
+// ECSPRESSO_ENDPOINT_{NAME} environment variables take precedence over the config.
+func resolveEndpoints(config map[string]string, environ []string) map[string]string {
+	eps := map[string]string{}
+	for name, u := range config {
+		eps[endpointServiceID(name)] = u
+	}
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, endpointEnvPrefix) {
+			continue
+		}
+		p := strings.SplitN(strings.TrimPrefix(kv, endpointEnvPrefix), "=", 2)
+		if len(p) != 2 || p[1] == "" {
+			continue
+		}
+		eps[endpointServiceID(strings.ToLower(p[0]))] = p[1]
+	}
+	return eps
+}
+
+func endpointServiceID(name string) string {
+	if id, ok := endpointServiceIDs[name]; ok {
+		return id
+	}
+	return strings.Replace(name, "_", "-", -1)
+}
+
+func endpointResolver(eps map[string]string) endpoints.ResolverFunc {
+	return func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if u, ok := eps[service]; ok {
+			return endpoints.ResolvedEndpoint{
+				URL:           u,
+				SigningRegion: region,
+			}, nil
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	}
+}
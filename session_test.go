@@ -0,0 +1,60 @@
+package ecspresso_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestResolveEndpoints(t *testing.T) {
+	config := map[string]string{
+		"ecs":                     "http://localhost:4566",
+		"ecr":                     "http://localhost:4566",
+		"application_autoscaling": "http://localhost:4566",
+		"sts":                     "http://localhost:4566",
+	}
+	environ := []string{
+		"HOME=/root",
+		"ECSPRESSO_ENDPOINT_ECS=http://localhost:5000",
+		"ECSPRESSO_ENDPOINT_ELBV2=http://localhost:5000",
+		"ECSPRESSO_ENDPOINT_CLOUDWATCH_LOGS=http://localhost:5000",
+		"ECSPRESSO_ENDPOINT_CODEDEPLOY=",
+	}
+	eps := ecspresso.ResolveEndpoints(config, environ)
+	expected := map[string]string{
+		"ecs":                     "http://localhost:5000",
+		"api.ecr":                 "http://localhost:4566",
+		"application-autoscaling": "http://localhost:4566",
+		"sts":                     "http://localhost:4566",
+		"elasticloadbalancing":    "http://localhost:5000",
+		"logs":                    "http://localhost:5000",
+	}
+	if !reflect.DeepEqual(eps, expected) {
+		t.Errorf("unexpected endpoints %v expected %v", eps, expected)
+	}
+}
+
+func TestAssumeRoleArnOverridesConfig(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	conf.AssumeRoleArn = "arn:aws:iam::210987654321:role/admin"
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if conf.AWS == nil || conf.AWS.AssumeRoleArn != "arn:aws:iam::210987654321:role/admin" {
+		t.Errorf("assume role must be overridden %#v", conf.AWS)
+	}
+
+	c := &ecspresso.AWSConfig{
+		AssumeRoleArn: "arn:aws:iam::123456789012:role/deploy",
+		ExternalID:    "ext",
+		SessionName:   "ci",
+	}
+	o := c.WithAssumeRole("arn:aws:iam::210987654321:role/admin")
+	if o.AssumeRoleArn != "arn:aws:iam::210987654321:role/admin" || o.ExternalID != "" || o.SessionName != "ci" {
+		t.Errorf("unexpected config %#v", o)
+	}
+	if c.AssumeRoleArn != "arn:aws:iam::123456789012:role/deploy" {
+		t.Error("original config must not be changed")
+	}
+}
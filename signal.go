@@ -0,0 +1,86 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Songmu/prompter"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/mattn/go-isatty"
+)
+
+// ExitCodeInterrupted is the exit status of the command interrupted by signals.
+const ExitCodeInterrupted = 130
+
+const abortCodeDeployTimeout = 30 * time.Second
+
+type interruptContextKey struct{}
+
+// handleSignals returns the context canceled by SIGINT or SIGTERM.
+// The second signal terminates the process immediately by the default behavior.
+func (d *App) handleSignals(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	ctx = context.WithValue(ctx, interruptContextKey{}, ctx)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigCh:
+			signal.Stop(sigCh)
+			atomic.StoreInt32(&d.interrupted, 1)
+			d.Log(fmt.Sprintf("Received %s. Stopping... (send again to exit immediately)", sig))
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigCh)
+		cancel()
+	}
+}
+
+// interruptContextOf returns the context canceled only by signals, without timeouts derived from it.
+// It returns the background context when signals are not handled.
+func interruptContextOf(ctx context.Context) context.Context {
+	if c, ok := ctx.Value(interruptContextKey{}).(context.Context); ok {
+		return c
+	}
+	return context.Background()
+}
+
+// Interrupted reports whether the command was interrupted by signals.
+func (d *App) Interrupted() bool {
+	return atomic.LoadInt32(&d.interrupted) == 1
+}
+
+// abortCodeDeployOnInterrupt asks whether to stop the CodeDeploy deployment after interrupted.
+// The deployment is left as is when the standard input is not a terminal.
+func (d *App) abortCodeDeployOnInterrupt(id string) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		d.Log("Deployment", id, "is still in progress on CodeDeploy")
+		return
+	}
+	if !prompter.YN(fmt.Sprintf("Stop the deployment %s on CodeDeploy?", id), false) {
+		d.Log("Deployment", id, "is still in progress on CodeDeploy")
+		return
+	}
+	// the context of the command was canceled already
+	ctx, cancel := context.WithTimeout(context.Background(), abortCodeDeployTimeout)
+	defer cancel()
+	d.Log("Stopping the deployment", id)
+	out, err := d.codedeploy.StopDeploymentWithContext(ctx, &codedeploy.StopDeploymentInput{
+		DeploymentId:        aws.String(id),
+		AutoRollbackEnabled: aws.Bool(true),
+	})
+	if err != nil {
+		d.Log("WARNING: failed to stop the deployment", id, err)
+		return
+	}
+	d.Log("Deployment", id, aws.StringValue(out.Status), aws.StringValue(out.StatusMessage))
+}
@@ -0,0 +1,57 @@
+package ecspresso_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestStartCanceledBySignal(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	app, err := ecspresso.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := app.Start()
+	defer cancel()
+	if app.Interrupted() {
+		t.Error("must not be interrupted before signals")
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not canceled by SIGINT")
+	}
+	if !app.Interrupted() {
+		t.Error("must be interrupted after SIGINT")
+	}
+}
+
+func TestInterruptContextOfTimedOutContext(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Millisecond
+	app, err := ecspresso.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := app.Start()
+	<-ctx.Done()
+	root := ecspresso.InterruptContextOf(ctx)
+	if root.Err() != nil {
+		t.Errorf("the context of signals must not be canceled by the timeout: %s", root.Err())
+	}
+	cancel()
+	if root.Err() == nil {
+		t.Error("the context of signals must be canceled after the command finished")
+	}
+}
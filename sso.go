@@ -0,0 +1,116 @@
+package ecspresso
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sso"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+)
+
+// currentProfile returns the name of the shared config profile used by the AWS SDK.
+func currentProfile() string {
+	for _, name := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE"} {
+		if p := os.Getenv(name); p != "" {
+			return p
+		}
+	}
+	return "default"
+}
+
+func sharedConfigFilename() string {
+	if f := os.Getenv("AWS_CONFIG_FILE"); f != "" {
+		return f
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", "config")
+}
+
+// isSSOProfile reports whether the profile in the shared config file uses AWS SSO (IAM Identity Center).
+func isSSOProfile(filename, profile string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	section := "profile " + profile
+	if profile == "default" {
+		section = "default"
+	}
+	var inSection bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(strings.Trim(line, "[]"))
+			inSection = name == section || (profile == "default" && name == "profile default")
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		key := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+		if key == "sso_start_url" || key == "sso_session" {
+			return true
+		}
+	}
+	return false
+}
+
+// isSSOSessionExpired reports whether the error is caused by an expired or invalid SSO session.
+func isSSOSessionExpired(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case ssocreds.ErrCodeSSOProviderInvalidToken, sso.ErrCodeUnauthorizedException:
+			return true
+		}
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "cached SSO token is expired") || strings.Contains(msg, "refresh cached SSO token failed")
+}
+
+// checkSSOSession retrieves credentials of the SSO profile in advance to detect the expired session.
+// When login is true, it runs `aws sso login` and retries.
+func checkSSOSession(sess *session.Session, login bool) error {
+	profile := currentProfile()
+	if !isSSOProfile(sharedConfigFilename(), profile) {
+		return nil
+	}
+	_, err := sess.Config.Credentials.Get()
+	if err == nil || !isSSOSessionExpired(err) {
+		// other errors are reported by the following API calls
+		return nil
+	}
+	loginCommand := fmt.Sprintf("aws sso login --profile %s", profile)
+	if !login {
+		return errors.Errorf(
+			"AWS SSO session of profile %s has expired or is invalid. run `%s`, or set aws.sso_login: true to run it automatically",
+			profile, loginCommand,
+		)
+	}
+	fmt.Fprintln(os.Stderr, color.YellowString("AWS SSO session of profile %s has expired. running `%s`", profile, loginCommand))
+	cmd := exec.Command("aws", "sso", "login", "--profile", profile)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "failed to run `%s`", loginCommand)
+	}
+	sess.Config.Credentials.Expire()
+	if _, err := sess.Config.Credentials.Get(); err != nil {
+		return errors.Wrap(err, "failed to retrieve credentials after SSO login")
+	}
+	return nil
+}
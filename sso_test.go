@@ -0,0 +1,45 @@
+package ecspresso_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/kayac/ecspresso"
+)
+
+func TestIsSSOProfile(t *testing.T) {
+	for profile, expected := range map[string]bool{
+		"default":     false,
+		"sso":         true,
+		"sso-session": true,
+		"static":      false,
+		"my-sso":      false,
+		"unknown":     false,
+	} {
+		if got := ecspresso.IsSSOProfile("tests/aws_config", profile); got != expected {
+			t.Errorf("profile %s: expected %v got %v", profile, expected, got)
+		}
+	}
+	if ecspresso.IsSSOProfile("tests/not_found", "sso") {
+		t.Error("must be false for a missing config file")
+	}
+}
+
+func TestIsSSOSessionExpired(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{awserr.New("SSOProviderInvalidToken", "the SSO session has expired or is invalid", nil), true},
+		{awserr.New("UnauthorizedException", "Session token not found or invalid", nil), true},
+		{errors.New("refresh cached SSO token failed, unable to refresh SSO token"), true},
+		{awserr.New("AccessDeniedException", "access denied", nil), false},
+		{errors.New("NoCredentialProviders: no valid providers in chain"), false},
+	}
+	for _, c := range cases {
+		if got := ecspresso.IsSSOSessionExpired(c.err); got != c.expected {
+			t.Errorf("%s: expected %v got %v", c.err, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package ecspresso
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Songmu/prompter"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso/registry"
+	"github.com/pkg/errors"
+)
+
+type CleanupOption struct {
+	DryRun                *bool
+	TaskDefinitions       *bool
+	LogStreamsDays        *int64
+	ECRUntaggedImages     *bool
+	ECRUntaggedImagesDays *int64
+	Force                 *bool
+}
+
+func (opt CleanupOption) DryRunString() string {
+	if aws.BoolValue(opt.DryRun) {
+		return dryRunStr
+	}
+	return ""
+}
+
+// ecrRepository represents an ECR repository used by containers.
+type ecrRepository struct {
+	registryID string
+	name       string
+}
+
+func (r ecrRepository) String() string {
+	return r.registryID + "/" + r.name
+}
+
+// stalePlan represents stale resources of the service to be deleted by cleanup.
+type stalePlan struct {
+	taskDefinitions []string
+	logStreams      map[string][]string
+	ecrImages       map[ecrRepository][]*ecr.ImageIdentifier
+}
+
+func (p *stalePlan) empty() bool {
+	return len(p.taskDefinitions) == 0 && len(p.logStreams) == 0 && len(p.ecrImages) == 0
+}
+
+func (d *App) logStalePlan(p *stalePlan) {
+	if p.empty() {
+		d.Log("No stale resources to clean up")
+		return
+	}
+	d.Log("Stale resources below will be deleted")
+	for _, name := range p.taskDefinitions {
+		d.Log("  INACTIVE task definition:", arnToName(name))
+	}
+	for _, group := range sortedKeys(p.logStreams) {
+		d.Log(fmt.Sprintf("  log streams in %s: %d streams", group, len(p.logStreams[group])))
+	}
+	repos := make([]ecrRepository, 0, len(p.ecrImages))
+	for r := range p.ecrImages {
+		repos = append(repos, r)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].String() < repos[j].String() })
+	for _, r := range repos {
+		d.Log(fmt.Sprintf("  untagged images in ECR repository %s: %d images", r, len(p.ecrImages[r])))
+	}
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ecrRepositoryOf returns the ECR repository of the image.
+func ecrRepositoryOf(image string) (ecrRepository, bool) {
+	if !ecrImageURLRegex.MatchString(image) {
+		return ecrRepository{}, false
+	}
+	name := ecrRepositoryNameOf(image)
+	if name == "" {
+		return ecrRepository{}, false
+	}
+	return ecrRepository{
+		registryID: strings.SplitN(image, ".", 2)[0],
+		name:       name,
+	}, true
+}
+
+// Cleanup deletes stale resources of the service.
+func (d *App) Cleanup(opt CleanupOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+	d.Log("Starting cleanup", opt.DryRunString())
+
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to load task definition")
+	}
+	p, err := d.buildStalePlan(ctx, td, opt)
+	if err != nil {
+		return errors.Wrap(err, "failed to build cleanup plan")
+	}
+	d.logStalePlan(p)
+	if p.empty() {
+		return nil
+	}
+	if aws.BoolValue(opt.DryRun) {
+		d.Log("DRY RUN OK")
+		return nil
+	}
+	if !aws.BoolValue(opt.Force) && !prompter.YesNo("Delete the stale resources?", false) {
+		d.Log("Aborted")
+		return errConfirmationFailed
+	}
+	if err := d.deleteStaleResources(ctx, p); err != nil {
+		return err
+	}
+	d.Log("Cleanup completed!")
+	return nil
+}
+
+func (d *App) buildStalePlan(ctx context.Context, td *TaskDefinitionInput, opt CleanupOption) (*stalePlan, error) {
+	p := &stalePlan{
+		logStreams: map[string][]string{},
+		ecrImages:  map[ecrRepository][]*ecr.ImageIdentifier{},
+	}
+	if aws.BoolValue(opt.TaskDefinitions) {
+		arns, err := d.inactiveTaskDefinitions(ctx, aws.StringValue(td.Family))
+		if err != nil {
+			return nil, err
+		}
+		p.taskDefinitions = arns
+	}
+	if days := aws.Int64Value(opt.LogStreamsDays); days > 0 {
+		threshold := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+		for _, group := range logGroupsOf(td) {
+			streams, err := d.staleLogStreams(ctx, group, threshold)
+			if err != nil {
+				return nil, err
+			}
+			if len(streams) > 0 {
+				p.logStreams[group] = streams
+			}
+		}
+	}
+	if aws.BoolValue(opt.ECRUntaggedImages) {
+		var repos []ecrRepository
+		seen := map[ecrRepository]bool{}
+		for _, c := range td.ContainerDefinitions {
+			repo, ok := ecrRepositoryOf(aws.StringValue(c.Image))
+			if !ok || seen[repo] {
+				continue
+			}
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+		if len(repos) > 0 {
+			inUse, err := d.imageDigestsInUse(ctx)
+			if err != nil {
+				return nil, err
+			}
+			threshold := time.Now().Add(-time.Duration(aws.Int64Value(opt.ECRUntaggedImagesDays)) * 24 * time.Hour)
+			for _, repo := range repos {
+				ids, err := d.untaggedImages(ctx, repo, threshold, inUse)
+				if err != nil {
+					return nil, err
+				}
+				if len(ids) > 0 {
+					p.ecrImages[repo] = ids
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+func (d *App) inactiveTaskDefinitions(ctx context.Context, family string) ([]string, error) {
+	var arns []string
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListTaskDefinitionsWithContext(ctx, &ecs.ListTaskDefinitionsInput{
+			FamilyPrefix: aws.String(family),
+			Status:       aws.String(ecs.TaskDefinitionStatusInactive),
+			NextToken:    nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list inactive task definitions")
+		}
+		arns = append(arns, aws.StringValueSlice(out.TaskDefinitionArns)...)
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+	return arns, nil
+}
+
+// staleLogStreams returns names of log streams which have no events after the threshold.
+func (d *App) staleLogStreams(ctx context.Context, group string, threshold time.Time) ([]string, error) {
+	var names []string
+	var nextToken *string
+	thresholdMs := threshold.UnixNano() / int64(time.Millisecond)
+	for {
+		out, err := d.cwl.DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+			LogGroupName: aws.String(group),
+			OrderBy:      aws.String(cloudwatchlogs.OrderByLastEventTime),
+			Descending:   aws.Bool(false),
+			NextToken:    nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to describe log streams in %s", group)
+		}
+		for _, s := range out.LogStreams {
+			last := aws.Int64Value(s.LastEventTimestamp)
+			if last == 0 {
+				last = aws.Int64Value(s.CreationTime)
+			}
+			if last >= thresholdMs {
+				// sorted by the last event time
+				return names, nil
+			}
+			names = append(names, aws.StringValue(s.LogStreamName))
+		}
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+	return names, nil
+}
+
+// imageDigestsInUse returns digests of images referred by ACTIVE task definitions (image@sha256:...)
+// and pulled by running tasks in the cluster.
+func (d *App) imageDigestsInUse(ctx context.Context) (map[string]bool, error) {
+	digests := map[string]bool{}
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListTaskDefinitionsWithContext(ctx, &ecs.ListTaskDefinitionsInput{
+			Status:    aws.String(ecs.TaskDefinitionStatusActive),
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list active task definitions")
+		}
+		for _, arn := range out.TaskDefinitionArns {
+			td, err := d.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+				TaskDefinition: arn,
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to describe task definition %s", aws.StringValue(arn))
+			}
+			for _, c := range td.TaskDefinition.ContainerDefinitions {
+				if _, tag := splitImageTag(aws.StringValue(c.Image)); registry.IsDigest(tag) {
+					digests[tag] = true
+				}
+			}
+		}
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+
+	var arns []*string
+	err := d.ecs.ListTasksPagesWithContext(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(d.Cluster),
+		DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+	}, func(out *ecs.ListTasksOutput, lastPage bool) bool {
+		arns = append(arns, out.TaskArns...)
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tasks")
+	}
+	// DescribeTasks accepts tasks less than 100
+	for i := 0; i < len(arns); i += 100 {
+		end := i + 100
+		if end > len(arns) {
+			end = len(arns)
+		}
+		out, err := d.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(d.Cluster),
+			Tasks:   arns[i:end],
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe tasks")
+		}
+		for _, t := range out.Tasks {
+			for _, c := range t.Containers {
+				if dg := aws.StringValue(c.ImageDigest); dg != "" {
+					digests[dg] = true
+				}
+			}
+		}
+	}
+	return digests, nil
+}
+
+// untaggedImages returns untagged images in the repository pushed before the threshold.
+// Images in use and images referred by manifest lists which are tagged or in use are excluded.
+func (d *App) untaggedImages(ctx context.Context, repo ecrRepository, threshold time.Time, inUse map[string]bool) ([]*ecr.ImageIdentifier, error) {
+	var images []*ecr.ImageDetail
+	err := d.ecr.DescribeImagesPagesWithContext(ctx, &ecr.DescribeImagesInput{
+		RegistryId:     aws.String(repo.registryID),
+		RepositoryName: aws.String(repo.name),
+	}, func(out *ecr.DescribeImagesOutput, lastPage bool) bool {
+		images = append(images, out.ImageDetails...)
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe images in %s", repo)
+	}
+
+	protected := map[string]bool{}
+	var lists []*ecr.ImageIdentifier
+	for _, img := range images {
+		digest := aws.StringValue(img.ImageDigest)
+		if len(img.ImageTags) == 0 && !inUse[digest] {
+			continue
+		}
+		protected[digest] = true
+		if isManifestListMediaType(aws.StringValue(img.ImageManifestMediaType)) {
+			lists = append(lists, &ecr.ImageIdentifier{ImageDigest: img.ImageDigest})
+		}
+	}
+	children, err := d.manifestListChildren(ctx, repo, lists)
+	if err != nil {
+		return nil, err
+	}
+	for _, digest := range children {
+		protected[digest] = true
+	}
+
+	var ids []*ecr.ImageIdentifier
+	for _, img := range images {
+		digest := aws.StringValue(img.ImageDigest)
+		if len(img.ImageTags) > 0 || protected[digest] {
+			continue
+		}
+		if img.ImagePushedAt != nil && img.ImagePushedAt.After(threshold) {
+			continue
+		}
+		ids = append(ids, &ecr.ImageIdentifier{ImageDigest: img.ImageDigest})
+	}
+	return ids, nil
+}
+
+func isManifestListMediaType(mediaType string) bool {
+	return mediaType == "application/vnd.docker.distribution.manifest.list.v2+json" ||
+		mediaType == "application/vnd.oci.image.index.v1+json"
+}
+
+// manifestListChildren returns digests of the images referred by the manifest lists.
+func (d *App) manifestListChildren(ctx context.Context, repo ecrRepository, lists []*ecr.ImageIdentifier) ([]string, error) {
+	var digests []string
+	// BatchGetImage accepts images less than 100
+	for i := 0; i < len(lists); i += 100 {
+		end := i + 100
+		if end > len(lists) {
+			end = len(lists)
+		}
+		out, err := d.ecr.BatchGetImageWithContext(ctx, &ecr.BatchGetImageInput{
+			RegistryId:     aws.String(repo.registryID),
+			RepositoryName: aws.String(repo.name),
+			ImageIds:       lists[i:end],
+			AcceptedMediaTypes: aws.StringSlice([]string{
+				"application/vnd.docker.distribution.manifest.list.v2+json",
+				"application/vnd.oci.image.index.v1+json",
+			}),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get manifest lists in %s", repo)
+		}
+		for _, f := range out.Failures {
+			// the children can not be known, so give up deleting untagged images
+			return nil, errors.Errorf("failed to get manifest list %s in %s: %s", aws.StringValue(f.ImageId.ImageDigest), repo, aws.StringValue(f.FailureReason))
+		}
+		for _, img := range out.Images {
+			var list struct {
+				Manifests []struct {
+					Digest string `json:"digest"`
+				} `json:"manifests"`
+			}
+			if err := json.Unmarshal([]byte(aws.StringValue(img.ImageManifest)), &list); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse manifest list %s in %s", aws.StringValue(img.ImageId.ImageDigest), repo)
+			}
+			for _, m := range list.Manifests {
+				digests = append(digests, m.Digest)
+			}
+		}
+	}
+	return digests, nil
+}
+
+func (d *App) deleteStaleResources(ctx context.Context, p *stalePlan) error {
+	// DeleteTaskDefinitions accepts task definitions less than 10
+	for i := 0; i < len(p.taskDefinitions); i += 10 {
+		end := i + 10
+		if end > len(p.taskDefinitions) {
+			end = len(p.taskDefinitions)
+		}
+		d.Log("Deleting task definitions", strings.Join(p.taskDefinitions[i:end], ","))
+		out, err := d.ecs.DeleteTaskDefinitionsWithContext(ctx, &ecs.DeleteTaskDefinitionsInput{
+			TaskDefinitions: aws.StringSlice(p.taskDefinitions[i:end]),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to delete task definitions")
+		}
+		for _, f := range out.Failures {
+			d.Log("WARNING: failed to delete task definition", aws.StringValue(f.Arn), aws.StringValue(f.Reason))
+		}
+	}
+	for _, group := range sortedKeys(p.logStreams) {
+		d.Log(fmt.Sprintf("Deleting %d log streams in %s", len(p.logStreams[group]), group))
+		for _, name := range p.logStreams[group] {
+			if _, err := d.cwl.DeleteLogStreamWithContext(ctx, &cloudwatchlogs.DeleteLogStreamInput{
+				LogGroupName:  aws.String(group),
+				LogStreamName: aws.String(name),
+			}); err != nil {
+				return errors.Wrapf(err, "failed to delete log stream %s in %s", name, group)
+			}
+		}
+	}
+	for repo, ids := range p.ecrImages {
+		d.Log(fmt.Sprintf("Deleting %d untagged images in %s", len(ids), repo))
+		// BatchDeleteImage accepts images less than 100
+		for i := 0; i < len(ids); i += 100 {
+			end := i + 100
+			if end > len(ids) {
+				end = len(ids)
+			}
+			out, err := d.ecr.BatchDeleteImageWithContext(ctx, &ecr.BatchDeleteImageInput{
+				RegistryId:     aws.String(repo.registryID),
+				RepositoryName: aws.String(repo.name),
+				ImageIds:       ids[i:end],
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to delete images in %s", repo)
+			}
+			for _, f := range out.Failures {
+				d.Log("WARNING: failed to delete image", aws.StringValue(f.ImageId.ImageDigest), aws.StringValue(f.FailureReason))
+			}
+		}
+	}
+	return nil
+}
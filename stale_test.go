@@ -0,0 +1,160 @@
+package ecspresso_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/kayac/ecspresso"
+)
+
+func TestECRRepositoryOf(t *testing.T) {
+	testCases := []struct {
+		image string
+		repo  string
+		ok    bool
+	}{
+		{"123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/app:latest", "123456789012/app", true},
+		{"123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/org/app:v1.0.0", "123456789012/org/app", true},
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com/app@sha256:0123456789abcdef", "123456789012/app", true},
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com/app", "123456789012/app", true},
+		{"nginx:latest", "", false},
+		{"ghcr.io/kayac/ecspresso:v2", "", false},
+	}
+	for _, tc := range testCases {
+		repo, ok := ecspresso.ECRRepositoryOf(tc.image)
+		if ok != tc.ok {
+			t.Errorf("%s: unexpected ok %v", tc.image, ok)
+			continue
+		}
+		if ok && repo.String() != tc.repo {
+			t.Errorf("%s: unexpected repository %s expected %s", tc.image, repo, tc.repo)
+		}
+	}
+}
+
+const testStaleImage = "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/app"
+
+// fakeStaleECS implements ECS APIs to find images in use.
+type fakeStaleECS struct {
+	ecsiface.ECSAPI
+}
+
+func (f *fakeStaleECS) ListTaskDefinitionsWithContext(_ aws.Context, in *ecs.ListTaskDefinitionsInput, _ ...request.Option) (*ecs.ListTaskDefinitionsOutput, error) {
+	return &ecs.ListTaskDefinitionsOutput{
+		TaskDefinitionArns: aws.StringSlice([]string{"arn:aws:ecs:ap-northeast-1:123456789012:task-definition/other:1"}),
+	}, nil
+}
+
+func (f *fakeStaleECS) DescribeTaskDefinitionWithContext(_ aws.Context, in *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{
+		TaskDefinition: &ecs.TaskDefinition{
+			ContainerDefinitions: []*ecs.ContainerDefinition{
+				{Image: aws.String(testStaleImage + "@sha256:referred")},
+			},
+		},
+	}, nil
+}
+
+func (f *fakeStaleECS) ListTasksPagesWithContext(_ aws.Context, in *ecs.ListTasksInput, fn func(*ecs.ListTasksOutput, bool) bool, _ ...request.Option) error {
+	fn(&ecs.ListTasksOutput{TaskArns: aws.StringSlice([]string{"task"})}, true)
+	return nil
+}
+
+func (f *fakeStaleECS) DescribeTasksWithContext(_ aws.Context, in *ecs.DescribeTasksInput, _ ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	return &ecs.DescribeTasksOutput{
+		Tasks: []*ecs.Task{
+			{Containers: []*ecs.Container{{ImageDigest: aws.String("sha256:running")}}},
+		},
+	}, nil
+}
+
+// fakeStaleECR implements ECR APIs to list images in the repository.
+type fakeStaleECR struct {
+	ecriface.ECRAPI
+}
+
+func (f *fakeStaleECR) DescribeImagesPagesWithContext(_ aws.Context, in *ecr.DescribeImagesInput, fn func(*ecr.DescribeImagesOutput, bool) bool, _ ...request.Option) error {
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	image := func(digest string, pushedAt time.Time, tags ...string) *ecr.ImageDetail {
+		return &ecr.ImageDetail{
+			ImageDigest:            aws.String(digest),
+			ImagePushedAt:          aws.Time(pushedAt),
+			ImageTags:              aws.StringSlice(tags),
+			ImageManifestMediaType: aws.String("application/vnd.docker.distribution.manifest.v2+json"),
+		}
+	}
+	list := image("sha256:list", old, "latest")
+	list.ImageManifestMediaType = aws.String("application/vnd.oci.image.index.v1+json")
+	fn(&ecr.DescribeImagesOutput{
+		ImageDetails: []*ecr.ImageDetail{
+			image("sha256:stale", old),
+			image("sha256:recent", time.Now()),
+			image("sha256:referred", old),
+			image("sha256:running", old),
+			image("sha256:tagged", old, "v1"),
+		},
+	}, false)
+	fn(&ecr.DescribeImagesOutput{
+		ImageDetails: []*ecr.ImageDetail{
+			list,
+			image("sha256:amd64", old),
+			image("sha256:arm64", old),
+		},
+	}, true)
+	return nil
+}
+
+func (f *fakeStaleECR) BatchGetImageWithContext(_ aws.Context, in *ecr.BatchGetImageInput, _ ...request.Option) (*ecr.BatchGetImageOutput, error) {
+	out := &ecr.BatchGetImageOutput{}
+	for _, id := range in.ImageIds {
+		if aws.StringValue(id.ImageDigest) == "sha256:list" {
+			out.Images = append(out.Images, &ecr.Image{
+				ImageId:       id,
+				ImageManifest: aws.String(`{"schemaVersion":2,"manifests":[{"digest":"sha256:amd64"},{"digest":"sha256:arm64"}]}`),
+			})
+		}
+	}
+	return out, nil
+}
+
+func TestStaleECRImages(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS: &fakeStaleECS{},
+		ECR: &fakeStaleECR{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := &ecspresso.TaskDefinitionInput{
+		Family: aws.String("test"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("app"), Image: aws.String(testStaleImage + ":latest")},
+			{Name: aws.String("nginx"), Image: aws.String("nginx:latest")},
+		},
+	}
+	images, err := app.StaleECRImages(context.Background(), td, ecspresso.CleanupOption{
+		ECRUntaggedImages:     aws.Bool(true),
+		ECRUntaggedImagesDays: aws.Int64(7),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests := images["123456789012/app"]
+	sort.Strings(digests)
+	if expected := []string{"sha256:stale"}; !reflect.DeepEqual(digests, expected) || len(images) != 1 {
+		t.Errorf("unexpected stale images %v expected %v", images, expected)
+	}
+}
@@ -0,0 +1,178 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+)
+
+// DeploymentSummary represents a machine-readable summary of the deployment for CI systems.
+type DeploymentSummary struct {
+	Command                string        `json:"command"`
+	Service                string        `json:"service"`
+	Cluster                string        `json:"cluster"`
+	Outcome                string        `json:"outcome"`
+	Error                  string        `json:"error,omitempty"`
+	PreviousTaskDefinition string        `json:"previous_task_definition,omitempty"`
+	TaskDefinition         string        `json:"task_definition,omitempty"`
+	Images                 []ImageChange `json:"images,omitempty"`
+	User                   string        `json:"user,omitempty"`
+	StartedAt              time.Time     `json:"started_at"`
+	FinishedAt             time.Time     `json:"finished_at"`
+	DurationSeconds        float64       `json:"duration_seconds"`
+}
+
+// ImageChange represents the image of the container before and after the deployment.
+type ImageChange struct {
+	Container string `json:"container"`
+	Previous  string `json:"previous,omitempty"`
+	Current   string `json:"current,omitempty"`
+	Changed   bool   `json:"changed"`
+}
+
+// newDeploymentSummary creates the summary from the finished deployment event.
+func newDeploymentSummary(command string, ev *DeploymentEvent) *DeploymentSummary {
+	s := &DeploymentSummary{
+		Command:                command,
+		Service:                ev.Service,
+		Cluster:                ev.Cluster,
+		Outcome:                AuditOutcomeSuccess,
+		Error:                  ev.Error,
+		PreviousTaskDefinition: ev.PreviousTaskDefinition,
+		TaskDefinition:         ev.TaskDefinition,
+		User:                   ev.User,
+		StartedAt:              ev.StartedAt,
+		FinishedAt:             ev.StartedAt.Add(ev.duration()),
+		DurationSeconds:        ev.DurationSeconds,
+	}
+	if ev.Type == DeploymentEventFailure {
+		s.Outcome = AuditOutcomeFailure
+	}
+	return s
+}
+
+// diffImages returns changes of images of containers between the previous and current task definitions.
+func diffImages(previous, current *TaskDefinitionInput) []ImageChange {
+	var changes []ImageChange
+	prev := map[string]string{}
+	if previous != nil {
+		for _, c := range previous.ContainerDefinitions {
+			prev[aws.StringValue(c.Name)] = aws.StringValue(c.Image)
+		}
+	}
+	seen := map[string]bool{}
+	if current != nil {
+		for _, c := range current.ContainerDefinitions {
+			name := aws.StringValue(c.Name)
+			seen[name] = true
+			changes = append(changes, ImageChange{
+				Container: name,
+				Previous:  prev[name],
+				Current:   aws.StringValue(c.Image),
+				Changed:   prev[name] != aws.StringValue(c.Image),
+			})
+		}
+	}
+	if previous != nil {
+		for _, c := range previous.ContainerDefinitions {
+			if name := aws.StringValue(c.Name); !seen[name] {
+				changes = append(changes, ImageChange{
+					Container: name,
+					Previous:  aws.StringValue(c.Image),
+					Changed:   true,
+				})
+			}
+		}
+	}
+	return changes
+}
+
+// Markdown returns the summary as a Markdown fragment for job summaries or comments of pull requests.
+func (s *DeploymentSummary) Markdown() string {
+	var b bytes.Buffer
+	result := "succeeded"
+	if s.Outcome == AuditOutcomeFailure {
+		result = "failed"
+	}
+	fmt.Fprintf(&b, "### ecspresso %s %s: %s/%s\n\n", s.Command, result, s.Cluster, s.Service)
+	b.WriteString("| | |\n|---|---|\n")
+	td := s.TaskDefinition
+	if s.PreviousTaskDefinition != "" && s.PreviousTaskDefinition != s.TaskDefinition {
+		td = fmt.Sprintf("%s → %s", s.PreviousTaskDefinition, s.TaskDefinition)
+	}
+	fmt.Fprintf(&b, "| Task definition | %s |\n", markdownCell(td))
+	fmt.Fprintf(&b, "| Duration | %s |\n", time.Duration(s.DurationSeconds)*time.Second)
+	if s.User != "" {
+		fmt.Fprintf(&b, "| User | %s |\n", markdownCell(s.User))
+	}
+	fmt.Fprintf(&b, "| Started at | %s |\n", s.StartedAt.Format(time.RFC3339))
+
+	if len(s.Images) > 0 {
+		b.WriteString("\n| Container | Previous image | Current image |\n|---|---|---|\n")
+		for _, c := range s.Images {
+			current := markdownCell(c.Current)
+			if c.Changed && c.Current != "" {
+				current = "**" + current + "**"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", markdownCell(c.Container), markdownCell(c.Previous), current)
+		}
+	}
+	if s.Error != "" {
+		fmt.Fprintf(&b, "\n```\n%s\n```\n", s.Error)
+	}
+	return b.String()
+}
+
+func markdownCell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Replace(s, "|", `\|`, -1)
+}
+
+// writeDeploymentSummary writes the summary of the finished deployment to files.
+// Failures are logged and never change the result of the deployment.
+func (d *App) writeDeploymentSummary(opt DeployOption, ev *DeploymentEvent) {
+	jsonPath, mdPath := aws.StringValue(opt.SummaryJSON), aws.StringValue(opt.SummaryMarkdown)
+	if jsonPath == "" && mdPath == "" {
+		return
+	}
+	s := newDeploymentSummary(opt.commandName(), ev)
+
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	var previous, current *TaskDefinitionInput
+	var err error
+	if s.PreviousTaskDefinition != "" {
+		if previous, err = d.DescribeTaskDefinition(ctx, s.PreviousTaskDefinition); err != nil {
+			d.Log("WARNING: failed to describe task definition for the summary", err)
+		}
+	}
+	if s.TaskDefinition != "" {
+		if current, err = d.DescribeTaskDefinition(ctx, s.TaskDefinition); err != nil {
+			d.Log("WARNING: failed to describe task definition for the summary", err)
+		}
+	}
+	if previous != nil || current != nil {
+		s.Images = diffImages(previous, current)
+	}
+
+	if jsonPath != "" {
+		b, _ := json.MarshalIndent(s, "", "  ")
+		if err := ioutil.WriteFile(jsonPath, append(b, '\n'), 0644); err != nil {
+			d.Log("WARNING:", errors.Wrap(err, "failed to write the summary"))
+		}
+	}
+	if mdPath != "" {
+		if err := ioutil.WriteFile(mdPath, []byte(s.Markdown()), 0644); err != nil {
+			d.Log("WARNING:", errors.Wrap(err, "failed to write the summary"))
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package ecspresso_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso"
+)
+
+func TestDiffImages(t *testing.T) {
+	previous := &ecspresso.TaskDefinitionInput{ContainerDefinitions: []*ecs.ContainerDefinition{
+		{Name: aws.String("app"), Image: aws.String("app:v1")},
+		{Name: aws.String("nginx"), Image: aws.String("nginx:1.25")},
+		{Name: aws.String("old"), Image: aws.String("old:v1")},
+	}}
+	current := &ecspresso.TaskDefinitionInput{ContainerDefinitions: []*ecs.ContainerDefinition{
+		{Name: aws.String("app"), Image: aws.String("app:v2")},
+		{Name: aws.String("nginx"), Image: aws.String("nginx:1.25")},
+		{Name: aws.String("new"), Image: aws.String("new:v1")},
+	}}
+	expected := []ecspresso.ImageChange{
+		{Container: "app", Previous: "app:v1", Current: "app:v2", Changed: true},
+		{Container: "nginx", Previous: "nginx:1.25", Current: "nginx:1.25"},
+		{Container: "new", Current: "new:v1", Changed: true},
+		{Container: "old", Previous: "old:v1", Changed: true},
+	}
+	if diff := cmp.Diff(expected, ecspresso.DiffImages(previous, current)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDeploymentSummaryMarkdown(t *testing.T) {
+	s := &ecspresso.DeploymentSummary{
+		Command:                "deploy",
+		Service:                "test",
+		Cluster:                "default",
+		Outcome:                "failure",
+		Error:                  "failed to wait service stable",
+		PreviousTaskDefinition: "test:1",
+		TaskDefinition:         "test:2",
+		Images: []ecspresso.ImageChange{
+			{Container: "app", Previous: "app:v1", Current: "app:v2", Changed: true},
+			{Container: "nginx", Previous: "nginx:1.25", Current: "nginx:1.25"},
+		},
+		User:            "alice",
+		StartedAt:       time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC),
+		DurationSeconds: 192,
+	}
+	expected := "### ecspresso deploy failed: default/test\n" +
+		"\n" +
+		"| | |\n" +
+		"|---|---|\n" +
+		"| Task definition | test:1 → test:2 |\n" +
+		"| Duration | 3m12s |\n" +
+		"| User | alice |\n" +
+		"| Started at | 2022-04-01T12:00:00Z |\n" +
+		"\n" +
+		"| Container | Previous image | Current image |\n" +
+		"|---|---|---|\n" +
+		"| app | app:v1 | **app:v2** |\n" +
+		"| nginx | nginx:1.25 | nginx:1.25 |\n" +
+		"\n" +
+		"```\nfailed to wait service stable\n```\n"
+	if diff := cmp.Diff(expected, s.Markdown()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+type fakeSummaryECS struct {
+	fakeECS
+}
+
+func (f *fakeSummaryECS) DescribeTaskDefinitionWithContext(_ aws.Context, in *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	image := "app:v1"
+	if strings.HasSuffix(aws.StringValue(in.TaskDefinition), ":2") {
+		image = "app:v2"
+	}
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{
+		Family:               aws.String("test"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{Name: aws.String("app"), Image: aws.String(image)}},
+	}}, nil
+}
+
+func TestDeployWritesSummary(t *testing.T) {
+	defer ecspresso.SetDelayForServiceChanged(0)()
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	fake := &fakeSummaryECS{fakeECS{
+		service: &ecs.Service{
+			ServiceName:    aws.String("test"),
+			ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default2"),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+			DesiredCount:   aws.Int64(1),
+		},
+	}}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+		ECS:                    fake,
+		ApplicationAutoScaling: &fakeAutoScaling{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "ecspresso-summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jsonPath, mdPath := filepath.Join(dir, "summary.json"), filepath.Join(dir, "summary.md")
+	if err := app.DeployWithContext(context.Background(), ecspresso.DeployOption{
+		SummaryJSON:     aws.String(jsonPath),
+		SummaryMarkdown: aws.String(mdPath),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s ecspresso.DeploymentSummary
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	family := aws.StringValue(fake.registered.Family)
+	if s.Outcome != "success" || s.PreviousTaskDefinition != "test:1" || s.TaskDefinition != family+":2" {
+		t.Errorf("unexpected summary %#v", s)
+	}
+	if diff := cmp.Diff([]ecspresso.ImageChange{{Container: "app", Previous: "app:v1", Current: "app:v2", Changed: true}}, s.Images); diff != "" {
+		t.Error(diff)
+	}
+	md, err := ioutil.ReadFile(mdPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(md), "### ecspresso deploy succeeded: default2/test\n") {
+		t.Errorf("unexpected markdown %s", md)
+	}
+}
@@ -0,0 +1,210 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/pkg/errors"
+)
+
+type TagsSyncOption struct {
+	DryRun *bool
+}
+
+func (opt TagsSyncOption) DryRunString() string {
+	if aws.BoolValue(opt.DryRun) {
+		return dryRunStr
+	}
+	return ""
+}
+
+// tagChange represents a change of the tag to be applied to the resource.
+type tagChange struct {
+	key      string
+	value    string
+	oldValue *string
+}
+
+func (c tagChange) String() string {
+	if c.oldValue == nil {
+		return fmt.Sprintf("+ %s=%s", c.key, c.value)
+	}
+	return fmt.Sprintf("~ %s=%s (was %s)", c.key, c.value, *c.oldValue)
+}
+
+// planTagChanges returns changes to make the current tags contain the desired tags.
+// Tags not in desired are kept as is.
+func planTagChanges(current, desired map[string]string) []tagChange {
+	var changes []tagChange
+	for k, v := range desired {
+		old, ok := current[k]
+		switch {
+		case !ok:
+			changes = append(changes, tagChange{key: k, value: v})
+		case old != v:
+			changes = append(changes, tagChange{key: k, value: v, oldValue: aws.String(old)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].key < changes[j].key
+	})
+	return changes
+}
+
+// TagsSync reconciles tags in the configuration onto the service, revisions of the task definition family
+// and scheduled task rules running the family.
+func (d *App) TagsSync(opt TagsSyncOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+
+	desired := d.config.Tags
+	if len(desired) == 0 {
+		return errors.New("no tags in the config. define tags to sync")
+	}
+	d.Log("Starting tags sync", opt.DryRunString())
+	dryRun := aws.BoolValue(opt.DryRun)
+
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return err
+	}
+	if long, _ := isLongArnFormat(aws.StringValue(sv.ServiceArn)); long {
+		if err := d.syncECSTags(ctx, "service "+d.Service, aws.StringValue(sv.ServiceArn), desired, dryRun); err != nil {
+			return err
+		}
+	} else {
+		d.Log("WARNING: the service ARN is not the long ARN format. tags of the service are not supported")
+	}
+
+	family := taskDefinitionFamily(aws.StringValue(sv.TaskDefinition))
+	tdArns, err := d.activeTaskDefinitionArns(ctx, family)
+	if err != nil {
+		return err
+	}
+	for _, arn := range tdArns {
+		if err := d.syncECSTags(ctx, "task definition "+arnToName(arn), arn, desired, dryRun); err != nil {
+			return err
+		}
+	}
+
+	rules, err := d.findScheduledTaskRules(ctx, aws.StringValue(sv.ClusterArn), family)
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		if err := d.syncRuleTags(ctx, r.name, desired, dryRun); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		d.Log("DRY RUN OK")
+	} else {
+		d.Log("Tags are synced. Completed!")
+	}
+	return nil
+}
+
+func (d *App) logTagChanges(resource string, changes []tagChange) {
+	if len(changes) == 0 {
+		d.DebugLog("tags of", resource, "are up to date")
+		return
+	}
+	d.Log("Tags of", resource)
+	for _, c := range changes {
+		d.Log(spcIndent + c.String())
+	}
+}
+
+func (d *App) activeTaskDefinitionArns(ctx context.Context, family string) ([]string, error) {
+	var arns []string
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListTaskDefinitionsWithContext(ctx, &ecs.ListTaskDefinitionsInput{
+			FamilyPrefix: aws.String(family),
+			Status:       aws.String(ecs.TaskDefinitionStatusActive),
+			NextToken:    nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list task definitions")
+		}
+		for _, arn := range out.TaskDefinitionArns {
+			// FamilyPrefix is the full family name, not a prefix. ARNs of other families are not listed, but skipped defensively
+			if taskDefinitionFamily(aws.StringValue(arn)) == family {
+				arns = append(arns, aws.StringValue(arn))
+			}
+		}
+		if nextToken = out.NextToken; nextToken == nil {
+			return arns, nil
+		}
+	}
+}
+
+func (d *App) syncECSTags(ctx context.Context, resource, arn string, desired map[string]string, dryRun bool) error {
+	out, err := d.ecs.ListTagsForResourceWithContext(ctx, &ecs.ListTagsForResourceInput{
+		ResourceArn: aws.String(arn),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list tags of %s", resource)
+	}
+	current := map[string]string{}
+	for _, t := range out.Tags {
+		current[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	changes := planTagChanges(current, desired)
+	d.logTagChanges(resource, changes)
+	if len(changes) == 0 || dryRun {
+		return nil
+	}
+	tags := make([]*ecs.Tag, 0, len(changes))
+	for _, c := range changes {
+		tags = append(tags, &ecs.Tag{Key: aws.String(c.key), Value: aws.String(c.value)})
+	}
+	if _, err := d.ecs.TagResourceWithContext(ctx, &ecs.TagResourceInput{
+		ResourceArn: aws.String(arn),
+		Tags:        tags,
+	}); err != nil {
+		return errors.Wrapf(err, "failed to tag %s", resource)
+	}
+	return nil
+}
+
+func (d *App) syncRuleTags(ctx context.Context, name string, desired map[string]string, dryRun bool) error {
+	resource := "scheduled task rule " + name
+	rule, err := d.eventbridge.DescribeRuleWithContext(ctx, &eventbridge.DescribeRuleInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to describe %s", resource)
+	}
+	out, err := d.eventbridge.ListTagsForResourceWithContext(ctx, &eventbridge.ListTagsForResourceInput{
+		ResourceARN: rule.Arn,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list tags of %s", resource)
+	}
+	current := map[string]string{}
+	for _, t := range out.Tags {
+		current[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	changes := planTagChanges(current, desired)
+	d.logTagChanges(resource, changes)
+	if len(changes) == 0 || dryRun {
+		return nil
+	}
+	tags := make([]*eventbridge.Tag, 0, len(changes))
+	for _, c := range changes {
+		tags = append(tags, &eventbridge.Tag{Key: aws.String(c.key), Value: aws.String(c.value)})
+	}
+	if _, err := d.eventbridge.TagResourceWithContext(ctx, &eventbridge.TagResourceInput{
+		ResourceARN: rule.Arn,
+		Tags:        tags,
+	}); err != nil {
+		return errors.Wrapf(err, "failed to tag %s", resource)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package ecspresso_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso"
+)
+
+func TestPlanTagChanges(t *testing.T) {
+	current := map[string]string{
+		"Team":    "app",
+		"Env":     "staging",
+		"Managed": "manual",
+	}
+	desired := map[string]string{
+		"Team":    "app",
+		"Env":     "production",
+		"Project": "ecspresso",
+	}
+	expected := []string{
+		"~ Env=production (was staging)",
+		"+ Project=ecspresso",
+	}
+	if diff := cmp.Diff(expected, ecspresso.PlanTagChanges(current, desired)); diff != "" {
+		t.Error(diff)
+	}
+	if changes := ecspresso.PlanTagChanges(desired, desired); len(changes) != 0 {
+		t.Errorf("unexpected changes %v", changes)
+	}
+}
@@ -0,0 +1,128 @@
+package ecspresso
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// mergeKeys are keys of objects in arrays of the task definition merged by the key.
+// Other arrays are replaced by fragments.
+var mergeKeys = map[string]string{
+	"containerDefinitions": "name",
+	"volumes":              "name",
+	"environment":          "name",
+	"secrets":              "name",
+	"dependsOn":            "containerName",
+}
+
+// readTaskDefinitionJSON reads the task definition file as a JSON value.
+// The task definition wrapped with "taskDefinition" (an output of describe-task-definition) is unwrapped.
+func (d *App) readTaskDefinitionJSON(path string) ([]byte, error) {
+	src, err := d.readDefinitionFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load task definition %s", path)
+	}
+	c := struct {
+		TaskDefinition json.RawMessage `json:"taskDefinition"`
+	}{}
+	dec := json.NewDecoder(bytes.NewReader(src))
+	if err := dec.Decode(&c); err != nil {
+		return nil, errors.Wrapf(err, "failed to load task definition %s", path)
+	}
+	if c.TaskDefinition != nil {
+		src = c.TaskDefinition
+	}
+	return src, nil
+}
+
+// mergeTaskDefinitionFragments merges the fragments into the task definition in order.
+func (d *App) mergeTaskDefinitionFragments(src []byte, paths []string) ([]byte, error) {
+	merged, err := decodeJSONValue(src)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse task definition")
+	}
+	for _, path := range paths {
+		fsrc, err := d.readTaskDefinitionJSON(path)
+		if err != nil {
+			return nil, err
+		}
+		fragment, err := decodeJSONValue(fsrc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse task definition fragment %s", path)
+		}
+		merged = mergeDefinitionValues(merged, fragment, "")
+	}
+	return json.Marshal(merged)
+}
+
+func decodeJSONValue(src []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// mergeDefinitionValues merges override into base. key is the key of the values in the parent object.
+// Objects are merged recursively, and arrays of objects keyed by mergeKeys are merged by the key.
+// The other values are replaced by override.
+func mergeDefinitionValues(base, override interface{}, key string) interface{} {
+	switch ov := override.(type) {
+	case map[string]interface{}:
+		bm, ok := base.(map[string]interface{})
+		if !ok {
+			return override
+		}
+		merged := make(map[string]interface{}, len(bm)+len(ov))
+		for k, v := range bm {
+			merged[k] = v
+		}
+		for k, v := range ov {
+			merged[k] = mergeDefinitionValues(bm[k], v, k)
+		}
+		return merged
+	case []interface{}:
+		ba, ok := base.([]interface{})
+		if mk := mergeKeys[key]; ok && mk != "" {
+			return mergeArrayByKey(ba, ov, mk)
+		}
+		return override
+	}
+	return override
+}
+
+func mergeArrayByKey(base, override []interface{}, key string) []interface{} {
+	merged := make([]interface{}, 0, len(base)+len(override))
+	index := map[string]int{}
+	for _, v := range base {
+		if name, ok := mergeKeyOf(v, key); ok {
+			index[name] = len(merged)
+		}
+		merged = append(merged, v)
+	}
+	for _, v := range override {
+		name, ok := mergeKeyOf(v, key)
+		if i, found := index[name]; ok && found {
+			merged[i] = mergeDefinitionValues(merged[i], v, "")
+			continue
+		}
+		if ok {
+			index[name] = len(merged)
+		}
+		merged = append(merged, v)
+	}
+	return merged
+}
+
+func mergeKeyOf(v interface{}, key string) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := m[key].(string)
+	return name, ok
+}
@@ -0,0 +1,78 @@
+package ecspresso_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso"
+)
+
+func TestLoadTaskDefinitionWithFragments(t *testing.T) {
+	os.Setenv("SERVICE", "app")
+	c := &ecspresso.Config{
+		Region:             "ap-northeast-1",
+		Timeout:            600 * time.Second,
+		Service:            "test",
+		Cluster:            "default",
+		TaskDefinitionPath: "tests/fragments/base.json",
+		TaskDefinitionFragments: []string{
+			"tests/fragments/production.json",
+			"tests/fragments/datadog.json",
+		},
+	}
+	if err := c.Restrict(); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td, err := app.LoadTaskDefinition(c.TaskDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(td.Cpu) != "1024" || aws.StringValue(td.Memory) != "2048" || aws.StringValue(td.Family) != "app" {
+		t.Errorf("unexpected task definition %s %s %s", *td.Family, *td.Cpu, *td.Memory)
+	}
+	expected := []*ecs.ContainerDefinition{
+		{
+			Name:      aws.String("app"),
+			Image:     aws.String("app:v1"),
+			Essential: aws.Bool(true),
+			Environment: []*ecs.KeyValuePair{
+				{Name: aws.String("ENV"), Value: aws.String("production")},
+				{Name: aws.String("LOG_LEVEL"), Value: aws.String("debug")},
+			},
+			PortMappings: []*ecs.PortMapping{
+				{ContainerPort: aws.Int64(8080)},
+			},
+			DependsOn: []*ecs.ContainerDependency{
+				{ContainerName: aws.String("datadog-agent"), Condition: aws.String("START")},
+			},
+		},
+		{
+			Name:      aws.String("datadog-agent"),
+			Image:     aws.String("public.ecr.aws/datadog/agent:7"),
+			Essential: aws.Bool(false),
+			Environment: []*ecs.KeyValuePair{
+				{Name: aws.String("DD_SERVICE"), Value: aws.String("app")},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, td.ContainerDefinitions); diff != "" {
+		t.Errorf("unexpected container definitions: %s", diff)
+	}
+
+	// fragments are not merged into other task definitions
+	other, err := app.LoadTaskDefinition("tests/td.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.ContainerDefinitions) != 1 {
+		t.Errorf("fragments must not be merged: %d containers", len(other.ContainerDefinitions))
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/Songmu/prompter"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/fujiwara/tracer"
 	"github.com/olekukonko/tablewriter"
@@ -40,7 +41,20 @@ func (opt TasksOption) newFormatter() taskFormatter {
 	return newTaskFormatterTable(os.Stdout)
 }
 
+// describeTasksBatchSize is the maximum number of tasks that DescribeTasks accepts at once.
+const describeTasksBatchSize = 100
+
 func (d *App) listTasks(ctx context.Context, id *string, desiredStatuses ...string) ([]*ecs.Task, error) {
+	var tasks []*ecs.Task
+	err := d.eachTask(ctx, id, func(task *ecs.Task) {
+		tasks = append(tasks, task)
+	}, desiredStatuses...)
+	return tasks, err
+}
+
+// eachTask calls fn for each task of the task definition family in order of listing.
+// Tasks are described in parallel batches, and fn is called as soon as the preceding batches are described.
+func (d *App) eachTask(ctx context.Context, id *string, fn func(*ecs.Task), desiredStatuses ...string) error {
 	if len(desiredStatuses) == 0 {
 		desiredStatuses = []string{"RUNNING", "STOPPED"}
 	}
@@ -52,73 +66,148 @@ func (d *App) listTasks(ctx context.Context, id *string, desiredStatuses ...stri
 		}
 		out, err := d.ecs.DescribeTasksWithContext(ctx, in)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to describe tasks")
+			return errors.Wrap(err, "failed to describe tasks")
 		}
 		if len(out.Tasks) == 0 && len(in.Tasks) != 0 {
-			return nil, errors.Errorf("task ID %s is not found", *id)
+			return errors.Errorf("task ID %s is not found", *id)
 		}
-		return out.Tasks, nil
+		for _, task := range out.Tasks {
+			fn(task)
+		}
+		return nil
 	}
 
-	var tasks []*ecs.Task
-	var family string
-	if d.config.Service != "" {
-		sv, err := d.DescribeService(ctx)
-		if err != nil {
-			return nil, err
-		}
-		tdArn := sv.TaskDefinition
-		td, err := d.DescribeTaskDefinition(ctx, *tdArn)
-		if err != nil {
-			return nil, err
-		}
-		family = aws.StringValue(td.Family)
-	} else {
-		td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
-		if err != nil {
-			return nil, err
-		}
-		family = aws.StringValue(td.Family)
+	family, err := d.taskDefinitionFamilyForTasks(ctx)
+	if err != nil {
+		return err
 	}
+	var arns []*string
 	for _, desiredStatus := range desiredStatuses {
 		var nextToken *string
 		for {
-			out, err := d.ecs.ListTasks(&ecs.ListTasksInput{
+			out, err := d.ecs.ListTasksWithContext(ctx, &ecs.ListTasksInput{
 				Cluster:       &d.config.Cluster,
 				Family:        &family,
 				DesiredStatus: aws.String(desiredStatus),
+				MaxResults:    aws.Int64(describeTasksBatchSize),
 				NextToken:     nextToken,
 			})
 			if err != nil {
-				return nil, errors.Wrap(err, "failed to list tasks")
+				return errors.Wrap(err, "failed to list tasks")
 			}
-			if len(out.TaskArns) == 0 {
+			arns = append(arns, out.TaskArns...)
+			if nextToken = out.NextToken; nextToken == nil {
 				break
 			}
-			in := &ecs.DescribeTasksInput{
-				Cluster: aws.String(d.Cluster),
-				Tasks:   out.TaskArns,
-				Include: []*string{aws.String("TAGS")},
+		}
+	}
+	return d.describeTasksInBatches(ctx, arns, fn)
+}
+
+func (d *App) taskDefinitionFamilyForTasks(ctx context.Context) (string, error) {
+	if d.config.Service != "" {
+		sv, err := d.DescribeService(ctx)
+		if err != nil {
+			return "", err
+		}
+		td, err := d.DescribeTaskDefinition(ctx, *sv.TaskDefinition)
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(td.Family), nil
+	}
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(td.Family), nil
+}
+
+type describeTasksResult struct {
+	tasks []*ecs.Task
+	err   error
+}
+
+// describeTasksInBatches describes tasks in batches of describeTasksBatchSize concurrently,
+// and calls fn for each task in order of arns.
+func (d *App) describeTasksInBatches(ctx context.Context, arns []*string, fn func(*ecs.Task)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	n := (len(arns) + describeTasksBatchSize - 1) / describeTasksBatchSize
+	results := make([]chan describeTasksResult, n)
+	for i := range results {
+		results[i] = make(chan describeTasksResult, 1)
+	}
+	go func() {
+		sem := make(chan struct{}, maxConcurrency)
+		for i := 0; i < n; i++ {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
 			}
-			taskOut, err := d.ecs.DescribeTasksWithContext(ctx, in)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to describe tasks")
+			from, to := i*describeTasksBatchSize, (i+1)*describeTasksBatchSize
+			if to > len(arns) {
+				to = len(arns)
 			}
-			for _, task := range taskOut.Tasks {
-				tasks = append(tasks, task)
+			go func(ch chan<- describeTasksResult, batch []*string) {
+				defer func() { <-sem }()
+				out, err := d.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+					Cluster: aws.String(d.Cluster),
+					Tasks:   batch,
+					Include: []*string{aws.String("TAGS")},
+				})
+				if err != nil {
+					ch <- describeTasksResult{err: errors.Wrap(err, "failed to describe tasks")}
+					return
+				}
+				ch <- describeTasksResult{tasks: out.Tasks}
+			}(results[i], arns[from:to])
+		}
+	}()
+
+	for _, ch := range results {
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				return r.err
 			}
-			if nextToken = out.NextToken; nextToken == nil {
-				break
+			for _, task := range r.tasks {
+				fn(task)
 			}
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
-	return tasks, nil
+	return nil
 }
 
 func (d *App) Tasks(opt TasksOption) error {
 	ctx, cancel := d.Start()
 	defer cancel()
 
+	if !aws.BoolValue(opt.Find) && !aws.BoolValue(opt.Stop) && !aws.BoolValue(opt.Trace) {
+		// stream tasks to the formatter as they are described
+		var formatter taskFormatter
+		err := d.eachTask(ctx, opt.ID, func(task *ecs.Task) {
+			if formatter == nil {
+				formatter = opt.newFormatter()
+			}
+			formatter.AddTask(task)
+		})
+		if formatter != nil {
+			formatter.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if formatter == nil {
+			d.Log("tasks not found")
+		}
+		return nil
+	}
+
 	tasks, err := d.listTasks(ctx, opt.ID)
 	if err != nil {
 		return err
@@ -128,15 +217,6 @@ func (d *App) Tasks(opt TasksOption) error {
 		return nil
 	}
 
-	if !aws.BoolValue(opt.Find) && !aws.BoolValue(opt.Stop) && !aws.BoolValue(opt.Trace) {
-		formatter := opt.newFormatter()
-		for _, task := range tasks {
-			formatter.AddTask(task)
-		}
-		formatter.Close()
-		return nil
-	}
-
 	task, err := d.findTask(opt, tasks)
 	if err != nil {
 		return err
@@ -154,7 +234,7 @@ func (d *App) Tasks(opt TasksOption) error {
 			return nil
 		}
 		d.Log("Request stop task ID " + arnToName(*task.TaskArn))
-		_, err := d.ecs.StopTask(&ecs.StopTaskInput{
+		_, err := d.ecs.StopTaskWithContext(ctx, &ecs.StopTaskInput{
 			Cluster: task.ClusterArn,
 			Task:    task.TaskArn,
 			Reason:  aws.String("Request stop task by user action."),
@@ -163,7 +243,7 @@ func (d *App) Tasks(opt TasksOption) error {
 			return errors.Wrap(err, "failed to stop task")
 		}
 	} else if aws.BoolValue(opt.Trace) {
-		tr, err := tracer.New(ctx, d.ecs, d.cwl)
+		tr, err := tracer.New(ctx, ecs.New(d.sess), cloudwatchlogs.New(d.sess))
 		if err != nil {
 			return errors.Wrap(err, "failed to new tracer")
 		}
@@ -0,0 +1,98 @@
+package ecspresso_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/kayac/ecspresso"
+)
+
+// fakeTasksECS has many RUNNING tasks of the family "test".
+type fakeTasksECS struct {
+	ecsiface.ECSAPI
+	running int
+
+	mu        sync.Mutex
+	described int
+}
+
+func (f *fakeTasksECS) DescribeServicesWithContext(_ aws.Context, _ *ecs.DescribeServicesInput, _ ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	return &ecs.DescribeServicesOutput{Services: []*ecs.Service{{
+		ServiceName:    aws.String("test"),
+		TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+	}}}, nil
+}
+
+func (f *fakeTasksECS) DescribeTaskDefinitionWithContext(_ aws.Context, _ *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{Family: aws.String("test")}}, nil
+}
+
+func (f *fakeTasksECS) ListTasksWithContext(_ aws.Context, in *ecs.ListTasksInput, _ ...request.Option) (*ecs.ListTasksOutput, error) {
+	if aws.StringValue(in.DesiredStatus) != "RUNNING" {
+		return &ecs.ListTasksOutput{}, nil
+	}
+	from, _ := strconv.Atoi(aws.StringValue(in.NextToken))
+	to := from + int(aws.Int64Value(in.MaxResults))
+	out := &ecs.ListTasksOutput{}
+	if to < f.running {
+		out.NextToken = aws.String(strconv.Itoa(to))
+	} else {
+		to = f.running
+	}
+	for i := from; i < to; i++ {
+		out.TaskArns = append(out.TaskArns, aws.String(fmt.Sprintf("arn:aws:ecs:ap-northeast-1:123456789012:task/default2/%04d", i)))
+	}
+	return out, nil
+}
+
+func (f *fakeTasksECS) DescribeTasksWithContext(_ aws.Context, in *ecs.DescribeTasksInput, _ ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	if len(in.Tasks) > 100 {
+		return nil, fmt.Errorf("too many tasks: %d", len(in.Tasks))
+	}
+	f.mu.Lock()
+	f.described++
+	n := f.described
+	f.mu.Unlock()
+	// batches described later return earlier
+	time.Sleep(time.Duration(10-n) * time.Millisecond)
+	out := &ecs.DescribeTasksOutput{}
+	for _, arn := range in.Tasks {
+		out.Tasks = append(out.Tasks, &ecs.Task{TaskArn: arn})
+	}
+	return out, nil
+}
+
+func TestListTasksInBatches(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeTasksECS{running: 250}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := app.ListTasks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 250 {
+		t.Fatalf("unexpected number of tasks: %d", len(tasks))
+	}
+	for i, task := range tasks {
+		if arn := fmt.Sprintf("arn:aws:ecs:ap-northeast-1:123456789012:task/default2/%04d", i); aws.StringValue(task.TaskArn) != arn {
+			t.Errorf("tasks[%d] must be %s: %s", i, arn, aws.StringValue(task.TaskArn))
+		}
+	}
+	if fake.described != 3 {
+		t.Errorf("DescribeTasks must be called 3 times: %d", fake.described)
+	}
+}
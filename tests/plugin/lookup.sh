@@ -0,0 +1,15 @@
+#!/bin/sh
+# A plugin for tests. "upper" returns the first argument in upper case, "request" returns the request as is.
+input=$(cat)
+case "$input" in
+  '{"function":"upper",'*)
+    arg=$(echo "$input" | sed 's/.*"args":\["\([^"]*\)".*/\1/' | tr a-z A-Z)
+    printf '{"value":"%s"}\n' "$arg"
+    ;;
+  '{"function":"request",'*)
+    printf '{"value":%s}\n' "$input"
+    ;;
+  *)
+    echo '{"error":"unknown function"}'
+    ;;
+esac
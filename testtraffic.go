@@ -0,0 +1,388 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/pkg/errors"
+)
+
+// Defaults of the test traffic validation.
+const (
+	DefaultTestTrafficValidationInterval = 30 * time.Second
+	DefaultTestTrafficValidationTimeout  = time.Minute
+
+	DefaultTestTrafficHTTPStatus        = http.StatusOK
+	DefaultTestTrafficHTTPRetryInterval = 5 * time.Second
+)
+
+// TestTrafficValidationConfig represents a configuration of validations against the test listener
+// while a CodeDeploy blue/green deployment waits for the traffic reroute.
+type TestTrafficValidationConfig struct {
+	// Commands are run by sh -c. ECSPRESSO_TEST_ENDPOINT and ECSPRESSO_DEPLOYMENT_ID are set in the environment.
+	Commands []string `yaml:"commands,omitempty"`
+	// HTTP are smoke tests requested by ecspresso itself before the commands.
+	HTTP []*TestTrafficHTTPCheck `yaml:"http,omitempty"`
+	// BakeTime is the duration to repeat the validation before continuing the deployment.
+	BakeTime time.Duration `yaml:"bake_time,omitempty"`
+	// Interval is the interval of validations in the bake time.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout is the timeout of each command and HTTP request.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// TestTrafficHTTPCheck represents an HTTP smoke test against the test listener.
+type TestTrafficHTTPCheck struct {
+	// URL is a template of the URL. e.g. {{ .Endpoint }}/health
+	URL    string `yaml:"url"`
+	Method string `yaml:"method,omitempty"`
+	// Headers are templates of request headers. Host overrides the Host header.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Status is the expected status code. default: 200
+	Status int `yaml:"status,omitempty"`
+	// Retries is the number of retries after the check failed.
+	Retries       int           `yaml:"retries,omitempty"`
+	RetryInterval time.Duration `yaml:"retry_interval,omitempty"`
+	// InsecureSkipVerify skips verification of the certificate, which does not match the DNS name of the load balancer usually.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// testTrafficHTTPVars represents variables in the URL template of TestTrafficHTTPCheck.
+type testTrafficHTTPVars struct {
+	Endpoint     string
+	Protocol     string
+	Host         string
+	Port         string
+	DeploymentID string
+}
+
+func newTestTrafficHTTPVars(endpoint, dpID string) (testTrafficHTTPVars, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return testTrafficHTTPVars{}, errors.Wrapf(err, "invalid endpoint %s", endpoint)
+	}
+	return testTrafficHTTPVars{
+		Endpoint:     endpoint,
+		Protocol:     u.Scheme,
+		Host:         u.Hostname(),
+		Port:         u.Port(),
+		DeploymentID: dpID,
+	}, nil
+}
+
+func (c *TestTrafficHTTPCheck) validate() error {
+	if c.URL == "" {
+		return errors.New("url is required")
+	}
+	if _, err := parseTestTrafficTemplate(c.URL); err != nil {
+		return err
+	}
+	for k, v := range c.Headers {
+		if _, err := parseTestTrafficTemplate(v); err != nil {
+			return errors.Wrapf(err, "header %s", k)
+		}
+	}
+	if c.Status < 0 || c.Retries < 0 || c.RetryInterval < 0 {
+		return errors.New("status, retries and retry_interval must be positive")
+	}
+	return nil
+}
+
+func (c *TestTrafficHTTPCheck) status() int {
+	if c.Status > 0 {
+		return c.Status
+	}
+	return DefaultTestTrafficHTTPStatus
+}
+
+func (c *TestTrafficHTTPCheck) retryInterval() time.Duration {
+	if c.RetryInterval > 0 {
+		return c.RetryInterval
+	}
+	return DefaultTestTrafficHTTPRetryInterval
+}
+
+func (c *TestTrafficHTTPCheck) method() string {
+	if c.Method != "" {
+		return strings.ToUpper(c.Method)
+	}
+	return http.MethodGet
+}
+
+func parseTestTrafficTemplate(s string) (*template.Template, error) {
+	tmpl, err := template.New("").Parse(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid template %s", s)
+	}
+	return tmpl, nil
+}
+
+func renderTestTrafficTemplate(s string, vars testTrafficHTTPVars) (string, error) {
+	tmpl, err := parseTestTrafficTemplate(s)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", errors.Wrapf(err, "failed to render %s", s)
+	}
+	return b.String(), nil
+}
+
+func (c *TestTrafficValidationConfig) validate() error {
+	if len(c.Commands) == 0 && len(c.HTTP) == 0 {
+		return errors.New("test_traffic_validation requires commands or http")
+	}
+	if c.BakeTime < 0 || c.Interval < 0 || c.Timeout < 0 {
+		return errors.New("durations in test_traffic_validation must be positive")
+	}
+	for i, h := range c.HTTP {
+		if err := h.validate(); err != nil {
+			return errors.Wrapf(err, "test_traffic_validation.http[%d]", i)
+		}
+	}
+	return nil
+}
+
+func (c *TestTrafficValidationConfig) interval() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return DefaultTestTrafficValidationInterval
+}
+
+func (c *TestTrafficValidationConfig) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTestTrafficValidationTimeout
+}
+
+// waitForCodeDeployWithValidation waits for the deployment, validates the test traffic when the deployment
+// is ready to reroute the traffic, and continues or stops the deployment by the result.
+func (d *App) waitForCodeDeployWithValidation(ctx context.Context, dg *codedeploy.DeploymentGroupInfo, dpID string) error {
+	poller := newWaitPoller(d.config.Wait, time.Now())
+	var validated bool
+	for {
+		out, err := d.codedeploy.GetDeploymentWithContext(ctx, &codedeploy.GetDeploymentInput{
+			DeploymentId: aws.String(dpID),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get deployment")
+		}
+		info := out.DeploymentInfo
+		switch status := aws.StringValue(info.Status); status {
+		case codedeploy.DeploymentStatusSucceeded:
+			if !validated {
+				d.Log("WARNING: the deployment succeeded without waiting for the traffic reroute. the test traffic was not validated")
+			}
+			return nil
+		case codedeploy.DeploymentStatusFailed, codedeploy.DeploymentStatusStopped:
+			if info.ErrorInformation != nil {
+				return errors.Errorf("deployment %s is %s: %s", dpID, status, aws.StringValue(info.ErrorInformation.Message))
+			}
+			return errors.Errorf("deployment %s is %s", dpID, status)
+		case codedeploy.DeploymentStatusReady:
+			if validated {
+				break
+			}
+			validated = true
+			if err := d.validateTestTraffic(ctx, dg, dpID); err != nil {
+				d.Log("Test traffic validation failed. stopping the deployment with rollback")
+				if _, serr := d.codedeploy.StopDeploymentWithContext(ctx, &codedeploy.StopDeploymentInput{
+					DeploymentId:        aws.String(dpID),
+					AutoRollbackEnabled: aws.Bool(true),
+				}); serr != nil {
+					return errors.Wrapf(serr, "failed to stop the deployment after the test traffic validation failed: %s", err)
+				}
+				return errors.Wrap(err, "test traffic validation failed")
+			}
+			d.Log("Test traffic is validated. continuing the deployment")
+			if _, err := d.codedeploy.ContinueDeploymentWithContext(ctx, &codedeploy.ContinueDeploymentInput{
+				DeploymentId:       aws.String(dpID),
+				DeploymentWaitType: aws.String(codedeploy.DeploymentWaitTypeReadyWait),
+			}); err != nil {
+				return errors.Wrap(err, "failed to continue the deployment")
+			}
+		}
+		if err := poller.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// validateTestTraffic runs validation commands against the test listener endpoint repeatedly in the bake time.
+func (d *App) validateTestTraffic(ctx context.Context, dg *codedeploy.DeploymentGroupInfo, dpID string) error {
+	c := d.config.TestTrafficValidation
+	endpoint, err := d.testListenerEndpoint(ctx, dg)
+	if err != nil {
+		return err
+	}
+	d.Log("Validating test traffic on", endpoint)
+	env := append(os.Environ(),
+		"ECSPRESSO_TEST_ENDPOINT="+endpoint,
+		"ECSPRESSO_DEPLOYMENT_ID="+dpID,
+	)
+	vars, err := newTestTrafficHTTPVars(endpoint, dpID)
+	if err != nil {
+		return err
+	}
+	bakeUntil := time.Now().Add(c.BakeTime)
+	for {
+		for _, h := range c.HTTP {
+			if err := d.runTestTrafficHTTPCheck(ctx, h, vars); err != nil {
+				return err
+			}
+		}
+		for _, command := range c.Commands {
+			if err := d.runTestTrafficCommand(ctx, command, env); err != nil {
+				return err
+			}
+		}
+		remaining := time.Until(bakeUntil)
+		if remaining <= 0 {
+			return nil
+		}
+		d.Log(fmt.Sprintf("Baking for %s", remaining.Round(time.Second)))
+		wait := c.interval()
+		if remaining < wait {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (d *App) runTestTrafficCommand(ctx context.Context, command string, env []string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.config.TestTrafficValidation.timeout())
+	defer cancel()
+	d.DebugLog("running the test traffic validation command", command)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "command %q failed", command)
+	}
+	return nil
+}
+
+// runTestTrafficHTTPCheck requests the URL and checks the status code, retrying until the retries run out.
+func (d *App) runTestTrafficHTTPCheck(ctx context.Context, h *TestTrafficHTTPCheck, vars testTrafficHTTPVars) error {
+	u, err := renderTestTrafficTemplate(h.URL, vars)
+	if err != nil {
+		return err
+	}
+	headers := make(map[string]string, len(h.Headers))
+	for k, v := range h.Headers {
+		if headers[k], err = renderTestTrafficTemplate(v, vars); err != nil {
+			return err
+		}
+	}
+	client := &http.Client{
+		Timeout: d.config.TestTrafficValidation.timeout(),
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: h.InsecureSkipVerify},
+		},
+	}
+	for i := 0; ; i++ {
+		err := testTrafficHTTPRequest(ctx, client, h, u, headers)
+		if err == nil {
+			d.Log(fmt.Sprintf("%s %s: %d OK", h.method(), u, h.status()))
+			return nil
+		}
+		if i >= h.Retries {
+			return err
+		}
+		d.Log(fmt.Sprintf("%s. retrying in %s (%d/%d)", err, h.retryInterval(), i+1, h.Retries))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(h.retryInterval()):
+		}
+	}
+}
+
+func testTrafficHTTPRequest(ctx context.Context, client *http.Client, h *TestTrafficHTTPCheck, u string, headers map[string]string) error {
+	req, err := http.NewRequest(h.method(), u, nil)
+	if err != nil {
+		return errors.Wrapf(err, "invalid request %s %s", h.method(), u)
+	}
+	req = req.WithContext(ctx)
+	for k, v := range headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s %s failed", h.method(), u)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != h.status() {
+		return errors.Errorf("%s %s returned %d, expected %d", h.method(), u, resp.StatusCode, h.status())
+	}
+	return nil
+}
+
+// testListenerEndpoint returns the endpoint URL of the test listener of the deployment group.
+func (d *App) testListenerEndpoint(ctx context.Context, dg *codedeploy.DeploymentGroupInfo) (string, error) {
+	var listenerArn *string
+	if dg.LoadBalancerInfo != nil {
+		for _, pair := range dg.LoadBalancerInfo.TargetGroupPairInfoList {
+			if pair.TestTrafficRoute != nil && len(pair.TestTrafficRoute.ListenerArns) > 0 {
+				listenerArn = pair.TestTrafficRoute.ListenerArns[0]
+				break
+			}
+		}
+	}
+	if listenerArn == nil {
+		return "", errors.Errorf("no test listener in the deployment group %s", aws.StringValue(dg.DeploymentGroupName))
+	}
+	ls, err := d.elbv2.DescribeListenersWithContext(ctx, &elbv2.DescribeListenersInput{
+		ListenerArns: []*string{listenerArn},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to describe the test listener")
+	}
+	if len(ls.Listeners) == 0 {
+		return "", errors.Errorf("test listener %s is not found", aws.StringValue(listenerArn))
+	}
+	l := ls.Listeners[0]
+	lbs, err := d.elbv2.DescribeLoadBalancersWithContext(ctx, &elbv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: []*string{l.LoadBalancerArn},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to describe the load balancer of the test listener")
+	}
+	if len(lbs.LoadBalancers) == 0 {
+		return "", errors.Errorf("load balancer %s is not found", aws.StringValue(l.LoadBalancerArn))
+	}
+	return fmt.Sprintf(
+		"%s://%s:%d",
+		strings.ToLower(aws.StringValue(l.Protocol)),
+		aws.StringValue(lbs.LoadBalancers[0].DNSName),
+		aws.Int64Value(l.Port),
+	), nil
+}
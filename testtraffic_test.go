@@ -0,0 +1,201 @@
+package ecspresso_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/codedeploy/codedeployiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/kayac/ecspresso"
+)
+
+type fakeTestTrafficCodeDeploy struct {
+	codedeployiface.CodeDeployAPI
+	status    string
+	continued bool
+	stopped   bool
+}
+
+func (f *fakeTestTrafficCodeDeploy) GetDeploymentWithContext(_ aws.Context, _ *codedeploy.GetDeploymentInput, _ ...request.Option) (*codedeploy.GetDeploymentOutput, error) {
+	return &codedeploy.GetDeploymentOutput{DeploymentInfo: &codedeploy.DeploymentInfo{Status: aws.String(f.status)}}, nil
+}
+
+func (f *fakeTestTrafficCodeDeploy) ContinueDeploymentWithContext(_ aws.Context, in *codedeploy.ContinueDeploymentInput, _ ...request.Option) (*codedeploy.ContinueDeploymentOutput, error) {
+	f.continued = true
+	f.status = codedeploy.DeploymentStatusSucceeded
+	return &codedeploy.ContinueDeploymentOutput{}, nil
+}
+
+func (f *fakeTestTrafficCodeDeploy) StopDeploymentWithContext(_ aws.Context, in *codedeploy.StopDeploymentInput, _ ...request.Option) (*codedeploy.StopDeploymentOutput, error) {
+	f.stopped = aws.BoolValue(in.AutoRollbackEnabled)
+	f.status = codedeploy.DeploymentStatusStopped
+	return &codedeploy.StopDeploymentOutput{}, nil
+}
+
+type fakeTestTrafficELBv2 struct {
+	elbv2iface.ELBV2API
+}
+
+func (f *fakeTestTrafficELBv2) DescribeListenersWithContext(_ aws.Context, in *elbv2.DescribeListenersInput, _ ...request.Option) (*elbv2.DescribeListenersOutput, error) {
+	return &elbv2.DescribeListenersOutput{Listeners: []*elbv2.Listener{{
+		ListenerArn:     in.ListenerArns[0],
+		LoadBalancerArn: aws.String(testLBArn),
+		Protocol:        aws.String("HTTP"),
+		Port:            aws.Int64(8080),
+	}}}, nil
+}
+
+func (f *fakeTestTrafficELBv2) DescribeLoadBalancersWithContext(_ aws.Context, _ *elbv2.DescribeLoadBalancersInput, _ ...request.Option) (*elbv2.DescribeLoadBalancersOutput, error) {
+	return &elbv2.DescribeLoadBalancersOutput{LoadBalancers: []*elbv2.LoadBalancer{{
+		LoadBalancerArn: aws.String(testLBArn),
+		DNSName:         aws.String("web.example.com"),
+	}}}, nil
+}
+
+func TestWaitForCodeDeployWithValidation(t *testing.T) {
+	dg := &codedeploy.DeploymentGroupInfo{
+		DeploymentGroupName: aws.String("dg"),
+		LoadBalancerInfo: &codedeploy.LoadBalancerInfo{TargetGroupPairInfoList: []*codedeploy.TargetGroupPairInfo{
+			testTargetGroupPair("web-blue", "web-green", "listener/app/web/1/prod", "listener/app/web/1/test"),
+		}},
+	}
+	testCases := []struct {
+		name      string
+		commands  []string
+		continued bool
+		stopped   bool
+		err       string
+	}{
+		{
+			name:      "validated",
+			commands:  []string{`test "$ECSPRESSO_TEST_ENDPOINT" = http://web.example.com:8080`, `test "$ECSPRESSO_DEPLOYMENT_ID" = d-TEST`},
+			continued: true,
+		},
+		{
+			name:     "failed",
+			commands: []string{"true", "exit 3"},
+			stopped:  true,
+			err:      `test traffic validation failed: command "exit 3" failed`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := ecspresso.NewDefaultConfig()
+			if err := conf.Load("tests/test.yaml"); err != nil {
+				t.Fatal(err)
+			}
+			conf.Wait = &ecspresso.WaitConfig{MinInterval: time.Millisecond, MaxInterval: time.Millisecond}
+			conf.TestTrafficValidation = &ecspresso.TestTrafficValidationConfig{
+				Commands: tc.commands,
+				BakeTime: 10 * time.Millisecond,
+				Interval: time.Millisecond,
+			}
+			cd := &fakeTestTrafficCodeDeploy{status: codedeploy.DeploymentStatusReady}
+			app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+				CodeDeploy: cd,
+				ELBv2:      &fakeTestTrafficELBv2{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.WaitForCodeDeployWithValidation(context.Background(), dg, "d-TEST")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error %q, got %v", tc.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if cd.continued != tc.continued || cd.stopped != tc.stopped {
+				t.Errorf("unexpected continued:%v stopped:%v", cd.continued, cd.stopped)
+			}
+		})
+	}
+}
+
+func TestWaitForCodeDeployWithHTTPValidation(t *testing.T) {
+	dg := &codedeploy.DeploymentGroupInfo{
+		DeploymentGroupName: aws.String("dg"),
+		LoadBalancerInfo: &codedeploy.LoadBalancerInfo{TargetGroupPairInfoList: []*codedeploy.TargetGroupPairInfo{
+			testTargetGroupPair("web-blue", "web-green", "listener/app/web/1/prod", "listener/app/web/1/test"),
+		}},
+	}
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Host+r.URL.String())
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	testCases := []struct {
+		name      string
+		retries   int
+		continued bool
+		stopped   bool
+		err       string
+	}{
+		{
+			name:    "failed",
+			stopped: true,
+			err:     "returned 503, expected 204",
+		},
+		{
+			name:      "retried",
+			retries:   1,
+			continued: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = nil
+			conf := ecspresso.NewDefaultConfig()
+			if err := conf.Load("tests/test.yaml"); err != nil {
+				t.Fatal(err)
+			}
+			conf.Wait = &ecspresso.WaitConfig{MinInterval: time.Millisecond, MaxInterval: time.Millisecond}
+			conf.TestTrafficValidation = &ecspresso.TestTrafficValidationConfig{
+				HTTP: []*ecspresso.TestTrafficHTTPCheck{{
+					URL:           ts.URL + "/health?port={{ .Port }}&id={{ .DeploymentID }}",
+					Headers:       map[string]string{"Host": "{{ .Host }}"},
+					Status:        http.StatusNoContent,
+					Retries:       tc.retries,
+					RetryInterval: time.Millisecond,
+				}},
+			}
+			cd := &fakeTestTrafficCodeDeploy{status: codedeploy.DeploymentStatusReady}
+			app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{
+				CodeDeploy: cd,
+				ELBv2:      &fakeTestTrafficELBv2{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.WaitForCodeDeployWithValidation(context.Background(), dg, "d-TEST")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error %q, got %v", tc.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if cd.continued != tc.continued || cd.stopped != tc.stopped {
+				t.Errorf("unexpected continued:%v stopped:%v", cd.continued, cd.stopped)
+			}
+			if len(requests) != tc.retries+1 || requests[0] != "web.example.com/health?port=8080&id=d-TEST" {
+				t.Errorf("unexpected requests %v", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package ecspresso
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/fujiwara/tfstate-lookup/tfstate"
+	"github.com/pkg/errors"
+)
+
+// tfstateLookups are shared in the process to read each state only once.
+var (
+	tfstateLookupsMu sync.Mutex
+	tfstateLookups   = map[string]*tfstateLookup{}
+)
+
+// tfstateLookup looks up values in the tfstate at the location.
+// The state is read once, and looked up values are memoized.
+// When the cache TTL is set, looked up values are also cached in a file to be shared by following commands.
+type tfstateLookup struct {
+	loc       string
+	cachePath string
+	ttl       time.Duration
+
+	once  sync.Once
+	state *tfstate.TFState
+	err   error
+
+	mu        sync.Mutex
+	fetchedAt time.Time
+	values    map[string]string
+}
+
+type tfstateCache struct {
+	Location  string            `json:"location"`
+	FetchedAt time.Time         `json:"fetched_at"`
+	Values    map[string]string `json:"values"`
+}
+
+var tfstateCacheDir = defaultTFStateCacheDir
+
+func defaultTFStateCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "ecspresso", "tfstate")
+}
+
+// newTFStateLookup returns the lookup of the location shared in the process.
+// The state is read immediately unless the cache in the file is fresh.
+func newTFStateLookup(loc string, ttl time.Duration) (*tfstateLookup, error) {
+	tfstateLookupsMu.Lock()
+	defer tfstateLookupsMu.Unlock()
+	key := loc
+	if !strings.Contains(loc, "://") {
+		// relative paths refer to different states in different working directories
+		if abs, err := filepath.Abs(loc); err == nil {
+			key = abs
+		}
+	}
+	if l, ok := tfstateLookups[key]; ok {
+		return l, l.err
+	}
+	h := sha256.Sum256([]byte(key))
+	l := &tfstateLookup{
+		loc:       loc,
+		ttl:       ttl,
+		cachePath: filepath.Join(tfstateCacheDir(), fmt.Sprintf("%x.json", h[:8])),
+		values:    map[string]string{},
+	}
+	if !l.readCache() {
+		l.fetchedAt = time.Now()
+		if err := l.readState(); err != nil {
+			return nil, err
+		}
+	}
+	tfstateLookups[key] = l
+	return l, nil
+}
+
+func (l *tfstateLookup) readState() error {
+	l.once.Do(func() {
+		l.state, l.err = tfstate.ReadURL(l.loc)
+		if l.err != nil {
+			l.err = errors.Wrapf(l.err, "failed to read tfstate: %s", l.loc)
+		}
+	})
+	return l.err
+}
+
+func (l *tfstateLookup) readCache() bool {
+	if l.ttl <= 0 {
+		return false
+	}
+	b, err := ioutil.ReadFile(l.cachePath)
+	if err != nil {
+		return false
+	}
+	var cache tfstateCache
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return false
+	}
+	if cache.Location != l.loc || time.Since(cache.FetchedAt) > l.ttl || cache.Values == nil {
+		return false
+	}
+	l.fetchedAt = cache.FetchedAt
+	l.values = cache.Values
+	return true
+}
+
+// writeCache writes the looked up values. Errors are ignored because the cache is optional.
+func (l *tfstateLookup) writeCache() {
+	if l.ttl <= 0 {
+		return
+	}
+	b, err := json.Marshal(tfstateCache{Location: l.loc, FetchedAt: l.fetchedAt, Values: l.values})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(l.cachePath), 0700); err != nil {
+		return
+	}
+	ioutil.WriteFile(l.cachePath, b, 0600)
+}
+
+func (l *tfstateLookup) lookup(addrs string) (string, error) {
+	if strings.Contains(addrs, "'") {
+		addrs = strings.ReplaceAll(addrs, "'", "\"")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if v, ok := l.values[addrs]; ok {
+		return v, nil
+	}
+	if err := l.readState(); err != nil {
+		return "", err
+	}
+	attrs, err := l.state.Lookup(addrs)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to lookup %s in tfstate", addrs)
+	}
+	if attrs.Value == nil {
+		return "", errors.Errorf("%s is not found in tfstate", addrs)
+	}
+	v := attrs.String()
+	l.values[addrs] = v
+	l.writeCache()
+	return v, nil
+}
+
+// funcMap returns template functions compatible with tfstate.FuncMap.
+func (l *tfstateLookup) funcMap() template.FuncMap {
+	nameFunc := func(addrs string) string {
+		v, err := l.lookup(addrs)
+		if err != nil {
+			panic(err.Error())
+		}
+		return v
+	}
+	return template.FuncMap{
+		"tfstate": nameFunc,
+		"tfstatef": func(format string, args ...interface{}) string {
+			return nameFunc(fmt.Sprintf(format, args...))
+		},
+	}
+}
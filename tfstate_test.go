@@ -0,0 +1,106 @@
+package ecspresso_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kayac/ecspresso"
+)
+
+const tfstateTestAddrs = "aws_ecr_repository.all['app'].repository_url"
+
+func TestTFStateLookupCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecspresso-tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer ecspresso.SetTFStateCacheDir(filepath.Join(dir, "cache"))()
+	defer ecspresso.ResetTFStateLookups()
+
+	b, err := ioutil.ReadFile("tests/terraform.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := filepath.Join(dir, "terraform.tfstate")
+	if err := ioutil.WriteFile(loc, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ecspresso.ResetTFStateLookups()
+	expected, err := ecspresso.TFStateLookup(loc, time.Hour, tfstateTestAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the state is not read again in the process
+	if err := os.Remove(loc); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ecspresso.TFStateLookup(loc, time.Hour, tfstateTestAddrs); err != nil || v != expected {
+		t.Errorf("must be looked up in the process: %s %v", v, err)
+	}
+
+	// the following command uses the cache file without reading the state
+	ecspresso.ResetTFStateLookups()
+	if v, err := ecspresso.TFStateLookup(loc, time.Hour, tfstateTestAddrs); err != nil || v != expected {
+		t.Errorf("must be looked up from the cache: %s %v", v, err)
+	}
+	if _, err := ecspresso.TFStateLookup(loc, time.Hour, "aws_ecr_repository.all['web'].repository_url"); err == nil {
+		t.Error("values not in the cache must be looked up from the state")
+	}
+
+	// the cache is not used without TTL
+	ecspresso.ResetTFStateLookups()
+	if _, err := ecspresso.TFStateLookup(loc, 0, tfstateTestAddrs); err == nil {
+		t.Error("the state must be read without the cache")
+	}
+}
+
+func TestTFStateLookupCacheOfRelativePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecspresso-tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer ecspresso.SetTFStateCacheDir(filepath.Join(dir, "cache"))()
+	defer ecspresso.ResetTFStateLookups()
+
+	b, err := ioutil.ReadFile("tests/terraform.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a", "terraform.tfstate"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.Chdir(filepath.Join(dir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	ecspresso.ResetTFStateLookups()
+	if _, err := ecspresso.TFStateLookup("terraform.tfstate", time.Hour, tfstateTestAddrs); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same relative path in another directory must not use the cache of the state in a
+	if err := os.Chdir(filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+	ecspresso.ResetTFStateLookups()
+	if _, err := ecspresso.TFStateLookup("terraform.tfstate", time.Hour, tfstateTestAddrs); err == nil {
+		t.Error("the cache of the state in another directory must not be used")
+	}
+}
@@ -0,0 +1,106 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Phases of the deployment limited by timeouts.
+const (
+	phaseRegister      = "register"
+	phaseUpdateService = "update_service"
+	phaseWait          = "wait"
+	phaseCodeDeploy    = "code_deploy"
+)
+
+// remainingReportInterval is the interval to report the remaining time of the phase while waiting.
+const remainingReportInterval = time.Minute
+
+// TimeoutsConfig represents timeouts of phases of the deployment.
+// Zero values are limited only by the global timeout.
+type TimeoutsConfig struct {
+	Register      time.Duration `yaml:"register,omitempty"`
+	UpdateService time.Duration `yaml:"update_service,omitempty"`
+	Wait          time.Duration `yaml:"wait,omitempty"`
+	CodeDeploy    time.Duration `yaml:"code_deploy,omitempty"`
+}
+
+func (c *TimeoutsConfig) validate() error {
+	for phase, t := range c.timeouts() {
+		if t < 0 {
+			return errors.Errorf("timeouts.%s must be positive: %s", phase, t)
+		}
+	}
+	return nil
+}
+
+func (c *TimeoutsConfig) timeouts() map[string]time.Duration {
+	return map[string]time.Duration{
+		phaseRegister:      c.Register,
+		phaseUpdateService: c.UpdateService,
+		phaseWait:          c.Wait,
+		phaseCodeDeploy:    c.CodeDeploy,
+	}
+}
+
+// phaseTimeout returns the timeout of the phase. It falls back to the global timeout.
+func (c *Config) phaseTimeout(phase string) time.Duration {
+	if c.Timeouts != nil {
+		if t := c.Timeouts.timeouts()[phase]; t > 0 {
+			return t
+		}
+	}
+	return c.Timeout
+}
+
+// withPhaseTimeout returns the context limited by the timeout of the phase.
+// The global timeout still limits the phase when it expires earlier.
+func (d *App) withPhaseTimeout(ctx context.Context, phase string) (context.Context, context.CancelFunc) {
+	if d.config.Timeouts == nil || d.config.Timeouts.timeouts()[phase] <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d.config.Timeouts.timeouts()[phase])
+}
+
+// phaseTimeoutError annotates the error when the phase is timed out.
+func (d *App) phaseTimeoutError(ctx context.Context, phase string, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	return withExitCode(ExitCodeTimeout, errors.Wrapf(err, "%s timed out after %s", phase, d.config.phaseTimeout(phase)))
+}
+
+// remainingTime returns the remaining time of the context.
+func remainingTime(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	if r := time.Until(deadline); r > 0 {
+		return r.Round(time.Second), true
+	}
+	return 0, true
+}
+
+func formatRemainingTime(phase string, remaining time.Duration) string {
+	return fmt.Sprintf("%s: %s remaining", phase, remaining)
+}
+
+// remainingReporter logs the remaining time of the phase at intervals.
+type remainingReporter struct {
+	d        *App
+	phase    string
+	reported time.Time
+}
+
+func (r *remainingReporter) report(ctx context.Context) {
+	remaining, ok := remainingTime(ctx)
+	if !ok || time.Since(r.reported) < remainingReportInterval {
+		return
+	}
+	r.reported = time.Now()
+	r.d.Log(formatRemainingTime(r.phase, remaining))
+}
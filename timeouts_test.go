@@ -0,0 +1,78 @@
+package ecspresso_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func TestPhaseTimeout(t *testing.T) {
+	conf := &ecspresso.Config{Timeout: 10 * time.Minute}
+	if got := ecspresso.PhaseTimeout(conf, "wait"); got != 10*time.Minute {
+		t.Errorf("unexpected timeout without timeouts: %s", got)
+	}
+	conf.Timeouts = &ecspresso.TimeoutsConfig{Wait: 3 * time.Minute}
+	testCases := map[string]time.Duration{
+		"register":       10 * time.Minute,
+		"update_service": 10 * time.Minute,
+		"wait":           3 * time.Minute,
+		"code_deploy":    10 * time.Minute,
+	}
+	for phase, expected := range testCases {
+		if got := ecspresso.PhaseTimeout(conf, phase); got != expected {
+			t.Errorf("unexpected timeout of %s: %s expected %s", phase, got, expected)
+		}
+	}
+}
+
+func TestTimeoutsConfigValidate(t *testing.T) {
+	conf := &ecspresso.Config{}
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeouts = &ecspresso.TimeoutsConfig{Register: -time.Second}
+	if err := conf.Restrict(); err == nil {
+		t.Error("negative timeout must be invalid")
+	}
+	conf.Timeouts = &ecspresso.TimeoutsConfig{Register: time.Second}
+	if err := conf.Restrict(); err != nil {
+		t.Error(err)
+	}
+}
+
+type fakeSlowRegisterECS struct {
+	fakeECS
+}
+
+func (c *fakeSlowRegisterECS) RegisterTaskDefinitionWithContext(ctx aws.Context, _ *ecs.RegisterTaskDefinitionInput, _ ...request.Option) (*ecs.RegisterTaskDefinitionOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRegisterTaskDefinitionPhaseTimeout(t *testing.T) {
+	conf := &ecspresso.Config{}
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeouts = &ecspresso.TimeoutsConfig{Register: 10 * time.Millisecond}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: &fakeSlowRegisterECS{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td, err := app.LoadTaskDefinition(conf.TaskDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.RegisterTaskDefinition(context.Background(), td)
+	if err == nil {
+		t.Fatal("register must be timed out")
+	}
+	if code := ecspresso.ExitCodeOf(err); code != ecspresso.ExitCodeTimeout {
+		t.Errorf("unexpected exit code %d: %s", code, err)
+	}
+}
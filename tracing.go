@@ -0,0 +1,88 @@
+package ecspresso
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName              = "github.com/kayac/ecspresso"
+	tracingShutdownTimeout  = 10 * time.Second
+	otlpEndpointEnv         = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpTracesEndpointEnv   = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	tracingServiceNameValue = "ecspresso"
+)
+
+// tracingEnabled reports whether spans should be exported.
+// Tracing is enabled only when the OTLP endpoint is configured by the standard environment variables.
+func tracingEnabled() bool {
+	return os.Getenv(otlpEndpointEnv) != "" || os.Getenv(otlpTracesEndpointEnv) != ""
+}
+
+// setupTracing sets up the tracer. The spans are exported via OTLP/HTTP.
+// The exporter is configured by OTEL_EXPORTER_OTLP_* environment variables.
+func (d *App) setupTracing() error {
+	if !tracingEnabled() {
+		d.tracer = trace.NewNoopTracerProvider().Tracer(tracerName)
+		return nil
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "failed to create OTLP trace exporter")
+	}
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(tracingServiceNameValue),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	d.tracerProvider = tp
+	d.tracer = tp.Tracer(tracerName)
+	return nil
+}
+
+// Shutdown flushes the spans not exported yet.
+func (d *App) Shutdown() error {
+	if d.tracerProvider == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	return d.tracerProvider.Shutdown(ctx)
+}
+
+func (d *App) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("ecs.cluster", d.Cluster),
+		attribute.String("ecs.service", d.Service),
+	)
+	ctx, span := d.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	ps := &phaseSpan{Span: span, restore: func() {}, startedAt: time.Now()}
+	// concurrent tasks would restore the phase out of order, and their outputs are buffered and shown in order.
+	// so they stay in the phase of the caller, and the timings are not logged
+	if !inBufferedTask(ctx) {
+		ps.restore = d.enterPhase(name)
+		ps.timing = func(elapsed time.Duration) { d.logPhaseTiming(name, elapsed) }
+	}
+	return ctx, ps
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,77 @@
+package ecspresso_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestTracingShutdown(t *testing.T) {
+	for _, endpoint := range []string{"", "http://127.0.0.1:4318"} {
+		os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", endpoint)
+		c := &ecspresso.Config{
+			Region:  "ap-northeast-1",
+			Timeout: 600 * time.Second,
+			Service: "test",
+			Cluster: "default",
+		}
+		if err := c.Restrict(); err != nil {
+			t.Fatal(err)
+		}
+		app, err := ecspresso.NewApp(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := app.Shutdown(); err != nil {
+			t.Errorf("failed to shutdown with endpoint %q: %s", endpoint, err)
+		}
+	}
+	os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+}
+
+func TestPhaseOfConcurrentSpans(t *testing.T) {
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, end := app.StartSpan(context.Background(), "verify")
+	// the first span ends before the second one
+	first, started, ended := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	err = ecspresso.RunBufferedTasks(ctx, ioutil.Discard,
+		func(ctx context.Context, _ io.Writer) error {
+			_, end := app.StartSpan(ctx, "verify TaskDefinition")
+			close(first)
+			<-started
+			end()
+			close(ended)
+			return nil
+		},
+		func(ctx context.Context, _ io.Writer) error {
+			<-first
+			_, end := app.StartSpan(ctx, "verify ServiceDefinition")
+			close(started)
+			<-ended
+			end()
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := app.CurrentPhase(); p != "verify" {
+		t.Errorf("unexpected phase after concurrent spans %q", p)
+	}
+	end()
+	if p := app.CurrentPhase(); p != "" {
+		t.Errorf("unexpected phase after the span ended %q", p)
+	}
+}
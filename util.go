@@ -13,7 +13,13 @@ import (
 
 func marshalJSON(s interface{}) (*bytes.Buffer, error) {
 	var buf bytes.Buffer
-	b, err := jsonutil.BuildJSON(s)
+	var b []byte
+	var err error
+	if sv, ok := s.(*Service); ok {
+		b, err = sv.buildJSON()
+	} else {
+		b, err = jsonutil.BuildJSON(s)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +59,10 @@ func (d *App) readDefinitionFile(path string) ([]byte, error) {
 	switch filepath.Ext(path) {
 	case jsonnetExt:
 		vm := jsonnet.MakeVM()
+		vm.NativeFunction(d.imageLabelNativeFunction())
+		for k, v := range d.config.Vars {
+			vm.ExtVar(k, v)
+		}
 		for k, v := range d.ExtStr {
 			vm.ExtVar(k, v)
 		}
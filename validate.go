@@ -0,0 +1,272 @@
+package ecspresso
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"text/template"
+
+	"github.com/fatih/color"
+	gc "github.com/kayac/go-config"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+type ValidateOption struct{}
+
+// LoadForValidation loads local configuration files for validate without calling AWS APIs.
+// Problems are collected instead of failing at the first one, and reported by Validate.
+// Plugins are not set up, and NewApp returns the App which renders template functions of plugins as empty strings.
+func (c *Config) LoadForValidation(paths ...string) {
+	c.validation = true
+	c.paths = paths
+	if len(paths) == 0 {
+		c.validationProblems = append(c.validationProblems, "no config file")
+		return
+	}
+	for _, p := range paths {
+		if isRemoteConfig(p) {
+			c.validationProblems = append(c.validationProblems, fmt.Sprintf("%s: remote config files can not be validated without calling AWS APIs", p))
+			return
+		}
+	}
+	// values of wrong types are reported by validateConfigFile, and the others are loaded
+	if err := loadMergedConfig(c, paths); err != nil {
+		if _, ok := errors.Cause(err).(*yaml.TypeError); !ok {
+			c.validationProblems = append(c.validationProblems, err.Error())
+			return
+		}
+	}
+	c.dir = filepath.Dir(paths[len(paths)-1])
+	if err := c.applyEnvironment(); err != nil {
+		c.validationProblems = append(c.validationProblems, err.Error())
+	}
+	c.applyOverrides()
+	if err := c.restrict(); err != nil {
+		c.validationProblems = append(c.validationProblems, err.Error())
+	}
+}
+
+// newValidationApp returns the App which renders definition files without plugins and AWS clients.
+func newValidationApp(conf *Config) *App {
+	loader := gc.New()
+	loader.Funcs(conf.varsFuncMap())
+	loader.Data = map[string]interface{}{"Var": conf.Vars}
+	names := []string{"image_label"}
+	for _, p := range conf.Plugins {
+		ns, err := p.templateFuncNames()
+		if err != nil {
+			conf.validationProblems = append(conf.validationProblems, err.Error())
+			continue
+		}
+		names = append(names, ns...)
+	}
+	funcs := template.FuncMap{}
+	for _, name := range names {
+		funcs[name] = func(args ...interface{}) string { return "" }
+	}
+	loader.Funcs(funcs)
+	return &App{
+		Service:  conf.Service,
+		Cluster:  conf.Cluster,
+		config:   conf,
+		loader:   loader,
+		redactor: newRedactor(conf.Redaction),
+	}
+}
+
+// validateConfigFile checks the configuration file strictly (unknown keys and wrong types).
+func validateConfigFile(path string) []string {
+	b, err := gc.ReadWithEnv(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		if terr, ok := err.(*yaml.TypeError); ok {
+			return terr.Errors
+		}
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// decodeJSONStrict decodes src into v, and fails for unknown fields and wrong types.
+func decodeJSONStrict(src []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid data after the top-level value")
+	}
+	return nil
+}
+
+// missingRequiredFields returns paths of the fields which are tagged as required but not set.
+func missingRequiredFields(v reflect.Value, path string) []string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	var missing []string
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			missing = append(missing, missingRequiredFields(v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			missing = append(missing, missingRequiredFields(v.MapIndex(k), fmt.Sprintf("%s.%v", path, k))...)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			fv := v.Field(i)
+			if f.Anonymous {
+				missing = append(missing, missingRequiredFields(fv, path)...)
+				continue
+			}
+			name, _ := jsonFieldName(f)
+			p := name
+			if path != "" {
+				p = path + "." + name
+			}
+			if f.Tag.Get("required") == "true" && isEmptyValue(fv) {
+				missing = append(missing, p)
+				continue
+			}
+			missing = append(missing, missingRequiredFields(fv, p)...)
+		}
+	}
+	return missing
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	}
+	return false
+}
+
+// validateDefinition checks the definition file strictly and returns problems.
+func validateDefinition(src []byte, v interface{}) []string {
+	if err := decodeJSONStrict(src, v); err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	for _, p := range missingRequiredFields(reflect.ValueOf(v), "") {
+		problems = append(problems, p+" is required")
+	}
+	return problems
+}
+
+func (d *App) validateTaskDefinitionFile(path string) []string {
+	src, err := d.readTaskDefinitionJSON(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if fragments := d.config.TaskDefinitionFragments; len(fragments) > 0 {
+		// required fields are checked in the merged task definition
+		if src, err = d.mergeTaskDefinitionFragments(src, fragments); err != nil {
+			return []string{err.Error()}
+		}
+	}
+	if src, err = d.overlayTaskDefinition(src); err != nil {
+		return []string{err.Error()}
+	}
+	return validateDefinition(src, &TaskDefinitionInput{})
+}
+
+// validateTaskDefinitionFragment checks unknown fields and wrong types in the fragment.
+func (d *App) validateTaskDefinitionFragment(path string) []string {
+	src, err := d.readTaskDefinitionJSON(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if err := decodeJSONStrict(src, &TaskDefinitionInput{}); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+func (d *App) validateServiceDefinitionFile(path string) []string {
+	src, err := d.readDefinitionFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if src, err = d.overlayServiceDefinition(src); err != nil {
+		return []string{err.Error()}
+	}
+	return validateDefinition(src, &Service{})
+}
+
+func (d *App) validateDefinitionFile(path string, v interface{}) []string {
+	src, err := d.readDefinitionFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return validateDefinition(src, v)
+}
+
+// Validate checks the configuration file and definition files without calling AWS APIs.
+func (d *App) Validate(opt ValidateOption) error {
+	var problems int
+	report := func(name string, ps []string) {
+		if len(ps) == 0 {
+			fmt.Printf("%s --> %s\n", name, color.GreenString("[OK]"))
+			return
+		}
+		fmt.Printf("%s --> %s\n", name, color.RedString("[NG]"))
+		for _, p := range ps {
+			fmt.Printf("  %s\n", p)
+		}
+		problems += len(ps)
+	}
+
+	for _, path := range d.config.paths {
+		if !isRemoteConfig(path) {
+			report("config "+path, validateConfigFile(path))
+		}
+	}
+	ps := d.config.validationProblems
+	if d.config.Region == "" {
+		ps = append(ps, "region is not defined (or AWS_REGION environment variable)")
+	}
+	if d.config.TaskDefinitionPath == "" {
+		ps = append(ps, "task_definition is required")
+	}
+	report("config", ps)
+
+	if path := d.config.TaskDefinitionPath; path != "" {
+		report("task definition "+path, d.validateTaskDefinitionFile(path))
+	}
+	for _, path := range d.config.TaskDefinitionFragments {
+		report("task definition fragment "+path, d.validateTaskDefinitionFragment(path))
+	}
+	if path := d.config.ServiceDefinitionPath; path != "" {
+		report("service definition "+path, d.validateServiceDefinitionFile(path))
+	}
+	if path := d.config.AutoScalingDefinitionPath; path != "" {
+		report("autoscaling definition "+path, d.validateDefinitionFile(path, &AutoScalingDefinition{}))
+	}
+
+	if problems > 0 {
+		return withExitCode(ExitCodeVerifyFailed, errors.Errorf("%d problems found", problems))
+	}
+	d.Log("Validation OK")
+	return nil
+}
@@ -0,0 +1,144 @@
+package ecspresso_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestValidateConfigFile(t *testing.T) {
+	if ps := ecspresso.ValidateConfigFile("tests/test.yaml"); len(ps) != 0 {
+		t.Errorf("unexpected problems %v", ps)
+	}
+	ps := ecspresso.ValidateConfigFile("tests/invalid-config.yml")
+	if len(ps) != 2 {
+		t.Fatalf("unexpected problems %v", ps)
+	}
+	if !strings.Contains(ps[0], "servise") || !strings.Contains(ps[1], "into bool") {
+		t.Errorf("unexpected problems %v", ps)
+	}
+}
+
+func TestValidateTaskDefinition(t *testing.T) {
+	testCases := []struct {
+		src     string
+		problem string
+	}{
+		{
+			src:     `{"family":"app","containerDefinitions":[{"name":"app","image":"nginx"}]}`,
+			problem: "",
+		},
+		{
+			src:     `{"containerDefinitions":[{"name":"app","image":"nginx"}]}`,
+			problem: "family is required",
+		},
+		{
+			src:     `{"family":"app","containerDefinitions":[{"name":"app","image":"nginx","portMapping":[]}]}`,
+			problem: `unknown field "portMapping"`,
+		},
+		{
+			src:     `{"family":"app","containerDefinitions":[{"name":"app","image":"nginx","cpu":"256"}]}`,
+			problem: "cannot unmarshal string",
+		},
+	}
+	for _, tc := range testCases {
+		ps := ecspresso.ValidateTaskDefinition([]byte(tc.src))
+		if tc.problem == "" {
+			if len(ps) != 0 {
+				t.Errorf("unexpected problems of %s: %v", tc.src, ps)
+			}
+			continue
+		}
+		if len(ps) != 1 || !strings.Contains(ps[0], tc.problem) {
+			t.Errorf("unexpected problems of %s: %v", tc.src, ps)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := &ecspresso.Config{}
+	if err := c.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Validate(ecspresso.ValidateOption{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateLoadForValidation(t *testing.T) {
+	// type errors in the config are reported by validate instead of failing in loading
+	c := ecspresso.NewDefaultConfig()
+	c.LoadForValidation("tests/invalid-config.yml")
+	app, err := ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Validate(ecspresso.ValidateOption{})
+	if err == nil || !strings.Contains(err.Error(), "2 problems found") {
+		t.Errorf("unexpected result %v", err)
+	}
+	if code := ecspresso.ExitCodeOf(err); code != ecspresso.ExitCodeVerifyFailed {
+		t.Errorf("unexpected exit code %d", code)
+	}
+
+	// plugins are not set up
+	os.Setenv("TAG", "testing")
+	c = ecspresso.NewDefaultConfig()
+	c.LoadForValidation("tests/ecspresso.yml")
+	app, err = ecspresso.NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Validate(ecspresso.ValidateOption{}); err != nil {
+		t.Error(err)
+	}
+}
+
+type testSchema struct {
+	Properties map[string]json.RawMessage `json:"properties"`
+	Required   []string                   `json:"required"`
+}
+
+func generateTestSchema(t *testing.T, schemaType string) *testSchema {
+	s, err := ecspresso.GenerateSchema(schemaType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ts testSchema
+	if err := json.Unmarshal(b, &ts); err != nil {
+		t.Fatal(err)
+	}
+	return &ts
+}
+
+func TestGenerateSchema(t *testing.T) {
+	s := generateTestSchema(t, "config")
+	for _, key := range []string{"region", "cluster", "service", "task_definition", "timeout", "aws", "environments", "vars"} {
+		if _, ok := s.Properties[key]; !ok {
+			t.Errorf("%s is not found in the config schema", key)
+		}
+	}
+	if strings.Join(s.Required, ",") != "task_definition" {
+		t.Errorf("unexpected required keys of config %v", s.Required)
+	}
+
+	s = generateTestSchema(t, "task-definition")
+	if strings.Join(s.Required, ",") != "containerDefinitions,family" {
+		t.Errorf("unexpected required fields of task definition %v", s.Required)
+	}
+
+	if _, err := ecspresso.GenerateSchema("unknown"); err == nil {
+		t.Error("unknown schema type must be an error")
+	}
+}
@@ -0,0 +1,50 @@
+package ecspresso_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestSetVars(t *testing.T) {
+	conf := &ecspresso.Config{Environment: "stg"}
+	if err := conf.Load("tests/environments.yml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.SetVars(map[string]string{"image_tag": "abc123", "git_sha": "0123abc"})
+	if conf.Vars["image_tag"] != "abc123" || conf.Vars["git_sha"] != "0123abc" || conf.Vars["log_level"] != "debug" {
+		t.Errorf("unexpected vars %v", conf.Vars)
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "ecspresso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"td.json":    `{"image":"nginx:{{ .Var.image_tag }}","sha":"{{ var "git_sha" }}"}`,
+		"td.jsonnet": `{image: 'nginx:' + std.extVar('image_tag'), sha: std.extVar('git_sha')}`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		b, err := app.ReadDefinitionFile(path)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !strings.Contains(string(b), `"nginx:abc123"`) || !strings.Contains(string(b), `"0123abc"`) {
+			t.Errorf("%s: unexpected output %s", name, string(b))
+		}
+	}
+}
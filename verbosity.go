@@ -0,0 +1,73 @@
+package ecspresso
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Levels of the verbosity of the output.
+const (
+	// VerbosityQuiet shows only warnings and errors.
+	VerbosityQuiet = -1
+	// VerbosityNormal is the default.
+	VerbosityNormal = 0
+	// VerbosityVerbose shows timing of phases and request IDs of failed AWS API calls.
+	VerbosityVerbose = 1
+	// VerbosityDump also dumps requests and responses of AWS API calls with secrets redacted.
+	VerbosityDump = 2
+)
+
+// isWarningMessage reports whether arguments of the log are a warning message.
+func isWarningMessage(args []interface{}) bool {
+	if len(args) == 0 {
+		return false
+	}
+	s, ok := args[0].(string)
+	return ok && strings.HasPrefix(s, "WARNING")
+}
+
+// setupRequestLogger adds the handler to log AWS API calls by the verbosity.
+// It must be called before clients are created from the session, because clients copy handlers of the session.
+func (d *App) setupRequestLogger(sess *session.Session) {
+	h := request.NamedHandler{
+		Name: "ecspresso.RequestLogger",
+		Fn:   d.logRequest,
+	}
+	if !sess.Handlers.Complete.SwapNamed(h) {
+		sess.Handlers.Complete.PushBackNamed(h)
+	}
+}
+
+func (d *App) logRequest(r *request.Request) {
+	if d.Verbosity < VerbosityVerbose {
+		return
+	}
+	api := r.ClientInfo.ServiceName + "." + r.Operation.Name
+	if r.Error != nil {
+		fields := LogFields{"request_id": r.RequestID}
+		if aerr, ok := r.Error.(awserr.Error); ok {
+			fields["code"] = aerr.Code()
+		}
+		d.Log(fmt.Sprintf("AWS API %s failed", api), fields)
+	}
+	if d.Verbosity < VerbosityDump {
+		return
+	}
+	d.log(logLevelDebug, fmt.Sprintf("AWS API %s request: %s", api, d.redactor.prettify(r.Params)))
+	if r.Error == nil {
+		d.log(logLevelDebug, fmt.Sprintf("AWS API %s response (request id %s): %s", api, r.RequestID, d.redactor.prettify(r.Data)))
+	}
+}
+
+// logPhaseTiming logs the elapsed time of the phase in the verbose mode.
+func (d *App) logPhaseTiming(phase string, elapsed time.Duration) {
+	if d.Verbosity < VerbosityVerbose {
+		return
+	}
+	d.Log(fmt.Sprintf("%s took %s", phase, elapsed.Round(time.Millisecond)), LogFields{"elapsed_seconds": elapsed.Seconds()})
+}
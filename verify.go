@@ -4,21 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/acmpca"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/aws/aws-sdk-go/service/sts"
@@ -28,6 +34,10 @@ import (
 )
 
 type verifier struct {
+	acmpca         *acmpca.ACMPCA
+	autoscaling    *autoscaling.AutoScaling
+	ec2            *ec2.EC2
+	kms            *kms.KMS
 	cwl            *cloudwatchlogs.CloudWatchLogs
 	elbv2          []*elbv2.ELBV2 // fallback to executionRole until v1.6
 	ssm            *ssm.SSM
@@ -35,10 +45,21 @@ type verifier struct {
 	ecr            *ecr.ECR
 	opt            *VerifyOption
 	isAssumed      bool
+
+	// definitions loaded once and shared by concurrent verifications. They must not be modified.
+	td *TaskDefinitionInput
+	sv *Service // nil when no service definition
+
+	mu                    sync.Mutex
+	pullThroughCacheRules []*ecr.PullThroughCacheRule
 }
 
 func newVerifier(execSess, appSess *session.Session, opt *VerifyOption) *verifier {
 	return &verifier{
+		acmpca:         acmpca.New(appSess),
+		autoscaling:    autoscaling.New(appSess),
+		ec2:            ec2.New(appSess),
+		kms:            kms.New(appSess),
 		cwl:            cloudwatchlogs.New(execSess),
 		elbv2:          []*elbv2.ELBV2{elbv2.New(appSess), elbv2.New(execSess)},
 		ssm:            ssm.New(execSess),
@@ -55,15 +76,12 @@ func (v *verifier) existsSecretValue(ctx context.Context, from string) error {
 	}
 
 	// secrets manager
-	if strings.HasPrefix(from, "arn:aws:secretsmanager:") {
-		// https://docs.aws.amazon.com/ja_jp/AmazonECS/latest/developerguide/specifying-sensitive-data-secrets.html
-		// Truncate additional params in secretsmanager Arn.
-		part := strings.Split(from, ":")
-		if len(part) < 7 {
-			return errors.New("invalid arn format")
+	if isSecretsManagerArn(from) {
+		secretArn, err := secretsManagerSecretArn(from)
+		if err != nil {
+			return err
 		}
-		secretArn := strings.Join(part[0:7], ":")
-		_, err := v.secretsmanager.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		_, err = v.secretsmanager.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
 			SecretId: &secretArn,
 		})
 		return err
@@ -99,8 +117,7 @@ func (d *App) newAssumedVerifier(sess *session.Session, executionRole *string, o
 		)
 		return newVerifier(sess, sess, opt), nil
 	}
-	assumedSess := session.New(&aws.Config{
-		Region: sess.Config.Region,
+	assumedSess := sess.Copy(&aws.Config{
 		Credentials: credentials.NewStaticCredentials(
 			*out.Credentials.AccessKeyId,
 			*out.Credentials.SecretAccessKey,
@@ -112,8 +129,10 @@ func (d *App) newAssumedVerifier(sess *session.Session, executionRole *string, o
 
 // VerifyOption represents options for Verify()
 type VerifyOption struct {
-	GetSecrets *bool
-	PutLogs    *bool
+	GetSecrets       *bool
+	PutLogs          *bool
+	PlaintextSecrets *string
+	IAM              *bool
 }
 
 type verifyResourceFunc func(context.Context) error
@@ -124,8 +143,23 @@ func (v verifySkipErr) Error() string {
 	return string(v)
 }
 
+type verifyWarnErr string
+
+func (v verifyWarnErr) Error() string {
+	return string(v)
+}
+
 // Verify verifies service / task definitions related resources are valid.
 func (d *App) Verify(opt VerifyOption) error {
+	ctx, cancel := d.Start()
+	defer cancel()
+	return d.VerifyWithContext(ctx, opt)
+}
+
+// VerifyWithContext verifies resources in configurations with the context.
+// Nil bool and string fields of the option are treated as zero values.
+func (d *App) VerifyWithContext(ctx context.Context, opt VerifyOption) (err error) {
+	fillNilOptions(&opt)
 	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
 	if err != nil {
 		return err
@@ -134,44 +168,91 @@ func (d *App) Verify(opt VerifyOption) error {
 	if err != nil {
 		return err
 	}
+	d.verifier.td = td
+	if p := d.config.ServiceDefinitionPath; p != "" {
+		if d.verifier.sv, err = d.LoadServiceDefinition(p); err != nil {
+			return err
+		}
+	}
 
-	ctx, cancel := d.Start()
+	ctx, cancel := d.withTimeout(ctx)
 	defer cancel()
+	ctx, span := d.startSpan(ctx, "verify")
+	defer func() { endSpan(span, err) }()
 
 	d.Log("Starting verify")
-	resources := []struct {
-		name string
-		fn   verifyResourceFunc
-	}{
+	resources := []verifyResourceItem{
 		{name: "TaskDefinition", fn: d.verifyTaskDefinition},
 		{name: "ServiceDefinition", fn: d.verifyServiceDefinition},
 		{name: "Cluster", fn: d.verifyCluster},
 	}
-	for _, r := range resources {
-		if err := d.verifyResource(ctx, r.name, r.fn); err != nil {
-			return err
-		}
+	if aws.BoolValue(opt.IAM) {
+		resources = append(resources, verifyResourceItem{name: "IAMPermissions", fn: d.verifyIAMPermissions})
+	}
+	err = d.verifyResources(ctx, resources)
+	if err != nil {
+		return withDefaultExitCode(ExitCodeVerifyFailed, err)
 	}
 	d.Log("Verify OK!")
 	return nil
 }
 
-var verifyResourceNestLevel = 0
+type verifyResourceItem struct {
+	name string
+	fn   verifyResourceFunc
+}
+
+type verifyOutputKey struct{}
+
+// verifyOutput represents the writer and the nest level of verifyResource in the context.
+type verifyOutput struct {
+	w     io.Writer
+	level int
+}
+
+func verifyOutputOf(ctx context.Context) verifyOutput {
+	if o, ok := ctx.Value(verifyOutputKey{}).(verifyOutput); ok {
+		return o
+	}
+	return verifyOutput{w: os.Stdout}
+}
+
+// verifyResources verifies independent resources concurrently, and prints the results in order.
+// It stops at the first failed resource in order as same as verifying them sequentially.
+func (d *App) verifyResources(ctx context.Context, resources []verifyResourceItem) error {
+	o := verifyOutputOf(ctx)
+	tasks := make([]bufferedTask, 0, len(resources))
+	for _, r := range resources {
+		r := r
+		tasks = append(tasks, func(ctx context.Context, w io.Writer) error {
+			ctx = context.WithValue(ctx, verifyOutputKey{}, verifyOutput{w: w, level: o.level})
+			return d.verifyResource(ctx, r.name, r.fn)
+		})
+	}
+	return runBufferedTasks(ctx, o.w, tasks...)
+}
 
 func (d *App) verifyResource(ctx context.Context, resourceType string, verifyFunc func(context.Context) error) error {
-	verifyResourceNestLevel++
-	defer func() { verifyResourceNestLevel-- }()
-	indent := strings.Repeat("  ", verifyResourceNestLevel)
+	o := verifyOutputOf(ctx)
+	o.level++
+	indent := strings.Repeat("  ", o.level)
 	print := func(f string, args ...interface{}) {
-		fmt.Printf(indent+f+"\n", args...)
+		fmt.Fprintf(o.w, indent+f+"\n", args...)
 	}
 	print("%s", resourceType)
+	ctx = context.WithValue(ctx, verifyOutputKey{}, o)
+	ctx, span := d.startSpan(ctx, "verify "+resourceType)
 	err := verifyFunc(ctx)
+	endSpan(span, err)
 	if err != nil {
 		if _, ok := err.(verifySkipErr); ok {
 			print("--> %s [%s] %s", resourceType, color.CyanString("SKIP"), color.CyanString(err.Error()))
 			return nil
 		}
+		if _, ok := err.(verifyWarnErr); ok {
+			print("--> %s [%s] %s", resourceType, color.YellowString("WARN"), color.YellowString(err.Error()))
+			return nil
+		}
 		print("--> %s [%s] %s", resourceType, color.RedString("NG"), color.RedString(err.Error()))
 		return errors.Wrapf(err, "verify %s failed", resourceType)
 	}
@@ -198,13 +279,19 @@ func (d *App) verifyServiceDefinition(ctx context.Context) error {
 	if d.config.ServiceDefinitionPath == "" {
 		return verifySkipErr("no ServiceDefinition")
 	}
-	sv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
-	if err != nil {
-		return err
-	}
-	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
-	if err != nil {
-		return err
+	sv, td := d.verifier.sv, d.verifier.td
+
+	if isExternalLaunchType(sv.LaunchType) {
+		// awsvpc, load balancers, etc. are not allowed for EXTERNAL. the checks of them below are no-op.
+		if err := verifyExternalServiceDefinition(sv, td); err != nil {
+			return err
+		}
+		err := d.verifyResource(ctx, "ExternalInstances", func(ctx context.Context) error {
+			return d.verifyExternalInstances(ctx)
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	// networkMode
@@ -217,64 +304,94 @@ func (d *App) verifyServiceDefinition(ctx context.Context) error {
 	}
 
 	// LB
+	lbs := make([]verifyResourceItem, 0, len(sv.LoadBalancers))
 	for i, lb := range sv.LoadBalancers {
-		name := fmt.Sprintf("LoadBalancer[%d]", i)
-		err := d.verifyResource(ctx, name, func(context.Context) error {
-			out, err := d.verifier.elbv2[0].DescribeTargetGroupsWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
-				TargetGroupArns: []*string{lb.TargetGroupArn},
-			})
-			if err != nil && d.verifier.isAssumed {
-				fmt.Fprintln(
-					os.Stderr,
-					color.YellowString(
-						"WARNING: verifying the target group using the task execution role has been DEPRECATED and will be removed in the future. "+
-							"Allow `elasticloadbalancing: DescribeTargetGroups` to the role that executes ecspresso."),
-				)
-				out, err = d.verifier.elbv2[1].DescribeTargetGroupsWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
-					TargetGroupArns: []*string{lb.TargetGroupArn},
-				})
-			}
-			if err != nil {
-				return err
-			} else if len(out.TargetGroups) == 0 {
-				return errors.Errorf("target group %s is not found", *lb.TargetGroupArn)
-			}
-			d.DebugLog(out.GoString())
-			tgPort := aws.Int64Value(out.TargetGroups[0].Port)
-			cPort := aws.Int64Value(lb.ContainerPort)
-			if tgPort != cPort {
-				return errors.Errorf("target group's port %d and container's port %d mismatch", tgPort, cPort)
-			}
+		lb := lb
+		lbs = append(lbs, verifyResourceItem{
+			name: fmt.Sprintf("LoadBalancer[%d]", i),
+			fn: func(ctx context.Context) error {
+				return d.verifyLoadBalancer(ctx, lb, td)
+			},
+		})
+	}
+	if err := d.verifyResources(ctx, lbs); err != nil {
+		return err
+	}
+	if len(sv.LoadBalancers) == 0 && sv.HealthCheckGracePeriodSeconds != nil {
+		return errors.Errorf("service has no load balancers, but healthCheckGracePeriodSeconds is defined.")
+	}
 
-			cname := aws.StringValue(lb.ContainerName)
-			var container *ecs.ContainerDefinition
-			for _, c := range td.ContainerDefinitions {
-				if aws.StringValue(c.Name) == cname {
-					container = c
-					break
-				}
-			}
-			if container == nil {
-				return errors.Errorf("container name %s is not defined in task definition", cname)
-			}
-			return nil
+	if isServiceConnectEnabled(sv.ServiceConnectConfiguration) {
+		if err := d.verifyServiceConnect(ctx, sv, td); err != nil {
+			return err
+		}
+	}
+
+	if len(sv.PlacementConstraints) > 0 || len(sv.PlacementStrategy) > 0 || len(td.PlacementConstraints) > 0 {
+		err := d.verifyResource(ctx, "Placement", func(ctx context.Context) error {
+			return d.verifyPlacement(ctx, sv, td)
 		})
 		if err != nil {
 			return err
 		}
 	}
-	if len(sv.LoadBalancers) == 0 && sv.HealthCheckGracePeriodSeconds != nil {
-		return errors.Errorf("service has no load balancers, but healthCheckGracePeriodSeconds is defined.")
+
+	for _, vc := range sv.VolumeConfigurations {
+		name := fmt.Sprintf("VolumeConfiguration[%s]", aws.StringValue(vc.Name))
+		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
+			return d.verifyVolumeConfiguration(ctx, vc)
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (d *App) verifyTaskDefinition(ctx context.Context) error {
-	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+func (d *App) verifyLoadBalancer(ctx context.Context, lb *ecs.LoadBalancer, td *TaskDefinitionInput) error {
+	out, err := d.verifier.elbv2[0].DescribeTargetGroupsWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: []*string{lb.TargetGroupArn},
+	})
+	if err != nil && d.verifier.isAssumed {
+		fmt.Fprintln(
+			os.Stderr,
+			color.YellowString(
+				"WARNING: verifying the target group using the task execution role has been DEPRECATED and will be removed in the future. "+
+					"Allow `elasticloadbalancing: DescribeTargetGroups` to the role that executes ecspresso."),
+		)
+		out, err = d.verifier.elbv2[1].DescribeTargetGroupsWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
+			TargetGroupArns: []*string{lb.TargetGroupArn},
+		})
+	}
 	if err != nil {
 		return err
+	} else if len(out.TargetGroups) == 0 {
+		return errors.Errorf("target group %s is not found", *lb.TargetGroupArn)
+	}
+	d.DebugLog(out.GoString())
+	tgPort := aws.Int64Value(out.TargetGroups[0].Port)
+	cPort := aws.Int64Value(lb.ContainerPort)
+	if tgPort != cPort {
+		return errors.Errorf("target group's port %d and container's port %d mismatch", tgPort, cPort)
+	}
+
+	cname := aws.StringValue(lb.ContainerName)
+	var container *ecs.ContainerDefinition
+	for _, c := range td.ContainerDefinitions {
+		if aws.StringValue(c.Name) == cname {
+			container = c
+			break
+		}
 	}
+	if container == nil {
+		return errors.Errorf("container name %s is not defined in task definition", cname)
+	}
+	return nil
+}
+
+func (d *App) verifyTaskDefinition(ctx context.Context) error {
+	td := d.verifier.td
 
 	if execRole := td.ExecutionRoleArn; execRole != nil {
 		name := fmt.Sprintf("ExecutionRole[%s]", *execRole)
@@ -295,16 +412,40 @@ func (d *App) verifyTaskDefinition(ctx context.Context) error {
 		}
 	}
 
-	for _, c := range td.ContainerDefinitions {
-		name := fmt.Sprintf("ContainerDefinition[%s]", aws.StringValue(c.Name))
+	if isWindowsFamily(td.RuntimePlatform) {
+		name := fmt.Sprintf("RuntimePlatform[%s]", aws.StringValue(td.RuntimePlatform.OperatingSystemFamily))
 		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
-			return d.verifyContainer(ctx, c)
+			isFargateService, err := d.isFargateService()
+			if err != nil {
+				return err
+			}
+			return verifyWindowsTaskDefinition(td, isFargateService)
 		})
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+
+	if requiresAccelerators(td) {
+		err := d.verifyResource(ctx, "Accelerators", func(ctx context.Context) error {
+			return d.verifyAccelerators(ctx, td)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	containers := make([]verifyResourceItem, 0, len(td.ContainerDefinitions))
+	for _, c := range td.ContainerDefinitions {
+		c := c
+		containers = append(containers, verifyResourceItem{
+			name: fmt.Sprintf("ContainerDefinition[%s]", aws.StringValue(c.Name)),
+			fn: func(ctx context.Context) error {
+				return d.verifyContainer(ctx, c, aws.StringValue(td.ExecutionRoleArn))
+			},
+		})
+	}
+	return d.verifyResources(ctx, containers)
 }
 
 var (
@@ -320,34 +461,29 @@ func (d *App) verifyECRImage(ctx context.Context, image string) error {
 	if err != nil {
 		return err
 	}
-	token := out.AuthorizationData[0].AuthorizationToken
-	return d.verifyRegistryImage(ctx, image, "AWS", aws.StringValue(token))
+	token := aws.StringValue(out.AuthorizationData[0].AuthorizationToken)
+	if ok, err := d.verifyPullThroughCacheImage(ctx, image, token); ok {
+		return err
+	}
+	return d.verifyRegistryImage(ctx, image, "AWS", token)
 }
 
 func (d *App) verifyRegistryImage(ctx context.Context, image, user, password string) error {
-	rr := strings.SplitN(image, ":", 2)
-	image = rr[0]
-	var tag string
-	if len(rr) == 1 {
-		tag = "latest"
-	} else {
-		tag = rr[1]
-	}
+	image, tag := splitImageTag(image)
 	d.DebugLog(fmt.Sprintf("image=%s tag=%s", image, tag))
 
-	repo := registry.New(image, user, password)
-	ok, err := repo.HasImage(ctx, tag)
+	repo, ok, err := d.findRegistryImage(ctx, registry.New(image, user, password), tag)
 	if err != nil {
+		if errors.Is(err, registry.ErrUnauthorized) && password == "" {
+			return errors.Wrap(err, "credentials of the registry are not set. see Private registries in README")
+		}
 		return err
 	}
 	if !ok {
-		return errors.Errorf("%s:%s is not found in Registry", image, tag)
+		return errors.Errorf("%s is not found in Registry", joinImageTag(image, tag))
 	}
 
-	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
-	if err != nil {
-		return err
-	}
+	td := d.verifier.td
 	// when requiredCompatibilities contain only fargate, regard as fargate task definition
 	isFargateTask := len(td.RequiresCompatibilities) == 1 && *td.RequiresCompatibilities[0] == ecs.CompatibilityFargate
 	isFargateService, err := d.isFargateService()
@@ -358,7 +494,11 @@ func (d *App) verifyRegistryImage(ctx context.Context, image, user, password str
 	if arch == "" && os == "" {
 		return nil
 	}
-	ok, err = repo.HasPlatformImage(ctx, tag, arch, os)
+	var osVersion string
+	if p := td.RuntimePlatform; p != nil {
+		osVersion = windowsOSVersions[aws.StringValue(p.OperatingSystemFamily)]
+	}
+	ok, err = repo.HasPlatformImageWithOSVersion(ctx, tag, arch, os, osVersion)
 	if err != nil {
 		if errors.Is(err, registry.ErrDeprecatedManifest) || errors.Is(err, registry.ErrPullRateLimitExceeded) {
 			return verifySkipErr(err.Error())
@@ -368,18 +508,49 @@ func (d *App) verifyRegistryImage(ctx context.Context, image, user, password str
 	if ok {
 		return nil
 	}
-	return errors.Errorf("%s:%s for arch=%s os=%s is not found in Registry", image, tag, arch, os)
+	if osVersion != "" {
+		return errors.Errorf("%s for arch=%s os=%s os.version=%s is not found in Registry", joinImageTag(image, tag), arch, os, osVersion)
+	}
+	if platforms, err := repo.ImagePlatforms(ctx, tag); err != nil {
+		d.DebugLog("unable to get platforms of the image", err)
+	} else if msg := platformMismatchMessage(td.RuntimePlatform, platforms, arch, os); msg != "" {
+		return errors.Errorf("%s %s", joinImageTag(image, tag), msg)
+	}
+	return errors.Errorf("%s for arch=%s os=%s is not found in Registry", joinImageTag(image, tag), arch, os)
+}
+
+// platformMismatchMessage describes the mismatch of the cpu architecture between the task definition and platforms of the image.
+// It returns an empty string when any platform of the os has the arch.
+func platformMismatchMessage(p *ecs.RuntimePlatform, platforms []string, arch, os string) string {
+	var archs []string
+	for _, platform := range platforms {
+		po := strings.SplitN(platform, "/", 2)
+		if len(po) != 2 || po[0] != os {
+			continue
+		}
+		if po[1] == arch {
+			return ""
+		}
+		archs = append(archs, po[1])
+	}
+	if len(archs) == 0 {
+		return ""
+	}
+	cpuArch := "X86_64 (default)"
+	if p != nil && p.CpuArchitecture != nil {
+		cpuArch = aws.StringValue(p.CpuArchitecture)
+	}
+	return fmt.Sprintf(
+		"is built for %s/%s only, but runtimePlatform.cpuArchitecture is %s. build the image for %s/%s or change runtimePlatform",
+		os, strings.Join(archs, ","), cpuArch, os, arch,
+	)
 }
 
 func (d *App) isFargateService() (bool, error) {
-	p := d.config.ServiceDefinitionPath
-	if p == "" {
+	sv := d.verifier.sv
+	if sv == nil {
 		return false, nil
 	}
-	sv, err := d.LoadServiceDefinition(p)
-	if err != nil {
-		return false, err
-	}
 	if sv.PlatformVersion != nil && *sv.PlatformVersion != "" {
 		return true, nil
 	}
@@ -431,10 +602,11 @@ func (d *App) verifyImage(ctx context.Context, image string) error {
 	if ecrImageURLRegex.MatchString(image) {
 		return d.verifyECRImage(ctx, image)
 	}
-	return d.verifyRegistryImage(ctx, image, "", "")
+	user, password := registryCredentials(image)
+	return d.verifyRegistryImage(ctx, image, user, password)
 }
 
-func (d *App) verifyContainer(ctx context.Context, c *ecs.ContainerDefinition) error {
+func (d *App) verifyContainer(ctx context.Context, c *ecs.ContainerDefinition, executionRoleArn string) error {
 	image := aws.StringValue(c.Image)
 	name := fmt.Sprintf("Image[%s]", image)
 	err := d.verifyResource(ctx, name, func(ctx context.Context) error {
@@ -443,6 +615,22 @@ func (d *App) verifyContainer(ctx context.Context, c *ecs.ContainerDefinition) e
 	if err != nil {
 		return err
 	}
+	if d.config.ImageTagPolicy != nil {
+		err := d.verifyResource(ctx, "ImageTagPolicy", func(ctx context.Context) error {
+			return d.verifyImageTagPolicy(ctx, image)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(c.Environment) > 0 {
+		err := d.verifyResource(ctx, "Environment", func(ctx context.Context) error {
+			return d.verifyPlaintextSecrets(ctx, c)
+		})
+		if err != nil {
+			return err
+		}
+	}
 	for _, secret := range c.Secrets {
 		name := fmt.Sprintf("Secret %s[%s]", *secret.Name, *secret.ValueFrom)
 		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
@@ -451,6 +639,19 @@ func (d *App) verifyContainer(ctx context.Context, c *ecs.ContainerDefinition) e
 		if err != nil {
 			return err
 		}
+		if isSecretsManagerArn(*secret.ValueFrom) {
+			secretArn, err := secretsManagerSecretArn(*secret.ValueFrom)
+			if err != nil {
+				return err
+			}
+			name := fmt.Sprintf("Secret %s KMSKey", *secret.Name)
+			err = d.verifyResource(ctx, name, func(ctx context.Context) error {
+				return d.verifySecretKMSKey(ctx, secretArn, executionRoleArn)
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
 	if c.LogConfiguration != nil && aws.StringValue(c.LogConfiguration.LogDriver) == "awslogs" {
 		err := d.verifyResource(ctx, "LogConfiguration[awslogs]", func(ctx context.Context) error {
@@ -459,6 +660,14 @@ func (d *App) verifyContainer(ctx context.Context, c *ecs.ContainerDefinition) e
 		if err != nil {
 			return err
 		}
+		if group := aws.StringValue(c.LogConfiguration.Options["awslogs-group"]); group != "" {
+			err := d.verifyResource(ctx, fmt.Sprintf("LogGroupKMSKey[%s]", group), func(ctx context.Context) error {
+				return d.verifyLogGroupKMSKey(ctx, group)
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -521,6 +730,10 @@ func parseRoleArn(arn string) (roleName string, err error) {
 }
 
 func (d *App) verifyRole(ctx context.Context, arn string) error {
+	return d.verifyRoleAssumedBy(ctx, arn, "ecs-tasks.amazonaws.com")
+}
+
+func (d *App) verifyRoleAssumedBy(ctx context.Context, arn string, principal string) error {
 	roleName, err := parseRoleArn(arn)
 	if err != nil {
 		return err
@@ -536,11 +749,11 @@ func (d *App) verifyRole(ctx context.Context, arn string) error {
 		return errors.Wrap(err, "failed to parse IAM policy document")
 	}
 	for _, st := range doc.Statement {
-		if st.Principal.Service == "ecs-tasks.amazonaws.com" && st.Action == "sts:AssumeRole" {
+		if st.Principal.Service == principal && st.Action == "sts:AssumeRole" {
 			return nil
 		}
 	}
-	return errors.Errorf("executionRole %s has not a valid policy document", roleName)
+	return errors.Errorf("role %s has not a valid policy document for %s", roleName, principal)
 }
 
 type iamPolicyDocument struct {
@@ -123,6 +123,46 @@ func TestNormalizePlatform(t *testing.T) {
 	}
 }
 
+func TestPlatformMismatchMessage(t *testing.T) {
+	x86 := &ecs.RuntimePlatform{CpuArchitecture: aws.String(ecs.CPUArchitectureX8664)}
+	testCases := []struct {
+		platform  *ecs.RuntimePlatform
+		platforms []string
+		arch      string
+		want      string
+	}{
+		{
+			platform:  x86,
+			platforms: []string{"linux/arm64"},
+			arch:      "amd64",
+			want:      "is built for linux/arm64 only, but runtimePlatform.cpuArchitecture is X86_64. build the image for linux/amd64 or change runtimePlatform",
+		},
+		{
+			platform:  nil,
+			platforms: []string{"linux/arm64", "windows/amd64"},
+			arch:      "amd64",
+			want:      "is built for linux/arm64 only, but runtimePlatform.cpuArchitecture is X86_64 (default). build the image for linux/amd64 or change runtimePlatform",
+		},
+		{
+			platform:  x86,
+			platforms: []string{"linux/arm64", "linux/amd64"},
+			arch:      "amd64",
+			want:      "",
+		},
+		{
+			platform:  x86,
+			platforms: []string{"windows/amd64"},
+			arch:      "amd64",
+			want:      "",
+		},
+	}
+	for _, c := range testCases {
+		if got := ecspresso.PlatformMismatchMessage(c.platform, c.platforms, c.arch, "linux"); got != c.want {
+			t.Errorf("unexpected message for %v: %q", c.platforms, got)
+		}
+	}
+}
+
 func TestParseRoleArn(t *testing.T) {
 	for _, s := range testRoleArns {
 		name, err := ecspresso.ParseRoleArn(s.arn)
@@ -0,0 +1,163 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+)
+
+// privateNetwork represents subnets of tasks which reach AWS services only by VPC endpoints.
+type privateNetwork struct {
+	routeTableIDs    []string
+	subnetCIDRs      []string
+	securityGroupIDs []string
+}
+
+// endpointServiceOf returns the service of the VPC endpoint. e.g. com.amazonaws.ap-northeast-1.ecr.dkr -> ecr.dkr
+func endpointServiceOf(e *ec2.VpcEndpoint) string {
+	if p := strings.SplitN(aws.StringValue(e.ServiceName), ".", 4); len(p) == 4 {
+		return p[3]
+	}
+	return ""
+}
+
+func (d *App) verifyVPCEndpoints(ctx context.Context, vpcID string, required []string, private *privateNetwork) error {
+	out, err := d.ec2.DescribeVpcEndpointsWithContext(ctx, &ec2.DescribeVpcEndpointsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{vpcID})}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to describe VPC endpoints")
+	}
+	var groupIDs []string
+	for _, e := range out.VpcEndpoints {
+		for _, g := range e.Groups {
+			groupIDs = appendIfMissing(groupIDs, aws.StringValue(g.GroupId))
+		}
+	}
+	sgs := map[string]*ec2.SecurityGroup{}
+	if len(groupIDs) > 0 {
+		sgOut, err := d.ec2.DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: aws.StringSlice(groupIDs)})
+		if err != nil {
+			return errors.Wrap(err, "failed to describe security groups of VPC endpoints")
+		}
+		for _, sg := range sgOut.SecurityGroups {
+			sgs[aws.StringValue(sg.GroupId)] = sg
+		}
+	}
+
+	// check all endpoints to report every unreachable endpoint
+	var unreachable []string
+	for _, svc := range required {
+		svc := svc
+		if err := d.verifyResource(ctx, fmt.Sprintf("VPCEndpoint[%s]", svc), func(context.Context) error {
+			return checkVPCEndpoint(svc, out.VpcEndpoints, private, sgs)
+		}); err != nil {
+			unreachable = append(unreachable, svc)
+		}
+	}
+	if len(unreachable) > 0 {
+		return errors.Errorf("tasks in private subnets can't reach VPC endpoints of %s", strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+// checkVPCEndpoint checks tasks in the private network can reach the VPC endpoint of the service.
+func checkVPCEndpoint(svc string, endpoints []*ec2.VpcEndpoint, private *privateNetwork, sgs map[string]*ec2.SecurityGroup) error {
+	var found *ec2.VpcEndpoint
+	for _, e := range endpoints {
+		if endpointServiceOf(e) == svc && aws.StringValue(e.State) == "available" {
+			found = e
+			break
+		}
+	}
+	if found == nil {
+		return errors.Errorf("VPC endpoint of %s is not found in the VPC", svc)
+	}
+
+	if aws.StringValue(found.VpcEndpointType) == ec2.VpcEndpointTypeGateway {
+		var missing []string
+		for _, id := range private.routeTableIDs {
+			if !containsString(aws.StringValueSlice(found.RouteTableIds), id) {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			return errors.Errorf("gateway endpoint %s is not associated with route tables %s", aws.StringValue(found.VpcEndpointId), strings.Join(missing, ", "))
+		}
+		return nil
+	}
+
+	if !aws.BoolValue(found.PrivateDnsEnabled) {
+		return errors.Errorf("private DNS of interface endpoint %s is disabled. tasks can't resolve the endpoint by the default name", aws.StringValue(found.VpcEndpointId))
+	}
+	for _, g := range found.Groups {
+		if sg, ok := sgs[aws.StringValue(g.GroupId)]; ok && ingressAllowsHTTPSFrom(sg, private) {
+			return nil
+		}
+	}
+	return errors.Errorf("security groups of interface endpoint %s don't allow HTTPS (443) from tasks", aws.StringValue(found.VpcEndpointId))
+}
+
+// ingressAllowsHTTPSFrom reports whether the security group allows HTTPS from security groups of tasks or all private subnets.
+func ingressAllowsHTTPSFrom(sg *ec2.SecurityGroup, private *privateNetwork) bool {
+	for _, p := range sg.IpPermissions {
+		proto := aws.StringValue(p.IpProtocol)
+		if proto != "-1" && !(proto == "tcp" && aws.Int64Value(p.FromPort) <= 443 && aws.Int64Value(p.ToPort) >= 443) {
+			continue
+		}
+		for _, g := range p.UserIdGroupPairs {
+			if containsString(private.securityGroupIDs, aws.StringValue(g.GroupId)) {
+				return true
+			}
+		}
+		var nets []*net.IPNet
+		for _, r := range p.IpRanges {
+			if _, n, err := net.ParseCIDR(aws.StringValue(r.CidrIp)); err == nil {
+				nets = append(nets, n)
+			}
+		}
+		if coversSubnets(nets, private.subnetCIDRs) {
+			return true
+		}
+	}
+	return false
+}
+
+// coversSubnets reports whether every subnet is in any of nets.
+func coversSubnets(nets []*net.IPNet, subnets []string) bool {
+	if len(nets) == 0 || len(subnets) == 0 {
+		return false
+	}
+	for _, s := range subnets {
+		ip, sn, err := net.ParseCIDR(s)
+		if err != nil {
+			return false
+		}
+		ones, _ := sn.Mask.Size()
+		covered := false
+		for _, n := range nets {
+			if nOnes, _ := n.Mask.Size(); n.Contains(ip) && nOnes <= ones {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package ecspresso
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
+)
+
+// Default intervals of polling while waiting for the service stable.
+const (
+	DefaultWaitMinInterval = 5 * time.Second
+	DefaultWaitMaxInterval = 30 * time.Second
+)
+
+// waitIntervalGrowth is the interval growth per the elapsed time of the deployment.
+// e.g. the interval grows 6 seconds per minute.
+const waitIntervalGrowth = 10
+
+// WaitConfig represents a configuration of polling intervals while waiting for deployments.
+type WaitConfig struct {
+	MinInterval time.Duration `yaml:"min_interval,omitempty"`
+	MaxInterval time.Duration `yaml:"max_interval,omitempty"`
+}
+
+func (c *WaitConfig) validate() error {
+	if c.MinInterval < 0 {
+		return errors.Errorf("wait.min_interval must be positive: %s", c.MinInterval)
+	}
+	if c.MaxInterval < 0 {
+		return errors.Errorf("wait.max_interval must be positive: %s", c.MaxInterval)
+	}
+	if min, max := c.intervals(); min > max {
+		return errors.Errorf("wait.min_interval %s must not be greater than wait.max_interval %s", min, max)
+	}
+	return nil
+}
+
+func (c *WaitConfig) intervals() (time.Duration, time.Duration) {
+	min, max := DefaultWaitMinInterval, DefaultWaitMaxInterval
+	if c == nil {
+		return min, max
+	}
+	if c.MinInterval > 0 {
+		min = c.MinInterval
+	}
+	if c.MaxInterval > 0 {
+		max = c.MaxInterval
+	}
+	return min, max
+}
+
+// waitPoller decides intervals of polling adaptively.
+// It polls fast right after the deployment started, and slower as the deployment ages.
+// The next poll happens immediately after new service events are observed.
+type waitPoller struct {
+	min, max  time.Duration
+	startedAt time.Time
+	now       func() time.Time
+
+	mu     sync.Mutex
+	events chan struct{}
+}
+
+func newWaitPoller(c *WaitConfig, startedAt time.Time) *waitPoller {
+	min, max := c.intervals()
+	return &waitPoller{
+		min:       min,
+		max:       max,
+		startedAt: startedAt,
+		now:       time.Now,
+		events:    make(chan struct{}, 1),
+	}
+}
+
+// interval returns the interval by the elapsed time from the start of the deployment.
+func (p *waitPoller) interval() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	iv := p.min + p.now().Sub(p.startedAt)/waitIntervalGrowth
+	if iv > p.max {
+		return p.max
+	}
+	return iv
+}
+
+// notify wakes up the waiting poll to re-check immediately.
+func (p *waitPoller) notify() {
+	select {
+	case p.events <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits for the interval or new events.
+func (p *waitPoller) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.events:
+	case <-time.After(p.interval()):
+	}
+	return nil
+}
+
+// waiterDelay returns the delay of the SDK waiter which waits by the poller.
+// The waiter sleeps nothing because the poller waits in the delay.
+func (p *waitPoller) waiterDelay(ctx context.Context) request.WaiterDelay {
+	return func(int) time.Duration {
+		p.wait(ctx)
+		return 0
+	}
+}
+
+// waiterOptions returns options of the SDK waiter polling by the poller until the timeout.
+func (p *waitPoller) waiterOptions(ctx context.Context, timeout time.Duration) []request.WaiterOption {
+	attempts := int(timeout/p.min) + 1
+	if (timeout % p.min) > 0 {
+		attempts++
+	}
+	return []request.WaiterOption{
+		request.WithWaiterDelay(p.waiterDelay(ctx)),
+		request.WithWaiterMaxAttempts(attempts),
+	}
+}
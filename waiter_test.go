@@ -0,0 +1,42 @@
+package ecspresso_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kayac/ecspresso"
+)
+
+func TestWaitPollerInterval(t *testing.T) {
+	startedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		config   *ecspresso.WaitConfig
+		elapsed  time.Duration
+		expected time.Duration
+	}{
+		{nil, 0, 5 * time.Second},
+		{nil, time.Minute, 11 * time.Second},
+		{nil, 3 * time.Minute, 23 * time.Second},
+		{nil, 10 * time.Minute, 30 * time.Second},
+		{&ecspresso.WaitConfig{MinInterval: 2 * time.Second}, 0, 2 * time.Second},
+		{&ecspresso.WaitConfig{MaxInterval: time.Minute}, 30 * time.Minute, time.Minute},
+		{&ecspresso.WaitConfig{MinInterval: 10 * time.Second, MaxInterval: 15 * time.Second}, time.Minute, 15 * time.Second},
+	}
+	for _, tt := range tests {
+		iv := ecspresso.WaitPollerInterval(tt.config, startedAt, startedAt.Add(tt.elapsed))
+		if iv != tt.expected {
+			t.Errorf("interval after %s must be %s: %s", tt.elapsed, tt.expected, iv)
+		}
+	}
+}
+
+func TestWaitPollerNotified(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// waits for 1 minute unless notified
+	c := &ecspresso.WaitConfig{MinInterval: time.Minute, MaxInterval: time.Minute}
+	if err := ecspresso.WaitPollerNotified(ctx, c); err != nil {
+		t.Errorf("must return immediately after notified: %s", err)
+	}
+}
@@ -0,0 +1,226 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/pkg/errors"
+)
+
+// Conditions of wait --until.
+const (
+	WaitUntilTasksRunning        = "tasks-running"
+	WaitUntilTargetHealthy       = "target-healthy"
+	WaitUntilDeploymentCompleted = "deployment-completed"
+	WaitUntilNoPendingTasks      = "no-pending-tasks"
+)
+
+var waitUntilInterval = 10 * time.Second
+
+// waitCondition represents a condition of wait --until.
+// The format is NAME[=VALUE][,timeout=DURATION].
+type waitCondition struct {
+	name    string
+	value   string
+	timeout time.Duration
+}
+
+func (c *waitCondition) String() string {
+	if c.value == "" {
+		return c.name
+	}
+	return c.name + "=" + c.value
+}
+
+func parseWaitCondition(s string) (*waitCondition, error) {
+	parts := strings.Split(s, ",")
+	c := &waitCondition{}
+	kv := strings.SplitN(parts[0], "=", 2)
+	c.name = kv[0]
+	if len(kv) == 2 {
+		c.value = kv[1]
+	}
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] != "timeout" {
+			return nil, errors.Errorf("invalid option %q of condition %s. only timeout=DURATION is allowed", p, c.name)
+		}
+		t, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timeout of condition %s", c.name)
+		}
+		c.timeout = t
+	}
+
+	switch c.name {
+	case WaitUntilTasksRunning:
+		if n, err := strconv.ParseInt(c.value, 10, 64); err != nil || n < 0 {
+			return nil, errors.Errorf("%s requires a number of tasks. e.g. %s=3", c.name, c.name)
+		}
+	case WaitUntilDeploymentCompleted:
+		if c.value == "" {
+			return nil, errors.Errorf("%s requires a deployment ID. e.g. %s=ecs-svc/1234567890", c.name, c.name)
+		}
+	case WaitUntilTargetHealthy, WaitUntilNoPendingTasks:
+		if c.value != "" {
+			return nil, errors.Errorf("%s does not accept a value", c.name)
+		}
+	default:
+		return nil, errors.Errorf("unknown condition %s", c.name)
+	}
+	return c, nil
+}
+
+// waitUntil waits until all of the conditions are satisfied in order.
+func (d *App) waitUntil(ctx context.Context, conds []*waitCondition) error {
+	for _, c := range conds {
+		if err := d.waitCondition(ctx, c); err != nil {
+			return errors.Wrapf(err, "failed to wait until %s", c)
+		}
+	}
+	return nil
+}
+
+func (d *App) waitCondition(ctx context.Context, c *waitCondition) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	d.Log("Waiting until", c.String())
+	var last string
+	for {
+		ok, status, err := d.checkWaitCondition(ctx, c)
+		if err != nil {
+			return err
+		}
+		if ok {
+			d.Log("Condition", c.String(), "is satisfied.", status)
+			return nil
+		}
+		if status != last {
+			d.Log(status)
+			last = status
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitUntilInterval):
+		}
+	}
+}
+
+// checkWaitCondition returns whether the condition is satisfied with the current status.
+func (d *App) checkWaitCondition(ctx context.Context, c *waitCondition) (bool, string, error) {
+	if c.name == WaitUntilDeploymentCompleted && strings.HasPrefix(c.value, "d-") {
+		return d.checkCodeDeployCompleted(ctx, c.value)
+	}
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	switch c.name {
+	case WaitUntilTasksRunning:
+		n, _ := strconv.ParseInt(c.value, 10, 64)
+		running := aws.Int64Value(sv.RunningCount)
+		return running >= n, fmt.Sprintf("running:%d pending:%d", running, aws.Int64Value(sv.PendingCount)), nil
+	case WaitUntilNoPendingTasks:
+		return serviceNoPendingTasks(sv), fmt.Sprintf("pending:%d", aws.Int64Value(sv.PendingCount)), nil
+	case WaitUntilDeploymentCompleted:
+		return ecsDeploymentCompleted(sv, c.value)
+	case WaitUntilTargetHealthy:
+		return d.checkTargetsHealthy(ctx, sv)
+	}
+	return false, "", errors.Errorf("unknown condition %s", c.name)
+}
+
+func serviceNoPendingTasks(sv *ecs.Service) bool {
+	if aws.Int64Value(sv.PendingCount) > 0 {
+		return false
+	}
+	for _, dep := range sv.Deployments {
+		if aws.Int64Value(dep.PendingCount) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func ecsDeploymentCompleted(sv *ecs.Service, id string) (bool, string, error) {
+	for _, dep := range sv.Deployments {
+		if aws.StringValue(dep.Id) != id {
+			continue
+		}
+		state := aws.StringValue(dep.RolloutState)
+		status := fmt.Sprintf("%s %s", id, state)
+		switch state {
+		case ecs.DeploymentRolloutStateCompleted:
+			return true, status, nil
+		case ecs.DeploymentRolloutStateFailed:
+			return false, status, errors.Errorf("deployment %s failed: %s", id, aws.StringValue(dep.RolloutStateReason))
+		}
+		return false, status, nil
+	}
+	return false, "", errors.Errorf("deployment %s is not found in the service", id)
+}
+
+func (d *App) checkCodeDeployCompleted(ctx context.Context, id string) (bool, string, error) {
+	out, err := d.codedeploy.GetDeploymentWithContext(ctx, &codedeploy.GetDeploymentInput{
+		DeploymentId: aws.String(id),
+	})
+	if err != nil {
+		return false, "", errors.Wrapf(err, "failed to get deployment %s", id)
+	}
+	st := aws.StringValue(out.DeploymentInfo.Status)
+	status := fmt.Sprintf("%s %s", id, st)
+	switch st {
+	case codedeploy.DeploymentStatusSucceeded:
+		return true, status, nil
+	case codedeploy.DeploymentStatusFailed, codedeploy.DeploymentStatusStopped:
+		return false, status, errors.Errorf("deployment %s is %s", id, st)
+	}
+	return false, status, nil
+}
+
+func (d *App) checkTargetsHealthy(ctx context.Context, sv *ecs.Service) (bool, string, error) {
+	var tgArns []string
+	seen := map[string]bool{}
+	for _, lb := range sv.LoadBalancers {
+		if arn := aws.StringValue(lb.TargetGroupArn); arn != "" && !seen[arn] {
+			seen[arn] = true
+			tgArns = append(tgArns, arn)
+		}
+	}
+	if len(tgArns) == 0 {
+		return false, "", errors.New("the service has no target groups")
+	}
+	ok := true
+	var status []string
+	for _, arn := range tgArns {
+		out, err := d.elbv2.DescribeTargetHealthWithContext(ctx, &elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: aws.String(arn),
+		})
+		if err != nil {
+			return false, "", errors.Wrap(err, "failed to describe target health")
+		}
+		var healthy int
+		for _, th := range out.TargetHealthDescriptions {
+			if th.TargetHealth != nil && aws.StringValue(th.TargetHealth.State) == elbv2.TargetHealthStateEnumHealthy {
+				healthy++
+			}
+		}
+		total := len(out.TargetHealthDescriptions)
+		if total == 0 || healthy < total {
+			ok = false
+		}
+		status = append(status, fmt.Sprintf("%s healthy:%d/%d", arnToName(arn), healthy, total))
+	}
+	return ok, strings.Join(status, " "), nil
+}
@@ -0,0 +1,85 @@
+package ecspresso_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+var parseWaitConditionTests = []struct {
+	src    string
+	str    string
+	errMsg string
+}{
+	{src: "tasks-running=3", str: "tasks-running=3"},
+	{src: "target-healthy,timeout=5m", str: "target-healthy"},
+	{src: "deployment-completed=ecs-svc/1234567890", str: "deployment-completed=ecs-svc/1234567890"},
+	{src: "deployment-completed=d-ABCDEFGHI,timeout=10m", str: "deployment-completed=d-ABCDEFGHI"},
+	{src: "no-pending-tasks", str: "no-pending-tasks"},
+	{src: "tasks-running", errMsg: "requires a number of tasks"},
+	{src: "tasks-running=-1", errMsg: "requires a number of tasks"},
+	{src: "deployment-completed", errMsg: "requires a deployment ID"},
+	{src: "no-pending-tasks=1", errMsg: "does not accept a value"},
+	{src: "target-healthy,timeout=xx", errMsg: "invalid timeout"},
+	{src: "target-healthy,foo=bar", errMsg: "invalid option"},
+	{src: "steady", errMsg: "unknown condition"},
+}
+
+func TestParseWaitCondition(t *testing.T) {
+	for _, ts := range parseWaitConditionTests {
+		c, err := ecspresso.ParseWaitCondition(ts.src)
+		if ts.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), ts.errMsg) {
+				t.Errorf("%s: unexpected error %v expected %s", ts.src, err, ts.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", ts.src, err)
+			continue
+		}
+		if c.String() != ts.str {
+			t.Errorf("%s: unexpected condition %s expected %s", ts.src, c, ts.str)
+		}
+	}
+}
+
+func TestWaitUntilTasksRunning(t *testing.T) {
+	defer ecspresso.SetWaitUntilInterval(time.Millisecond)()
+
+	conf := ecspresso.NewDefaultConfig()
+	if err := conf.Load("tests/test.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	conf.Timeout = time.Minute
+	var describes int
+	fake := &fakeECS{
+		service: &ecs.Service{
+			ServiceName:  aws.String("test"),
+			RunningCount: aws.Int64(0),
+			PendingCount: aws.Int64(2),
+		},
+		onDescribe: func(sv *ecs.Service) {
+			describes++
+			if describes == 3 {
+				sv.RunningCount = aws.Int64(2)
+				sv.PendingCount = aws.Int64(0)
+			}
+		},
+	}
+	app, err := ecspresso.NewWithClients(conf, ecspresso.AWSClients{ECS: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	until := []string{"tasks-running=2", "no-pending-tasks"}
+	if err := app.Wait(ecspresso.WaitOption{Until: &until}); err != nil {
+		t.Fatal(err)
+	}
+	if describes != 4 {
+		t.Errorf("unexpected describe count %d", describes)
+	}
+}
@@ -0,0 +1,129 @@
+package ecspresso
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// windowsOSVersions maps the operating system families to the os.version (build) of Windows images.
+// https://learn.microsoft.com/en-us/virtualization/windowscontainers/deploy-containers/version-compatibility
+var windowsOSVersions = map[string]string{
+	ecs.OSFamilyWindowsServer2016Full: "10.0.14393",
+	ecs.OSFamilyWindowsServer2019Full: "10.0.17763",
+	ecs.OSFamilyWindowsServer2019Core: "10.0.17763",
+	ecs.OSFamilyWindowsServer2004Core: "10.0.19041",
+	ecs.OSFamilyWindowsServer20h2Core: "10.0.19042",
+	ecs.OSFamilyWindowsServer2022Full: "10.0.20348",
+	ecs.OSFamilyWindowsServer2022Core: "10.0.20348",
+	"WINDOWS_SERVER_2025_FULL":        "10.0.26100",
+	"WINDOWS_SERVER_2025_CORE":        "10.0.26100",
+}
+
+// fargateWindowsFamilies are the operating system families supported by Fargate.
+var fargateWindowsFamilies = map[string]bool{
+	ecs.OSFamilyWindowsServer2019Full: true,
+	ecs.OSFamilyWindowsServer2019Core: true,
+	ecs.OSFamilyWindowsServer2022Full: true,
+	ecs.OSFamilyWindowsServer2022Core: true,
+}
+
+// fargateWindowsMemoryRanges maps the cpu units to the range of memory (MiB) for Windows tasks on Fargate.
+// The memory must be in 1 GB increments.
+var fargateWindowsMemoryRanges = map[int64][2]int64{
+	1024: {2048, 8192},
+	2048: {4096, 16384},
+	4096: {8192, 30720},
+}
+
+func isWindowsFamily(p *ecs.RuntimePlatform) bool {
+	return p != nil && strings.HasPrefix(aws.StringValue(p.OperatingSystemFamily), "WINDOWS_SERVER_")
+}
+
+// verifyWindowsTaskDefinition verifies the task definition for Windows containers.
+func verifyWindowsTaskDefinition(td *TaskDefinitionInput, isFargateService bool) error {
+	family := aws.StringValue(td.RuntimePlatform.OperatingSystemFamily)
+	if _, ok := windowsOSVersions[family]; !ok {
+		return errors.Errorf("unknown operatingSystemFamily %s", family)
+	}
+	if errs := windowsUnsupportedFeatures(td); len(errs) > 0 {
+		return errors.Errorf("Linux-only features are not supported for Windows tasks: %s", strings.Join(errs, ", "))
+	}
+
+	isFargate := isFargateService
+	for _, c := range td.RequiresCompatibilities {
+		if aws.StringValue(c) == ecs.CompatibilityFargate {
+			isFargate = true
+		}
+	}
+	if !isFargate {
+		return nil
+	}
+	if !fargateWindowsFamilies[family] {
+		return errors.Errorf("operatingSystemFamily %s is not supported by Fargate", family)
+	}
+	return verifyFargateWindowsResources(aws.StringValue(td.Cpu), aws.StringValue(td.Memory))
+}
+
+func verifyFargateWindowsResources(cpu, memory string) error {
+	c, err := strconv.ParseInt(aws.StringValue(toNumberCPU(cpu)), 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid cpu %q for Windows tasks on Fargate", cpu)
+	}
+	m, err := strconv.ParseInt(aws.StringValue(toNumberMemory(memory)), 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid memory %q for Windows tasks on Fargate", memory)
+	}
+	r, ok := fargateWindowsMemoryRanges[c]
+	if !ok {
+		return errors.Errorf("cpu %d is not supported for Windows tasks on Fargate. supported values are 1024, 2048 and 4096", c)
+	}
+	if m < r[0] || m > r[1] || m%1024 != 0 {
+		return errors.Errorf("memory %d is not supported with cpu %d for Windows tasks on Fargate. between %d and %d in 1024 increments are supported", m, c, r[0], r[1])
+	}
+	return nil
+}
+
+// windowsUnsupportedFeatures returns Linux-only features used in the task definition.
+func windowsUnsupportedFeatures(td *TaskDefinitionInput) []string {
+	var errs []string
+	if td.PidMode != nil {
+		errs = append(errs, "pidMode")
+	}
+	if td.IpcMode != nil {
+		errs = append(errs, "ipcMode")
+	}
+	if td.ProxyConfiguration != nil {
+		errs = append(errs, "proxyConfiguration")
+	}
+	for _, c := range td.ContainerDefinitions {
+		name := aws.StringValue(c.Name)
+		add := func(feature string) {
+			errs = append(errs, fmt.Sprintf("%s of container %s", feature, name))
+		}
+		if lp := c.LinuxParameters; lp != nil {
+			if aws.BoolValue(lp.InitProcessEnabled) {
+				add("linuxParameters.initProcessEnabled")
+			} else {
+				add("linuxParameters")
+			}
+		}
+		if aws.BoolValue(c.Privileged) {
+			add("privileged")
+		}
+		if aws.BoolValue(c.ReadonlyRootFilesystem) {
+			add("readonlyRootFilesystem")
+		}
+		if len(c.Ulimits) > 0 {
+			add("ulimits")
+		}
+		if len(c.SystemControls) > 0 {
+			add("systemControls")
+		}
+	}
+	return errs
+}
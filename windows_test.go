@@ -0,0 +1,77 @@
+package ecspresso_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/kayac/ecspresso"
+)
+
+func windowsTaskDefinition(family, cpu, memory string, c *ecs.ContainerDefinition) *ecspresso.TaskDefinitionInput {
+	if c == nil {
+		c = &ecs.ContainerDefinition{Name: aws.String("app")}
+	}
+	return &ecspresso.TaskDefinitionInput{
+		Cpu:                     aws.String(cpu),
+		Memory:                  aws.String(memory),
+		RequiresCompatibilities: aws.StringSlice([]string{"FARGATE"}),
+		RuntimePlatform: &ecs.RuntimePlatform{
+			CpuArchitecture:       aws.String("X86_64"),
+			OperatingSystemFamily: aws.String(family),
+		},
+		ContainerDefinitions: []*ecs.ContainerDefinition{c},
+	}
+}
+
+func TestVerifyWindowsTaskDefinition(t *testing.T) {
+	testCases := []struct {
+		name   string
+		td     *ecspresso.TaskDefinitionInput
+		errMsg string
+	}{
+		{name: "valid", td: windowsTaskDefinition("WINDOWS_SERVER_2019_CORE", "1024", "2048", nil)},
+		{name: "vCPU unit", td: windowsTaskDefinition("WINDOWS_SERVER_2022_FULL", "4 vCPU", "30GB", nil)},
+		{name: "small cpu", td: windowsTaskDefinition("WINDOWS_SERVER_2019_CORE", "512", "2048", nil), errMsg: "cpu 512 is not supported"},
+		{name: "too large memory", td: windowsTaskDefinition("WINDOWS_SERVER_2019_CORE", "1024", "16384", nil), errMsg: "memory 16384 is not supported"},
+		{name: "memory increments", td: windowsTaskDefinition("WINDOWS_SERVER_2019_CORE", "2048", "5000", nil), errMsg: "memory 5000 is not supported"},
+		{name: "unsupported family on fargate", td: windowsTaskDefinition("WINDOWS_SERVER_2016_FULL", "1024", "2048", nil), errMsg: "not supported by Fargate"},
+		{name: "unknown family", td: windowsTaskDefinition("WINDOWS_SERVER_1999_FULL", "1024", "2048", nil), errMsg: "unknown operatingSystemFamily"},
+		{
+			name: "init process",
+			td: windowsTaskDefinition("WINDOWS_SERVER_2019_CORE", "1024", "2048", &ecs.ContainerDefinition{
+				Name:            aws.String("app"),
+				LinuxParameters: &ecs.LinuxParameters{InitProcessEnabled: aws.Bool(true)},
+			}),
+			errMsg: "linuxParameters.initProcessEnabled of container app",
+		},
+		{
+			name: "readonly root",
+			td: windowsTaskDefinition("WINDOWS_SERVER_2022_CORE", "1024", "2048", &ecs.ContainerDefinition{
+				Name:                   aws.String("app"),
+				ReadonlyRootFilesystem: aws.Bool(true),
+			}),
+			errMsg: "readonlyRootFilesystem of container app",
+		},
+	}
+	for _, tc := range testCases {
+		err := ecspresso.VerifyWindowsTaskDefinition(tc.td, false)
+		if tc.errMsg == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %s", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+			t.Errorf("%s: unexpected error %v expected %s", tc.name, err, tc.errMsg)
+		}
+	}
+
+	// EC2 launch type allows any cpu and memory
+	td := windowsTaskDefinition("WINDOWS_SERVER_2016_FULL", "512", "1024", nil)
+	td.RequiresCompatibilities = aws.StringSlice([]string{"EC2"})
+	if err := ecspresso.VerifyWindowsTaskDefinition(td, false); err != nil {
+		t.Errorf("unexpected error for EC2 %s", err)
+	}
+}